@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+)
+
+var (
+	errConfigUsage   = errors.New("usage: config validate [flags]")
+	errConfigInvalid = errors.New("configuration is invalid")
+)
+
+func runConfig(args []string) error {
+	if len(args) == 0 || args[0] != "validate" {
+		return errConfigUsage
+	}
+
+	flags := flag.NewFlagSet("config validate", flag.ContinueOnError)
+	configPath := flags.String("config", config.ConfigPath, "Path to the configuration file")
+	show := flags.Bool("show", false, "Print the effective configuration including the defaults")
+	overrides := addOverrideFlags(flags)
+
+	if err := flags.Parse(args[1:]); err != nil {
+		return fmt.Errorf("parse flags: %w", err)
+	}
+
+	cfg, err := config.Read(*configPath)
+	if err != nil {
+		return fmt.Errorf("read configuration: %w", err)
+	}
+
+	if err := overrides.apply(cfg); err != nil {
+		return err
+	}
+
+	if *show {
+		out, err := yaml.Marshal(cfg)
+		if err != nil {
+			return fmt.Errorf("marshal configuration: %w", err)
+		}
+
+		fmt.Fprint(os.Stdout, string(out))
+	}
+
+	if problems := config.Problems(cfg.Validate()); len(problems) > 0 {
+		for _, problem := range problems {
+			fmt.Fprintln(os.Stdout, problem)
+		}
+
+		return errConfigInvalid
+	}
+
+	fmt.Fprintln(os.Stdout, "Configuration is valid")
+
+	return nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/daemon"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/events"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/k8s"
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+)
+
+var (
+	errSyncNode     = errors.New("sync requires the --node flag")
+	errSyncInterval = errors.New("sync interval has to be positive")
+)
+
+func runDaemon(args []string) error {
+	return runDaemonMode("daemon", args)
+}
+
+func runSync(args []string) error {
+	return runDaemonMode("sync", args)
+}
+
+// runDaemonMode runs the daemon, which additionally reconciles the auth files
+// of the node in the sync mode.
+func runDaemonMode(name string, args []string) error {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	configPath := flags.String("config", config.ConfigPath, "Path to the configuration file")
+	kubeconfig := flags.String("kubeconfig", "", "Path to the kubeconfig with cluster level credentials, uses the in-cluster config if empty")
+	overrides := addOverrideFlags(flags)
+
+	var (
+		node     *string
+		interval *time.Duration
+	)
+
+	if name == "sync" {
+		node = flags.String("node", "", "Name of the node whose pods get their auth files reconciled")
+		interval = flags.Duration("interval", time.Minute, "Interval of the reconciliation")
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("parse flags: %w", err)
+	}
+
+	if node != nil && *node == "" {
+		return errSyncNode
+	}
+
+	if interval != nil && *interval <= 0 {
+		return errSyncInterval
+	}
+
+	cfg, err := loadConfig(*configPath, overrides)
+	if err != nil {
+		return err
+	}
+
+	if err := configureLogging(cfg); err != nil {
+		return err
+	}
+
+	events.Enable(&cfg.Events)
+
+	client, err := k8s.NewClusterClient(*kubeconfig)
+	if err != nil {
+		return fmt.Errorf("create cluster client: %w", err)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	d := daemon.New(cfg, client)
+	if node != nil {
+		d.EnableSync(*node, *interval)
+	}
+
+	if err := d.Run(ctx); err != nil {
+		return fmt.Errorf("run daemon: %w", err)
+	}
+
+	return nil
+}
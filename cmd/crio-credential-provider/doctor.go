@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/compat"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/preflight"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/state"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/warnings"
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+)
+
+func runDoctor(args []string) error {
+	flags := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	configPath := flags.String("config", config.ConfigPath, "Path to the configuration file")
+	overrides := addOverrideFlags(flags)
+	outputJSON := flags.Bool("json", false, "Print the results as JSON")
+	kubeletConfig := flags.String("kubelet-config", "", "Path to the kubelet credential provider configuration to check the matchImages against the registries configuration")
+	provider := flags.String("provider", "crio-credential-provider", "Name of the provider within the kubelet credential provider configuration")
+	images := []string{}
+	flags.Func("image", "Image to evaluate against the matchImages and the registries configuration (can be repeated)", func(value string) error {
+		images = append(images, value)
+
+		return nil
+	})
+
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("parse flags: %w", err)
+	}
+
+	cfg, err := loadConfig(*configPath, overrides)
+	if err != nil {
+		return err
+	}
+
+	result := struct {
+		Warnings      []warnings.Warning `json:"warnings"`
+		Preflight     string             `json:"preflight,omitempty"`
+		State         string             `json:"state,omitempty"`
+		Compatibility []compat.Gap       `json:"compatibility,omitempty"`
+	}{
+		Warnings: warnings.Check(cfg),
+	}
+
+	if err := preflight.Check(cfg); err != nil {
+		result.Preflight = err.Error()
+	}
+
+	// A state file of a newer version remains after a downgrade
+	if _, err := state.Load(cfg.StateFile); err != nil {
+		result.State = err.Error()
+	}
+
+	if *kubeletConfig != "" {
+		matchImages, err := compat.LoadMatchImages(*kubeletConfig, *provider)
+		if err != nil {
+			return fmt.Errorf("load matchImages: %w", err)
+		}
+
+		result.Compatibility, err = compat.Check(cfg, matchImages, images)
+		if err != nil {
+			return fmt.Errorf("check matchImages compatibility: %w", err)
+		}
+	}
+
+	if *outputJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+
+		if err := encoder.Encode(result); err != nil {
+			return fmt.Errorf("encode result: %w", err)
+		}
+
+		return nil
+	}
+
+	if result.Preflight != "" {
+		fmt.Printf("Preflight check failed: %s\n", result.Preflight)
+	}
+
+	if result.State != "" {
+		fmt.Printf("State check failed: %s\n", result.State)
+	}
+
+	for i := range result.Compatibility {
+		fmt.Println(result.Compatibility[i].String())
+	}
+
+	if len(result.Warnings) == 0 {
+		fmt.Println("No warnings found")
+
+		return nil
+	}
+
+	for i := range result.Warnings {
+		fmt.Println(result.Warnings[i].String())
+	}
+
+	return nil
+}
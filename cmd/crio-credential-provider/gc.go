@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/auth"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/events"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/k8s"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/retention"
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+)
+
+func runGC(args []string) error {
+	flags := flag.NewFlagSet("gc", flag.ContinueOnError)
+	configPath := flags.String("config", config.ConfigPath, "Path to the configuration file")
+	overrides := addOverrideFlags(flags)
+	namespaces := flags.Bool("namespaces", false, "Also remove the auth files of namespaces which do not exist any more")
+	kubeconfig := flags.String("kubeconfig", "", "Path to the kubeconfig with cluster level credentials for listing the namespaces, uses the in-cluster config if empty")
+
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("parse flags: %w", err)
+	}
+
+	cfg, err := loadConfig(*configPath, overrides)
+	if err != nil {
+		return err
+	}
+
+	events.Enable(&cfg.Events)
+
+	if *namespaces {
+		removed, err := removeDeletedNamespaces(cfg, *kubeconfig)
+		for _, path := range removed {
+			fmt.Printf("Removed %s\n", path)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Removed %d auth file(s) of deleted namespaces\n", len(removed))
+	}
+
+	// Registry credential policies may set a TTL on the auth files
+	if !cfg.Retention.Enabled() && !cfg.RegistryCredentialPolicies {
+		if !*namespaces {
+			fmt.Println("No retention limits configured")
+		}
+
+		return nil
+	}
+
+	evicted, err := retention.Sweep(cfg, time.Now())
+	for _, path := range evicted {
+		fmt.Printf("Evicted %s\n", path)
+	}
+
+	if err != nil {
+		return fmt.Errorf("enforce retention: %w", err)
+	}
+
+	fmt.Printf("Evicted %d auth file(s)\n", len(evicted))
+
+	return nil
+}
+
+var errNoNamespaces = errors.New("cluster has no namespaces")
+
+// removeDeletedNamespaces removes the auth files of all namespaces which do
+// not exist in the cluster any more.
+func removeDeletedNamespaces(cfg *config.Config, kubeconfig string) ([]string, error) {
+	client, err := k8s.NewClusterClient(kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("create cluster client: %w", err)
+	}
+
+	list, err := client.CoreV1().Namespaces().List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("list namespaces: %w", err)
+	}
+
+	// Never remove all auth files because of a misbehaving API server
+	if len(list.Items) == 0 {
+		return nil, errNoNamespaces
+	}
+
+	existing := make([]string, 0, len(list.Items))
+	for i := range list.Items {
+		existing = append(existing, list.Items[i].Name)
+	}
+
+	var integrityKey []byte
+
+	if cfg.HashNamespaces {
+		if integrityKey, err = auth.LoadOrCreateIntegrityKey(cfg.IntegrityKeyPath); err != nil {
+			return nil, fmt.Errorf("get integrity key: %w", err)
+		}
+	}
+
+	removed, err := retention.RemoveDeletedNamespaces(cfg, integrityKey, existing)
+	if err != nil {
+		return removed, fmt.Errorf("remove auth files of deleted namespaces: %w", err)
+	}
+
+	return removed, nil
+}
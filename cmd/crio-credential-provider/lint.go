@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/k8s"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/lint"
+)
+
+var (
+	errLintUsage    = errors.New("usage: lint secrets [flags]")
+	errLintFindings = errors.New("found problems in secrets")
+)
+
+func runLint(args []string) error {
+	if len(args) == 0 || args[0] != "secrets" {
+		return errLintUsage
+	}
+
+	flags := flag.NewFlagSet("lint secrets", flag.ContinueOnError)
+	namespace := flags.String("namespace", metav1.NamespaceDefault, "Namespace to scan for secrets")
+	allNamespaces := flags.Bool("all-namespaces", false, "Scan the secrets of all namespaces")
+	kubeconfig := flags.String("kubeconfig", "", "Path to the kubeconfig, uses the in-cluster config if empty")
+
+	if err := flags.Parse(args[1:]); err != nil {
+		return fmt.Errorf("parse flags: %w", err)
+	}
+
+	if *allNamespaces {
+		*namespace = metav1.NamespaceAll
+	}
+
+	client, err := k8s.NewClusterClient(*kubeconfig)
+	if err != nil {
+		return fmt.Errorf("create cluster client: %w", err)
+	}
+
+	secrets, err := client.CoreV1().Secrets(*namespace).List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("list secrets: %w", err)
+	}
+
+	findings := lint.Secrets(secrets.Items)
+
+	if err := lint.WriteReport(os.Stdout, findings); err != nil {
+		return fmt.Errorf("print report: %w", err)
+	}
+
+	if len(findings) > 0 {
+		return errLintFindings
+	}
+
+	return nil
+}
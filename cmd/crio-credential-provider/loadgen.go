@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/loadgen"
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+)
+
+func runLoadgen(args []string) error {
+	var namespaces, images []string
+
+	flags := flag.NewFlagSet("loadgen", flag.ContinueOnError)
+	configPath := flags.String("config", config.ConfigPath, "Path to the configuration file passed to the executed provider")
+	pods := flags.Int("pods", 10, "Number of distinct pods per namespace the tokens get bound to")
+	serviceAccount := flags.String("service-account", "default", "Service account name of the synthesized tokens")
+	issuer := flags.String("issuer", "", "Issuer of the synthesized tokens, omitted if empty")
+	tokenTTL := flags.Duration("token-ttl", time.Hour, "Lifetime of the synthesized tokens")
+	claims := flags.String("claims", "", "JSON object of additional token claims, like {\"aud\":[\"api\"]}")
+	rate := flags.Float64("rate", 10, "Target rate of requests per second")
+	duration := flags.Duration("duration", 30*time.Second, "Duration of the load test")
+	concurrency := flags.Int("concurrency", 16, "Maximum number of requests in flight")
+	outputJSON := flags.Bool("json", false, "Print the report as JSON")
+
+	flags.Func("namespace", "Namespace of the synthesized service account tokens, can be repeated, defaults to default", func(value string) error {
+		namespaces = append(namespaces, value)
+
+		return nil
+	})
+	flags.Func("image", "Image of the synthesized requests, can be repeated", func(value string) error {
+		images = append(images, value)
+
+		return nil
+	})
+
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s loadgen [flags] [-- provider command]\n\n", os.Args[0])
+		fmt.Fprintln(flags.Output(), "Executes this binary with the configuration if no provider command is provided.")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("parse flags: %w", err)
+	}
+
+	if len(namespaces) == 0 {
+		namespaces = []string{"default"}
+	}
+
+	opts := &loadgen.Options{
+		Namespaces:     namespaces,
+		Images:         images,
+		Pods:           *pods,
+		ServiceAccount: *serviceAccount,
+		Issuer:         *issuer,
+		TokenTTL:       *tokenTTL,
+	}
+
+	if *claims != "" {
+		if err := json.Unmarshal([]byte(*claims), &opts.Claims); err != nil {
+			return fmt.Errorf("parse claims: %w", err)
+		}
+	}
+
+	command := flags.Args()
+	if len(command) == 0 {
+		self, err := os.Executable()
+		if err != nil {
+			return fmt.Errorf("get executable: %w", err)
+		}
+
+		command = []string{self, "--config", *configPath}
+	}
+
+	generator, err := loadgen.NewGenerator(opts)
+	if err != nil {
+		return fmt.Errorf("create generator: %w", err)
+	}
+
+	target, err := loadgen.Exec(command)
+	if err != nil {
+		return fmt.Errorf("create target: %w", err)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	report, err := loadgen.Run(ctx, generator, target, *rate, *duration, *concurrency)
+	if err != nil {
+		return fmt.Errorf("run load test: %w", err)
+	}
+
+	if *outputJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+
+		if err := encoder.Encode(report); err != nil {
+			return fmt.Errorf("encode report: %w", err)
+		}
+
+		return nil
+	}
+
+	if err := report.WriteSummary(os.Stdout); err != nil {
+		return fmt.Errorf("print report: %w", err)
+	}
+
+	return nil
+}
@@ -2,65 +2,198 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"os"
 
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/rest"
 
 	"github.com/cri-o/crio-credential-provider/internal/pkg/app"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/events"
 	"github.com/cri-o/crio-credential-provider/internal/pkg/k8s"
 	"github.com/cri-o/crio-credential-provider/internal/pkg/logger"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/policy"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/preflight"
 	"github.com/cri-o/crio-credential-provider/internal/pkg/version"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/warnings"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/webhook"
 	"github.com/cri-o/crio-credential-provider/pkg/config"
 )
 
+const (
+	// exitCodeTokenExpired is the exit code used if the service account token is expired.
+	exitCodeTokenExpired = 3
+
+	// exitCodeNotAuthorized is the exit code used if a registry credential
+	// policy denies all mirrors of the image for the namespace, or if the
+	// pre-write webhook denies the write.
+	exitCodeNotAuthorized = 4
+)
+
+// commands are the available subcommands of the credential provider.
+var commands = map[string]func(args []string) error{
+	"cleanup":  runGC,
+	"config":   runConfig,
+	"daemon":   runDaemon,
+	"doctor":   runDoctor,
+	"export":   runExport,
+	"gc":       runGC,
+	"import":   runImport,
+	"lint":     runLint,
+	"loadgen":  runLoadgen,
+	"migrate":  runMigrate,
+	"prewarm":  runPrewarm,
+	"resync":   runResync,
+	"rollback": runRollback,
+	"stats":    runStats,
+	"sync":     runSync,
+	"ui":       runUI,
+}
+
 func main() {
+	defer logger.Flush()
+	defer events.Flush()
+
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			if err := command(os.Args[2:]); err != nil {
+				logger.Fatalf("Failed to run %s command: %v", os.Args[1], err)
+			}
+
+			return
+		}
+	}
+
 	showVersion := flag.Bool("version", false, "Display version information")
 	showVersionJSON := flag.Bool("version-json", false, "Display version information as JSON")
+	showSchema := flag.Bool("schema", false, "Display the JSON schema of the configuration file")
+	configPath := flag.String("config", config.ConfigPath, "Path to the configuration file")
+	overrides := addOverrideFlags(flag.CommandLine)
 
 	flag.Parse()
 
 	if *showVersion {
-		printVersion(false)
+		printVersion(*configPath, false)
 
 		return
 	}
 
 	if *showVersionJSON {
-		printVersion(true)
+		printVersion(*configPath, true)
 
 		return
 	}
 
+	if *showSchema {
+		schema, err := config.Schema()
+		if err != nil {
+			logger.Fatalf("Failed to get configuration schema: %v", err)
+		}
+
+		fmt.Println(string(schema))
+
+		return
+	}
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		logger.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	if err := overrides.apply(cfg); err != nil {
+		logger.Fatalf("Failed to override configuration: %v", err)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		logger.Fatalf("Failed to validate configuration: %v", err)
+	}
+
+	if err := configureLogging(cfg); err != nil {
+		logger.Fatalf("Failed to configure logging: %v", err)
+	}
+
+	events.Enable(&cfg.Events)
+
+	warnings.Log(warnings.Check(cfg))
+
+	if os.Geteuid() != 0 {
+		// Fail early with guidance instead of in the middle of a run
+		if err := preflight.Check(cfg); err != nil {
+			logger.Fatalf("Failed to run as non-root user: %v", err)
+		}
+	}
+
 	if err := app.Run(
 		os.Stdin,
-		config.RegistriesConfPath,
-		config.AuthDir,
-		config.KubeletAuthFilePath,
+		cfg,
 		func(token string) (kubernetes.Interface, error) {
-			return kubernetes.NewForConfig(&rest.Config{
-				Host:            k8s.APIServerHost(config.KubernetesConfigDir),
-				BearerToken:     token,
-				TLSClientConfig: rest.TLSClientConfig{Insecure: true},
-			})
+			restConfig, err := k8s.APIServerConfig(cfg, token)
+			if err != nil {
+				return nil, fmt.Errorf("unable to get API server config: %w", err)
+			}
+
+			return kubernetes.NewForConfig(restConfig)
 		},
 	); err != nil {
-		logger.L().Fatalf("Failed to run credential provider: %v", err)
+		if errors.Is(err, k8s.ErrTokenExpired) {
+			// Use a dedicated exit code to distinguish expired tokens, which
+			// get resolved by a kubelet retry, from real auth failures.
+			logger.Errorf("Failed to run credential provider: %v", err)
+			logger.Exit(exitCodeTokenExpired)
+		}
+
+		if errors.Is(err, policy.ErrNotAuthorized) || errors.Is(err, webhook.ErrDenied) {
+			logger.Errorf("Failed to run credential provider: %v", err)
+			logger.Exit(exitCodeNotAuthorized)
+		}
+
+		logger.Fatalf("Failed to run credential provider: %v", err)
+	}
+}
+
+// configureLogging applies the configured level and format and enables the
+// configured log outputs besides stderr and journald.
+func configureLogging(cfg *config.Config) error {
+	if cfg.Logging.Level != "" {
+		if err := logger.SetLevel(cfg.Logging.Level); err != nil {
+			return fmt.Errorf("set log level: %w", err)
+		}
+	}
+
+	logger.SetJSON(cfg.Logging.Format == config.LogFormatJSON)
+
+	if cfg.Logging.JSONLFile != "" {
+		if err := logger.EnableJSONL(cfg.Logging.JSONLFile); err != nil {
+			return fmt.Errorf("enable JSON lines log file: %w", err)
+		}
+	}
+
+	if cfg.Logging.OTLPEndpoint != "" {
+		logger.EnableOTLP(cfg.Logging.OTLPEndpoint)
 	}
+
+	return nil
 }
 
-func printVersion(asJSON bool) {
+func printVersion(configPath string, asJSON bool) {
 	v, err := version.Get()
 	if err != nil {
-		logger.L().Fatalf("Failed to retrieve version: %v", err)
+		logger.Fatalf("Failed to retrieve version: %v", err)
+	}
+
+	// The features are best effort, the version has to be printable even
+	// with a broken configuration.
+	if cfg, err := config.Load(configPath); err == nil {
+		v.Features = cfg.Features()
+	} else {
+		logger.Warnf("Omitting enabled features: %v", err)
 	}
 
 	if asJSON {
 		jsonString, err := v.JSONString()
 		if err != nil {
-			logger.L().Fatalf("Failed to get JSON string from version: %v", err)
+			logger.Fatalf("Failed to get JSON string from version: %v", err)
 		}
 
 		fmt.Print(jsonString)
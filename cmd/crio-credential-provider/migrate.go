@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/events"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/migrate"
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+)
+
+func runMigrate(args []string) error {
+	var images []string
+
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	configPath := flags.String("config", config.ConfigPath, "Path to the configuration file")
+	overrides := addOverrideFlags(flags)
+	dryRun := flags.Bool("dry-run", false, "Only print the changes without applying them")
+
+	flags.Func("image", "Image to convert the legacy files for besides the ones recorded in the state, can be repeated", func(value string) error {
+		images = append(images, value)
+
+		return nil
+	})
+
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("parse flags: %w", err)
+	}
+
+	cfg, err := loadConfig(*configPath, overrides)
+	if err != nil {
+		return err
+	}
+
+	events.Enable(&cfg.Events)
+
+	res, err := migrate.Run(cfg, images, *dryRun)
+	if res != nil {
+		for _, path := range res.Converted {
+			fmt.Printf("Converted %s\n", path)
+		}
+
+		for _, path := range res.Removed {
+			fmt.Printf("Removed %s\n", path)
+		}
+
+		for _, path := range res.Skipped {
+			fmt.Printf("Kept unparsable %s\n", path)
+		}
+
+		fmt.Printf("Converted %d auth file(s), removed %d legacy file(s)\n", len(res.Converted), len(res.Removed))
+	}
+
+	if err != nil {
+		return fmt.Errorf("migrate legacy files: %w", err)
+	}
+
+	return nil
+}
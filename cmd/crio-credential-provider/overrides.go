@@ -0,0 +1,145 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+)
+
+// overrides are the per-invocation configuration overrides, which can be
+// passed by the args of the kubelet credential provider configuration.
+type overrides struct {
+	profile         string
+	authDir         string
+	registriesConf  string
+	confDir         string
+	kubeletAuthFile string
+	apiServerEnvDir string
+	apiServer       string
+	logLevel        string
+	logFormat       string
+	timeout         time.Duration
+	sets            []string
+
+	insecureAPIServer bool
+
+	flags *flag.FlagSet
+}
+
+// addOverrideFlags registers the override flags on the flag set.
+func addOverrideFlags(flags *flag.FlagSet) *overrides {
+	o := &overrides{flags: flags}
+
+	flags.StringVar(&o.profile, "profile", "", "Name of the configuration profile to merge over the configuration file")
+	flags.StringVar(&o.authDir, "auth-dir", "", "Directory the auth files get written to, overrides authDir")
+	flags.StringVar(&o.registriesConf, "registries-conf", "", "Path to the registries.conf used for mirror matching, overrides registriesConfPath")
+	flags.StringVar(&o.confDir, "registries-conf-dir", "", "Drop-in directory of the registries.conf, overrides registriesConfDirPath")
+	flags.StringVar(&o.kubeletAuthFile, "kubelet-auth-file", "", "Path to the kubelet global auth file, overrides kubeletAuthFilePath")
+	flags.StringVar(&o.apiServerEnvDir, "apiserver-env-dir", "", "Directory containing the apiserver-url.env, overrides kubernetesConfigDir")
+	flags.StringVar(&o.apiServer, "apiserver", "", "Endpoint of the API server, overrides apiServer.host")
+	flags.DurationVar(&o.timeout, "timeout", 0, "Timeout of the whole run, overrides timeouts.run")
+	flags.StringVar(&o.logLevel, "log-level", "", "Minimum level of the logged records (debug, info, warn or error), overrides logging.level")
+	flags.StringVar(&o.logFormat, "log-format", "", "Format of the records logged to stderr (text or json), overrides logging.format")
+	flags.BoolVar(&o.insecureAPIServer, "insecure-api-server", false, "Skip verifying the API server certificate, overrides apiServer.insecure")
+	flags.Func("set", "Override a configuration value as path=value, like secrets.opaque=true (can be repeated)", func(value string) error {
+		o.sets = append(o.sets, value)
+
+		return nil
+	})
+
+	return o
+}
+
+// apply merges the overrides over the configuration. The profile gets
+// applied first, followed by the dedicated flags and the assignments in their
+// order.
+func (o *overrides) apply(cfg *config.Config) error {
+	if o.profile != "" {
+		if err := cfg.ApplyProfile(o.profile); err != nil {
+			return fmt.Errorf("apply profile: %w", err)
+		}
+	}
+
+	if o.authDir != "" {
+		cfg.AuthDir = o.authDir
+	}
+
+	if o.registriesConf != "" {
+		cfg.RegistriesConfPath = o.registriesConf
+	}
+
+	if o.confDir != "" {
+		cfg.RegistriesConfDirPath = o.confDir
+	}
+
+	if o.kubeletAuthFile != "" {
+		cfg.KubeletAuthFilePath = o.kubeletAuthFile
+	}
+
+	if o.apiServerEnvDir != "" {
+		cfg.KubernetesConfigDir = o.apiServerEnvDir
+	}
+
+	if o.apiServer != "" {
+		cfg.APIServer.Host = o.apiServer
+	}
+
+	// An explicit zero timeout disables the one of the configuration file
+	if o.isSet("timeout") {
+		cfg.Timeouts.Run.Duration = o.timeout
+	}
+
+	if o.logLevel != "" {
+		cfg.Logging.Level = o.logLevel
+	}
+
+	if o.logFormat != "" {
+		cfg.Logging.Format = o.logFormat
+	}
+
+	if o.insecureAPIServer {
+		cfg.APIServer.Insecure = true
+	}
+
+	for _, set := range o.sets {
+		if err := cfg.Set(set); err != nil {
+			return fmt.Errorf("apply override: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// isSet returns true if the flag has been explicitly passed.
+func (o *overrides) isSet(name string) bool {
+	set := false
+
+	o.flags.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+
+	return set
+}
+
+// loadConfig loads the configuration file, merges the overrides over it and
+// validates the result.
+func loadConfig(path string, o *overrides) (*config.Config, error) {
+	cfg, err := config.Load(path)
+	if err != nil {
+		return nil, fmt.Errorf("load configuration: %w", err)
+	}
+
+	if err := o.apply(cfg); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("validate configuration: %w", err)
+	}
+
+	return cfg, nil
+}
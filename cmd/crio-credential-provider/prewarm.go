@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/events"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/k8s"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/prewarm"
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+)
+
+var errPrewarmUsage = errors.New("prewarm requires at least one --image or the --node flag")
+
+func runPrewarm(args []string) error {
+	var namespaces, images []string
+
+	flags := flag.NewFlagSet("prewarm", flag.ContinueOnError)
+	configPath := flags.String("config", config.ConfigPath, "Path to the configuration file")
+	kubeconfig := flags.String("kubeconfig", "", "Path to the kubeconfig with cluster level credentials, uses the in-cluster config if empty")
+	node := flags.String("node", "", "Prewarm the images of all pods scheduled to the provided node")
+	overrides := addOverrideFlags(flags)
+
+	flags.Func("namespace", "Namespace to prewarm, can be repeated, defaults to all namespaces", func(value string) error {
+		namespaces = append(namespaces, value)
+
+		return nil
+	})
+	flags.Func("image", "Image to prewarm in every namespace, can be repeated", func(value string) error {
+		images = append(images, value)
+
+		return nil
+	})
+
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("parse flags: %w", err)
+	}
+
+	if len(images) == 0 && *node == "" {
+		return errPrewarmUsage
+	}
+
+	cfg, err := loadConfig(*configPath, overrides)
+	if err != nil {
+		return err
+	}
+
+	events.Enable(&cfg.Events)
+
+	client, err := k8s.NewClusterClient(*kubeconfig)
+	if err != nil {
+		return fmt.Errorf("create cluster client: %w", err)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	targets, err := prewarm.Targets(ctx, client, namespaces, images, *node)
+	if err != nil {
+		return fmt.Errorf("collect targets: %w", err)
+	}
+
+	res, err := prewarm.Run(ctx, cfg, client, targets)
+	if res != nil {
+		for _, path := range res.Written {
+			fmt.Printf("Wrote %s\n", path)
+		}
+
+		fmt.Printf("Wrote %d auth file(s), skipped %d target(s) without credentials\n", len(res.Written), res.Skipped)
+	}
+
+	if err != nil {
+		return fmt.Errorf("prewarm auth files: %w", err)
+	}
+
+	return nil
+}
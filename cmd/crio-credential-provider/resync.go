@@ -0,0 +1,70 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/resync"
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+)
+
+func runResync(args []string) error {
+	var images, namespaces []string
+
+	flags := flag.NewFlagSet("resync", flag.ContinueOnError)
+	configPath := flags.String("config", config.ConfigPath, "Path to the configuration file")
+	overrides := addOverrideFlags(flags)
+	dryRun := flags.Bool("dry-run", false, "Only print the changes without applying them")
+
+	flags.Func("image", "Image to resolve the auth files for besides the ones recorded in the state, can be repeated", func(value string) error {
+		images = append(images, value)
+
+		return nil
+	})
+
+	flags.Func("namespace", "Namespace to resolve hashed namespaces for besides the ones recorded in the state, can be repeated", func(value string) error {
+		namespaces = append(namespaces, value)
+
+		return nil
+	})
+
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("parse flags: %w", err)
+	}
+
+	cfg, err := loadConfig(*configPath, overrides)
+	if err != nil {
+		return err
+	}
+
+	res, err := resync.Run(cfg, images, namespaces, *dryRun)
+	if res != nil {
+		for _, path := range res.Recorded {
+			fmt.Printf("Recorded %s\n", path)
+		}
+
+		for _, path := range res.Unresolved {
+			fmt.Printf("Recorded without namespace or image %s\n", path)
+		}
+
+		for _, path := range res.Completed {
+			fmt.Printf("Completed sidecar of %s\n", path)
+		}
+
+		for _, path := range res.Unverifiable {
+			fmt.Printf("Kept unverifiable %s\n", path)
+		}
+
+		for _, path := range res.Orphaned {
+			fmt.Printf("Removed orphaned %s\n", path)
+		}
+
+		fmt.Printf("Recorded %d auth file(s), %d unverifiable, removed %d orphan(s)\n", len(res.Recorded), len(res.Unverifiable), len(res.Orphaned))
+	}
+
+	if err != nil {
+		return fmt.Errorf("resync state: %w", err)
+	}
+
+	return nil
+}
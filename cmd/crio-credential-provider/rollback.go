@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/auth"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/events"
+	cpAuth "github.com/cri-o/crio-credential-provider/pkg/auth"
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+	"github.com/cri-o/crio-credential-provider/pkg/reference"
+)
+
+var errRollbackTarget = errors.New("the namespace and image are required")
+
+func runRollback(args []string) error {
+	flags := flag.NewFlagSet("rollback", flag.ContinueOnError)
+	configPath := flags.String("config", config.ConfigPath, "Path to the configuration file")
+	overrides := addOverrideFlags(flags)
+	namespace := flags.String("namespace", "", "Namespace of the auth file to roll back")
+	image := flags.String("image", "", "Image of the auth file to roll back")
+
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("parse flags: %w", err)
+	}
+
+	if *namespace == "" || *image == "" {
+		return errRollbackTarget
+	}
+
+	cfg, err := loadConfig(*configPath, overrides)
+	if err != nil {
+		return err
+	}
+
+	events.Enable(&cfg.Events)
+
+	var integrityKey []byte
+	if cfg.HashNamespaces {
+		if integrityKey, err = cpAuth.ReadKey(cfg.IntegrityKeyPath); err != nil {
+			return fmt.Errorf("hash namespace: %w", err)
+		}
+	}
+
+	path, err := cfg.Naming.FilePath(cfg.AuthDir, auth.FileNamespace(*namespace, cfg.HashNamespaces, integrityKey), reference.Key(*image))
+	if err != nil {
+		return fmt.Errorf("get auth file path: %w", err)
+	}
+
+	if err := auth.Rollback(path); err != nil {
+		return fmt.Errorf("roll back auth file: %w", err)
+	}
+
+	fmt.Printf("Rolled back %s\n", path)
+
+	return nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/events"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/snapshot"
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+)
+
+var (
+	errExportUsage = errors.New("export requires the --namespace, --output and --key-file flags")
+	errImportUsage = errors.New("import requires the --input and --key-file flags")
+)
+
+func runExport(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	configPath := flags.String("config", config.ConfigPath, "Path to the configuration file")
+	overrides := addOverrideFlags(flags)
+	namespace := flags.String("namespace", "", "Namespace whose auth files get exported")
+	output := flags.String("output", "", "Path of the written bundle")
+	keyFile := flags.String("key-file", "", "Path to the key used to encrypt the bundle")
+	ttl := flags.Duration("ttl", 24*time.Hour, "Duration after which the bundle cannot be imported anymore")
+
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("parse flags: %w", err)
+	}
+
+	if *namespace == "" || *output == "" || *keyFile == "" {
+		return errExportUsage
+	}
+
+	cfg, err := loadConfig(*configPath, overrides)
+	if err != nil {
+		return err
+	}
+
+	key, err := os.ReadFile(*keyFile)
+	if err != nil {
+		return fmt.Errorf("read bundle key: %w", err)
+	}
+
+	data, err := snapshot.Export(cfg, *namespace, key, *ttl, time.Now())
+	if err != nil {
+		return fmt.Errorf("export auth files: %w", err)
+	}
+
+	if err := os.WriteFile(*output, data, 0o600); err != nil {
+		return fmt.Errorf("write bundle: %w", err)
+	}
+
+	fmt.Printf("Exported the auth files of namespace %s to %s\n", *namespace, *output)
+
+	return nil
+}
+
+func runImport(args []string) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	configPath := flags.String("config", config.ConfigPath, "Path to the configuration file")
+	overrides := addOverrideFlags(flags)
+	input := flags.String("input", "", "Path of the bundle to import")
+	keyFile := flags.String("key-file", "", "Path to the key used to decrypt the bundle")
+
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("parse flags: %w", err)
+	}
+
+	if *input == "" || *keyFile == "" {
+		return errImportUsage
+	}
+
+	cfg, err := loadConfig(*configPath, overrides)
+	if err != nil {
+		return err
+	}
+
+	events.Enable(&cfg.Events)
+
+	key, err := os.ReadFile(*keyFile)
+	if err != nil {
+		return fmt.Errorf("read bundle key: %w", err)
+	}
+
+	data, err := os.ReadFile(*input)
+	if err != nil {
+		return fmt.Errorf("read bundle: %w", err)
+	}
+
+	written, err := snapshot.Import(cfg, data, key, time.Now())
+	for _, path := range written {
+		fmt.Printf("Imported %s\n", path)
+	}
+
+	if err != nil {
+		return fmt.Errorf("import auth files: %w", err)
+	}
+
+	fmt.Printf("Imported %d auth file(s)\n", len(written))
+
+	return nil
+}
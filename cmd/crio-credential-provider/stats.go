@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/logger"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/state"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/stats"
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+)
+
+func runStats(args []string) error {
+	flags := flag.NewFlagSet("stats", flag.ContinueOnError)
+	configPath := flags.String("config", config.ConfigPath, "Path to the configuration file")
+	overrides := addOverrideFlags(flags)
+	textfile := flags.String("textfile", "", "Write node-exporter textfile metrics to the provided path instead of printing a summary")
+	interval := flags.Duration("interval", 0, "Rewrite the textfile in the provided interval until interrupted")
+	outputJSON := flags.Bool("json", false, "Print the summary as JSON")
+	last := flags.Int("last", 10, "Number of most recent resolutions to include in the summary")
+
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("parse flags: %w", err)
+	}
+
+	cfg, err := loadConfig(*configPath, overrides)
+	if err != nil {
+		return err
+	}
+
+	if *textfile == "" {
+		s, err := collectStats(cfg, *last)
+		if err != nil {
+			return err
+		}
+
+		if *outputJSON {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+
+			if err := encoder.Encode(s); err != nil {
+				return fmt.Errorf("encode stats: %w", err)
+			}
+
+			return nil
+		}
+
+		if err := s.WriteSummary(os.Stdout, time.Now()); err != nil {
+			return fmt.Errorf("print stats: %w", err)
+		}
+
+		return nil
+	}
+
+	if err := writeTextfile(cfg, *textfile); err != nil {
+		return err
+	}
+
+	if *interval <= 0 {
+		return nil
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case <-ticker.C:
+			if err := writeTextfile(cfg, *textfile); err != nil {
+				logger.Warnf("Unable to write textfile: %v", err)
+			}
+		}
+	}
+}
+
+func writeTextfile(cfg *config.Config, path string) error {
+	s, err := collectStats(cfg, 0)
+	if err != nil {
+		return err
+	}
+
+	if err := s.WriteTextfile(path, time.Now()); err != nil {
+		return fmt.Errorf("write textfile: %w", err)
+	}
+
+	return nil
+}
+
+// collectStats gathers the stats of the auth directory together with the
+// summary and the last resolutions of the state.
+func collectStats(cfg *config.Config, last int) (*stats.Stats, error) {
+	s, err := stats.Collect(cfg.AuthDir)
+	if err != nil {
+		return nil, fmt.Errorf("collect stats: %w", err)
+	}
+
+	st, err := state.Load(cfg.StateFile)
+	if err != nil {
+		return nil, fmt.Errorf("load state: %w", err)
+	}
+
+	s.AddState(st, last)
+
+	return s, nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cri-o/crio-credential-provider/pkg/auth"
+)
+
+func TestRunStatsOverrides(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	authDir := filepath.Join(dir, "auth")
+	require.NoError(t, os.Mkdir(authDir, 0o700))
+
+	path, err := auth.FilePath(authDir, "default", "quay.io/crio/image")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, []byte("{}"), 0o600))
+
+	textfile := filepath.Join(dir, "stats.prom")
+
+	require.NoError(t, runStats([]string{
+		"--config", filepath.Join(dir, "config.yaml"),
+		"--auth-dir", authDir,
+		"--set", "stateFile=" + filepath.Join(dir, "state.json"),
+		"--textfile", textfile,
+	}))
+
+	res, err := os.ReadFile(textfile)
+	require.NoError(t, err)
+	assert.Contains(t, string(res), "crio_credential_provider_auth_files 1\n")
+	assert.Contains(t, string(res), `crio_credential_provider_namespace_auth_files{namespace="default"} 1`)
+}
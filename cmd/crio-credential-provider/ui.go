@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/logger"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/ui"
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+)
+
+// uiShutdownTimeout is the time in-flight requests get to complete on
+// shutdown.
+const uiShutdownTimeout = 5 * time.Second
+
+var errNotLoopback = errors.New("the ui only listens on loopback addresses")
+
+func runUI(args []string) error {
+	flags := flag.NewFlagSet("ui", flag.ContinueOnError)
+	configPath := flags.String("config", config.ConfigPath, "Path to the configuration file")
+	overrides := addOverrideFlags(flags)
+	listen := flags.String("listen", "127.0.0.1:8765", "Loopback address to serve the read-only ui on")
+	last := flags.Int("last", 50, "Number of most recent audited resolutions to show")
+
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("parse flags: %w", err)
+	}
+
+	if err := checkLoopback(*listen); err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig(*configPath, overrides)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	listener, err := (&net.ListenConfig{}).Listen(ctx, "tcp", *listen)
+	if err != nil {
+		return fmt.Errorf("listen: %w", err)
+	}
+
+	server := &http.Server{
+		Handler:           ui.Handler(cfg, *last),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), uiShutdownTimeout)
+		defer cancel()
+
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			logger.Warnf("Unable to shut down the ui: %v", err)
+		}
+	}()
+
+	logger.Infof("Serving the ui on http://%s", listener.Addr())
+
+	if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("serve ui: %w", err)
+	}
+
+	return nil
+}
+
+// checkLoopback ensures that the address only listens on a loopback
+// interface, because the ui shows the namespaces and secret names of the
+// node without any authentication.
+func checkLoopback(address string) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("parse listen address: %w", err)
+	}
+
+	if host == "localhost" {
+		return nil
+	}
+
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		return fmt.Errorf("%w: %q", errNotLoopback, address)
+	}
+
+	return nil
+}
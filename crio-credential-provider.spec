@@ -41,10 +41,13 @@ go build \
 %install
 install -d %{buildroot}%{_libexecdir}/kubelet-image-credential-provider-plugins
 install -p -m 755 crio-credential-provider %{buildroot}%{_libexecdir}/kubelet-image-credential-provider-plugins/crio-credential-provider
+install -d %{buildroot}%{_tmpfilesdir}
+install -p -m 644 contrib/tmpfiles.d/crio-credential-provider.conf %{buildroot}%{_tmpfilesdir}/crio-credential-provider.conf
 
 %files
 %license LICENSE
 %{_libexecdir}/kubelet-image-credential-provider-plugins/crio-credential-provider
+%{_tmpfilesdir}/crio-credential-provider.conf
 
 %changelog
 * Wed Dec 03 2025 Sascha Grunert <sgrunert@redhat.com> - 0.1.2
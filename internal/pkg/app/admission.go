@@ -0,0 +1,63 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/logger"
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+)
+
+// admissionSlotFile is the name of a single in-flight slot file within the
+// admission directory.
+const admissionSlotFile = "slot-%d.lock"
+
+// admit acquires one of the in-flight slots of the admission gate and returns
+// its release function. It returns false if all slots are held by other runs,
+// which means that the run has to be shed. The slots are held by flock(2) and
+// get released by the kernel if a run crashes. Failures to acquire a slot get
+// logged and admit the run, because the gate must not fail any pulls.
+func admit(cfg *config.Admission) (func(), bool) {
+	noop := func() {}
+
+	if cfg.MaxInFlight == 0 {
+		return noop, true
+	}
+
+	if err := os.MkdirAll(cfg.Dir, 0o700); err != nil {
+		logger.Warnf("Unable to ensure the admission directory, admitting the run: %v", err)
+
+		return noop, true
+	}
+
+	for i := range cfg.MaxInFlight {
+		f, err := os.OpenFile(filepath.Join(cfg.Dir, fmt.Sprintf(admissionSlotFile, i)), os.O_RDWR|os.O_CREATE, 0o600)
+		if err != nil {
+			logger.Warnf("Unable to open admission slot, admitting the run: %v", err)
+
+			return noop, true
+		}
+
+		if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+			_ = f.Close()
+
+			if errors.Is(err, syscall.EWOULDBLOCK) {
+				continue
+			}
+
+			logger.Warnf("Unable to lock admission slot, admitting the run: %v", err)
+
+			return noop, true
+		}
+
+		return func() {
+			_ = syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+			_ = f.Close()
+		}, true
+	}
+
+	return nil, false
+}
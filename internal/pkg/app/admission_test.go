@@ -0,0 +1,116 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	cpv1 "k8s.io/kubelet/pkg/apis/credentialprovider/v1"
+
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+)
+
+func TestAdmit(t *testing.T) {
+	t.Parallel()
+
+	cfg := &config.Admission{MaxInFlight: 2, Dir: filepath.Join(t.TempDir(), "admission")}
+
+	first, ok := admit(cfg)
+	require.True(t, ok)
+
+	second, ok := admit(cfg)
+	require.True(t, ok)
+
+	_, ok = admit(cfg)
+	require.False(t, ok, "all slots are held")
+
+	first()
+
+	third, ok := admit(cfg)
+	require.True(t, ok, "released slots get reused")
+
+	second()
+	third()
+
+	// Failures to acquire a slot admit the run
+	release, ok := admit(&config.Admission{MaxInFlight: 1, Dir: "/proc/invalid"})
+	require.True(t, ok)
+	release()
+
+	release, ok = admit(&config.Admission{})
+	require.True(t, ok, "disabled gate")
+	release()
+}
+
+func TestRunShed(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	cfg := config.Default()
+	cfg.RegistriesConfPath = filepath.Join(dir, "registries.conf")
+	cfg.AuthDir = filepath.Join(dir, "auth")
+	cfg.KubeletAuthFilePath = filepath.Join(dir, "kubelet-auth.json")
+	cfg.DiagnosticsDir = filepath.Join(dir, "diagnostics")
+	cfg.IntegrityKeyPath = filepath.Join(dir, "integrity.key")
+	cfg.StateFile = filepath.Join(dir, "state.json")
+	cfg.Sources.PolicyPath = filepath.Join(dir, "policy.json")
+	cfg.Admission = config.Admission{MaxInFlight: 1, Dir: filepath.Join(dir, "admission")}
+
+	require.NoError(t, os.WriteFile(cfg.RegistriesConfPath, []byte(testRegistryConfig), 0o600))
+
+	request := func() *bytes.Buffer {
+		raw, err := json.Marshal(&cpv1.CredentialProviderRequest{
+			Image:               image,
+			ServiceAccountToken: prepareToken(t, jwt.MapClaims{k8sClaimKey: map[string]any{"namespace": namespace}}),
+		})
+		require.NoError(t, err)
+
+		return bytes.NewBuffer(raw)
+	}
+
+	clientFunc := func(string) (kubernetes.Interface, error) {
+		return fake.NewClientset(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "secret", Namespace: namespace},
+			Type:       corev1.SecretTypeDockerConfigJson,
+			Data:       map[string][]byte{corev1.DockerConfigJsonKey: testSecretData},
+		}), nil
+	}
+
+	failingClientFunc := func(string) (kubernetes.Interface, error) {
+		return nil, errors.New("must not be called")
+	}
+
+	release, ok := admit(&cfg.Admission)
+	require.True(t, ok)
+
+	// Shed runs without a previously written auth file respond without credentials
+	require.NoError(t, Run(request(), cfg, failingClientFunc))
+	require.NoDirExists(t, cfg.AuthDir)
+
+	release()
+
+	require.NoError(t, Run(request(), cfg, clientFunc))
+
+	entries, err := os.ReadDir(cfg.AuthDir)
+	require.NoError(t, err)
+	assert.NotEmpty(t, entries)
+
+	release, ok = admit(&cfg.Admission)
+	require.True(t, ok)
+
+	defer release()
+
+	// Shed runs keep the previously written auth file
+	require.NoError(t, Run(request(), cfg, failingClientFunc))
+}
@@ -2,45 +2,96 @@
 package app
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"os"
 	"strings"
 	"time"
 
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	cpv1 "k8s.io/kubelet/pkg/apis/credentialprovider/v1"
 
 	"github.com/cri-o/crio-credential-provider/internal/pkg/auth"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/claims"
 	"github.com/cri-o/crio-credential-provider/internal/pkg/k8s"
 	"github.com/cri-o/crio-credential-provider/internal/pkg/logger"
-	"github.com/cri-o/crio-credential-provider/internal/pkg/mirrors"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/policy"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/registrytls"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/retention"
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+	"github.com/cri-o/crio-credential-provider/pkg/docker"
+	"github.com/cri-o/crio-credential-provider/pkg/mirrors"
+	"github.com/cri-o/crio-credential-provider/pkg/reference"
 )
 
+// eventReasonNotAuthorized is the reason of the events created for workloads
+// denied by a registry credential policy.
+const eventReasonNotAuthorized = "MirrorCredentialsNotAuthorized"
+
 // Run is the main entry point for the whole credential provider application.
-func Run(stdin io.Reader, registriesConfPath, authDir, kubeletAuthFilePath string, clientFunc k8s.ClientFunc) error {
-	logger.L().Print("Running credential provider")
+// Panics are recovered and result in a crash report written to the
+// configured diagnostics directory. Every run logs a summary on completion,
+// while its metrics get written to the file descriptor 3 if enabled.
+func Run(stdin io.Reader, cfg *config.Config, clientFunc k8s.ClientFunc) error {
+	start := time.Now()
+	s := &runState{phase: phaseRequest, metrics: newRunMetrics()}
+
+	var err error
+
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				err = handlePanic(cfg, s, r)
+			}
+		}()
+
+		err = run(stdin, cfg, clientFunc, s)
+	}()
+
+	s.summary.finish(start, err)
+	s.summary.log()
+
+	if cfg.EmitMetrics {
+		s.metrics.finish(s, start, err)
+		emitMetrics(s.metrics)
+	}
+
+	return err
+}
+
+func run(stdin io.Reader, cfg *config.Config, clientFunc k8s.ClientFunc, s *runState) error {
+	logger.Infof("Running credential provider")
+
+	logger.Debugf("Reading from stdin")
+
+	raw, err := io.ReadAll(stdin)
+	if err != nil {
+		return fmt.Errorf("unable to read credential provider request from stdin: %w", err)
+	}
+
+	// Older kubelets only accept responses of their own API version
+	s.apiVersion = k8s.APIVersion(raw)
+
+	registriesConfPath := cfg.RegistriesConfPath
 
 	if _, err := os.Stat(registriesConfPath); err != nil {
 		if os.IsNotExist(err) {
-			logger.L().Printf("Registries conf path %q does not exist, stopping", registriesConfPath)
+			logger.Infof("Registries conf path %q does not exist, stopping", registriesConfPath)
 
-			return response()
+			return response(s.apiVersion)
 		}
 
 		return fmt.Errorf("unable to access registries conf path %q: %w", registriesConfPath, err)
 	}
 
-	logger.L().Print("Reading from stdin")
-
-	// Use json.Decoder directly instead of reading all bytes first
-	// This is more efficient for streaming input
-	req := &cpv1.CredentialProviderRequest{}
-
-	decoder := json.NewDecoder(stdin)
-	if err := decoder.Decode(req); err != nil {
+	req, err := k8s.DecodeRequest(bytes.NewReader(raw))
+	if err != nil {
 		return fmt.Errorf("unable to parse credential provider request from stdin: %w", err)
 	}
 
@@ -50,66 +101,427 @@ func Run(stdin io.Reader, registriesConfPath, authDir, kubeletAuthFilePath strin
 	// https://github.com/kubernetes/kubernetes/blob/6070f5a/pkg/kubelet/images/image_manager.go#L192-L195
 	// which calls into:
 	// https://github.com/kubernetes/kubernetes/blob/6070f5a/pkg/util/parsers/parsers.go#L29-L37
-	logger.L().Printf("Parsed credential provider request for image %q", req.Image)
+	logger.Infof("Parsed credential provider request for image %q", req.Image)
+
+	// All components have to agree on the image key to find the auth file
+	if key := reference.Key(req.Image); key != req.Image {
+		logger.Debugf("Normalized image %q to %q", req.Image, key)
+
+		req.Image = key
+	}
 
-	logger.L().Print("Parsing namespace from request")
+	s.summary.Image = req.Image
 
-	namespace, err := k8s.ExtractNamespace(req)
+	s.token = req.ServiceAccountToken
+
+	logger.Debugf("Resolving service account token")
+
+	ctx := context.Background()
+
+	if cfg.Timeouts.Run.Duration > 0 {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, cfg.Timeouts.Run.Duration)
+		defer cancel()
+	}
+
+	token, err := runPhase(ctx, s, phaseToken, cfg.Timeouts.Token.Duration, func(ctx context.Context) (string, error) {
+		return k8s.ResolveToken(ctx, req, cfg.Token.Sources, k8s.NewClusterClient)
+	})
 	if err != nil {
-		return fmt.Errorf("unable to extract namespace: %w", err)
+		return fmt.Errorf("unable to resolve service account token: %w", err)
+	}
+
+	if err := k8s.VerifyIssuer(ctx, token, cfg.Token.Issuers); err != nil {
+		return fmt.Errorf("unable to verify service account token: %w", err)
 	}
 
-	logger.L().Printf("Matching mirrors for registry config: %s", registriesConfPath)
+	s.token = token
+	req.ServiceAccountToken = token
 
-	mirrors, err := mirrors.Match(req, registriesConfPath)
+	logger.Debugf("Parsing namespace from token")
+
+	identity, err := k8s.ExtractIdentity(req, cfg.Token.Leeway.Duration, k8s.NewClaimMapper(&cfg.Token.ClaimMapping))
 	if err != nil {
-		return fmt.Errorf("unable to match mirrors: %w", err)
+		return fmt.Errorf("unable to extract namespace: %w", err)
 	}
 
-	if len(mirrors) == 0 {
-		logger.L().Printf("No mirrors found, will not write any auth file")
+	namespace := identity.Namespace
+	s.summary.Namespace = namespace
 
-		return response()
+	logger.Infof("Got namespace %q for %s", namespace, identity.Workload)
+
+	if !cfg.Namespaces.Allows(namespace) {
+		logger.Infof("Namespace %q is not enabled, will not write any auth file", namespace)
+
+		return response(s.apiVersion)
 	}
 
-	logger.L().Printf("Got mirror(s) for %q: %q", req.Image, strings.Join(mirrors, ", "))
+	if cfg.Audit.Enabled {
+		logger.Infof("Audit mode enabled, recording the credentials to %s instead of writing the auth file", cfg.Audit.File)
+	} else if err := claims.Publish(cfg); err != nil {
+		// Other providers still see the previously published claims
+		logger.Warnf("Unable to publish the registry claims: %v", err)
+	}
+
+	var pol *policy.Policy
+
+	// Registry credential policies are not supported in the standalone mode
+	if cfg.RegistryCredentialPolicies && cfg.StaticSecretsDir == "" {
+		pol, err = runPhase(ctx, s, phasePolicy, cfg.Timeouts.Secrets.Duration, func(ctx context.Context) (*policy.Policy, error) {
+			return loadPolicy(ctx, cfg, clientFunc, req.ServiceAccountToken, namespace)
+		})
+		if err != nil {
+			return fmt.Errorf("unable to load registry credential policy: %w", err)
+		}
+	}
 
-	logger.L().Printf("Getting secrets from namespace: %s", namespace)
+	logger.Debugf("Resolving pull sources for registry config: %s", registriesConfPath)
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
-	defer cancel()
+	s.phase = phaseMirrors
+	mirrorsStart := time.Now()
 
-	secrets, err := k8s.RetrieveSecrets(ctx, clientFunc, req.ServiceAccountToken, namespace)
+	sources, err := mirrors.Resolve(req.Image, cfg)
 	if err != nil {
-		// Check if context was cancelled or timed out
-		if ctx.Err() != nil {
-			return fmt.Errorf("unable to get secrets (context error): %w", err)
+		return fmt.Errorf("unable to resolve pull sources: %w", err)
+	}
+
+	sources = pol.Sources(sources)
+
+	if cfg.Sources.Pinning {
+		sources = pinMirror(s, sources, req.ServiceAccountAnnotations[k8s.PullMirrorAnnotation])
+	}
+
+	s.metrics.observe(phaseMirrors, mirrorsStart)
+
+	if cfg.Sources.Probe.Enabled {
+		sources = probeMirrors(ctx, cfg, s, sources)
+	}
+
+	s.metrics.Sources = len(sources)
+
+	for i := range sources {
+		if sources[i].Allowed {
+			s.metrics.AllowedSources++
+
+			logger.Debugf("Pull source %q is allowed to receive credentials", sources[i].Reference)
+		} else {
+			logger.Debugf("Pull source %q is not allowed to receive credentials: %s", sources[i].Reference, sources[i].Reason)
+		}
+	}
+
+	allowedMirrors := mirrors.Mirrors(sources)
+	s.summary.Mirrors = len(allowedMirrors)
+	if len(allowedMirrors) == 0 {
+		if err := pol.Denied(sources); err != nil {
+			reportDenial(ctx, cfg, clientFunc, req.ServiceAccountToken, identity, err)
+
+			return fmt.Errorf("unable to provide credentials for %q: %w", req.Image, err)
 		}
 
+		logger.Infof("No allowed mirrors found, will not write any auth file")
+
+		return response(s.apiVersion)
+	}
+
+	logger.Infof("Got mirror(s) for %q: %q", req.Image, strings.Join(allowedMirrors, ", "))
+
+	if !cfg.Audit.Enabled && cachedNoCredentials(cfg, namespace, req.Image) {
+		logger.Infof("No credentials found for namespace %s and the registry of %q within the last %s, skipping", namespace, req.Image, cfg.Secrets.NegativeCacheTTL.Duration)
+
+		s.summary.NegativeCached = true
+
+		return response(s.apiVersion)
+	}
+
+	if path, file, ok := reusableAuthFile(cfg, namespace, req.Image); ok && !cfg.Audit.Enabled && !respondsCredentials(cfg) {
+		logger.Infof("Reusing auth file %s written at %s", path, file.Updated.Format(time.RFC3339))
+
+		s.summary.Reused = true
+		s.summary.AuthFile = path
+		s.summary.SecretsMatched = len(file.Secrets)
+		s.summary.sidecar(path)
+
+		return response(s.apiVersion)
+	}
+
+	release, admitted := admit(&cfg.Admission)
+	if !admitted {
+		return shed(cfg, namespace, req.Image, s)
+	}
+	defer release()
+
+	stamp, err := NewStamp(cfg)
+	if err != nil {
+		return err
+	}
+
+	stamp.Workload = identity.Workload
+	stamp.Expires = pol.Expires(time.Now())
+
+	logger.Debugf("Getting secrets from namespace: %s", namespace)
+
+	secrets, err := runPhase(ctx, s, phaseSecrets, cfg.Timeouts.Secrets.Duration, func(ctx context.Context) (*corev1.SecretList, error) {
+		return retrieveSecrets(ctx, cfg, clientFunc, req.ServiceAccountToken, namespace, identity.Workload)
+	})
+	if err != nil {
 		return fmt.Errorf("unable to get secrets: %w", err)
 	}
 
-	logger.L().Printf("Got %d secret(s)", len(secrets.Items))
+	secrets, s.metrics.OversizedSecrets = k8s.LimitSecrets(secrets, cfg.Secrets.MaxSize)
+	secrets = pol.Secrets(secrets)
+
+	logger.Infof("Got %d secret(s)", len(secrets.Items))
 
-	authFilePath, err := auth.CreateAuthFile(secrets, kubeletAuthFilePath, authDir, namespace, req.Image, mirrors)
+	s.metrics.Secrets = len(secrets.Items)
+	s.summary.SecretsConsidered = len(secrets.Items)
+
+	if cfg.Shadow.Enabled {
+		s.summary.Divergences = shadow(ctx, cfg, clientFunc, req.ServiceAccountToken, identity, secrets, req.Image, sources)
+	}
+
+	res, err := runPhase(ctx, s, phaseWrite, cfg.Timeouts.Write.Duration, func(ctx context.Context) (*auth.Result, error) {
+		if respondsCredentials(cfg) {
+			return resolveCredentials(ctx, pol.Config(cfg), secrets, req.Image, sources)
+		}
+
+		tlsSecrets := retrieveTLSSecrets(ctx, cfg, k8s.NewClusterClient)
+
+		return provision(ctx, pol.Config(cfg), stamp, secrets, tlsSecrets, namespace, req.Image, sources, req.ServiceAccountToken)
+	})
 	if err != nil {
+		if errors.Is(err, auth.ErrNoAuths) {
+			cacheNoCredentials(cfg, namespace, req.Image)
+		}
+
 		return fmt.Errorf("unable to create auth file: %w", err)
 	}
 
-	logger.L().Printf("Auth file path: %s", authFilePath)
+	s.summary.Audited = cfg.Audit.Enabled
+	s.summary.AuthFile = res.Path
+	s.summary.SecretsMatched = len(res.Secrets)
+
+	skipped := maps.Clone(res.Skipped)
+	if s.metrics.OversizedSecrets > 0 {
+		skipped[auth.SkipReasonOversized] = s.metrics.OversizedSecrets
+	}
 
-	return response()
+	s.summary.SecretsSkipped = skipped
+	s.metrics.SkippedSecrets = skipped
+
+	if cfg.Audit.Enabled {
+		logger.Infof("Recorded %d secret(s) providing credentials to the audit file", len(res.Secrets))
+
+		s.phase = phaseResponse
+
+		return response(s.apiVersion)
+	}
+
+	if respondsCredentials(cfg) {
+		logger.Infof("Responding with the credentials of %d secret(s) instead of writing the auth file", len(res.Secrets))
+
+		s.summary.Responded = true
+
+		if len(res.Secrets) == 0 {
+			cacheNoCredentials(cfg, namespace, req.Image)
+		}
+
+		s.phase = phaseResponse
+
+		return credentialsResponse(s.apiVersion, res.Contents)
+	}
+
+	logger.Infof("Auth file path: %s", res.Path)
+
+	s.summary.sidecar(res.Path)
+
+	// Registries federating the identity provide tokens without any secret
+	if len(res.Secrets) == 0 && !hasRegistryTokens(res.Contents) {
+		cacheNoCredentials(cfg, namespace, req.Image)
+	}
+
+	// Enforce the retention inline to bound the auth directory between gc runs
+	evicted, err := retention.Sweep(cfg, time.Now())
+	if err != nil {
+		logger.Warnf("Unable to enforce auth file retention: %v", err)
+	}
+
+	s.metrics.Evictions = len(evicted)
+
+	s.phase = phaseResponse
+
+	return response(s.apiVersion)
+}
+
+// retrieveSecrets returns the secrets of the namespace, or only the
+// imagePullSecrets of the workload if enabled, merged with the shared secrets
+// if the namespace is permitted to reference them as well as the cluster pull
+// secrets if enabled. Shared and cluster pull secrets which cannot be
+// retrieved get skipped.
+func retrieveSecrets(ctx context.Context, cfg *config.Config, clientFunc k8s.ClientFunc, token, namespace string, workload k8s.Workload) (*corev1.SecretList, error) {
+	get := func(namespace string) (*corev1.SecretList, error) {
+		if cfg.StaticSecretsDir != "" {
+			return k8s.ReadStaticSecrets(cfg.StaticSecretsDir, namespace)
+		}
+
+		return k8s.RetrieveSecrets(ctx, clientFunc, token, namespace, &cfg.Secrets)
+	}
+
+	var (
+		secrets *corev1.SecretList
+		err     error
+	)
+
+	if cfg.Secrets.PodPullSecrets && cfg.StaticSecretsDir == "" {
+		secrets, err = k8s.RetrieveWorkloadSecrets(ctx, clientFunc, token, namespace, workload, &cfg.Secrets)
+	} else {
+		secrets, err = get(namespace)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Secrets.Shared.Allows(namespace) {
+		shared, err := get(cfg.Secrets.Shared.Namespace)
+		if err != nil {
+			logger.Warnf("Unable to get shared secrets from namespace %s: %v", cfg.Secrets.Shared.Namespace, err)
+		} else {
+			logger.Infof("Referencing %d shared secret(s) from namespace %s", len(shared.Items), cfg.Secrets.Shared.Namespace)
+
+			secrets = k8s.MergeSharedSecrets(secrets, shared)
+		}
+	}
+
+	if cfg.Secrets.ClusterPullSecrets && cfg.StaticSecretsDir == "" {
+		distributed, err := retrieveClusterPullSecrets(ctx, clientFunc, token, namespace)
+		if err != nil {
+			logger.Warnf("Unable to get cluster pull secrets: %v", err)
+		} else {
+			secrets = k8s.MergeSharedSecrets(secrets, distributed)
+		}
+	}
+
+	return secrets, nil
+}
+
+func loadPolicy(ctx context.Context, cfg *config.Config, clientFunc k8s.ClientFunc, token, namespace string) (*policy.Policy, error) {
+	client, err := clientFunc(token)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to Kubernetes API: %w", err)
+	}
+
+	return policy.Load(ctx, cfg, client, namespace)
+}
+
+func retrieveClusterPullSecrets(ctx context.Context, clientFunc k8s.ClientFunc, token, namespace string) (*corev1.SecretList, error) {
+	client, err := clientFunc(token)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to Kubernetes API: %w", err)
+	}
+
+	return k8s.RetrieveClusterPullSecrets(ctx, client, namespace)
+}
+
+// retrieveTLSSecrets returns the kubernetes.io/tls secrets of the registries
+// requiring mutual TLS by using the node identity of the token exchange,
+// because the service account of the request must not be able to read the
+// private keys. Failures only get logged, which keeps the default client for
+// the registries.
+func retrieveTLSSecrets(ctx context.Context, cfg *config.Config, clientFunc k8s.NodeClientFunc) *corev1.SecretList {
+	if !cfg.TokenExchange.Enabled() || len(registrytls.SecretReferences(cfg.RegistryTLS)) == 0 {
+		return nil
+	}
+
+	kubeconfig := cfg.TokenExchange.Kubeconfig
+	if kubeconfig == "" {
+		kubeconfig = config.KubeletKubeconfig()
+	}
+
+	client, err := clientFunc(kubeconfig)
+	if err != nil {
+		logger.Warnf("Unable to get registry TLS secrets: %v", err)
+
+		return nil
+	}
+
+	return RetrieveTLSSecrets(ctx, cfg, client)
+}
+
+// reportDenial creates a warning event for the workload denied by a registry
+// credential policy, if enabled. Failures only get logged, because the
+// denial is reported by the error of the run as well.
+func reportDenial(ctx context.Context, cfg *config.Config, clientFunc k8s.ClientFunc, token string, identity *k8s.Identity, denial error) {
+	if !cfg.Events.Kubernetes {
+		return
+	}
+
+	client, err := clientFunc(token)
+	if err == nil {
+		err = k8s.CreateWarningEvent(ctx, client, identity.Namespace, identity.Workload, eventReasonNotAuthorized, denial.Error())
+	}
+
+	if err != nil {
+		logger.Warnf("Unable to report the denial to namespace %s: %v", identity.Namespace, err)
+	}
 }
 
-func response() error {
-	resp := cpv1.CredentialProviderResponse{
+// shed responds to a run exceeding the admission limit with the auth file
+// previously written for the namespace and image if it did not expire, or
+// without credentials otherwise.
+func shed(cfg *config.Config, namespace, image string, s *runState) error {
+	s.summary.Shed = true
+
+	path, file, ok := recordedAuthFile(cfg, namespace, image, 0)
+	if !ok || cfg.Audit.Enabled || respondsCredentials(cfg) {
+		logger.Warnf("More than %d runs in flight, responding without credentials", cfg.Admission.MaxInFlight)
+
+		return response(s.apiVersion)
+	}
+
+	logger.Warnf("More than %d runs in flight, keeping auth file %s written at %s", cfg.Admission.MaxInFlight, path, file.Updated.Format(time.RFC3339))
+
+	s.summary.AuthFile = path
+	s.summary.SecretsMatched = len(file.Secrets)
+	s.summary.sidecar(path)
+
+	return response(s.apiVersion)
+}
+
+// response writes the response without credentials of the API version to
+// stdout.
+func response(apiVersion string) error {
+	return writeResponse(&cpv1.CredentialProviderResponse{
 		TypeMeta: metav1.TypeMeta{
 			Kind:       "CredentialProviderResponse",
-			APIVersion: "credentialprovider.kubelet.k8s.io/v1",
+			APIVersion: apiVersion,
 		},
 		CacheKeyType: cpv1.RegistryPluginCacheKeyType,
+	})
+}
+
+// credentialsResponse writes the response of the API version carrying the
+// credentials of the auth file contents to stdout. The credentials get cached
+// by the kubelet per image, because the secrets may be scoped to
+// repositories.
+func credentialsResponse(apiVersion string, contents docker.ConfigJSON) error {
+	resp := &cpv1.CredentialProviderResponse{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "CredentialProviderResponse",
+			APIVersion: apiVersion,
+		},
+		CacheKeyType: cpv1.ImagePluginCacheKeyType,
+		Auth:         map[string]cpv1.AuthConfig{},
+	}
+
+	for key, entry := range auth.Credentials(contents) {
+		resp.Auth[key] = cpv1.AuthConfig{Username: entry.Username, Password: entry.Password}
 	}
 
+	return writeResponse(resp)
+}
+
+// writeResponse writes the response to stdout.
+func writeResponse(resp *cpv1.CredentialProviderResponse) error {
 	if err := json.NewEncoder(os.Stdout).Encode(resp); err != nil {
 		return fmt.Errorf("unable to write credential provider response: %w", err)
 	}
@@ -17,13 +17,19 @@ import (
 	"github.com/stretchr/testify/require"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
 	cpv1 "k8s.io/kubelet/pkg/apis/credentialprovider/v1"
 
-	"github.com/cri-o/crio-credential-provider/internal/pkg/docker"
+	internalAuth "github.com/cri-o/crio-credential-provider/internal/pkg/auth"
 	"github.com/cri-o/crio-credential-provider/internal/pkg/k8s"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/state"
 	"github.com/cri-o/crio-credential-provider/pkg/auth"
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+	"github.com/cri-o/crio-credential-provider/pkg/docker"
+	"github.com/cri-o/crio-credential-provider/pkg/mirrors"
 )
 
 const (
@@ -92,7 +98,11 @@ func TestRun(t *testing.T) {
 
 		var claims jwt.MapClaims
 		if includeNamespace {
-			claims = jwt.MapClaims{k8sClaimKey: map[string]any{"namespace": namespace}}
+			claims = jwt.MapClaims{k8sClaimKey: map[string]any{
+				"namespace":      namespace,
+				"serviceaccount": map[string]any{"name": "builder", "uid": "3f0c1d2e"},
+				"pod":            map[string]any{"name": "app-0"},
+			}}
 		}
 
 		serviceAccountToken := prepareToken(t, claims)
@@ -163,6 +173,46 @@ func TestRun(t *testing.T) {
 
 				require.Len(t, authConfig.Auths, 1)
 				require.Equal(t, usernamePasswordBase64, authConfig.Auths[mirror].Auth)
+
+				integrityKey, err := auth.ReadKey(filepath.Join(authDir, "integrity.key"))
+				require.NoError(t, err)
+
+				verified, err := auth.Read(authDir, namespace, image, config.AuthFormatAuthJSON, integrityKey)
+				require.NoError(t, err)
+				require.Equal(t, authConfig, *verified)
+
+				s, err := state.Load(filepath.Join(authDir, "state.json"))
+				require.NoError(t, err)
+				require.Equal(t, []string{path}, s.FilesFor(namespace, "secret"))
+				require.Equal(t, []mirrors.Source{
+					{Reference: mirror + "/library/image", Location: mirror, Mirror: true, Allowed: true, Prefix: registry},
+					{Reference: image, Location: registry, Allowed: true, Prefix: registry},
+				}, s.Files[path].Sources)
+				require.Equal(t, k8s.Workload{ServiceAccount: "builder", ServiceAccountUID: "3f0c1d2e", Pod: "app-0"}, s.Files[path].Workload)
+			},
+		},
+		"success mirror rejected by policy": {
+			prepare: func() (*bytes.Buffer, string, string, k8s.ClientFunc) {
+				tempDir, registriesConf := tempDirWithRegistriesConf()
+
+				_, err := registriesConf.WriteString(testRegistryConfig)
+				require.NoError(t, err)
+
+				require.NoError(t, os.WriteFile(filepath.Join(tempDir, "policy.json"), fmt.Appendf(nil,
+					`{"default":[{"type":"insecureAcceptAnything"}],"transports":{"docker":{%q:[{"type":"reject"}]}}}`, mirror,
+				), 0o600))
+
+				return requestBuffer(true),
+					registriesConf.Name(),
+					tempDir,
+					nil
+			},
+			assert: func(err error, authDir string) {
+				require.NoError(t, err)
+
+				path, err := auth.FilePath(authDir, namespace, image)
+				require.NoError(t, err)
+				require.NoFileExists(t, path)
 			},
 		},
 		"success no mirrors": {
@@ -215,6 +265,31 @@ func TestRun(t *testing.T) {
 				require.Error(t, err)
 			},
 		},
+		"failure on panic": {
+			prepare: func() (*bytes.Buffer, string, string, k8s.ClientFunc) {
+				tempDir, registriesConf := tempDirWithRegistriesConf()
+
+				_, err := registriesConf.WriteString(testRegistryConfig)
+				require.NoError(t, err)
+
+				clientFunc := func(string) (kubernetes.Interface, error) {
+					panic("boom")
+				}
+
+				return requestBuffer(true),
+					registriesConf.Name(),
+					tempDir,
+					clientFunc
+			},
+			assert: func(err error, authDir string) {
+				require.ErrorIs(t, err, errPanic)
+				require.ErrorContains(t, err, `phase "secrets"`)
+
+				reports, err := filepath.Glob(filepath.Join(authDir, "diagnostics", "crash-*.json"))
+				require.NoError(t, err)
+				require.Len(t, reports, 1)
+			},
+		},
 		"failure on match mirrors": {
 			prepare: func() (*bytes.Buffer, string, string, k8s.ClientFunc) {
 				tempDir, registriesConf := tempDirWithRegistriesConf()
@@ -266,9 +341,127 @@ func TestRun(t *testing.T) {
 			buffer, registriesConfPath, authDir, clientFunc := tc.prepare()
 			kubeletAuthFilePath := filepath.Join(authDir, "kubelet-auth.json")
 
-			err := Run(buffer, registriesConfPath, authDir, kubeletAuthFilePath, clientFunc)
+			cfg := config.Default()
+			cfg.RegistriesConfPath = registriesConfPath
+			cfg.AuthDir = authDir
+			cfg.KubeletAuthFilePath = kubeletAuthFilePath
+			cfg.DiagnosticsDir = filepath.Join(authDir, "diagnostics")
+			cfg.IntegrityKeyPath = filepath.Join(authDir, "integrity.key")
+			cfg.StateFile = filepath.Join(authDir, "state.json")
+			cfg.Sources.PolicyPath = filepath.Join(authDir, "policy.json")
+
+			err := Run(buffer, cfg, clientFunc)
 
 			tc.assert(err, authDir)
 		})
 	}
 }
+
+func TestProvisionStrict(t *testing.T) {
+	t.Parallel()
+
+	secrets := &corev1.SecretList{Items: []corev1.Secret{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "valid", Namespace: namespace},
+			Type:       corev1.SecretTypeDockerConfigJson,
+			Data:       map[string][]byte{corev1.DockerConfigJsonKey: testSecretData},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "malformed", Namespace: namespace},
+			Type:       corev1.SecretTypeDockerConfigJson,
+			Data:       map[string][]byte{corev1.DockerConfigJsonKey: []byte("invalid")},
+		},
+	}}
+	sources := []mirrors.Source{{Reference: mirror + "/library/image", Location: mirror, Mirror: true, Allowed: true}}
+
+	for name, strict := range map[string]bool{
+		"lenient": false,
+		"strict":  true,
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+
+			cfg := config.Default()
+			cfg.AuthDir = dir
+			cfg.KubeletAuthFilePath = filepath.Join(dir, "kubelet-auth.json")
+			cfg.IntegrityKeyPath = filepath.Join(dir, "integrity.key")
+			cfg.StateFile = filepath.Join(dir, "state.json")
+			cfg.Secrets.Strict = strict
+
+			path, err := Provision(t.Context(), cfg, internalAuth.Stamp{}, secrets, nil, namespace, image, sources)
+			if strict {
+				require.ErrorIs(t, err, internalAuth.ErrMalformedSecret)
+				require.ErrorContains(t, err, namespace+"/malformed")
+
+				return
+			}
+
+			require.NoError(t, err)
+			require.FileExists(t, path)
+		})
+	}
+}
+
+func TestRetrieveSecrets(t *testing.T) {
+	t.Parallel()
+
+	const sharedNamespace = "pull-secrets"
+
+	secret := func(namespace, name string) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Type:       corev1.SecretTypeDockerConfigJson,
+			Data:       map[string][]byte{corev1.DockerConfigJsonKey: testSecretData},
+		}
+	}
+
+	for name, tc := range map[string]struct {
+		consumers []string
+		clientErr bool
+		expected  []string
+	}{
+		"success referencing shared secrets": {
+			consumers: []string{"def*"},
+			expected:  []string{sharedNamespace + "/shared", "own"},
+		},
+		"success without permitted namespace": {
+			consumers: []string{"other"},
+			expected:  []string{"own"},
+		},
+		"success skipping unavailable shared secrets": {
+			consumers: []string{namespace},
+			clientErr: true,
+			expected:  []string{"own"},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := config.Default()
+			cfg.Secrets.Shared = config.SharedSecrets{Namespace: sharedNamespace, Consumers: tc.consumers}
+
+			client := fake.NewClientset(secret(namespace, "own"), secret(sharedNamespace, "shared"), secret("other", "other"))
+			if tc.clientErr {
+				client.PrependReactor("list", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+					return action.GetNamespace() == sharedNamespace, nil, errors.New("forbidden")
+				})
+			}
+
+			clientFunc := func(string) (kubernetes.Interface, error) {
+				return client, nil
+			}
+
+			secrets, err := retrieveSecrets(t.Context(), cfg, clientFunc, "token", namespace, k8s.Workload{})
+			require.NoError(t, err)
+
+			names := []string{}
+			for i := range secrets.Items {
+				names = append(names, secrets.Items[i].Name)
+			}
+
+			require.Equal(t, tc.expected, names)
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/auth"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/k8s"
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+	"github.com/cri-o/crio-credential-provider/pkg/mirrors"
+)
+
+// auditVersion is the schema version of the audit records, which has to be
+// increased for every incompatible change of their format.
+const auditVersion = 1
+
+// auditRecord is a single record of the audit mode, which describes the
+// credentials a request would have received. It never contains any
+// credentials.
+type auditRecord struct {
+	// Version is the schema version of the record, see auditVersion.
+	Version int `json:"version"`
+
+	// Time is the time of the request.
+	Time time.Time `json:"time"`
+
+	// Namespace is the namespace of the request.
+	Namespace string `json:"namespace"`
+
+	// Image is the requested image.
+	Image string `json:"image"`
+
+	// Workload is the workload of the request, if known.
+	Workload k8s.Workload `json:"workload,omitzero"`
+
+	// Sources are the resolved pull sources of the image together with the
+	// decision whether they would have received credentials.
+	Sources []mirrors.Source `json:"sources"`
+
+	// Secrets are the names of the secrets which would have contributed
+	// credentials.
+	Secrets []string `json:"secrets"`
+
+	// Skipped are the numbers of the secrets which would not have contributed
+	// any credentials by their skip reason.
+	Skipped map[string]int `json:"skipped,omitempty"`
+
+	// Registries are the auth file keys which would have received
+	// credentials, including the ones of the global auth file.
+	Registries []string `json:"registries"`
+}
+
+// audit resolves the credentials of the request without writing the auth
+// file and appends the result to the audit file.
+func audit(ctx context.Context, cfg *config.Config, stamp auth.Stamp, secrets *corev1.SecretList, namespace, image string, sources []mirrors.Source) (*auth.Result, error) {
+	resolution, err := auth.Resolve(ctx, secrets, cfg.KubeletAuthFilePath, image, sources, cfg.SecretMatching, cfg.Sources.ScopeMirrorAuths, cfg.Timeouts.CredentialSources.Duration)
+	if err != nil {
+		return nil, fmt.Errorf("unable to resolve credentials: %w", err)
+	}
+
+	record := &auditRecord{
+		Version:    auditVersion,
+		Time:       time.Now().UTC(),
+		Namespace:  namespace,
+		Image:      image,
+		Workload:   stamp.Workload,
+		Sources:    sources,
+		Secrets:    resolution.Secrets,
+		Skipped:    resolution.Skipped,
+		Registries: slices.Sorted(maps.Keys(resolution.Contents.Auths)),
+	}
+
+	if err := appendAuditRecord(cfg.Audit.File, record); err != nil {
+		return nil, err
+	}
+
+	return &auth.Result{Secrets: resolution.Secrets, Skipped: resolution.Skipped}, nil
+}
+
+// appendAuditRecord appends the record as JSON line to the audit file.
+func appendAuditRecord(path string, record *auditRecord) error {
+	raw, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("marshal audit record: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("ensure audit file dir: %w", err)
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("open audit file: %w", err)
+	}
+
+	// A single write keeps concurrent records of multiple runs intact
+	if _, err := f.Write(append(raw, '\n')); err != nil {
+		_ = f.Close()
+
+		return fmt.Errorf("write audit record: %w", err)
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("close audit file: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,100 @@
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	cpv1 "k8s.io/kubelet/pkg/apis/credentialprovider/v1"
+
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+)
+
+func TestRunAudit(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	authDir := filepath.Join(dir, "auth")
+
+	cfg := config.Default()
+	cfg.RegistriesConfPath = filepath.Join(dir, "registries.conf")
+	cfg.AuthDir = authDir
+	cfg.KubeletAuthFilePath = filepath.Join(dir, "kubelet-auth.json")
+	cfg.DiagnosticsDir = filepath.Join(dir, "diagnostics")
+	cfg.IntegrityKeyPath = filepath.Join(dir, "integrity.key")
+	cfg.StateFile = filepath.Join(dir, "state.json")
+	cfg.Sources.PolicyPath = filepath.Join(dir, "policy.json")
+	cfg.Audit = config.Audit{Enabled: true, File: filepath.Join(dir, "audit", "audit.jsonl")}
+
+	require.NoError(t, os.WriteFile(cfg.RegistriesConfPath, []byte(testRegistryConfig), 0o600))
+
+	request := func() *bytes.Buffer {
+		raw, err := json.Marshal(&cpv1.CredentialProviderRequest{
+			Image:               image,
+			ServiceAccountToken: prepareToken(t, jwt.MapClaims{k8sClaimKey: map[string]any{"namespace": namespace}}),
+		})
+		require.NoError(t, err)
+
+		return bytes.NewBuffer(raw)
+	}
+
+	clientFunc := func(string) (kubernetes.Interface, error) {
+		return fake.NewClientset(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "secret", Namespace: namespace},
+			Type:       corev1.SecretTypeDockerConfigJson,
+			Data:       map[string][]byte{corev1.DockerConfigJsonKey: testSecretData},
+		}), nil
+	}
+
+	// Runs without credentials get recorded as well
+	require.NoError(t, Run(request(), cfg, clientFunc))
+	require.NoError(t, Run(request(), cfg, func(string) (kubernetes.Interface, error) {
+		return fake.NewClientset(), nil
+	}))
+
+	// Neither auth files nor state got written
+	require.NoDirExists(t, authDir)
+	require.NoFileExists(t, cfg.StateFile)
+	require.NoFileExists(t, cfg.IntegrityKeyPath)
+
+	f, err := os.Open(cfg.Audit.File)
+	require.NoError(t, err)
+
+	defer f.Close()
+
+	records := []auditRecord{}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		record := auditRecord{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &record))
+
+		records = append(records, record)
+	}
+
+	require.NoError(t, scanner.Err())
+	require.Len(t, records, 2)
+
+	assert.Equal(t, namespace, records[0].Namespace)
+	assert.Equal(t, image, records[0].Image)
+	assert.Equal(t, []string{"secret"}, records[0].Secrets)
+	assert.Equal(t, []string{mirror}, records[0].Registries)
+	assert.NotEmpty(t, records[0].Sources)
+
+	assert.Empty(t, records[1].Secrets)
+	assert.Empty(t, records[1].Registries)
+
+	raw, err := os.ReadFile(cfg.Audit.File)
+	require.NoError(t, err)
+	assert.NotContains(t, string(raw), usernamePasswordBase64, "no credentials get recorded")
+}
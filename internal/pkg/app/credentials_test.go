@@ -0,0 +1,86 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	cpv1 "k8s.io/kubelet/pkg/apis/credentialprovider/v1"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/k8s"
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+)
+
+//nolint:paralleltest // replaces os.Stdout
+func TestRunCredentialsResponse(t *testing.T) {
+	dir := t.TempDir()
+	authDir := filepath.Join(dir, "auth")
+
+	cfg := config.Default()
+	cfg.RegistriesConfPath = filepath.Join(dir, "registries.conf")
+	cfg.AuthDir = authDir
+	cfg.KubeletAuthFilePath = filepath.Join(dir, "kubelet-auth.json")
+	cfg.DiagnosticsDir = filepath.Join(dir, "diagnostics")
+	cfg.IntegrityKeyPath = filepath.Join(dir, "integrity.key")
+	cfg.StateFile = filepath.Join(dir, "state.json")
+	cfg.Sources.PolicyPath = filepath.Join(dir, "policy.json")
+	cfg.ResponseMode = config.ResponseModeCredentials
+
+	require.NoError(t, os.WriteFile(cfg.RegistriesConfPath, []byte(testRegistryConfig), 0o600))
+
+	// Older kubelets get a response of their own API version
+	raw, err := json.Marshal(&cpv1.CredentialProviderRequest{
+		TypeMeta:            metav1.TypeMeta{Kind: "CredentialProviderRequest", APIVersion: k8s.RequestAPIVersionV1Beta1},
+		Image:               image,
+		ServiceAccountToken: prepareToken(t, jwt.MapClaims{k8sClaimKey: map[string]any{"namespace": namespace}}),
+	})
+	require.NoError(t, err)
+
+	clientFunc := func(string) (kubernetes.Interface, error) {
+		return fake.NewClientset(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "secret", Namespace: namespace},
+			Type:       corev1.SecretTypeDockerConfigJson,
+			Data:       map[string][]byte{corev1.DockerConfigJsonKey: testSecretData},
+		}), nil
+	}
+
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+
+	stdout := os.Stdout
+	os.Stdout = w
+
+	err = Run(bytes.NewBuffer(raw), cfg, clientFunc)
+
+	os.Stdout = stdout
+
+	require.NoError(t, w.Close())
+	require.NoError(t, err)
+
+	out, err := io.ReadAll(r)
+	require.NoError(t, err)
+
+	resp := cpv1.CredentialProviderResponse{}
+	require.NoError(t, json.Unmarshal(out, &resp))
+
+	assert.Equal(t, k8s.RequestAPIVersionV1Beta1, resp.APIVersion)
+	assert.Equal(t, cpv1.ImagePluginCacheKeyType, resp.CacheKeyType)
+	assert.Equal(t, map[string]cpv1.AuthConfig{
+		mirror: {Username: "myuser", Password: "mypassword"},
+	}, resp.Auth)
+
+	// Neither auth files nor state got written
+	require.NoDirExists(t, authDir)
+	require.NoFileExists(t, cfg.StateFile)
+	require.NoFileExists(t, cfg.IntegrityKeyPath)
+}
@@ -0,0 +1,124 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"syscall"
+	"time"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/logger"
+	"github.com/cri-o/crio-credential-provider/pkg/mirrors"
+)
+
+// metricsFD is the file descriptor the metrics get written to.
+const metricsFD = 3
+
+// runMetrics is the per-invocation telemetry of a single run.
+type runMetrics struct {
+	// Success is true if the run did not fail.
+	Success bool `json:"success"`
+
+	// Phase is the last entered phase, which is the failed one on error.
+	Phase string `json:"phase"`
+
+	// DurationMs is the duration of the whole run in milliseconds.
+	DurationMs float64 `json:"durationMs"`
+
+	// PhasesMs are the durations of the finished phases in milliseconds.
+	PhasesMs map[string]float64 `json:"phasesMs"`
+
+	// Secrets is the number of retrieved secrets.
+	Secrets int `json:"secrets"`
+
+	// OversizedSecrets is the number of secrets skipped because they exceed
+	// the maximum secret size.
+	OversizedSecrets int `json:"oversizedSecrets"`
+
+	// SkippedSecrets are the numbers of secrets which did not contribute any
+	// credentials by their skip reason, including the oversized ones.
+	SkippedSecrets map[string]int `json:"skippedSecrets"`
+
+	// Sources is the number of resolved pull sources.
+	Sources int `json:"sources"`
+
+	// AllowedSources is the number of pull sources permitted to receive credentials.
+	AllowedSources int `json:"allowedSources"`
+
+	// Evictions is the number of auth files evicted by the retention.
+	Evictions int `json:"evictions"`
+
+	// CacheHits is the number of registry lookups served from the cache.
+	CacheHits uint64 `json:"cacheHits"`
+
+	// CacheMisses is the number of registry lookups which were not cached.
+	CacheMisses uint64 `json:"cacheMisses"`
+}
+
+func newRunMetrics() *runMetrics {
+	return &runMetrics{PhasesMs: map[string]float64{}, SkippedSecrets: map[string]int{}}
+}
+
+// observe records the duration of a finished phase.
+func (m *runMetrics) observe(phase string, start time.Time) {
+	m.PhasesMs[phase] = milliseconds(time.Since(start))
+}
+
+// finish completes the metrics after the run.
+func (m *runMetrics) finish(s *runState, start time.Time, err error) {
+	m.Success = err == nil
+	m.Phase = s.phase
+	m.DurationMs = milliseconds(time.Since(start))
+	m.CacheHits, m.CacheMisses = mirrors.CacheStats()
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// write encodes the metrics as a single JSON line.
+func (m *runMetrics) write(w io.Writer) error {
+	raw, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("marshal metrics: %w", err)
+	}
+
+	if _, err := w.Write(append(raw, '\n')); err != nil {
+		return fmt.Errorf("write metrics: %w", err)
+	}
+
+	return nil
+}
+
+// emitMetrics writes the metrics to the file descriptor 3 if it is open. The
+// descriptor has to refer to a pipe, socket or file to not accidentally write
+// to a descriptor opened by the Go runtime.
+func emitMetrics(m *runMetrics) {
+	var stat syscall.Stat_t
+	if err := syscall.Fstat(metricsFD, &stat); err != nil {
+		return
+	}
+
+	switch stat.Mode & syscall.S_IFMT {
+	case syscall.S_IFIFO, syscall.S_IFSOCK, syscall.S_IFREG, syscall.S_IFCHR:
+	default:
+		return
+	}
+
+	if err := m.write(fdWriter(metricsFD)); err != nil {
+		logger.Warnf("Unable to emit metrics: %v", err)
+	}
+}
+
+// fdWriter writes to a raw file descriptor without taking its ownership,
+// which means that it never gets closed.
+type fdWriter int
+
+func (fd fdWriter) Write(p []byte) (int, error) {
+	n, err := syscall.Write(int(fd), p)
+	if err != nil {
+		return n, fmt.Errorf("write to file descriptor %d: %w", fd, err)
+	}
+
+	return n, nil
+}
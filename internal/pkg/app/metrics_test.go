@@ -0,0 +1,42 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunMetrics(t *testing.T) {
+	t.Parallel()
+
+	m := newRunMetrics()
+	s := &runState{phase: phaseWrite, metrics: m}
+
+	m.observe(phaseToken, time.Now().Add(-time.Second))
+	m.Secrets = 2
+	m.SkippedSecrets = map[string]int{"noMatch": 1}
+	m.finish(s, time.Now().Add(-2*time.Second), errors.New("test"))
+
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+
+	defer r.Close()
+
+	require.NoError(t, m.write(fdWriter(w.Fd())))
+	require.NoError(t, w.Close())
+
+	res := &runMetrics{}
+	require.NoError(t, json.NewDecoder(r).Decode(res))
+
+	assert.False(t, res.Success)
+	assert.Equal(t, phaseWrite, res.Phase)
+	assert.Equal(t, 2, res.Secrets)
+	assert.Equal(t, map[string]int{"noMatch": 1}, res.SkippedSecrets)
+	assert.GreaterOrEqual(t, res.DurationMs, 2000.0)
+	assert.GreaterOrEqual(t, res.PhasesMs[phaseToken], 1000.0)
+}
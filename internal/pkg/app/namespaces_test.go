@@ -0,0 +1,49 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/kubernetes"
+	cpv1 "k8s.io/kubelet/pkg/apis/credentialprovider/v1"
+
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+)
+
+func TestRunNamespaceNotEnabled(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	cfg := config.Default()
+	cfg.RegistriesConfPath = filepath.Join(dir, "registries.conf")
+	cfg.AuthDir = filepath.Join(dir, "auth")
+	cfg.KubeletAuthFilePath = filepath.Join(dir, "kubelet-auth.json")
+	cfg.DiagnosticsDir = filepath.Join(dir, "diagnostics")
+	cfg.IntegrityKeyPath = filepath.Join(dir, "integrity.key")
+	cfg.StateFile = filepath.Join(dir, "state.json")
+	cfg.Sources.PolicyPath = filepath.Join(dir, "policy.json")
+	cfg.Namespaces.Include = []string{"pilot-*"}
+
+	require.NoError(t, os.WriteFile(cfg.RegistriesConfPath, []byte(testRegistryConfig), 0o600))
+
+	raw, err := json.Marshal(&cpv1.CredentialProviderRequest{
+		Image:               image,
+		ServiceAccountToken: prepareToken(t, jwt.MapClaims{k8sClaimKey: map[string]any{"namespace": namespace}}),
+	})
+	require.NoError(t, err)
+
+	// The secrets of namespaces which are not enabled never get retrieved
+	require.NoError(t, Run(bytes.NewBuffer(raw), cfg, func(string) (kubernetes.Interface, error) {
+		return nil, errors.New("must not be called")
+	}))
+
+	assert.NoDirExists(t, cfg.AuthDir)
+}
@@ -0,0 +1,45 @@
+package app
+
+import (
+	"time"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/logger"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/state"
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+)
+
+// cachedNoCredentials returns true if a recent request of the namespace for
+// the registry of the image did not find any credentials. Errors get logged
+// and result in retrieving the secrets again.
+func cachedNoCredentials(cfg *config.Config, namespace, image string) bool {
+	if cfg.Secrets.NegativeCacheTTL.Duration <= 0 {
+		return false
+	}
+
+	s, err := state.Load(cfg.StateFile)
+	if err != nil {
+		logger.Warnf("Unable to check the negative cache: %v", err)
+
+		return false
+	}
+
+	return s.HasNoCredentials(namespace, image, time.Now())
+}
+
+// cacheNoCredentials records that the request of the namespace for the
+// registry of the image did not find any credentials.
+func cacheNoCredentials(cfg *config.Config, namespace, image string) {
+	ttl := cfg.Secrets.NegativeCacheTTL.Duration
+	if ttl <= 0 {
+		return
+	}
+
+	if err := state.Update(cfg.StateFile, func(s *state.State) error {
+		now := time.Now()
+		s.SetNoCredentials(namespace, image, now, now.Add(ttl))
+
+		return nil
+	}); err != nil {
+		logger.Warnf("Unable to update the negative cache: %v", err)
+	}
+}
@@ -0,0 +1,74 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	cpv1 "k8s.io/kubelet/pkg/apis/credentialprovider/v1"
+
+	internalAuth "github.com/cri-o/crio-credential-provider/internal/pkg/auth"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/state"
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+)
+
+func TestRunNegativeCache(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	cfg := config.Default()
+	cfg.RegistriesConfPath = filepath.Join(dir, "registries.conf")
+	cfg.AuthDir = dir
+	cfg.KubeletAuthFilePath = filepath.Join(dir, "kubelet-auth.json")
+	cfg.DiagnosticsDir = filepath.Join(dir, "diagnostics")
+	cfg.IntegrityKeyPath = filepath.Join(dir, "integrity.key")
+	cfg.StateFile = filepath.Join(dir, "state.json")
+	cfg.Sources.PolicyPath = filepath.Join(dir, "policy.json")
+	cfg.Secrets.NegativeCacheTTL.Duration = time.Hour
+
+	require.NoError(t, os.WriteFile(cfg.RegistriesConfPath, []byte(testRegistryConfig), 0o600))
+
+	request := func() *bytes.Buffer {
+		raw, err := json.Marshal(&cpv1.CredentialProviderRequest{
+			Image:               image,
+			ServiceAccountToken: prepareToken(t, jwt.MapClaims{k8sClaimKey: map[string]any{"namespace": namespace}}),
+		})
+		require.NoError(t, err)
+
+		return bytes.NewBuffer(raw)
+	}
+
+	// Without any secret no credentials get found
+	require.ErrorIs(t, Run(request(), cfg, func(string) (kubernetes.Interface, error) {
+		return fake.NewClientset(), nil
+	}), internalAuth.ErrNoAuths)
+
+	s, err := state.Load(cfg.StateFile)
+	require.NoError(t, err)
+	require.True(t, s.HasNoCredentials(namespace, image, time.Now()))
+
+	// The secrets do not get retrieved while the result is cached
+	require.NoError(t, Run(request(), cfg, func(string) (kubernetes.Interface, error) {
+		return nil, errors.New("must not be called")
+	}))
+
+	// Expired results get retrieved again
+	require.NoError(t, state.Update(cfg.StateFile, func(s *state.State) error {
+		s.SetNoCredentials(namespace, image, time.Now(), time.Now())
+
+		return nil
+	}))
+
+	require.Error(t, Run(request(), cfg, func(string) (kubernetes.Interface, error) {
+		return nil, errors.New("called")
+	}))
+}
@@ -0,0 +1,61 @@
+package app
+
+import (
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/diagnostics"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/errcode"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/k8s"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/logger"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/version"
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+)
+
+var errPanic = errcode.New(errcode.Panicked, "credential provider panicked")
+
+// handlePanic converts the recovered value r into a crash report and returns
+// an error to be reported back to the kubelet. The kubelet still receives the
+// response without credentials, like for runs not finding any.
+func handlePanic(cfg *config.Config, s *runState, r any) error {
+	stack := debug.Stack()
+
+	if p, ok := r.(*phasePanic); ok {
+		r = p.value
+		stack = p.stack
+	}
+
+	configHash, err := cfg.Hash()
+	if err != nil {
+		configHash = "unknown"
+	}
+
+	report := &diagnostics.CrashReport{
+		Time:       time.Now(),
+		Version:    version.Version,
+		Phase:      s.phase,
+		ConfigHash: configHash,
+		Panic:      diagnostics.Sanitize(fmt.Sprint(r), s.token),
+		Stack:      diagnostics.Sanitize(string(stack), s.token),
+	}
+
+	// The panic may occur before the API version of the request is known
+	apiVersion := s.apiVersion
+	if apiVersion == "" {
+		apiVersion = k8s.RequestAPIVersion
+	}
+
+	if err := response(apiVersion); err != nil {
+		logger.Warnf("Unable to respond after panic: %v", err)
+	}
+
+	path, err := diagnostics.WriteCrashReport(cfg.DiagnosticsDir, report)
+	if err != nil {
+		logger.Warnf("Unable to write crash report: %v", err)
+
+		return fmt.Errorf("%w in phase %q: %s", errPanic, report.Phase, report.Panic)
+	}
+
+	return fmt.Errorf("%w in phase %q, crash report written to %s", errPanic, report.Phase, path)
+}
@@ -0,0 +1,72 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	cpv1 "k8s.io/kubelet/pkg/apis/credentialprovider/v1"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/k8s"
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+)
+
+//nolint:paralleltest // replaces os.Stdout
+func TestRunPanicResponse(t *testing.T) {
+	dir := t.TempDir()
+
+	cfg := config.Default()
+	cfg.RegistriesConfPath = filepath.Join(dir, "registries.conf")
+	cfg.AuthDir = filepath.Join(dir, "auth")
+	cfg.KubeletAuthFilePath = filepath.Join(dir, "kubelet-auth.json")
+	cfg.DiagnosticsDir = filepath.Join(dir, "diagnostics")
+	cfg.IntegrityKeyPath = filepath.Join(dir, "integrity.key")
+	cfg.StateFile = filepath.Join(dir, "state.json")
+	cfg.Sources.PolicyPath = filepath.Join(dir, "policy.json")
+
+	require.NoError(t, os.WriteFile(cfg.RegistriesConfPath, []byte(testRegistryConfig), 0o600))
+
+	raw, err := json.Marshal(&cpv1.CredentialProviderRequest{
+		TypeMeta:            metav1.TypeMeta{Kind: "CredentialProviderRequest", APIVersion: k8s.RequestAPIVersionV1Beta1},
+		Image:               image,
+		ServiceAccountToken: prepareToken(t, jwt.MapClaims{k8sClaimKey: map[string]any{"namespace": namespace}}),
+	})
+	require.NoError(t, err)
+
+	clientFunc := func(string) (kubernetes.Interface, error) {
+		panic("boom")
+	}
+
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+
+	stdout := os.Stdout
+	os.Stdout = w
+
+	err = Run(bytes.NewBuffer(raw), cfg, clientFunc)
+
+	os.Stdout = stdout
+
+	require.NoError(t, w.Close())
+	require.ErrorIs(t, err, errPanic)
+
+	out, err := io.ReadAll(r)
+	require.NoError(t, err)
+
+	// The kubelet still gets a response without credentials
+	resp := cpv1.CredentialProviderResponse{}
+	require.NoError(t, json.Unmarshal(out, &resp))
+
+	assert.Equal(t, k8s.RequestAPIVersionV1Beta1, resp.APIVersion)
+	assert.Equal(t, "CredentialProviderResponse", resp.Kind)
+	assert.Equal(t, cpv1.RegistryPluginCacheKeyType, resp.CacheKeyType)
+	assert.Empty(t, resp.Auth)
+}
@@ -0,0 +1,84 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"time"
+)
+
+const (
+	phaseRequest  = "request"
+	phaseToken    = "token"
+	phasePolicy   = "policy"
+	phaseMirrors  = "mirrors"
+	phaseProbe    = "probe"
+	phaseSecrets  = "secrets"
+	phaseWrite    = "write"
+	phaseResponse = "response"
+)
+
+// runState tracks the progress of a single run.
+type runState struct {
+	phase      string
+	token      string
+	apiVersion string
+	metrics    *runMetrics
+	summary    runSummary
+}
+
+type phaseResult[T any] struct {
+	value T
+	err   error
+	panic *phasePanic
+}
+
+// phasePanic wraps a panic which occurred in a phase goroutine to preserve
+// its original stack when re-panicking in the calling goroutine.
+type phasePanic struct {
+	value any
+	stack []byte
+}
+
+// runPhase executes fn bounded by the provided timeout. The function gets
+// abandoned if it does not return in time, which ensures that a hanging phase
+// cannot block the whole run. A non positive timeout disables the deadline.
+func runPhase[T any](ctx context.Context, s *runState, phase string, timeout time.Duration, fn func(context.Context) (T, error)) (T, error) {
+	s.phase = phase
+
+	defer s.metrics.observe(phase, time.Now())
+
+	if timeout <= 0 {
+		return fn(ctx)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	resCh := make(chan phaseResult[T], 1)
+
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				resCh <- phaseResult[T]{panic: &phasePanic{value: r, stack: debug.Stack()}}
+			}
+		}()
+
+		value, err := fn(ctx)
+		resCh <- phaseResult[T]{value: value, err: err}
+	}()
+
+	select {
+	case res := <-resCh:
+		if res.panic != nil {
+			panic(res.panic)
+		}
+
+		return res.value, res.err
+
+	case <-ctx.Done():
+		var zero T
+
+		return zero, fmt.Errorf("%s phase did not finish within %s: %w", phase, timeout, ctx.Err())
+	}
+}
@@ -0,0 +1,92 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunPhase(t *testing.T) {
+	t.Parallel()
+
+	errTest := errors.New("test")
+
+	for name, tc := range map[string]struct {
+		timeout time.Duration
+		fn      func(context.Context) (string, error)
+		assert  func(string, error)
+	}{
+		"success": {
+			timeout: time.Second,
+			fn: func(context.Context) (string, error) {
+				return "value", nil
+			},
+			assert: func(res string, err error) {
+				require.NoError(t, err)
+				require.Equal(t, "value", res)
+			},
+		},
+		"success without timeout": {
+			fn: func(ctx context.Context) (string, error) {
+				_, hasDeadline := ctx.Deadline()
+				require.False(t, hasDeadline)
+
+				return "value", nil
+			},
+			assert: func(res string, err error) {
+				require.NoError(t, err)
+				require.Equal(t, "value", res)
+			},
+		},
+		"failure on phase error": {
+			timeout: time.Second,
+			fn: func(context.Context) (string, error) {
+				return "", errTest
+			},
+			assert: func(_ string, err error) {
+				require.ErrorIs(t, err, errTest)
+			},
+		},
+		"failure on timeout": {
+			timeout: time.Millisecond,
+			fn: func(context.Context) (string, error) {
+				time.Sleep(time.Second)
+
+				return "value", nil
+			},
+			assert: func(res string, err error) {
+				require.ErrorIs(t, err, context.DeadlineExceeded)
+				require.ErrorContains(t, err, "test phase")
+				require.Empty(t, res)
+			},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			s := &runState{metrics: newRunMetrics()}
+
+			res, err := runPhase(t.Context(), s, "test", tc.timeout, tc.fn)
+			tc.assert(res, err)
+			require.Equal(t, "test", s.phase)
+		})
+	}
+}
+
+func TestRunPhasePanic(t *testing.T) {
+	t.Parallel()
+
+	defer func() {
+		p, ok := recover().(*phasePanic)
+		require.True(t, ok)
+		require.Equal(t, "boom", p.value)
+		require.NotEmpty(t, p.stack)
+	}()
+
+	_, _ = runPhase(t.Context(), &runState{metrics: newRunMetrics()}, "test", time.Second, func(context.Context) (string, error) {
+		panic("boom")
+	})
+}
@@ -0,0 +1,49 @@
+package app
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/logger"
+	"github.com/cri-o/crio-credential-provider/pkg/mirrors"
+)
+
+// reasonPinned is the reason of sources skipped because of a pinned mirror.
+const reasonPinned = "pinned to another mirror"
+
+// pinMirror restricts the credentials to the allowed mirror named by the pull
+// mirror annotation of the service account, which can be its location or its
+// host. All other sources, including the image itself, do not receive
+// credentials. Pins naming no allowed mirror of the sources get ignored.
+func pinMirror(s *runState, sources []mirrors.Source, pin string) []mirrors.Source {
+	if pin == "" {
+		return sources
+	}
+
+	pinned := func(source *mirrors.Source) bool {
+		host, _, _ := strings.Cut(source.Location, "/")
+
+		return source.Mirror && source.Allowed && (source.Location == pin || host == pin)
+	}
+
+	if !slices.ContainsFunc(sources, func(source mirrors.Source) bool { return pinned(&source) }) {
+		logger.Warnf("Ignoring pinned mirror %q, which is no allowed mirror of the image", pin)
+
+		return sources
+	}
+
+	logger.Infof("Pinning the credentials to mirror %q", pin)
+
+	s.summary.PinnedMirror = pin
+
+	res := slices.Clone(sources)
+
+	for i := range res {
+		if res[i].Allowed && !pinned(&res[i]) {
+			res[i].Allowed = false
+			res[i].Reason = reasonPinned
+		}
+	}
+
+	return res
+}
@@ -0,0 +1,67 @@
+package app
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cri-o/crio-credential-provider/pkg/mirrors"
+)
+
+func TestPinMirror(t *testing.T) {
+	t.Parallel()
+
+	for name, tc := range map[string]struct {
+		pin           string
+		expectAllowed []bool
+		expectPinned  string
+	}{
+		"no pin": {
+			expectAllowed: []bool{true, true, false, true},
+		},
+		"pin by location": {
+			pin:           "next.mirror.local/org",
+			expectAllowed: []bool{false, true, false, false},
+			expectPinned:  "next.mirror.local/org",
+		},
+		"pin by host": {
+			pin:           "mirror.local",
+			expectAllowed: []bool{true, false, false, false},
+			expectPinned:  "mirror.local",
+		},
+		"ignore pin of rejected mirror": {
+			pin:           "insecure.mirror.local",
+			expectAllowed: []bool{true, true, false, true},
+		},
+		"ignore pin of the image": {
+			pin:           "registry.local",
+			expectAllowed: []bool{true, true, false, true},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			sources := []mirrors.Source{
+				{Location: "mirror.local", Mirror: true, Allowed: true},
+				{Location: "next.mirror.local/org", Mirror: true, Allowed: true},
+				{Location: "insecure.mirror.local", Mirror: true, Reason: "insecure sources are not allowed"},
+				{Location: "registry.local", Allowed: true},
+			}
+
+			s := &runState{metrics: newRunMetrics()}
+			res := pinMirror(s, sources, tc.pin)
+
+			allowed := []bool{}
+			for i := range res {
+				allowed = append(allowed, res[i].Allowed)
+
+				if !res[i].Allowed && sources[i].Allowed {
+					assert.Equal(t, reasonPinned, res[i].Reason)
+				}
+			}
+
+			assert.Equal(t, tc.expectAllowed, allowed)
+			assert.Equal(t, tc.expectPinned, s.summary.PinnedMirror)
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package app
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/logger"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/probe"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/registrytls"
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+	"github.com/cri-o/crio-credential-provider/pkg/mirrors"
+)
+
+// reasonUnreachable is the reason of mirrors skipped by the probe.
+const reasonUnreachable = "mirror is unreachable"
+
+// probeMirrors probes the reachability of the allowed mirrors within the
+// budget of the probe and records the unreachable ones in the run summary. If
+// configured, unreachable mirrors do not receive credentials as long as any
+// mirror is reachable, which matches the fallback of the runtime to the next
+// source in the order of the registries.conf. Mirrors requiring mutual TLS
+// get the client certificates of their node files presented, because the
+// secrets are not retrieved yet.
+func probeMirrors(ctx context.Context, cfg *config.Config, s *runState, sources []mirrors.Source) []mirrors.Source {
+	s.phase = phaseProbe
+
+	defer s.metrics.observe(phaseProbe, time.Now())
+
+	if timeout := cfg.Sources.Probe.Timeout.Duration; timeout > 0 {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	clients, err := registrytls.New(cfg.RegistryTLS, nil)
+	if err != nil {
+		logger.Warnf("Unable to load registry client certificates: %v", err)
+	}
+
+	unreachable := probe.Unreachable(ctx, sources, cfg.Sources.Probe.TLS, clients.TLSConfig)
+	if len(unreachable) == 0 {
+		return sources
+	}
+
+	s.summary.UnreachableMirrors = slices.Sorted(maps.Keys(unreachable))
+
+	for _, location := range s.summary.UnreachableMirrors {
+		logger.Warnf("Mirror %s is unreachable: %v", location, unreachable[location])
+	}
+
+	if !cfg.Sources.Probe.SkipUnreachable {
+		return sources
+	}
+
+	if !slices.ContainsFunc(sources, func(source mirrors.Source) bool {
+		return source.Mirror && source.Allowed && unreachable[source.Location] == nil
+	}) {
+		logger.Warnf("All mirrors are unreachable, keeping their credentials")
+
+		return sources
+	}
+
+	res := slices.Clone(sources)
+
+	for i := range res {
+		if _, ok := unreachable[res[i].Location]; ok && res[i].Mirror && res[i].Allowed {
+			res[i].Allowed = false
+			res[i].Reason = reasonUnreachable
+		}
+	}
+
+	return res
+}
@@ -0,0 +1,76 @@
+package app
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+	"github.com/cri-o/crio-credential-provider/pkg/mirrors"
+)
+
+func TestProbeMirrors(t *testing.T) {
+	t.Parallel()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	require.NoError(t, closed.Close())
+
+	reachable, unreachable := l.Addr().String(), closed.Addr().String()
+
+	for name, tc := range map[string]struct {
+		skipUnreachable bool
+		mirrors         []string
+		expectAllowed   []bool
+	}{
+		"annotate only": {
+			mirrors:       []string{unreachable, reachable},
+			expectAllowed: []bool{true, true, true},
+		},
+		"skip unreachable": {
+			skipUnreachable: true,
+			mirrors:         []string{unreachable, reachable},
+			expectAllowed:   []bool{false, true, true},
+		},
+		"keep all unreachable": {
+			skipUnreachable: true,
+			mirrors:         []string{unreachable, unreachable + "/org"},
+			expectAllowed:   []bool{true, true, true},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := config.Default()
+			cfg.Sources.Probe.Enabled = true
+			cfg.Sources.Probe.SkipUnreachable = tc.skipUnreachable
+
+			sources := []mirrors.Source{}
+			for _, location := range tc.mirrors {
+				sources = append(sources, mirrors.Source{Location: location, Mirror: true, Allowed: true})
+			}
+
+			sources = append(sources, mirrors.Source{Location: "registry.local", Allowed: true})
+
+			s := &runState{metrics: newRunMetrics()}
+			res := probeMirrors(context.Background(), cfg, s, sources)
+
+			allowed := []bool{}
+			for i := range res {
+				allowed = append(allowed, res[i].Allowed)
+			}
+
+			assert.Equal(t, tc.expectAllowed, allowed)
+			assert.Contains(t, s.summary.UnreachableMirrors, unreachable)
+			assert.NotContains(t, s.summary.UnreachableMirrors, reachable)
+			assert.Contains(t, s.metrics.PhasesMs, phaseProbe)
+		})
+	}
+}
@@ -0,0 +1,319 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net/http"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/auth"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/claims"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/k8s"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/logger"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/registrytls"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/retention"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/state"
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+	"github.com/cri-o/crio-credential-provider/pkg/docker"
+	"github.com/cri-o/crio-credential-provider/pkg/mirrors"
+)
+
+// NewStamp returns the stamp for a write into the auth directory. It has to
+// be created before retrieving the secrets, which ensures that writes based
+// on outdated secrets do not overwrite more recent ones of other instances
+// sharing the auth directory.
+func NewStamp(cfg *config.Config) (auth.Stamp, error) {
+	// The audit mode does not write into the auth directory
+	if cfg.Audit.Enabled || respondsCredentials(cfg) {
+		return auth.Stamp{}, nil
+	}
+
+	stamp := auth.Stamp{
+		Publication: auth.Publication{
+			Versioned:      cfg.Publication.Versioned,
+			RetainPrevious: cfg.Publication.RetainPrevious.Duration,
+		},
+		Naming: cfg.Naming,
+		Merge:  cfg.Merge.Policy(),
+	}
+
+	if !cfg.Coordination.Enabled() {
+		return stamp, nil
+	}
+
+	stamp.Lock = auth.Lock{Mode: cfg.Coordination.Lock, LeaseTTL: cfg.Coordination.LeaseTTL.Duration}
+
+	fence, err := auth.NextFence(cfg.AuthDir, stamp.Lock)
+	if err != nil {
+		return auth.Stamp{}, fmt.Errorf("unable to get fencing token: %w", err)
+	}
+
+	stamp.Owner = cfg.Coordination.Owner
+	stamp.Fence = fence
+
+	return stamp, nil
+}
+
+// Provision writes the auth file for the namespace and image based on the
+// provided secrets and resolved pull sources. The kubernetes.io/tls secrets
+// contain the client certificates of the registries configured by
+// registryTLS. The written file gets recorded
+// in the state database to be able to track which secrets it is derived from
+// and which sources received credentials. Malformed secrets result in an
+// error if the strict mode is enabled. The returned path is empty in the
+// audit mode.
+func Provision(ctx context.Context, cfg *config.Config, stamp auth.Stamp, secrets, tlsSecrets *corev1.SecretList, namespace, image string, sources []mirrors.Source) (string, error) {
+	res, err := provision(ctx, cfg, stamp, secrets, tlsSecrets, namespace, image, sources, "")
+	if err != nil {
+		return "", err
+	}
+
+	return res.Path, nil
+}
+
+// RetrieveTLSSecrets returns the kubernetes.io/tls secrets containing the
+// client certificates of the registries, which are only required if the
+// token exchange is enabled.
+func RetrieveTLSSecrets(ctx context.Context, cfg *config.Config, client kubernetes.Interface) *corev1.SecretList {
+	refs := registrytls.SecretReferences(cfg.RegistryTLS)
+	if !cfg.TokenExchange.Enabled() || len(refs) == 0 {
+		return nil
+	}
+
+	return k8s.RetrieveTLSSecrets(ctx, client, refs)
+}
+
+// provision works like Provision but returns the full result of the write.
+// The audit mode only records the result without writing the auth file, which
+// results in an empty path. The service account token of the request gets
+// exchanged with the registries federating the identity if it has their
+// audience, otherwise tokens get requested by using the node identity.
+func provision(ctx context.Context, cfg *config.Config, stamp auth.Stamp, secrets, tlsSecrets *corev1.SecretList, namespace, image string, sources []mirrors.Source, token string) (*auth.Result, error) {
+	if cfg.Secrets.Strict {
+		if err := auth.CheckSecrets(secrets); err != nil {
+			return nil, fmt.Errorf("strict mode: %w", err)
+		}
+	}
+
+	if cfg.Audit.Enabled {
+		return audit(ctx, cfg, stamp, secrets, namespace, image, sources)
+	}
+
+	references := []string{}
+
+	for i := range sources {
+		if sources[i].Allowed {
+			references = append(references, sources[i].Reference)
+		}
+	}
+
+	stamp.Expires = retention.Expires(cfg.Retention.RegistryTTLs, references, stamp.Expires, time.Now())
+
+	integrityKey, err := auth.LoadOrCreateIntegrityKey(cfg.IntegrityKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get integrity key: %w", err)
+	}
+
+	fileNamespace := auth.FileNamespace(namespace, cfg.HashNamespaces, integrityKey)
+
+	resolution, err := auth.Resolve(ctx, secrets, cfg.KubeletAuthFilePath, image, sources, cfg.SecretMatching, cfg.Sources.ScopeMirrorAuths, cfg.Timeouts.CredentialSources.Duration)
+	if err != nil {
+		return nil, fmt.Errorf("unable to write auth file: %w", err)
+	}
+
+	if cfg.TokenExchange.Enabled() {
+		clients, err := registrytls.New(cfg.RegistryTLS, tlsSecrets)
+		if err != nil {
+			logger.Warnf("Unable to load registry client certificates: %v", err)
+		}
+
+		var expires time.Time
+
+		resolution.Contents, expires = exchangeTokens(ctx, cfg, clients, resolution.Contents, references)
+
+		var identityExpires time.Time
+
+		resolution.Contents, identityExpires = exchangeIdentityTokens(ctx, cfg, clients, resolution.Contents, namespace, stamp.Workload, token, sources)
+		if !identityExpires.IsZero() && (expires.IsZero() || identityExpires.Before(expires)) {
+			expires = identityExpires
+		}
+
+		// The auth file expires together with its first registry token
+		if !expires.IsZero() && (stamp.Expires.IsZero() || expires.Before(stamp.Expires)) {
+			stamp.Expires = expires
+		}
+	}
+
+	if err := preWrite(cfg, stamp, namespace, image, resolution); err != nil {
+		return nil, err
+	}
+
+	res, err := auth.WriteResolution(ctx, cfg.AuthDir, fileNamespace, image, resolution, cfg.AuthFormat, integrityKey, stamp)
+	if err != nil {
+		return nil, fmt.Errorf("unable to write auth file: %w", err)
+	}
+
+	if res.Fenced {
+		// The more recent write already recorded the file
+		return res, nil
+	}
+
+	postWrite(cfg, stamp, namespace, image, res)
+
+	writeOutputs(cfg, fileNamespace, image, res.Contents, integrityKey, stamp)
+
+	if err := state.Update(cfg.StateFile, func(s *state.State) error {
+		s.Files[res.Path] = &state.File{
+			Namespace: namespace,
+			Image:     image,
+			Secrets:   res.Secrets,
+			Sources:   sources,
+			Updated:   time.Now(),
+			Owner:     stamp.Owner,
+			Fence:     stamp.Fence,
+			Workload:  stamp.Workload,
+			Expires:   stamp.Expires,
+		}
+
+		return nil
+	}); err != nil {
+		// The auth file is usable without the state, which means we do not
+		// want to fail the whole run.
+		logger.Warnf("Unable to record auth file %s in state: %v", res.Path, err)
+	}
+
+	return res, nil
+}
+
+// respondsCredentials returns true if the credentials get returned to the
+// kubelet instead of writing the auth file. The audit mode never hands out
+// any credentials.
+func respondsCredentials(cfg *config.Config) bool {
+	return cfg.ResponseMode == config.ResponseModeCredentials && !cfg.Audit.Enabled
+}
+
+// resolveCredentials resolves the credentials of the request without writing
+// the auth file, which results in an empty path.
+func resolveCredentials(ctx context.Context, cfg *config.Config, secrets *corev1.SecretList, image string, sources []mirrors.Source) (*auth.Result, error) {
+	if cfg.Secrets.Strict {
+		if err := auth.CheckSecrets(secrets); err != nil {
+			return nil, fmt.Errorf("strict mode: %w", err)
+		}
+	}
+
+	resolution, err := auth.Resolve(ctx, secrets, cfg.KubeletAuthFilePath, image, sources, cfg.SecretMatching, cfg.Sources.ScopeMirrorAuths, cfg.Timeouts.CredentialSources.Duration)
+	if err != nil {
+		return nil, fmt.Errorf("unable to resolve credentials: %w", err)
+	}
+
+	return &auth.Result{Secrets: resolution.Secrets, Skipped: resolution.Skipped, Contents: resolution.Contents}, nil
+}
+
+// exchangeTokens exchanges the credentials of the configured registries for
+// registry tokens by using the TLS clients of the registries, see
+// auth.ExchangeTokens.
+func exchangeTokens(ctx context.Context, cfg *config.Config, clients *registrytls.Clients, contents docker.ConfigJSON, references []string) (docker.ConfigJSON, time.Time) {
+	ctx, cancel := credentialSourceContext(ctx, cfg)
+	defer cancel()
+
+	return auth.ExchangeTokens(ctx, clients.HTTPClient, contents, cfg.TokenExchange.Registries, references, time.Now())
+}
+
+// exchangeIdentityTokens exchanges a service account token of the workload
+// with the registries federating the identity for registry tokens, which
+// replace the credentials of the secrets for the allowed sources matching
+// the configured audiences. Failing exchanges keep the credentials of the
+// secrets. It returns the earliest expiry of the exchanged tokens.
+func exchangeIdentityTokens(ctx context.Context, cfg *config.Config, clients *registrytls.Clients, contents docker.ConfigJSON, namespace string, workload k8s.Workload, token string, sources []mirrors.Source) (docker.ConfigJSON, time.Time) {
+	res := docker.ConfigJSON{Auths: maps.Clone(contents.Auths)}
+	if res.Auths == nil {
+		res.Auths = map[string]docker.AuthConfig{}
+	}
+
+	var expires time.Time
+
+	for i := range cfg.TokenExchange.Audiences {
+		audience := &cfg.TokenExchange.Audiences[i]
+
+		for j := range sources {
+			source := &sources[j]
+			if !source.Allowed || !claims.Match(audience.Registry, source.Location) {
+				continue
+			}
+
+			ctx, cancel := credentialSourceContext(ctx, cfg)
+			registryToken, lifetime, err := exchangeIdentityToken(ctx, cfg, clients.HTTPClient(source.Location), audience, namespace, workload, token, source)
+
+			cancel()
+
+			if err != nil {
+				logger.Warnf("Unable to exchange the service account token with %s: %v", source.Location, err)
+
+				continue
+			}
+
+			res.Auths[source.Location] = docker.AuthConfig{RegistryToken: registryToken}
+
+			if candidate := time.Now().Add(lifetime); expires.IsZero() || candidate.Before(expires) {
+				expires = candidate
+			}
+
+			logger.Infof("Exchanged the service account token with %s for a registry token valid for %s", source.Location, lifetime)
+		}
+	}
+
+	return res, expires
+}
+
+// credentialSourceContext bounds ctx by the timeout of a single credential
+// source, where a non positive timeout disables the deadline.
+func credentialSourceContext(ctx context.Context, cfg *config.Config) (context.Context, context.CancelFunc) {
+	if cfg.Timeouts.CredentialSources.Duration <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, cfg.Timeouts.CredentialSources.Duration)
+}
+
+// hasRegistryTokens returns true if any auth entry of the contents is a
+// registry token.
+func hasRegistryTokens(contents docker.ConfigJSON) bool {
+	for _, entry := range contents.Auths {
+		if entry.RegistryToken != "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+func exchangeIdentityToken(ctx context.Context, cfg *config.Config, client *http.Client, audience *config.TokenAudience, namespace string, workload k8s.Workload, token string, source *mirrors.Source) (string, time.Duration, error) {
+	audienceToken, err := k8s.AudienceToken(ctx, token, audience.Audience, namespace, workload, cfg.TokenExchange.Kubeconfig, k8s.NewClusterClient)
+	if err != nil {
+		return "", 0, fmt.Errorf("get service account token for audience %q: %w", audience.Audience, err)
+	}
+
+	return auth.ExchangeIdentityToken(ctx, client, source.Location, audience.Username, audienceToken, []string{source.Reference})
+}
+
+// writeOutputs writes the auth file contents to the additional auth
+// directories. Failures only get logged, because the auth file of the runtime
+// got written.
+func writeOutputs(cfg *config.Config, fileNamespace, image string, contents docker.ConfigJSON, integrityKey []byte, stamp auth.Stamp) {
+	if len(cfg.Outputs) == 0 {
+		return
+	}
+
+	outputs, err := auth.NewOutputs(cfg)
+	if err == nil {
+		err = auth.WriteOutputs(outputs, fileNamespace, image, contents, integrityKey, stamp)
+	}
+
+	if err != nil {
+		logger.Warnf("Unable to write auth file outputs: %v", err)
+	}
+}
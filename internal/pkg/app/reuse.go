@@ -0,0 +1,70 @@
+package app
+
+import (
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/logger"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/state"
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+)
+
+// reuseDuration returns the duration for which the auth file of the image
+// can be reused, which depends on whether it is referenced by digest.
+func reuseDuration(cfg *config.Config, image string) time.Duration {
+	// A digest cannot be part of the registry host, which allows skipping
+	// the parsing of IPv6 literal hosts
+	if strings.Contains(image, "@") {
+		return cfg.Reuse.Digest.Duration
+	}
+
+	return cfg.Reuse.Tag.Duration
+}
+
+// reusableAuthFile returns the auth file previously written for the namespace
+// and image, if it got written within the reuse duration, did not expire and
+// still exists. Errors get logged and result in writing the auth file again.
+func reusableAuthFile(cfg *config.Config, namespace, image string) (string, *state.File, bool) {
+	ttl := reuseDuration(cfg, image)
+	if ttl <= 0 {
+		return "", nil, false
+	}
+
+	return recordedAuthFile(cfg, namespace, image, ttl)
+}
+
+// recordedAuthFile returns the auth file previously written for the namespace
+// and image, if it got written within maxAge, did not expire and still
+// exists. A zero maxAge accepts auth files of any age.
+func recordedAuthFile(cfg *config.Config, namespace, image string, maxAge time.Duration) (string, *state.File, bool) {
+	s, err := state.Load(cfg.StateFile)
+	if err != nil {
+		logger.Warnf("Unable to look up the recorded auth file: %v", err)
+
+		return "", nil, false
+	}
+
+	path, file, ok := s.FileOf(namespace, image)
+	if !ok {
+		return "", nil, false
+	}
+
+	now := time.Now()
+	if (maxAge > 0 && now.Sub(file.Updated) >= maxAge) || (!file.Expires.IsZero() && !now.Before(file.Expires)) {
+		return "", nil, false
+	}
+
+	// Auth files written before switching the naming are not found by CRI-O
+	if !cfg.Naming.Matches(path) {
+		return "", nil, false
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		logger.Warnf("Unable to reuse auth file %s: %v", path, err)
+
+		return "", nil, false
+	}
+
+	return path, file, true
+}
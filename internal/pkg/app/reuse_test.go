@@ -0,0 +1,99 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	cpv1 "k8s.io/kubelet/pkg/apis/credentialprovider/v1"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/state"
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+)
+
+func TestReuseDuration(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.Default()
+	cfg.Reuse.Digest.Duration = time.Hour
+	cfg.Reuse.Tag.Duration = time.Minute
+
+	assert.Equal(t, time.Hour, reuseDuration(cfg, "quay.io/org/app@sha256:"+string(bytes.Repeat([]byte("a"), 64))))
+	assert.Equal(t, time.Minute, reuseDuration(cfg, "quay.io/org/app:latest"))
+	assert.Equal(t, time.Minute, reuseDuration(cfg, "[fd00::1]:5000/org/app"))
+}
+
+func TestRunReuse(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	cfg := config.Default()
+	cfg.RegistriesConfPath = filepath.Join(dir, "registries.conf")
+	cfg.AuthDir = dir
+	cfg.KubeletAuthFilePath = filepath.Join(dir, "kubelet-auth.json")
+	cfg.DiagnosticsDir = filepath.Join(dir, "diagnostics")
+	cfg.IntegrityKeyPath = filepath.Join(dir, "integrity.key")
+	cfg.StateFile = filepath.Join(dir, "state.json")
+	cfg.Sources.PolicyPath = filepath.Join(dir, "policy.json")
+	cfg.Reuse.Digest.Duration = time.Hour
+
+	require.NoError(t, os.WriteFile(cfg.RegistriesConfPath, []byte(testRegistryConfig), 0o600))
+
+	digestImage := image + "@sha256:" + string(bytes.Repeat([]byte("a"), 64))
+
+	request := func(image string) *bytes.Buffer {
+		raw, err := json.Marshal(&cpv1.CredentialProviderRequest{
+			Image:               image,
+			ServiceAccountToken: prepareToken(t, jwt.MapClaims{k8sClaimKey: map[string]any{"namespace": namespace}}),
+		})
+		require.NoError(t, err)
+
+		return bytes.NewBuffer(raw)
+	}
+
+	clientFunc := func(string) (kubernetes.Interface, error) {
+		return fake.NewClientset(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "secret", Namespace: namespace},
+			Type:       corev1.SecretTypeDockerConfigJson,
+			Data:       map[string][]byte{corev1.DockerConfigJsonKey: testSecretData},
+		}), nil
+	}
+
+	failingClientFunc := func(string) (kubernetes.Interface, error) {
+		return nil, errors.New("must not be called")
+	}
+
+	for _, image := range []string{digestImage, image} {
+		require.NoError(t, Run(request(image), cfg, clientFunc))
+	}
+
+	// The digest reference reuses its auth file without retrieving the secrets
+	require.NoError(t, Run(request(digestImage), cfg, failingClientFunc))
+
+	// The tag reference has no reuse duration configured
+	require.Error(t, Run(request(image), cfg, failingClientFunc))
+
+	// Auth files written before the reuse duration get written again
+	require.NoError(t, state.Update(cfg.StateFile, func(s *state.State) error {
+		_, file, ok := s.FileOf(namespace, digestImage)
+		require.True(t, ok)
+
+		file.Updated = time.Now().Add(-time.Hour)
+
+		return nil
+	}))
+
+	require.Error(t, Run(request(digestImage), cfg, failingClientFunc))
+}
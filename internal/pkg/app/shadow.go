@@ -0,0 +1,121 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/auth"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/errcode"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/k8s"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/logger"
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+	"github.com/cri-o/crio-credential-provider/pkg/mirrors"
+)
+
+// shadow logs the divergences from the kubelet secrets flow and returns
+// their number. Failing comparisons only get logged, because they must not
+// affect the run.
+func shadow(ctx context.Context, cfg *config.Config, clientFunc k8s.ClientFunc, token string, identity *k8s.Identity, secrets *corev1.SecretList, image string, sources []mirrors.Source) int {
+	// The standalone mode has no pods to compare against
+	if cfg.StaticSecretsDir != "" {
+		return 0
+	}
+
+	divergences, err := shadowCompare(ctx, cfg, clientFunc, token, identity.Namespace, identity.Workload, secrets, image, sources)
+	if err != nil {
+		logger.Warnf("Shadow mode: unable to compare against the kubelet secrets flow: %v", err)
+
+		return 0
+	}
+
+	for _, divergence := range divergences {
+		logger.Warnf("Shadow mode: %s", divergence)
+	}
+
+	if len(divergences) == 0 {
+		logger.Infof("Shadow mode: credentials of %q match the kubelet secrets flow", image)
+	}
+
+	return len(divergences)
+}
+
+var errNoPod = errcode.New(errcode.NoPod, "service account token is not bound to a pod")
+
+// shadowCompare compares the credentials of the provider against the ones
+// the kubelet resolves from the imagePullSecrets of the pod. The kubelet only
+// matches the secrets against the primary registry of the image, while the
+// provider considers all secrets of the namespace for all pull sources. The
+// global auth file gets ignored on both sides. It returns the divergences in
+// a human readable form, which never contains any credentials.
+func shadowCompare(ctx context.Context, cfg *config.Config, clientFunc k8s.ClientFunc, token, namespace string, workload k8s.Workload, secrets *corev1.SecretList, image string, sources []mirrors.Source) ([]string, error) {
+	if workload.Pod == "" {
+		return nil, errNoPod
+	}
+
+	client, err := clientFunc(token)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to Kubernetes API: %w", err)
+	}
+
+	names, err := k8s.RetrieveImagePullSecrets(ctx, client, namespace, workload)
+	if err != nil {
+		return nil, err
+	}
+
+	divergences := []string{}
+	legacySecrets := &corev1.SecretList{}
+
+	for _, name := range names {
+		i := slices.IndexFunc(secrets.Items, func(secret corev1.Secret) bool {
+			return secret.Name == name
+		})
+		if i == -1 {
+			divergences = append(divergences, fmt.Sprintf("imagePullSecret %q of the pod is not available to the provider", name))
+
+			continue
+		}
+
+		legacySecrets.Items = append(legacySecrets.Items, secrets.Items[i])
+	}
+
+	// The kubelet pulls from the primary registry regardless of the policies
+	primary := []mirrors.Source{}
+
+	for _, source := range sources {
+		if !source.Mirror {
+			source.Allowed = true
+			primary = append(primary, source)
+		}
+	}
+
+	legacy, err := auth.Resolve(ctx, legacySecrets, "", image, primary, cfg.SecretMatching, false, 0)
+	if err != nil {
+		return nil, fmt.Errorf("unable to resolve kubelet credentials: %w", err)
+	}
+
+	provider, err := auth.Resolve(ctx, secrets, "", image, sources, cfg.SecretMatching, cfg.Sources.ScopeMirrorAuths, 0)
+	if err != nil {
+		return nil, fmt.Errorf("unable to resolve provider credentials: %w", err)
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(legacy.Contents.Auths)) {
+		switch entry, ok := provider.Contents.Auths[key]; {
+		case !ok:
+			divergences = append(divergences, fmt.Sprintf("%s only gets credentials by the kubelet", key))
+		case entry != legacy.Contents.Auths[key]:
+			divergences = append(divergences, fmt.Sprintf("%s gets different credentials by the kubelet", key))
+		}
+	}
+
+	for _, name := range provider.Secrets {
+		if !slices.Contains(names, name) {
+			divergences = append(divergences, fmt.Sprintf("secret %q is not an imagePullSecret of the pod", name))
+		}
+	}
+
+	return divergences, nil
+}
@@ -0,0 +1,86 @@
+package app
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/k8s"
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+	"github.com/cri-o/crio-credential-provider/pkg/mirrors"
+)
+
+func TestShadowCompare(t *testing.T) {
+	t.Parallel()
+
+	secret := func(name, registry string) corev1.Secret {
+		return corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Type:       corev1.SecretTypeDockerConfigJson,
+			Data: map[string][]byte{
+				corev1.DockerConfigJsonKey: []byte(`{"auths":{"` + registry + `":{"auth":"` + usernamePasswordBase64 + `"}}}`),
+			},
+		}
+	}
+
+	secrets := &corev1.SecretList{Items: []corev1.Secret{secret("registry", registry), secret("mirror", mirror)}}
+
+	sources := func(primaryAllowed bool) []mirrors.Source {
+		return []mirrors.Source{
+			{Reference: mirror + "/library/image", Location: mirror, Mirror: true, Allowed: true},
+			{Reference: image, Location: registry, Allowed: primaryAllowed},
+		}
+	}
+
+	for name, tc := range map[string]struct {
+		pullSecrets []string
+		sources     []mirrors.Source
+		expected    []string
+	}{
+		"matching": {
+			pullSecrets: []string{"registry", "mirror"},
+			sources:     sources(true),
+			expected:    []string{},
+		},
+		"secret not referenced by the pod": {
+			pullSecrets: []string{"registry"},
+			sources:     sources(true),
+			expected:    []string{`secret "mirror" is not an imagePullSecret of the pod`},
+		},
+		"unavailable imagePullSecret": {
+			pullSecrets: []string{"registry", "mirror", "missing"},
+			sources:     sources(true),
+			expected:    []string{`imagePullSecret "missing" of the pod is not available to the provider`},
+		},
+		"primary registry not allowed": {
+			pullSecrets: []string{"registry", "mirror"},
+			sources:     sources(false),
+			expected:    []string{registry + " only gets credentials by the kubelet"},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: namespace}}
+			for _, name := range tc.pullSecrets {
+				pod.Spec.ImagePullSecrets = append(pod.Spec.ImagePullSecrets, corev1.LocalObjectReference{Name: name})
+			}
+
+			clientFunc := func(string) (kubernetes.Interface, error) {
+				return fake.NewClientset(pod), nil
+			}
+
+			divergences, err := shadowCompare(t.Context(), config.Default(), clientFunc, "", namespace, k8s.Workload{Pod: "pod"}, secrets, image, tc.sources)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, divergences)
+		})
+	}
+
+	_, err := shadowCompare(t.Context(), config.Default(), nil, "", namespace, k8s.Workload{}, secrets, image, sources(true))
+	require.ErrorIs(t, err, errNoPod)
+}
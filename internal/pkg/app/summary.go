@@ -0,0 +1,167 @@
+package app
+
+import (
+	"errors"
+	"time"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/auth"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/errcode"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/logger"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/policy"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/webhook"
+	cpAuth "github.com/cri-o/crio-credential-provider/pkg/auth"
+)
+
+const (
+	// outcomeProvisioned is the outcome of runs writing an auth file with, or
+	// responding with, credentials of at least one secret.
+	outcomeProvisioned = "provisioned"
+
+	// outcomeNoCredentials is the outcome of runs without credentials of any
+	// secret, which usually results in unauthenticated pulls from the
+	// mirrors.
+	outcomeNoCredentials = "noCredentials"
+
+	// outcomeSkipped is the outcome of runs without anything to do, for
+	// example if the image has no allowed mirrors.
+	outcomeSkipped = "skipped"
+
+	// outcomeShed is the outcome of runs shed by the admission gate without
+	// a previously written auth file.
+	outcomeShed = "shed"
+
+	// outcomeDenied is the outcome of runs denied by a registry credential
+	// policy or the pre-write webhook.
+	outcomeDenied = "denied"
+
+	// outcomeFailed is the outcome of failed runs.
+	outcomeFailed = "failed"
+)
+
+// runSummary is the structured record logged on completion of every run,
+// which allows alerting on images resolved with zero credentials.
+type runSummary struct {
+	// Namespace is the namespace of the request, empty if it did not get
+	// extracted.
+	Namespace string `json:"namespace,omitempty"`
+
+	// Image is the requested image.
+	Image string `json:"image,omitempty"`
+
+	// Mirrors is the number of mirrors permitted to receive credentials.
+	Mirrors int `json:"mirrors"`
+
+	// PinnedMirror is the mirror the credentials got pinned to by the service
+	// account annotation.
+	PinnedMirror string `json:"pinnedMirror,omitempty"`
+
+	// UnreachableMirrors are the locations of the mirrors which did not pass
+	// the reachability probe.
+	UnreachableMirrors []string `json:"unreachableMirrors,omitempty"`
+
+	// SecretsConsidered is the number of secrets used for the auth file.
+	SecretsConsidered int `json:"secretsConsidered"`
+
+	// SecretsMatched is the number of secrets which contributed credentials.
+	SecretsMatched int `json:"secretsMatched"`
+
+	// SecretsSkipped are the numbers of secrets which did not contribute any
+	// credentials by their skip reason.
+	SecretsSkipped map[string]int `json:"secretsSkipped,omitempty"`
+
+	// AuthFile is the path of the written auth file.
+	AuthFile string `json:"authFile,omitempty"`
+
+	// AuthFileSHA256 is the content hash of the auth file as recorded in its
+	// sidecar, which allows correlating the run with the pull of the runtime.
+	AuthFileSHA256 string `json:"authFileSHA256,omitempty"`
+
+	// Expires is the time after which the auth file gets evicted, if set.
+	Expires time.Time `json:"expires,omitzero"`
+
+	// NegativeCached is true if the secrets did not get retrieved, because a
+	// recent request did not find any credentials.
+	NegativeCached bool `json:"negativeCached,omitempty"`
+
+	// Reused is true if the secrets did not get retrieved, because the auth
+	// file written by a recent request got reused.
+	Reused bool `json:"reused,omitempty"`
+
+	// Shed is true if the secrets did not get retrieved, because too many
+	// runs were in flight.
+	Shed bool `json:"shed,omitempty"`
+
+	// Audited is true if the run only recorded the credentials in the audit
+	// file without writing the auth file.
+	Audited bool `json:"audited,omitempty"`
+
+	// Responded is true if the credentials got returned to the kubelet
+	// instead of writing the auth file.
+	Responded bool `json:"responded,omitempty"`
+
+	// Divergences is the number of divergences from the kubelet secrets flow
+	// found by the shadow mode.
+	Divergences int `json:"divergences,omitempty"`
+
+	// DurationMs is the duration of the whole run in milliseconds.
+	DurationMs float64 `json:"durationMs"`
+
+	// Outcome is the result of the run, see the outcome* constants.
+	Outcome string `json:"outcome"`
+
+	// Error is the error of a failed run.
+	Error string `json:"error,omitempty"`
+
+	// ErrorCode is the stable code of the error, if any.
+	ErrorCode errcode.Code `json:"errorCode,omitempty"`
+}
+
+// finish completes the summary after the run.
+func (r *runSummary) finish(start time.Time, err error) {
+	r.DurationMs = milliseconds(time.Since(start))
+	r.ErrorCode = errcode.Of(err)
+
+	switch {
+	case errors.Is(err, auth.ErrNoAuths):
+		r.Outcome = outcomeNoCredentials
+		r.Error = err.Error()
+
+	case errors.Is(err, policy.ErrNotAuthorized), errors.Is(err, webhook.ErrDenied):
+		r.Outcome = outcomeDenied
+		r.Error = err.Error()
+
+	case err != nil:
+		r.Outcome = outcomeFailed
+		r.Error = err.Error()
+
+	case r.NegativeCached:
+		r.Outcome = outcomeNoCredentials
+
+	case r.Shed && r.AuthFile == "":
+		r.Outcome = outcomeShed
+
+	case r.AuthFile == "" && !r.Audited && !r.Responded:
+		r.Outcome = outcomeSkipped
+
+	case r.SecretsMatched == 0:
+		r.Outcome = outcomeNoCredentials
+
+	default:
+		r.Outcome = outcomeProvisioned
+	}
+}
+
+// sidecar records the content hash and expiry of the auth file at path from
+// its sidecar file, if readable.
+func (r *runSummary) sidecar(path string) {
+	if sidecar, err := cpAuth.ReadSidecar(path); err == nil {
+		r.AuthFileSHA256 = sidecar.SHA256
+		r.Expires = sidecar.Expires
+	}
+}
+
+// log writes the summary as a single structured log record, which carries
+// the outcome and the whole summary as attributes.
+func (r *runSummary) log() {
+	logger.Logger().Info("Run summary", "outcome", r.Outcome, "summary", r)
+}
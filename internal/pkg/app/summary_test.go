@@ -0,0 +1,86 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/auth"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/errcode"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/policy"
+)
+
+func TestRunSummary(t *testing.T) {
+	t.Parallel()
+
+	for name, tc := range map[string]struct {
+		summary         runSummary
+		err             error
+		expectedOutcome string
+		expectedCode    errcode.Code
+	}{
+		"provisioned": {
+			summary:         runSummary{AuthFile: "/auth/file.json", SecretsConsidered: 2, SecretsMatched: 1},
+			expectedOutcome: outcomeProvisioned,
+		},
+		"responded": {
+			summary:         runSummary{Responded: true, SecretsConsidered: 2, SecretsMatched: 1},
+			expectedOutcome: outcomeProvisioned,
+		},
+		"no credentials": {
+			summary:         runSummary{AuthFile: "/auth/file.json", SecretsConsidered: 2},
+			expectedOutcome: outcomeNoCredentials,
+		},
+		"skipped": {
+			summary:         runSummary{Image: "quay.io/org/app"},
+			expectedOutcome: outcomeSkipped,
+		},
+		"no credentials without auth file": {
+			summary:         runSummary{SecretsConsidered: 2},
+			err:             fmt.Errorf("write: %w", auth.ErrNoAuths),
+			expectedOutcome: outcomeNoCredentials,
+			expectedCode:    errcode.NoAuths,
+		},
+		"no credentials cached": {
+			summary:         runSummary{NegativeCached: true},
+			expectedOutcome: outcomeNoCredentials,
+		},
+		"shed": {
+			summary:         runSummary{Shed: true},
+			expectedOutcome: outcomeShed,
+		},
+		"shed with auth file": {
+			summary:         runSummary{Shed: true, AuthFile: "/auth/file.json", SecretsMatched: 1},
+			expectedOutcome: outcomeProvisioned,
+		},
+		"denied": {
+			err:             fmt.Errorf("unable to provide credentials: %w", policy.ErrNotAuthorized),
+			expectedOutcome: outcomeDenied,
+			expectedCode:    errcode.NotAuthorized,
+		},
+		"failed": {
+			summary:         runSummary{AuthFile: "/auth/file.json", SecretsMatched: 1},
+			err:             errors.New("test"),
+			expectedOutcome: outcomeFailed,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			tc.summary.finish(time.Now().Add(-time.Second), tc.err)
+
+			assert.Equal(t, tc.expectedOutcome, tc.summary.Outcome)
+			assert.Equal(t, tc.expectedCode, tc.summary.ErrorCode)
+			assert.GreaterOrEqual(t, tc.summary.DurationMs, 1000.0)
+
+			if tc.err != nil {
+				assert.Equal(t, tc.err.Error(), tc.summary.Error)
+			} else {
+				assert.Empty(t, tc.summary.Error)
+			}
+		})
+	}
+}
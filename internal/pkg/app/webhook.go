@@ -0,0 +1,72 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/auth"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/logger"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/webhook"
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+	"github.com/cri-o/crio-credential-provider/pkg/docker"
+)
+
+// preWrite calls the pre-write webhook, which can deny writing the auth file
+// of the resolution. Failing calls deny the write as well, unless the failure
+// policy ignores them.
+func preWrite(cfg *config.Config, stamp auth.Stamp, namespace, image string, resolution *auth.Resolution) error {
+	hook := &cfg.Webhooks.PreWrite
+	if !hook.Enabled() || len(resolution.Contents.Auths) == 0 {
+		return nil
+	}
+
+	err := webhook.Call(context.Background(), hook, payload(webhook.PhasePreWrite, stamp, namespace, image, resolution.Contents, resolution.Secrets, ""))
+
+	switch {
+	case err == nil:
+		return nil
+
+	case errors.Is(err, webhook.ErrDenied):
+		return fmt.Errorf("unable to write auth file for %q: %w", image, err)
+
+	case hook.FailurePolicy == config.WebhookFailurePolicyIgnore:
+		logger.Warnf("Ignoring failed pre-write webhook: %v", err)
+
+		return nil
+
+	default:
+		return fmt.Errorf("unable to call pre-write webhook: %w", err)
+	}
+}
+
+// postWrite calls the post-write webhook for the written auth file. Failing
+// calls only get logged, because the auth file is already written.
+func postWrite(cfg *config.Config, stamp auth.Stamp, namespace, image string, res *auth.Result) {
+	hook := &cfg.Webhooks.PostWrite
+	if !hook.Enabled() {
+		return
+	}
+
+	if err := webhook.Call(context.Background(), hook, payload(webhook.PhasePostWrite, stamp, namespace, image, res.Contents, res.Secrets, res.Path)); err != nil {
+		logger.Warnf("Unable to call post-write webhook: %v", err)
+	}
+}
+
+// payload returns the webhook payload of an auth file, which only contains
+// the registry keys of the contents.
+func payload(phase string, stamp auth.Stamp, namespace, image string, contents docker.ConfigJSON, secrets []string, path string) *webhook.Payload {
+	return &webhook.Payload{
+		Phase:      phase,
+		Time:       time.Now().UTC(),
+		Namespace:  namespace,
+		Image:      image,
+		Workload:   stamp.Workload,
+		Registries: slices.Sorted(maps.Keys(contents.Auths)),
+		Secrets:    secrets,
+		AuthFile:   path,
+	}
+}
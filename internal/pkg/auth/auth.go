@@ -2,52 +2,240 @@
 package auth
 
 import (
+	"context"
+	"crypto/rand"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"maps"
 	"os"
+	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
 
-	"github.com/cri-o/crio-credential-provider/internal/pkg/docker"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/errcode"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/events"
 	"github.com/cri-o/crio-credential-provider/internal/pkg/logger"
 	"github.com/cri-o/crio-credential-provider/pkg/auth"
+	"github.com/cri-o/crio-credential-provider/pkg/docker"
+	"github.com/cri-o/crio-credential-provider/pkg/mirrors"
+)
+
+// ErrNoAuths is returned if neither the secrets nor the global auth file
+// provide any auth for the image.
+var ErrNoAuths = errcode.New(errcode.NoAuths, "no auths found in file contents")
+
+// ErrMalformedSecret is returned by CheckSecrets if a secret is not parsable.
+// The returned errors carry the code of the specific condition.
+var ErrMalformedSecret = errcode.New(errcode.MalformedSecret, "malformed secret")
+
+const (
+	// SkipReasonWrongType is the skip reason of secrets which are not of type
+	// kubernetes.io/dockerconfigjson.
+	SkipReasonWrongType = "wrongType"
+
+	// SkipReasonMissingKey is the skip reason of secrets without the
+	// .dockerconfigjson data key.
+	SkipReasonMissingKey = "missingKey"
+
+	// SkipReasonBadJSON is the skip reason of secrets whose docker config
+	// JSON is not parsable.
+	SkipReasonBadJSON = "badJSON"
+
+	// SkipReasonBadBase64 is the skip reason of secrets containing auth
+	// entries which cannot be decoded.
+	SkipReasonBadBase64 = "badBase64"
+
+	// SkipReasonNoMatch is the skip reason of valid secrets without any auth
+	// entry matching the image or its mirrors.
+	SkipReasonNoMatch = "noMatch"
+
+	// SkipReasonOversized is the skip reason of secrets exceeding the maximum
+	// secret size, which get skipped before creating the auth file.
+	SkipReasonOversized = "oversized"
 )
 
 var (
-	errNoAuths        = errors.New("no auths found in file contents")
 	errNamespaceEmpty = errors.New("namespace is empty")
 	errSecretsNil     = errors.New("secrets is nil")
+
+	errWrongSecretType = ErrMalformedSecret.Sub(errcode.WrongSecretType, "secret is not a docker config JSON secret")
+	errMissingDataKey  = ErrMalformedSecret.Sub(errcode.MissingSecretKey, "secret does not contain data key")
+	errUnparsable      = ErrMalformedSecret.Sub(errcode.UnparsableSecret, "docker config JSON is not parsable")
+	errInvalidAuth     = ErrMalformedSecret.Sub(errcode.InvalidAuth, "invalid base64 auth")
 )
 
-// CreateAuthFile can be used to create a auth file to /etc/crio/auth which follows the convention for CRI-O consumption.
-func CreateAuthFile(secrets *corev1.SecretList, globalAuthFilePath, authDir, namespace, image string, mirrors []string) (string, error) {
-	if namespace == "" {
-		return "", errNamespaceEmpty
-	}
+// Result contains the information about a written auth file.
+type Result struct {
+	// Path is the path to the written auth file.
+	Path string
+
+	// Secrets are the names of the secrets which contributed auth entries.
+	Secrets []string
+
+	// Skipped are the numbers of the secrets which did not contribute any
+	// auth entry by their skip reason, see the SkipReason* constants.
+	Skipped map[string]int
+
+	// Fenced is true if the auth file did not get written, because another
+	// instance already wrote it with a more recent fencing token.
+	Fenced bool
+
+	// Contents are the written auth file contents.
+	Contents docker.ConfigJSON
+}
+
+// Resolution is the result of matching the secrets against an image and its
+// pull sources.
+type Resolution struct {
+	// Contents are the auth file contents, including the global auths.
+	Contents docker.ConfigJSON
+
+	// Secrets are the names of the secrets which contributed auth entries.
+	Secrets []string
+
+	// Skipped are the numbers of the secrets which did not contribute any
+	// auth entry by their skip reason, see the SkipReason* constants.
+	Skipped map[string]int
+}
 
+// Resolve matches the secrets against the image and its pull sources without
+// writing anything, see CreateAuthFile for the parameters.
+func Resolve(ctx context.Context, secrets *corev1.SecretList, globalAuthFilePath, image string, sources []mirrors.Source, matching string, scopeMirrors bool, credHelperTimeout time.Duration) (*Resolution, error) {
 	if secrets == nil {
-		return "", errSecretsNil
+		return nil, errSecretsNil
 	}
 
 	globalAuthContents, err := readGlobalAuthFile(globalAuthFilePath)
 	if err != nil {
-		return "", fmt.Errorf("unable to read global auth file: %w", err)
+		return nil, fmt.Errorf("unable to read global auth file: %w", err)
 	}
 
-	authfileContents := updateAuthContents(secrets, globalAuthContents, image, mirrors)
+	authfileContents := inlineCredHelpers(ctx, globalAuthContents, sources, credHelperTimeout)
+	usedSecrets := []string{}
+
+	// Unqualified images get matched per qualified candidate, while earlier
+	// candidates of the search order take precedence by being merged last
+	for _, candidate := range slices.Backward(mirrors.Candidates(sources, image)) {
+		m, err := newMatcher(matching, candidate)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create secret matcher: %w", err)
+		}
+
+		if scopeMirrors {
+			m = &scopedMatcher{matcher: m}
+		}
+
+		candidateSources := mirrors.CandidateSources(sources, candidate)
+
+		var used []string
+
+		authfileContents, used = updateAuthContents(secrets, authfileContents, m, mirrors.Mirrors(candidateSources), mirrors.PrimaryAllowed(candidateSources))
+
+		for _, name := range used {
+			if !slices.Contains(usedSecrets, name) {
+				usedSecrets = append(usedSecrets, name)
+			}
+		}
+	}
+
+	return &Resolution{Contents: authfileContents, Secrets: usedSecrets, Skipped: skippedSecrets(secrets, usedSecrets)}, nil
+}
+
+// CreateAuthFile can be used to create a auth file to /etc/crio/auth which follows the convention for CRI-O consumption.
+// The matching mode selects how the registry entries of the secrets get matched,
+// see the config.SecretMatching* constants, while the format selects the
+// output format, see the config.AuthFormat* constants. The integrityKey is used
+// to sign the auth file contents within its sidecar file. Only the allowed
+// pull sources receive credentials from the secrets. If scopeMirrors is true,
+// the auth entries of mirrors get scoped to the path of the mirror location.
+// The credential helpers of the global auth file are bounded by the
+// credHelperTimeout. A non zero stamp serializes the write with other instances sharing the auth
+// directory. The write gets abandoned if ctx is done before replacing the
+// auth file.
+func CreateAuthFile(ctx context.Context, secrets *corev1.SecretList, globalAuthFilePath, authDir, namespace, image string, sources []mirrors.Source, matching, format string, scopeMirrors bool, credHelperTimeout time.Duration, integrityKey []byte, stamp Stamp) (*Result, error) {
+	if namespace == "" {
+		return nil, errNamespaceEmpty
+	}
+
+	resolution, err := Resolve(ctx, secrets, globalAuthFilePath, image, sources, matching, scopeMirrors, credHelperTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	return WriteResolution(ctx, authDir, namespace, image, resolution, format, integrityKey, stamp)
+}
+
+// WriteResolution writes the auth file of the resolved credentials, see
+// CreateAuthFile for the parameters. It allows modifying the resolution
+// before writing it.
+func WriteResolution(ctx context.Context, authDir, namespace, image string, resolution *Resolution, format string, integrityKey []byte, stamp Stamp) (*Result, error) {
+	if namespace == "" {
+		return nil, errNamespaceEmpty
+	}
 
 	// Write the namespace auth file to the auth directory /etc/crio/<namespace>-<image_name_sha256>.json
-	path, err := writeAuthFile(authDir, image, namespace, authfileContents)
+	path, written, contents, err := writeMergedAuthFile(ctx, authDir, image, namespace, resolution.Contents, format, integrityKey, stamp)
 	if err != nil {
-		return "", fmt.Errorf("unable to write namespace auth file: %w", err)
+		return nil, fmt.Errorf("unable to write namespace auth file: %w", err)
+	}
+
+	if !written {
+		logger.Infof("Skipped writing auth file %s, a more recent write already happened", path)
+
+		return &Result{Path: path, Secrets: resolution.Secrets, Skipped: resolution.Skipped, Fenced: true, Contents: contents}, nil
 	}
 
-	logger.L().Printf("Wrote auth file to %s with %d number of entries", path, len(authfileContents.Auths))
+	logger.Infof("Wrote auth file to %s with %d number of entries", path, len(contents.Auths))
 
-	return path, nil
+	return &Result{Path: path, Secrets: resolution.Secrets, Skipped: resolution.Skipped, Contents: contents}, nil
+}
+
+// skippedSecrets returns the number of secrets which did not contribute any
+// auth entry by their skip reason.
+func skippedSecrets(secrets *corev1.SecretList, usedSecrets []string) map[string]int {
+	skipped := map[string]int{}
+
+	for i := range secrets.Items {
+		secret := &secrets.Items[i]
+
+		if !slices.Contains(usedSecrets, secret.Name) {
+			skipped[skipReason(secret)]++
+		}
+	}
+
+	return skipped
+}
+
+// skipReason returns why the secret did not contribute any auth entry, see
+// the SkipReason* constants. Secrets containing auth entries which cannot be
+// decoded are reported as such, even if their other entries do not match.
+func skipReason(secret *corev1.Secret) string {
+	if secret.Type != corev1.SecretTypeDockerConfigJson {
+		return SkipReasonWrongType
+	}
+
+	raw, ok := secret.Data[corev1.DockerConfigJsonKey]
+	if !ok {
+		return SkipReasonMissingKey
+	}
+
+	dockerConfigJSON, _, err := docker.ParseConfigJSON(raw)
+	if err != nil {
+		return SkipReasonBadJSON
+	}
+
+	for _, authConfig := range dockerConfigJSON.Auths {
+		if _, err := decodeDockerAuth(authConfig); err != nil {
+			return SkipReasonBadBase64
+		}
+	}
+
+	return SkipReasonNoMatch
 }
 
 func readGlobalAuthFile(path string) (docker.ConfigJSON, error) {
@@ -71,7 +259,10 @@ func readGlobalAuthFile(path string) (docker.ConfigJSON, error) {
 	return fileContents, nil
 }
 
-func updateAuthContents(secrets *corev1.SecretList, globalAuthContents docker.ConfigJSON, image string, mirrors []string) docker.ConfigJSON {
+// updateAuthContents merges the matching secret auths into the global auth
+// contents and returns the result together with the names of the used secrets.
+// Secret entries matching the image itself are only used if matchImage is true.
+func updateAuthContents(secrets *corev1.SecretList, globalAuthContents docker.ConfigJSON, m matcher, mirrors []string, matchImage bool) (docker.ConfigJSON, []string) {
 	// Collect all matching auths keyed by registry or mirror
 	// Pre-allocate with estimated capacity to reduce reallocations
 	estimatedCapacity := len(secrets.Items) * len(mirrors)
@@ -79,55 +270,107 @@ func updateAuthContents(secrets *corev1.SecretList, globalAuthContents docker.Co
 		estimatedCapacity = 8 // reasonable default
 	}
 
-	auths := make(map[string]docker.ConfigEntry, estimatedCapacity)
+	auths := make(map[string]docker.AuthConfig, estimatedCapacity)
+	usedSecrets := []string{}
+
+	// More specific registry entries take precedence for the same auth key
+	specificities := make(map[string]int, estimatedCapacity)
+	setAuth := func(key string, specificity int, auth docker.AuthConfig) bool {
+		if current, ok := specificities[key]; ok && current > specificity {
+			return false
+		}
+
+		auths[key] = auth
+		specificities[key] = specificity
+
+		return true
+	}
 
 	// Optimize by avoiding range value copies for large structs
 	for i := range secrets.Items {
 		secret := &secrets.Items[i]
-		logger.L().Printf("Parsing secret: %s", secret.Name)
+		logger.Debugf("Parsing secret: %s", secret.Name)
 
 		dockerConfigJSON, err := validDockerConfigSecret(*secret)
 		if err != nil {
-			logger.L().Printf("Skipping secret %q: %v", secret.Name, err)
+			logger.Warnf("Skipping secret %q: %v", secret.Name, err)
 
 			continue
 		}
 
+		used := false
+
 		for registry, authConfig := range dockerConfigJSON.Auths {
-			logger.L().Printf("Found docker config JSON auth in secret %q for %q", secret.Name, registry)
+			logger.Debugf("Found docker config JSON auth in secret %q for %q", secret.Name, registry)
 
-			auth, err := decodeDockerAuth(authConfig)
+			auth, err := secretAuth(authConfig)
 			if err != nil {
-				logger.L().Printf("Skipping secret %q because the docker config JSON auth is not parsable: %v", secret.Name, err)
+				logger.Warnf("Skipping secret %q because the docker config JSON auth is not parsable: %v", secret.Name, err)
 
 				continue
 			}
 
-			trimmedRegistry := normalizeSecretRegistry(registry)
+			trimmedRegistry := normalizeRegistry(registry)
+
+			// Glob entries expand to a concrete key per matched location and
+			// are less specific than the equivalent concrete entries
+			isGlob := strings.HasPrefix(trimmedRegistry, globPrefix)
+			globPenalty := 0
+
+			if isGlob {
+				globPenalty = 1
+			}
 
 			// Check mirrors with early exit optimization
 			mirrorsLen := len(mirrors)
 			for j := range mirrorsLen {
-				m := mirrors[j]
-				logger.L().Printf("Checking if mirror %q matches registry %q", m, trimmedRegistry)
+				mirror := mirrors[j]
 
-				if strings.HasPrefix(m, trimmedRegistry) {
-					logger.L().Printf("Using mirror auth %q for registry from secret %q", m, trimmedRegistry)
-					auths[trimmedRegistry] = auth
+				entry, ok := expandGlob(trimmedRegistry, normalizeRegistry(mirror))
+				if !ok {
+					continue
+				}
 
-					break // No need to check remaining mirrors once matched
+				logger.Debugf("Checking if mirror %q matches registry %q", mirror, entry)
+
+				if key, specificity, ok := m.mirror(entry, mirror); ok {
+					logger.Debugf("Using mirror auth %q for registry from secret %q", mirror, entry)
+
+					if setAuth(key, specificity-globPenalty, auth) {
+						used = true
+					}
+
+					if !isGlob {
+						break // No need to check remaining mirrors once matched
+					}
 				}
 			}
 
-			if strings.HasPrefix(image, trimmedRegistry) {
-				logger.L().Printf("Using auth for registry %q matching image %q", trimmedRegistry, image)
-				auths[trimmedRegistry] = auth
+			if !matchImage {
+				continue
+			}
+
+			entry, ok := expandGlob(trimmedRegistry, m.name())
+			if !ok {
+				continue
+			}
+
+			if key, specificity, ok := m.image(entry); ok {
+				logger.Debugf("Using auth for registry %q matching the image", entry)
+
+				if setAuth(key, specificity-globPenalty, auth) {
+					used = true
+				}
 			}
 		}
+
+		if used {
+			usedSecrets = append(usedSecrets, secret.Name)
+		}
 	}
 
 	if len(auths) == 0 {
-		logger.L().Print("No docker auth found for any available secret")
+		logger.Infof("No docker auth found for any available secret")
 	}
 
 	// Merge global auth file contents with auths from secrets
@@ -137,38 +380,108 @@ func updateAuthContents(secrets *corev1.SecretList, globalAuthContents docker.Co
 		fileContents.Auths = map[string]docker.AuthConfig{}
 	}
 
-	for k, e := range auths {
-		// Pre-calculate the size to avoid string concatenation allocations
-		credentials := make([]byte, 0, len(e.Username)+1+len(e.Password))
-		credentials = append(credentials, e.Username...)
-		credentials = append(credentials, ':')
-		credentials = append(credentials, e.Password...)
-		encoded := base64.StdEncoding.EncodeToString(credentials)
-		fileContents.Auths[k] = docker.AuthConfig{Auth: encoded}
+	maps.Copy(fileContents.Auths, auths)
+
+	return fileContents, usedSecrets
+}
+
+// secretAuth returns the auth entry for the secret auth config. The credential
+// gets re-encoded from its decoded username and password, while identity and
+// registry tokens get propagated unchanged. Entries only consisting of tokens
+// keep an empty credential.
+func secretAuth(conf docker.AuthConfig) (docker.AuthConfig, error) {
+	res := docker.AuthConfig{IdentityToken: conf.IdentityToken, RegistryToken: conf.RegistryToken}
+	if conf.Auth == "" && res.HasToken() {
+		return res, nil
+	}
+
+	entry, err := decodeDockerAuth(conf)
+	if err != nil {
+		return docker.AuthConfig{}, err
 	}
 
-	return fileContents
+	// Pre-calculate the size to avoid string concatenation allocations
+	credentials := make([]byte, 0, len(entry.Username)+1+len(entry.Password))
+	credentials = append(credentials, entry.Username...)
+	credentials = append(credentials, ':')
+	credentials = append(credentials, entry.Password...)
+	res.Auth = base64.StdEncoding.EncodeToString(credentials)
+
+	return res, nil
+}
+
+// CheckSecrets returns an error for every secret which is not parsable or
+// contains auth entries which cannot be decoded. Such secrets get skipped when
+// creating the auth files.
+func CheckSecrets(secrets *corev1.SecretList) error {
+	if secrets == nil {
+		return errSecretsNil
+	}
+
+	var errs []error
+
+	for i := range secrets.Items {
+		secret := &secrets.Items[i]
+
+		dockerConfigJSON, err := validDockerConfigSecret(*secret)
+		if err != nil {
+			errs = append(errs, err)
+
+			continue
+		}
+
+		for _, registry := range slices.Sorted(maps.Keys(dockerConfigJSON.Auths)) {
+			if _, err := decodeDockerAuth(dockerConfigJSON.Auths[registry]); err != nil {
+				errs = append(errs, fmt.Errorf("%w: secret %s/%s: registry %q: %w", errInvalidAuth, secret.Namespace, secret.Name, registry, err))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
 }
 
 func validDockerConfigSecret(secret corev1.Secret) (docker.ConfigJSON, error) {
 	dockerConfigJSON := docker.ConfigJSON{}
 
 	if secret.Type != corev1.SecretTypeDockerConfigJson {
-		return dockerConfigJSON, errors.New("secret is not a docker config JSON secret")
+		return dockerConfigJSON, fmt.Errorf("%w: secret %s/%s", errWrongSecretType, secret.Namespace, secret.Name)
 	}
 
 	dockerConfigJSONBytes, ok := secret.Data[corev1.DockerConfigJsonKey]
 	if !ok {
-		return dockerConfigJSON, fmt.Errorf("skipping secret %q because it does not contain data key %q", secret.Name, corev1.DockerConfigJsonKey)
+		return dockerConfigJSON, fmt.Errorf("%w %q: secret %s/%s", errMissingDataKey, corev1.DockerConfigJsonKey, secret.Namespace, secret.Name)
+	}
+
+	dockerConfigJSON, legacy, err := docker.ParseConfigJSON(dockerConfigJSONBytes)
+	if err != nil {
+		return dockerConfigJSON, fmt.Errorf("%w: secret %s/%s: %w", errUnparsable, secret.Namespace, secret.Name, err)
 	}
 
-	if err := json.Unmarshal(dockerConfigJSONBytes, &dockerConfigJSON); err != nil {
-		return dockerConfigJSON, fmt.Errorf("skipping secret %q because the docker config JSON is not parsable: %w", secret.Name, err)
+	if legacy {
+		logger.Warnf("Secret %q uses the legacy .dockercfg format within %q, converting it", secret.Name, corev1.DockerConfigJsonKey)
 	}
 
 	return dockerConfigJSON, nil
 }
 
+// Credentials returns the decoded usernames and passwords of the auth file
+// contents by their registry key. Entries without decodable credentials, like
+// registry tokens, get skipped.
+func Credentials(contents docker.ConfigJSON) map[string]docker.ConfigEntry {
+	res := make(map[string]docker.ConfigEntry, len(contents.Auths))
+
+	for key, conf := range contents.Auths {
+		entry, err := decodeDockerAuth(conf)
+		if err != nil || entry.Username == "" && entry.Password == "" {
+			continue
+		}
+
+		res[key] = entry
+	}
+
+	return res
+}
+
 // decodeDockerAuth decodes the username and password from conf.
 func decodeDockerAuth(conf docker.AuthConfig) (docker.ConfigEntry, error) {
 	decoded, err := base64.StdEncoding.DecodeString(conf.Auth)
@@ -189,75 +502,379 @@ func decodeDockerAuth(conf docker.AuthConfig) (docker.ConfigEntry, error) {
 	}, nil
 }
 
-func normalizeSecretRegistry(reg string) string {
-	// Avoid double allocation by checking which prefix exists first
-	if strings.HasPrefix(reg, "https://") {
-		return reg[8:] // len("https://") == 8
+// normalizeRegistry strips the scheme and the default port of the host from a
+// secret registry entry, mirror location or image name, which allows matching
+// "https://registry.local:443" against "registry.local". IPv6 literals get
+// bracketed and canonicalized, like "[fd00::1]:5000".
+func normalizeRegistry(reg string) string {
+	reg = stripScheme(reg)
+
+	host, rest, hasRest := strings.Cut(reg, "/")
+
+	hostname, port := splitHost(host)
+	if hostname != "" && slices.Contains(defaultPorts, port) {
+		port = ""
 	}
 
-	if strings.HasPrefix(reg, "http://") {
-		return reg[7:] // len("http://") == 7
+	host = joinHost(hostname, port)
+
+	if hasRest {
+		return host + "/" + rest
+	}
+
+	return host
+}
+
+// stripScheme removes the HTTP(S) scheme of the registry, if present.
+func stripScheme(reg string) string {
+	for _, scheme := range []string{"https://", "http://"} {
+		if len(reg) >= len(scheme) && strings.EqualFold(reg[:len(scheme)], scheme) {
+			return reg[len(scheme):]
+		}
 	}
 
 	return reg
 }
 
-func writeAuthFile(dir, image, namespace string, fileContents docker.ConfigJSON) (string, error) {
+// restoreHost replaces the normalized host of the auth file key with the host
+// of the matched location, if both only differ by their normalization. This
+// keeps the key consistent with the name the runtime looks up, like
+// "registry.local:443/org" for a secret entry of "registry.local/org".
+func restoreHost(key, location string) string {
+	host, _, _ := strings.Cut(stripScheme(location), "/")
+	keyHost, rest, hasRest := strings.Cut(key, "/")
+
+	if host == keyHost || normalizeRegistry(host) != keyHost {
+		return key
+	}
+
+	if hasRest {
+		return host + "/" + rest
+	}
+
+	return host
+}
+
+func writeAuthFile(dir, image, namespace string, fileContents docker.ConfigJSON, format string, integrityKey []byte, stamp Stamp) (string, bool, error) {
+	path, written, _, err := writeMergedAuthFile(context.Background(), dir, image, namespace, fileContents, format, integrityKey, stamp)
+
+	return path, written, err
+}
+
+// writeMergedAuthFile works like writeAuthFile, but merges the contents into
+// the existing auth file if the stamp has a merge conflict policy. It
+// additionally returns the written contents.
+func writeMergedAuthFile(ctx context.Context, dir, image, namespace string, fileContents docker.ConfigJSON, format string, integrityKey []byte, stamp Stamp) (string, bool, docker.ConfigJSON, error) {
 	if len(fileContents.Auths) == 0 {
-		return "", errNoAuths
+		return "", false, fileContents, ErrNoAuths
+	}
+
+	// The existing auth file is read while holding the lock of the auth
+	// directory, which avoids losing the entries of concurrent writes
+	encode := func(path string) ([]byte, error) {
+		if stamp.Merge != "" {
+			fileContents = merge(path, fileContents, format, integrityKey, stamp.Merge)
+		}
+
+		raw, err := encodeAuthFile(format, fileContents)
+		if err != nil {
+			return nil, fmt.Errorf("encode auth file: %w", err)
+		}
+
+		return raw, nil
 	}
 
+	path, written, err := writeEncodedAuthFile(ctx, dir, namespace, image, encode, integrityKey, stamp, defaultPermissions)
+
+	return path, written, fileContents, err
+}
+
+// WriteAuthFile encodes the contents in the provided format and writes them
+// like WriteRawAuthFile.
+func WriteAuthFile(dir, namespace, image string, contents docker.ConfigJSON, format string, integrityKey []byte, stamp Stamp) (string, bool, error) {
+	return writeAuthFile(dir, image, namespace, contents, format, integrityKey, stamp)
+}
+
+// WriteRawAuthFile writes the already encoded auth file contents raw for the
+// namespace and image together with its signed sidecar file. It returns the
+// path of the auth file and false if a more recent write of another instance
+// fenced the write.
+func WriteRawAuthFile(dir, namespace, image string, raw, integrityKey []byte, stamp Stamp) (string, bool, error) {
+	return writeRawAuthFile(dir, namespace, image, raw, integrityKey, stamp, defaultPermissions)
+}
+
+func writeRawAuthFile(dir, namespace, image string, raw, integrityKey []byte, stamp Stamp, perms permissions) (string, bool, error) {
+	return writeEncodedAuthFile(context.Background(), dir, namespace, image, func(string) ([]byte, error) { return raw, nil }, integrityKey, stamp, perms)
+}
+
+// writeEncodedAuthFile works like writeRawAuthFile, but encodes the contents
+// by using encode with the path of the auth file after locking the auth
+// directory. Nothing gets written if ctx is done after encoding.
+func writeEncodedAuthFile(ctx context.Context, dir, namespace, image string, encode func(path string) ([]byte, error), integrityKey []byte, stamp Stamp, perms permissions) (string, bool, error) {
 	if err := os.MkdirAll(dir, 0o700); err != nil {
-		return "", fmt.Errorf("ensure auth dir %q: %w", dir, err)
+		return "", false, fmt.Errorf("ensure auth dir %q: %w", dir, err)
 	}
 
-	path, err := auth.FilePath(dir, namespace, image)
+	path, err := stamp.Naming.FilePath(dir, namespace, image)
 	if err != nil {
-		return "", fmt.Errorf("get auth path: %w", err)
+		return "", false, fmt.Errorf("get auth path: %w", err)
 	}
 
-	// Write to a temp file first, then atomically rename into place.
-	// This prevents a truncated or empty auth file if the process is
-	// killed mid-write.
-	tmpFile, err := os.CreateTemp(dir, ".auth-*.tmp")
+	// Consumers locate the auth files by the published naming
+	if err := auth.WriteNaming(dir, &stamp.Naming); err != nil {
+		return "", false, fmt.Errorf("publish naming: %w", err)
+	}
+
+	// The auth file and its sidecar must not get interleaved with the writes
+	// of concurrent kubelet invocations or other instances, which would
+	// result in a sidecar not matching the auth file
+	_, unlock, err := lockDir(dir, stamp.Lock)
 	if err != nil {
-		return "", fmt.Errorf("create temp auth file: %w", err)
+		return "", false, err
+	}
+	defer unlock()
+
+	raw, err := encode(path)
+	if err != nil {
+		return "", false, err
+	}
+
+	meta := auth.Sidecar{
+		Version: auth.SidecarVersion,
+		HMAC:    auth.ComputeHMAC(integrityKey, raw),
+		Owner:   stamp.Owner,
+		Fence:   stamp.Fence,
+		SHA256:  auth.ComputeSHA256(raw),
+		Written: time.Now().UTC(),
+		Expires: stamp.Expires,
 	}
 
-	tmpPath := tmpFile.Name()
+	sidecar, err := json.Marshal(meta)
+	if err != nil {
+		return "", false, fmt.Errorf("encode sidecar file: %w", err)
+	}
+
+	if stamp.enabled() && fenced(path, stamp) {
+		return path, false, nil
+	}
+
+	// The auth file and its sidecar get written together or not at all,
+	// because a deadline in between would leave them mismatched
+	if err := ctx.Err(); err != nil {
+		return "", false, fmt.Errorf("write auth file: %w", err)
+	}
+
+	switch compare(path, raw, &meta, stamp, perms) {
+	case changeNone:
+		logger.Debugf("Auth file %s is unchanged, skipping write", path)
+
+		return path, true, touch(path)
 
-	success := false
+	case changeMetadata:
+		logger.Debugf("Auth file %s is unchanged, only updating its sidecar", path)
 
-	defer func() {
-		if !success {
-			_ = os.Remove(tmpPath)
+		return path, true, writeMetadata(path, sidecar, perms)
+
+	case changeContents:
+		// Written below
+	}
+
+	eventType := events.TypeCreated
+	if _, err := os.Stat(path); err == nil {
+		eventType = events.TypeUpdated
+	}
+
+	if stamp.Publication.Versioned {
+		if err := publish(dir, path, raw, sidecar, perms, stamp.Publication); err != nil {
+			return "", false, err
+		}
+	} else {
+		// Readers retry once on a mismatch, which covers the new sidecar
+		// next to the old auth file, but not the other way around
+		if err := auth.WriteFileAtomic(auth.SidecarPath(path), sidecar, perms.mode, perms.gid); err != nil {
+			return "", false, fmt.Errorf("write sidecar file: %w", err)
 		}
-	}()
 
-	encoder := json.NewEncoder(tmpFile)
-	encoder.SetIndent("", "\t")
+		if err := auth.WriteFileAtomic(path, raw, perms.mode, perms.gid); err != nil {
+			return "", false, fmt.Errorf("write auth file: %w", err)
+		}
 
-	if err := encoder.Encode(fileContents); err != nil {
-		_ = tmpFile.Close()
+		// Versions of a previously versioned publication are stale now
+		if err := pruneVersions(path, 0, time.Now()); err != nil {
+			return "", false, err
+		}
+	}
+
+	events.Emit(eventType, events.Data{Path: path, Namespace: namespace, Image: image, Owner: stamp.Owner, Workload: stamp.Workload})
+
+	return path, true, nil
+}
+
+// permissions are the file mode and group of the written auth files.
+type permissions struct {
+	mode os.FileMode
+
+	// gid is the group owning the files, or -1 to keep the group.
+	gid int
+}
 
-		return "", fmt.Errorf("encode auth file: %w", err)
+// defaultPermissions restrict the auth files to the owner.
+var defaultPermissions = permissions{mode: 0o600, gid: -1}
+
+// LoadOrCreateIntegrityKey reads the integrity key from path or creates a new
+// random one if it does not exist yet.
+func LoadOrCreateIntegrityKey(path string) ([]byte, error) {
+	const keySize = 32
+
+	key, err := auth.ReadKey(path)
+	if err == nil {
+		return key, nil
+	}
+
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("load integrity key: %w", err)
+	}
+
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("ensure integrity key dir: %w", err)
+	}
+
+	key = make([]byte, keySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("generate integrity key: %w", err)
 	}
 
-	if err := tmpFile.Sync(); err != nil {
+	tmpFile, err := os.CreateTemp(dir, ".key-*.tmp")
+	if err != nil {
+		return nil, fmt.Errorf("create temp integrity key: %w", err)
+	}
+
+	defer os.Remove(tmpFile.Name()) //nolint:errcheck // best effort cleanup
+
+	if _, err := tmpFile.Write(key); err != nil {
 		_ = tmpFile.Close()
 
-		return "", fmt.Errorf("sync temp auth file: %w", err)
+		return nil, fmt.Errorf("write integrity key: %w", err)
 	}
 
 	if err := tmpFile.Close(); err != nil {
-		return "", fmt.Errorf("close temp auth file: %w", err)
+		return nil, fmt.Errorf("close integrity key: %w", err)
+	}
+
+	// Linking fails if the key already exists, which makes sure that
+	// concurrent runs never observe a partially written key.
+	if err := os.Link(tmpFile.Name(), path); err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return auth.ReadKey(path)
+		}
+
+		return nil, fmt.Errorf("link integrity key: %w", err)
+	}
+
+	return key, nil
+}
+
+// FileNamespace returns the namespace component of the auth file names, which
+// is the keyed namespace hash if hash is true.
+func FileNamespace(namespace string, hash bool, integrityKey []byte) string {
+	if hash && namespace != "" {
+		return auth.NamespaceHash(integrityKey, namespace)
+	}
+
+	return namespace
+}
+
+// Namespaces returns the unique namespace components of all auth files within
+// dir, which are namespace hashes for hashed namespaces.
+func Namespaces(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("read auth dir: %w", err)
+	}
+
+	res := []string{}
+
+	for _, entry := range entries {
+		namespace, _, err := auth.ParseFilePath(entry.Name())
+		if err != nil || slices.Contains(res, namespace) {
+			continue
+		}
+
+		res = append(res, namespace)
 	}
 
-	if err := os.Rename(tmpPath, path); err != nil {
-		return "", fmt.Errorf("rename temp auth file: %w", err)
+	return res, nil
+}
+
+// RemoveNamespace removes all auth files including their sidecars of the
+// provided namespace component from dir. Auth files written by other owners
+// than the provided one are kept if the owner is not empty. It returns the
+// paths of the removed auth files.
+func RemoveNamespace(dir, namespace, owner string) ([]string, error) {
+	if namespace == "" {
+		return nil, errNamespaceEmpty
 	}
 
-	success = true
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("read auth dir: %w", err)
+	}
+
+	removed := []string{}
+
+	for _, entry := range entries {
+		fileNamespace, _, err := auth.ParseFilePath(entry.Name())
+		if err != nil || fileNamespace != namespace {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+
+		if owner != "" && ForeignOwner(path, owner) {
+			continue
+		}
+
+		if err := RemoveFile(path); err != nil {
+			return removed, err
+		}
+
+		removed = append(removed, path)
+	}
+
+	return removed, nil
+}
+
+// RemoveFile removes the auth file at path together with its sidecar file
+// and all of its versions. Already removed files are ignored.
+func RemoveFile(path string) error {
+	removed := false
+
+	for _, p := range []string{path, auth.SidecarPath(path)} {
+		err := os.Remove(p)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("remove auth file: %w", err)
+		}
+
+		removed = removed || (err == nil && p == path)
+	}
+
+	if err := pruneVersions(path, 0, time.Now()); err != nil {
+		return err
+	}
+
+	if removed {
+		namespace, _, _ := auth.ParseFilePath(path)
+		events.Emit(events.TypeDeleted, events.Data{Path: path, Namespace: namespace})
+	}
 
-	return path, nil
+	return nil
 }
@@ -1,18 +1,24 @@
 package auth
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
-	"github.com/cri-o/crio-credential-provider/internal/pkg/docker"
 	cpAuth "github.com/cri-o/crio-credential-provider/pkg/auth"
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+	"github.com/cri-o/crio-credential-provider/pkg/docker"
+	"github.com/cri-o/crio-credential-provider/pkg/mirrors"
 )
 
 var (
@@ -21,6 +27,7 @@ var (
 	testGlobalEncoded = base64.StdEncoding.EncodeToString([]byte("gu:gp"))
 	testAuthEncoded   = base64.StdEncoding.EncodeToString([]byte("u1:p1"))
 	testValidAuth     = base64.StdEncoding.EncodeToString([]byte("user:pass"))
+	testIntegrityKey  = []byte("key")
 )
 
 func TestUpdateAuthContents(t *testing.T) {
@@ -54,6 +61,7 @@ func TestUpdateAuthContents(t *testing.T) {
 		secretRegs     []string
 		image          string
 		mirrors        []string
+		imageRejected  bool
 		wantSecretRegs []string // should exist with secretEncoded
 		wantGlobalRegs []string // should exist with globalEncoded (not overwritten)
 		notWantRegs    []string // should not exist
@@ -93,6 +101,16 @@ func TestUpdateAuthContents(t *testing.T) {
 			wantSecretRegs: []string{"registry.local"},
 			notWantRegs:    []string{"quay.io"},
 		},
+		{
+			name:           "image match skipped for rejected primary source",
+			globalRegs:     []string{},
+			secretRegs:     []string{"registry.local", "quay.io"},
+			image:          "registry.local/foo:tag",
+			mirrors:        []string{"quay.io"},
+			imageRejected:  true,
+			wantSecretRegs: []string{"quay.io"},
+			notWantRegs:    []string{"registry.local"},
+		},
 		{
 			name:           "no mirror or image matches in secret, returns global secret",
 			globalRegs:     []string{"keep.io", "nomatch.local"},
@@ -111,7 +129,7 @@ func TestUpdateAuthContents(t *testing.T) {
 			secrets := buildSecretList(t, secretEncoded, tt.secretRegs)
 			globalContents := buildGlobalConfig(globalEncoded, tt.globalRegs)
 
-			contents := updateAuthContents(secrets, globalContents, tt.image, tt.mirrors)
+			contents, _ := updateAuthContents(secrets, globalContents, &prefixMatcher{ref: tt.image}, tt.mirrors, !tt.imageRejected)
 
 			assertHas(contents, tt.wantSecretRegs, secretEncoded)
 			assertHas(contents, tt.wantGlobalRegs, globalEncoded)
@@ -127,13 +145,15 @@ func TestCreateAuthFile(t *testing.T) {
 		"quay.io":          {Auth: testAuthEncoded},
 		"cache.local:5000": {Auth: testAuthEncoded},
 		"registry.local":   {Auth: testAuthEncoded},
+		"blocked.local":    {Auth: testAuthEncoded},
 	}}
 
 	cfgBytes, err := json.Marshal(cfg)
 	require.NoError(t, err)
 
 	secret := corev1.Secret{
-		Type: corev1.SecretTypeDockerConfigJson,
+		ObjectMeta: metav1.ObjectMeta{Name: "secret"},
+		Type:       corev1.SecretTypeDockerConfigJson,
 		Data: map[string][]byte{
 			corev1.DockerConfigJsonKey: cfgBytes,
 		},
@@ -143,12 +163,22 @@ func TestCreateAuthFile(t *testing.T) {
 
 	namespace := "ns-unit"
 	image := "registry.local/app/img:1"
-	mirrors := []string{"mirror.quay.io", "cache.local:5000", "quay.io"}
+	sources := []mirrors.Source{
+		{Location: "mirror.quay.io", Mirror: true, Allowed: true},
+		{Location: "cache.local:5000", Mirror: true, Allowed: true},
+		{Location: "quay.io", Mirror: true, Allowed: true},
+		{Location: "blocked.local", Mirror: true, Reason: "registry is blocked"},
+		{Location: "registry.local", Allowed: true},
+	}
 
 	authDir := t.TempDir()
 
-	path, err := CreateAuthFile(secrets, "", authDir, namespace, image, mirrors)
+	res, err := CreateAuthFile(t.Context(), secrets, "", authDir, namespace, image, sources, config.SecretMatchingPrefix, config.AuthFormatAuthJSON, false, 0, testIntegrityKey, Stamp{})
 	require.NoError(t, err)
+	assert.Equal(t, []string{"secret"}, res.Secrets)
+	assert.Empty(t, res.Skipped)
+
+	path := res.Path
 
 	wantPath, err := cpAuth.FilePath(authDir, namespace, image)
 	require.NoError(t, err)
@@ -163,10 +193,75 @@ func TestCreateAuthFile(t *testing.T) {
 	require.NoError(t, err)
 
 	// Expect entries for quay.io (mirror match) and registry.local (image match)
-	assert.Len(t, written.Auths, len(cfg.Auths))
+	// but not for the disallowed blocked.local source
+	assert.Len(t, written.Auths, len(cfg.Auths)-1)
 	assert.Contains(t, written.Auths, "quay.io")
 	assert.Contains(t, written.Auths, "registry.local")
 	assert.Contains(t, written.Auths, "cache.local:5000")
+	assert.NotContains(t, written.Auths, "blocked.local")
+}
+
+func TestCreateAuthFileCanceled(t *testing.T) {
+	t.Parallel()
+
+	secrets := buildSecretList(t, base64.StdEncoding.EncodeToString([]byte("user:pass")), []string{"quay.io"})
+	sources := []mirrors.Source{{Location: "quay.io", Allowed: true}}
+	authDir := t.TempDir()
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	_, err := CreateAuthFile(ctx, secrets, "", authDir, "ns", "quay.io/org/app", sources, config.SecretMatchingPrefix, config.AuthFormatAuthJSON, false, 0, testIntegrityKey, Stamp{})
+	require.ErrorIs(t, err, context.Canceled)
+
+	path, err := cpAuth.FilePath(authDir, "ns", "quay.io/org/app")
+	require.NoError(t, err)
+	assert.NoFileExists(t, path)
+	assert.NoFileExists(t, cpAuth.SidecarPath(path))
+}
+
+func TestCreateAuthFileUnqualified(t *testing.T) {
+	t.Parallel()
+
+	quayAuth := base64.StdEncoding.EncodeToString([]byte("quay:pass"))
+	localAuth := base64.StdEncoding.EncodeToString([]byte("local:pass"))
+
+	secrets := buildSecretList(t, quayAuth, []string{"mirror.quay.io", "quay.io/org"})
+	secrets.Items[0].Name = "quay"
+	secrets.Items = append(secrets.Items, buildSecretList(t, localAuth, []string{"registry.local", "quay.io"}).Items...)
+	secrets.Items[1].Name = "local"
+
+	const image = "org/app"
+
+	sources := []mirrors.Source{
+		{Location: "mirror.quay.io", Mirror: true, Allowed: true, Candidate: "quay.io/org/app"},
+		{Location: "quay.io", Allowed: true, Candidate: "quay.io/org/app"},
+		{Location: "registry.local", Allowed: true, Candidate: "registry.local/org/app"},
+	}
+
+	authDir := t.TempDir()
+
+	res, err := CreateAuthFile(t.Context(), secrets, "", authDir, "ns", image, sources, config.SecretMatchingReference, config.AuthFormatAuthJSON, false, 0, testIntegrityKey, Stamp{})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"quay", "local"}, res.Secrets)
+
+	wantPath, err := cpAuth.FilePath(authDir, "ns", image)
+	require.NoError(t, err)
+	assert.Equal(t, wantPath, res.Path)
+
+	data, err := os.ReadFile(res.Path)
+	require.NoError(t, err)
+
+	var written docker.ConfigJSON
+	require.NoError(t, json.Unmarshal(data, &written))
+
+	// Every candidate gets matched against its own sources
+	assert.Equal(t, map[string]docker.AuthConfig{
+		"mirror.quay.io": {Auth: quayAuth},
+		"quay.io":        {Auth: localAuth},
+		"quay.io/org":    {Auth: quayAuth},
+		"registry.local": {Auth: localAuth},
+	}, written.Auths)
 }
 
 func buildSecretList(t *testing.T, encoded string, regs []string) *corev1.SecretList {
@@ -268,6 +363,15 @@ func TestValidDockerConfigSecret(t *testing.T) {
 			},
 			shouldErr: false,
 		},
+		"legacy dockercfg data": {
+			secret: corev1.Secret{
+				Type: corev1.SecretTypeDockerConfigJson,
+				Data: map[string][]byte{
+					corev1.DockerConfigJsonKey: []byte(`{"quay.io":{"auth":"` + testValidAuth + `"}}`),
+				},
+			},
+			shouldErr: false,
+		},
 		"wrong secret type": {
 			secret: corev1.Secret{
 				Type: corev1.SecretTypeOpaque,
@@ -310,6 +414,85 @@ func TestValidDockerConfigSecret(t *testing.T) {
 	}
 }
 
+func TestCheckSecrets(t *testing.T) {
+	t.Parallel()
+
+	secret := func(name, data string) corev1.Secret {
+		return corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "ns"},
+			Type:       corev1.SecretTypeDockerConfigJson,
+			Data:       map[string][]byte{corev1.DockerConfigJsonKey: []byte(data)},
+		}
+	}
+
+	for name, tc := range map[string]struct {
+		secrets        []corev1.Secret
+		expectedErrors []string
+	}{
+		"valid secrets": {
+			secrets: []corev1.Secret{secret("valid", `{"auths":{"quay.io":{"auth":"`+testValidAuth+`"}}}`)},
+		},
+		"malformed secrets": {
+			secrets: []corev1.Secret{
+				secret("valid", `{"auths":{"quay.io":{"auth":"`+testValidAuth+`"}}}`),
+				secret("invalid-json", `invalid`),
+				secret("invalid-auth", `{"auths":{"quay.io":{"auth":"!"}}}`),
+			},
+			expectedErrors: []string{
+				"CP2004: docker config JSON is not parsable: secret ns/invalid-json: ",
+				`CP2005: invalid base64 auth: secret ns/invalid-auth: registry "quay.io": `,
+			},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			err := CheckSecrets(&corev1.SecretList{Items: tc.secrets})
+			if len(tc.expectedErrors) == 0 {
+				require.NoError(t, err)
+
+				return
+			}
+
+			require.ErrorIs(t, err, ErrMalformedSecret)
+
+			for _, expected := range tc.expectedErrors {
+				assert.ErrorContains(t, err, expected)
+			}
+		})
+	}
+}
+
+func TestSkippedSecrets(t *testing.T) {
+	t.Parallel()
+
+	secret := func(name, data string) corev1.Secret {
+		return corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "ns"},
+			Type:       corev1.SecretTypeDockerConfigJson,
+			Data:       map[string][]byte{corev1.DockerConfigJsonKey: []byte(data)},
+		}
+	}
+
+	secrets := &corev1.SecretList{Items: []corev1.Secret{
+		secret("used", `{"auths":{"quay.io":{"auth":"`+testValidAuth+`"}}}`),
+		secret("no-match", `{"auths":{"docker.io":{"auth":"`+testValidAuth+`"}}}`),
+		secret("another-no-match", `{"auths":{"docker.io":{"auth":"`+testValidAuth+`"}}}`),
+		secret("invalid-json", `invalid`),
+		secret("invalid-auth", `{"auths":{"docker.io":{"auth":"!"}}}`),
+		{ObjectMeta: metav1.ObjectMeta{Name: "missing-key"}, Type: corev1.SecretTypeDockerConfigJson},
+		{ObjectMeta: metav1.ObjectMeta{Name: "wrong-type"}, Type: corev1.SecretTypeOpaque},
+	}}
+
+	assert.Equal(t, map[string]int{
+		SkipReasonNoMatch:    2,
+		SkipReasonBadJSON:    1,
+		SkipReasonBadBase64:  1,
+		SkipReasonMissingKey: 1,
+		SkipReasonWrongType:  1,
+	}, skippedSecrets(secrets, []string{"used"}))
+}
+
 func TestDecodeDockerAuth(t *testing.T) {
 	t.Parallel()
 
@@ -357,6 +540,21 @@ func TestDecodeDockerAuth(t *testing.T) {
 	}
 }
 
+func TestCredentials(t *testing.T) {
+	t.Parallel()
+
+	credentials := Credentials(docker.ConfigJSON{Auths: map[string]docker.AuthConfig{
+		"mirror.local":      {Auth: base64.StdEncoding.EncodeToString([]byte("user:password"))},
+		"token.local":       {RegistryToken: "token"},
+		"invalid.local":     {Auth: "not-valid-base64!!!"},
+		"no-password.local": {Auth: base64.StdEncoding.EncodeToString([]byte("userpassword"))},
+	}})
+
+	assert.Equal(t, map[string]docker.ConfigEntry{
+		"mirror.local": {Username: "user", Password: "password"},
+	}, credentials)
+}
+
 func TestWriteAuthFile(t *testing.T) {
 	t.Parallel()
 
@@ -384,7 +582,9 @@ func TestWriteAuthFile(t *testing.T) {
 
 			dir := t.TempDir()
 
-			path, err := writeAuthFile(dir, "test-image", "test-ns", tc.contents)
+			expires := time.Now().Add(time.Hour).UTC()
+
+			path, _, err := writeAuthFile(dir, "test-image", "test-ns", tc.contents, config.AuthFormatAuthJSON, testIntegrityKey, Stamp{Expires: expires})
 			if tc.shouldErr {
 				require.Error(t, err)
 			} else {
@@ -400,6 +600,16 @@ func TestWriteAuthFile(t *testing.T) {
 				err = json.Unmarshal(data, &written)
 				require.NoError(t, err)
 				assert.Equal(t, tc.contents.Auths, written.Auths)
+
+				verified, err := cpAuth.Read(dir, "test-ns", "test-image", config.AuthFormatAuthJSON, testIntegrityKey)
+				require.NoError(t, err)
+				assert.Equal(t, tc.contents.Auths, verified.Auths)
+
+				sidecar, err := cpAuth.ReadSidecar(path)
+				require.NoError(t, err)
+				assert.True(t, sidecar.Matches(data))
+				assert.WithinDuration(t, time.Now(), sidecar.Written, time.Minute)
+				assert.True(t, expires.Equal(sidecar.Expires))
 			}
 		})
 	}
@@ -472,7 +682,7 @@ func TestCreateAuthFileErrors(t *testing.T) {
 				globalAuthPath = tc.setupGlobalAuth(t)
 			}
 
-			_, err := CreateAuthFile(tc.secrets, globalAuthPath, dir, tc.namespace, "test-image", []string{"mirror.io"})
+			_, err := CreateAuthFile(t.Context(), tc.secrets, globalAuthPath, dir, tc.namespace, "test-image", []mirrors.Source{{Location: "mirror.io", Mirror: true, Allowed: true}}, config.SecretMatchingPrefix, config.AuthFormatAuthJSON, false, 0, testIntegrityKey, Stamp{})
 			if tc.shouldErr {
 				require.Error(t, err)
 
@@ -504,14 +714,44 @@ func TestUpdateAuthContentsNoMatches(t *testing.T) {
 		},
 	}
 
-	result := updateAuthContents(secrets, globalContents, "test.io/image", []string{"mirror.io"})
+	result, usedSecrets := updateAuthContents(secrets, globalContents, &prefixMatcher{ref: "test.io/image"}, []string{"mirror.io"}, true)
 
 	// Should preserve global auths when no matching secrets
 	assert.Len(t, result.Auths, 1)
 	assert.Contains(t, result.Auths, "global.io")
+	assert.Empty(t, usedSecrets)
 }
 
-func TestNormalizeSecretRegistry(t *testing.T) {
+func TestUpdateAuthContentsTokens(t *testing.T) {
+	t.Parallel()
+
+	raw, err := json.Marshal(docker.ConfigJSON{Auths: map[string]docker.AuthConfig{
+		"acr.example.io":    {Auth: base64.StdEncoding.EncodeToString([]byte("00000000-0000-0000-0000-000000000000:")), IdentityToken: "refresh"},
+		"harbor.example.io": {RegistryToken: "bearer"},
+	}})
+	require.NoError(t, err)
+
+	secrets := &corev1.SecretList{Items: []corev1.Secret{{
+		ObjectMeta: metav1.ObjectMeta{Name: "tokens"},
+		Type:       corev1.SecretTypeDockerConfigJson,
+		Data:       map[string][]byte{corev1.DockerConfigJsonKey: raw},
+	}}}
+
+	globalContents := docker.ConfigJSON{Auths: map[string]docker.AuthConfig{
+		"global.io": {Auth: testGlobalEncoded, IdentityToken: "global-refresh"},
+	}}
+
+	result, usedSecrets := updateAuthContents(secrets, globalContents, &prefixMatcher{ref: "example.io/app"}, []string{"acr.example.io", "harbor.example.io"}, true)
+
+	assert.Equal(t, []string{"tokens"}, usedSecrets)
+	assert.Equal(t, map[string]docker.AuthConfig{
+		"acr.example.io":    {Auth: base64.StdEncoding.EncodeToString([]byte("00000000-0000-0000-0000-000000000000:")), IdentityToken: "refresh"},
+		"harbor.example.io": {RegistryToken: "bearer"},
+		"global.io":         {Auth: testGlobalEncoded, IdentityToken: "global-refresh"},
+	}, result.Auths)
+}
+
+func TestNormalizeRegistry(t *testing.T) {
 	t.Parallel()
 
 	for name, tc := range map[string]struct {
@@ -534,12 +774,127 @@ func TestNormalizeSecretRegistry(t *testing.T) {
 			input:    "https://registry.io:5000",
 			expected: "registry.io:5000",
 		},
+		"upper case scheme": {
+			input:    "HTTPS://registry.io",
+			expected: "registry.io",
+		},
+		"default https port": {
+			input:    "https://registry.io:443/org",
+			expected: "registry.io/org",
+		},
+		"default http port": {
+			input:    "registry.io:80",
+			expected: "registry.io",
+		},
+		"default port within path": {
+			input:    "registry.io/org:443",
+			expected: "registry.io/org:443",
+		},
+		"port with default port suffix": {
+			input:    "registry.io:8443",
+			expected: "registry.io:8443",
+		},
+		"ipv6 with port": {
+			input:    "https://[FD00:0::1]:5000/org",
+			expected: "[fd00::1]:5000/org",
+		},
+		"ipv6 with default port": {
+			input:    "[fd00::1]:443",
+			expected: "[fd00::1]",
+		},
+		"unbracketed ipv6": {
+			input:    "fd00::1",
+			expected: "[fd00::1]",
+		},
 	} {
 		t.Run(name, func(t *testing.T) {
 			t.Parallel()
 
-			result := normalizeSecretRegistry(tc.input)
+			result := normalizeRegistry(tc.input)
 			assert.Equal(t, tc.expected, result)
 		})
 	}
 }
+
+func TestLoadOrCreateIntegrityKey(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "sub", "integrity.key")
+
+	key, err := LoadOrCreateIntegrityKey(path)
+	require.NoError(t, err)
+	assert.Len(t, key, 32)
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	again, err := LoadOrCreateIntegrityKey(path)
+	require.NoError(t, err)
+	assert.Equal(t, key, again)
+
+	tmpFiles, err := filepath.Glob(filepath.Join(filepath.Dir(path), ".key-*.tmp"))
+	require.NoError(t, err)
+	assert.Empty(t, tmpFiles)
+}
+
+func TestRemoveNamespace(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	contents := docker.ConfigJSON{Auths: map[string]docker.AuthConfig{"quay.io": {Auth: "auth"}}}
+
+	var paths []string
+
+	for _, namespace := range []string{"default", "default", "other"} {
+		path, _, err := writeAuthFile(dir, fmt.Sprintf("quay.io/image-%d", len(paths)), namespace, contents, config.AuthFormatAuthJSON, testIntegrityKey, Stamp{})
+		require.NoError(t, err)
+
+		paths = append(paths, path)
+	}
+
+	namespaces, err := Namespaces(dir)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"default", "other"}, namespaces)
+
+	removed, err := RemoveNamespace(dir, "default", "")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, paths[:2], removed)
+
+	for _, path := range paths[:2] {
+		assert.NoFileExists(t, path)
+		assert.NoFileExists(t, cpAuth.SidecarPath(path))
+	}
+
+	assert.FileExists(t, paths[2])
+	assert.FileExists(t, cpAuth.SidecarPath(paths[2]))
+
+	namespaces, err = Namespaces(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"other"}, namespaces)
+
+	_, err = RemoveNamespace(dir, "", "")
+	require.ErrorIs(t, err, errNamespaceEmpty)
+
+	namespaces, err = Namespaces(filepath.Join(dir, "missing"))
+	require.NoError(t, err)
+	assert.Empty(t, namespaces)
+}
+
+func TestWriteRawAuthFileNaming(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	contents := []byte(`{"auths":{"quay.io":{"auth":"dXNlcjpwYXNz"}}}`)
+	naming := cpAuth.Naming{Version: cpAuth.NamingVersion2, Length: 16, Registry: true}
+
+	path, written, err := WriteRawAuthFile(dir, "ns", "quay.io/org/image", contents, testIntegrityKey, Stamp{Naming: naming})
+	require.NoError(t, err)
+	assert.True(t, written)
+	assert.True(t, naming.Matches(path))
+
+	// Consumers locate the auth file by the published naming
+	config, err := cpAuth.Read(dir, "ns", "quay.io/org/image", config.AuthFormatAuthJSON, testIntegrityKey)
+	require.NoError(t, err)
+	assert.Contains(t, config.Auths, "quay.io")
+}
@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/cri-o/crio-credential-provider/pkg/auth"
+)
+
+// change is the difference between a write and the existing auth file.
+type change int
+
+const (
+	// changeContents requires writing the auth file and its sidecar.
+	changeContents change = iota
+
+	// changeMetadata only requires writing the sidecar, because the auth
+	// file already has the contents.
+	changeMetadata
+
+	// changeNone does not require any write.
+	changeNone
+)
+
+// compare returns the change of writing raw with the sidecar to the auth file
+// at path. Skipping unchanged auth files avoids disk churn and spurious
+// inotify events for consumers watching the auth directory. Switching the
+// publication mode or the permissions always changes the contents.
+func compare(path string, raw []byte, sidecar *auth.Sidecar, stamp Stamp, perms permissions) change {
+	info, err := os.Lstat(path)
+	if err != nil || (info.Mode()&fs.ModeSymlink != 0) != stamp.Publication.Versioned {
+		return changeContents
+	}
+
+	existing, err := auth.ReadSidecar(path)
+	if err != nil || !existing.Matches(raw) || existing.HMAC != sidecar.HMAC {
+		return changeContents
+	}
+
+	// The sidecar may be outdated, which means the contents are compared
+	contents, err := os.ReadFile(path)
+	if err != nil || !bytes.Equal(contents, raw) {
+		return changeContents
+	}
+
+	if info, err = os.Stat(path); err != nil || info.Mode().Perm() != perms.mode {
+		return changeContents
+	}
+
+	if perms.gid >= 0 {
+		if stat, ok := info.Sys().(*syscall.Stat_t); !ok || int(stat.Gid) != perms.gid {
+			return changeContents
+		}
+	}
+
+	if existing.Version != sidecar.Version || existing.Owner != sidecar.Owner ||
+		existing.Fence != sidecar.Fence || !existing.Expires.Equal(sidecar.Expires) {
+		return changeMetadata
+	}
+
+	return changeNone
+}
+
+// writeMetadata writes the sidecar of the unchanged auth file at path, which
+// is the one of the current version if published versioned. The modification
+// time of the auth file gets updated, because it counts as written for the
+// retention.
+func writeMetadata(path string, sidecar []byte, perms permissions) error {
+	sidecarPath, err := filepath.EvalSymlinks(auth.SidecarPath(path))
+	if err != nil {
+		return fmt.Errorf("resolve sidecar file: %w", err)
+	}
+
+	if err := auth.WriteFileAtomic(sidecarPath, sidecar, perms.mode, perms.gid); err != nil {
+		return fmt.Errorf("write sidecar file: %w", err)
+	}
+
+	return touch(path)
+}
+
+// touch updates the modification time of the unchanged auth file at path.
+func touch(path string) error {
+	now := time.Now()
+
+	if err := os.Chtimes(path, now, now); err != nil {
+		return fmt.Errorf("touch auth file: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	cpAuth "github.com/cri-o/crio-credential-provider/pkg/auth"
+)
+
+func TestWriteRawAuthFileUnchanged(t *testing.T) {
+	t.Parallel()
+
+	expires := time.Now().Add(time.Hour).UTC()
+
+	for name, tc := range map[string]struct {
+		raw              []byte
+		stamp            Stamp
+		expectedContents bool
+		expectedSidecar  bool
+	}{
+		"unchanged": {
+			raw:   []byte("first"),
+			stamp: Stamp{Expires: expires},
+		},
+		"changed contents": {
+			raw:              []byte("second"),
+			stamp:            Stamp{Expires: expires},
+			expectedContents: true,
+			expectedSidecar:  true,
+		},
+		"changed metadata": {
+			raw:             []byte("first"),
+			stamp:           Stamp{Expires: expires.Add(time.Hour)},
+			expectedSidecar: true,
+		},
+		"changed publication": {
+			raw:              []byte("first"),
+			stamp:            Stamp{Expires: expires, Publication: Publication{Versioned: true}},
+			expectedContents: true,
+			expectedSidecar:  true,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+
+			path, written, err := WriteRawAuthFile(dir, "ns", "image", []byte("first"), testIntegrityKey, Stamp{Expires: expires})
+			require.NoError(t, err)
+			require.True(t, written)
+
+			before, err := os.Lstat(path)
+			require.NoError(t, err)
+
+			sidecarBefore, err := os.Lstat(cpAuth.SidecarPath(path))
+			require.NoError(t, err)
+
+			_, written, err = WriteRawAuthFile(dir, "ns", "image", tc.raw, testIntegrityKey, tc.stamp)
+			require.NoError(t, err)
+			assert.True(t, written)
+
+			after, err := os.Lstat(path)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedContents, !os.SameFile(before, after))
+
+			sidecarAfter, err := os.Lstat(cpAuth.SidecarPath(path))
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedSidecar, !os.SameFile(sidecarBefore, sidecarAfter))
+
+			contents, err := os.ReadFile(path)
+			require.NoError(t, err)
+			assert.Equal(t, tc.raw, contents)
+
+			sidecar, err := cpAuth.ReadSidecar(path)
+			require.NoError(t, err)
+			assert.True(t, sidecar.Matches(tc.raw))
+			assert.True(t, tc.stamp.Expires.Equal(sidecar.Expires))
+		})
+	}
+}
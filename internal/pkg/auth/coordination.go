@@ -0,0 +1,156 @@
+package auth
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/k8s"
+	"github.com/cri-o/crio-credential-provider/pkg/auth"
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+)
+
+// coordinationFile is the file within an auth directory which is used to
+// serialize the writes of all processes and to hand out fencing tokens if the
+// directory is shared by multiple instances.
+const coordinationFile = ".coordination"
+
+// Stamp identifies a write into the auth directory. An empty owner disables
+// the coordination with other instances sharing the auth directory.
+type Stamp struct {
+	// Workload is the workload the write got requested by, if known.
+	Workload k8s.Workload
+
+	// Expires is the time after which the written auth file gets evicted by
+	// the retention. The zero value never expires.
+	Expires time.Time
+
+	// Owner identifies the writing instance.
+	Owner string
+
+	// Fence is the fencing token of the write, see NextFence.
+	Fence uint64
+
+	// Lock is the locking of the auth directory used for the write.
+	Lock Lock
+
+	// Publication is the way the written auth file gets published.
+	Publication Publication
+
+	// Naming is the naming of the written auth file.
+	Naming auth.Naming
+
+	// Merge is the conflict policy for merging the contents into the
+	// existing auth file, see the config.MergeConflict* constants. The
+	// existing auth file gets replaced if empty.
+	Merge string
+}
+
+// Lock configures the locking of an auth directory shared by multiple
+// instances.
+type Lock struct {
+	// Mode is the locking mechanism, one of the config.Lock* values. Empty
+	// defaults to flock.
+	Mode string
+
+	// LeaseTTL is the duration after which a lease of the lease lock gets
+	// considered stale.
+	LeaseTTL time.Duration
+}
+
+func (s Stamp) enabled() bool {
+	return s.Owner != ""
+}
+
+// NextFence returns a new fencing token for the auth directory dir. The
+// tokens increase monotonically across all instances sharing the directory,
+// which allows rejecting writes started before a more recent one.
+func NextFence(dir string, lock Lock) (uint64, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return 0, fmt.Errorf("ensure auth dir %q: %w", dir, err)
+	}
+
+	f, unlock, err := lockDir(dir, lock)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	raw, err := os.ReadFile(f.Name())
+	if err != nil {
+		return 0, fmt.Errorf("read fence: %w", err)
+	}
+
+	var fence uint64
+
+	if content := strings.TrimSpace(string(raw)); content != "" {
+		if fence, err = strconv.ParseUint(content, 10, 64); err != nil {
+			return 0, fmt.Errorf("parse fence: %w", err)
+		}
+	}
+
+	fence++
+
+	if err := f.Truncate(0); err != nil {
+		return 0, fmt.Errorf("truncate fence: %w", err)
+	}
+
+	if _, err := f.WriteAt([]byte(strconv.FormatUint(fence, 10)), 0); err != nil {
+		return 0, fmt.Errorf("write fence: %w", err)
+	}
+
+	return fence, nil
+}
+
+// ForeignOwner returns true if the auth file at path got written by another
+// owner than the provided one. Files without an owner are not foreign.
+func ForeignOwner(path, owner string) bool {
+	sidecar, err := auth.ReadSidecar(path)
+	if err != nil {
+		return false
+	}
+
+	return sidecar.Owner != "" && sidecar.Owner != owner
+}
+
+// fenced returns true if the existing auth file at path got written with a
+// more recent fencing token than the provided stamp.
+func fenced(path string, stamp Stamp) bool {
+	sidecar, err := auth.ReadSidecar(path)
+	if err != nil {
+		return false
+	}
+
+	return sidecar.Fence > stamp.Fence
+}
+
+// lockDir exclusively locks the coordination file of the auth directory by
+// using the configured locking mechanism. The returned function releases the
+// lock and closes the file.
+func lockDir(dir string, lock Lock) (*os.File, func(), error) {
+	f, err := os.OpenFile(filepath.Join(dir, coordinationFile), os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, nil, fmt.Errorf("open coordination file: %w", err)
+	}
+
+	var unlock func()
+
+	// The lock functions close the file on error
+	switch lock.Mode {
+	case config.LockFcntl:
+		unlock, err = lockFcntl(f)
+	case config.LockLease:
+		unlock, err = lockLease(f, lock.LeaseTTL)
+	default:
+		unlock, err = lockFlock(f)
+	}
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("lock auth dir: %w", err)
+	}
+
+	return f, unlock, nil
+}
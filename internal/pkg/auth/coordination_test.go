@@ -0,0 +1,209 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	cpAuth "github.com/cri-o/crio-credential-provider/pkg/auth"
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+	"github.com/cri-o/crio-credential-provider/pkg/docker"
+)
+
+func TestNextFence(t *testing.T) {
+	t.Parallel()
+
+	for _, mode := range []string{config.LockFlock, config.LockFcntl, config.LockLease} {
+		t.Run(mode, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			lock := Lock{Mode: mode, LeaseTTL: time.Minute}
+
+			for expected := range uint64(3) {
+				fence, err := NextFence(dir, lock)
+				require.NoError(t, err)
+				assert.Equal(t, expected+1, fence)
+			}
+
+			assert.NoFileExists(t, filepath.Join(dir, leaseFile))
+		})
+	}
+}
+
+func TestNextFenceConcurrent(t *testing.T) {
+	t.Parallel()
+
+	const writers = 20
+
+	for _, mode := range []string{config.LockFlock, config.LockFcntl, config.LockLease} {
+		t.Run(mode, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			lock := Lock{Mode: mode, LeaseTTL: time.Minute}
+
+			var (
+				wg     sync.WaitGroup
+				mu     sync.Mutex
+				fences = map[uint64]bool{}
+			)
+
+			for range writers {
+				wg.Go(func() {
+					fence, err := NextFence(dir, lock)
+					assert.NoError(t, err)
+
+					mu.Lock()
+					fences[fence] = true
+					mu.Unlock()
+				})
+			}
+
+			wg.Wait()
+
+			// Every fencing token must be handed out exactly once
+			assert.Len(t, fences, writers)
+			assert.True(t, fences[writers])
+		})
+	}
+}
+
+func TestNextFenceLeaseRecovery(t *testing.T) {
+	t.Parallel()
+
+	for name, tc := range map[string]struct {
+		expires   time.Time
+		recovered bool
+	}{
+		"success recovering stale lease": {
+			expires:   time.Now().Add(-time.Second),
+			recovered: true,
+		},
+		"success keeping held lease": {
+			expires: time.Now().Add(time.Hour),
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			path := filepath.Join(dir, leaseFile)
+
+			// Lease of a crashed or still running instance
+			raw, err := json.Marshal(lease{Holder: "other", Expires: tc.expires})
+			require.NoError(t, err)
+			require.NoError(t, os.WriteFile(path, raw, 0o600))
+
+			require.NoError(t, recoverStaleLease(path, time.Minute))
+
+			if !tc.recovered {
+				current, err := readLease(path, time.Minute)
+				require.NoError(t, err)
+				assert.Equal(t, "other", current.Holder)
+
+				return
+			}
+
+			assert.NoFileExists(t, path)
+
+			fence, err := NextFence(dir, Lock{Mode: config.LockLease, LeaseTTL: time.Minute})
+			require.NoError(t, err)
+			assert.Equal(t, uint64(1), fence)
+
+			entries, err := os.ReadDir(dir)
+			require.NoError(t, err)
+			assert.Len(t, entries, 1)
+		})
+	}
+}
+
+func TestNextFenceLeaseIncomplete(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, leaseFile)
+
+	// Lease which got created without being written by a crashed instance
+	require.NoError(t, os.WriteFile(path, nil, 0o600))
+
+	old := time.Now().Add(-time.Hour)
+	require.NoError(t, os.Chtimes(path, old, old))
+
+	fence, err := NextFence(dir, Lock{Mode: config.LockLease, LeaseTTL: time.Minute})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), fence)
+	assert.NoFileExists(t, path)
+}
+
+func TestWriteAuthFileCoordination(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	contents := docker.ConfigJSON{Auths: map[string]docker.AuthConfig{"quay.io": {Auth: "auth"}}}
+
+	write := func(stamp Stamp) (string, bool) {
+		path, written, err := writeAuthFile(dir, "image", "ns", contents, config.AuthFormatAuthJSON, testIntegrityKey, stamp)
+		require.NoError(t, err)
+
+		return path, written
+	}
+
+	path, written := write(Stamp{Owner: "a", Fence: 2})
+	assert.True(t, written)
+	assert.True(t, ForeignOwner(path, "b"))
+	assert.False(t, ForeignOwner(path, "a"))
+
+	// A write started before the existing one must not overwrite it
+	_, written = write(Stamp{Owner: "b", Fence: 1})
+	assert.False(t, written)
+	assert.True(t, ForeignOwner(path, "b"))
+
+	_, written = write(Stamp{Owner: "b", Fence: 3})
+	assert.True(t, written)
+	assert.True(t, ForeignOwner(path, "a"))
+
+	removed, err := RemoveNamespace(dir, "ns", "a")
+	require.NoError(t, err)
+	assert.Empty(t, removed)
+	assert.FileExists(t, path)
+
+	removed, err = RemoveNamespace(dir, "ns", "b")
+	require.NoError(t, err)
+	assert.Equal(t, []string{path}, removed)
+}
+
+func TestWriteAuthFileConcurrent(t *testing.T) {
+	t.Parallel()
+
+	const writers = 20
+
+	dir := t.TempDir()
+
+	var wg sync.WaitGroup
+
+	for i := range writers {
+		wg.Go(func() {
+			contents := docker.ConfigJSON{Auths: map[string]docker.AuthConfig{
+				"quay.io": {Auth: fmt.Sprintf("writer-%d", i)},
+			}}
+
+			_, written, err := writeAuthFile(dir, "image", "ns", contents, config.AuthFormatAuthJSON, testIntegrityKey, Stamp{})
+			assert.NoError(t, err)
+			assert.True(t, written)
+		})
+	}
+
+	wg.Wait()
+
+	// The sidecar has to match the auth file of the last write
+	_, err := cpAuth.Read(dir, "ns", "image", config.AuthFormatAuthJSON, testIntegrityKey)
+	require.NoError(t, err)
+}
@@ -0,0 +1,131 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/logger"
+	"github.com/cri-o/crio-credential-provider/pkg/docker"
+	"github.com/cri-o/crio-credential-provider/pkg/mirrors"
+)
+
+const (
+	// credHelperPrefix is the name prefix of the docker credential helper
+	// binaries, which get looked up in the PATH.
+	credHelperPrefix = "docker-credential-"
+
+	// credHelperTokenUsername is the username returned by credential helpers
+	// for identity tokens.
+	credHelperTokenUsername = "<token>"
+)
+
+var (
+	// credHelperName matches the plain helper names. Names containing a
+	// slash, like "x/../../bin/sh", would get executed as path relative to
+	// the working directory instead of being looked up in the PATH.
+	credHelperName = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+	errInvalidCredHelper = errors.New("invalid credential helper name")
+)
+
+// credHelperOutput is the output of the get command of a docker credential
+// helper.
+type credHelperOutput struct {
+	Username string `json:"Username"` //nolint:tagliatelle // defined by the credential helper protocol
+	Secret   string `json:"Secret"`   //nolint:tagliatelle // defined by the credential helper protocol
+}
+
+// inlineCredHelpers replaces the credHelpers of the global auth contents by
+// the credentials returned by their helpers, which only get invoked for the
+// registries of the allowed sources. The inlined credentials take precedence
+// over the auths of the same registry like in Docker. Failing helpers and
+// helpers not returning within the timeout get skipped, where a non positive
+// timeout only bounds them by ctx.
+func inlineCredHelpers(ctx context.Context, contents docker.ConfigJSON, sources []mirrors.Source, timeout time.Duration) docker.ConfigJSON {
+	if len(contents.CredHelpers) == 0 {
+		return contents
+	}
+
+	helpers := contents.CredHelpers
+	contents.CredHelpers = nil
+	contents.Auths = maps.Clone(contents.Auths)
+
+	if contents.Auths == nil {
+		contents.Auths = map[string]docker.AuthConfig{}
+	}
+
+	registries := []string{}
+
+	for i := range sources {
+		if sources[i].Allowed {
+			host, _, _ := strings.Cut(normalizeRegistry(sources[i].Location), "/")
+			registries = append(registries, host)
+		}
+	}
+
+	for _, registry := range slices.Sorted(maps.Keys(helpers)) {
+		if !slices.Contains(registries, normalizeRegistry(registry)) {
+			continue
+		}
+
+		entry, err := runCredHelper(ctx, helpers[registry], registry, timeout)
+		if err != nil {
+			logger.Warnf("Skipping credential helper of registry %q: %v", registry, err)
+
+			continue
+		}
+
+		logger.Debugf("Using credential helper %s%s for registry %q", credHelperPrefix, helpers[registry], registry)
+
+		contents.Auths[registry] = entry
+	}
+
+	return contents
+}
+
+// runCredHelper invokes the get command of the credential helper with the
+// suffix helper for the registry and returns its credentials.
+func runCredHelper(ctx context.Context, helper, registry string, timeout time.Duration) (docker.AuthConfig, error) {
+	if !credHelperName.MatchString(helper) {
+		return docker.AuthConfig{}, fmt.Errorf("%w: %q", errInvalidCredHelper, helper)
+	}
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, credHelperPrefix+helper, "get")
+	cmd.Stdin = strings.NewReader(registry)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return docker.AuthConfig{}, fmt.Errorf("run credential helper: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	output := credHelperOutput{}
+	if err := json.Unmarshal(stdout.Bytes(), &output); err != nil {
+		return docker.AuthConfig{}, fmt.Errorf("decode credential helper output: %w", err)
+	}
+
+	if output.Username == credHelperTokenUsername {
+		return docker.AuthConfig{IdentityToken: output.Secret}, nil
+	}
+
+	return docker.AuthConfig{Auth: base64.StdEncoding.EncodeToString([]byte(output.Username + ":" + output.Secret))}, nil
+}
@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cri-o/crio-credential-provider/pkg/docker"
+	"github.com/cri-o/crio-credential-provider/pkg/mirrors"
+)
+
+//nolint:paralleltest // modifies the PATH
+func TestInlineCredHelpers(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	for name, script := range map[string]string{
+		"test":  `read registry; echo "{\"ServerURL\":\"$registry\",\"Username\":\"user\",\"Secret\":\"$registry\"}"`,
+		"token": `echo '{"Username":"<token>","Secret":"refresh"}'`,
+		"fail":  `echo "credentials not found" >&2; exit 1`,
+		"slow":  `exec sleep 10`,
+	} {
+		path := filepath.Join(dir, credHelperPrefix+name)
+		require.NoError(t, os.WriteFile(path, []byte("#!/bin/sh\n"+script+"\n"), 0o700))
+	}
+
+	contents := inlineCredHelpers(t.Context(), docker.ConfigJSON{
+		Auths: map[string]docker.AuthConfig{
+			"global.local": {Auth: "global"},
+			"mirror.local": {Auth: "replaced"},
+		},
+		CredHelpers: map[string]string{
+			"mirror.local":     "test",
+			"token.local":      "token",
+			"fail.local":       "fail",
+			"slow.local":       "slow",
+			"rejected.local":   "test",
+			"unrelated.local":  "test",
+			"registry.local:5": "test",
+		},
+	}, []mirrors.Source{
+		{Location: "mirror.local/org", Mirror: true, Allowed: true},
+		{Location: "token.local", Mirror: true, Allowed: true},
+		{Location: "fail.local", Mirror: true, Allowed: true},
+		{Location: "slow.local", Mirror: true, Allowed: true},
+		{Location: "rejected.local", Mirror: true},
+		{Location: "registry.local:5/org", Allowed: true},
+	}, time.Second)
+
+	assert.Nil(t, contents.CredHelpers)
+	assert.Equal(t, map[string]docker.AuthConfig{
+		"global.local":     {Auth: "global"},
+		"mirror.local":     {Auth: base64.StdEncoding.EncodeToString([]byte("user:mirror.local"))},
+		"token.local":      {IdentityToken: "refresh"},
+		"registry.local:5": {Auth: base64.StdEncoding.EncodeToString([]byte("user:registry.local:5"))},
+	}, contents.Auths)
+}
+
+//nolint:paralleltest // modifies the working directory
+func TestRunCredHelperInvalidName(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+
+	// Names with a slash bypass the PATH and resolve relative to the working
+	// directory, like docker-credential-x/../escape
+	require.NoError(t, os.Mkdir(credHelperPrefix+"x", 0o700))
+	require.NoError(t, os.WriteFile("escape", []byte("#!/bin/sh\necho '{\"Username\":\"user\",\"Secret\":\"pass\"}'\n"), 0o700))
+
+	for _, helper := range []string{"x/../escape", "../escape", "/bin/sh", "", "helper name"} {
+		_, err := runCredHelper(t.Context(), helper, "mirror.local", time.Second)
+		require.ErrorIs(t, err, errInvalidCredHelper, helper)
+	}
+
+	contents := inlineCredHelpers(t.Context(), docker.ConfigJSON{
+		CredHelpers: map[string]string{"mirror.local": "x/../escape"},
+	}, []mirrors.Source{{Location: "mirror.local", Mirror: true, Allowed: true}}, time.Second)
+
+	assert.Empty(t, contents.Auths)
+}
@@ -0,0 +1,229 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/claims"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/errcode"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/logger"
+	"github.com/cri-o/crio-credential-provider/pkg/docker"
+	"github.com/cri-o/crio-credential-provider/pkg/reference"
+)
+
+const (
+	// defaultTokenLifetime is the lifetime of registry tokens without
+	// expires_in, see the distribution token authentication specification.
+	defaultTokenLifetime = time.Minute
+
+	// tokenMaxSize is the maximum size of a token response.
+	tokenMaxSize = 1 << 20
+
+	// dockerHubAPIHost is the host serving the registry API of Docker Hub.
+	dockerHubAPIHost = "registry-1.docker.io"
+)
+
+var (
+	errTokenAuthUnsupported = errcode.New(errcode.TokenAuthUnsupported, "registry does not support the token authentication")
+	errInsecureRealm        = errcode.New(errcode.InsecureRealm, "token realm is not served via HTTPS")
+	errNoToken              = errcode.New(errcode.NoRegistryToken, "token response contains no token")
+
+	challengeParam = regexp.MustCompile(`(\w+)="([^"]*)"`)
+)
+
+// tokenResponse is the response of the token endpoint of a registry.
+type tokenResponse struct {
+	Token       string `json:"token"`
+	AccessToken string `json:"access_token"` //nolint:tagliatelle // defined by the specification
+	ExpiresIn   int    `json:"expires_in"`   //nolint:tagliatelle // defined by the specification
+}
+
+// ExchangeTokens replaces the credentials of the registries matching the
+// patterns with registry tokens, which are scoped to pull the repositories of
+// the references. Failing exchanges keep the static credentials, because
+// pulls still succeed with them. It returns the earliest expiry of the
+// exchanged tokens, which is zero if none got exchanged. The client of a
+// registry location gets returned by client.
+func ExchangeTokens(ctx context.Context, client func(location string) *http.Client, contents docker.ConfigJSON, patterns, references []string, now time.Time) (docker.ConfigJSON, time.Time) {
+	res := docker.ConfigJSON{Auths: maps.Clone(contents.Auths)}
+
+	var expires time.Time
+
+	for _, key := range slices.Sorted(maps.Keys(contents.Auths)) {
+		entry := contents.Auths[key]
+		if entry.Auth == "" || !claims.MatchAny(patterns, key) {
+			continue
+		}
+
+		token, lifetime, err := exchangeToken(ctx, client(key), key, entry.Auth, references)
+		if err != nil {
+			logger.Warnf("Keeping static credentials of %s: %v", key, err)
+
+			continue
+		}
+
+		res.Auths[key] = docker.AuthConfig{RegistryToken: token}
+
+		if candidate := now.Add(lifetime); expires.IsZero() || candidate.Before(expires) {
+			expires = candidate
+		}
+
+		logger.Infof("Exchanged credentials of %s for a registry token valid for %s", key, lifetime)
+	}
+
+	return res, expires
+}
+
+// ExchangeIdentityToken requests a registry token for the registry location
+// by sending the service account token as password together with the
+// username, which allows registries federating the service account identity
+// to hand out tokens without any secret. It returns the token together with
+// its lifetime.
+func ExchangeIdentityToken(ctx context.Context, client *http.Client, location, username, token string, references []string) (string, time.Duration, error) {
+	credential := base64.StdEncoding.EncodeToString([]byte(username + ":" + token))
+
+	return exchangeToken(ctx, client, location, credential, references)
+}
+
+// exchangeToken requests a registry token for the auth entry with the key by
+// using the base64 encoded credential. The challenge of the registry API
+// provides the realm and service of the token endpoint.
+func exchangeToken(ctx context.Context, client *http.Client, key, credential string, references []string) (string, time.Duration, error) {
+	if _, name, ok := strings.Cut(key, "://"); ok {
+		key = name
+	}
+
+	host, _, _ := strings.Cut(key, "/")
+	if host == "docker.io" || host == "index.docker.io" {
+		host = dockerHubAPIHost
+	}
+
+	scopes := tokenScopes(key, references)
+	if len(scopes) == 0 {
+		return "", 0, fmt.Errorf("%w: no repository to scope the token to", errTokenAuthUnsupported)
+	}
+
+	realm, service, err := challenge(ctx, client, host)
+	if err != nil {
+		return "", 0, err
+	}
+
+	query := realm.Query()
+	if service != "" {
+		query.Set("service", service)
+	}
+
+	for _, scope := range scopes {
+		query.Add("scope", scope)
+	}
+
+	realm.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), http.NoBody)
+	if err != nil {
+		return "", 0, fmt.Errorf("create token request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Basic "+credential)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", 0, fmt.Errorf("request token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", 0, fmt.Errorf("request token: unexpected status %s", resp.Status)
+	}
+
+	token := tokenResponse{}
+	if err := json.NewDecoder(http.MaxBytesReader(nil, resp.Body, tokenMaxSize)).Decode(&token); err != nil {
+		return "", 0, fmt.Errorf("decode token response: %w", err)
+	}
+
+	value := token.Token
+	if value == "" {
+		value = token.AccessToken
+	}
+
+	if value == "" {
+		return "", 0, errNoToken
+	}
+
+	lifetime := defaultTokenLifetime
+	if token.ExpiresIn > 0 {
+		lifetime = time.Duration(token.ExpiresIn) * time.Second
+	}
+
+	return value, lifetime, nil
+}
+
+// challenge returns the realm and service of the bearer challenge of the
+// registry API.
+func challenge(ctx context.Context, client *http.Client, host string) (*url.URL, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://"+host+"/v2/", http.NoBody)
+	if err != nil {
+		return nil, "", fmt.Errorf("create registry API request: %w", err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("request registry API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	scheme, params, _ := strings.Cut(resp.Header.Get("WWW-Authenticate"), " ")
+	if resp.StatusCode != http.StatusUnauthorized || !strings.EqualFold(scheme, "Bearer") {
+		return nil, "", errTokenAuthUnsupported
+	}
+
+	values := map[string]string{}
+	for _, match := range challengeParam.FindAllStringSubmatch(params, -1) {
+		values[strings.ToLower(match[1])] = match[2]
+	}
+
+	realm, err := url.Parse(values["realm"])
+	if err != nil {
+		return nil, "", fmt.Errorf("parse token realm: %w", err)
+	}
+
+	// The credentials must not leave the node unencrypted
+	if realm.Scheme != "https" {
+		return nil, "", fmt.Errorf("%w: %q", errInsecureRealm, values["realm"])
+	}
+
+	return realm, values["service"], nil
+}
+
+// tokenScopes returns the pull scopes of the repositories of the references
+// the auth entry with the key applies to.
+func tokenScopes(key string, references []string) []string {
+	scopes := []string{}
+
+	for _, ref := range references {
+		if !claims.Match(key, ref) {
+			continue
+		}
+
+		parsed, err := reference.Parse(ref)
+		if err != nil {
+			continue
+		}
+
+		scope := "repository:" + strings.TrimPrefix(parsed.Name(), parsed.Domain()+"/") + ":pull"
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	return scopes
+}
@@ -0,0 +1,126 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cri-o/crio-credential-provider/pkg/docker"
+)
+
+func TestExchangeTokens(t *testing.T) {
+	t.Parallel()
+
+	var server *httptest.Server
+
+	server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/":
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+server.URL+`/token",service="registry.example.com"`)
+			w.WriteHeader(http.StatusUnauthorized)
+
+		case "/token":
+			assert.Equal(t, "Basic "+testValidAuth, r.Header.Get("Authorization"))
+			assert.Equal(t, "registry.example.com", r.URL.Query().Get("service"))
+			assert.Equal(t, []string{"repository:org/app:pull"}, r.URL.Query()["scope"])
+
+			_, err := w.Write([]byte(`{"token":"short-lived","expires_in":300}`))
+			assert.NoError(t, err)
+
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	host := strings.TrimPrefix(server.URL, "https://")
+	now := time.Now()
+
+	contents := docker.ConfigJSON{Auths: map[string]docker.AuthConfig{
+		host:          {Auth: testValidAuth},
+		"quay.io":     {Auth: testValidAuth},
+		"ghcr.io/org": {Auth: testValidAuth},
+	}}
+
+	exchanged, expires := ExchangeTokens(t.Context(), func(string) *http.Client { return server.Client() }, contents, []string{host, "ghcr.io"}, []string{host + "/org/app:latest", "quay.io/org/app:latest"}, now)
+
+	assert.Equal(t, docker.AuthConfig{RegistryToken: "short-lived"}, exchanged.Auths[host])
+	assert.True(t, now.Add(5*time.Minute).Equal(expires))
+
+	// Not matching any pattern
+	assert.Equal(t, docker.AuthConfig{Auth: testValidAuth}, exchanged.Auths["quay.io"])
+
+	// No reference to scope the token to
+	assert.Equal(t, docker.AuthConfig{Auth: testValidAuth}, exchanged.Auths["ghcr.io/org"])
+
+	// The provided contents stay unchanged
+	assert.Equal(t, docker.AuthConfig{Auth: testValidAuth}, contents.Auths[host])
+}
+
+func TestExchangeTokensUnsupported(t *testing.T) {
+	t.Parallel()
+
+	for name, challenge := range map[string]string{
+		"basic authentication": `Basic realm="registry"`,
+		"insecure realm":       `Bearer realm="http://auth.example.com/token"`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "/v2/", r.URL.Path)
+
+				w.Header().Set("WWW-Authenticate", challenge)
+				w.WriteHeader(http.StatusUnauthorized)
+			}))
+			t.Cleanup(server.Close)
+
+			host := strings.TrimPrefix(server.URL, "https://")
+			contents := docker.ConfigJSON{Auths: map[string]docker.AuthConfig{host: {Auth: testValidAuth}}}
+
+			exchanged, expires := ExchangeTokens(t.Context(), func(string) *http.Client { return server.Client() }, contents, []string{host}, []string{host + "/org/app"}, time.Now())
+			assert.Equal(t, contents, exchanged)
+			assert.True(t, expires.IsZero())
+		})
+	}
+}
+
+func TestExchangeIdentityToken(t *testing.T) {
+	t.Parallel()
+
+	var server *httptest.Server
+
+	server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/":
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+server.URL+`/token"`)
+			w.WriteHeader(http.StatusUnauthorized)
+
+		case "/token":
+			username, password, ok := r.BasicAuth()
+			assert.True(t, ok)
+			assert.Equal(t, "org+robot", username)
+			assert.Equal(t, "sa-token", password)
+			assert.Equal(t, []string{"repository:org/app:pull"}, r.URL.Query()["scope"])
+
+			_, err := w.Write([]byte(`{"access_token":"federated"}`))
+			assert.NoError(t, err)
+
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	host := strings.TrimPrefix(server.URL, "https://")
+
+	token, lifetime, err := ExchangeIdentityToken(t.Context(), server.Client(), host+"/org", "org+robot", "sa-token", []string{host + "/org/app:latest"})
+	require.NoError(t, err)
+	assert.Equal(t, "federated", token)
+	assert.Equal(t, defaultTokenLifetime, lifetime)
+}
@@ -0,0 +1,126 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+	"github.com/cri-o/crio-credential-provider/pkg/docker"
+)
+
+// encodeAuthFile encodes the auth file contents into the provided format,
+// including the format specific normalization of the registry keys.
+func encodeAuthFile(format string, contents docker.ConfigJSON) ([]byte, error) {
+	switch format {
+	case "", config.AuthFormatAuthJSON:
+		return encodeJSON(contents)
+
+	case config.AuthFormatDocker:
+		return encodeJSON(docker.ConfigJSON{Auths: hostAuths(contents.Auths, dockerHubKey)})
+
+	case config.AuthFormatContainerd:
+		return encodeContainerd(contents)
+
+	default:
+		return nil, fmt.Errorf("%w: %q", config.ErrUnknownAuthFormat, format)
+	}
+}
+
+func encodeJSON(contents docker.ConfigJSON) ([]byte, error) {
+	raw, err := json.MarshalIndent(contents, "", "\t")
+	if err != nil {
+		return nil, fmt.Errorf("encode JSON: %w", err)
+	}
+
+	return append(raw, '\n'), nil
+}
+
+// encodeContainerd encodes the contents as containerd CRI registry
+// configuration, which can be used as drop-in config file.
+func encodeContainerd(contents docker.ConfigJSON) ([]byte, error) {
+	configs := map[string]any{}
+	for host, auth := range hostAuths(contents.Auths, containerdDockerHubKey) {
+		entry := map[string]string{"auth": auth.Auth}
+		if auth.IdentityToken != "" {
+			entry["identitytoken"] = auth.IdentityToken
+		}
+
+		configs[host] = map[string]any{"auth": entry}
+	}
+
+	tree := map[string]any{
+		"plugins": map[string]any{
+			"io.containerd.grpc.v1.cri": map[string]any{
+				"registry": map[string]any{"configs": configs},
+			},
+		},
+	}
+
+	buf := &bytes.Buffer{}
+	if err := toml.NewEncoder(buf).Encode(tree); err != nil {
+		return nil, fmt.Errorf("encode TOML: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// formatKey returns the registry key of the auth entry within the auth file
+// of the provided format, where Docker Hub is "docker.io".
+func formatKey(format, key string) string {
+	switch format {
+	case config.AuthFormatDocker, config.AuthFormatContainerd:
+		host, _, _ := strings.Cut(key, "/")
+
+		switch host {
+		case "index.docker.io", "registry-1.docker.io":
+			return "docker.io"
+		}
+
+		return host
+
+	default:
+		return key
+	}
+}
+
+const (
+	dockerHubKey           = "https://index.docker.io/v1/"
+	containerdDockerHubKey = "registry-1.docker.io"
+)
+
+// hostAuths reduces the auth keys to registry hosts, because the docker and
+// containerd formats do not support repository scoped credentials. Docker Hub
+// entries get replaced by the provided key. An entry for the plain host takes
+// precedence over repository scoped ones.
+func hostAuths(auths map[string]docker.AuthConfig, dockerHub string) map[string]docker.AuthConfig {
+	res := make(map[string]docker.AuthConfig, len(auths))
+	exact := map[string]bool{}
+
+	for _, key := range slices.Sorted(maps.Keys(auths)) {
+		host, _, hasPath := strings.Cut(key, "/")
+
+		switch host {
+		case "docker.io", "index.docker.io", "registry-1.docker.io":
+			host = dockerHub
+		}
+
+		if exact[host] {
+			continue
+		}
+
+		if _, ok := res[host]; ok && hasPath {
+			continue
+		}
+
+		res[host] = auths[key]
+		exact[host] = !hasPath
+	}
+
+	return res
+}
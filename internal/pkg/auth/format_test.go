@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+	"github.com/cri-o/crio-credential-provider/pkg/docker"
+)
+
+func TestEncodeAuthFile(t *testing.T) {
+	t.Parallel()
+
+	contents := docker.ConfigJSON{Auths: map[string]docker.AuthConfig{
+		"docker.io":         {Auth: "hub"},
+		"quay.io/org/app":   {Auth: "repo"},
+		"quay.io":           {Auth: "host", IdentityToken: "refresh"},
+		"localhost:5000/ns": {Auth: "local"},
+	}}
+
+	for name, tc := range map[string]struct {
+		format, expected, expectedErr string
+	}{
+		"auth.json": {
+			format: config.AuthFormatAuthJSON,
+			expected: `{
+	"auths": {
+		"docker.io": {
+			"auth": "hub"
+		},
+		"localhost:5000/ns": {
+			"auth": "local"
+		},
+		"quay.io": {
+			"auth": "host",
+			"identitytoken": "refresh"
+		},
+		"quay.io/org/app": {
+			"auth": "repo"
+		}
+	}
+}
+`,
+		},
+		"docker": {
+			format: config.AuthFormatDocker,
+			expected: `{
+	"auths": {
+		"https://index.docker.io/v1/": {
+			"auth": "hub"
+		},
+		"localhost:5000": {
+			"auth": "local"
+		},
+		"quay.io": {
+			"auth": "host",
+			"identitytoken": "refresh"
+		}
+	}
+}
+`,
+		},
+		"containerd": {
+			format: config.AuthFormatContainerd,
+			expected: `[plugins]
+  [plugins."io.containerd.grpc.v1.cri"]
+    [plugins."io.containerd.grpc.v1.cri".registry]
+      [plugins."io.containerd.grpc.v1.cri".registry.configs]
+        [plugins."io.containerd.grpc.v1.cri".registry.configs."localhost:5000"]
+          [plugins."io.containerd.grpc.v1.cri".registry.configs."localhost:5000".auth]
+            auth = "local"
+        [plugins."io.containerd.grpc.v1.cri".registry.configs."quay.io"]
+          [plugins."io.containerd.grpc.v1.cri".registry.configs."quay.io".auth]
+            auth = "host"
+            identitytoken = "refresh"
+        [plugins."io.containerd.grpc.v1.cri".registry.configs."registry-1.docker.io"]
+          [plugins."io.containerd.grpc.v1.cri".registry.configs."registry-1.docker.io".auth]
+            auth = "hub"
+`,
+		},
+		"unknown": {
+			format:      "wrong",
+			expectedErr: `unknown auth format: "wrong"`,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			raw, err := encodeAuthFile(tc.format, contents)
+			if tc.expectedErr != "" {
+				require.EqualError(t, err, tc.expectedErr)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, string(raw))
+		})
+	}
+}
+
+func TestHostAuths(t *testing.T) {
+	t.Parallel()
+
+	res := hostAuths(map[string]docker.AuthConfig{
+		"quay.io/a":       {Auth: "a"},
+		"quay.io/b":       {Auth: "b"},
+		"index.docker.io": {Auth: "hub"},
+	}, dockerHubKey)
+
+	assert.Equal(t, map[string]docker.AuthConfig{
+		"quay.io":    {Auth: "a"},
+		dockerHubKey: {Auth: "hub"},
+	}, res)
+}
@@ -0,0 +1,229 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/logger"
+)
+
+const (
+	// leaseFile is the lease file within a shared auth directory used by the
+	// lease lock.
+	leaseFile = ".coordination.lease"
+
+	// leaseRetryInterval is the interval between the attempts to acquire a
+	// lease held by another instance.
+	leaseRetryInterval = 50 * time.Millisecond
+)
+
+// fcntlMutexes serializes the fcntl locks within this process by the path of
+// the coordination file, because POSIX record locks are held per process
+// and get released by closing any file descriptor of the file.
+var fcntlMutexes sync.Map
+
+// lease is the content of a lease file.
+type lease struct {
+	// Holder identifies the instance holding the lease.
+	Holder string `json:"holder"`
+
+	// Expires is the time after which the lease is considered stale.
+	Expires time.Time `json:"expires"`
+}
+
+func lockFlock(f *os.File) (func(), error) {
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		_ = f.Close()
+
+		return nil, fmt.Errorf("flock: %w", err)
+	}
+
+	return func() {
+		_ = syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		_ = f.Close()
+	}, nil
+}
+
+func lockFcntl(f *os.File) (func(), error) {
+	value, _ := fcntlMutexes.LoadOrStore(f.Name(), &sync.Mutex{})
+	mu, _ := value.(*sync.Mutex)
+	mu.Lock()
+
+	lk := syscall.Flock_t{Type: syscall.F_WRLCK, Whence: io.SeekStart}
+	if err := syscall.FcntlFlock(f.Fd(), syscall.F_SETLKW, &lk); err != nil {
+		_ = f.Close()
+
+		mu.Unlock()
+
+		return nil, fmt.Errorf("fcntl: %w", err)
+	}
+
+	return func() {
+		lk.Type = syscall.F_UNLCK
+		_ = syscall.FcntlFlock(f.Fd(), syscall.F_SETLK, &lk)
+		_ = f.Close()
+
+		mu.Unlock()
+	}, nil
+}
+
+// lockLease acquires the lease file next to the coordination file f. Leases
+// of other instances get waited for until they expire, which recovers the
+// leases of crashed holders.
+func lockLease(f *os.File, ttl time.Duration) (func(), error) {
+	path := filepath.Join(filepath.Dir(f.Name()), leaseFile)
+	holder := rand.Text()
+
+	for {
+		acquired, err := createLease(path, holder, ttl)
+		if err != nil {
+			_ = f.Close()
+
+			return nil, err
+		}
+
+		if acquired {
+			break
+		}
+
+		if err := recoverStaleLease(path, ttl); err != nil {
+			_ = f.Close()
+
+			return nil, err
+		}
+
+		time.Sleep(leaseRetryInterval)
+	}
+
+	return func() {
+		releaseLease(path, holder)
+		_ = f.Close()
+	}, nil
+}
+
+// createLease exclusively creates the lease file at path and returns false if
+// it is already held by another instance.
+func createLease(path, holder string, ttl time.Duration) (bool, error) {
+	raw, err := json.Marshal(lease{Holder: holder, Expires: time.Now().Add(ttl)})
+	if err != nil {
+		return false, fmt.Errorf("marshal lease: %w", err)
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		if os.IsExist(err) {
+			return false, nil
+		}
+
+		return false, fmt.Errorf("create lease: %w", err)
+	}
+
+	if _, err := f.Write(raw); err != nil {
+		_ = f.Close()
+		_ = os.Remove(path)
+
+		return false, fmt.Errorf("write lease: %w", err)
+	}
+
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		_ = os.Remove(path)
+
+		return false, fmt.Errorf("sync lease: %w", err)
+	}
+
+	if err := f.Close(); err != nil {
+		_ = os.Remove(path)
+
+		return false, fmt.Errorf("close lease: %w", err)
+	}
+
+	return true, nil
+}
+
+// recoverStaleLease removes the lease file at path if it is expired. The
+// lease gets renamed before, which ensures that only one of multiple
+// recovering instances succeeds. A lease acquired by another instance in
+// the meantime gets restored.
+func recoverStaleLease(path string, ttl time.Duration) error {
+	stale, err := readLease(path, ttl)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+
+		return err
+	}
+
+	if time.Now().Before(stale.Expires) {
+		return nil
+	}
+
+	recovered := fmt.Sprintf("%s.%s", path, rand.Text())
+	if err := os.Rename(path, recovered); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return fmt.Errorf("rename stale lease: %w", err)
+	}
+
+	defer os.Remove(recovered) //nolint:errcheck // best effort cleanup
+
+	if current, err := readLease(recovered, ttl); err == nil && time.Now().Before(current.Expires) {
+		if err := os.Link(recovered, path); err != nil && !os.IsExist(err) {
+			return fmt.Errorf("restore lease: %w", err)
+		}
+
+		return nil
+	}
+
+	logger.Warnf("Recovered stale lease of %s held by %s, expired at %s", filepath.Dir(path), stale.Holder, stale.Expires.Format(time.RFC3339))
+
+	return nil
+}
+
+// readLease reads the lease file at path. Leases which have not been written
+// completely expire after the ttl since their modification.
+func readLease(path string, ttl time.Duration) (*lease, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("stat lease: %w", err)
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read lease: %w", err)
+	}
+
+	l := &lease{}
+	if err := json.Unmarshal(raw, l); err != nil || l.Expires.IsZero() {
+		return &lease{Expires: info.ModTime().Add(ttl)}, nil
+	}
+
+	return l, nil
+}
+
+// releaseLease removes the lease file at path if it is still held by the
+// holder, which is not the case if it got recovered as stale by another
+// instance.
+func releaseLease(path, holder string) {
+	l, err := readLease(path, 0)
+	if err != nil || l.Holder != holder {
+		logger.Warnf("Lease of %s got lost before releasing it", filepath.Dir(path))
+
+		return
+	}
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		logger.Warnf("Unable to release lease of %s: %v", filepath.Dir(path), err)
+	}
+}
@@ -0,0 +1,247 @@
+package auth
+
+import (
+	"fmt"
+	"net/netip"
+	"path"
+	"strings"
+
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+	"github.com/cri-o/crio-credential-provider/pkg/reference"
+)
+
+// matcher decides whether a registry entry of a secret applies to the
+// requested image or one of its mirrors.
+type matcher interface {
+	// image returns the auth file key and the specificity of the registry
+	// entry if it applies to the requested image.
+	image(registry string) (string, int, bool)
+
+	// mirror returns the auth file key and the specificity of the registry
+	// entry if it applies to the mirror location.
+	mirror(registry, mirror string) (string, int, bool)
+
+	// name returns the image name the registry entries get matched against.
+	name() string
+}
+
+// defaultPorts are the ports implied by the registry schemes, which get
+// stripped before matching.
+var defaultPorts = []string{"443", "80"}
+
+// ipv6Placeholder replaces IPv6 literal hosts while parsing image references,
+// because the reference grammar does not support them.
+const ipv6Placeholder = "ipv6.invalid"
+
+// splitHost splits the registry host into its hostname and port. Bracketed
+// IPv6 literals like "[fd00::1]:5000" keep their brackets, while unbracketed
+// IPv6 literals never contain a port.
+func splitHost(host string) (string, string) {
+	if strings.HasPrefix(host, "[") {
+		end := strings.Index(host, "]")
+		if end == -1 {
+			return host, ""
+		}
+
+		return host[:end+1], strings.TrimPrefix(host[end+1:], ":")
+	}
+
+	if strings.Count(host, ":") == 1 {
+		hostname, port, _ := strings.Cut(host, ":")
+
+		return hostname, port
+	}
+
+	return host, ""
+}
+
+// joinHost joins the hostname and port of a registry host. IPv6 literals get
+// bracketed and canonicalized, which makes different notations of the same
+// address comparable.
+func joinHost(hostname, port string) string {
+	if addr, err := netip.ParseAddr(strings.TrimSuffix(strings.TrimPrefix(hostname, "["), "]")); err == nil && addr.Is6() {
+		hostname = "[" + addr.String() + "]"
+	}
+
+	if port == "" {
+		return hostname
+	}
+
+	return hostname + ":" + port
+}
+
+// globPrefix is the prefix of registry entries matching any subdomain, like
+// "*.internal.example.com".
+const globPrefix = "*."
+
+// expandGlob returns the concrete registry entry of a glob entry for the
+// provided image name or mirror location, which replaces the glob with the
+// host of the name. The host has to be a subdomain of the glob domain. Entries
+// without a glob are returned as they are.
+func expandGlob(registry, name string) (string, bool) {
+	glob, ok := strings.CutPrefix(registry, globPrefix)
+	if !ok {
+		return registry, true
+	}
+
+	domain, rest, _ := strings.Cut(glob, "/")
+	host, _, _ := strings.Cut(name, "/")
+
+	if domain == "" || !strings.HasSuffix(host, "."+domain) {
+		return "", false
+	}
+
+	if rest != "" {
+		return host + "/" + rest, true
+	}
+
+	return host, true
+}
+
+func newMatcher(mode, image string) (matcher, error) {
+	switch mode {
+	case "", config.SecretMatchingPrefix:
+		return &prefixMatcher{ref: image}, nil
+
+	case config.SecretMatchingReference:
+		return newReferenceMatcher(image)
+
+	default:
+		return nil, fmt.Errorf("%w: %q", config.ErrUnknownSecretMatching, mode)
+	}
+}
+
+// prefixMatcher matches the registry entries as plain string prefixes of the
+// normalized image and mirrors.
+type prefixMatcher struct {
+	ref string
+}
+
+func (m *prefixMatcher) image(registry string) (string, int, bool) {
+	return restoreHost(registry, m.ref), 0, strings.HasPrefix(m.name(), registry)
+}
+
+func (m *prefixMatcher) mirror(registry, mirror string) (string, int, bool) {
+	return restoreHost(registry, mirror), 0, strings.HasPrefix(normalizeRegistry(mirror), registry)
+}
+
+func (m *prefixMatcher) name() string {
+	return normalizeRegistry(m.ref)
+}
+
+// referenceMatcher matches the registry entries against the normalized image
+// reference. Entries can be scoped to a registry host, a repository namespace,
+// a full repository or even tags and digests of a repository, like
+// "quay.io/org/app:release-*" or "quay.io/org/app@sha256:…".
+type referenceMatcher struct {
+	// location is the image name before normalizing the registry host.
+	location string
+
+	imageName, tag, digest string
+}
+
+func newReferenceMatcher(image string) (*referenceMatcher, error) {
+	// The reference grammar does not support IPv6 literal hosts
+	parsed, ipv6Host := image, ""
+
+	if host, rest, ok := strings.Cut(image, "/"); ok && strings.HasPrefix(host, "[") {
+		hostname, port := splitHost(host)
+		ipv6Host = hostname
+		parsed = joinHost(ipv6Placeholder, port) + "/" + rest
+	}
+
+	ref, err := reference.Parse(parsed)
+	if err != nil {
+		return nil, fmt.Errorf("parse image reference %q: %w", image, err)
+	}
+
+	location := ref.Name()
+	if ipv6Host != "" {
+		location = ipv6Host + strings.TrimPrefix(location, ipv6Placeholder)
+	}
+
+	return &referenceMatcher{
+		location:  location,
+		imageName: normalizeRegistry(location),
+		tag:       ref.Tag(),
+		digest:    ref.Digest(),
+	}, nil
+}
+
+func (m *referenceMatcher) image(registry string) (string, int, bool) {
+	key, specificity, ok := m.match(registry, m.imageName)
+
+	return restoreHost(key, m.location), specificity, ok
+}
+
+func (m *referenceMatcher) name() string {
+	return m.imageName
+}
+
+// mirror matches the entry against the mirror location, which gets treated
+// like a repository namespace of the image.
+func (m *referenceMatcher) mirror(registry, mirror string) (string, int, bool) {
+	key, specificity, ok := m.match(registry, normalizeRegistry(mirror))
+
+	return restoreHost(key, mirror), specificity, ok
+}
+
+func (m *referenceMatcher) match(registry, name string) (string, int, bool) {
+	repo, tagPattern, digest := splitRegistryEntry(registry)
+
+	switch {
+	case digest != "":
+		return repo, len(registry), repo == name && digest == m.digest
+
+	case tagPattern != "":
+		matched, err := path.Match(tagPattern, m.tag)
+
+		return repo, len(registry), repo == name && err == nil && matched
+	}
+
+	return repo, len(repo), name == repo || strings.HasPrefix(name, repo+"/")
+}
+
+// splitRegistryEntry splits a registry entry of a secret into its repository,
+// tag pattern and digest parts.
+func splitRegistryEntry(registry string) (string, string, string) {
+	registry = strings.TrimSuffix(registry, "/")
+
+	if repo, digest, ok := strings.Cut(registry, "@"); ok {
+		return repo, "", digest
+	}
+
+	lastSlash := strings.LastIndex(registry, "/")
+	if lastSlash == -1 {
+		// A colon without any path separator is a port
+		return registry, "", ""
+	}
+
+	if i := strings.LastIndex(registry, ":"); i > lastSlash {
+		return registry[:i], registry[i+1:], ""
+	}
+
+	return registry, "", ""
+}
+
+// scopedMatcher scopes the auth file keys of the mirror matches to the path
+// of the mirror location, like "mirror.example.com/org" instead of
+// "mirror.example.com" for a host wide secret entry. More specific entries
+// keep their key.
+type scopedMatcher struct {
+	matcher
+}
+
+func (m *scopedMatcher) mirror(registry, mirror string) (string, int, bool) {
+	key, specificity, ok := m.matcher.mirror(registry, mirror)
+	if !ok {
+		return key, specificity, ok
+	}
+
+	location := stripScheme(mirror)
+	if !strings.HasPrefix(normalizeRegistry(location), normalizeRegistry(key)+"/") {
+		return key, specificity, ok
+	}
+
+	return location, specificity, ok
+}
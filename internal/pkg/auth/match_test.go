@@ -0,0 +1,315 @@
+package auth
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+	"github.com/cri-o/crio-credential-provider/pkg/docker"
+)
+
+const testDigest = "baee713fe56d0f5189067a1126374bc39cd8bbca1cd980322f0c8596cd400826"
+
+func TestReferenceMatcher(t *testing.T) {
+	t.Parallel()
+
+	for name, tc := range map[string]struct {
+		image, registry, mirror string
+		expectedKey             string
+		expectedMatch           bool
+	}{
+		"host": {
+			image:         "quay.io/org/app:v1",
+			registry:      "quay.io",
+			expectedKey:   "quay.io",
+			expectedMatch: true,
+		},
+		"host with port": {
+			image:         "localhost:5000/app",
+			registry:      "localhost:5000",
+			expectedKey:   "localhost:5000",
+			expectedMatch: true,
+		},
+		"namespace": {
+			image:         "quay.io/org/app:v1",
+			registry:      "quay.io/org",
+			expectedKey:   "quay.io/org",
+			expectedMatch: true,
+		},
+		"namespace without path boundary": {
+			image:       "quay.io/organization/app:v1",
+			registry:    "quay.io/org",
+			expectedKey: "quay.io/org",
+		},
+		"normalized docker hub image": {
+			image:         "nginx",
+			registry:      "docker.io/library/nginx",
+			expectedKey:   "docker.io/library/nginx",
+			expectedMatch: true,
+		},
+		"tag pattern": {
+			image:         "quay.io/org/app:release-1.0",
+			registry:      "quay.io/org/app:release-*",
+			expectedKey:   "quay.io/org/app",
+			expectedMatch: true,
+		},
+		"tag pattern mismatch": {
+			image:       "quay.io/org/app:latest",
+			registry:    "quay.io/org/app:release-*",
+			expectedKey: "quay.io/org/app",
+		},
+		"tag pattern on implicit latest tag": {
+			image:         "quay.io/org/app",
+			registry:      "quay.io/org/app:latest",
+			expectedKey:   "quay.io/org/app",
+			expectedMatch: true,
+		},
+		"tag pattern requires full repository": {
+			image:       "quay.io/org/app:release-1.0",
+			registry:    "quay.io/org:release-*",
+			expectedKey: "quay.io/org",
+		},
+		"digest": {
+			image:         "quay.io/org/app@sha256:" + testDigest,
+			registry:      "quay.io/org/app@sha256:" + testDigest,
+			expectedKey:   "quay.io/org/app",
+			expectedMatch: true,
+		},
+		"digest mismatch": {
+			image:       "quay.io/org/app:v1",
+			registry:    "quay.io/org/app@sha256:" + testDigest,
+			expectedKey: "quay.io/org/app",
+		},
+		"mirror namespace": {
+			image:         "quay.io/org/app:v1",
+			registry:      "mirror.local",
+			mirror:        "mirror.local/quay",
+			expectedKey:   "mirror.local",
+			expectedMatch: true,
+		},
+		"mirror tag pattern": {
+			image:         "quay.io/org/app:release-1",
+			registry:      "mirror.local/app:release-*",
+			mirror:        "mirror.local/app",
+			expectedKey:   "mirror.local/app",
+			expectedMatch: true,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			m, err := newMatcher(config.SecretMatchingReference, tc.image)
+			require.NoError(t, err)
+
+			var (
+				key   string
+				match bool
+			)
+
+			if tc.mirror != "" {
+				key, _, match = m.mirror(tc.registry, tc.mirror)
+			} else {
+				key, _, match = m.image(tc.registry)
+			}
+
+			assert.Equal(t, tc.expectedKey, key)
+			assert.Equal(t, tc.expectedMatch, match)
+		})
+	}
+}
+
+func TestNewMatcherErrors(t *testing.T) {
+	t.Parallel()
+
+	_, err := newMatcher("unknown", "quay.io/org/app")
+	require.ErrorIs(t, err, config.ErrUnknownSecretMatching)
+
+	_, err = newMatcher(config.SecretMatchingReference, "Invalid:Image")
+	require.Error(t, err)
+}
+
+func TestUpdateAuthContentsReferenceSpecificity(t *testing.T) {
+	t.Parallel()
+
+	repoAuth := base64.StdEncoding.EncodeToString([]byte("repo:pass"))
+	tagAuth := base64.StdEncoding.EncodeToString([]byte("tag:pass"))
+
+	secrets := buildSecretList(t, repoAuth, []string{"quay.io/org/app"})
+	secrets.Items = append(secrets.Items, buildSecretList(t, tagAuth, []string{"quay.io/org/app:release-*"}).Items...)
+	secrets.Items[1].Name = "tag-secret"
+
+	for _, image := range []string{"quay.io/org/app:release-1", "quay.io/org/app:latest"} {
+		m, err := newMatcher(config.SecretMatchingReference, image)
+		require.NoError(t, err)
+
+		contents, _ := updateAuthContents(secrets, docker.ConfigJSON{}, m, nil, true)
+		require.Len(t, contents.Auths, 1)
+
+		expected := repoAuth
+		if image == "quay.io/org/app:release-1" {
+			expected = tagAuth
+		}
+
+		assert.Equal(t, expected, contents.Auths["quay.io/org/app"].Auth, image)
+	}
+}
+
+func TestExpandGlob(t *testing.T) {
+	t.Parallel()
+
+	for name, tc := range map[string]struct {
+		registry, name, expected string
+		expectedMatch            bool
+	}{
+		"no glob": {
+			registry:      "quay.io",
+			name:          "docker.io/library/nginx",
+			expected:      "quay.io",
+			expectedMatch: true,
+		},
+		"subdomain": {
+			registry:      "*.internal.example.com",
+			name:          "mirror.internal.example.com/org/app",
+			expected:      "mirror.internal.example.com",
+			expectedMatch: true,
+		},
+		"nested subdomain with path": {
+			registry:      "*.example.com/org",
+			name:          "a.b.example.com/org/app",
+			expected:      "a.b.example.com/org",
+			expectedMatch: true,
+		},
+		"domain itself": {
+			registry: "*.example.com",
+			name:     "example.com/org/app",
+		},
+		"other domain": {
+			registry: "*.example.com",
+			name:     "mirror.example.org/org/app",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			res, ok := expandGlob(tc.registry, tc.name)
+			assert.Equal(t, tc.expectedMatch, ok)
+			assert.Equal(t, tc.expected, res)
+		})
+	}
+}
+
+func TestUpdateAuthContentsGlob(t *testing.T) {
+	t.Parallel()
+
+	globAuth := base64.StdEncoding.EncodeToString([]byte("glob:pass"))
+	exactAuth := base64.StdEncoding.EncodeToString([]byte("exact:pass"))
+
+	secrets := buildSecretList(t, globAuth, []string{"*.internal.example.com"})
+	secrets.Items = append(secrets.Items, buildSecretList(t, exactAuth, []string{"b.internal.example.com"}).Items...)
+	secrets.Items[1].Name = "exact-secret"
+
+	mirrors := []string{"a.internal.example.com/org", "b.internal.example.com/org", "mirror.example.org/org"}
+
+	for _, mode := range []string{config.SecretMatchingPrefix, config.SecretMatchingReference} {
+		m, err := newMatcher(mode, "c.internal.example.com/org/app")
+		require.NoError(t, err)
+
+		contents, used := updateAuthContents(secrets, docker.ConfigJSON{}, m, mirrors, true)
+		assert.Len(t, used, 2, mode)
+		assert.Equal(t, map[string]docker.AuthConfig{
+			"a.internal.example.com": {Auth: globAuth},
+			"b.internal.example.com": {Auth: exactAuth},
+			"c.internal.example.com": {Auth: globAuth},
+		}, contents.Auths, mode)
+	}
+}
+
+func TestUpdateAuthContentsScopedMirrors(t *testing.T) {
+	t.Parallel()
+
+	hostAuth := base64.StdEncoding.EncodeToString([]byte("host:pass"))
+	repoAuth := base64.StdEncoding.EncodeToString([]byte("repo:pass"))
+
+	secrets := buildSecretList(t, hostAuth, []string{"mirror.local", "https://other.local:443"})
+	secrets.Items = append(secrets.Items, buildSecretList(t, repoAuth, []string{"cache.local/org"}).Items...)
+	secrets.Items[1].Name = "repo-secret"
+
+	mirrors := []string{"mirror.local/foo", "other.local/bar", "cache.local/org", "plain.local"}
+
+	for _, mode := range []string{config.SecretMatchingPrefix, config.SecretMatchingReference} {
+		m, err := newMatcher(mode, "quay.io/org/app")
+		require.NoError(t, err)
+
+		// Host wide entries get scoped to the mirror path, while entries
+		// matching the mirror path keep their key
+		contents, used := updateAuthContents(secrets, docker.ConfigJSON{}, &scopedMatcher{matcher: m}, mirrors, true)
+		assert.Len(t, used, 2, mode)
+		assert.Equal(t, map[string]docker.AuthConfig{
+			"mirror.local/foo": {Auth: hostAuth},
+			"other.local/bar":  {Auth: hostAuth},
+			"cache.local/org":  {Auth: repoAuth},
+		}, contents.Auths, mode)
+	}
+}
+
+func TestUpdateAuthContentsDefaultPorts(t *testing.T) {
+	t.Parallel()
+
+	portAuth := base64.StdEncoding.EncodeToString([]byte("port:pass"))
+	schemeAuth := base64.StdEncoding.EncodeToString([]byte("scheme:pass"))
+	imageAuth := base64.StdEncoding.EncodeToString([]byte("image:pass"))
+
+	secrets := buildSecretList(t, portAuth, []string{"registry.local:443"})
+	secrets.Items = append(secrets.Items, buildSecretList(t, schemeAuth, []string{"https://other.local"}).Items...)
+	secrets.Items = append(secrets.Items, buildSecretList(t, imageAuth, []string{"http://image.local:80/org"}).Items...)
+	secrets.Items[1].Name = "scheme-secret"
+	secrets.Items[2].Name = "image-secret"
+
+	mirrors := []string{"registry.local/org", "other.local:443/org"}
+
+	for _, mode := range []string{config.SecretMatchingPrefix, config.SecretMatchingReference} {
+		m, err := newMatcher(mode, "image.local:443/org/app")
+		require.NoError(t, err)
+
+		// The keys use the host of the matched location
+		contents, used := updateAuthContents(secrets, docker.ConfigJSON{}, m, mirrors, true)
+		assert.Len(t, used, 3, mode)
+		assert.Equal(t, map[string]docker.AuthConfig{
+			"registry.local":      {Auth: portAuth},
+			"other.local:443":     {Auth: schemeAuth},
+			"image.local:443/org": {Auth: imageAuth},
+		}, contents.Auths, mode)
+	}
+}
+
+func TestUpdateAuthContentsIPv6(t *testing.T) {
+	t.Parallel()
+
+	mirrorAuth := base64.StdEncoding.EncodeToString([]byte("mirror:pass"))
+	imageAuth := base64.StdEncoding.EncodeToString([]byte("image:pass"))
+	otherAuth := base64.StdEncoding.EncodeToString([]byte("other:pass"))
+
+	secrets := buildSecretList(t, mirrorAuth, []string{"[fd00:0::1]:5000"})
+	secrets.Items = append(secrets.Items, buildSecretList(t, imageAuth, []string{"https://[fd00::2]/org"}).Items...)
+	secrets.Items = append(secrets.Items, buildSecretList(t, otherAuth, []string{"[fd00::1]:5001"}).Items...)
+	secrets.Items[0].Name = "mirror-secret"
+	secrets.Items[1].Name = "image-secret"
+	secrets.Items[2].Name = "other-secret"
+
+	mirrors := []string{"[fd00::1]:5000/org"}
+
+	for _, mode := range []string{config.SecretMatchingPrefix, config.SecretMatchingReference} {
+		m, err := newMatcher(mode, "[fd00::2]:443/org/app:v1")
+		require.NoError(t, err)
+
+		contents, used := updateAuthContents(secrets, docker.ConfigJSON{}, m, mirrors, true)
+		assert.Equal(t, []string{"mirror-secret", "image-secret"}, used, mode)
+		assert.Equal(t, map[string]docker.AuthConfig{
+			"[fd00::1]:5000":    {Auth: mirrorAuth},
+			"[fd00::2]:443/org": {Auth: imageAuth},
+		}, contents.Auths, mode)
+	}
+}
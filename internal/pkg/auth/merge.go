@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/errcode"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/logger"
+	"github.com/cri-o/crio-credential-provider/pkg/auth"
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+	"github.com/cri-o/crio-credential-provider/pkg/docker"
+)
+
+var errUnverified = errcode.New(errcode.UnverifiedAuthFile, "existing auth file does not match its sidecar")
+
+// merge merges the contents into the existing auth file at path by using the
+// conflict policy, see the config.MergeConflict* constants. Entries of the
+// existing auth file whose registry key is not part of the contents are
+// always kept. The contents get returned unchanged if the auth file does not
+// exist or cannot be verified by using the integrity key, which avoids
+// signing entries not written by the provider.
+func merge(path string, contents docker.ConfigJSON, format string, integrityKey []byte, conflict string) docker.ConfigJSON {
+	existing, err := readExisting(path, format, integrityKey)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			logger.Warnf("Not merging into auth file %s: %v", path, err)
+		}
+
+		return contents
+	}
+
+	merged := docker.ConfigJSON{Auths: maps.Clone(contents.Auths)}
+	keys := map[string][]string{}
+
+	for key := range contents.Auths {
+		written := formatKey(format, key)
+		keys[written] = append(keys[written], key)
+	}
+
+	for key, entry := range existing.Auths {
+		if _, ok := keys[key]; ok && conflict != config.MergeConflictExisting {
+			continue
+		}
+
+		for _, replaced := range keys[key] {
+			delete(merged.Auths, replaced)
+		}
+
+		merged.Auths[key] = entry
+	}
+
+	if added := len(merged.Auths) - len(contents.Auths); added > 0 {
+		logger.Debugf("Merged %d existing auth entries into auth file %s", added, path)
+	}
+
+	return merged
+}
+
+// readExisting reads and verifies the existing auth file at path.
+func readExisting(path, format string, integrityKey []byte) (docker.ConfigJSON, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return docker.ConfigJSON{}, fmt.Errorf("read auth file: %w", err)
+	}
+
+	sidecar, err := auth.ReadSidecar(path)
+	if err != nil {
+		return docker.ConfigJSON{}, fmt.Errorf("read sidecar file: %w", err)
+	}
+
+	if !hmac.Equal([]byte(sidecar.HMAC), []byte(auth.ComputeHMAC(integrityKey, raw))) {
+		return docker.ConfigJSON{}, errUnverified
+	}
+
+	return auth.Decode(format, raw)
+}
@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+	"github.com/cri-o/crio-credential-provider/pkg/docker"
+)
+
+func TestWriteAuthFileMerge(t *testing.T) {
+	t.Parallel()
+
+	existing := docker.ConfigJSON{Auths: map[string]docker.AuthConfig{
+		"docker.io":           {Auth: "old-hub"},
+		"mirror-a.local":      {Auth: "old-a"},
+		"mirror-b.local/org":  {Auth: "old-b"},
+		"mirror-c.local:5000": {Auth: "old-c"},
+	}}
+	contents := docker.ConfigJSON{Auths: map[string]docker.AuthConfig{
+		"index.docker.io":    {Auth: "new-hub"},
+		"mirror-a.local":     {Auth: "new-a"},
+		"mirror-b.local/org": {Auth: "new-b"},
+	}}
+
+	for name, tc := range map[string]struct {
+		format, merge string
+		tamper        bool
+		expected      map[string]docker.AuthConfig
+	}{
+		"replace": {
+			format:   config.AuthFormatAuthJSON,
+			expected: contents.Auths,
+		},
+		"newest wins": {
+			format: config.AuthFormatAuthJSON,
+			merge:  config.MergeConflictNewest,
+			expected: map[string]docker.AuthConfig{
+				"docker.io":           {Auth: "old-hub"},
+				"index.docker.io":     {Auth: "new-hub"},
+				"mirror-a.local":      {Auth: "new-a"},
+				"mirror-b.local/org":  {Auth: "new-b"},
+				"mirror-c.local:5000": {Auth: "old-c"},
+			},
+		},
+		"keep existing": {
+			format: config.AuthFormatAuthJSON,
+			merge:  config.MergeConflictExisting,
+			expected: map[string]docker.AuthConfig{
+				"docker.io":           {Auth: "old-hub"},
+				"index.docker.io":     {Auth: "new-hub"},
+				"mirror-a.local":      {Auth: "old-a"},
+				"mirror-b.local/org":  {Auth: "old-b"},
+				"mirror-c.local:5000": {Auth: "old-c"},
+			},
+		},
+		"keep existing with host keys": {
+			format: config.AuthFormatDocker,
+			merge:  config.MergeConflictExisting,
+			expected: map[string]docker.AuthConfig{
+				"docker.io":           {Auth: "old-hub"},
+				"mirror-a.local":      {Auth: "old-a"},
+				"mirror-b.local":      {Auth: "old-b"},
+				"mirror-c.local:5000": {Auth: "old-c"},
+			},
+		},
+		"newest wins with containerd": {
+			format: config.AuthFormatContainerd,
+			merge:  config.MergeConflictNewest,
+			expected: map[string]docker.AuthConfig{
+				"index.docker.io":     {Auth: "new-hub"},
+				"mirror-a.local":      {Auth: "new-a"},
+				"mirror-b.local/org":  {Auth: "new-b"},
+				"mirror-c.local:5000": {Auth: "old-c"},
+			},
+		},
+		"tampered existing auth file": {
+			format:   config.AuthFormatAuthJSON,
+			merge:    config.MergeConflictNewest,
+			tamper:   true,
+			expected: contents.Auths,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+
+			path, _, err := writeAuthFile(dir, "image", "ns", existing, tc.format, testIntegrityKey, Stamp{})
+			require.NoError(t, err)
+
+			if tc.tamper {
+				raw, err := os.ReadFile(path)
+				require.NoError(t, err)
+				require.NoError(t, os.WriteFile(path, append(raw, ' '), 0o600))
+			}
+
+			_, written, merged, err := writeMergedAuthFile(t.Context(), dir, "image", "ns", contents, tc.format, testIntegrityKey, Stamp{Merge: tc.merge})
+			require.NoError(t, err)
+			require.True(t, written)
+			assert.Equal(t, tc.expected, merged.Auths)
+
+			raw, err := os.ReadFile(path)
+			require.NoError(t, err)
+
+			expected, err := encodeAuthFile(tc.format, merged)
+			require.NoError(t, err)
+			assert.Equal(t, string(expected), string(raw))
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"os/user"
+	"path/filepath"
+	"strconv"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/logger"
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+	"github.com/cri-o/crio-credential-provider/pkg/docker"
+)
+
+// Output is an additional auth directory of another consumer, see
+// config.Output.
+type Output struct {
+	dir    string
+	format string
+	perms  permissions
+}
+
+// NewOutputs returns the additional auth directories of the configuration,
+// which requires their groups to exist.
+func NewOutputs(cfg *config.Config) ([]Output, error) {
+	outputs := make([]Output, 0, len(cfg.Outputs))
+
+	for i := range cfg.Outputs {
+		output := &cfg.Outputs[i]
+
+		mode, err := output.FileMode()
+		if err != nil {
+			return nil, fmt.Errorf("output %s: %w", output.Dir, err)
+		}
+
+		perms := permissions{mode: mode, gid: -1}
+
+		if output.Group != "" {
+			g, err := user.LookupGroup(output.Group)
+			if err != nil {
+				return nil, fmt.Errorf("output %s: lookup group: %w", output.Dir, err)
+			}
+
+			if perms.gid, err = strconv.Atoi(g.Gid); err != nil {
+				return nil, fmt.Errorf("output %s: parse gid of group %q: %w", output.Dir, output.Group, err)
+			}
+		}
+
+		outputs = append(outputs, Output{
+			dir:    output.Dir,
+			format: cmp.Or(output.Format, cfg.AuthFormat),
+			perms:  perms,
+		})
+	}
+
+	return outputs, nil
+}
+
+// WriteOutputs writes the auth file contents for the namespace component and
+// image to all outputs. The writes are not fenced, because the outputs are
+// consumed on the node only. All outputs get written even if some fail.
+func WriteOutputs(outputs []Output, namespace, image string, contents docker.ConfigJSON, integrityKey []byte, stamp Stamp) error {
+	var errs []error
+
+	// Other instances sharing the auth directory do not share the outputs
+	stamp.Owner, stamp.Fence = "", 0
+
+	for _, output := range outputs {
+		raw, err := encodeAuthFile(output.format, contents)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("encode auth file for %s: %w", output.dir, err))
+
+			continue
+		}
+
+		path, _, err := writeRawAuthFile(output.dir, namespace, image, raw, integrityKey, stamp, output.perms)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("write auth file to %s: %w", output.dir, err))
+
+			continue
+		}
+
+		logger.Infof("Wrote auth file to output %s", path)
+	}
+
+	return errors.Join(errs...)
+}
+
+// RemoveOutputs removes the auth files corresponding to the auth file at
+// path of the auth directory from all configured outputs.
+func RemoveOutputs(cfg *config.Config, path string) error {
+	var errs []error
+
+	for i := range cfg.Outputs {
+		if err := RemoveFile(filepath.Join(cfg.Outputs[i].Dir, filepath.Base(path))); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
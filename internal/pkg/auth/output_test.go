@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	cpAuth "github.com/cri-o/crio-credential-provider/pkg/auth"
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+	"github.com/cri-o/crio-credential-provider/pkg/docker"
+)
+
+func TestWriteOutputs(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.Default()
+	cfg.AuthDir = t.TempDir()
+	cfg.Outputs = []config.Output{
+		{Dir: t.TempDir()},
+		{Dir: t.TempDir(), Format: config.AuthFormatContainerd, Mode: "0640"},
+	}
+
+	outputs, err := NewOutputs(cfg)
+	require.NoError(t, err)
+	require.Len(t, outputs, 2)
+
+	contents := docker.ConfigJSON{Auths: map[string]docker.AuthConfig{"quay.io": {Auth: testValidAuth}}}
+	require.NoError(t, WriteOutputs(outputs, "test-ns", "quay.io/org/app", contents, testIntegrityKey, Stamp{Owner: "node", Fence: 1}))
+
+	path, err := cpAuth.FilePath(cfg.AuthDir, "test-ns", "quay.io/org/app")
+	require.NoError(t, err)
+
+	for i, output := range cfg.Outputs {
+		outputPath := filepath.Join(output.Dir, filepath.Base(path))
+
+		info, err := os.Stat(outputPath)
+		require.NoError(t, err)
+
+		expected, err := output.FileMode()
+		require.NoError(t, err)
+		assert.Equal(t, expected, info.Mode().Perm(), i)
+
+		raw, err := os.ReadFile(outputPath)
+		require.NoError(t, err)
+
+		encoded, err := encodeAuthFile(outputs[i].format, contents)
+		require.NoError(t, err)
+		assert.Equal(t, encoded, raw, i)
+	}
+
+	require.NoError(t, RemoveOutputs(cfg, path))
+
+	for _, output := range cfg.Outputs {
+		assert.NoFileExists(t, filepath.Join(output.Dir, filepath.Base(path)))
+	}
+}
+
+func TestNewOutputsUnknownGroup(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.Default()
+	cfg.Outputs = []config.Output{{Dir: t.TempDir(), Group: "crio-credential-provider-missing"}}
+
+	_, err := NewOutputs(cfg)
+	require.Error(t, err)
+}
@@ -0,0 +1,222 @@
+package auth
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/errcode"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/events"
+	"github.com/cri-o/crio-credential-provider/pkg/auth"
+)
+
+// versionsDir is the directory within the auth directory containing the
+// versioned auth files of the blue/green publication.
+const versionsDir = ".versions"
+
+// ErrNoPreviousVersion is returned if an auth file has no previous version to
+// roll back to.
+var ErrNoPreviousVersion = errcode.New(errcode.NoPreviousVersion, "no previous version to roll back to")
+
+// Publication configures how the auth files get published.
+type Publication struct {
+	// Versioned writes the contents into a new versioned file and atomically
+	// flips the auth file, a symlink to the current version, to it.
+	Versioned bool
+
+	// RetainPrevious is the duration the previous version is kept after
+	// getting replaced, which allows rolling back to it.
+	RetainPrevious time.Duration
+}
+
+// publish writes the auth file and sidecar contents as a new version of path
+// and flips path and its sidecar to it. Versions not required for a rollback
+// anymore get removed afterwards.
+func publish(dir, path string, raw, sidecar []byte, perms permissions, publication Publication) error {
+	versions := filepath.Join(dir, versionsDir)
+	if err := os.MkdirAll(versions, 0o700); err != nil {
+		return fmt.Errorf("ensure versions dir: %w", err)
+	}
+
+	name := filepath.Base(path) + "." + strconv.FormatInt(time.Now().UnixNano(), 10)
+
+	if err := auth.WriteFileAtomic(filepath.Join(versions, name), raw, perms.mode, perms.gid); err != nil {
+		return fmt.Errorf("write auth file version: %w", err)
+	}
+
+	if err := auth.WriteFileAtomic(auth.SidecarPath(filepath.Join(versions, name)), sidecar, perms.mode, perms.gid); err != nil {
+		return fmt.Errorf("write sidecar file version: %w", err)
+	}
+
+	if err := flip(dir, path, name); err != nil {
+		return err
+	}
+
+	return pruneVersions(path, publication.RetainPrevious, time.Now())
+}
+
+// flip atomically points path and its sidecar to the version name. The
+// sidecar gets flipped first, which matches the order of the in-place writes.
+func flip(dir, path, name string) error {
+	target := filepath.Join(versionsDir, name)
+
+	if err := symlinkAtomic(dir, auth.SidecarPath(target), auth.SidecarPath(path)); err != nil {
+		return fmt.Errorf("flip sidecar file: %w", err)
+	}
+
+	if err := symlinkAtomic(dir, target, path); err != nil {
+		return fmt.Errorf("flip auth file: %w", err)
+	}
+
+	return nil
+}
+
+// symlinkAtomic creates a temp symlink to target in dir first, then
+// atomically renames it to path.
+func symlinkAtomic(dir, target, path string) error {
+	tmpPath := filepath.Join(dir, fmt.Sprintf(".auth-%d.link", time.Now().UnixNano()))
+
+	if err := os.Symlink(target, tmpPath); err != nil {
+		return fmt.Errorf("create temp symlink: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		_ = os.Remove(tmpPath)
+
+		return fmt.Errorf("rename temp symlink: %w", err)
+	}
+
+	return nil
+}
+
+// version is a single versioned auth file.
+type version struct {
+	// name is the file name within the versions directory.
+	name string
+
+	// published is the time the version got written.
+	published time.Time
+}
+
+// listVersions returns the versions of the auth file at path, starting with
+// the oldest one, together with the name of the current version. The current
+// version is empty if path is not published versioned.
+func listVersions(path string) ([]version, string, error) {
+	current := ""
+	if target, err := os.Readlink(path); err == nil {
+		current = filepath.Base(target)
+	}
+
+	entries, err := os.ReadDir(filepath.Join(filepath.Dir(path), versionsDir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, current, nil
+		}
+
+		return nil, "", fmt.Errorf("read versions dir: %w", err)
+	}
+
+	versions := []version{}
+
+	for _, entry := range entries {
+		suffix, ok := strings.CutPrefix(entry.Name(), filepath.Base(path)+".")
+		if !ok {
+			continue
+		}
+
+		// Sidecar files do not parse as version
+		nanos, err := strconv.ParseInt(suffix, 10, 64)
+		if err != nil {
+			continue
+		}
+
+		versions = append(versions, version{name: entry.Name(), published: time.Unix(0, nanos)})
+	}
+
+	slices.SortFunc(versions, func(a, b version) int {
+		return a.published.Compare(b.published)
+	})
+
+	return versions, current, nil
+}
+
+// previousVersion returns the index of the most recent version published
+// before the current one, or -1 if there is none.
+func previousVersion(versions []version, current string) int {
+	i := slices.IndexFunc(versions, func(v version) bool { return v.name == current })
+
+	return i - 1
+}
+
+// pruneVersions removes all versions of the auth file at path besides the
+// current one and the previous one, which is only kept for retainPrevious
+// after the current version got published.
+func pruneVersions(path string, retainPrevious time.Duration, now time.Time) error {
+	versions, current, err := listVersions(path)
+	if err != nil {
+		return err
+	}
+
+	keep := []string{current}
+
+	if i := previousVersion(versions, current); i >= 0 && now.Sub(versions[i+1].published) < retainPrevious {
+		keep = append(keep, versions[i].name)
+	}
+
+	for _, v := range versions {
+		if !slices.Contains(keep, v.name) {
+			if err := removeVersion(path, v.name); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// removeVersion removes the version name of the auth file at path together
+// with its sidecar file.
+func removeVersion(path, name string) error {
+	versioned := filepath.Join(filepath.Dir(path), versionsDir, name)
+
+	for _, p := range []string{versioned, auth.SidecarPath(versioned)} {
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("remove auth file version: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Rollback flips the versioned auth file at path back to its previous
+// version, which does not require resolving the credentials again. The
+// rolled back version gets removed, which makes sure that it never becomes
+// the previous version of a later write.
+func Rollback(path string) error {
+	versions, current, err := listVersions(path)
+	if err != nil {
+		return err
+	}
+
+	i := previousVersion(versions, current)
+	if i < 0 {
+		return fmt.Errorf("%w: %s", ErrNoPreviousVersion, path)
+	}
+
+	if err := flip(filepath.Dir(path), path, versions[i].name); err != nil {
+		return err
+	}
+
+	if err := removeVersion(path, current); err != nil {
+		return err
+	}
+
+	namespace, _, _ := auth.ParseFilePath(path)
+	events.Emit(events.TypeUpdated, events.Data{Path: path, Namespace: namespace})
+
+	return nil
+}
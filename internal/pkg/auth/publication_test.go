@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cri-o/crio-credential-provider/pkg/auth"
+)
+
+func TestPublication(t *testing.T) {
+	t.Parallel()
+
+	key := []byte("key")
+
+	for name, tc := range map[string]struct {
+		retainPrevious time.Duration
+		expectedErr    error
+	}{
+		"success rolling back to the previous version": {
+			retainPrevious: time.Hour,
+		},
+		"failure on expired previous version": {
+			expectedErr: ErrNoPreviousVersion,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			stamp := Stamp{Publication: Publication{Versioned: true, RetainPrevious: tc.retainPrevious}}
+
+			for _, content := range []string{"first", "second", "third"} {
+				_, _, err := WriteRawAuthFile(dir, "ns", "quay.io/org/app", []byte(content), key, stamp)
+				require.NoError(t, err)
+			}
+
+			path, err := auth.FilePath(dir, "ns", "quay.io/org/app")
+			require.NoError(t, err)
+
+			info, err := os.Lstat(path)
+			require.NoError(t, err)
+			assert.NotZero(t, info.Mode()&os.ModeSymlink)
+
+			raw, err := os.ReadFile(path)
+			require.NoError(t, err)
+			assert.Equal(t, "third", string(raw))
+
+			err = Rollback(path)
+			if tc.expectedErr != nil {
+				require.ErrorIs(t, err, tc.expectedErr)
+
+				return
+			}
+
+			require.NoError(t, err)
+
+			raw, err = os.ReadFile(path)
+			require.NoError(t, err)
+			assert.Equal(t, "second", string(raw))
+
+			sidecar, err := auth.ReadSidecar(path)
+			require.NoError(t, err)
+			assert.Equal(t, auth.ComputeSHA256([]byte("second")), sidecar.SHA256)
+
+			// The first version got pruned and the rolled back one removed
+			require.ErrorIs(t, Rollback(path), ErrNoPreviousVersion)
+
+			require.NoError(t, RemoveFile(path))
+
+			entries, err := os.ReadDir(filepath.Join(dir, versionsDir))
+			require.NoError(t, err)
+			assert.Empty(t, entries)
+		})
+	}
+}
+
+func TestPublicationInPlace(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	key := []byte("key")
+
+	_, _, err := WriteRawAuthFile(dir, "ns", "quay.io/org/app", []byte("versioned"), key, Stamp{Publication: Publication{Versioned: true}})
+	require.NoError(t, err)
+
+	path, _, err := WriteRawAuthFile(dir, "ns", "quay.io/org/app", []byte("in place"), key, Stamp{})
+	require.NoError(t, err)
+
+	info, err := os.Lstat(path)
+	require.NoError(t, err)
+	assert.True(t, info.Mode().IsRegular())
+
+	entries, err := os.ReadDir(filepath.Join(dir, versionsDir))
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
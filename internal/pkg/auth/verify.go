@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/cri-o/crio-credential-provider/pkg/auth"
+)
+
+// VerifyFile verifies the contents of the auth file at path against the HMAC
+// of its sidecar by using the integrity key and returns the sidecar. The
+// returned bool is true if the sidecar lacks the content hash or write time,
+// like the sidecars of earlier versions. Such sidecars get completed while
+// holding the lock of the auth directory if complete is true, where the write
+// time falls back to the modification time of the auth file.
+func VerifyFile(path string, integrityKey []byte, lock Lock, complete bool) (*auth.Sidecar, bool, error) {
+	_, unlock, err := lockDir(filepath.Dir(path), lock)
+	if err != nil {
+		return nil, false, err
+	}
+	defer unlock()
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false, fmt.Errorf("read auth file: %w", err)
+	}
+
+	sidecar, err := auth.ReadSidecar(path)
+	if err != nil {
+		return nil, false, fmt.Errorf("read sidecar file: %w", err)
+	}
+
+	if !hmac.Equal([]byte(sidecar.HMAC), []byte(auth.ComputeHMAC(integrityKey, raw))) {
+		return nil, false, auth.ErrIntegrity
+	}
+
+	incomplete := sidecar.SHA256 == "" || sidecar.Written.IsZero()
+	if !incomplete || !complete {
+		return sidecar, incomplete, nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, false, fmt.Errorf("get auth file info: %w", err)
+	}
+
+	if sidecar.SHA256 == "" {
+		sidecar.SHA256 = auth.ComputeSHA256(raw)
+	}
+
+	if sidecar.Written.IsZero() {
+		sidecar.Written = info.ModTime().UTC()
+	}
+
+	encoded, err := json.Marshal(sidecar)
+	if err != nil {
+		return nil, false, fmt.Errorf("encode sidecar file: %w", err)
+	}
+
+	// Versioned auth files link to the sidecar of their version
+	sidecarPath, err := filepath.EvalSymlinks(auth.SidecarPath(path))
+	if err != nil {
+		return nil, false, fmt.Errorf("resolve sidecar file: %w", err)
+	}
+
+	sidecarInfo, err := os.Stat(sidecarPath)
+	if err != nil {
+		return nil, false, fmt.Errorf("get sidecar file info: %w", err)
+	}
+
+	gid := -1
+	if stat, ok := sidecarInfo.Sys().(*syscall.Stat_t); ok {
+		gid = int(stat.Gid)
+	}
+
+	if err := auth.WriteFileAtomic(sidecarPath, encoded, sidecarInfo.Mode().Perm(), gid); err != nil {
+		return nil, false, fmt.Errorf("write sidecar file: %w", err)
+	}
+
+	return sidecar, true, nil
+}
@@ -0,0 +1,258 @@
+// Package claims contains the coexistence with other kubelet credential
+// providers of the node. Every provider claims the registry patterns it
+// handles by writing a claims file into a shared directory.
+package claims
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/logger"
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+)
+
+// fileExt is the file extension of the claims files.
+const fileExt = ".claim.json"
+
+// Claim is the content of a single claims file.
+type Claim struct {
+	// Provider is the name of the claiming provider.
+	Provider string `json:"provider"`
+
+	// Priority is the priority of the claiming provider.
+	Priority int `json:"priority"`
+
+	// Pattern is the claimed registry pattern.
+	Pattern string `json:"pattern"`
+}
+
+// Publish writes a claims file for every configured pattern and removes the
+// claims files of patterns which are no longer configured. Unchanged claims
+// files are not rewritten. Nothing happens if the claims are disabled.
+func Publish(cfg *config.Config) error {
+	if !cfg.Claims.Enabled() {
+		return nil
+	}
+
+	if err := os.MkdirAll(cfg.Claims.Dir, 0o755); err != nil {
+		return fmt.Errorf("ensure claims dir: %w", err)
+	}
+
+	existing, err := Load(cfg.Claims.Dir)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+
+	for _, pattern := range cfg.Claims.Patterns {
+		claim := Claim{Provider: cfg.Claims.Provider, Priority: cfg.Claims.Priority, Pattern: pattern}
+		if err := write(cfg.Claims.Dir, &claim); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	for _, claim := range existing {
+		if claim.Provider == cfg.Claims.Provider && !slices.Contains(cfg.Claims.Patterns, claim.Pattern) {
+			if err := os.Remove(filePath(cfg.Claims.Dir, &claim)); err != nil && !os.IsNotExist(err) {
+				errs = append(errs, fmt.Errorf("remove stale claims file: %w", err))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Load returns all claims of the claims directory. A non existing directory
+// results in an empty list, while unparsable claims files get skipped.
+func Load(dir string) ([]Claim, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("read claims dir: %w", err)
+	}
+
+	res := []Claim{}
+
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || !strings.HasSuffix(entry.Name(), fileExt) {
+			continue
+		}
+
+		raw, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+
+			return nil, fmt.Errorf("read claims file: %w", err)
+		}
+
+		claim := Claim{}
+		if err := json.Unmarshal(raw, &claim); err != nil || claim.Provider == "" {
+			logger.Warnf("Skipping invalid claims file %s", entry.Name())
+
+			continue
+		}
+
+		res = append(res, claim)
+	}
+
+	return res, nil
+}
+
+// Owner returns the provider of the claim with the highest priority matching
+// the image name, if it is claimed by another provider with a higher
+// priority than this one.
+func Owner(cfg *config.Config, claims []Claim, name string) (string, bool) {
+	var owner *Claim
+
+	for i := range claims {
+		claim := &claims[i]
+
+		if claim.Provider == cfg.Claims.Provider || claim.Priority <= cfg.Claims.Priority {
+			continue
+		}
+
+		if !Match(claim.Pattern, name) {
+			continue
+		}
+
+		if owner == nil || claim.Priority > owner.Priority {
+			owner = claim
+		}
+	}
+
+	if owner == nil {
+		return "", false
+	}
+
+	return owner.Provider, true
+}
+
+// Match returns true if the image name matches the pattern by using the
+// matchImages semantics of the kubelet: The host labels get matched as globs
+// and have to be of the same number, the ports have to be equal and the
+// pattern path has to be a prefix of the image path. IPv6 literal hosts, like
+// "[fd00::1]:5000", have to be the same address.
+func Match(pattern, name string) bool {
+	patternHost, patternPath, _ := strings.Cut(pattern, "/")
+	nameHost, namePath, _ := strings.Cut(name, "/")
+
+	patternHostname, patternPort := splitHost(patternHost)
+	nameHostname, namePort := splitHost(nameHost)
+
+	if patternPort != namePort {
+		return false
+	}
+
+	if strings.Contains(patternHostname, ":") || strings.Contains(nameHostname, ":") {
+		// IPv6 literals cannot be matched label wise
+		patternAddr, patternErr := netip.ParseAddr(patternHostname)
+		nameAddr, nameErr := netip.ParseAddr(nameHostname)
+
+		return patternErr == nil && nameErr == nil && patternAddr == nameAddr && strings.HasPrefix(namePath, patternPath)
+	}
+
+	patternLabels := strings.Split(patternHostname, ".")
+	nameLabels := strings.Split(nameHostname, ".")
+
+	if len(patternLabels) != len(nameLabels) {
+		return false
+	}
+
+	for i := range patternLabels {
+		if matched, err := path.Match(patternLabels[i], nameLabels[i]); err != nil || !matched {
+			return false
+		}
+	}
+
+	return strings.HasPrefix(namePath, patternPath)
+}
+
+// MatchAny returns true if the registry matches any of the patterns, see
+// Match. A scheme of the registry, like in the entries of docker configs, gets
+// ignored.
+func MatchAny(patterns []string, registry string) bool {
+	if _, name, ok := strings.Cut(registry, "://"); ok {
+		registry = name
+	}
+
+	return slices.ContainsFunc(patterns, func(pattern string) bool {
+		return Match(pattern, registry)
+	})
+}
+
+// splitHost splits the host into its hostname and port, which supports
+// bracketed IPv6 literals.
+func splitHost(host string) (string, string) {
+	if hostname, port, err := net.SplitHostPort(host); err == nil {
+		return hostname, port
+	}
+
+	return strings.TrimSuffix(strings.TrimPrefix(host, "["), "]"), ""
+}
+
+// filePath returns the path of the claims file, which is derived from the
+// provider and pattern to support any characters within them.
+func filePath(dir string, claim *Claim) string {
+	sum := sha256.Sum256([]byte(claim.Provider + "\x00" + claim.Pattern))
+
+	return filepath.Join(dir, hex.EncodeToString(sum[:8])+fileExt)
+}
+
+func write(dir string, claim *Claim) error {
+	raw, err := json.Marshal(claim)
+	if err != nil {
+		return fmt.Errorf("marshal claim: %w", err)
+	}
+
+	p := filePath(dir, claim)
+
+	if existing, err := os.ReadFile(p); err == nil && bytes.Equal(existing, raw) {
+		return nil
+	}
+
+	tmpFile, err := os.CreateTemp(dir, ".claim-*.tmp")
+	if err != nil {
+		return fmt.Errorf("create temp claims file: %w", err)
+	}
+
+	defer os.Remove(tmpFile.Name()) //nolint:errcheck // best effort cleanup
+
+	if _, err := tmpFile.Write(raw); err != nil {
+		_ = tmpFile.Close()
+
+		return fmt.Errorf("write claims file: %w", err)
+	}
+
+	if err := tmpFile.Chmod(0o644); err != nil {
+		_ = tmpFile.Close()
+
+		return fmt.Errorf("chmod claims file: %w", err)
+	}
+
+	if err := tmpFile.Close(); err != nil {
+		return fmt.Errorf("close claims file: %w", err)
+	}
+
+	if err := os.Rename(tmpFile.Name(), p); err != nil {
+		return fmt.Errorf("rename claims file: %w", err)
+	}
+
+	return nil
+}
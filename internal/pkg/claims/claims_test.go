@@ -0,0 +1,88 @@
+package claims
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+)
+
+func TestMatch(t *testing.T) {
+	t.Parallel()
+
+	for name, tc := range map[string]struct {
+		pattern  string
+		name     string
+		expected bool
+	}{
+		"exact host":              {pattern: "quay.io", name: "quay.io/org/app", expected: true},
+		"glob label":              {pattern: "*.quay.io", name: "mirror.quay.io/org/app", expected: true},
+		"glob requires label":     {pattern: "*.quay.io", name: "quay.io/org/app"},
+		"different label count":   {pattern: "*.io", name: "mirror.quay.io/org/app"},
+		"path prefix":             {pattern: "quay.io/org", name: "quay.io/org/app", expected: true},
+		"different path":          {pattern: "quay.io/other", name: "quay.io/org/app"},
+		"matching port":           {pattern: "registry.local:5000", name: "registry.local:5000/app", expected: true},
+		"missing port in pattern": {pattern: "registry.local", name: "registry.local:5000/app"},
+		"ipv6 with port":          {pattern: "[fd00::1]:5000", name: "[fd00::1]:5000/app", expected: true},
+		"ipv6 other notation":     {pattern: "[fd00:0::1]/org", name: "[fd00::1]/org/app", expected: true},
+		"ipv6 different port":     {pattern: "[fd00::1]:5000", name: "[fd00::1]:5001/app"},
+		"ipv6 different address":  {pattern: "[fd00::1]", name: "[fd00::10]/app"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tc.expected, Match(tc.pattern, tc.name))
+		})
+	}
+}
+
+func TestPublish(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.Default()
+	cfg.Claims.Dir = filepath.Join(t.TempDir(), "claims")
+	cfg.Claims.Priority = 5
+	cfg.Claims.Patterns = []string{"quay.io", "*.example.com"}
+
+	other := Claim{Provider: "other", Priority: 10, Pattern: "quay.io/org"}
+	require.NoError(t, os.MkdirAll(cfg.Claims.Dir, 0o755))
+	require.NoError(t, write(cfg.Claims.Dir, &other))
+
+	require.NoError(t, Publish(cfg))
+
+	claims, err := Load(cfg.Claims.Dir)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []Claim{
+		other,
+		{Provider: config.ClaimsProvider, Priority: 5, Pattern: "quay.io"},
+		{Provider: config.ClaimsProvider, Priority: 5, Pattern: "*.example.com"},
+	}, claims)
+
+	owner, ok := Owner(cfg, claims, "quay.io/org/app")
+	assert.True(t, ok)
+	assert.Equal(t, "other", owner)
+
+	_, ok = Owner(cfg, claims, "quay.io/another/app")
+	assert.False(t, ok)
+
+	// Removed patterns get unclaimed
+	cfg.Claims.Patterns = []string{"quay.io"}
+	require.NoError(t, Publish(cfg))
+
+	claims, err = Load(cfg.Claims.Dir)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []Claim{
+		other,
+		{Provider: config.ClaimsProvider, Priority: 5, Pattern: "quay.io"},
+	}, claims)
+}
+
+func TestPublishDisabled(t *testing.T) {
+	t.Parallel()
+
+	require.NoError(t, Publish(config.Default()))
+}
@@ -0,0 +1,245 @@
+// Package compat contains the consistency checks between the matchImages of
+// the kubelet credential provider configuration and the registries
+// configuration of the credential provider. The kubelet only invokes the
+// provider for images matching its globs, while the provider only acts on
+// registries with mirrors, which leaves images falling through the cracks if
+// both disagree.
+package compat
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"go.podman.io/image/v5/pkg/sysregistriesv2"
+	"go.podman.io/image/v5/types"
+	"sigs.k8s.io/yaml"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/claims"
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+	"github.com/cri-o/crio-credential-provider/pkg/reference"
+)
+
+// ErrUnknownProvider is returned if the kubelet credential provider
+// configuration does not contain the provider.
+var ErrUnknownProvider = errors.New("provider not found in kubelet credential provider configuration")
+
+// Kind classifies a gap between both matchers.
+type Kind string
+
+const (
+	// KindUncovered marks registries with mirrors the kubelet never invokes
+	// the provider for, which means that their mirrors receive no credentials.
+	KindUncovered Kind = "uncovered"
+
+	// KindPartial marks wildcard registries whose nested subdomains are not
+	// matched by the kubelet, because its globs match a single label only.
+	KindPartial Kind = "partial"
+
+	// KindUnused marks matchImages patterns or images the provider gets
+	// invoked for without any mirrors to write credentials for.
+	KindUnused Kind = "unused"
+)
+
+// Gap is a single inconsistency between both matchers.
+type Gap struct {
+	// Kind classifies the gap.
+	Kind Kind `json:"kind"`
+
+	// Subject is the registries.conf prefix, matchImages pattern or image
+	// the gap applies to.
+	Subject string `json:"subject"`
+
+	// Message describes the gap and how to close it.
+	Message string `json:"message"`
+}
+
+// String returns the human readable representation of the gap.
+func (g *Gap) String() string {
+	return fmt.Sprintf("[%s] %s: %s", g.Kind, g.Subject, g.Message)
+}
+
+// kubeletConfig is the subset of the kubelet CredentialProviderConfig
+// required for the checks.
+type kubeletConfig struct {
+	Providers []struct {
+		Name        string   `json:"name"`
+		MatchImages []string `json:"matchImages"`
+	} `json:"providers"`
+}
+
+// LoadMatchImages returns the matchImages of the provider from the kubelet
+// credential provider configuration file, which can be YAML or JSON.
+func LoadMatchImages(path, provider string) ([]string, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read kubelet credential provider configuration: %w", err)
+	}
+
+	cfg := kubeletConfig{}
+	if err := yaml.Unmarshal(raw, &cfg); err != nil {
+		return nil, fmt.Errorf("parse kubelet credential provider configuration: %w", err)
+	}
+
+	for i := range cfg.Providers {
+		if cfg.Providers[i].Name == provider {
+			return cfg.Providers[i].MatchImages, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %q", ErrUnknownProvider, provider)
+}
+
+// Check returns the gaps between the matchImages and the registries with
+// mirrors of the registries configuration. The images get evaluated against
+// both matchers in addition, which allows verifying concrete workloads.
+func Check(cfg *config.Config, matchImages, images []string) ([]Gap, error) {
+	ctx := &types.SystemContext{
+		SystemRegistriesConfPath:    cfg.RegistriesConfPath,
+		SystemRegistriesConfDirPath: cfg.RegistriesConfDirPath,
+	}
+
+	registries, err := sysregistriesv2.GetRegistries(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("loading registries configuration: %w", err)
+	}
+
+	res := []Gap{}
+	mirrored := []string{}
+
+	for i := range registries {
+		registry := &registries[i]
+
+		if len(registry.Mirrors) == 0 || registry.Blocked {
+			continue
+		}
+
+		mirrored = append(mirrored, registry.Prefix)
+
+		if gap, ok := checkPrefix(matchImages, registry.Prefix); ok {
+			res = append(res, gap)
+		}
+	}
+
+	for _, pattern := range matchImages {
+		used, err := patternUsed(ctx, mirrored, pattern)
+		if err != nil {
+			return nil, err
+		}
+
+		if !used {
+			res = append(res, Gap{
+				Kind:    KindUnused,
+				Subject: pattern,
+				Message: "The matchImages pattern matches no registry with mirrors, the provider gets invoked without writing any mirror credentials",
+			})
+		}
+	}
+
+	for _, image := range images {
+		gap, ok, err := checkImage(ctx, matchImages, image)
+		if err != nil {
+			return nil, err
+		}
+
+		if ok {
+			res = append(res, gap)
+		}
+	}
+
+	return res, nil
+}
+
+// checkPrefix verifies that the kubelet invokes the provider for the images
+// of the registries.conf prefix. Wildcard prefixes like "*.example.com"
+// match subdomains of any depth, while every matchImages glob only matches a
+// single label.
+func checkPrefix(matchImages []string, prefix string) (Gap, bool) {
+	domain, wildcard := strings.CutPrefix(prefix, "*.")
+	if !wildcard {
+		if claims.MatchAny(matchImages, prefix) {
+			return Gap{}, false
+		}
+
+		message := "The kubelet does not invoke the provider for images of the registry, add it to the matchImages"
+		if claims.MatchAny(matchImages, "x."+prefix) {
+			message += fmt.Sprintf(", because wildcard patterns like %q do not match the domain itself", "*."+domain)
+		}
+
+		return Gap{Kind: KindUncovered, Subject: prefix, Message: message}, true
+	}
+
+	if !claims.MatchAny(matchImages, "x."+domain) {
+		return Gap{
+			Kind:    KindUncovered,
+			Subject: prefix,
+			Message: fmt.Sprintf("The kubelet does not invoke the provider for images of the subdomains, add %q to the matchImages", prefix),
+		}, true
+	}
+
+	if !claims.MatchAny(matchImages, "x.x."+domain) {
+		return Gap{
+			Kind:    KindPartial,
+			Subject: prefix,
+			Message: fmt.Sprintf("The kubelet does not invoke the provider for images of nested subdomains like %q, add %q to the matchImages", "a.b."+domain, "*.*."+domain),
+		}, true
+	}
+
+	return Gap{}, false
+}
+
+// patternUsed returns true if the matchImages pattern overlaps with any of
+// the mirrored registries.conf prefixes.
+func patternUsed(ctx *types.SystemContext, mirrored []string, pattern string) (bool, error) {
+	for _, prefix := range mirrored {
+		// Wildcard prefixes get represented by their first subdomain
+		if claims.Match(pattern, strings.Replace(prefix, "*", "x", 1)) {
+			return true, nil
+		}
+	}
+
+	// The pattern can be more specific than the prefix, like
+	// "registry.example.com/org" for the prefix "registry.example.com"
+	registry, err := sysregistriesv2.FindRegistry(ctx, strings.ReplaceAll(pattern, "*", "x"))
+	if err != nil {
+		return false, fmt.Errorf("loading registries configuration: %w", err)
+	}
+
+	return registry != nil && len(registry.Mirrors) > 0 && !registry.Blocked, nil
+}
+
+// checkImage evaluates the image against both matchers. Unqualified images
+// get normalized like by the kubelet.
+func checkImage(ctx *types.SystemContext, matchImages []string, image string) (Gap, bool, error) {
+	ref, err := reference.Parse(image)
+	if err != nil {
+		return Gap{}, false, fmt.Errorf("check image: %w", err)
+	}
+
+	registry, err := sysregistriesv2.FindRegistry(ctx, ref.Name())
+	if err != nil {
+		return Gap{}, false, fmt.Errorf("loading registries configuration: %w", err)
+	}
+
+	invoked := claims.MatchAny(matchImages, ref.Name())
+	mirrored := registry != nil && len(registry.Mirrors) > 0 && !registry.Blocked
+
+	switch {
+	case mirrored && !invoked:
+		return Gap{
+			Kind:    KindUncovered,
+			Subject: image,
+			Message: fmt.Sprintf("The image has mirrors by the registries.conf prefix %q, but the kubelet does not invoke the provider for it", registry.Prefix),
+		}, true, nil
+
+	case invoked && !mirrored:
+		return Gap{
+			Kind:    KindUnused,
+			Subject: image,
+			Message: "The kubelet invokes the provider for the image, but it has no mirrors",
+		}, true, nil
+	}
+
+	return Gap{}, false, nil
+}
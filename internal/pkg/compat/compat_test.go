@@ -0,0 +1,178 @@
+package compat
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+)
+
+const registriesConf = `[[registry]]
+location = "docker.io"
+
+  [[registry.mirror]]
+  location = "mirror.local"
+
+[[registry]]
+prefix = "*.example.com"
+location = "example.com"
+
+  [[registry.mirror]]
+  location = "mirror.local/example"
+
+[[registry]]
+location = "quay.io/org"
+
+  [[registry.mirror]]
+  location = "mirror.local/org"
+
+[[registry]]
+location = "ghcr.io"
+`
+
+func testConfig(t *testing.T) *config.Config {
+	t.Helper()
+
+	cfg := config.Default()
+	cfg.RegistriesConfPath = filepath.Join(t.TempDir(), "registries.conf")
+
+	require.NoError(t, os.WriteFile(cfg.RegistriesConfPath, []byte(registriesConf), 0o600))
+
+	return cfg
+}
+
+func TestLoadMatchImages(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "credential-provider-config.yml")
+	require.NoError(t, os.WriteFile(path, []byte(`kind: CredentialProviderConfig
+apiVersion: kubelet.config.k8s.io/v1
+providers:
+  - name: other
+    matchImages: ["*.dkr.ecr.*.amazonaws.com"]
+  - name: crio-credential-provider
+    matchImages: ["docker.io", "*.example.com"]
+`), 0o600))
+
+	matchImages, err := LoadMatchImages(path, "crio-credential-provider")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"docker.io", "*.example.com"}, matchImages)
+
+	_, err = LoadMatchImages(path, "missing")
+	require.ErrorIs(t, err, ErrUnknownProvider)
+
+	_, err = LoadMatchImages(filepath.Join(t.TempDir(), "missing.yml"), "crio-credential-provider")
+	require.Error(t, err)
+}
+
+func TestCheck(t *testing.T) {
+	t.Parallel()
+
+	for name, tc := range map[string]struct {
+		matchImages []string
+		images      []string
+		expected    []Gap
+	}{
+		"consistent": {
+			matchImages: []string{"docker.io", "*.example.com", "*.*.example.com", "quay.io/org"},
+			expected:    []Gap{},
+		},
+		"uncovered registry": {
+			matchImages: []string{"*.example.com", "*.*.example.com", "quay.io"},
+			expected: []Gap{{
+				Kind:    KindUncovered,
+				Subject: "docker.io",
+				Message: "The kubelet does not invoke the provider for images of the registry, add it to the matchImages",
+			}},
+		},
+		"wildcard pattern not matching the domain itself": {
+			matchImages: []string{"*.docker.io", "*.example.com", "*.*.example.com", "quay.io"},
+			expected: []Gap{
+				{
+					Kind:    KindUncovered,
+					Subject: "docker.io",
+					Message: `The kubelet does not invoke the provider for images of the registry, add it to the matchImages, because wildcard patterns like "*.docker.io" do not match the domain itself`,
+				},
+				{
+					Kind:    KindUnused,
+					Subject: "*.docker.io",
+					Message: "The matchImages pattern matches no registry with mirrors, the provider gets invoked without writing any mirror credentials",
+				},
+			},
+		},
+		"nested subdomains": {
+			matchImages: []string{"docker.io", "*.example.com", "quay.io"},
+			expected: []Gap{{
+				Kind:    KindPartial,
+				Subject: "*.example.com",
+				Message: `The kubelet does not invoke the provider for images of nested subdomains like "a.b.example.com", add "*.*.example.com" to the matchImages`,
+			}},
+		},
+		"uncovered subdomains": {
+			matchImages: []string{"docker.io", "example.com", "quay.io"},
+			expected: []Gap{
+				{
+					Kind:    KindUncovered,
+					Subject: "*.example.com",
+					Message: `The kubelet does not invoke the provider for images of the subdomains, add "*.example.com" to the matchImages`,
+				},
+				{
+					Kind:    KindUnused,
+					Subject: "example.com",
+					Message: "The matchImages pattern matches no registry with mirrors, the provider gets invoked without writing any mirror credentials",
+				},
+			},
+		},
+		"images": {
+			matchImages: []string{"docker.io", "*.example.com", "*.*.example.com", "quay.io", "ghcr.io"},
+			images:      []string{"nginx", "quay.io/other/app", "quay.io/org/app", "a.b.example.com/app"},
+			expected: []Gap{
+				{
+					Kind:    KindUnused,
+					Subject: "ghcr.io",
+					Message: "The matchImages pattern matches no registry with mirrors, the provider gets invoked without writing any mirror credentials",
+				},
+				{
+					Kind:    KindUnused,
+					Subject: "quay.io/other/app",
+					Message: "The kubelet invokes the provider for the image, but it has no mirrors",
+				},
+			},
+		},
+		"uncovered image": {
+			matchImages: []string{"*.example.com", "*.*.example.com", "quay.io/org"},
+			images:      []string{"docker.io/library/nginx:latest"},
+			expected: []Gap{
+				{
+					Kind:    KindUncovered,
+					Subject: "docker.io",
+					Message: "The kubelet does not invoke the provider for images of the registry, add it to the matchImages",
+				},
+				{
+					Kind:    KindUncovered,
+					Subject: "docker.io/library/nginx:latest",
+					Message: `The image has mirrors by the registries.conf prefix "docker.io", but the kubelet does not invoke the provider for it`,
+				},
+			},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			gaps, err := Check(testConfig(t), tc.matchImages, tc.images)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, gaps)
+		})
+	}
+}
+
+func TestCheckInvalidImage(t *testing.T) {
+	t.Parallel()
+
+	_, err := Check(testConfig(t), nil, []string{"Invalid:Image"})
+	require.Error(t, err)
+}
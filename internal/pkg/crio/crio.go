@@ -0,0 +1,86 @@
+// Package crio contains the client of the CRI-O API socket, which provides
+// the effective configuration the runtime pulls the images with.
+package crio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// timeout is the budget for reading the configuration from the socket.
+const timeout = 2 * time.Second
+
+var errStatus = errors.New("unexpected HTTP response status")
+
+// Config contains the settings of the CRI-O configuration which affect the
+// pull sources of an image.
+type Config struct {
+	// InsecureRegistries are the registries CRI-O skips the TLS verification
+	// for in addition to the ones of the registries configuration, either as
+	// host or as CIDR.
+	InsecureRegistries []string
+
+	// SignaturePolicy is the path of the containers-policy.json(5) CRI-O
+	// verifies the images with, which is the system default if empty.
+	SignaturePolicy string
+}
+
+// file is the TOML layout of the CRI-O configuration.
+type file struct {
+	Crio struct {
+		Image struct {
+			InsecureRegistries []string `toml:"insecure_registries"`
+			SignaturePolicy    string   `toml:"signature_policy"`
+		} `toml:"image"`
+	} `toml:"crio"`
+}
+
+// ReadConfig reads the effective configuration of CRI-O from the /config
+// endpoint of the socket.
+func ReadConfig(ctx context.Context, socket string) (*Config, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+
+				return dialer.DialContext(ctx, "unix", socket)
+			},
+		},
+	}
+	defer client.CloseIdleConnections()
+
+	// The host is irrelevant for the socket
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://crio/config", http.NoBody)
+	if err != nil {
+		return nil, fmt.Errorf("create CRI-O config request: %w", err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("send CRI-O config request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %s", errStatus, resp.Status)
+	}
+
+	var raw file
+	if _, err := toml.NewDecoder(resp.Body).Decode(&raw); err != nil {
+		return nil, fmt.Errorf("decode CRI-O config: %w", err)
+	}
+
+	return &Config{
+		InsecureRegistries: raw.Crio.Image.InsecureRegistries,
+		SignaturePolicy:    raw.Crio.Image.SignaturePolicy,
+	}, nil
+}
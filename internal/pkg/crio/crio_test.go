@@ -0,0 +1,103 @@
+package crio
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serve serves the handler on a socket within a temporary directory and
+// returns its path.
+func serve(t *testing.T, handler http.HandlerFunc) string {
+	t.Helper()
+
+	// Socket paths are limited to 108 bytes, which long test names exceed
+	dir, err := os.MkdirTemp("", "crio")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	socket := filepath.Join(dir, "crio.sock")
+
+	listener, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+
+	server := httptest.NewUnstartedServer(handler)
+	server.Listener = listener
+	server.Start()
+	t.Cleanup(server.Close)
+
+	return socket
+}
+
+func TestReadConfig(t *testing.T) {
+	t.Parallel()
+
+	for name, tc := range map[string]struct {
+		handler http.HandlerFunc
+		assert  func(*Config, error)
+	}{
+		"success": {
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "/config", r.URL.Path)
+
+				_, err := w.Write([]byte("[crio]\nroot = \"/var/lib/containers/storage\"\n\n" +
+					"[crio.image]\ninsecure_registries = [\"registry.local:5000\", \"10.0.0.0/8\"]\n" +
+					"signature_policy = \"/etc/crio/policy.json\"\n"))
+				assert.NoError(t, err)
+			},
+			assert: func(cfg *Config, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, []string{"registry.local:5000", "10.0.0.0/8"}, cfg.InsecureRegistries)
+				assert.Equal(t, "/etc/crio/policy.json", cfg.SignaturePolicy)
+			},
+		},
+		"success without image section": {
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				_, err := w.Write([]byte("[crio]\nroot = \"/var/lib/containers/storage\"\n"))
+				assert.NoError(t, err)
+			},
+			assert: func(cfg *Config, err error) {
+				require.NoError(t, err)
+				assert.Empty(t, cfg.InsecureRegistries)
+				assert.Empty(t, cfg.SignaturePolicy)
+			},
+		},
+		"failure on status": {
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusNotFound)
+			},
+			assert: func(_ *Config, err error) {
+				require.ErrorIs(t, err, errStatus)
+			},
+		},
+		"failure on invalid TOML": {
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				_, err := w.Write([]byte("[crio"))
+				assert.NoError(t, err)
+			},
+			assert: func(_ *Config, err error) {
+				require.ErrorContains(t, err, "decode CRI-O config")
+			},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			tc.assert(ReadConfig(context.Background(), serve(t, tc.handler)))
+		})
+	}
+}
+
+func TestReadConfigUnreachable(t *testing.T) {
+	t.Parallel()
+
+	_, err := ReadConfig(context.Background(), filepath.Join(t.TempDir(), "crio.sock"))
+	require.ErrorContains(t, err, "send CRI-O config request")
+}
@@ -0,0 +1,479 @@
+// Package daemon contains the long running mode of the credential provider.
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/app"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/auth"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/claims"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/k8s"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/logger"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/policy"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/retention"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/state"
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+	"github.com/cri-o/crio-credential-provider/pkg/mirrors"
+)
+
+// Daemon watches the secrets of the cluster to keep the auth files up to date.
+// It also removes the auth files of namespaces which no longer exist.
+type Daemon struct {
+	cfg                *config.Config
+	informer           cache.SharedIndexInformer
+	namespacesInformer cache.SharedIndexInformer
+	limiter            *writeLimiter
+	writes             sync.WaitGroup
+
+	// integrityKey is used to compute the hashed namespace components of
+	// the auth file names.
+	integrityKey []byte
+
+	// mu guards active and pending, which track the secrets changed while
+	// waiting as hot standby for the lease.
+	mu      sync.Mutex
+	active  bool
+	pending map[cache.ObjectName]bool
+
+	// client, syncNode and syncInterval are used by the sync mode.
+	client       kubernetes.Interface
+	syncNode     string
+	syncInterval time.Duration
+}
+
+var errNoAllowedMirrors = errors.New("no allowed mirrors")
+
+// New creates a new daemon instance using a client with cluster level credentials.
+func New(cfg *config.Config, client kubernetes.Interface) *Daemon {
+	listWatch := &cache.ListWatch{
+		ListWithContextFunc: func(ctx context.Context, options metav1.ListOptions) (runtime.Object, error) {
+			options.FieldSelector = k8s.FieldSelector(&cfg.Secrets)
+
+			return client.CoreV1().Secrets(metav1.NamespaceAll).List(ctx, options)
+		},
+		WatchFuncWithContext: func(ctx context.Context, options metav1.ListOptions) (watch.Interface, error) {
+			options.FieldSelector = k8s.FieldSelector(&cfg.Secrets)
+
+			return client.CoreV1().Secrets(metav1.NamespaceAll).Watch(ctx, options)
+		},
+	}
+
+	lw := cache.ToListWatcherWithWatchListSemantics(listWatch, client)
+
+	informer := cache.NewSharedIndexInformer(lw, &corev1.Secret{}, 0, cache.Indexers{
+		cache.NamespaceIndex: cache.MetaNamespaceIndexFunc,
+	})
+
+	namespacesListWatch := &cache.ListWatch{
+		ListWithContextFunc: func(ctx context.Context, options metav1.ListOptions) (runtime.Object, error) {
+			return client.CoreV1().Namespaces().List(ctx, options)
+		},
+		WatchFuncWithContext: func(ctx context.Context, options metav1.ListOptions) (watch.Interface, error) {
+			return client.CoreV1().Namespaces().Watch(ctx, options)
+		},
+	}
+
+	namespacesInformer := cache.NewSharedIndexInformer(
+		cache.ToListWatcherWithWatchListSemantics(namespacesListWatch, client),
+		&corev1.Namespace{}, 0, cache.Indexers{},
+	)
+
+	return &Daemon{
+		cfg:                cfg,
+		informer:           informer,
+		namespacesInformer: namespacesInformer,
+		limiter:            newWriteLimiter(cfg.Daemon.NamespaceWriteConcurrency),
+		pending:            map[cache.ObjectName]bool{},
+		client:             client,
+	}
+}
+
+// Run starts the daemon and blocks until the context is done. Whenever the
+// data of a secret changes, all auth files derived from it get rewritten.
+// Auth files of deleted namespaces get removed.
+func (d *Daemon) Run(ctx context.Context) error {
+	if _, err := d.informer.AddEventHandler(cache.ResourceEventHandlerDetailedFuncs{
+		AddFunc: d.onAdd,
+		// Rewrites get canceled once the daemon stops
+		UpdateFunc: func(oldObj, newObj any) { d.onUpdate(ctx, oldObj, newObj) },
+	}); err != nil {
+		return fmt.Errorf("unable to add secret event handler: %w", err)
+	}
+
+	if _, err := d.namespacesInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		DeleteFunc: d.onNamespaceDelete,
+	}); err != nil {
+		return fmt.Errorf("unable to add namespace event handler: %w", err)
+	}
+
+	if d.cfg.HashNamespaces {
+		key, err := auth.LoadOrCreateIntegrityKey(d.cfg.IntegrityKeyPath)
+		if err != nil {
+			return fmt.Errorf("unable to get integrity key: %w", err)
+		}
+
+		d.integrityKey = key
+	}
+
+	go d.informer.RunWithContext(ctx)
+	go d.namespacesInformer.RunWithContext(ctx)
+
+	if !cache.WaitForCacheSync(ctx.Done(), d.informer.HasSynced, d.namespacesInformer.HasSynced) {
+		// Context got done before the cache synced
+		return nil
+	}
+
+	// Waiting with synced caches allows taking over without delay, while
+	// both daemons never write the same auth file concurrently
+	release, acquired, err := acquireLease(ctx, d.cfg.Daemon.LeaseFile)
+	if err != nil {
+		return fmt.Errorf("unable to acquire daemon lease: %w", err)
+	}
+
+	if !acquired {
+		return nil
+	}
+
+	d.takeOver(ctx)
+
+	if err := claims.Publish(d.cfg); err != nil {
+		logger.Warnf("Unable to publish the registry claims: %v", err)
+	}
+
+	// Namespaces may have been deleted while the daemon was not running
+	if err := d.removeStaleNamespaces(); err != nil {
+		logger.Warnf("Unable to remove auth files of deleted namespaces: %v", err)
+	}
+
+	logger.Infof("Daemon started, watching secrets for rotation and namespaces for deletion")
+
+	if d.syncNode != "" {
+		logger.Infof("Reconciling the auth files of node %s every %s", d.syncNode, d.syncInterval)
+
+		d.writes.Go(func() { d.syncLoop(ctx) })
+	}
+
+	<-ctx.Done()
+
+	// Canceled writes return before another daemon may write the same files
+	d.writes.Wait()
+
+	// Hand off to a standby daemon only after all writes finished
+	release()
+
+	logger.Infof("Daemon stopped")
+
+	return nil
+}
+
+func (d *Daemon) onAdd(obj any, isInInitialList bool) {
+	if isInInitialList {
+		return
+	}
+
+	secret, ok := obj.(*corev1.Secret)
+	if !ok {
+		return
+	}
+
+	if _, ok := k8s.ConvertSecret(secret); !ok {
+		return
+	}
+
+	d.forgetNoCredentials(secret.Namespace)
+}
+
+func (d *Daemon) onUpdate(ctx context.Context, oldObj, newObj any) {
+	oldSecret, ok := oldObj.(*corev1.Secret)
+	if !ok {
+		return
+	}
+
+	newSecret, ok := newObj.(*corev1.Secret)
+	if !ok {
+		return
+	}
+
+	if _, ok := k8s.ConvertSecret(newSecret); !ok {
+		return
+	}
+
+	if maps.EqualFunc(oldSecret.Data, newSecret.Data, bytes.Equal) {
+		return
+	}
+
+	d.forgetNoCredentials(newSecret.Namespace)
+
+	if d.deferWhileStandby(newSecret.Namespace, newSecret.Name) {
+		return
+	}
+
+	logger.Infof("Secret %s/%s changed, rewriting derived auth files", newSecret.Namespace, newSecret.Name)
+
+	if err := d.rotate(ctx, newSecret.Namespace, newSecret.Name); err != nil {
+		logger.Warnf("Unable to rewrite auth files for secret %s/%s: %v", newSecret.Namespace, newSecret.Name, err)
+	}
+}
+
+// forgetNoCredentials drops the negative cache entries which may be outdated
+// by a new or changed secret of the namespace. Secrets of the shared
+// namespace or referenced by cluster pull secrets can provide credentials to
+// any namespace, which drops all entries.
+func (d *Daemon) forgetNoCredentials(namespace string) {
+	if d.cfg.Secrets.NegativeCacheTTL.Duration <= 0 {
+		return
+	}
+
+	if namespace == d.cfg.Secrets.Shared.Namespace || d.cfg.Secrets.ClusterPullSecrets {
+		namespace = ""
+	}
+
+	if err := state.Update(d.cfg.StateFile, func(s *state.State) error {
+		s.ForgetNamespaceNoCredentials(namespace)
+
+		return nil
+	}); err != nil {
+		logger.Warnf("Unable to update the negative cache: %v", err)
+	}
+}
+
+func (d *Daemon) onNamespaceDelete(obj any) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+
+	namespace, ok := obj.(*corev1.Namespace)
+	if !ok {
+		return
+	}
+
+	d.mu.Lock()
+	active := d.active
+	d.mu.Unlock()
+
+	// The stale namespaces get removed after the takeover
+	if !active {
+		return
+	}
+
+	logger.Infof("Namespace %s got deleted, removing its auth files", namespace.Name)
+
+	if err := d.removeNamespace(namespace.Name); err != nil {
+		logger.Warnf("Unable to remove auth files of namespace %s: %v", namespace.Name, err)
+	}
+}
+
+// removeStaleNamespaces removes the auth files of all namespaces which do not
+// exist in the cluster any more.
+func (d *Daemon) removeStaleNamespaces() error {
+	_, err := retention.RemoveDeletedNamespaces(d.cfg, d.integrityKey, d.namespacesInformer.GetStore().ListKeys())
+
+	return err
+}
+
+// removeNamespace removes all auth files of the namespace as well as their
+// state entries.
+func (d *Daemon) removeNamespace(namespace string) error {
+	_, err := retention.RemoveNamespace(d.cfg, namespace, auth.FileNamespace(namespace, d.cfg.HashNamespaces, d.integrityKey))
+
+	return err
+}
+
+// rotate schedules the rewrite of all auth files which are derived from the
+// provided secret. The writes of a namespace are bounded by the configured
+// concurrency, while writes of the same auth file get serialized.
+func (d *Daemon) rotate(ctx context.Context, namespace, name string) error {
+	s, err := state.Load(d.cfg.StateFile)
+	if err != nil {
+		return fmt.Errorf("unable to load state: %w", err)
+	}
+
+	paths := s.FilesFor(namespace, name)
+	if len(paths) == 0 {
+		logger.Debugf("No auth files derived from secret %s/%s", namespace, name)
+
+		return nil
+	}
+
+	for _, path := range paths {
+		if owner := s.Files[path].Owner; owner != "" && owner != d.cfg.Coordination.Owner {
+			logger.Debugf("Skipping auth file %s owned by %s", path, owner)
+
+			continue
+		}
+
+		// Differs from the namespace of the secret for shared secrets
+		fileNamespace := s.Files[path].Namespace
+		image := s.Files[path].Image
+		workload := s.Files[path].Workload
+
+		d.writes.Go(func() {
+			if !d.limitWrite(fileNamespace, path, func() {
+				if err := d.provision(ctx, fileNamespace, path, image, workload); err != nil {
+					logger.Warnf("Unable to rewrite auth file %s: %v", path, err)
+				}
+			}) {
+				logger.Debugf("Rewrite of auth file %s is already queued", path)
+			}
+		})
+	}
+
+	return nil
+}
+
+// provision rewrites the auth file of the image based on the latest cached
+// secrets of the namespace. The rewrite stays attributed to the workload of
+// the original write. The phases are bounded by the timeouts of the
+// configuration as well as by ctx, which gets done once the daemon stops.
+func (d *Daemon) provision(ctx context.Context, namespace, path, image string, workload k8s.Workload) error {
+	stamp, err := app.NewStamp(d.cfg)
+	if err != nil {
+		return err
+	}
+
+	stamp.Workload = workload
+
+	// Rewrites replace the auth file to drop the entries of revoked secrets
+	stamp.Merge = ""
+
+	secretsCtx, cancel := withTimeout(ctx, d.cfg.Timeouts.Secrets.Duration)
+	defer cancel()
+
+	pol, err := policy.Load(secretsCtx, d.cfg, d.client, namespace)
+	if err != nil {
+		return err
+	}
+
+	stamp.Expires = pol.Expires(time.Now())
+
+	secrets, err := d.secrets(secretsCtx, namespace, workload)
+	if err != nil {
+		return err
+	}
+
+	sources, err := mirrors.Resolve(image, d.cfg)
+	if err != nil {
+		return fmt.Errorf("resolve pull sources for %s: %w", image, err)
+	}
+
+	sources = pol.Sources(sources)
+
+	if len(mirrors.Mirrors(sources)) == 0 {
+		return fmt.Errorf("%w for %s", errNoAllowedMirrors, image)
+	}
+
+	tlsSecrets := app.RetrieveTLSSecrets(secretsCtx, d.cfg, d.client)
+
+	writeCtx, cancel := withTimeout(ctx, d.cfg.Timeouts.Write.Duration)
+	defer cancel()
+
+	written, err := app.Provision(writeCtx, pol.Config(d.cfg), stamp, pol.Secrets(secrets), tlsSecrets, namespace, image, sources)
+	if err != nil {
+		return fmt.Errorf("provision %s: %w", path, err)
+	}
+
+	if written == "" {
+		logger.Infof("Recorded auth file %s in the audit file", path)
+
+		return nil
+	}
+
+	logger.Infof("Rewrote auth file %s", written)
+
+	return nil
+}
+
+// limitWrite runs fn by the write limiter, which gets keyed by the namespace
+// component of the auth file path. This serializes the rotation and the sync
+// of the same auth files, independent of which namespace the caller knows.
+func (d *Daemon) limitWrite(namespace, path string, fn func()) bool {
+	return d.limiter.run(auth.FileNamespace(namespace, d.cfg.HashNamespaces, d.integrityKey), path, fn)
+}
+
+// withTimeout bounds ctx by the timeout of a phase, which is disabled if not
+// positive.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, timeout)
+}
+
+// secrets returns all cached secrets of the provided namespace, or only the
+// imagePullSecrets of the workload if enabled, merged with the shared secrets
+// if the namespace is permitted to reference them as well as the cluster pull
+// secrets if enabled.
+func (d *Daemon) secrets(ctx context.Context, namespace string, workload k8s.Workload) (*corev1.SecretList, error) {
+	list, err := d.namespaceSecrets(namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.cfg.Secrets.PodPullSecrets {
+		names, err := k8s.WorkloadPullSecrets(ctx, d.client, namespace, workload)
+		if err != nil {
+			return nil, err
+		}
+
+		list = k8s.FilterSecrets(list, names)
+	}
+
+	if d.cfg.Secrets.Shared.Allows(namespace) {
+		shared, err := d.namespaceSecrets(d.cfg.Secrets.Shared.Namespace)
+		if err != nil {
+			return nil, err
+		}
+
+		list = k8s.MergeSharedSecrets(list, shared)
+	}
+
+	if d.cfg.Secrets.ClusterPullSecrets {
+		distributed, err := k8s.RetrieveClusterPullSecrets(ctx, d.client, namespace)
+		if err != nil {
+			return nil, err
+		}
+
+		list = k8s.MergeSharedSecrets(list, distributed)
+	}
+
+	return list, nil
+}
+
+// namespaceSecrets returns all cached secrets of the provided namespace.
+func (d *Daemon) namespaceSecrets(namespace string) (*corev1.SecretList, error) {
+	objs, err := d.informer.GetIndexer().ByIndex(cache.NamespaceIndex, namespace)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list cached secrets: %w", err)
+	}
+
+	list := &corev1.SecretList{Items: make([]corev1.Secret, 0, len(objs))}
+
+	for _, obj := range objs {
+		secret, ok := obj.(*corev1.Secret)
+		if !ok || !k8s.Considered(secret, &d.cfg.Secrets) {
+			continue
+		}
+
+		if secret, ok = k8s.ConvertSecret(secret); ok {
+			list.Items = append(list.Items, *secret)
+		}
+	}
+
+	list, _ = k8s.LimitSecrets(list, d.cfg.Secrets.MaxSize)
+
+	return list, nil
+}
@@ -0,0 +1,326 @@
+package daemon
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/app"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/state"
+	"github.com/cri-o/crio-credential-provider/pkg/auth"
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+	"github.com/cri-o/crio-credential-provider/pkg/mirrors"
+)
+
+const (
+	namespace = "default"
+	registry  = "docker.io"
+	image     = registry + "/library/image"
+	mirror    = "localhost:5000"
+)
+
+var key = []byte("key")
+
+func secretData(password string) []byte {
+	encoded := base64.StdEncoding.EncodeToString([]byte("user:" + password))
+
+	return fmt.Appendf(nil, `{"auths":{%q:{"auth":%q}}}`, mirror, encoded)
+}
+
+func testConfig(t *testing.T) *config.Config {
+	t.Helper()
+
+	dir := t.TempDir()
+
+	cfg := config.Default()
+	cfg.AuthDir = filepath.Join(dir, "auth")
+	cfg.RegistriesConfPath = filepath.Join(dir, "registries.conf")
+	cfg.KubeletAuthFilePath = filepath.Join(dir, "kubelet.json")
+	cfg.IntegrityKeyPath = filepath.Join(dir, "integrity.key")
+	cfg.StateFile = filepath.Join(dir, "state.json")
+	cfg.Sources.PolicyPath = filepath.Join(dir, "policy.json")
+	cfg.Daemon.LeaseFile = filepath.Join(dir, "daemon.lease")
+
+	require.NoError(t, os.WriteFile(cfg.RegistriesConfPath, fmt.Appendf(nil,
+		"[[registry]]\nlocation = %q\n[[registry.mirror]]\nlocation = %q", registry, mirror,
+	), 0o600))
+
+	require.NoError(t, os.WriteFile(cfg.IntegrityKeyPath, key, 0o600))
+
+	return cfg
+}
+
+func TestRunRotation(t *testing.T) {
+	t.Parallel()
+
+	cfg := testConfig(t)
+
+	path, err := auth.FilePath(cfg.AuthDir, namespace, image)
+	require.NoError(t, err)
+
+	require.NoError(t, state.Update(cfg.StateFile, func(s *state.State) error {
+		s.Files[path] = &state.File{Namespace: namespace, Image: image, Secrets: []string{"secret"}}
+
+		return nil
+	}))
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "secret", Namespace: namespace},
+		Type:       corev1.SecretTypeDockerConfigJson,
+		Data:       map[string][]byte{corev1.DockerConfigJsonKey: secretData("old")},
+	}
+	client := fake.NewClientset(secret)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	errCh := make(chan error, 1)
+
+	d := New(cfg, client)
+
+	go func() { errCh <- d.Run(ctx) }()
+
+	require.Eventually(t, d.informer.HasSynced, 5*time.Second, 10*time.Millisecond)
+	assert.NoFileExists(t, path)
+
+	secret = secret.DeepCopy()
+	secret.Data[corev1.DockerConfigJsonKey] = secretData("new")
+	_, err = client.CoreV1().Secrets(namespace).Update(t.Context(), secret, metav1.UpdateOptions{})
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		authFile, err := auth.Read(cfg.AuthDir, namespace, image, cfg.AuthFormat, key)
+
+		return err == nil && authFile.Auths[mirror].Auth == base64.StdEncoding.EncodeToString([]byte("user:new"))
+	}, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+	require.NoError(t, <-errCh)
+}
+
+func TestRunForgetNoCredentials(t *testing.T) {
+	t.Parallel()
+
+	cfg := testConfig(t)
+	cfg.Secrets.NegativeCacheTTL.Duration = time.Hour
+
+	now := time.Now()
+
+	require.NoError(t, state.Update(cfg.StateFile, func(s *state.State) error {
+		s.SetNoCredentials(namespace, image, now, now.Add(time.Hour))
+		s.SetNoCredentials("other", image, now, now.Add(time.Hour))
+
+		return nil
+	}))
+
+	client := fake.NewClientset()
+
+	ctx, cancel := context.WithCancel(t.Context())
+	errCh := make(chan error, 1)
+
+	d := New(cfg, client)
+
+	go func() { errCh <- d.Run(ctx) }()
+
+	require.Eventually(t, d.informer.HasSynced, 5*time.Second, 10*time.Millisecond)
+
+	_, err := client.CoreV1().Secrets(namespace).Create(t.Context(), &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "secret", Namespace: namespace},
+		Type:       corev1.SecretTypeDockerConfigJson,
+		Data:       map[string][]byte{corev1.DockerConfigJsonKey: secretData("new")},
+	}, metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		s, err := state.Load(cfg.StateFile)
+
+		return err == nil && !s.HasNoCredentials(namespace, image, now)
+	}, 5*time.Second, 10*time.Millisecond)
+
+	s, err := state.Load(cfg.StateFile)
+	require.NoError(t, err)
+	assert.True(t, s.HasNoCredentials("other", image, now))
+
+	cancel()
+	require.NoError(t, <-errCh)
+}
+
+func TestRunNamespaceDeletion(t *testing.T) {
+	t.Parallel()
+
+	cfg := testConfig(t)
+
+	secrets := &corev1.SecretList{Items: []corev1.Secret{{
+		ObjectMeta: metav1.ObjectMeta{Name: "secret"},
+		Type:       corev1.SecretTypeDockerConfigJson,
+		Data:       map[string][]byte{corev1.DockerConfigJsonKey: secretData("pass")},
+	}}}
+
+	paths := map[string]string{}
+
+	for _, ns := range []string{namespace, "deleted", "stale"} {
+		stamp, err := app.NewStamp(cfg)
+		require.NoError(t, err)
+
+		path, err := app.Provision(t.Context(), cfg, stamp, secrets, nil, ns, image, []mirrors.Source{{Location: mirror, Mirror: true, Allowed: true}})
+		require.NoError(t, err)
+
+		paths[ns] = path
+	}
+
+	client := fake.NewClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "deleted"}},
+	)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	errCh := make(chan error, 1)
+
+	d := New(cfg, client)
+
+	go func() { errCh <- d.Run(ctx) }()
+
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(paths["stale"])
+
+		return os.IsNotExist(err)
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.FileExists(t, paths["deleted"])
+
+	require.NoError(t, client.CoreV1().Namespaces().Delete(t.Context(), "deleted", metav1.DeleteOptions{}))
+
+	// The state gets updated after the files have been removed
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(paths["deleted"])
+		s, loadErr := state.Load(cfg.StateFile)
+
+		return os.IsNotExist(err) && loadErr == nil && len(s.FilesFor("deleted", "secret")) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.NoFileExists(t, auth.SidecarPath(paths["deleted"]))
+	assert.FileExists(t, paths[namespace])
+
+	s, err := state.Load(cfg.StateFile)
+	require.NoError(t, err)
+	assert.Equal(t, []string{paths[namespace]}, s.FilesFor(namespace, "secret"))
+	assert.Empty(t, s.FilesFor("deleted", "secret"))
+	assert.Empty(t, s.FilesFor("stale", "secret"))
+
+	cancel()
+	require.NoError(t, <-errCh)
+}
+
+func TestRunNamespaceDeletionHashed(t *testing.T) {
+	t.Parallel()
+
+	cfg := testConfig(t)
+	cfg.HashNamespaces = true
+
+	secrets := &corev1.SecretList{Items: []corev1.Secret{{
+		ObjectMeta: metav1.ObjectMeta{Name: "secret"},
+		Type:       corev1.SecretTypeDockerConfigJson,
+		Data:       map[string][]byte{corev1.DockerConfigJsonKey: secretData("pass")},
+	}}}
+
+	paths := map[string]string{}
+
+	for _, ns := range []string{namespace, "stale"} {
+		stamp, err := app.NewStamp(cfg)
+		require.NoError(t, err)
+
+		path, err := app.Provision(t.Context(), cfg, stamp, secrets, nil, ns, image, []mirrors.Source{{Location: mirror, Mirror: true, Allowed: true}})
+		require.NoError(t, err)
+		assert.NotContains(t, filepath.Base(path), ns)
+
+		paths[ns] = path
+	}
+
+	_, err := auth.ReadHashed(cfg.AuthDir, namespace, image, cfg.AuthFormat, key)
+	require.NoError(t, err)
+
+	client := fake.NewClientset(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}})
+
+	ctx, cancel := context.WithCancel(t.Context())
+	errCh := make(chan error, 1)
+
+	go func() { errCh <- New(cfg, client).Run(ctx) }()
+
+	// The state gets updated after the files have been removed
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(paths["stale"])
+		s, loadErr := state.Load(cfg.StateFile)
+
+		return os.IsNotExist(err) && loadErr == nil && s.Files[paths["stale"]] == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.FileExists(t, paths[namespace])
+
+	cancel()
+	require.NoError(t, <-errCh)
+}
+
+func TestRunSync(t *testing.T) {
+	t.Parallel()
+
+	cfg := testConfig(t)
+
+	stale, err := auth.FilePath(cfg.AuthDir, namespace, "quay.io/org/unused")
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(cfg.AuthDir, 0o700))
+	require.NoError(t, os.WriteFile(stale, []byte("{}"), 0o600))
+
+	path, err := auth.FilePath(cfg.AuthDir, namespace, image)
+	require.NoError(t, err)
+
+	client := fake.NewClientset(
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "secret", Namespace: namespace},
+			Type:       corev1.SecretTypeDockerConfigJson,
+			Data:       map[string][]byte{corev1.DockerConfigJsonKey: secretData("pass")},
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: namespace},
+			Spec: corev1.PodSpec{
+				NodeName:   "node",
+				Containers: []corev1.Container{{Image: image + ":latest"}},
+			},
+		},
+	)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	errCh := make(chan error, 1)
+
+	d := New(cfg, client)
+	d.EnableSync("node", 10*time.Millisecond)
+
+	go func() { errCh <- d.Run(ctx) }()
+
+	require.Eventually(t, func() bool {
+		_, err := auth.Read(cfg.AuthDir, namespace, image, cfg.AuthFormat, key)
+
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(stale)
+
+		return os.IsNotExist(err)
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Auth files without credentials get removed
+	require.NoError(t, client.CoreV1().Secrets(namespace).Delete(t.Context(), "secret", metav1.DeleteOptions{}))
+
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(path)
+
+		return os.IsNotExist(err)
+	}, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+	require.NoError(t, <-errCh)
+}
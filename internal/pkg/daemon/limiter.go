@@ -0,0 +1,125 @@
+package daemon
+
+import "sync"
+
+// writeLimiter bounds the number of concurrent auth file writes per namespace
+// and serializes writes of the same auth file. At most one write per auth
+// file is queued while another one is running, because a queued write reads
+// the latest secrets when it starts. This turns a burst of updates into a
+// single additional write.
+type writeLimiter struct {
+	limit int
+
+	mu         sync.Mutex
+	namespaces map[string]*namespaceSlots
+	files      map[string]*fileLock
+}
+
+// namespaceSlots is the semaphore of a namespace.
+type namespaceSlots struct {
+	slots chan struct{}
+	refs  int
+}
+
+// fileLock serializes the writes of a single auth file.
+type fileLock struct {
+	mu     sync.Mutex
+	queued bool
+	refs   int
+}
+
+func newWriteLimiter(limit int) *writeLimiter {
+	return &writeLimiter{
+		limit:      limit,
+		namespaces: map[string]*namespaceSlots{},
+		files:      map[string]*fileLock{},
+	}
+}
+
+// run executes fn for the auth file path of the namespace once a slot is
+// available and no other write of the same path is running. It returns false
+// without executing fn if a write of the same path is already queued.
+func (l *writeLimiter) run(namespace, path string, fn func()) bool {
+	file, ok := l.acquireFile(path)
+	if !ok {
+		return false
+	}
+	defer l.releaseFile(path)
+
+	// Wait for running writes of the same file before taking a slot
+	file.mu.Lock()
+	defer file.mu.Unlock()
+
+	l.mu.Lock()
+	file.queued = false
+	l.mu.Unlock()
+
+	ns := l.acquireNamespace(namespace)
+	defer l.releaseNamespace(namespace)
+
+	ns.slots <- struct{}{}
+	defer func() { <-ns.slots }()
+
+	fn()
+
+	return true
+}
+
+func (l *writeLimiter) acquireFile(path string) (*fileLock, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	file, ok := l.files[path]
+	if !ok {
+		file = &fileLock{}
+		l.files[path] = file
+	}
+
+	if file.queued {
+		return nil, false
+	}
+
+	file.queued = true
+	file.refs++
+
+	return file, true
+}
+
+func (l *writeLimiter) releaseFile(path string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	file := l.files[path]
+
+	file.refs--
+	if file.refs == 0 {
+		delete(l.files, path)
+	}
+}
+
+func (l *writeLimiter) acquireNamespace(namespace string) *namespaceSlots {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ns, ok := l.namespaces[namespace]
+	if !ok {
+		ns = &namespaceSlots{slots: make(chan struct{}, l.limit)}
+		l.namespaces[namespace] = ns
+	}
+
+	ns.refs++
+
+	return ns
+}
+
+func (l *writeLimiter) releaseNamespace(namespace string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ns := l.namespaces[namespace]
+
+	ns.refs--
+	if ns.refs == 0 {
+		delete(l.namespaces, namespace)
+	}
+}
@@ -0,0 +1,94 @@
+package daemon
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteLimiterNamespaceConcurrency(t *testing.T) {
+	t.Parallel()
+
+	const limit = 2
+
+	l := newWriteLimiter(limit)
+
+	var (
+		running, peak atomic.Int32
+		wg            sync.WaitGroup
+	)
+
+	for i := range 10 {
+		wg.Go(func() {
+			assert.True(t, l.run("ns", fmt.Sprintf("file-%d", i), func() {
+				current := running.Add(1)
+				defer running.Add(-1)
+
+				for {
+					old := peak.Load()
+					if current <= old || peak.CompareAndSwap(old, current) {
+						break
+					}
+				}
+
+				time.Sleep(10 * time.Millisecond)
+			}))
+		})
+	}
+
+	wg.Wait()
+
+	assert.Equal(t, int32(limit), peak.Load())
+	assert.Empty(t, l.namespaces)
+	assert.Empty(t, l.files)
+}
+
+func TestWriteLimiterCoalescesSameFile(t *testing.T) {
+	t.Parallel()
+
+	l := newWriteLimiter(4)
+
+	var (
+		runs    atomic.Int32
+		wg      sync.WaitGroup
+		started = make(chan struct{})
+		release = make(chan struct{})
+	)
+
+	wg.Go(func() {
+		l.run("ns", "file", func() {
+			runs.Add(1)
+			close(started)
+			<-release
+		})
+	})
+
+	<-started
+
+	// The first write gets queued while all others get coalesced into it
+	wg.Go(func() {
+		l.run("ns", "file", func() { runs.Add(1) })
+	})
+
+	require.Eventually(t, func() bool {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		return l.files["file"].queued
+	}, time.Second, time.Millisecond)
+
+	for range 10 {
+		assert.False(t, l.run("ns", "file", func() { runs.Add(1) }))
+	}
+
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(2), runs.Load())
+	assert.Empty(t, l.files)
+}
@@ -0,0 +1,116 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/logger"
+)
+
+// leaseRetryInterval is the interval between the attempts of a standby
+// daemon to acquire the lease.
+const leaseRetryInterval = time.Second
+
+// acquireLease locks the lease file of the daemon and returns its release
+// function. It waits as hot standby while another daemon holds the lease and
+// returns false if the context got done before. The lock is held by flock(2),
+// which gets released by the kernel if the active daemon crashes. An empty
+// path disables the lease.
+func acquireLease(ctx context.Context, path string) (func(), bool, error) {
+	if path == "" {
+		return func() {}, true, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, false, fmt.Errorf("ensure lease file dir: %w", err)
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, false, fmt.Errorf("open lease file: %w", err)
+	}
+
+	ticker := time.NewTicker(leaseRetryInterval)
+	defer ticker.Stop()
+
+	for standby := false; ; standby = true {
+		err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			break
+		}
+
+		if !errors.Is(err, syscall.EWOULDBLOCK) {
+			_ = f.Close()
+
+			return nil, false, fmt.Errorf("lock lease file: %w", err)
+		}
+
+		if !standby {
+			logger.Infof("Another daemon holds the lease %s, waiting as hot standby", path)
+		}
+
+		select {
+		case <-ctx.Done():
+			_ = f.Close()
+
+			return nil, false, nil
+		case <-ticker.C:
+		}
+	}
+
+	// The PID of the holder only helps debugging, the lock is authoritative
+	if err := f.Truncate(0); err == nil {
+		_, _ = f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	}
+
+	return func() {
+		_ = syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		_ = f.Close()
+	}, true, nil
+}
+
+// deferWhileStandby records the secret for rotation after the takeover and
+// returns true if the daemon does not hold the lease yet. The active daemon
+// rotates the auth files of the secret in the meantime, which means that the
+// rotation after the takeover only catches up on changes the active daemon
+// missed during its shutdown.
+func (d *Daemon) deferWhileStandby(namespace, name string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.active {
+		return false
+	}
+
+	d.pending[cache.NewObjectName(namespace, name)] = true
+
+	return true
+}
+
+// takeOver activates the daemon after acquiring the lease and rotates the
+// secrets changed while waiting as hot standby.
+func (d *Daemon) takeOver(ctx context.Context) {
+	d.mu.Lock()
+	d.active = true
+	pending := d.pending
+	d.pending = nil
+	d.mu.Unlock()
+
+	if len(pending) > 0 {
+		logger.Infof("Catching up on %d secret(s) changed during the handoff", len(pending))
+	}
+
+	for secret := range pending {
+		if err := d.rotate(ctx, secret.Namespace, secret.Name); err != nil {
+			logger.Warnf("Unable to rewrite auth files for secret %s: %v", secret, err)
+		}
+	}
+}
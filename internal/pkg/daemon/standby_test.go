@@ -0,0 +1,74 @@
+package daemon
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestAcquireLease(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "lease", "daemon.lease")
+
+	release, acquired, err := acquireLease(t.Context(), path)
+	require.NoError(t, err)
+	require.True(t, acquired)
+
+	// The standby gives up if its context got done
+	ctx, cancel := context.WithTimeout(t.Context(), 100*time.Millisecond)
+	defer cancel()
+
+	_, acquired, err = acquireLease(ctx, path)
+	require.NoError(t, err)
+	assert.False(t, acquired)
+
+	// The standby takes over after the release
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		standbyRelease, acquired, err := acquireLease(t.Context(), path)
+		assert.NoError(t, err)
+		assert.True(t, acquired)
+
+		if acquired {
+			standbyRelease()
+		}
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("standby acquired the lease held by the active daemon")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	release()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("standby did not take over")
+	}
+}
+
+func TestDeferWhileStandby(t *testing.T) {
+	t.Parallel()
+
+	d := New(testConfig(t), fake.NewClientset())
+
+	assert.True(t, d.deferWhileStandby(namespace, "secret"))
+	assert.Equal(t, map[cache.ObjectName]bool{cache.NewObjectName(namespace, "secret"): true}, d.pending)
+
+	d.takeOver(t.Context())
+
+	assert.False(t, d.deferWhileStandby(namespace, "secret"))
+	assert.Empty(t, d.pending)
+}
@@ -0,0 +1,152 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/auth"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/k8s"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/logger"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/prewarm"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/retention"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/state"
+)
+
+// EnableSync turns the daemon into a node local credentials controller, which
+// continuously reconciles the auth files of all images of the pods scheduled
+// to the node in the provided interval. Auth files get created, updated with
+// the current secrets and mirror configuration and deleted if no pod uses
+// the image any more or no credentials are available.
+func (d *Daemon) EnableSync(node string, interval time.Duration) {
+	d.syncNode = node
+	d.syncInterval = interval
+}
+
+// syncLoop reconciles the auth files until the context is done.
+func (d *Daemon) syncLoop(ctx context.Context) {
+	ticker := time.NewTicker(d.syncInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := d.reconcile(ctx); err != nil {
+			logger.Warnf("Unable to reconcile auth files: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// reconcile brings the auth directory in line with the images of the pods
+// scheduled to the node.
+func (d *Daemon) reconcile(ctx context.Context) error {
+	targets, err := prewarm.Targets(ctx, d.client, nil, nil, d.syncNode)
+	if err != nil {
+		return fmt.Errorf("collect targets: %w", err)
+	}
+
+	desired := make(map[string]prewarm.Target, len(targets))
+
+	for _, target := range targets {
+		// Auth files of namespaces which are not enabled anymore get removed
+		if !d.cfg.Namespaces.Allows(target.Namespace) {
+			continue
+		}
+
+		path, err := d.cfg.Naming.FilePath(d.cfg.AuthDir, auth.FileNamespace(target.Namespace, d.cfg.HashNamespaces, d.integrityKey), target.Image)
+		if err != nil {
+			return fmt.Errorf("get auth path: %w", err)
+		}
+
+		desired[path] = target
+	}
+
+	var errs []error
+
+	// Rewrites stay attributed to the workload of the original write
+	s, err := state.Load(d.cfg.StateFile)
+	if err != nil {
+		return fmt.Errorf("load state: %w", err)
+	}
+
+	for path, target := range desired {
+		var workload k8s.Workload
+		if file, ok := s.Files[path]; ok {
+			workload = file.Workload
+		}
+
+		if !d.limitWrite(target.Namespace, path, func() {
+			if err := d.reconcileFile(ctx, target.Namespace, path, target.Image, workload); err != nil {
+				errs = append(errs, err)
+			}
+		}) {
+			// The queued write reads the latest secrets as well, while a
+			// removal of the auth file happens on the next reconciliation
+			logger.Debugf("Write of auth file %s is already queued, skipping its reconciliation", path)
+		}
+	}
+
+	files, err := retention.List(d.cfg.AuthDir)
+	if err != nil {
+		return errors.Join(append(errs, err)...)
+	}
+
+	for _, file := range files {
+		if _, ok := desired[file.Path]; ok {
+			continue
+		}
+
+		if d.cfg.Coordination.Enabled() && auth.ForeignOwner(file.Path, d.cfg.Coordination.Owner) {
+			continue
+		}
+
+		logger.Infof("Auth file %s is not used by any pod of node %s", file.Path, d.syncNode)
+
+		if err := d.removeFile(file.Path); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// reconcileFile writes the auth file of the image or removes it if there are
+// no credentials for it any more.
+func (d *Daemon) reconcileFile(ctx context.Context, namespace, path, image string, workload k8s.Workload) error {
+	err := d.provision(ctx, namespace, path, image, workload)
+	if errors.Is(err, auth.ErrNoAuths) || errors.Is(err, errNoAllowedMirrors) {
+		logger.Infof("No credentials available for auth file %s: %v", path, err)
+
+		return d.removeFile(path)
+	}
+
+	return err
+}
+
+// removeFile removes the auth file at path as well as its state entry.
+func (d *Daemon) removeFile(path string) error {
+	if err := auth.RemoveFile(path); err != nil {
+		return err
+	}
+
+	logger.Infof("Removed auth file %s", path)
+
+	if err := auth.RemoveOutputs(d.cfg, path); err != nil {
+		logger.Warnf("Unable to remove auth file outputs: %v", err)
+	}
+
+	if err := state.Update(d.cfg.StateFile, func(s *state.State) error {
+		delete(s.Files, path)
+
+		return nil
+	}); err != nil {
+		return fmt.Errorf("update state: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,72 @@
+// Package diagnostics contains helpers for persisting diagnostic data.
+package diagnostics
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const redacted = "[REDACTED]"
+
+// jwtRegex matches strings looking like a JSON Web Token.
+var jwtRegex = regexp.MustCompile(`eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)
+
+// CrashReport is the sanitized representation of a recovered panic.
+type CrashReport struct {
+	// Time is the point in time when the panic got recovered.
+	Time time.Time `json:"time"`
+
+	// Version is the version of the credential provider.
+	Version string `json:"version"`
+
+	// Phase is the run phase in which the panic occurred.
+	Phase string `json:"phase"`
+
+	// ConfigHash is the hash of the active configuration.
+	ConfigHash string `json:"configHash"`
+
+	// Panic is the sanitized panic value.
+	Panic string `json:"panic"`
+
+	// Stack is the sanitized stack trace of the panicking goroutine.
+	Stack string `json:"stack"`
+}
+
+// Sanitize removes all provided secrets as well as anything looking like a
+// JSON Web Token from s.
+func Sanitize(s string, secrets ...string) string {
+	for _, secret := range secrets {
+		if secret != "" {
+			s = strings.ReplaceAll(s, secret, redacted)
+		}
+	}
+
+	return jwtRegex.ReplaceAllString(s, redacted)
+}
+
+// WriteCrashReport writes the report as JSON into dir and returns the path to
+// the written file.
+func WriteCrashReport(dir string, report *CrashReport) (string, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", fmt.Errorf("ensure diagnostics dir %q: %w", dir, err)
+	}
+
+	name := fmt.Sprintf("crash-%s-%d.json", report.Time.UTC().Format("20060102T150405Z"), os.Getpid())
+	path := filepath.Join(dir, name)
+
+	raw, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("marshal crash report: %w", err)
+	}
+
+	if err := os.WriteFile(path, raw, 0o600); err != nil {
+		return "", fmt.Errorf("write crash report: %w", err)
+	}
+
+	return path, nil
+}
@@ -0,0 +1,102 @@
+// Package errcode contains the stable codes of the user-facing errors, which
+// allow the documentation, events and support tooling to reference the exact
+// condition independent of the wording of the message.
+package errcode
+
+import (
+	"errors"
+)
+
+// Code is a stable identifier of an error condition, which must never be
+// reused for a different condition once released.
+type Code string
+
+// Request and service account token errors.
+const (
+	RequestEmpty       Code = "CP1001"
+	TokenEmpty         Code = "CP1002"
+	TokenExpired       Code = "CP1003"
+	NoNamespaceInClaim Code = "CP1004"
+	NamespaceNotString Code = "CP1005"
+	NoKubernetesClaim  Code = "CP1006"
+	NoNamespaceAtPath  Code = "CP1007"
+	UntrustedIssuer    Code = "CP1008"
+	NoToken            Code = "CP1009"
+	NoServiceAccount   Code = "CP1010"
+	NoWorkload         Code = "CP1011"
+	PodUIDMismatch     Code = "CP1012"
+	NoPod              Code = "CP1013"
+	InvalidNamespace   Code = "CP1014"
+)
+
+// Secret errors.
+const (
+	MalformedSecret  Code = "CP2001"
+	WrongSecretType  Code = "CP2002"
+	MissingSecretKey Code = "CP2003"
+	UnparsableSecret Code = "CP2004"
+	InvalidAuth      Code = "CP2005"
+)
+
+// Auth file and registry token errors.
+const (
+	NoAuths              Code = "CP3001"
+	UnverifiedAuthFile   Code = "CP3002"
+	NoPreviousVersion    Code = "CP3003"
+	TokenAuthUnsupported Code = "CP3004"
+	InsecureRealm        Code = "CP3005"
+	NoRegistryToken      Code = "CP3006"
+)
+
+// Authorization and internal errors.
+const (
+	NotAuthorized Code = "CP4001"
+	Panicked      Code = "CP9001"
+)
+
+// Error is an error with a stable code, which prefixes its message.
+type Error struct {
+	// Code is the code of the error.
+	Code Code
+
+	// Message is the message of the error without the code.
+	Message string
+
+	parent *Error
+}
+
+// New returns a new error with the code and message.
+func New(code Code, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+// Sub returns a new error with the code and message, which is a more
+// specific condition of e and therefore matches it by using errors.Is.
+func (e *Error) Sub(code Code, message string) *Error {
+	return &Error{Code: code, Message: message, parent: e}
+}
+
+// Error returns the message prefixed by the code.
+func (e *Error) Error() string {
+	return string(e.Code) + ": " + e.Message
+}
+
+// Unwrap returns the more general error of a sub error.
+func (e *Error) Unwrap() error {
+	if e.parent == nil {
+		return nil
+	}
+
+	return e.parent
+}
+
+// Of returns the code of the first coded error within the tree of err, which
+// is empty if there is none.
+func Of(err error) Code {
+	var coded *Error
+	if errors.As(err, &coded) {
+		return coded.Code
+	}
+
+	return ""
+}
@@ -0,0 +1,53 @@
+package errcode
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestError(t *testing.T) {
+	t.Parallel()
+
+	parent := New(MalformedSecret, "malformed secret")
+	sub := parent.Sub(InvalidAuth, "invalid base64 auth")
+
+	for name, tc := range map[string]struct {
+		err             error
+		expectedCode    Code
+		expectedMessage string
+		isParent        bool
+	}{
+		"error": {
+			err:             parent,
+			expectedCode:    MalformedSecret,
+			expectedMessage: "CP2001: malformed secret",
+			isParent:        true,
+		},
+		"sub error with context": {
+			err:             fmt.Errorf("%w: secret %s", sub, "ns/name"),
+			expectedCode:    InvalidAuth,
+			expectedMessage: "CP2005: invalid base64 auth: secret ns/name",
+			isParent:        true,
+		},
+		"wrapped error": {
+			err:             fmt.Errorf("run: %w", New(NoAuths, "no auths")),
+			expectedCode:    NoAuths,
+			expectedMessage: "run: CP3001: no auths",
+		},
+		"uncoded error": {
+			err:             errors.New("test"),
+			expectedMessage: "test",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tc.expectedCode, Of(tc.err))
+			assert.EqualError(t, tc.err, tc.expectedMessage)
+			assert.Equal(t, tc.isParent, errors.Is(tc.err, parent))
+		})
+	}
+}
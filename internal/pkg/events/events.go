@@ -0,0 +1,224 @@
+// Package events contains the emission of CloudEvents on the lifecycle of the
+// auth files, which allows security pipelines to track where registry
+// credentials get materialized. The events never contain credentials.
+package events
+
+import (
+	"crypto/rand"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/k8s"
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+)
+
+const (
+	// TypeCreated is the event type of a newly written auth file.
+	TypeCreated = "io.cri-o.credential-provider.authfile.created"
+
+	// TypeUpdated is the event type of a rewritten auth file.
+	TypeUpdated = "io.cri-o.credential-provider.authfile.updated"
+
+	// TypeDeleted is the event type of a removed auth file.
+	TypeDeleted = "io.cri-o.credential-provider.authfile.deleted"
+
+	// specVersion is the implemented CloudEvents specification version.
+	specVersion = "1.0"
+
+	// queueSize is the maximum number of pending events.
+	queueSize = 1024
+
+	// flushTimeout is the maximum time to wait for pending events.
+	flushTimeout = 2 * time.Second
+
+	sourcePrefix = "/crio-credential-provider/"
+)
+
+var (
+	mu      sync.Mutex
+	current *emitter
+)
+
+// Event is a CloudEvent in the structured JSON format.
+type Event struct {
+	// SpecVersion is the CloudEvents specification version.
+	SpecVersion string `json:"specversion"`
+
+	// ID uniquely identifies the event.
+	ID string `json:"id"`
+
+	// Source identifies the emitting node.
+	Source string `json:"source"`
+
+	// Type is one of the Type* values.
+	Type string `json:"type"`
+
+	// Subject is the path of the auth file.
+	Subject string `json:"subject"`
+
+	// Time is the time of the lifecycle change.
+	Time time.Time `json:"time"`
+
+	// DataContentType is the content type of the data.
+	DataContentType string `json:"datacontenttype"`
+
+	// Data describes the auth file.
+	Data Data `json:"data"`
+}
+
+// Data is the payload of an event.
+type Data struct {
+	// Path is the path of the auth file.
+	Path string `json:"path"`
+
+	// Namespace is the namespace of the auth file as used in its file name,
+	// which is hashed if the namespace hashing is enabled.
+	Namespace string `json:"namespace"`
+
+	// Image is the image the auth file got written for, if known.
+	Image string `json:"image,omitempty"`
+
+	// Owner is the owner of the auth file within a shared auth directory.
+	Owner string `json:"owner,omitempty"`
+
+	// Workload is the workload the auth file got written for, if known.
+	Workload k8s.Workload `json:"workload,omitzero"`
+}
+
+// sink delivers the events to a single destination.
+type sink interface {
+	name() string
+	send(event *Event) error
+}
+
+// emitter delivers the events to all sinks on a background goroutine to never
+// block the write path. Events get dropped if the bounded queue is full.
+type emitter struct {
+	source  string
+	sinks   []sink
+	queue   chan *Event
+	pending sync.WaitGroup
+
+	// failed ensures that delivery failures get reported only once per sink.
+	failed []atomic.Bool
+}
+
+// Enable starts emitting the events to the configured sinks. Nothing happens
+// if no sink is configured.
+func Enable(cfg *config.Events) {
+	var sinks []sink
+
+	if cfg.Endpoint != "" {
+		sinks = append(sinks, newHTTPSink(cfg.Endpoint))
+	}
+
+	if cfg.Journal {
+		sinks = append(sinks, newJournalSink(os.Stderr))
+	}
+
+	if len(sinks) == 0 {
+		return
+	}
+
+	e := newEmitter(sinks, queueSize)
+
+	mu.Lock()
+	current = e
+	mu.Unlock()
+}
+
+// Emit emits an event of the provided type for the auth file. Nothing happens
+// if the events are not enabled.
+func Emit(eventType string, data Data) {
+	mu.Lock()
+	e := current
+	mu.Unlock()
+
+	if e == nil {
+		return
+	}
+
+	e.emit(eventType, data, time.Now())
+}
+
+// Flush waits until all pending events are delivered, but not longer than a
+// fixed timeout to never block the process exit on a sink.
+func Flush() {
+	mu.Lock()
+	e := current
+	mu.Unlock()
+
+	if e != nil {
+		e.flush(flushTimeout)
+	}
+}
+
+func newEmitter(sinks []sink, size int) *emitter {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	e := &emitter{
+		source: sourcePrefix + hostname,
+		sinks:  sinks,
+		queue:  make(chan *Event, size),
+		failed: make([]atomic.Bool, len(sinks)),
+	}
+
+	go e.run()
+
+	return e
+}
+
+func (e *emitter) emit(eventType string, data Data, now time.Time) {
+	event := &Event{
+		SpecVersion:     specVersion,
+		ID:              rand.Text(),
+		Source:          e.source,
+		Type:            eventType,
+		Subject:         data.Path,
+		Time:            now.UTC(),
+		DataContentType: "application/json",
+		Data:            data,
+	}
+
+	e.pending.Add(1)
+
+	select {
+	case e.queue <- event:
+	default:
+		e.pending.Done()
+	}
+}
+
+func (e *emitter) run() {
+	for event := range e.queue {
+		for i, s := range e.sinks {
+			if err := s.send(event); err != nil && e.failed[i].CompareAndSwap(false, true) {
+				// Using the logger would interleave with the journal sink
+				fmt.Fprintf(os.Stderr, "Unable to emit events via %s, further failures are not reported: %v\n", s.name(), err)
+			}
+		}
+
+		e.pending.Done()
+	}
+}
+
+// flush waits until all queued events are delivered or the timeout exceeds.
+func (e *emitter) flush(timeout time.Duration) {
+	done := make(chan struct{})
+
+	go func() {
+		e.pending.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+	}
+}
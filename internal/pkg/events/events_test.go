@@ -0,0 +1,150 @@
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPSink(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu       sync.Mutex
+		received []Event
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, contentType, r.Header.Get("Content-Type"))
+
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+
+		event := Event{}
+		assert.NoError(t, json.Unmarshal(body, &event))
+
+		mu.Lock()
+		received = append(received, event)
+		mu.Unlock()
+
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	e := newEmitter([]sink{newHTTPSink(server.URL)}, queueSize)
+	now := time.Now()
+
+	e.emit(TypeCreated, Data{Path: "/etc/crio/auth/ns-0.json", Namespace: "ns", Image: "quay.io/org/app"}, now)
+	e.emit(TypeDeleted, Data{Path: "/etc/crio/auth/ns-0.json", Namespace: "ns"}, now)
+	e.flush(5 * time.Second)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	require.Len(t, received, 2)
+
+	for i, eventType := range []string{TypeCreated, TypeDeleted} {
+		event := received[i]
+		assert.Equal(t, specVersion, event.SpecVersion)
+		assert.Equal(t, eventType, event.Type)
+		assert.Equal(t, "/etc/crio/auth/ns-0.json", event.Subject)
+		assert.True(t, strings.HasPrefix(event.Source, sourcePrefix))
+		assert.NotEmpty(t, event.ID)
+		assert.True(t, now.Equal(event.Time))
+		assert.Equal(t, "ns", event.Data.Namespace)
+	}
+
+	assert.NotEqual(t, received[0].ID, received[1].ID)
+	assert.Equal(t, "quay.io/org/app", received[0].Data.Image)
+}
+
+func TestHTTPSinkFailure(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	err := newHTTPSink(server.URL).send(&Event{Type: TypeUpdated})
+	require.ErrorIs(t, err, errHTTPStatus)
+}
+
+func TestJournalSink(t *testing.T) {
+	t.Parallel()
+
+	event := &Event{
+		SpecVersion: specVersion,
+		ID:          "id",
+		Source:      sourcePrefix + "node",
+		Type:        TypeUpdated,
+		Subject:     "/etc/crio/auth/ns-0.json",
+		Data:        Data{Path: "/etc/crio/auth/ns-0.json", Namespace: "ns"},
+	}
+
+	for name, tc := range map[string]struct {
+		journal bool
+		assert  func(*Event, []byte, map[string]string)
+	}{
+		"success with journald": {
+			journal: true,
+			assert: func(event *Event, out []byte, vars map[string]string) {
+				assert.Empty(t, out)
+				assert.Equal(t, TypeUpdated, vars["CLOUDEVENT_TYPE"])
+				assert.Equal(t, event.Subject, vars["CLOUDEVENT_SUBJECT"])
+				assert.Equal(t, syslogIdentifier, vars["SYSLOG_IDENTIFIER"])
+			},
+		},
+		"success falling back to JSON lines": {
+			assert: func(event *Event, out []byte, vars map[string]string) {
+				assert.Nil(t, vars)
+
+				written := &Event{}
+				require.NoError(t, json.Unmarshal(out, written))
+				assert.Equal(t, event, written)
+				assert.True(t, bytes.HasSuffix(out, []byte("\n")))
+			},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var (
+				out  bytes.Buffer
+				vars map[string]string
+			)
+
+			s := &journalSink{fallback: &out}
+			if tc.journal {
+				s.sendJournal = func(message string, v map[string]string) error {
+					assert.JSONEq(t, `{"specversion":"1.0","id":"id","source":"/crio-credential-provider/node","type":"`+TypeUpdated+`","subject":"/etc/crio/auth/ns-0.json","time":"0001-01-01T00:00:00Z","datacontenttype":"","data":{"path":"/etc/crio/auth/ns-0.json","namespace":"ns"}}`, message)
+
+					vars = v
+
+					return nil
+				}
+			}
+
+			require.NoError(t, s.send(event))
+			tc.assert(event, out.Bytes(), vars)
+		})
+	}
+}
+
+func TestEmitDisabled(t *testing.T) {
+	t.Parallel()
+
+	// Must neither block nor panic without enabled sinks
+	Emit(TypeCreated, Data{Path: "/path"})
+	Flush()
+}
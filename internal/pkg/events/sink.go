@@ -0,0 +1,125 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/journal"
+)
+
+const (
+	// httpTimeout is the timeout of a single HTTP delivery.
+	httpTimeout = 5 * time.Second
+
+	// contentType is the content type of the structured CloudEvents mode.
+	contentType = "application/cloudevents+json; charset=UTF-8"
+
+	syslogIdentifier = "crio-credential-provider"
+)
+
+var errHTTPStatus = errors.New("unexpected HTTP response status")
+
+// journalAvailable reports whether journald accepts messages.
+var journalAvailable = journal.Enabled
+
+// httpSink posts every event in the structured content mode to an endpoint.
+type httpSink struct {
+	url    string
+	client *http.Client
+}
+
+func newHTTPSink(url string) *httpSink {
+	return &httpSink{url: url, client: &http.Client{Timeout: httpTimeout}}
+}
+
+func (s *httpSink) name() string {
+	return "HTTP"
+}
+
+func (s *httpSink) send(event *Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("marshal event: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), httpTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create event request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("send event request: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("%w: %s", errHTTPStatus, resp.Status)
+	}
+
+	return nil
+}
+
+// journalSink writes every event as structured journald record. The event
+// gets written as JSON line to the fallback writer if journald is not
+// available, for example in containers, where it gets collected from stderr.
+// Stdout cannot be used, because it carries the credential provider response.
+type journalSink struct {
+	sendJournal func(message string, vars map[string]string) error
+	fallback    io.Writer
+}
+
+func newJournalSink(fallback io.Writer) *journalSink {
+	s := &journalSink{fallback: fallback}
+
+	if journalAvailable() {
+		s.sendJournal = func(message string, vars map[string]string) error {
+			return journal.Send(message, journal.PriInfo, vars)
+		}
+	}
+
+	return s
+}
+
+func (s *journalSink) name() string {
+	return "journal"
+}
+
+func (s *journalSink) send(event *Event) error {
+	raw, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("marshal event: %w", err)
+	}
+
+	if s.sendJournal == nil {
+		if _, err := s.fallback.Write(append(raw, '\n')); err != nil {
+			return fmt.Errorf("write event: %w", err)
+		}
+
+		return nil
+	}
+
+	if err := s.sendJournal(string(raw), map[string]string{
+		"SYSLOG_IDENTIFIER":  syslogIdentifier,
+		"CLOUDEVENT_ID":      event.ID,
+		"CLOUDEVENT_TYPE":    event.Type,
+		"CLOUDEVENT_SOURCE":  event.Source,
+		"CLOUDEVENT_SUBJECT": event.Subject,
+	}); err != nil {
+		return fmt.Errorf("send journal event: %w", err)
+	}
+
+	return nil
+}
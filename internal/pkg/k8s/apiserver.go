@@ -0,0 +1,104 @@
+package k8s
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/logger"
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+)
+
+var errNoCA = errors.New("no CA bundle found to verify the API server certificate")
+
+// APIServerConfig returns the client configuration for connecting to the API
+// server with the bearer token. The configured host or otherwise the server of
+// the current cluster of the kubeconfig gets used as endpoint, which falls
+// back to APIServerHost only if the kubeconfig does not exist. The credentials of the kubeconfig are never
+// used, because the secrets have to be retrieved with the token.
+func APIServerConfig(cfg *config.Config, token string) (*rest.Config, error) {
+	tlsConfig, err := APIServerTLSConfig(&cfg.APIServer)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.APIServer.Host != "" {
+		return &rest.Config{Host: cfg.APIServer.Host, BearerToken: token, TLSClientConfig: tlsConfig}, nil
+	}
+
+	kubeconfig, err := loadKubeconfig(cfg.APIServer.Kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+
+	if kubeconfig == nil {
+		return &rest.Config{Host: APIServerHost(cfg.KubernetesConfigDir), BearerToken: token, TLSClientConfig: tlsConfig}, nil
+	}
+
+	logger.Debugf("Using API server host of kubeconfig %s: %s", cfg.APIServer.Kubeconfig, kubeconfig.Host)
+
+	if !tlsConfig.Insecure {
+		tlsConfig.ServerName = kubeconfig.ServerName
+	}
+
+	return &rest.Config{Host: kubeconfig.Host, BearerToken: token, TLSClientConfig: tlsConfig}, nil
+}
+
+// APIServerTLSConfig returns the TLS configuration for connecting to the API
+// server. The CA file takes precedence over the certificate authority of the
+// current cluster of the kubeconfig, while nothing gets verified in the
+// insecure mode.
+func APIServerTLSConfig(apiServer *config.APIServer) (rest.TLSClientConfig, error) {
+	if apiServer.Insecure {
+		return rest.TLSClientConfig{Insecure: true}, nil
+	}
+
+	if apiServer.CAFile != "" {
+		if _, err := os.Stat(apiServer.CAFile); err == nil {
+			return rest.TLSClientConfig{CAFile: apiServer.CAFile}, nil
+		} else if !os.IsNotExist(err) {
+			return rest.TLSClientConfig{}, fmt.Errorf("check CA file: %w", err)
+		}
+	}
+
+	kubeconfig, err := loadKubeconfig(apiServer.Kubeconfig)
+	if err != nil {
+		return rest.TLSClientConfig{}, err
+	}
+
+	if kubeconfig == nil {
+		return rest.TLSClientConfig{}, fmt.Errorf("%w: neither %q nor %q exist", errNoCA, apiServer.CAFile, apiServer.Kubeconfig)
+	}
+
+	if kubeconfig.CAFile == "" && len(kubeconfig.CAData) == 0 {
+		return rest.TLSClientConfig{}, fmt.Errorf("%w: kubeconfig %q has no certificate authority", errNoCA, apiServer.Kubeconfig)
+	}
+
+	return rest.TLSClientConfig{CAFile: kubeconfig.CAFile, CAData: kubeconfig.CAData}, nil
+}
+
+// loadKubeconfig returns the client configuration of the current context of
+// the kubeconfig at path, or nil if path is empty or does not exist.
+func loadKubeconfig(path string) (*rest.Config, error) {
+	if path == "" {
+		return nil, nil //nolint:nilnil // a missing kubeconfig is not an error
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil //nolint:nilnil // a missing kubeconfig is not an error
+		}
+
+		return nil, fmt.Errorf("check kubeconfig: %w", err)
+	}
+
+	restConfig, err := clientcmd.BuildConfigFromFlags("", path)
+	if err != nil {
+		return nil, fmt.Errorf("load kubeconfig: %w", err)
+	}
+
+	return restConfig, nil
+}
@@ -0,0 +1,146 @@
+package k8s
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/rest"
+
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+)
+
+// writeKubeconfig writes a kubeconfig with the additional fields of the
+// cluster and returns its path.
+func writeKubeconfig(t *testing.T, cluster string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "kubeconfig")
+	require.NoError(t, os.WriteFile(path, []byte(`apiVersion: v1
+kind: Config
+clusters:
+- name: default
+  cluster:
+    server: https://api.example.com:6443
+`+cluster+`
+contexts:
+- name: default
+  context:
+    cluster: default
+current-context: default
+`), 0o600))
+
+	return path
+}
+
+func TestAPIServerConfig(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	caFile := filepath.Join(dir, "kubelet-ca.crt")
+	require.NoError(t, os.WriteFile(caFile, []byte("ca"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "apiserver-url.env"), []byte("KUBERNETES_SERVICE_HOST=api.local\nKUBERNETES_SERVICE_PORT=6443\n"), 0o600))
+
+	for name, tc := range map[string]struct {
+		host       string
+		kubeconfig string
+		expected   *rest.Config
+	}{
+		"success with host": {
+			host:       "https://api.override:6443",
+			kubeconfig: writeKubeconfig(t, "    tls-server-name: kubernetes"),
+			expected: &rest.Config{
+				Host:            "https://api.override:6443",
+				BearerToken:     "token",
+				TLSClientConfig: rest.TLSClientConfig{CAFile: caFile},
+			},
+		},
+		"success with kubeconfig": {
+			kubeconfig: writeKubeconfig(t, "    tls-server-name: kubernetes"),
+			expected: &rest.Config{
+				Host:            "https://api.example.com:6443",
+				BearerToken:     "token",
+				TLSClientConfig: rest.TLSClientConfig{CAFile: caFile, ServerName: "kubernetes"},
+			},
+		},
+		"success without kubeconfig": {
+			kubeconfig: filepath.Join(dir, "missing"),
+			expected: &rest.Config{
+				Host:            "api.local:6443",
+				BearerToken:     "token",
+				TLSClientConfig: rest.TLSClientConfig{CAFile: caFile},
+			},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := config.Default()
+			cfg.KubernetesConfigDir = dir
+			cfg.APIServer = config.APIServer{Host: tc.host, CAFile: caFile, Kubeconfig: tc.kubeconfig}
+
+			restConfig, err := APIServerConfig(cfg, "token")
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, restConfig)
+		})
+	}
+}
+
+func TestAPIServerTLSConfig(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	caFile := filepath.Join(dir, "kubelet-ca.crt")
+	require.NoError(t, os.WriteFile(caFile, []byte("ca"), 0o600))
+
+	missing := filepath.Join(dir, "missing")
+
+	for name, tc := range map[string]struct {
+		apiServer   config.APIServer
+		expected    rest.TLSClientConfig
+		expectedErr error
+	}{
+		"success insecure": {
+			apiServer: config.APIServer{CAFile: caFile, Insecure: true},
+			expected:  rest.TLSClientConfig{Insecure: true},
+		},
+		"success with CA file": {
+			apiServer: config.APIServer{CAFile: caFile, Kubeconfig: missing},
+			expected:  rest.TLSClientConfig{CAFile: caFile},
+		},
+		"success with kubeconfig CA data": {
+			apiServer: config.APIServer{CAFile: missing, Kubeconfig: writeKubeconfig(t, "    certificate-authority-data: Y2E=")},
+			expected:  rest.TLSClientConfig{CAData: []byte("ca")},
+		},
+		"success with kubeconfig CA file": {
+			apiServer: config.APIServer{Kubeconfig: writeKubeconfig(t, "    certificate-authority: "+caFile)},
+			expected:  rest.TLSClientConfig{CAFile: caFile},
+		},
+		"failure without CA": {
+			apiServer:   config.APIServer{CAFile: missing, Kubeconfig: missing},
+			expectedErr: errNoCA,
+		},
+		"failure on kubeconfig without CA": {
+			apiServer:   config.APIServer{CAFile: missing, Kubeconfig: writeKubeconfig(t, "")},
+			expectedErr: errNoCA,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			tlsConfig, err := APIServerTLSConfig(&tc.apiServer)
+			if tc.expectedErr != nil {
+				require.ErrorIs(t, err, tc.expectedErr)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, tlsConfig)
+		})
+	}
+}
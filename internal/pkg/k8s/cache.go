@@ -0,0 +1,76 @@
+package k8s
+
+import (
+	"crypto/sha256"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// maxCachedClaims is the maximum number of cached token claims.
+const maxCachedClaims = 1024
+
+// parsedClaims caches the claims of already validated tokens, which
+// avoids parsing and validating the same token for every image pull of a pod
+// within the lifetime of its token.
+var parsedClaims = newClaimsCache(maxCachedClaims)
+
+// cachedClaims are the claims of a validated token. The identity gets mapped
+// on every lookup, because the mapping depends on the configuration.
+type cachedClaims struct {
+	claims  jwt.MapClaims
+	expires time.Time
+}
+
+// claimsCache caches the extracted claims keyed by the SHA-256 hash of the
+// token, which avoids keeping the tokens in memory. Tokens without expiry
+// never get cached.
+type claimsCache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[[sha256.Size]byte]cachedClaims
+}
+
+func newClaimsCache(size int) *claimsCache {
+	return &claimsCache{size: size, entries: map[[sha256.Size]byte]cachedClaims{}}
+}
+
+// get returns the cached claims of the token.
+func (c *claimsCache) get(token string) (cachedClaims, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[sha256.Sum256([]byte(token))]
+
+	return entry, ok
+}
+
+// add caches the claims of the token. Expired entries get evicted if the
+// cache is full, and an arbitrary one if none is expired.
+func (c *claimsCache) add(token string, entry cachedClaims, now time.Time) {
+	if entry.expires.IsZero() || c.size <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.entries) >= c.size {
+		for key, e := range c.entries {
+			if now.After(e.expires) {
+				delete(c.entries, key)
+			}
+		}
+	}
+
+	if len(c.entries) >= c.size {
+		for key := range c.entries {
+			delete(c.entries, key)
+
+			break
+		}
+	}
+
+	c.entries[sha256.Sum256([]byte(token))] = entry
+}
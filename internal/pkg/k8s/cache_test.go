@@ -0,0 +1,100 @@
+package k8s
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	cpv1 "k8s.io/kubelet/pkg/apis/credentialprovider/v1"
+)
+
+func TestExtractNamespaceCached(t *testing.T) {
+	t.Parallel()
+
+	signedToken := func(exp time.Time) string {
+		claims := jwt.MapClaims{k8sClaimKey: map[string]any{"namespace": "cached"}}
+		if !exp.IsZero() {
+			claims["exp"] = exp.Unix()
+		}
+
+		token, err := jwt.NewWithClaims(jwt.SigningMethodES256, claims).SignedString(getTestECDSAKey(t))
+		require.NoError(t, err)
+
+		return token
+	}
+
+	for name, tc := range map[string]struct {
+		exp          time.Time
+		leeway       time.Duration
+		cached       bool
+		shouldExpire bool
+	}{
+		"success caching token with expiry": {
+			exp:    time.Now().Add(time.Hour),
+			cached: true,
+		},
+		"success without caching token without expiry": {},
+		"failure on expired cached token": {
+			exp:          time.Now().Add(time.Second),
+			leeway:       -time.Minute,
+			cached:       true,
+			shouldExpire: true,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			req := &cpv1.CredentialProviderRequest{ServiceAccountToken: signedToken(tc.exp)}
+
+			namespace, err := ExtractNamespace(req, time.Minute)
+			require.NoError(t, err)
+			assert.Equal(t, "cached", namespace)
+
+			cached, ok := parsedClaims.get(req.ServiceAccountToken)
+			require.Equal(t, tc.cached, ok)
+
+			if !tc.cached {
+				return
+			}
+
+			assert.Equal(t, map[string]any{"namespace": "cached"}, cached.claims[k8sClaimKey])
+			assert.Equal(t, tc.exp.Unix(), cached.expires.Unix())
+
+			namespace, err = ExtractNamespace(req, tc.leeway)
+			if tc.shouldExpire {
+				require.ErrorIs(t, err, ErrTokenExpired)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, "cached", namespace)
+			}
+		})
+	}
+}
+
+func TestClaimsCacheEviction(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	c := newClaimsCache(2)
+
+	c.add("expired", cachedClaims{claims: jwt.MapClaims{"sub": "expired"}, expires: now.Add(-time.Minute)}, now)
+	c.add("valid", cachedClaims{claims: jwt.MapClaims{"sub": "valid"}, expires: now.Add(time.Hour)}, now)
+	c.add("new", cachedClaims{claims: jwt.MapClaims{"sub": "new"}, expires: now.Add(time.Hour)}, now)
+
+	_, ok := c.get("expired")
+	assert.False(t, ok)
+
+	for _, token := range []string{"valid", "new"} {
+		entry, ok := c.get(token)
+		require.True(t, ok)
+		assert.Equal(t, token, entry.claims["sub"])
+	}
+
+	c.add("full", cachedClaims{claims: jwt.MapClaims{"sub": "full"}, expires: now.Add(time.Hour)}, now)
+	assert.Len(t, c.entries, 2)
+
+	_, ok = c.get("full")
+	assert.True(t, ok)
+}
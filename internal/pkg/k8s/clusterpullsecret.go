@@ -0,0 +1,137 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/claims"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/logger"
+	"github.com/cri-o/crio-credential-provider/pkg/apis/v1alpha1"
+	"github.com/cri-o/crio-credential-provider/pkg/docker"
+)
+
+// clusterPullSecretsPath is the API path of the ClusterPullSecret resources.
+const clusterPullSecretsPath = "/apis/" + v1alpha1.Group + "/" + v1alpha1.Version + "/" + v1alpha1.ClusterPullSecretResource
+
+// listClusterResources lists the cluster scoped custom resources at the API
+// path into list.
+func listClusterResources(ctx context.Context, client kubernetes.Interface, apiPath string, list any) error {
+	raw, err := client.Discovery().RESTClient().Get().AbsPath(apiPath).DoRaw(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to list %s: %w", path.Base(apiPath), err)
+	}
+
+	if err := json.Unmarshal(raw, list); err != nil {
+		return fmt.Errorf("unable to decode %s: %w", path.Base(apiPath), err)
+	}
+
+	return nil
+}
+
+// selectsNamespace returns true if the namespace selector of a custom
+// resource selects the namespace. A missing selector selects no namespace.
+func selectsNamespace(kind, name string, namespaceSelector *metav1.LabelSelector, ns *corev1.Namespace) bool {
+	if namespaceSelector == nil {
+		return false
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(namespaceSelector)
+	if err != nil {
+		logger.Warnf("Skipping %s %s with invalid namespace selector: %v", kind, name, err)
+
+		return false
+	}
+
+	return selector.Matches(labels.Set(ns.Labels))
+}
+
+// RetrieveClusterPullSecrets returns the pull secrets distributed to the
+// namespace by ClusterPullSecret resources. The secrets only contain the
+// registry entries matching the registry patterns of the resource. Resources
+// referencing secrets which cannot be retrieved get skipped.
+func RetrieveClusterPullSecrets(ctx context.Context, client kubernetes.Interface, namespace string) (*corev1.SecretList, error) {
+	list := &v1alpha1.ClusterPullSecretList{}
+	if err := listClusterResources(ctx, client, clusterPullSecretsPath, list); err != nil {
+		return nil, err
+	}
+
+	res := &corev1.SecretList{Items: []corev1.Secret{}}
+
+	if len(list.Items) == 0 {
+		return res, nil
+	}
+
+	ns, err := client.CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get namespace %s: %w", namespace, err)
+	}
+
+	for i := range list.Items {
+		cps := &list.Items[i]
+		ref := cps.Spec.SecretRef
+
+		if !selectsNamespace("cluster pull secret", cps.Name, cps.Spec.NamespaceSelector, ns) {
+			continue
+		}
+
+		secret, err := client.CoreV1().Secrets(ref.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+		if err != nil {
+			logger.Warnf("Skipping cluster pull secret %s, unable to get secret %s/%s: %v", cps.Name, ref.Namespace, ref.Name, err)
+
+			continue
+		}
+
+		converted, ok := ConvertSecret(secret)
+		if !ok {
+			logger.Warnf("Skipping cluster pull secret %s, secret %s/%s is no pull secret", cps.Name, ref.Namespace, ref.Name)
+
+			continue
+		}
+
+		filtered, err := filterRegistries(converted, cps.Spec.Registries)
+		if err != nil {
+			logger.Warnf("Skipping cluster pull secret %s: %v", cps.Name, err)
+
+			continue
+		}
+
+		logger.Infof("Using cluster pull secret %s referencing secret %s/%s with %d registry entries", cps.Name, ref.Namespace, ref.Name, len(filtered.Auths))
+
+		converted = converted.DeepCopy()
+
+		converted.Data[corev1.DockerConfigJsonKey], err = json.Marshal(filtered)
+		if err != nil {
+			return nil, fmt.Errorf("unable to encode cluster pull secret %s: %w", cps.Name, err)
+		}
+
+		res.Items = append(res.Items, *converted)
+	}
+
+	return res, nil
+}
+
+// filterRegistries returns the docker config of the secret restricted to the
+// registry entries matching any of the patterns.
+func filterRegistries(secret *corev1.Secret, patterns []string) (*docker.ConfigJSON, error) {
+	config, _, err := docker.ParseConfigJSON(secret.Data[corev1.DockerConfigJsonKey])
+	if err != nil {
+		return nil, fmt.Errorf("secret %s/%s: %w", secret.Namespace, secret.Name, err)
+	}
+
+	filtered := &docker.ConfigJSON{Auths: map[string]docker.AuthConfig{}}
+
+	for registry, auth := range config.Auths {
+		if claims.MatchAny(patterns, registry) {
+			filtered.Auths[registry] = auth
+		}
+	}
+
+	return filtered, nil
+}
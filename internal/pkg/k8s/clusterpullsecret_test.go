@@ -0,0 +1,119 @@
+package k8s
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"github.com/cri-o/crio-credential-provider/pkg/apis/v1alpha1"
+	"github.com/cri-o/crio-credential-provider/pkg/docker"
+)
+
+// newTestAPIClient returns a client of an API server serving the objects by
+// their path.
+func newTestAPIClient(t *testing.T, objects map[string]any) kubernetes.Interface {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		obj, ok := objects[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			assert.NoError(t, json.NewEncoder(w).Encode(metav1.Status{Status: metav1.StatusFailure, Code: http.StatusNotFound, Reason: metav1.StatusReasonNotFound}))
+
+			return
+		}
+
+		assert.NoError(t, json.NewEncoder(w).Encode(obj))
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := kubernetes.NewForConfig(&rest.Config{Host: server.URL})
+	require.NoError(t, err)
+
+	return client
+}
+
+func TestRetrieveClusterPullSecrets(t *testing.T) {
+	t.Parallel()
+
+	clusterPullSecret := func(name, secret string, selector *metav1.LabelSelector, registries ...string) v1alpha1.ClusterPullSecret {
+		return v1alpha1.ClusterPullSecret{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: v1alpha1.ClusterPullSecretSpec{
+				Registries:        registries,
+				SecretRef:         v1alpha1.SecretReference{Namespace: "pull-secrets", Name: secret},
+				NamespaceSelector: selector,
+			},
+		}
+	}
+
+	objects := map[string]any{
+		clusterPullSecretsPath: v1alpha1.ClusterPullSecretList{Items: []v1alpha1.ClusterPullSecret{
+			clusterPullSecret("mirrors", "mirrors", &metav1.LabelSelector{MatchLabels: map[string]string{"team": "a"}}, "*.example.com"),
+			clusterPullSecret("all", "all", &metav1.LabelSelector{}, "quay.io/org"),
+			clusterPullSecret("other-team", "mirrors", &metav1.LabelSelector{MatchLabels: map[string]string{"team": "b"}}, "*.example.com"),
+			clusterPullSecret("no-selector", "mirrors", nil, "*.example.com"),
+			clusterPullSecret("missing", "missing", &metav1.LabelSelector{}, "*.example.com"),
+		}},
+		"/api/v1/namespaces/team-a": corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{Name: "team-a", Labels: map[string]string{"team": "a"}},
+		},
+		"/api/v1/namespaces/pull-secrets/secrets/mirrors": corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "mirrors", Namespace: "pull-secrets"},
+			Type:       corev1.SecretTypeDockerConfigJson,
+			Data: map[string][]byte{corev1.DockerConfigJsonKey: []byte(
+				`{"auths":{"https://mirror.example.com":{"auth":"bWlycm9y"},"quay.io":{"auth":"cXVheQ=="}}}`,
+			)},
+		},
+		"/api/v1/namespaces/pull-secrets/secrets/all": corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "all", Namespace: "pull-secrets"},
+			Type:       corev1.SecretTypeDockerConfigJson,
+			Data: map[string][]byte{corev1.DockerConfigJsonKey: []byte(
+				`{"auths":{"quay.io/org/app":{"auth":"YXBw"},"quay.io/other":{"auth":"b3RoZXI="}}}`,
+			)},
+		},
+	}
+
+	secrets, err := RetrieveClusterPullSecrets(t.Context(), newTestAPIClient(t, objects), "team-a")
+	require.NoError(t, err)
+	require.Len(t, secrets.Items, 2)
+
+	expected := map[string]docker.ConfigJSON{
+		"mirrors": {Auths: map[string]docker.AuthConfig{"https://mirror.example.com": {Auth: "bWlycm9y"}}},
+		"all":     {Auths: map[string]docker.AuthConfig{"quay.io/org/app": {Auth: "YXBw"}}},
+	}
+
+	for i := range secrets.Items {
+		secret := &secrets.Items[i]
+		assert.Equal(t, "pull-secrets", secret.Namespace)
+
+		config, _, err := docker.ParseConfigJSON(secret.Data[corev1.DockerConfigJsonKey])
+		require.NoError(t, err)
+		assert.Equal(t, expected[secret.Name], config)
+	}
+}
+
+func TestRetrieveClusterPullSecretsUnavailable(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	client, err := kubernetes.NewForConfig(&rest.Config{Host: server.URL})
+	require.NoError(t, err)
+
+	_, err = RetrieveClusterPullSecrets(t.Context(), client, "team-a")
+	require.Error(t, err)
+}
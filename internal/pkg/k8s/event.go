@@ -0,0 +1,56 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// eventComponent is the source component of the created events.
+const eventComponent = "crio-credential-provider"
+
+var errNoInvolvedObject = errors.New("neither pod nor service account of the workload is known")
+
+// CreateWarningEvent creates a warning event in the namespace of the
+// workload, which involves its pod or, if unknown, its service account. This
+// surfaces the reason to the tenant, for example within kubectl describe.
+func CreateWarningEvent(ctx context.Context, client kubernetes.Interface, namespace string, workload Workload, reason, message string) error {
+	involved := corev1.ObjectReference{Namespace: namespace}
+
+	switch {
+	case workload.Pod != "":
+		involved.Kind, involved.APIVersion, involved.Name = "Pod", "v1", workload.Pod
+	case workload.ServiceAccount != "":
+		involved.Kind, involved.APIVersion, involved.Name = "ServiceAccount", "v1", workload.ServiceAccount
+		involved.UID = types.UID(workload.ServiceAccountUID)
+	default:
+		return errNoInvolvedObject
+	}
+
+	now := metav1.NewTime(time.Now())
+
+	if _, err := client.CoreV1().Events(namespace).Create(ctx, &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: eventComponent + "-",
+			Namespace:    namespace,
+		},
+		InvolvedObject: involved,
+		Reason:         reason,
+		Message:        message,
+		Type:           corev1.EventTypeWarning,
+		Source:         corev1.EventSource{Component: eventComponent},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}, metav1.CreateOptions{}); err != nil {
+		return fmt.Errorf("unable to create event: %w", err)
+	}
+
+	return nil
+}
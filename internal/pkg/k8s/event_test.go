@@ -0,0 +1,59 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCreateWarningEvent(t *testing.T) {
+	t.Parallel()
+
+	for name, tc := range map[string]struct {
+		workload    Workload
+		expected    corev1.ObjectReference
+		expectedErr error
+	}{
+		"pod": {
+			workload: Workload{ServiceAccount: "sa", ServiceAccountUID: "uid", Pod: "pod"},
+			expected: corev1.ObjectReference{Kind: "Pod", APIVersion: "v1", Namespace: "ns", Name: "pod"},
+		},
+		"service account": {
+			workload: Workload{ServiceAccount: "sa", ServiceAccountUID: "uid"},
+			expected: corev1.ObjectReference{Kind: "ServiceAccount", APIVersion: "v1", Namespace: "ns", Name: "sa", UID: "uid"},
+		},
+		"unknown workload": {
+			expectedErr: errNoInvolvedObject,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			client := fake.NewClientset()
+
+			err := CreateWarningEvent(t.Context(), client, "ns", tc.workload, "Reason", "message")
+			if tc.expectedErr != nil {
+				require.ErrorIs(t, err, tc.expectedErr)
+
+				return
+			}
+
+			require.NoError(t, err)
+
+			events, err := client.CoreV1().Events("ns").List(t.Context(), metav1.ListOptions{})
+			require.NoError(t, err)
+			require.Len(t, events.Items, 1)
+
+			event := events.Items[0]
+			assert.Equal(t, tc.expected, event.InvolvedObject)
+			assert.Equal(t, corev1.EventTypeWarning, event.Type)
+			assert.Equal(t, "Reason", event.Reason)
+			assert.Equal(t, "message", event.Message)
+			assert.Equal(t, eventComponent, event.Source.Component)
+		})
+	}
+}
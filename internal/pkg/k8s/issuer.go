@@ -0,0 +1,269 @@
+package k8s
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/errcode"
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+)
+
+const (
+	// jwksMaxSize is the maximum size of a fetched JSON Web Key Set.
+	jwksMaxSize = 1 << 20
+
+	// jwksTimeout is the timeout for fetching a JSON Web Key Set.
+	jwksTimeout = 5 * time.Second
+)
+
+var (
+	// ErrUntrustedIssuer is returned if the service account token is not
+	// issued by any of the trusted issuers.
+	ErrUntrustedIssuer = errcode.New(errcode.UntrustedIssuer, "service account token issuer is not trusted")
+
+	errUnknownKey     = errors.New("no matching key in JSON Web Key Set")
+	errUnsupportedKey = errors.New("unsupported JSON Web Key")
+)
+
+// jwk is a single public key of a JSON Web Key Set, see RFC 7517.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// keySets caches the fetched JSON Web Key Sets by their URI, which avoids
+// fetching them for every token within the daemon.
+var keySets = struct {
+	sync.Mutex
+	keys map[string]map[string]crypto.PublicKey
+}{keys: map[string]map[string]crypto.PublicKey{}}
+
+// VerifyIssuer verifies that the token got issued by one of the trusted
+// issuers. The signature gets verified as well if the issuer has a JWKS URI.
+// Nothing gets verified if no issuers are configured. The time based claims
+// are validated by ExtractIdentity.
+func VerifyIssuer(ctx context.Context, token string, issuers []config.TokenIssuer) error {
+	if len(issuers) == 0 {
+		return nil
+	}
+
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(token, claims); err != nil {
+		return fmt.Errorf("unable to parse JWT token: %w", err)
+	}
+
+	iss, err := claims.GetIssuer()
+	if err != nil {
+		return fmt.Errorf("unable to get issuer: %w", err)
+	}
+
+	i := slices.IndexFunc(issuers, func(issuer config.TokenIssuer) bool {
+		return issuer.Issuer == iss
+	})
+	if i == -1 {
+		return fmt.Errorf("%w: %q", ErrUntrustedIssuer, iss)
+	}
+
+	issuer := &issuers[i]
+	if issuer.JWKSURI == "" {
+		return nil
+	}
+
+	parser := jwt.NewParser(
+		jwt.WithoutClaimsValidation(),
+		jwt.WithIssuer(issuer.Issuer),
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}),
+	)
+
+	if _, err := parser.Parse(token, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+
+		return publicKey(ctx, issuer, kid)
+	}); err != nil {
+		return fmt.Errorf("unable to verify token of issuer %q: %w", iss, err)
+	}
+
+	return nil
+}
+
+// publicKey returns the key of the issuer with the key ID, which gets fetched
+// again if it is not cached to support key rotations. Tokens without a key ID
+// require the key set to contain a single key.
+func publicKey(ctx context.Context, issuer *config.TokenIssuer, kid string) (crypto.PublicKey, error) {
+	keySets.Lock()
+	defer keySets.Unlock()
+
+	if key, ok := lookupKey(keySets.keys[issuer.JWKSURI], kid); ok {
+		return key, nil
+	}
+
+	keys, err := fetchKeySet(ctx, issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	keySets.keys[issuer.JWKSURI] = keys
+
+	if key, ok := lookupKey(keys, kid); ok {
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("%w: kid %q", errUnknownKey, kid)
+}
+
+func lookupKey(keys map[string]crypto.PublicKey, kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(keys) == 1 {
+		for _, key := range keys {
+			return key, true
+		}
+	}
+
+	key, ok := keys[kid]
+
+	return key, ok
+}
+
+// fetchKeySet fetches the signing keys of the JSON Web Key Set of the issuer
+// by their key ID. Unsupported keys get skipped.
+func fetchKeySet(ctx context.Context, issuer *config.TokenIssuer) (map[string]crypto.PublicKey, error) {
+	client, err := jwksClient(issuer.CAFile)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, issuer.JWKSURI, http.NoBody)
+	if err != nil {
+		return nil, fmt.Errorf("create JWKS request: %w", err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch JWKS: unexpected status %s", resp.Status)
+	}
+
+	set := struct {
+		Keys []jwk `json:"keys"`
+	}{}
+	if err := json.NewDecoder(http.MaxBytesReader(nil, resp.Body, jwksMaxSize)).Decode(&set); err != nil {
+		return nil, fmt.Errorf("decode JWKS: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+
+	for i := range set.Keys {
+		if set.Keys[i].Use != "" && set.Keys[i].Use != "sig" {
+			continue
+		}
+
+		key, err := set.Keys[i].publicKey()
+		if err != nil {
+			continue
+		}
+
+		keys[set.Keys[i].Kid] = key
+	}
+
+	return keys, nil
+}
+
+// jwksClient returns the HTTP client trusting the CA bundle, or the system
+// roots if empty.
+func jwksClient(caFile string) (*http.Client, error) {
+	if caFile == "" {
+		return &http.Client{Timeout: jwksTimeout}, nil
+	}
+
+	raw, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("read CA file: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(raw) {
+		return nil, fmt.Errorf("no certificates found in CA file %s", caFile)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone() //nolint:forcetypeassert // always a transport
+	transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+
+	return &http.Client{Timeout: jwksTimeout, Transport: transport}, nil
+}
+
+// publicKey decodes the RSA or EC public key.
+func (k *jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("decode modulus: %w", err)
+		}
+
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("decode exponent: %w", err)
+		}
+
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("%w: exponent too large", errUnsupportedKey)
+		}
+
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+
+	case "EC":
+		curves := map[string]elliptic.Curve{"P-256": elliptic.P256(), "P-384": elliptic.P384(), "P-521": elliptic.P521()}
+
+		curve, ok := curves[k.Crv]
+		if !ok {
+			return nil, fmt.Errorf("%w: curve %q", errUnsupportedKey, k.Crv)
+		}
+
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("decode x coordinate: %w", err)
+		}
+
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("decode y coordinate: %w", err)
+		}
+
+		key, err := ecdsa.ParseUncompressedPublicKey(curve, append(append([]byte{4}, x...), y...))
+		if err != nil {
+			return nil, fmt.Errorf("parse EC key: %w", err)
+		}
+
+		return key, nil
+
+	default:
+		return nil, fmt.Errorf("%w: key type %q", errUnsupportedKey, k.Kty)
+	}
+}
@@ -0,0 +1,160 @@
+package k8s
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+)
+
+// serveJWKS serves the public keys by their key ID and returns the URI of
+// the key set together with the path of the CA file trusting the server.
+func serveJWKS(t *testing.T, keys map[string]any) (string, string) {
+	t.Helper()
+
+	set := struct {
+		Keys []jwk `json:"keys"`
+	}{}
+
+	for kid, key := range keys {
+		switch key := key.(type) {
+		case *ecdsa.PublicKey:
+			raw, err := key.Bytes()
+			require.NoError(t, err)
+
+			set.Keys = append(set.Keys, jwk{
+				Kty: "EC",
+				Kid: kid,
+				Crv: "P-256",
+				X:   base64.RawURLEncoding.EncodeToString(raw[1:33]),
+				Y:   base64.RawURLEncoding.EncodeToString(raw[33:]),
+			})
+
+		case *rsa.PublicKey:
+			set.Keys = append(set.Keys, jwk{
+				Kty: "RSA",
+				Kid: kid,
+				Use: "sig",
+				N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			})
+		}
+	}
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		assert.NoError(t, json.NewEncoder(w).Encode(set))
+	}))
+	t.Cleanup(server.Close)
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0o600))
+
+	return server.URL + "/openid/v1/jwks", caFile
+}
+
+func TestVerifyIssuer(t *testing.T) {
+	t.Parallel()
+
+	ecKey := getTestECDSAKey(t)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	jwksURI, caFile := serveJWKS(t, map[string]any{"ec": &ecKey.PublicKey, "rsa": &rsaKey.PublicKey})
+
+	sign := func(method jwt.SigningMethod, kid, iss string, key any) string {
+		token := jwt.NewWithClaims(method, jwt.MapClaims{"iss": iss})
+		token.Header["kid"] = kid
+
+		signed, err := token.SignedString(key)
+		require.NoError(t, err)
+
+		return signed
+	}
+
+	issuers := []config.TokenIssuer{
+		{Issuer: "https://kubernetes.default.svc"},
+		{Issuer: "https://aggregated.example.com", JWKSURI: jwksURI, CAFile: caFile},
+	}
+
+	for name, tc := range map[string]struct {
+		token       string
+		issuers     []config.TokenIssuer
+		expectedErr error
+		failure     bool
+	}{
+		"success without issuers": {
+			token: sign(jwt.SigningMethodES256, "", "https://unknown", otherKey),
+		},
+		"success with issuer without JWKS": {
+			token:   sign(jwt.SigningMethodES256, "", "https://kubernetes.default.svc", otherKey),
+			issuers: issuers,
+		},
+		"success with EC key": {
+			token:   sign(jwt.SigningMethodES256, "ec", "https://aggregated.example.com", ecKey),
+			issuers: issuers,
+		},
+		"success with RSA key": {
+			token:   sign(jwt.SigningMethodRS256, "rsa", "https://aggregated.example.com", rsaKey),
+			issuers: issuers,
+		},
+		"failure on unknown issuer": {
+			token:       sign(jwt.SigningMethodES256, "ec", "https://unknown", ecKey),
+			issuers:     issuers,
+			expectedErr: ErrUntrustedIssuer,
+		},
+		"failure on missing issuer": {
+			token:       sign(jwt.SigningMethodES256, "ec", "", ecKey),
+			issuers:     issuers,
+			expectedErr: ErrUntrustedIssuer,
+		},
+		"failure on invalid signature": {
+			token:       sign(jwt.SigningMethodES256, "ec", "https://aggregated.example.com", otherKey),
+			issuers:     issuers,
+			expectedErr: jwt.ErrTokenSignatureInvalid,
+		},
+		"failure on unknown key": {
+			token:       sign(jwt.SigningMethodES256, "other", "https://aggregated.example.com", otherKey),
+			issuers:     issuers,
+			expectedErr: errUnknownKey,
+		},
+		"failure on untrusted JWKS endpoint": {
+			token:   sign(jwt.SigningMethodES256, "ec", "https://untrusted.example.com", ecKey),
+			issuers: []config.TokenIssuer{{Issuer: "https://untrusted.example.com", JWKSURI: jwksURI + "?untrusted"}},
+			failure: true,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			err := VerifyIssuer(t.Context(), tc.token, tc.issuers)
+
+			switch {
+			case tc.expectedErr != nil:
+				require.ErrorIs(t, err, tc.expectedErr)
+			case tc.failure:
+				require.Error(t, err)
+			default:
+				require.NoError(t, err)
+			}
+		})
+	}
+}
@@ -7,35 +7,124 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/joho/godotenv"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
 	cpv1 "k8s.io/kubelet/pkg/apis/credentialprovider/v1"
 
+	"github.com/cri-o/crio-credential-provider/internal/pkg/errcode"
 	"github.com/cri-o/crio-credential-provider/internal/pkg/logger"
+	"github.com/cri-o/crio-credential-provider/pkg/config"
 )
 
 const k8sClaimKey = "kubernetes.io"
 
+// SecretFieldSelector selects all secrets considered by the credential provider.
+var SecretFieldSelector = "type=" + string(corev1.SecretTypeDockerConfigJson)
+
+// ErrTokenExpired is returned if the service account token is expired, even
+// when taking the configured leeway into account.
+var ErrTokenExpired = errcode.New(errcode.TokenExpired, "service account token is expired")
+
 var (
-	errRequestEmpty       = errors.New("request is empty")
-	errTokenEmpty         = errors.New("request service account token is empty")
-	errNoNamespaceInClaim = errors.New("no namespace found in kubernetes claim")
-	errNamespaceNotString = errors.New("namespace is not a string object")
-	errNoK8sClaimMap      = errors.New("kubernetes.io claim does not contain a map")
+	errRequestEmpty       = errcode.New(errcode.RequestEmpty, "request is empty")
+	errTokenEmpty         = errcode.New(errcode.TokenEmpty, "request service account token is empty")
+	errNoNamespaceInClaim = errcode.New(errcode.NoNamespaceInClaim, "no namespace found in kubernetes claim")
+	errNamespaceNotString = errcode.New(errcode.NamespaceNotString, "namespace is not a string object")
+	errNoK8sClaimMap      = errcode.New(errcode.NoKubernetesClaim, "kubernetes.io claim does not contain a map")
+	errMissingKey         = errcode.New(errcode.MissingSecretKey, "missing key")
 )
 
+// Identity is the identity of the workload a service account token got
+// issued for.
+type Identity struct {
+	// Namespace is the namespace of the service account.
+	Namespace string
+
+	// Workload attributes the token to the service account and pod.
+	Workload Workload
+}
+
+// Workload identifies the workload within a namespace which requested
+// credentials. All fields are optional, because they are not part of every
+// service account token.
+type Workload struct {
+	// ServiceAccount is the name of the service account.
+	ServiceAccount string `json:"serviceAccount,omitempty"`
+
+	// ServiceAccountUID is the UID of the service account.
+	ServiceAccountUID string `json:"serviceAccountUID,omitempty"`
+
+	// Pod is the name of the pod the token is bound to.
+	Pod string `json:"pod,omitempty"`
+
+	// PodUID is the UID of the pod the token is bound to.
+	PodUID string `json:"podUID,omitempty"`
+}
+
+// String returns the workload in a human readable form for logging.
+func (w Workload) String() string {
+	if w == (Workload{}) {
+		return "unknown workload"
+	}
+
+	var parts []string
+
+	if w.ServiceAccount != "" {
+		parts = append(parts, "service account "+w.ServiceAccount)
+	}
+
+	if w.ServiceAccountUID != "" {
+		parts = append(parts, "uid "+w.ServiceAccountUID)
+	}
+
+	if w.Pod != "" {
+		parts = append(parts, "pod "+w.Pod)
+	}
+
+	return strings.Join(parts, ", ")
+}
+
 // ExtractNamespace extracts the namespace from the provided credential provider request.
-func ExtractNamespace(req *cpv1.CredentialProviderRequest) (string, error) {
+// See ExtractIdentity for the validation of the token.
+func ExtractNamespace(req *cpv1.CredentialProviderRequest, leeway time.Duration) (string, error) {
+	identity, err := ExtractIdentity(req, leeway, kubernetesClaimMapper{})
+	if err != nil {
+		return "", err
+	}
+
+	return identity.Namespace, nil
+}
+
+// ExtractIdentity extracts the namespace together with the service account
+// and pod from the provided credential provider request by using the mapper.
+// The time based claims (exp, nbf, iat) of the token are validated by applying
+// the provided leeway to tolerate clock skew between the node and the API server.
+// The claims of already validated tokens get cached until their expiry.
+func ExtractIdentity(req *cpv1.CredentialProviderRequest, leeway time.Duration, mapper ClaimMapper) (*Identity, error) {
 	if req == nil {
-		return "", errRequestEmpty
+		return nil, errRequestEmpty
 	}
 
 	if req.ServiceAccountToken == "" {
-		return "", errTokenEmpty
+		return nil, errTokenEmpty
+	}
+
+	now := time.Now()
+
+	if cached, ok := parsedClaims.get(req.ServiceAccountToken); ok {
+		if now.After(cached.expires.Add(leeway)) {
+			return nil, fmt.Errorf("%w: %w", ErrTokenExpired, jwt.ErrTokenExpired)
+		}
+
+		return mapper.Identity(cached.claims)
 	}
 
 	// Use a reusable parser to avoid allocations
@@ -43,37 +132,51 @@ func ExtractNamespace(req *cpv1.CredentialProviderRequest) (string, error) {
 
 	claims := jwt.MapClaims{}
 	if _, _, err := parser.ParseUnverified(req.ServiceAccountToken, claims); err != nil {
-		return "", fmt.Errorf("unable to parse JWT token: %w", err)
+		return nil, fmt.Errorf("unable to parse JWT token: %w", err)
 	}
 
-	k8sClaim, ok := claims[k8sClaimKey]
-	if !ok {
-		return "", fmt.Errorf("no %s claim name in JWT claims found", k8sClaimKey)
+	if err := jwt.NewValidator(jwt.WithLeeway(leeway), jwt.WithIssuedAt()).Validate(claims); err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return nil, fmt.Errorf("%w: %w", ErrTokenExpired, err)
+		}
+
+		return nil, fmt.Errorf("unable to validate JWT time claims: %w", err)
 	}
 
-	k8sClaimMap, ok := k8sClaim.(map[string]any)
-	if !ok {
-		return "", errNoK8sClaimMap
+	identity, err := mapper.Identity(claims)
+	if err != nil {
+		return nil, err
 	}
 
-	namespaceAny, ok := k8sClaimMap["namespace"]
-	if !ok {
-		return "", errNoNamespaceInClaim
+	var expires time.Time
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+		expires = exp.Time
 	}
 
-	namespace, ok := namespaceAny.(string)
+	parsedClaims.add(req.ServiceAccountToken, cachedClaims{claims: claims, expires: expires}, now)
+
+	return identity, nil
+}
+
+// claimString returns the string value of key within the object of the
+// kubernetes.io claim, or an empty string if it does not exist.
+func claimString(k8sClaimMap map[string]any, object, key string) string {
+	objectMap, ok := k8sClaimMap[object].(map[string]any)
 	if !ok {
-		return "", errNamespaceNotString
+		return ""
 	}
 
-	return namespace, nil
+	value, _ := objectMap[key].(string)
+
+	return value
 }
 
 // ClientFunc is the function for retrieving the Kubernetes client.
 type ClientFunc func(token string) (kubernetes.Interface, error)
 
 // RetrieveSecrets collects all secrets from the localhost node using the Kubernetes API.
-func RetrieveSecrets(ctx context.Context, clientFunc ClientFunc, token, namespace string) (*corev1.SecretList, error) {
+// The Opaque and dockercfg secrets considered by cfg are included and translated.
+func RetrieveSecrets(ctx context.Context, clientFunc ClientFunc, token, namespace string, cfg *config.Secrets) (*corev1.SecretList, error) {
 	client, err := clientFunc(token)
 	if err != nil {
 		return nil, fmt.Errorf("unable to connect to Kubernetes API: %w", err)
@@ -81,12 +184,12 @@ func RetrieveSecrets(ctx context.Context, clientFunc ClientFunc, token, namespac
 
 	secrets, err := client.CoreV1().
 		Secrets(namespace).
-		List(ctx, metav1.ListOptions{FieldSelector: "type=" + string(corev1.SecretTypeDockerConfigJson)})
+		List(ctx, metav1.ListOptions{FieldSelector: FieldSelector(cfg)})
 	if err != nil {
 		return nil, fmt.Errorf("unable to retrieve secrets: %w", err)
 	}
 
-	return secrets, nil
+	return ConvertSecrets(secrets, cfg), nil
 }
 
 // APIServerHost can be used to retrieve the API server host:port combination
@@ -99,7 +202,7 @@ func APIServerHost(rootDir string) string {
 	)
 
 	if !filepath.IsAbs(rootDir) {
-		logger.L().Printf("Provided API server config dir %q is not an absolute path", rootDir)
+		logger.Warnf("Provided API server config dir %q is not an absolute path", rootDir)
 
 		return defaultHost
 	}
@@ -109,9 +212,9 @@ func APIServerHost(rootDir string) string {
 	envMap, err := godotenv.Read(envFilePath)
 	if err != nil {
 		if os.IsNotExist(err) {
-			logger.L().Printf("Unable to find env file %q, using default API server host: %s", envFilePath, defaultHost)
+			logger.Warnf("Unable to find env file %q, using default API server host: %s", envFilePath, defaultHost)
 		} else {
-			logger.L().Printf("Unable to read env file %q, using default API server host: %s", envFilePath, defaultHost)
+			logger.Warnf("Unable to read env file %q, using default API server host: %s", envFilePath, defaultHost)
 		}
 
 		return defaultHost
@@ -121,13 +224,40 @@ func APIServerHost(rootDir string) string {
 	servicePort := envMap["KUBERNETES_SERVICE_PORT"]
 
 	if serviceHost == "" || servicePort == "" {
-		logger.L().Printf("Env file %q missing KUBERNETES_SERVICE_HOST or KUBERNETES_SERVICE_PORT, using default API server host: %s", envFilePath, defaultHost)
+		logger.Warnf("Env file %q missing KUBERNETES_SERVICE_HOST or KUBERNETES_SERVICE_PORT, using default API server host: %s", envFilePath, defaultHost)
 
 		return defaultHost
 	}
 
 	host := serviceHost + ":" + servicePort
-	logger.L().Printf("Using API server host: %s", host)
+	logger.Debugf("Using API server host: %s", host)
 
 	return host
 }
+
+// NewClusterClient creates a Kubernetes client with cluster level credentials
+// from the provided kubeconfig path. The in-cluster configuration gets used if
+// the path is empty.
+func NewClusterClient(kubeconfig string) (kubernetes.Interface, error) {
+	var (
+		restConfig *rest.Config
+		err        error
+	)
+
+	if kubeconfig == "" {
+		restConfig, err = rest.InClusterConfig()
+	} else {
+		restConfig, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to build client config: %w", err)
+	}
+
+	client, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create client: %w", err)
+	}
+
+	return client, nil
+}
@@ -10,6 +10,7 @@ import (
 	"path/filepath"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/stretchr/testify/assert"
@@ -21,6 +22,8 @@ import (
 	"k8s.io/client-go/kubernetes/fake"
 	k8stesting "k8s.io/client-go/testing"
 	cpv1 "k8s.io/kubelet/pkg/apis/credentialprovider/v1"
+
+	"github.com/cri-o/crio-credential-provider/pkg/config"
 )
 
 var (
@@ -58,6 +61,7 @@ func TestExtractNamespace(t *testing.T) {
 	for name, tc := range map[string]struct {
 		req               *cpv1.CredentialProviderRequest
 		shouldErr         bool
+		expired           bool
 		expectedNamespace string
 	}{
 		"success": {
@@ -70,6 +74,41 @@ func TestExtractNamespace(t *testing.T) {
 			},
 			expectedNamespace: "default",
 		},
+		"success with expired token within leeway": {
+			req: &cpv1.CredentialProviderRequest{
+				ServiceAccountToken: prepareToken(jwt.MapClaims{
+					"exp": time.Now().Add(-30 * time.Second).Unix(),
+					"iat": time.Now().Add(30 * time.Second).Unix(),
+					k8sClaimKey: map[string]any{
+						"namespace": "default",
+					},
+				}),
+			},
+			expectedNamespace: "default",
+		},
+		"failed with expired token": {
+			req: &cpv1.CredentialProviderRequest{
+				ServiceAccountToken: prepareToken(jwt.MapClaims{
+					"exp": time.Now().Add(-2 * time.Minute).Unix(),
+					k8sClaimKey: map[string]any{
+						"namespace": "default",
+					},
+				}),
+			},
+			shouldErr: true,
+			expired:   true,
+		},
+		"failed with token not valid yet": {
+			req: &cpv1.CredentialProviderRequest{
+				ServiceAccountToken: prepareToken(jwt.MapClaims{
+					"nbf": time.Now().Add(2 * time.Minute).Unix(),
+					k8sClaimKey: map[string]any{
+						"namespace": "default",
+					},
+				}),
+			},
+			shouldErr: true,
+		},
 		"failed with empty request": {
 			shouldErr: true,
 		},
@@ -119,9 +158,10 @@ func TestExtractNamespace(t *testing.T) {
 		t.Run(name, func(t *testing.T) {
 			t.Parallel()
 
-			namespace, err := ExtractNamespace(tc.req)
+			namespace, err := ExtractNamespace(tc.req, time.Minute)
 			if tc.shouldErr {
 				require.Error(t, err)
+				assert.Equal(t, tc.expired, errors.Is(err, ErrTokenExpired))
 			} else {
 				require.NoError(t, err)
 				assert.Equal(t, tc.expectedNamespace, namespace)
@@ -137,6 +177,7 @@ func TestRetrieveSecrets(t *testing.T) {
 		clientFunc    ClientFunc
 		namespace     string
 		setupClient   func() kubernetes.Interface
+		secrets       config.Secrets
 		shouldErr     bool
 		expectedCount int
 	}{
@@ -162,6 +203,76 @@ func TestRetrieveSecrets(t *testing.T) {
 			},
 			expectedCount: 2,
 		},
+		"success with opaque secrets": {
+			namespace: "default",
+			secrets:   config.Secrets{Opaque: true},
+			setupClient: func() kubernetes.Interface {
+				return fake.NewClientset(
+					&corev1.Secret{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:        "secret1",
+							Namespace:   "default",
+							Annotations: map[string]string{OpaqueSecretAnnotation: "true"},
+						},
+						Type: corev1.SecretTypeOpaque,
+						Data: map[string][]byte{
+							OpaqueUsernameKey: []byte("user"),
+							OpaquePasswordKey: []byte("pass"),
+							OpaqueRegistryKey: []byte("quay.io"),
+						},
+					},
+					&corev1.Secret{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "secret2",
+							Namespace: "default",
+						},
+						Type: corev1.SecretTypeOpaque,
+					},
+					&corev1.Secret{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "secret3",
+							Namespace: "default",
+						},
+						Type: corev1.SecretTypeDockerConfigJson,
+					},
+				)
+			},
+			expectedCount: 2,
+		},
+		"success with dockercfg secrets": {
+			namespace: "default",
+			secrets:   config.Secrets{Dockercfg: true},
+			setupClient: func() kubernetes.Interface {
+				return fake.NewClientset(
+					&corev1.Secret{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "secret1",
+							Namespace: "default",
+						},
+						Type: corev1.SecretTypeDockercfg,
+						Data: map[string][]byte{
+							corev1.DockerConfigKey: []byte(`{"quay.io":{"auth":"dXNlcjpwYXNz"}}`),
+						},
+					},
+					&corev1.Secret{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:        "secret2",
+							Namespace:   "default",
+							Annotations: map[string]string{OpaqueSecretAnnotation: "true"},
+						},
+						Type: corev1.SecretTypeOpaque,
+					},
+					&corev1.Secret{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "secret3",
+							Namespace: "default",
+						},
+						Type: corev1.SecretTypeDockerConfigJson,
+					},
+				)
+			},
+			expectedCount: 2,
+		},
 		"success with no secrets": {
 			namespace: "empty",
 			setupClient: func() kubernetes.Interface {
@@ -201,7 +312,7 @@ func TestRetrieveSecrets(t *testing.T) {
 				}
 			}
 
-			secrets, err := RetrieveSecrets(context.Background(), clientFunc, "test-token", tc.namespace)
+			secrets, err := RetrieveSecrets(context.Background(), clientFunc, "test-token", tc.namespace, &tc.secrets)
 			if tc.shouldErr {
 				require.Error(t, err)
 			} else {
@@ -275,3 +386,54 @@ func TestAPIServerHost(t *testing.T) {
 		})
 	}
 }
+
+func TestExtractIdentity(t *testing.T) {
+	t.Parallel()
+
+	for name, tc := range map[string]struct {
+		claim    map[string]any
+		expected Workload
+	}{
+		"success with service account and pod": {
+			claim: map[string]any{
+				"namespace":      "default",
+				"serviceaccount": map[string]any{"name": "builder", "uid": "3f0c1d2e"},
+				"pod":            map[string]any{"name": "app-0", "uid": "9a8b7c6d"},
+			},
+			expected: Workload{ServiceAccount: "builder", ServiceAccountUID: "3f0c1d2e", Pod: "app-0", PodUID: "9a8b7c6d"},
+		},
+		"success without pod": {
+			claim: map[string]any{
+				"namespace":      "default",
+				"serviceaccount": map[string]any{"name": "builder"},
+			},
+			expected: Workload{ServiceAccount: "builder"},
+		},
+		"success ignoring malformed objects": {
+			claim: map[string]any{
+				"namespace":      "default",
+				"serviceaccount": "builder",
+				"pod":            map[string]any{"name": 1},
+			},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			token, err := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{k8sClaimKey: tc.claim}).SignedString(getTestECDSAKey(t))
+			require.NoError(t, err)
+
+			identity, err := ExtractIdentity(&cpv1.CredentialProviderRequest{ServiceAccountToken: token}, time.Minute, kubernetesClaimMapper{})
+			require.NoError(t, err)
+			assert.Equal(t, "default", identity.Namespace)
+			assert.Equal(t, tc.expected, identity.Workload)
+		})
+	}
+}
+
+func TestWorkloadString(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "unknown workload", Workload{}.String())
+	assert.Equal(t, "service account builder, uid 3f0c1d2e, pod app-0", Workload{ServiceAccount: "builder", ServiceAccountUID: "3f0c1d2e", Pod: "app-0"}.String())
+}
@@ -0,0 +1,112 @@
+package k8s
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/errcode"
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+)
+
+var errNoNamespaceAtPath = errcode.New(errcode.NoNamespaceAtPath, "no namespace string found in claims")
+
+// ClaimMapper extracts the identity out of the validated claims of a token.
+type ClaimMapper interface {
+	Identity(claims jwt.MapClaims) (*Identity, error)
+}
+
+// NewClaimMapper returns the claim mapper of the configuration, which is the
+// kubernetes.io claim layout of service account tokens if no claim paths are
+// configured.
+func NewClaimMapper(mapping *config.ClaimMapping) ClaimMapper {
+	if mapping == nil || !mapping.Enabled() {
+		return kubernetesClaimMapper{}
+	}
+
+	return &pathClaimMapper{mapping: *mapping}
+}
+
+// kubernetesClaimMapper maps the kubernetes.io claim of the service account
+// tokens issued by the API server.
+type kubernetesClaimMapper struct{}
+
+func (kubernetesClaimMapper) Identity(claims jwt.MapClaims) (*Identity, error) {
+	k8sClaim, ok := claims[k8sClaimKey]
+	if !ok {
+		return nil, fmt.Errorf("no %s claim name in JWT claims found", k8sClaimKey)
+	}
+
+	k8sClaimMap, ok := k8sClaim.(map[string]any)
+	if !ok {
+		return nil, errNoK8sClaimMap
+	}
+
+	namespaceAny, ok := k8sClaimMap["namespace"]
+	if !ok {
+		return nil, errNoNamespaceInClaim
+	}
+
+	namespace, ok := namespaceAny.(string)
+	if !ok {
+		return nil, errNamespaceNotString
+	}
+
+	return &Identity{
+		Namespace: namespace,
+		Workload: Workload{
+			ServiceAccount:    claimString(k8sClaimMap, "serviceaccount", "name"),
+			ServiceAccountUID: claimString(k8sClaimMap, "serviceaccount", "uid"),
+			Pod:               claimString(k8sClaimMap, "pod", "name"),
+			PodUID:            claimString(k8sClaimMap, "pod", "uid"),
+		},
+	}, nil
+}
+
+// pathClaimMapper maps the claims at the configured paths, which supports
+// tokens of external OIDC issuers or virtual clusters nesting the identity
+// differently.
+type pathClaimMapper struct {
+	mapping config.ClaimMapping
+}
+
+func (m *pathClaimMapper) Identity(claims jwt.MapClaims) (*Identity, error) {
+	namespace := claimPath(claims, m.mapping.Namespace)
+	if namespace == "" {
+		return nil, fmt.Errorf("%w at %q", errNoNamespaceAtPath, strings.Join(m.mapping.Namespace, "."))
+	}
+
+	return &Identity{
+		Namespace: namespace,
+		Workload: Workload{
+			ServiceAccount:    claimPath(claims, m.mapping.ServiceAccount),
+			ServiceAccountUID: claimPath(claims, m.mapping.ServiceAccountUID),
+			Pod:               claimPath(claims, m.mapping.Pod),
+			PodUID:            claimPath(claims, m.mapping.PodUID),
+		},
+	}, nil
+}
+
+// claimPath returns the string value at the path of nested objects within
+// the claims, or an empty string if it does not exist.
+func claimPath(claims map[string]any, path []string) string {
+	if len(path) == 0 {
+		return ""
+	}
+
+	var value any = claims
+
+	for _, key := range path {
+		object, ok := value.(map[string]any)
+		if !ok {
+			return ""
+		}
+
+		value = object[key]
+	}
+
+	res, _ := value.(string)
+
+	return res
+}
@@ -0,0 +1,103 @@
+package k8s
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	cpv1 "k8s.io/kubelet/pkg/apis/credentialprovider/v1"
+
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+)
+
+func TestNewClaimMapper(t *testing.T) {
+	t.Parallel()
+
+	assert.IsType(t, kubernetesClaimMapper{}, NewClaimMapper(nil))
+	assert.IsType(t, kubernetesClaimMapper{}, NewClaimMapper(&config.ClaimMapping{}))
+	assert.IsType(t, &pathClaimMapper{}, NewClaimMapper(&config.ClaimMapping{Namespace: []string{"namespace"}}))
+}
+
+func TestPathClaimMapper(t *testing.T) {
+	t.Parallel()
+
+	mapper := NewClaimMapper(&config.ClaimMapping{
+		Namespace:      []string{"ext", "vcluster.loft.sh/namespace"},
+		ServiceAccount: []string{"ext", "serviceaccount", "name"},
+		Pod:            []string{"pod"},
+	})
+
+	for name, tc := range map[string]struct {
+		claims      jwt.MapClaims
+		expected    *Identity
+		expectedErr error
+	}{
+		"success": {
+			claims: jwt.MapClaims{
+				"ext": map[string]any{
+					"vcluster.loft.sh/namespace": "team-a",
+					"serviceaccount":             map[string]any{"name": "builder"},
+				},
+				"pod": "app-0",
+			},
+			expected: &Identity{Namespace: "team-a", Workload: Workload{ServiceAccount: "builder", Pod: "app-0"}},
+		},
+		"success ignoring malformed optional claims": {
+			claims: jwt.MapClaims{
+				"ext": map[string]any{"vcluster.loft.sh/namespace": "team-a", "serviceaccount": "builder"},
+				"pod": 1,
+			},
+			expected: &Identity{Namespace: "team-a"},
+		},
+		"failure on missing namespace": {
+			claims:      jwt.MapClaims{k8sClaimKey: map[string]any{"namespace": "default"}},
+			expectedErr: errNoNamespaceAtPath,
+		},
+		"failure on namespace not being a string": {
+			claims:      jwt.MapClaims{"ext": map[string]any{"vcluster.loft.sh/namespace": map[string]any{}}},
+			expectedErr: errNoNamespaceAtPath,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			identity, err := mapper.Identity(tc.claims)
+			if tc.expectedErr != nil {
+				require.ErrorIs(t, err, tc.expectedErr)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, identity)
+		})
+	}
+}
+
+func TestExtractIdentityMapped(t *testing.T) {
+	t.Parallel()
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"exp":       time.Now().Add(time.Hour).Unix(),
+		k8sClaimKey: map[string]any{"namespace": "host"},
+		"ext":       map[string]any{"namespace": "virtual"},
+	}).SignedString(getTestECDSAKey(t))
+	require.NoError(t, err)
+
+	req := &cpv1.CredentialProviderRequest{ServiceAccountToken: token}
+
+	// The cached claims get mapped by every mapper separately
+	for _, tc := range []struct {
+		mapper   ClaimMapper
+		expected string
+	}{
+		{mapper: NewClaimMapper(nil), expected: "host"},
+		{mapper: NewClaimMapper(&config.ClaimMapping{Namespace: []string{"ext", "namespace"}}), expected: "virtual"},
+	} {
+		identity, err := ExtractIdentity(req, time.Minute, tc.mapper)
+		require.NoError(t, err)
+		assert.Equal(t, tc.expected, identity.Namespace)
+	}
+}
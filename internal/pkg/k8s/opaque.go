@@ -0,0 +1,177 @@
+package k8s
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/logger"
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+	"github.com/cri-o/crio-credential-provider/pkg/docker"
+)
+
+const (
+	// OpaqueSecretAnnotation marks Opaque secrets containing registry
+	// credentials if set to "true".
+	OpaqueSecretAnnotation = "crio-credential-provider.cri-o.io/registry-credentials"
+
+	// PullMirrorAnnotation is the service account annotation pinning the
+	// credentials of its workloads to the mirror of its value.
+	PullMirrorAnnotation = "crio-credential-provider.cri-o.io/pull-mirror"
+
+	// OpaqueUsernameKey is the key of the username within an Opaque secret.
+	OpaqueUsernameKey = "username"
+
+	// OpaquePasswordKey is the key of the password within an Opaque secret.
+	OpaquePasswordKey = "password"
+
+	// OpaqueRegistryKey is the key of the registry within an Opaque secret.
+	OpaqueRegistryKey = "registry"
+)
+
+// FieldSelector returns the field selector for listing the secrets. Opaque
+// and dockercfg secrets cannot be selected together with dockerconfigjson
+// ones, which means that all secrets have to be listed and filtered by using
+// ConvertSecrets if one of them is considered.
+func FieldSelector(cfg *config.Secrets) string {
+	if cfg.Opaque || cfg.Dockercfg {
+		return ""
+	}
+
+	return SecretFieldSelector
+}
+
+// ConvertSecrets returns the dockerconfigjson secrets of the list. The
+// considered Opaque and dockercfg secrets get translated into dockerconfigjson
+// ones, while all other secrets are dropped.
+func ConvertSecrets(list *corev1.SecretList, cfg *config.Secrets) *corev1.SecretList {
+	if !cfg.Opaque && !cfg.Dockercfg {
+		return list
+	}
+
+	converted := &corev1.SecretList{Items: make([]corev1.Secret, 0, len(list.Items))}
+
+	for i := range list.Items {
+		if !Considered(&list.Items[i], cfg) {
+			continue
+		}
+
+		if secret, ok := ConvertSecret(&list.Items[i]); ok {
+			converted.Items = append(converted.Items, *secret)
+		}
+	}
+
+	return converted
+}
+
+// Considered returns true if the type of the secret is considered by the
+// configuration, without checking the Opaque annotation.
+func Considered(secret *corev1.Secret, cfg *config.Secrets) bool {
+	switch secret.Type {
+	case corev1.SecretTypeDockerConfigJson:
+		return true
+
+	case corev1.SecretTypeOpaque:
+		return cfg.Opaque
+
+	case corev1.SecretTypeDockercfg:
+		return cfg.Dockercfg
+
+	default:
+		return false
+	}
+}
+
+// ConvertSecret returns the secret if it is of type dockerconfigjson, or the
+// translated secret if it is an annotated Opaque or a dockercfg one. Secrets
+// which cannot be translated result in a secret without data, which gets
+// treated as malformed. It returns false for all other secrets.
+func ConvertSecret(secret *corev1.Secret) (*corev1.Secret, bool) {
+	switch secret.Type {
+	case corev1.SecretTypeDockerConfigJson:
+		return secret, true
+
+	case corev1.SecretTypeDockercfg:
+		converted := secret.DeepCopy()
+		converted.Type = corev1.SecretTypeDockerConfigJson
+		converted.Data = map[string][]byte{}
+
+		data, err := legacyDockerConfig(secret.Data)
+		if err != nil {
+			// Keep the secret without data to get it reported as malformed
+			logger.Warnf("Unable to translate dockercfg secret %s/%s: %v", secret.Namespace, secret.Name, err)
+
+			return converted, true
+		}
+
+		converted.Data[corev1.DockerConfigJsonKey] = data
+
+		return converted, true
+
+	case corev1.SecretTypeOpaque:
+		if secret.Annotations[OpaqueSecretAnnotation] != "true" {
+			return nil, false
+		}
+
+		converted := secret.DeepCopy()
+		converted.Type = corev1.SecretTypeDockerConfigJson
+		converted.Data = map[string][]byte{}
+
+		data, err := opaqueDockerConfig(secret.Data)
+		if err != nil {
+			// Keep the secret without data to get it reported as malformed
+			logger.Warnf("Unable to translate Opaque secret %s/%s: %v", secret.Namespace, secret.Name, err)
+
+			return converted, true
+		}
+
+		converted.Data[corev1.DockerConfigJsonKey] = data
+
+		return converted, true
+
+	default:
+		return nil, false
+	}
+}
+
+// legacyDockerConfig wraps the flat registry map of the .dockercfg key into
+// the auths object of a docker config JSON document.
+func legacyDockerConfig(data map[string][]byte) ([]byte, error) {
+	raw, ok := data[corev1.DockerConfigKey]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", errMissingKey, corev1.DockerConfigKey)
+	}
+
+	auths := map[string]docker.AuthConfig{}
+	if err := json.Unmarshal(raw, &auths); err != nil {
+		return nil, fmt.Errorf("unmarshal %s: %w", corev1.DockerConfigKey, err)
+	}
+
+	encoded, err := json.Marshal(docker.ConfigJSON{Auths: auths})
+	if err != nil {
+		return nil, fmt.Errorf("marshal docker config: %w", err)
+	}
+
+	return encoded, nil
+}
+
+func opaqueDockerConfig(data map[string][]byte) ([]byte, error) {
+	for _, key := range []string{OpaqueUsernameKey, OpaquePasswordKey, OpaqueRegistryKey} {
+		if len(data[key]) == 0 {
+			return nil, fmt.Errorf("%w: %s", errMissingKey, key)
+		}
+	}
+
+	auth := string(data[OpaqueUsernameKey]) + ":" + string(data[OpaquePasswordKey])
+
+	raw, err := json.Marshal(docker.ConfigJSON{Auths: map[string]docker.AuthConfig{
+		string(data[OpaqueRegistryKey]): {Auth: base64.StdEncoding.EncodeToString([]byte(auth))},
+	}})
+	if err != nil {
+		return nil, fmt.Errorf("marshal docker config: %w", err)
+	}
+
+	return raw, nil
+}
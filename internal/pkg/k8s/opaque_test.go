@@ -0,0 +1,106 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestConvertSecret(t *testing.T) {
+	t.Parallel()
+
+	annotated := metav1.ObjectMeta{
+		Name:        "secret",
+		Namespace:   "default",
+		Annotations: map[string]string{OpaqueSecretAnnotation: "true"},
+	}
+
+	for name, tc := range map[string]struct {
+		secret   corev1.Secret
+		expectOK bool
+		expected string
+	}{
+		"dockerconfigjson secret": {
+			secret: corev1.Secret{
+				Type: corev1.SecretTypeDockerConfigJson,
+				Data: map[string][]byte{corev1.DockerConfigJsonKey: []byte("{}")},
+			},
+			expectOK: true,
+			expected: "{}",
+		},
+		"annotated opaque secret": {
+			secret: corev1.Secret{
+				ObjectMeta: annotated,
+				Type:       corev1.SecretTypeOpaque,
+				Data: map[string][]byte{
+					OpaqueUsernameKey: []byte("user"),
+					OpaquePasswordKey: []byte("pass"),
+					OpaqueRegistryKey: []byte("quay.io"),
+				},
+			},
+			expectOK: true,
+			expected: `{"auths":{"quay.io":{"auth":"dXNlcjpwYXNz"}}}`,
+		},
+		"opaque secret without annotation": {
+			secret: corev1.Secret{
+				Type: corev1.SecretTypeOpaque,
+				Data: map[string][]byte{
+					OpaqueUsernameKey: []byte("user"),
+					OpaquePasswordKey: []byte("pass"),
+					OpaqueRegistryKey: []byte("quay.io"),
+				},
+			},
+		},
+		"annotated opaque secret missing registry": {
+			secret: corev1.Secret{
+				ObjectMeta: annotated,
+				Type:       corev1.SecretTypeOpaque,
+				Data: map[string][]byte{
+					OpaqueUsernameKey: []byte("user"),
+					OpaquePasswordKey: []byte("pass"),
+				},
+			},
+			expectOK: true,
+		},
+		"dockercfg secret": {
+			secret: corev1.Secret{
+				Type: corev1.SecretTypeDockercfg,
+				Data: map[string][]byte{corev1.DockerConfigKey: []byte(`{"quay.io":{"auth":"dXNlcjpwYXNz"}}`)},
+			},
+			expectOK: true,
+			expected: `{"auths":{"quay.io":{"auth":"dXNlcjpwYXNz"}}}`,
+		},
+		"malformed dockercfg secret": {
+			secret: corev1.Secret{
+				Type: corev1.SecretTypeDockercfg,
+				Data: map[string][]byte{corev1.DockerConfigKey: []byte("invalid")},
+			},
+			expectOK: true,
+		},
+		"other secret type": {
+			secret: corev1.Secret{Type: corev1.SecretTypeServiceAccountToken},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			converted, ok := ConvertSecret(&tc.secret)
+			require.Equal(t, tc.expectOK, ok)
+
+			if !tc.expectOK {
+				return
+			}
+
+			assert.Equal(t, corev1.SecretTypeDockerConfigJson, converted.Type)
+
+			if tc.expected == "" {
+				assert.NotContains(t, converted.Data, corev1.DockerConfigJsonKey)
+			} else {
+				assert.JSONEq(t, tc.expected, string(converted.Data[corev1.DockerConfigJsonKey]))
+			}
+		})
+	}
+}
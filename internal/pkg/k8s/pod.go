@@ -0,0 +1,139 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/errcode"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/logger"
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+)
+
+var (
+	errNoWorkload     = errcode.New(errcode.NoWorkload, "service account token is neither bound to a pod nor a service account")
+	errPodUIDMismatch = errcode.New(errcode.PodUIDMismatch, "pod UID does not match the token")
+)
+
+// RetrieveImagePullSecrets returns the names of the imagePullSecrets of the
+// pod of the workload, which are the secrets the kubelet uses for pulling its
+// images. They already contain the imagePullSecrets of the service account,
+// because the service account admission adds them to the pod on creation. A
+// pod recreated with the same name is rejected if the workload has a pod UID.
+func RetrieveImagePullSecrets(ctx context.Context, client kubernetes.Interface, namespace string, workload Workload) ([]string, error) {
+	p, err := client.CoreV1().Pods(namespace).Get(ctx, workload.Pod, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get pod %s/%s: %w", namespace, workload.Pod, err)
+	}
+
+	if workload.PodUID != "" && string(p.UID) != workload.PodUID {
+		return nil, fmt.Errorf("%w: pod %s/%s has UID %s instead of %s", errPodUIDMismatch, namespace, workload.Pod, p.UID, workload.PodUID)
+	}
+
+	return referenceNames(p.Spec.ImagePullSecrets), nil
+}
+
+// WorkloadPullSecrets returns the names of the imagePullSecrets of the pod and
+// the service account of the workload. The ones of the service account are
+// retrieved as well, because they may have been added after the pod got
+// created.
+func WorkloadPullSecrets(ctx context.Context, client kubernetes.Interface, namespace string, workload Workload) ([]string, error) {
+	if workload.Pod == "" && workload.ServiceAccount == "" {
+		return nil, errNoWorkload
+	}
+
+	names := []string{}
+
+	if workload.Pod != "" {
+		podNames, err := RetrieveImagePullSecrets(ctx, client, namespace, workload)
+		if err != nil {
+			return nil, err
+		}
+
+		names = append(names, podNames...)
+	}
+
+	if workload.ServiceAccount != "" {
+		sa, err := client.CoreV1().ServiceAccounts(namespace).Get(ctx, workload.ServiceAccount, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("unable to get service account %s/%s: %w", namespace, workload.ServiceAccount, err)
+		}
+
+		for _, name := range referenceNames(sa.ImagePullSecrets) {
+			if !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+
+	return names, nil
+}
+
+// RetrieveWorkloadSecrets gets the imagePullSecrets of the pod and the service
+// account of the workload, instead of listing all secrets of the namespace.
+// Referenced secrets which do not exist get skipped like by the kubelet.
+// The Opaque and dockercfg secrets considered by cfg are included and translated.
+func RetrieveWorkloadSecrets(ctx context.Context, clientFunc ClientFunc, token, namespace string, workload Workload, cfg *config.Secrets) (*corev1.SecretList, error) {
+	client, err := clientFunc(token)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to Kubernetes API: %w", err)
+	}
+
+	names, err := WorkloadPullSecrets(ctx, client, namespace, workload)
+	if err != nil {
+		return nil, err
+	}
+
+	list := &corev1.SecretList{Items: make([]corev1.Secret, 0, len(names))}
+
+	for _, name := range names {
+		secret, err := client.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			logger.Warnf("Skipping imagePullSecret %s/%s of %s: not found", namespace, name, workload)
+
+			continue
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("unable to get secret %s/%s: %w", namespace, name, err)
+		}
+
+		if !Considered(secret, cfg) {
+			continue
+		}
+
+		if secret, ok := ConvertSecret(secret); ok {
+			list.Items = append(list.Items, *secret)
+		}
+	}
+
+	return list, nil
+}
+
+// FilterSecrets returns the secrets of the list with the provided names.
+func FilterSecrets(list *corev1.SecretList, names []string) *corev1.SecretList {
+	filtered := &corev1.SecretList{Items: make([]corev1.Secret, 0, len(names))}
+
+	for i := range list.Items {
+		if slices.Contains(names, list.Items[i].Name) {
+			filtered.Items = append(filtered.Items, list.Items[i])
+		}
+	}
+
+	return filtered
+}
+
+func referenceNames(refs []corev1.LocalObjectReference) []string {
+	names := make([]string, 0, len(refs))
+
+	for _, ref := range refs {
+		names = append(names, ref.Name)
+	}
+
+	return names
+}
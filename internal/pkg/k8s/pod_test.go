@@ -0,0 +1,115 @@
+package k8s
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+)
+
+func TestRetrieveWorkloadSecrets(t *testing.T) {
+	t.Parallel()
+
+	const namespace = "default"
+
+	secret := func(name string, secretType corev1.SecretType) *corev1.Secret {
+		return &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace}, Type: secretType}
+	}
+
+	objects := func() []runtime.Object {
+		return []runtime.Object{
+			&corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "app-0", Namespace: namespace, UID: "9a8b7c6d"},
+				Spec: corev1.PodSpec{ImagePullSecrets: []corev1.LocalObjectReference{
+					{Name: "pod"}, {Name: "shared"}, {Name: "missing"}, {Name: "opaque"},
+				}},
+			},
+			&corev1.ServiceAccount{
+				ObjectMeta:       metav1.ObjectMeta{Name: "builder", Namespace: namespace},
+				ImagePullSecrets: []corev1.LocalObjectReference{{Name: "shared"}, {Name: "sa"}},
+			},
+			secret("pod", corev1.SecretTypeDockerConfigJson),
+			secret("shared", corev1.SecretTypeDockerConfigJson),
+			secret("sa", corev1.SecretTypeDockerConfigJson),
+			secret("opaque", corev1.SecretTypeOpaque),
+			secret("unrelated", corev1.SecretTypeDockerConfigJson),
+		}
+	}
+
+	for name, tc := range map[string]struct {
+		workload  Workload
+		getErr    bool
+		expected  []string
+		shouldErr error
+	}{
+		"success with pod and service account": {
+			workload: Workload{ServiceAccount: "builder", Pod: "app-0", PodUID: "9a8b7c6d"},
+			expected: []string{"pod", "shared", "sa"},
+		},
+		"success with pod only": {
+			workload: Workload{Pod: "app-0"},
+			expected: []string{"pod", "shared"},
+		},
+		"success with service account only": {
+			workload: Workload{ServiceAccount: "builder"},
+			expected: []string{"shared", "sa"},
+		},
+		"failure on recreated pod": {
+			workload:  Workload{ServiceAccount: "builder", Pod: "app-0", PodUID: "other"},
+			shouldErr: errPodUIDMismatch,
+		},
+		"failure without workload": {
+			shouldErr: errNoWorkload,
+		},
+		"failure on secret retrieval": {
+			workload: Workload{Pod: "app-0"},
+			getErr:   true,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			client := fake.NewClientset(objects()...)
+			if tc.getErr {
+				client.PrependReactor("get", "secrets", func(k8stesting.Action) (bool, runtime.Object, error) {
+					return true, nil, errors.New("forbidden")
+				})
+			}
+
+			clientFunc := func(string) (kubernetes.Interface, error) {
+				return client, nil
+			}
+
+			secrets, err := RetrieveWorkloadSecrets(t.Context(), clientFunc, "token", namespace, tc.workload, &config.Secrets{})
+
+			switch {
+			case tc.shouldErr != nil:
+				require.ErrorIs(t, err, tc.shouldErr)
+			case tc.getErr:
+				require.Error(t, err)
+			default:
+				require.NoError(t, err)
+
+				names := []string{}
+				for i := range secrets.Items {
+					names = append(names, secrets.Items[i].Name)
+				}
+
+				assert.Equal(t, tc.expected, names)
+
+				for _, action := range client.Actions() {
+					assert.NotEqual(t, "list", action.GetVerb())
+				}
+			}
+		})
+	}
+}
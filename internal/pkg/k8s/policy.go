@@ -0,0 +1,61 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/logger"
+	"github.com/cri-o/crio-credential-provider/pkg/apis/v1alpha1"
+)
+
+// registryCredentialPoliciesPath is the API path of the
+// RegistryCredentialPolicy resources.
+const registryCredentialPoliciesPath = "/apis/" + v1alpha1.Group + "/" + v1alpha1.Version + "/" + v1alpha1.RegistryCredentialPolicyResource
+
+// RetrieveRegistryCredentialPolicy returns the RegistryCredentialPolicy
+// selecting the namespace, or nil if there is none. The first policy by name
+// wins if multiple policies select the namespace.
+func RetrieveRegistryCredentialPolicy(ctx context.Context, client kubernetes.Interface, namespace string) (*v1alpha1.RegistryCredentialPolicy, error) {
+	list := &v1alpha1.RegistryCredentialPolicyList{}
+	if err := listClusterResources(ctx, client, registryCredentialPoliciesPath, list); err != nil {
+		return nil, err
+	}
+
+	if len(list.Items) == 0 {
+		return nil, nil //nolint:nilnil // no policy is not an error
+	}
+
+	ns, err := client.CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get namespace %s: %w", namespace, err)
+	}
+
+	slices.SortFunc(list.Items, func(a, b v1alpha1.RegistryCredentialPolicy) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	var selected *v1alpha1.RegistryCredentialPolicy
+
+	for i := range list.Items {
+		policy := &list.Items[i]
+
+		if !selectsNamespace("registry credential policy", policy.Name, policy.Spec.NamespaceSelector, ns) {
+			continue
+		}
+
+		if selected != nil {
+			logger.Warnf("Ignoring registry credential policy %s for namespace %s, policy %s already applies", policy.Name, namespace, selected.Name)
+
+			continue
+		}
+
+		selected = policy
+	}
+
+	return selected, nil
+}
@@ -0,0 +1,72 @@
+package k8s
+
+import (
+	"maps"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/cri-o/crio-credential-provider/pkg/apis/v1alpha1"
+)
+
+func TestRetrieveRegistryCredentialPolicy(t *testing.T) {
+	t.Parallel()
+
+	policy := func(name string, selector *metav1.LabelSelector) v1alpha1.RegistryCredentialPolicy {
+		return v1alpha1.RegistryCredentialPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec:       v1alpha1.RegistryCredentialPolicySpec{NamespaceSelector: selector},
+		}
+	}
+
+	namespaces := map[string]any{
+		"/api/v1/namespaces/team-a": corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{Name: "team-a", Labels: map[string]string{"team": "a"}},
+		},
+	}
+
+	for name, tc := range map[string]struct {
+		policies []v1alpha1.RegistryCredentialPolicy
+		expected string
+	}{
+		"success selecting first policy by name": {
+			policies: []v1alpha1.RegistryCredentialPolicy{
+				policy("z-all", &metav1.LabelSelector{}),
+				policy("a-team", &metav1.LabelSelector{MatchLabels: map[string]string{"team": "a"}}),
+				policy("b-other", &metav1.LabelSelector{MatchLabels: map[string]string{"team": "b"}}),
+			},
+			expected: "a-team",
+		},
+		"success without selecting policy": {
+			policies: []v1alpha1.RegistryCredentialPolicy{
+				policy("no-selector", nil),
+				policy("other", &metav1.LabelSelector{MatchLabels: map[string]string{"team": "b"}}),
+			},
+		},
+		"success without policies": {},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			objects := map[string]any{
+				registryCredentialPoliciesPath: v1alpha1.RegistryCredentialPolicyList{Items: tc.policies},
+			}
+			maps.Copy(objects, namespaces)
+
+			res, err := RetrieveRegistryCredentialPolicy(t.Context(), newTestAPIClient(t, objects), "team-a")
+			require.NoError(t, err)
+
+			if tc.expected == "" {
+				assert.Nil(t, res)
+
+				return
+			}
+
+			require.NotNil(t, res)
+			assert.Equal(t, tc.expected, res.Name)
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package k8s
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/logger"
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+)
+
+// RetrieveTLSSecrets returns the referenced kubernetes.io/tls secrets, which
+// contain the client certificates of registries requiring mutual TLS.
+// Secrets which cannot be retrieved or have another type get skipped.
+func RetrieveTLSSecrets(ctx context.Context, client kubernetes.Interface, refs []config.SecretReference) *corev1.SecretList {
+	res := &corev1.SecretList{Items: []corev1.Secret{}}
+
+	for _, ref := range refs {
+		secret, err := client.CoreV1().Secrets(ref.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+		if err != nil {
+			logger.Warnf("Skipping registry TLS secret %s/%s: %v", ref.Namespace, ref.Name, err)
+
+			continue
+		}
+
+		if secret.Type != corev1.SecretTypeTLS {
+			logger.Warnf("Skipping registry TLS secret %s/%s of type %s", ref.Namespace, ref.Name, secret.Type)
+
+			continue
+		}
+
+		res.Items = append(res.Items, *secret)
+	}
+
+	return res
+}
@@ -0,0 +1,36 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+)
+
+func TestRetrieveTLSSecrets(t *testing.T) {
+	t.Parallel()
+
+	client := fake.NewClientset(
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "registry-tls"},
+			Type:       corev1.SecretTypeTLS,
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "pull-secret"},
+			Type:       corev1.SecretTypeDockerConfigJson,
+		},
+	)
+
+	secrets := RetrieveTLSSecrets(t.Context(), client, []config.SecretReference{
+		{Namespace: "kube-system", Name: "registry-tls"},
+		{Namespace: "kube-system", Name: "pull-secret"},
+		{Namespace: "kube-system", Name: "missing"},
+	})
+
+	assert.Len(t, secrets.Items, 1)
+	assert.Equal(t, "registry-tls", secrets.Items[0].Name)
+}
@@ -0,0 +1,152 @@
+package k8s
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	cpv1 "k8s.io/kubelet/pkg/apis/credentialprovider/v1"
+)
+
+const (
+	// RequestAPIVersion is the default API version of the credential provider
+	// request.
+	RequestAPIVersion = "credentialprovider.kubelet.k8s.io/v1"
+
+	// RequestAPIVersionV1Beta1 is the API version of the credential provider
+	// request used by kubelets configured with the beta API.
+	RequestAPIVersionV1Beta1 = "credentialprovider.kubelet.k8s.io/v1beta1"
+
+	// RequestAPIVersionV1Alpha1 is the API version of the credential provider
+	// request used by kubelets configured with the alpha API.
+	RequestAPIVersionV1Alpha1 = "credentialprovider.kubelet.k8s.io/v1alpha1"
+
+	// RequestKind is the supported kind of the credential provider request.
+	RequestKind = "CredentialProviderRequest"
+)
+
+// RequestAPIVersions are the supported API versions of the credential
+// provider request, which share the same request and response shape.
+var RequestAPIVersions = []string{RequestAPIVersion, RequestAPIVersionV1Beta1, RequestAPIVersionV1Alpha1}
+
+// APIVersion returns the API version of the raw request, which the response
+// has to use as well. Requests without a supported API version, including
+// malformed ones, result in RequestAPIVersion.
+func APIVersion(raw []byte) string {
+	req := struct {
+		APIVersion string `json:"apiVersion"`
+	}{}
+
+	if err := json.Unmarshal(raw, &req); err != nil || !slices.Contains(RequestAPIVersions, req.APIVersion) {
+		return RequestAPIVersion
+	}
+
+	return req.APIVersion
+}
+
+// DecodeRequest reads the credential provider request from r and validates it
+// against the schema of the credentialprovider.kubelet.k8s.io API. The
+// v1alpha1 and v1beta1 requests get decoded into the v1 request, which keeps
+// their apiVersion. All violations get reported together with their field
+// path.
+func DecodeRequest(r io.Reader) (*cpv1.CredentialProviderRequest, error) {
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("read request: %w", err)
+	}
+
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, fmt.Errorf("request is not a JSON object: %w", err)
+	}
+
+	if errs := validateRequest(fields); len(errs) > 0 {
+		return nil, fmt.Errorf("invalid credential provider request: %w", errs.ToAggregate())
+	}
+
+	req := &cpv1.CredentialProviderRequest{}
+	if err := json.Unmarshal(raw, req); err != nil {
+		return nil, fmt.Errorf("decode request: %w", err)
+	}
+
+	return req, nil
+}
+
+func validateRequest(fields map[string]json.RawMessage) field.ErrorList {
+	var errs field.ErrorList
+
+	// Iterate sorted to get a stable error order
+	for _, name := range slices.Sorted(maps.Keys(fields)) {
+		value := fields[name]
+		path := field.NewPath(name)
+
+		switch name {
+		case "apiVersion":
+			if s, ok := stringValue(value, path, &errs); ok && s != "" && !slices.Contains(RequestAPIVersions, s) {
+				errs = append(errs, field.Invalid(path, s, fmt.Sprintf(
+					"the provider only supports %q, one of which has to be configured as apiVersion of the provider in the kubelet CredentialProviderConfig",
+					RequestAPIVersions,
+				)))
+			}
+
+		case "kind":
+			if s, ok := stringValue(value, path, &errs); ok && s != "" && s != RequestKind {
+				errs = append(errs, field.NotSupported(path, s, []string{RequestKind}))
+			}
+
+		case "image", "serviceAccountToken":
+			stringValue(value, path, &errs)
+
+		case "serviceAccountAnnotations":
+			if isNull(value) {
+				continue
+			}
+
+			annotations := map[string]json.RawMessage{}
+			if err := json.Unmarshal(value, &annotations); err != nil {
+				errs = append(errs, field.TypeInvalid(path, string(value), "must be an object"))
+
+				continue
+			}
+
+			for _, key := range slices.Sorted(maps.Keys(annotations)) {
+				stringValue(annotations[key], path.Key(key), &errs)
+			}
+
+		default:
+			errs = append(errs, field.Forbidden(path, "unknown field"))
+		}
+	}
+
+	image, ok := fields["image"]
+	if !ok || isNull(image) || bytes.Equal(image, []byte(`""`)) {
+		errs = append(errs, field.Required(field.NewPath("image"), "image has to be provided by the kubelet"))
+	}
+
+	return errs
+}
+
+// stringValue decodes a string value and records a type error if the value
+// is not a string. A null value results in an empty string.
+func stringValue(value json.RawMessage, path *field.Path, errs *field.ErrorList) (string, bool) {
+	var s *string
+	if err := json.Unmarshal(value, &s); err != nil {
+		*errs = append(*errs, field.TypeInvalid(path, string(value), "must be a string"))
+
+		return "", false
+	}
+
+	if s == nil {
+		return "", true
+	}
+
+	return *s, true
+}
+
+func isNull(value json.RawMessage) bool {
+	return bytes.Equal(bytes.TrimSpace(value), []byte("null"))
+}
@@ -0,0 +1,93 @@
+package k8s
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeRequest(t *testing.T) {
+	t.Parallel()
+
+	for name, tc := range map[string]struct {
+		input     string
+		expectErr []string
+	}{
+		"success": {
+			input: `{"kind":"CredentialProviderRequest","apiVersion":"credentialprovider.kubelet.k8s.io/v1",` +
+				`"image":"quay.io/org/app","serviceAccountToken":"token","serviceAccountAnnotations":{"key":"value"}}`,
+		},
+		"success without type meta": {
+			input: `{"image":"quay.io/org/app","serviceAccountToken":null}`,
+		},
+		"success with v1beta1": {
+			input: `{"kind":"CredentialProviderRequest","apiVersion":"credentialprovider.kubelet.k8s.io/v1beta1","image":"quay.io/org/app"}`,
+		},
+		"success with v1alpha1": {
+			input: `{"kind":"CredentialProviderRequest","apiVersion":"credentialprovider.kubelet.k8s.io/v1alpha1","image":"quay.io/org/app"}`,
+		},
+		"failure on api version mismatch": {
+			input:     `{"apiVersion":"credentialprovider.kubelet.k8s.io/v2","image":"quay.io/org/app"}`,
+			expectErr: []string{`apiVersion: Invalid value: "credentialprovider.kubelet.k8s.io/v2": the provider only supports ["credentialprovider.kubelet.k8s.io/v1" "credentialprovider.kubelet.k8s.io/v1beta1" "credentialprovider.kubelet.k8s.io/v1alpha1"]`},
+		},
+		"failure on wrong kind": {
+			input:     `{"kind":"CredentialProviderResponse","image":"quay.io/org/app"}`,
+			expectErr: []string{`kind: Unsupported value: "CredentialProviderResponse"`},
+		},
+		"failure on missing image": {
+			input:     `{"serviceAccountToken":"token"}`,
+			expectErr: []string{"image: Required value"},
+		},
+		"failure on multiple violations": {
+			input: `{"image":1,"serviceAccountAnnotations":{"key":true},"unknown":"value"}`,
+			expectErr: []string{
+				"image: Invalid value: \"1\": must be a string",
+				"serviceAccountAnnotations[key]: Invalid value: \"true\": must be a string",
+				"unknown: Forbidden: unknown field",
+			},
+		},
+		"failure on wrong annotations type": {
+			input:     `{"image":"quay.io/org/app","serviceAccountAnnotations":[]}`,
+			expectErr: []string{"serviceAccountAnnotations: Invalid value: \"[]\": must be an object"},
+		},
+		"failure on no object": {
+			input:     `[]`,
+			expectErr: []string{"request is not a JSON object"},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			req, err := DecodeRequest(strings.NewReader(tc.input))
+			if len(tc.expectErr) == 0 {
+				require.NoError(t, err)
+				assert.Equal(t, "quay.io/org/app", req.Image)
+
+				return
+			}
+
+			require.Error(t, err)
+
+			for _, expected := range tc.expectErr {
+				assert.ErrorContains(t, err, expected)
+			}
+		})
+	}
+}
+
+func TestAPIVersion(t *testing.T) {
+	t.Parallel()
+
+	for input, expected := range map[string]string{
+		`{"apiVersion":"credentialprovider.kubelet.k8s.io/v1","image":"quay.io/org/app"}`:       RequestAPIVersion,
+		`{"apiVersion":"credentialprovider.kubelet.k8s.io/v1beta1","image":"quay.io/org/app"}`:  RequestAPIVersionV1Beta1,
+		`{"apiVersion":"credentialprovider.kubelet.k8s.io/v1alpha1","image":"quay.io/org/app"}`: RequestAPIVersionV1Alpha1,
+		`{"apiVersion":"credentialprovider.kubelet.k8s.io/v2","image":"quay.io/org/app"}`:       RequestAPIVersion,
+		`{"image":"quay.io/org/app"}`: RequestAPIVersion,
+		`not json`:                    RequestAPIVersion,
+	} {
+		assert.Equal(t, expected, APIVersion([]byte(input)), input)
+	}
+}
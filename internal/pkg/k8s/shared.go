@@ -0,0 +1,34 @@
+package k8s
+
+import (
+	"slices"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// SharedSecretName returns the name under which a secret of the shared
+// namespace gets referenced by other namespaces. Qualifying the name with
+// the namespace is unambiguous, because secret names cannot contain slashes.
+func SharedSecretName(namespace, name string) string {
+	return namespace + "/" + name
+}
+
+// MergeSharedSecrets merges the secrets of other namespaces, like the shared
+// namespace or the ones referenced by cluster pull secrets, into the secrets
+// of the requesting namespace. The shared secrets get renamed by
+// SharedSecretName, which attributes them in the logs and the state, and are
+// ordered first to let the secrets of the requesting namespace take
+// precedence for equally specific registry entries.
+func MergeSharedSecrets(secrets, shared *corev1.SecretList) *corev1.SecretList {
+	merged := &corev1.SecretList{Items: make([]corev1.Secret, 0, len(shared.Items)+len(secrets.Items))}
+
+	for i := range shared.Items {
+		secret := shared.Items[i]
+		secret.Name = SharedSecretName(secret.Namespace, secret.Name)
+		merged.Items = append(merged.Items, secret)
+	}
+
+	merged.Items = slices.Concat(merged.Items, secrets.Items)
+
+	return merged
+}
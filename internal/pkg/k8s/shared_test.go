@@ -0,0 +1,31 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestMergeSharedSecrets(t *testing.T) {
+	t.Parallel()
+
+	secrets := &corev1.SecretList{Items: []corev1.Secret{
+		{ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "own"}},
+	}}
+	shared := &corev1.SecretList{Items: []corev1.Secret{
+		{ObjectMeta: metav1.ObjectMeta{Namespace: "pull-secrets", Name: "mirror"}},
+	}}
+
+	merged := MergeSharedSecrets(secrets, shared)
+
+	names := []string{}
+	for i := range merged.Items {
+		names = append(names, merged.Items[i].Name)
+	}
+
+	assert.Equal(t, []string{"pull-secrets/mirror", "own"}, names)
+	assert.Equal(t, "pull-secrets", merged.Items[0].Namespace)
+	assert.Equal(t, "mirror", shared.Items[0].Name, "must not modify the shared secrets")
+}
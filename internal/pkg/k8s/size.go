@@ -0,0 +1,43 @@
+package k8s
+
+import (
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/logger"
+)
+
+// SecretSize returns the size of the data of the secret in bytes.
+func SecretSize(secret *corev1.Secret) int {
+	size := 0
+
+	for key, value := range secret.Data {
+		size += len(key) + len(value)
+	}
+
+	return size
+}
+
+// LimitSecrets returns the secrets of the list which do not exceed maxSize as
+// well as the number of skipped secrets. Every skipped secret gets logged.
+// Nothing gets skipped if maxSize is zero.
+func LimitSecrets(list *corev1.SecretList, maxSize int) (*corev1.SecretList, int) {
+	if maxSize <= 0 {
+		return list, 0
+	}
+
+	limited := &corev1.SecretList{Items: make([]corev1.Secret, 0, len(list.Items))}
+
+	for i := range list.Items {
+		secret := &list.Items[i]
+
+		if size := SecretSize(secret); size > maxSize {
+			logger.Warnf("Skipping oversized secret: namespace=%s name=%s size=%d maxSize=%d", secret.Namespace, secret.Name, size, maxSize)
+
+			continue
+		}
+
+		limited.Items = append(limited.Items, *secret)
+	}
+
+	return limited, len(list.Items) - len(limited.Items)
+}
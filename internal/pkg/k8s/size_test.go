@@ -0,0 +1,58 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestLimitSecrets(t *testing.T) {
+	t.Parallel()
+
+	list := &corev1.SecretList{Items: []corev1.Secret{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "small"},
+			Data:       map[string][]byte{corev1.DockerConfigJsonKey: make([]byte, 10)},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "large"},
+			Data:       map[string][]byte{corev1.DockerConfigJsonKey: make([]byte, 100)},
+		},
+	}}
+
+	for name, tc := range map[string]struct {
+		maxSize         int
+		expectedNames   []string
+		expectedSkipped int
+	}{
+		"disabled": {
+			expectedNames: []string{"small", "large"},
+		},
+		"large secret skipped": {
+			maxSize:         50,
+			expectedNames:   []string{"small"},
+			expectedSkipped: 1,
+		},
+		"all secrets skipped": {
+			maxSize:         5,
+			expectedNames:   []string{},
+			expectedSkipped: 2,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			limited, skipped := LimitSecrets(list, tc.maxSize)
+			assert.Equal(t, tc.expectedSkipped, skipped)
+
+			names := []string{}
+			for i := range limited.Items {
+				names = append(names, limited.Items[i].Name)
+			}
+
+			assert.Equal(t, tc.expectedNames, names)
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package k8s
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/errcode"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/logger"
+)
+
+var errInvalidNamespace = errcode.New(errcode.InvalidNamespace, "invalid namespace")
+
+// StaticSecretsExtension is the file extension of the dockerconfigjson
+// documents within the static secrets directory.
+const StaticSecretsExtension = ".json"
+
+// ReadStaticSecrets reads the dockerconfigjson documents of the namespace from
+// the static secrets directory, which is organized as
+// <dir>/<namespace>/<name>.json. This allows using the credential provider
+// without an API server, for example with a standalone kubelet. Every document
+// results in a secret named after the file without its extension. A non
+// existing namespace directory results in an empty list.
+func ReadStaticSecrets(dir, namespace string) (*corev1.SecretList, error) {
+	if errs := validation.IsDNS1123Label(namespace); len(errs) > 0 {
+		return nil, fmt.Errorf("%w %q: %s", errInvalidNamespace, namespace, strings.Join(errs, ", "))
+	}
+
+	namespaceDir := filepath.Join(dir, namespace)
+
+	entries, err := os.ReadDir(namespaceDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			logger.Debugf("Static secrets directory %q does not exist", namespaceDir)
+
+			return &corev1.SecretList{}, nil
+		}
+
+		return nil, fmt.Errorf("unable to read static secrets directory: %w", err)
+	}
+
+	list := &corev1.SecretList{Items: make([]corev1.Secret, 0, len(entries))}
+
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), StaticSecretsExtension)
+		if !ok || name == "" || !entry.Type().IsRegular() {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(namespaceDir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("unable to read static secret: %w", err)
+		}
+
+		list.Items = append(list.Items, corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Type:       corev1.SecretTypeDockerConfigJson,
+			Data:       map[string][]byte{corev1.DockerConfigJsonKey: data},
+		})
+	}
+
+	return list, nil
+}
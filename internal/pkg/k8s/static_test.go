@@ -0,0 +1,68 @@
+package k8s
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestReadStaticSecrets(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	namespaceDir := filepath.Join(dir, "ns")
+	data := []byte(`{"auths":{"quay.io":{"auth":"dXNlcjpwYXNz"}}}`)
+
+	require.NoError(t, os.MkdirAll(filepath.Join(namespaceDir, "subdir.json"), 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(namespaceDir, "pull.json"), data, 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(namespaceDir, "README"), []byte("ignored"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "other.json"), data, 0o600))
+
+	for name, tc := range map[string]struct {
+		namespace     string
+		shouldErr     bool
+		expectSecrets []string
+	}{
+		"success": {
+			namespace:     "ns",
+			expectSecrets: []string{"pull"},
+		},
+		"success on missing namespace directory": {
+			namespace:     "missing",
+			expectSecrets: []string{},
+		},
+		"failure on invalid namespace": {
+			namespace: "../ns",
+			shouldErr: true,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			secrets, err := ReadStaticSecrets(dir, tc.namespace)
+			if tc.shouldErr {
+				require.Error(t, err)
+
+				return
+			}
+
+			require.NoError(t, err)
+
+			names := []string{}
+
+			for _, secret := range secrets.Items {
+				assert.Equal(t, tc.namespace, secret.Namespace)
+				assert.Equal(t, corev1.SecretTypeDockerConfigJson, secret.Type)
+				assert.Equal(t, data, secret.Data[corev1.DockerConfigJsonKey])
+
+				names = append(names, secret.Name)
+			}
+
+			assert.Equal(t, tc.expectSecrets, names)
+		})
+	}
+}
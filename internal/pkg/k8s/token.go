@@ -0,0 +1,157 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	cpv1 "k8s.io/kubelet/pkg/apis/credentialprovider/v1"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/errcode"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/logger"
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+)
+
+// tokenRequestExpirationSeconds is the lifetime of requested tokens, which is
+// the minimum accepted by the API server.
+const tokenRequestExpirationSeconds = 600
+
+var (
+	errNoToken          = errcode.New(errcode.NoToken, "no token source provided a service account token")
+	errNoServiceAccount = errcode.New(errcode.NoServiceAccount, "service account of the workload is unknown")
+)
+
+// NodeClientFunc is the function for retrieving a Kubernetes client using the
+// node identity of the provided kubeconfig.
+type NodeClientFunc func(kubeconfig string) (kubernetes.Interface, error)
+
+// ResolveToken returns the service account token of the first source
+// providing one. Failing sources are logged and skipped in favor of the next
+// one.
+func ResolveToken(ctx context.Context, req *cpv1.CredentialProviderRequest, sources []config.TokenSource, clientFunc NodeClientFunc) (string, error) {
+	var errs []error
+
+	for i := range sources {
+		token, err := tokenFromSource(ctx, req, &sources[i], clientFunc)
+		if err != nil {
+			logger.Warnf("Unable to get token from %s source: %v", sources[i].Type, err)
+
+			errs = append(errs, fmt.Errorf("%s: %w", sources[i].Type, err))
+
+			continue
+		}
+
+		if token != "" {
+			logger.Debugf("Using service account token from %s source", sources[i].Type)
+
+			return token, nil
+		}
+	}
+
+	if len(errs) > 0 {
+		return "", fmt.Errorf("%w: %w", errNoToken, errors.Join(errs...))
+	}
+
+	return "", errNoToken
+}
+
+func tokenFromSource(ctx context.Context, req *cpv1.CredentialProviderRequest, source *config.TokenSource, clientFunc NodeClientFunc) (string, error) {
+	switch source.Type {
+	case config.TokenSourceRequest:
+		if req == nil {
+			return "", nil
+		}
+
+		return req.ServiceAccountToken, nil
+
+	case config.TokenSourceFile:
+		raw, err := os.ReadFile(source.Path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return "", nil
+			}
+
+			return "", fmt.Errorf("read token file: %w", err)
+		}
+
+		return strings.TrimSpace(string(raw)), nil
+
+	case config.TokenSourceTokenRequest:
+		kubeconfig := source.Kubeconfig
+		if kubeconfig == "" {
+			kubeconfig = config.KubeletKubeconfig()
+		}
+
+		client, err := clientFunc(kubeconfig)
+		if err != nil {
+			return "", fmt.Errorf("create node client: %w", err)
+		}
+
+		return requestToken(ctx, client, source.Namespace, source.ServiceAccount, source.Audiences, nil)
+
+	default:
+		return "", fmt.Errorf("%w: %q", config.ErrUnknownTokenSource, source.Type)
+	}
+}
+
+// AudienceToken returns a service account token of the workload for the
+// audience. The token of the request gets used if it contains the audience,
+// otherwise a token gets requested by using the node identity of the
+// kubeconfig, which defaults to the kubelet kubeconfig. The requested token is
+// bound to the pod of the workload if known.
+func AudienceToken(ctx context.Context, token, audience, namespace string, workload Workload, kubeconfig string, clientFunc NodeClientFunc) (string, error) {
+	if token != "" {
+		claims := jwt.MapClaims{}
+		if _, _, err := jwt.NewParser().ParseUnverified(token, claims); err == nil {
+			if audiences, err := claims.GetAudience(); err == nil && slices.Contains(audiences, audience) {
+				return token, nil
+			}
+		}
+	}
+
+	if workload.ServiceAccount == "" {
+		return "", errNoServiceAccount
+	}
+
+	if kubeconfig == "" {
+		kubeconfig = config.KubeletKubeconfig()
+	}
+
+	client, err := clientFunc(kubeconfig)
+	if err != nil {
+		return "", fmt.Errorf("create node client: %w", err)
+	}
+
+	var bound *authenticationv1.BoundObjectReference
+	if workload.Pod != "" {
+		bound = &authenticationv1.BoundObjectReference{Kind: "Pod", APIVersion: "v1", Name: workload.Pod}
+	}
+
+	return requestToken(ctx, client, namespace, workload.ServiceAccount, []string{audience}, bound)
+}
+
+// requestToken requests a short-lived token of the service account for the
+// audiences, which is optionally bound to the object.
+func requestToken(ctx context.Context, client kubernetes.Interface, namespace, serviceAccount string, audiences []string, bound *authenticationv1.BoundObjectReference) (string, error) {
+	expirationSeconds := int64(tokenRequestExpirationSeconds)
+
+	res, err := client.CoreV1().ServiceAccounts(namespace).CreateToken(ctx, serviceAccount, &authenticationv1.TokenRequest{
+		Spec: authenticationv1.TokenRequestSpec{
+			Audiences:         audiences,
+			ExpirationSeconds: &expirationSeconds,
+			BoundObjectRef:    bound,
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return "", fmt.Errorf("request token for service account %s/%s: %w", namespace, serviceAccount, err)
+	}
+
+	return res.Status.Token, nil
+}
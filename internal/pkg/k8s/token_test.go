@@ -0,0 +1,150 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	cpv1 "k8s.io/kubelet/pkg/apis/credentialprovider/v1"
+
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+)
+
+func TestResolveToken(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("file-token\n"), 0o600))
+
+	nodeClient := func(string) (kubernetes.Interface, error) {
+		client := fake.NewClientset()
+		client.PrependReactor("create", "serviceaccounts", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			if action.GetSubresource() != "token" {
+				return false, nil, nil
+			}
+
+			return true, &authenticationv1.TokenRequest{
+				Status: authenticationv1.TokenRequestStatus{Token: "requested-token"},
+			}, nil
+		})
+
+		return client, nil
+	}
+
+	tokenRequest := config.TokenSource{Type: config.TokenSourceTokenRequest, Namespace: "ns", ServiceAccount: "sa"}
+
+	for name, tc := range map[string]struct {
+		req        *cpv1.CredentialProviderRequest
+		sources    []config.TokenSource
+		clientFunc NodeClientFunc
+		expected   string
+		shouldErr  bool
+	}{
+		"success from request": {
+			req:      &cpv1.CredentialProviderRequest{ServiceAccountToken: "request-token"},
+			sources:  []config.TokenSource{{Type: config.TokenSourceRequest}, {Type: config.TokenSourceFile, Path: tokenFile}},
+			expected: "request-token",
+		},
+		"success falling back to file": {
+			req:      &cpv1.CredentialProviderRequest{},
+			sources:  []config.TokenSource{{Type: config.TokenSourceRequest}, {Type: config.TokenSourceFile, Path: tokenFile}},
+			expected: "file-token",
+		},
+		"success falling back to token request": {
+			req: &cpv1.CredentialProviderRequest{},
+			sources: []config.TokenSource{
+				{Type: config.TokenSourceFile, Path: filepath.Join(dir, "missing")},
+				tokenRequest,
+			},
+			clientFunc: nodeClient,
+			expected:   "requested-token",
+		},
+		"success skipping failing source": {
+			req: &cpv1.CredentialProviderRequest{ServiceAccountToken: "request-token"},
+			sources: []config.TokenSource{
+				tokenRequest,
+				{Type: config.TokenSourceRequest},
+			},
+			clientFunc: func(string) (kubernetes.Interface, error) {
+				return nil, errors.New("no node identity")
+			},
+			expected: "request-token",
+		},
+		"failure without any token": {
+			req:       &cpv1.CredentialProviderRequest{},
+			sources:   []config.TokenSource{{Type: config.TokenSourceRequest}},
+			shouldErr: true,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			token, err := ResolveToken(context.Background(), tc.req, tc.sources, tc.clientFunc)
+			if tc.shouldErr {
+				require.ErrorIs(t, err, errNoToken)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, token)
+		})
+	}
+}
+
+func TestAudienceToken(t *testing.T) {
+	t.Parallel()
+
+	sign := func(aud ...string) string {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"aud": aud}).SignedString([]byte("key"))
+		require.NoError(t, err)
+
+		return token
+	}
+
+	var requested *authenticationv1.TokenRequest
+
+	nodeClient := func(string) (kubernetes.Interface, error) {
+		client := fake.NewClientset()
+		client.PrependReactor("create", "serviceaccounts", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			requested = action.(k8stesting.CreateAction).GetObject().(*authenticationv1.TokenRequest) //nolint:forcetypeassert // defined by the action
+
+			return true, &authenticationv1.TokenRequest{
+				Status: authenticationv1.TokenRequestStatus{Token: "requested-token"},
+			}, nil
+		})
+
+		return client, nil
+	}
+
+	workload := Workload{ServiceAccount: "sa", Pod: "pod"}
+
+	// The token of the request contains the audience
+	token := sign("api", "registry.example.com")
+	res, err := AudienceToken(t.Context(), token, "registry.example.com", "ns", workload, "", nodeClient)
+	require.NoError(t, err)
+	assert.Equal(t, token, res)
+	assert.Nil(t, requested)
+
+	// The token gets requested for the audience and bound to the pod
+	res, err = AudienceToken(t.Context(), sign("api"), "registry.example.com", "ns", workload, "", nodeClient)
+	require.NoError(t, err)
+	assert.Equal(t, "requested-token", res)
+	require.NotNil(t, requested)
+	assert.Equal(t, []string{"registry.example.com"}, requested.Spec.Audiences)
+	assert.Equal(t, &authenticationv1.BoundObjectReference{Kind: "Pod", APIVersion: "v1", Name: "pod"}, requested.Spec.BoundObjectRef)
+
+	_, err = AudienceToken(t.Context(), "", "registry.example.com", "ns", Workload{}, "", nodeClient)
+	require.ErrorIs(t, err, errNoServiceAccount)
+}
@@ -0,0 +1,175 @@
+// Package lint contains checks for common misconfigurations of pull secrets.
+package lint
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/cri-o/crio-credential-provider/pkg/docker"
+)
+
+// Finding is a single problem found within a secret.
+type Finding struct {
+	// Namespace is the namespace of the secret.
+	Namespace string
+
+	// Secret is the name of the secret.
+	Secret string
+
+	// Registry is the affected registry entry, empty if the whole secret is affected.
+	Registry string
+
+	// Problem describes what is wrong.
+	Problem string
+
+	// Fix describes how to resolve the problem.
+	Fix string
+}
+
+// Secrets checks the provided secrets for malformed docker config JSON
+// contents and returns all found problems.
+func Secrets(secrets []corev1.Secret) []Finding {
+	findings := []Finding{}
+
+	for i := range secrets {
+		findings = append(findings, checkSecret(&secrets[i])...)
+	}
+
+	return findings
+}
+
+func checkSecret(s *corev1.Secret) []Finding {
+	finding := func(registry, problem, fix string) Finding {
+		return Finding{Namespace: s.Namespace, Secret: s.Name, Registry: registry, Problem: problem, Fix: fix}
+	}
+
+	raw, hasKey := s.Data[corev1.DockerConfigJsonKey]
+
+	switch {
+	case s.Type == corev1.SecretTypeDockercfg:
+		return []Finding{finding("",
+			fmt.Sprintf("secret type %q is only considered if secrets.dockercfg is enabled", s.Type),
+			"recreate the secret by using `kubectl create secret docker-registry` or enable secrets.dockercfg",
+		)}
+
+	case s.Type != corev1.SecretTypeDockerConfigJson && hasKey:
+		return []Finding{finding("",
+			fmt.Sprintf("secret contains the %q key but is of type %q", corev1.DockerConfigJsonKey, s.Type),
+			fmt.Sprintf("change the secret type to %q", corev1.SecretTypeDockerConfigJson),
+		)}
+
+	case s.Type != corev1.SecretTypeDockerConfigJson:
+		return nil
+
+	case !hasKey:
+		return []Finding{finding("",
+			fmt.Sprintf("secret does not contain the %q key", corev1.DockerConfigJsonKey),
+			fmt.Sprintf("store the docker config JSON under the %q data key", corev1.DockerConfigJsonKey),
+		)}
+	}
+
+	config, legacy, err := docker.ParseConfigJSON(raw)
+	if err != nil {
+		return []Finding{finding("",
+			fmt.Sprintf("docker config JSON is not parsable: %v", err),
+			"ensure the secret data is valid JSON and not additionally base64 encoded",
+		)}
+	}
+
+	if len(config.Auths) == 0 {
+		return []Finding{finding("",
+			`docker config JSON contains no "auths" entries`,
+			`wrap the registry entries into an "auths" object`,
+		)}
+	}
+
+	findings := []Finding{}
+
+	if legacy {
+		findings = append(findings, finding("",
+			`docker config JSON uses the legacy .dockercfg format without "auths" object`,
+			`wrap the registry entries into an "auths" object`,
+		))
+	}
+
+	for _, registry := range slices.Sorted(maps.Keys(config.Auths)) {
+		if trimmed, ok := trimScheme(registry); ok {
+			findings = append(findings, finding(registry,
+				"registry contains a scheme prefix and may not match the image or mirror",
+				fmt.Sprintf("use %q as registry key", trimmed),
+			))
+		}
+
+		if problem := checkAuth(config.Auths[registry].Auth); problem != "" {
+			findings = append(findings, finding(registry, problem,
+				`set "auth" to the standard base64 encoding of "user:password"`,
+			))
+		}
+	}
+
+	return findings
+}
+
+func trimScheme(registry string) (string, bool) {
+	for _, scheme := range []string{"https://", "http://"} {
+		if trimmed, ok := strings.CutPrefix(registry, scheme); ok {
+			return strings.TrimSuffix(trimmed, "/"), true
+		}
+	}
+
+	return registry, false
+}
+
+func checkAuth(encoded string) string {
+	if encoded == "" {
+		return `"auth" is empty`
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return fmt.Sprintf(`"auth" is not valid base64: %v`, err)
+	}
+
+	if !strings.Contains(string(decoded), ":") {
+		return `decoded "auth" is not in the "user:password" format`
+	}
+
+	return ""
+}
+
+// WriteReport writes a human readable fix-it report of the findings to w.
+func WriteReport(w io.Writer, findings []Finding) error {
+	if len(findings) == 0 {
+		if _, err := fmt.Fprintln(w, "No problems found"); err != nil {
+			return fmt.Errorf("write report: %w", err)
+		}
+
+		return nil
+	}
+
+	b := &strings.Builder{}
+
+	for _, f := range findings {
+		fmt.Fprintf(b, "%s/%s", f.Namespace, f.Secret)
+
+		if f.Registry != "" {
+			fmt.Fprintf(b, " (registry %q)", f.Registry)
+		}
+
+		fmt.Fprintf(b, ": %s\n  fix: %s\n", f.Problem, f.Fix)
+	}
+
+	fmt.Fprintf(b, "\nFound %d problem(s)\n", len(findings))
+
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return fmt.Errorf("write report: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,121 @@
+package lint
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSecrets(t *testing.T) {
+	t.Parallel()
+
+	validAuth := base64.StdEncoding.EncodeToString([]byte("user:pass"))
+
+	for name, tc := range map[string]struct {
+		secretType       corev1.SecretType
+		data             map[string][]byte
+		expectedProblems []string
+	}{
+		"valid": {
+			secretType: corev1.SecretTypeDockerConfigJson,
+			data:       map[string][]byte{corev1.DockerConfigJsonKey: []byte(`{"auths":{"quay.io":{"auth":"` + validAuth + `"}}}`)},
+		},
+		"unrelated secret": {
+			secretType: corev1.SecretTypeOpaque,
+			data:       map[string][]byte{"key": []byte("value")},
+		},
+		"legacy dockercfg": {
+			secretType:       corev1.SecretTypeDockercfg,
+			data:             map[string][]byte{corev1.DockerConfigKey: []byte(`{}`)},
+			expectedProblems: []string{`secret type "kubernetes.io/dockercfg" is only considered if secrets.dockercfg is enabled`},
+		},
+		"wrong type": {
+			secretType:       corev1.SecretTypeOpaque,
+			data:             map[string][]byte{corev1.DockerConfigJsonKey: []byte(`{}`)},
+			expectedProblems: []string{`secret contains the ".dockerconfigjson" key but is of type "Opaque"`},
+		},
+		"missing key": {
+			secretType:       corev1.SecretTypeDockerConfigJson,
+			data:             map[string][]byte{"config.json": []byte(`{}`)},
+			expectedProblems: []string{`secret does not contain the ".dockerconfigjson" key`},
+		},
+		"invalid json": {
+			secretType:       corev1.SecretTypeDockerConfigJson,
+			data:             map[string][]byte{corev1.DockerConfigJsonKey: []byte(`eyJhdXRocyI6e319`)},
+			expectedProblems: []string{"docker config JSON is not parsable: unmarshal docker config: invalid character 'e' looking for beginning of value"},
+		},
+		"no auths": {
+			secretType:       corev1.SecretTypeDockerConfigJson,
+			data:             map[string][]byte{corev1.DockerConfigJsonKey: []byte(`{}`)},
+			expectedProblems: []string{`docker config JSON contains no "auths" entries`},
+		},
+		"legacy format": {
+			secretType:       corev1.SecretTypeDockerConfigJson,
+			data:             map[string][]byte{corev1.DockerConfigJsonKey: []byte(`{"quay.io":{"auth":"` + validAuth + `"}}`)},
+			expectedProblems: []string{`docker config JSON uses the legacy .dockercfg format without "auths" object`},
+		},
+		"registry problems": {
+			secretType: corev1.SecretTypeDockerConfigJson,
+			data: map[string][]byte{corev1.DockerConfigJsonKey: []byte(`{"auths":{` +
+				`"https://quay.io/":{"auth":"` + validAuth + `"},` +
+				`"docker.io":{"auth":"not base64!"},` +
+				`"ghcr.io":{"auth":""},` +
+				`"registry.k8s.io":{"auth":"` + base64.StdEncoding.EncodeToString([]byte("token")) + `"}` +
+				`}}`)},
+			expectedProblems: []string{
+				`"auth" is not valid base64: illegal base64 data at input byte 3`,
+				`"auth" is empty`,
+				"registry contains a scheme prefix and may not match the image or mirror",
+				`decoded "auth" is not in the "user:password" format`,
+			},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			findings := Secrets([]corev1.Secret{{
+				ObjectMeta: metav1.ObjectMeta{Name: "secret", Namespace: "default"},
+				Type:       tc.secretType,
+				Data:       tc.data,
+			}})
+
+			var problems []string
+
+			for _, f := range findings {
+				assert.Equal(t, "default", f.Namespace)
+				assert.Equal(t, "secret", f.Secret)
+				assert.NotEmpty(t, f.Fix)
+
+				problems = append(problems, f.Problem)
+			}
+
+			assert.Equal(t, tc.expectedProblems, problems)
+		})
+	}
+}
+
+func TestWriteReport(t *testing.T) {
+	t.Parallel()
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, WriteReport(buf, nil))
+	assert.Equal(t, "No problems found\n", buf.String())
+
+	buf.Reset()
+	require.NoError(t, WriteReport(buf, []Finding{
+		{Namespace: "default", Secret: "a", Problem: "problem a", Fix: "fix a"},
+		{Namespace: "default", Secret: "b", Registry: "https://quay.io", Problem: "problem b", Fix: "fix b"},
+	}))
+	assert.Equal(t, `default/a: problem a
+  fix: fix a
+default/b (registry "https://quay.io"): problem b
+  fix: fix b
+
+Found 2 problem(s)
+`, buf.String())
+}
@@ -0,0 +1,340 @@
+// Package loadgen contains the request generator for load testing the
+// credential provider, which allows capacity planning for large nodes before
+// rolling it out.
+package loadgen
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	cpv1 "k8s.io/kubelet/pkg/apis/credentialprovider/v1"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/k8s"
+)
+
+// stderrTailSize is the maximum size of the stderr output of a failed
+// provider invocation reported as error.
+const stderrTailSize = 512
+
+var (
+	errNoNamespaces  = errors.New("at least one namespace is required")
+	errNoImages      = errors.New("at least one image is required")
+	errInvalidRate   = errors.New("rate has to be positive")
+	errInvalidLimits = errors.New("duration and concurrency have to be positive")
+	errNoCommand     = errors.New("no provider command")
+)
+
+// Options configure the synthesized requests.
+type Options struct {
+	// Namespaces are the namespaces of the service account tokens, which get
+	// used in a round-robin fashion.
+	Namespaces []string
+
+	// Images are the requested images, which get used in a round-robin
+	// fashion per namespace.
+	Images []string
+
+	// Pods is the number of distinct pods per namespace the tokens get bound
+	// to.
+	Pods int
+
+	// ServiceAccount is the name of the service account of the tokens.
+	ServiceAccount string
+
+	// Issuer is the iss claim of the tokens, omitted if empty.
+	Issuer string
+
+	// TokenTTL is the lifetime of the tokens.
+	TokenTTL time.Duration
+
+	// Claims are additional claims of the tokens, which take precedence over
+	// the generated ones.
+	Claims map[string]any
+}
+
+// Generator synthesizes credential provider requests with service account
+// tokens signed by a random key, which get accepted by providers not
+// verifying the token issuer.
+type Generator struct {
+	opts *Options
+	key  *ecdsa.PrivateKey
+	next atomic.Uint64
+}
+
+// NewGenerator returns a generator for the options.
+func NewGenerator(opts *Options) (*Generator, error) {
+	if len(opts.Namespaces) == 0 {
+		return nil, errNoNamespaces
+	}
+
+	if len(opts.Images) == 0 {
+		return nil, errNoImages
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("generate signing key: %w", err)
+	}
+
+	return &Generator{opts: opts, key: key}, nil
+}
+
+// Request returns the next request, which is safe for concurrent use.
+func (g *Generator) Request() ([]byte, error) {
+	n := g.next.Add(1) - 1
+	namespace := g.opts.Namespaces[n%uint64(len(g.opts.Namespaces))]
+	round := n / uint64(len(g.opts.Namespaces))
+	image := g.opts.Images[round%uint64(len(g.opts.Images))]
+	pod := fmt.Sprintf("loadgen-%d", round%uint64(max(g.opts.Pods, 1)))
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iat": now.Unix(),
+		"nbf": now.Unix(),
+		"exp": now.Add(g.opts.TokenTTL).Unix(),
+		"sub": fmt.Sprintf("system:serviceaccount:%s:%s", namespace, g.opts.ServiceAccount),
+		"kubernetes.io": map[string]any{
+			"namespace":      namespace,
+			"serviceaccount": map[string]any{"name": g.opts.ServiceAccount, "uid": fmt.Sprintf("loadgen-%s", namespace)},
+			"pod":            map[string]any{"name": pod, "uid": fmt.Sprintf("%s-%s", namespace, pod)},
+		},
+	}
+
+	if g.opts.Issuer != "" {
+		claims["iss"] = g.opts.Issuer
+	}
+
+	maps.Copy(claims, g.opts.Claims)
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodES256, claims).SignedString(g.key)
+	if err != nil {
+		return nil, fmt.Errorf("sign token: %w", err)
+	}
+
+	raw, err := json.Marshal(&cpv1.CredentialProviderRequest{
+		TypeMeta:            metav1.TypeMeta{APIVersion: k8s.RequestAPIVersion, Kind: k8s.RequestKind},
+		Image:               image,
+		ServiceAccountToken: token,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("encode request: %w", err)
+	}
+
+	return raw, nil
+}
+
+// Target sends a single request to the credential provider.
+type Target func(ctx context.Context, request []byte) error
+
+// Exec returns the target executing the command for every request, like the
+// kubelet does. Invocations exiting non-zero fail with the tail of their
+// stderr output.
+func Exec(command []string) (Target, error) {
+	if len(command) == 0 {
+		return nil, errNoCommand
+	}
+
+	return func(ctx context.Context, request []byte) error {
+		stderr := &bytes.Buffer{}
+
+		cmd := exec.CommandContext(ctx, command[0], command[1:]...) //nolint:gosec // the command is provided by the operator
+		cmd.Stdin = bytes.NewReader(request)
+		cmd.Stdout = io.Discard
+		cmd.Stderr = stderr
+
+		if err := cmd.Run(); err != nil {
+			tail := strings.TrimSpace(stderr.String())
+			if tail == "" {
+				return fmt.Errorf("run provider: %w", err)
+			}
+
+			if len(tail) > stderrTailSize {
+				tail = tail[len(tail)-stderrTailSize:]
+			}
+
+			return fmt.Errorf("run provider: %w: %s", err, tail)
+		}
+
+		return nil
+	}, nil
+}
+
+// Report is the result of a load test.
+type Report struct {
+	// Requests is the number of sent requests.
+	Requests int `json:"requests"`
+
+	// Failures is the number of failed requests.
+	Failures int `json:"failures"`
+
+	// Dropped is the number of requests which did not get sent, because all
+	// workers were busy. Any dropped request means that the provider cannot
+	// sustain the target rate with the concurrency.
+	Dropped int `json:"dropped"`
+
+	// DurationMs is the duration of the load test in milliseconds.
+	DurationMs float64 `json:"durationMs"`
+
+	// Rate is the achieved rate of completed requests per second.
+	Rate float64 `json:"rate"`
+
+	// Latencies are the latency percentiles in milliseconds, like "p99".
+	Latencies map[string]float64 `json:"latencies"`
+
+	// Errors counts the distinct errors of the failed requests.
+	Errors map[string]int `json:"errors,omitempty"`
+}
+
+// percentiles are the reported latency percentiles.
+var percentiles = []struct {
+	name  string
+	value float64
+}{{"p50", 0.5}, {"p90", 0.9}, {"p99", 0.99}, {"max", 1}}
+
+// Run sends requests of the generator to the target at the rate per second
+// for the duration, by using at most concurrency requests in flight. The
+// requests get started on schedule regardless of the latency of previous
+// ones, while requests finding all workers busy get dropped.
+func Run(ctx context.Context, g *Generator, target Target, rate float64, duration time.Duration, concurrency int) (*Report, error) {
+	if rate <= 0 {
+		return nil, errInvalidRate
+	}
+
+	if duration <= 0 || concurrency <= 0 {
+		return nil, errInvalidLimits
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, duration)
+	defer cancel()
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		slots     = make(chan struct{}, concurrency)
+		latencies = []time.Duration{}
+		report    = &Report{Errors: map[string]int{}}
+		ticker    = time.NewTicker(time.Duration(float64(time.Second) / rate))
+		start     = time.Now()
+	)
+
+	defer ticker.Stop()
+
+loop:
+	for {
+		select {
+		case <-ctx.Done():
+			break loop
+		case <-ticker.C:
+		}
+
+		select {
+		case slots <- struct{}{}:
+		default:
+			report.Dropped++
+
+			continue
+		}
+
+		request, err := g.Request()
+		if err != nil {
+			<-slots
+			wg.Wait()
+
+			return nil, err
+		}
+
+		report.Requests++
+
+		wg.Go(func() {
+			defer func() { <-slots }()
+
+			// In-flight requests complete after the duration
+			requestStart := time.Now()
+			err := target(context.WithoutCancel(ctx), request)
+			latency := time.Since(requestStart)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			latencies = append(latencies, latency)
+
+			if err != nil {
+				report.Failures++
+				report.Errors[err.Error()]++
+			}
+		})
+	}
+
+	wg.Wait()
+
+	elapsed := time.Since(start)
+	report.DurationMs = milliseconds(elapsed)
+	report.Rate = float64(len(latencies)) / elapsed.Seconds()
+	report.Latencies = map[string]float64{}
+
+	slices.Sort(latencies)
+
+	for _, p := range percentiles {
+		report.Latencies[p.name] = milliseconds(percentile(latencies, p.value))
+	}
+
+	return report, nil
+}
+
+// percentile returns the nearest-rank percentile p of the sorted latencies.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	i := int(math.Ceil(p*float64(len(sorted)))) - 1
+
+	return sorted[min(max(i, 0), len(sorted)-1)]
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// WriteSummary writes the human readable summary of the report.
+func (r *Report) WriteSummary(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "Requests:\t%d\n", r.Requests)
+	fmt.Fprintf(tw, "Failures:\t%d\n", r.Failures)
+	fmt.Fprintf(tw, "Dropped:\t%d\n", r.Dropped)
+	fmt.Fprintf(tw, "Duration:\t%.0fms\n", r.DurationMs)
+	fmt.Fprintf(tw, "Rate:\t%.1f/s\n", r.Rate)
+
+	for _, p := range percentiles {
+		fmt.Fprintf(tw, "Latency %s:\t%.1fms\n", p.name, r.Latencies[p.name])
+	}
+
+	for _, err := range slices.Sorted(maps.Keys(r.Errors)) {
+		fmt.Fprintf(tw, "Error (%dx):\t%s\n", r.Errors[err], err)
+	}
+
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("write summary: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,117 @@
+package loadgen
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/k8s"
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+)
+
+func TestRequest(t *testing.T) {
+	t.Parallel()
+
+	g, err := NewGenerator(&Options{
+		Namespaces:     []string{"team-a", "team-b"},
+		Images:         []string{"quay.io/org/app", "quay.io/org/db"},
+		Pods:           2,
+		ServiceAccount: "builder",
+		TokenTTL:       time.Hour,
+	})
+	require.NoError(t, err)
+
+	for _, expected := range []struct {
+		namespace, image, pod string
+	}{
+		{"team-a", "quay.io/org/app", "loadgen-0"},
+		{"team-b", "quay.io/org/app", "loadgen-0"},
+		{"team-a", "quay.io/org/db", "loadgen-1"},
+		{"team-b", "quay.io/org/db", "loadgen-1"},
+		{"team-a", "quay.io/org/app", "loadgen-0"},
+	} {
+		raw, err := g.Request()
+		require.NoError(t, err)
+
+		req, err := k8s.DecodeRequest(bytes.NewReader(raw))
+		require.NoError(t, err)
+		assert.Equal(t, expected.image, req.Image)
+
+		identity, err := k8s.ExtractIdentity(req, 0, k8s.NewClaimMapper(&config.ClaimMapping{}))
+		require.NoError(t, err)
+		assert.Equal(t, expected.namespace, identity.Namespace)
+		assert.Equal(t, "builder", identity.Workload.ServiceAccount)
+		assert.Equal(t, expected.pod, identity.Workload.Pod)
+	}
+}
+
+func TestNewGenerator(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewGenerator(&Options{Images: []string{"quay.io/org/app"}})
+	require.ErrorIs(t, err, errNoNamespaces)
+
+	_, err = NewGenerator(&Options{Namespaces: []string{"default"}})
+	require.ErrorIs(t, err, errNoImages)
+}
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+
+	g, err := NewGenerator(&Options{Namespaces: []string{"default"}, Images: []string{"quay.io/org/app"}, TokenTTL: time.Hour})
+	require.NoError(t, err)
+
+	var calls atomic.Int64
+
+	report, err := Run(t.Context(), g, func(context.Context, []byte) error {
+		if calls.Add(1)%2 == 0 {
+			return errors.New("failed")
+		}
+
+		return nil
+	}, 200, 200*time.Millisecond, 4)
+	require.NoError(t, err)
+
+	assert.Positive(t, report.Requests)
+	assert.Equal(t, int(calls.Load()), report.Requests)
+	assert.Equal(t, report.Requests/2, report.Failures)
+	assert.Equal(t, map[string]int{"failed": report.Failures}, report.Errors)
+	assert.Contains(t, report.Latencies, "p99")
+
+	_, err = Run(t.Context(), g, nil, 0, time.Second, 1)
+	require.ErrorIs(t, err, errInvalidRate)
+}
+
+func TestRunDropped(t *testing.T) {
+	t.Parallel()
+
+	g, err := NewGenerator(&Options{Namespaces: []string{"default"}, Images: []string{"quay.io/org/app"}, TokenTTL: time.Hour})
+	require.NoError(t, err)
+
+	report, err := Run(t.Context(), g, func(context.Context, []byte) error {
+		time.Sleep(100 * time.Millisecond)
+
+		return nil
+	}, 100, 100*time.Millisecond, 1)
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, report.Requests)
+	assert.Positive(t, report.Dropped)
+}
+
+func TestPercentile(t *testing.T) {
+	t.Parallel()
+
+	latencies := []time.Duration{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+
+	assert.Equal(t, time.Duration(5), percentile(latencies, 0.5))
+	assert.Equal(t, time.Duration(9), percentile(latencies, 0.9))
+	assert.Equal(t, time.Duration(10), percentile(latencies, 1))
+	assert.Zero(t, percentile(nil, 0.5))
+}
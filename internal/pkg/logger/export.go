@@ -0,0 +1,76 @@
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// exports forwards the log records to all enabled export sinks.
+var exports = &exportWriter{}
+
+// exportWriter passes every log record to the export sinks.
+type exportWriter struct {
+	mu    sync.RWMutex
+	sinks []func(record)
+}
+
+func (w *exportWriter) export(rec record) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	for _, sink := range w.sinks {
+		sink(rec)
+	}
+}
+
+func (w *exportWriter) add(sink func(record)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.sinks = append(w.sinks, sink)
+}
+
+// EnableJSONL appends every log record as JSON line to the file at path.
+func EnableJSONL(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return fmt.Errorf("open JSON lines log file: %w", err)
+	}
+
+	exports.add(jsonlSink(f))
+
+	return nil
+}
+
+// jsonlSink returns a sink writing each record as single line, which keeps
+// the lines of concurrent processes appending to the same file intact.
+func jsonlSink(f *os.File) func(record) {
+	var mu sync.Mutex
+
+	return func(rec record) {
+		line, err := json.Marshal(rec)
+		if err != nil {
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		//nolint:errcheck // logging to stderr still works
+		_, _ = f.Write(append(line, '\n'))
+	}
+}
+
+// EnableOTLP exports every log record to the OTLP/HTTP collector endpoint,
+// for example "http://localhost:4318".
+func EnableOTLP(endpoint string) {
+	exporter := newOTLPExporter(endpoint, otlpQueueSize)
+
+	otlpMu.Lock()
+	otlpE = append(otlpE, exporter)
+	otlpMu.Unlock()
+
+	exports.add(exporter.export)
+}
@@ -0,0 +1,108 @@
+package logger
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONLSink(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "log.jsonl")
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	require.NoError(t, err)
+
+	w := &exportWriter{}
+	w.add(jsonlSink(f))
+
+	w.export(record{Time: time.Now(), Level: slog.LevelInfo, Source: "app.go:42", Message: "first"})
+	w.export(record{
+		Time: time.Now(), Level: slog.LevelWarn, Source: "app.go:43", Message: "second",
+		Attrs: attrs{slog.String("registry", "quay.io"), slog.Int("mirrors", 2)},
+	})
+	require.NoError(t, f.Close())
+
+	raw, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(string(raw)), "\n")
+	require.Len(t, lines, 2)
+
+	rec := map[string]any{}
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &rec))
+	assert.Equal(t, "WARN", rec["level"])
+	assert.Equal(t, "app.go:43", rec["source"])
+	assert.Equal(t, "second", rec["message"])
+	assert.Equal(t, map[string]any{"registry": "quay.io", "mirrors": float64(2)}, rec["attrs"])
+	assert.NotEmpty(t, rec["time"])
+}
+
+func TestOTLPExporter(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu       sync.Mutex
+		messages []string
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, otlpLogsPath, r.URL.Path)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+
+		data := &otlpLogsData{}
+		assert.NoError(t, json.Unmarshal(body, data))
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		for _, resource := range data.ResourceLogs {
+			assert.Contains(t, resource.Resource.Attributes, otlpKeyValue{Key: "service.name", Value: otlpAnyValue{StringValue: serviceName}})
+
+			for _, scope := range resource.ScopeLogs {
+				for _, logRecord := range scope.LogRecords {
+					assert.Equal(t, otlpSeverityInfo+4, logRecord.SeverityNumber)
+					assert.Equal(t, "WARN", logRecord.SeverityText)
+					assert.Contains(t, logRecord.Attributes, otlpKeyValue{Key: "registry", Value: otlpAnyValue{StringValue: "quay.io"}})
+					assert.NotEmpty(t, logRecord.TimeUnixNano)
+
+					messages = append(messages, logRecord.Body.StringValue)
+				}
+			}
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	e := newOTLPExporter(server.URL+"/", otlpQueueSize)
+
+	for _, msg := range []string{"first", "second", "third"} {
+		e.export(record{
+			Time: time.Now(), Level: slog.LevelWarn, Source: "app.go:1", Message: msg,
+			Attrs: attrs{slog.String("registry", "quay.io")},
+		})
+	}
+
+	e.flush(5 * time.Second)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	assert.Equal(t, []string{"first", "second", "third"}, messages)
+}
@@ -0,0 +1,251 @@
+package logger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/journal"
+)
+
+// timeLayout is the time layout of the text lines written to stderr.
+const timeLayout = "2006/01/02 15:04:05"
+
+// handler is the slog.Handler of all log records. It passes every record
+// together with its level, source and attributes to the sinks, like the
+// journal and the exports, and writes it to stderr as either text line or
+// JSON document. Groups get flattened into dotted attribute keys.
+type handler struct {
+	mu     *sync.Mutex
+	stderr io.Writer
+	sinks  []func(record)
+	attrs  attrs
+	group  string
+}
+
+// record is a single log record as passed to the sinks.
+type record struct {
+	Time    time.Time  `json:"time"`
+	Level   slog.Level `json:"level"`
+	Source  string     `json:"source,omitempty"`
+	Message string     `json:"message"`
+	Attrs   attrs      `json:"attrs,omitempty"`
+}
+
+func (h *handler) Enabled(_ context.Context, l slog.Level) bool {
+	return l >= level.Level()
+}
+
+func (h *handler) Handle(_ context.Context, r slog.Record) error {
+	rec := record{Time: r.Time, Level: r.Level, Message: r.Message, Attrs: slices.Clone(h.attrs)}
+
+	if r.PC != 0 {
+		frame, _ := runtime.CallersFrames([]uintptr{r.PC}).Next()
+		rec.Source = filepath.Base(frame.File) + ":" + strconv.Itoa(frame.Line)
+	}
+
+	r.Attrs(func(attr slog.Attr) bool {
+		rec.Attrs = appendAttr(rec.Attrs, h.group, attr)
+
+		return true
+	})
+
+	out := []byte(rec.Time.Format(timeLayout) + " " + rec.text() + "\n")
+	if jsonOutput.Load() {
+		encoded, err := json.Marshal(rec)
+		if err == nil {
+			out = append(encoded, '\n')
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	//nolint:errcheck // logging cannot fail
+	_, _ = h.stderr.Write(out)
+
+	for _, sink := range h.sinks {
+		sink(rec)
+	}
+
+	return nil
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	res := *h
+	res.attrs = slices.Clone(h.attrs)
+
+	for _, attr := range attrs {
+		res.attrs = appendAttr(res.attrs, h.group, attr)
+	}
+
+	return &res
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+
+	res := *h
+	res.group = joinKey(h.group, name)
+
+	return &res
+}
+
+// text renders the record without its time, like "app.go:42: INFO Message
+// key=value".
+func (r *record) text() string {
+	var b strings.Builder
+
+	if r.Source != "" {
+		b.WriteString(r.Source)
+		b.WriteString(": ")
+	}
+
+	b.WriteString(r.Level.String())
+	b.WriteString(" ")
+	b.WriteString(r.Message)
+
+	for _, attr := range r.Attrs {
+		b.WriteString(" ")
+		b.WriteString(attr.Key)
+		b.WriteString("=")
+		b.WriteString(valueString(attr.Value))
+	}
+
+	return b.String()
+}
+
+// attrs are the flattened attributes of a record, which get encoded as JSON
+// object.
+type attrs []slog.Attr
+
+func (a attrs) MarshalJSON() ([]byte, error) {
+	res := make(map[string]any, len(a))
+
+	for _, attr := range a {
+		if err, ok := attr.Value.Any().(error); ok {
+			res[attr.Key] = err.Error()
+
+			continue
+		}
+
+		res[attr.Key] = attr.Value.Any()
+	}
+
+	return json.Marshal(res)
+}
+
+// appendAttr appends the resolved attribute to dst, with groups flattened
+// into keys prefixed by the group names.
+func appendAttr(dst attrs, group string, attr slog.Attr) attrs {
+	attr.Value = attr.Value.Resolve()
+	if attr.Equal(slog.Attr{}) {
+		return dst
+	}
+
+	if attr.Value.Kind() == slog.KindGroup {
+		prefix := group
+		if attr.Key != "" {
+			prefix = joinKey(group, attr.Key)
+		}
+
+		for _, member := range attr.Value.Group() {
+			dst = appendAttr(dst, prefix, member)
+		}
+
+		return dst
+	}
+
+	attr.Key = joinKey(group, attr.Key)
+
+	return append(dst, attr)
+}
+
+func joinKey(group, key string) string {
+	if group == "" {
+		return key
+	}
+
+	return group + "." + key
+}
+
+// valueString renders the value of an attribute for the text outputs. Values
+// other than the basic kinds get encoded as JSON if possible.
+func valueString(v slog.Value) string {
+	if v.Kind() != slog.KindAny {
+		return v.String()
+	}
+
+	switch value := v.Any().(type) {
+	case error:
+		return value.Error()
+
+	case fmt.Stringer:
+		return value.String()
+	}
+
+	if raw, err := json.Marshal(v.Any()); err == nil {
+		return string(raw)
+	}
+
+	return v.String()
+}
+
+// journalPriority returns the journal priority of the level.
+func journalPriority(l slog.Level) journal.Priority {
+	switch {
+	case l >= slog.LevelError:
+		return journal.PriErr
+	case l >= slog.LevelWarn:
+		return journal.PriWarning
+	case l >= slog.LevelInfo:
+		return journal.PriInfo
+	default:
+		return journal.PriDebug
+	}
+}
+
+// journalVars returns the attributes of the record as journal fields, which
+// allows filtering the journal by them, like "journalctl OUTCOME=failed".
+// The keys get uppercased and all characters not permitted by journald get
+// replaced by underscores, leading digits get dropped.
+func journalVars(rec *record) map[string]string {
+	if len(rec.Attrs) == 0 {
+		return nil
+	}
+
+	vars := make(map[string]string, len(rec.Attrs))
+
+	for _, attr := range rec.Attrs {
+		key := strings.TrimLeft(strings.Map(func(r rune) rune {
+			switch {
+			case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+				return r
+			case r >= 'a' && r <= 'z':
+				return r - 'a' + 'A'
+			default:
+				return '_'
+			}
+		}, attr.Key), "_0123456789")
+
+		// The message and priority are set by the journal itself
+		if key == "" || key == "MESSAGE" || key == "PRIORITY" {
+			continue
+		}
+
+		vars[key] = valueString(attr.Value)
+	}
+
+	return vars
+}
@@ -0,0 +1,100 @@
+package logger
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// journalQueueSize is the maximum number of pending journal messages.
+const journalQueueSize = 1024
+
+// journalWriter sends the log records to journald on a background goroutine,
+// because a synchronous journal send per record slows down the pull path
+// under journald pressure. Records get dropped if the bounded queue is full.
+type journalWriter struct {
+	send    func(record) error
+	queue   chan record
+	pending sync.WaitGroup
+
+	// dropped counts the messages dropped since the last drop notice.
+	dropped atomic.Uint64
+
+	// failed disables sending after journald became unreachable.
+	failed atomic.Bool
+}
+
+func newJournalWriter(send func(record) error, size int) *journalWriter {
+	w := &journalWriter{
+		send:  send,
+		queue: make(chan record, size),
+	}
+
+	go w.run()
+
+	return w
+}
+
+func (w *journalWriter) write(rec record) {
+	if w.failed.Load() {
+		return
+	}
+
+	w.pending.Add(1)
+
+	select {
+	case w.queue <- rec:
+	default:
+		w.pending.Done()
+		w.dropped.Add(1)
+	}
+}
+
+func (w *journalWriter) run() {
+	for rec := range w.queue {
+		if w.failed.Load() {
+			w.pending.Done()
+
+			continue
+		}
+
+		if dropped := w.dropped.Swap(0); dropped > 0 {
+			//nolint:errcheck // nothing we can do
+			_ = w.send(record{
+				Time:    time.Now(),
+				Level:   slog.LevelWarn,
+				Message: fmt.Sprintf("Dropped %d journal messages because the queue was full", dropped),
+			})
+		}
+
+		if err := w.send(rec); err != nil && w.failed.CompareAndSwap(false, true) {
+			// Using the logger would feed the failure back into the journal
+			fmt.Fprintf(os.Stderr, "Unable to write to journald, logging to stderr only: %v\n", err)
+		}
+
+		w.pending.Done()
+	}
+}
+
+// flush waits until all queued messages are sent or the timeout exceeds.
+func (w *journalWriter) flush(timeout time.Duration) {
+	waitTimeout(&w.pending, timeout)
+}
+
+// waitTimeout waits for the wait group, but not longer than the timeout.
+func waitTimeout(wg *sync.WaitGroup, timeout time.Duration) {
+	done := make(chan struct{})
+
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+	}
+}
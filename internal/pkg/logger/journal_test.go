@@ -0,0 +1,97 @@
+package logger
+
+import (
+	"errors"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recorder struct {
+	mu       sync.Mutex
+	messages []string
+	block    chan struct{}
+}
+
+func (r *recorder) send(rec record) error {
+	if r.block != nil {
+		<-r.block
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.messages = append(r.messages, rec.text())
+
+	return nil
+}
+
+func (r *recorder) get() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]string{}, r.messages...)
+}
+
+func TestJournalWriter(t *testing.T) {
+	t.Parallel()
+
+	r := &recorder{}
+	w := newJournalWriter(r.send, 10)
+
+	w.write(record{Time: time.Now(), Level: slog.LevelInfo, Source: "file.go:1", Message: "message"})
+
+	w.flush(time.Second)
+	assert.Equal(t, []string{"file.go:1: INFO message"}, r.get())
+}
+
+func TestJournalWriterDrops(t *testing.T) {
+	t.Parallel()
+
+	r := &recorder{block: make(chan struct{})}
+	w := newJournalWriter(r.send, 1)
+
+	// The blocked sender and the full queue result in dropped messages
+	for range 5 {
+		w.write(record{Message: "message"})
+	}
+
+	close(r.block)
+	w.flush(time.Second)
+
+	w.write(record{Message: "last"})
+
+	w.flush(time.Second)
+
+	messages := r.get()
+	assert.Equal(t, "INFO last", messages[len(messages)-1])
+	assert.True(t, slices.ContainsFunc(messages, func(msg string) bool {
+		return strings.HasPrefix(msg, "WARN Dropped ")
+	}), messages)
+}
+
+func TestJournalWriterFailure(t *testing.T) {
+	t.Parallel()
+
+	var calls atomic.Int32
+
+	w := newJournalWriter(func(record) error {
+		calls.Add(1)
+
+		return errors.New("unreachable")
+	}, 10)
+
+	for range 3 {
+		w.write(record{Message: "message"})
+		w.flush(time.Second)
+	}
+
+	assert.True(t, w.failed.Load())
+	assert.Equal(t, int32(1), calls.Load())
+}
@@ -2,52 +2,161 @@
 package logger
 
 import (
+	"context"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"os"
+	"runtime"
+	"slices"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/coreos/go-systemd/v22/journal"
 )
 
+// flushTimeout is the maximum time to wait for pending journal messages and
+// exported log records.
+const flushTimeout = 2 * time.Second
+
 var (
-	instance *log.Logger
+	root     *handler
+	journalW *journalWriter
 	once     sync.Once
+
+	// level is the minimum level of the logged records.
+	level = new(slog.LevelVar)
+
+	// jsonOutput writes JSON documents instead of text lines to stderr.
+	jsonOutput atomic.Bool
 )
 
-// L can be used to get the default logging instance.
-func L() *log.Logger {
-	once.Do(func() { instance = newLogger() })
+// setup creates the root handler on first use.
+func setup() {
+	once.Do(func() {
+		root = newHandler(os.Stderr, journalAvailable())
+	})
+}
+
+// journalAvailable reports whether journald accepts messages.
+var journalAvailable = journal.Enabled
+
+// newHandler returns the handler writing to stderr and all other log outputs.
+// The journal is only used if journald is available, which is not the case in
+// containers or on minimal hosts, otherwise the logs only go to stderr.
+func newHandler(stderr io.Writer, withJournal bool) *handler {
+	if !withJournal {
+		fmt.Fprintln(stderr, "Journald is not available, logging to stderr only")
+
+		return &handler{mu: &sync.Mutex{}, stderr: stderr, sinks: []func(record){exports.export}}
+	}
+
+	journalW = newJournalWriter(func(rec record) error {
+		return journal.Send(rec.text(), journalPriority(rec.Level), journalVars(&rec))
+	}, journalQueueSize)
+
+	return &handler{mu: &sync.Mutex{}, stderr: stderr, sinks: []func(record){journalW.write, exports.export}}
+}
+
+// SetLevel sets the minimum level of the logged records, which is one of
+// debug, info, warn or error.
+func SetLevel(name string) error {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(name)); err != nil {
+		return fmt.Errorf("parse log level: %w", err)
+	}
+
+	level.Set(l)
+
+	return nil
+}
+
+// SetJSON switches the stderr output between JSON and text lines. The journal
+// and the exports are not affected.
+func SetJSON(enabled bool) {
+	jsonOutput.Store(enabled)
+}
+
+// Logger returns the structured logger writing to all log outputs. Its
+// attributes get passed as fields to the journal and the exports.
+func Logger() *slog.Logger {
+	setup()
 
-	return instance
+	return slog.New(root)
 }
 
-// newLogger creates a new default logger instance.
-func newLogger() *log.Logger {
-	writer := io.MultiWriter(os.Stderr, &journalWriter{})
+// Debugf logs the message at the debug level.
+func Debugf(format string, v ...any) {
+	logf(slog.LevelDebug, format, v...)
+}
+
+// Infof logs the message at the info level.
+func Infof(format string, v ...any) {
+	logf(slog.LevelInfo, format, v...)
+}
+
+// Warnf logs the message at the warn level.
+func Warnf(format string, v ...any) {
+	logf(slog.LevelWarn, format, v...)
+}
 
-	return log.New(writer, "", log.Ldate|log.Ltime|log.Lshortfile)
+// Errorf logs the message at the error level.
+func Errorf(format string, v ...any) {
+	logf(slog.LevelError, format, v...)
 }
 
-type journalWriter struct{}
+// logf logs the message at the level with the source of the caller of the
+// exported logging function.
+func logf(l slog.Level, format string, v ...any) {
+	const skip = 3
 
-func (*journalWriter) Write(p []byte) (int, error) {
-	// log.Ldate + log.Ltime have a length of 20 including 2 spaces
-	const trimLen = 20
+	setup()
 
-	// Avoid string allocation by using byte slicing directly
-	var trimmed string
-	if len(p) > trimLen {
-		// Convert only the necessary portion to string
-		trimmed = string(p[trimLen:])
-	} else {
-		trimmed = string(p)
+	if !root.Enabled(context.Background(), l) {
+		return
 	}
 
-	if err := journal.Send(trimmed, journal.PriInfo, nil); err != nil {
-		return 0, fmt.Errorf("unable to send to journald: %w", err)
+	var pcs [1]uintptr
+
+	runtime.Callers(skip, pcs[:])
+
+	r := slog.NewRecord(time.Now(), l, fmt.Sprintf(format, v...), pcs[0])
+
+	_ = root.Handle(context.Background(), r) //nolint:errcheck // nothing we can do
+}
+
+// Flush waits until all pending journal messages and exported log records are
+// sent, but not longer than a fixed timeout to never block the process exit on
+// journald or a collector.
+func Flush() {
+	var wg sync.WaitGroup
+
+	if journalW != nil {
+		wg.Go(func() { journalW.flush(flushTimeout) })
 	}
 
-	return len(p), nil
+	otlpMu.Lock()
+	exporters := slices.Clone(otlpE)
+	otlpMu.Unlock()
+
+	for _, e := range exporters {
+		wg.Go(func() { e.flush(flushTimeout) })
+	}
+
+	wg.Wait()
+}
+
+// Fatalf logs the message at the error level, flushes the journal and exits
+// with code 1.
+func Fatalf(format string, v ...any) {
+	logf(slog.LevelError, format, v...)
+
+	Exit(1)
+}
+
+// Exit flushes the journal and exits with the provided code.
+func Exit(code int) {
+	Flush()
+	os.Exit(code)
 }
@@ -2,10 +2,17 @@ package logger
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
 	"io"
+	"log/slog"
 	"os"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/coreos/go-systemd/v22/journal"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -27,8 +34,8 @@ func TestNew(t *testing.T) {
 			r, w, _ := os.Pipe()
 			os.Stderr = w
 
-			L().Print(tc.message)
-			L().Print(tc.message)
+			Infof("%s", tc.message)
+			Infof("%s", tc.message)
 
 			require.NoError(t, w.Close())
 
@@ -43,3 +50,93 @@ func TestNew(t *testing.T) {
 		})
 	}
 }
+
+func TestNewHandlerWithoutJournal(t *testing.T) {
+	t.Parallel()
+
+	buf := &bytes.Buffer{}
+	h := newHandler(buf, false)
+
+	require.NoError(t, h.Handle(t.Context(), slog.NewRecord(time.Date(2025, 1, 1, 10, 0, 0, 0, time.Local), slog.LevelWarn, "message", 0)))
+
+	assert.Equal(t, "Journald is not available, logging to stderr only\n2025/01/01 10:00:00 WARN message\n", buf.String())
+}
+
+//nolint:paralleltest // modifies the global level and output format
+func TestLevels(t *testing.T) {
+	var sunk []record
+
+	stderr := &bytes.Buffer{}
+	h := &handler{mu: &sync.Mutex{}, stderr: stderr, sinks: []func(record){func(rec record) {
+		sunk = append(sunk, rec)
+	}}}
+
+	require.Error(t, SetLevel("verbose"))
+	require.NoError(t, SetLevel("warn"))
+	SetJSON(true)
+
+	t.Cleanup(func() {
+		level.Set(slog.LevelInfo)
+		SetJSON(false)
+	})
+
+	logger := slog.New(h)
+	logger.Info("hidden")
+	logger.Warn("shown", "registry", "quay.io")
+
+	require.Len(t, sunk, 1)
+	assert.Equal(t, slog.LevelWarn, sunk[0].Level)
+	assert.Equal(t, "shown", sunk[0].Message)
+	assert.Equal(t, attrs{slog.String("registry", "quay.io")}, sunk[0].Attrs)
+	assert.True(t, strings.HasSuffix(sunk[0].text(), "WARN shown registry=quay.io"), sunk[0].text())
+
+	rec := map[string]any{}
+	require.NoError(t, json.Unmarshal(stderr.Bytes(), &rec))
+	assert.Equal(t, "WARN", rec["level"])
+	assert.Equal(t, "logger_test.go", strings.Split(rec["source"].(string), ":")[0]) //nolint:forcetypeassert // checked by the encoding
+	assert.Equal(t, "shown", rec["message"])
+	assert.Equal(t, map[string]any{"registry": "quay.io"}, rec["attrs"])
+}
+
+func TestHandlerAttrs(t *testing.T) {
+	t.Parallel()
+
+	var sunk []record
+
+	stderr := &bytes.Buffer{}
+	h := &handler{mu: &sync.Mutex{}, stderr: stderr, sinks: []func(record){func(rec record) {
+		sunk = append(sunk, rec)
+	}}}
+
+	logger := slog.New(h).With("namespace", "default").WithGroup("run")
+	logger.Info("done", "outcome", "provisioned", slog.Group("secrets", "matched", 2), slog.Any("error", errors.New("failed")))
+
+	require.Len(t, sunk, 1)
+	assert.Equal(t, attrs{
+		slog.String("namespace", "default"),
+		slog.String("run.outcome", "provisioned"),
+		slog.Int("run.secrets.matched", 2),
+		slog.Any("run.error", errors.New("failed")),
+	}, sunk[0].Attrs)
+	assert.Contains(t, stderr.String(), "INFO done namespace=default run.outcome=provisioned run.secrets.matched=2 run.error=failed\n")
+
+	assert.Equal(t, map[string]string{
+		"NAMESPACE":           "default",
+		"RUN_OUTCOME":         "provisioned",
+		"RUN_SECRETS_MATCHED": "2",
+		"RUN_ERROR":           "failed",
+	}, journalVars(&sunk[0]))
+}
+
+func TestJournalPriority(t *testing.T) {
+	t.Parallel()
+
+	for l, expected := range map[slog.Level]journal.Priority{
+		slog.LevelDebug: journal.PriDebug,
+		slog.LevelInfo:  journal.PriInfo,
+		slog.LevelWarn:  journal.PriWarning,
+		slog.LevelError: journal.PriErr,
+	} {
+		assert.Equal(t, expected, journalPriority(l), l)
+	}
+}
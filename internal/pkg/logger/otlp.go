@@ -0,0 +1,212 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// otlpQueueSize is the maximum number of pending OTLP log records.
+	otlpQueueSize = 1024
+
+	// otlpBatchSize is the maximum number of log records per export request.
+	otlpBatchSize = 128
+
+	// otlpTimeout is the timeout of a single export request.
+	otlpTimeout = 5 * time.Second
+
+	// otlpLogsPath is the OTLP/HTTP path for log exports.
+	otlpLogsPath = "/v1/logs"
+
+	// otlpSeverityInfo is the OTLP severity number of informational records.
+	otlpSeverityInfo = 9
+
+	serviceName = "crio-credential-provider"
+)
+
+var errOTLPStatus = errors.New("unexpected OTLP response status")
+
+var (
+	otlpMu sync.Mutex
+	otlpE  []*otlpExporter
+)
+
+// otlpExporter sends the log records in batches to an OTLP/HTTP collector
+// using the JSON encoding. Like the journal, records get dropped if the
+// bounded queue is full to never block the logging caller.
+type otlpExporter struct {
+	url     string
+	client  *http.Client
+	queue   chan record
+	pending sync.WaitGroup
+
+	// failed ensures that export failures get reported only once.
+	failed atomic.Bool
+}
+
+func newOTLPExporter(endpoint string, size int) *otlpExporter {
+	url := strings.TrimSuffix(endpoint, "/")
+	if !strings.HasSuffix(url, otlpLogsPath) {
+		url += otlpLogsPath
+	}
+
+	e := &otlpExporter{
+		url:    url,
+		client: &http.Client{Timeout: otlpTimeout},
+		queue:  make(chan record, size),
+	}
+
+	go e.run()
+
+	return e
+}
+
+func (e *otlpExporter) export(rec record) {
+	e.pending.Add(1)
+
+	select {
+	case e.queue <- rec:
+	default:
+		e.pending.Done()
+	}
+}
+
+func (e *otlpExporter) run() {
+	for rec := range e.queue {
+		batch := []record{rec}
+
+	drain:
+		for len(batch) < otlpBatchSize {
+			select {
+			case rec := <-e.queue:
+				batch = append(batch, rec)
+			default:
+				break drain
+			}
+		}
+
+		if err := e.send(batch); err != nil && e.failed.CompareAndSwap(false, true) {
+			// Using the logger would feed the failure back into the exporter
+			fmt.Fprintf(os.Stderr, "Unable to export logs via OTLP, further failures are not reported: %v\n", err)
+		}
+
+		for range batch {
+			e.pending.Done()
+		}
+	}
+}
+
+func (e *otlpExporter) send(batch []record) error {
+	body, err := json.Marshal(otlpPayload(batch))
+	if err != nil {
+		return fmt.Errorf("marshal OTLP payload: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), otlpTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create OTLP request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("send OTLP request: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("%w: %s", errOTLPStatus, resp.Status)
+	}
+
+	return nil
+}
+
+// flush waits until all queued records are exported or the timeout exceeds.
+func (e *otlpExporter) flush(timeout time.Duration) {
+	waitTimeout(&e.pending, timeout)
+}
+
+type otlpAnyValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpLogRecord struct {
+	TimeUnixNano   string         `json:"timeUnixNano"`
+	SeverityNumber int            `json:"severityNumber"`
+	SeverityText   string         `json:"severityText"`
+	Body           otlpAnyValue   `json:"body"`
+	Attributes     []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+type otlpScopeLogs struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	LogRecords []otlpLogRecord `json:"logRecords"`
+}
+
+type otlpResourceLogs struct {
+	Resource struct {
+		Attributes []otlpKeyValue `json:"attributes"`
+	} `json:"resource"`
+	ScopeLogs []otlpScopeLogs `json:"scopeLogs"`
+}
+
+type otlpLogsData struct {
+	ResourceLogs []otlpResourceLogs `json:"resourceLogs"`
+}
+
+// otlpPayload converts the records into the OTLP JSON logs data model.
+func otlpPayload(batch []record) *otlpLogsData {
+	scope := otlpScopeLogs{LogRecords: make([]otlpLogRecord, 0, len(batch))}
+	scope.Scope.Name = serviceName
+
+	for _, rec := range batch {
+		// The distances of the slog levels match the OTLP severity numbers
+		logRecord := otlpLogRecord{
+			TimeUnixNano:   strconv.FormatInt(rec.Time.UnixNano(), 10),
+			SeverityNumber: otlpSeverityInfo + int(rec.Level-slog.LevelInfo),
+			SeverityText:   rec.Level.String(),
+			Body:           otlpAnyValue{StringValue: rec.Message},
+		}
+
+		if rec.Source != "" {
+			logRecord.Attributes = append(logRecord.Attributes, otlpKeyValue{Key: "code.filepath", Value: otlpAnyValue{StringValue: rec.Source}})
+		}
+
+		for _, attr := range rec.Attrs {
+			logRecord.Attributes = append(logRecord.Attributes, otlpKeyValue{Key: attr.Key, Value: otlpAnyValue{StringValue: valueString(attr.Value)}})
+		}
+
+		scope.LogRecords = append(scope.LogRecords, logRecord)
+	}
+
+	resource := otlpResourceLogs{ScopeLogs: []otlpScopeLogs{scope}}
+	resource.Resource.Attributes = []otlpKeyValue{
+		{Key: "service.name", Value: otlpAnyValue{StringValue: serviceName}},
+		{Key: "process.pid", Value: otlpAnyValue{StringValue: strconv.Itoa(os.Getpid())}},
+	}
+
+	return &otlpLogsData{ResourceLogs: []otlpResourceLogs{resource}}
+}
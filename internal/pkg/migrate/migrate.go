@@ -0,0 +1,254 @@
+// Package migrate contains the migration of auth files written by earlier
+// versions of the credential provider.
+package migrate
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/app"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/auth"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/events"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/logger"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/state"
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+	"github.com/cri-o/crio-credential-provider/pkg/docker"
+)
+
+// legacyExt is the file extension of the legacy per-namespace auth files.
+const legacyExt = ".json"
+
+var errInvalidAuths = errors.New("file does not contain auth entries")
+
+// Result contains the outcome of a migration.
+type Result struct {
+	// Converted are the paths of the auth files written from legacy files.
+	Converted []string
+
+	// Removed are the paths of the removed legacy files.
+	Removed []string
+
+	// Skipped are the paths of the legacy files which have been kept,
+	// because their contents are not parsable.
+	Skipped []string
+}
+
+// LegacyFile is an auth file written by earlier versions of the credential
+// provider, which used a single <namespace>.json file per namespace.
+type LegacyFile struct {
+	// Path is the path of the legacy file.
+	Path string
+
+	// Namespace is the namespace the legacy file belongs to.
+	Namespace string
+}
+
+// LegacyFiles returns all legacy per-namespace auth files within dir besides
+// the excluded paths. A non existing directory results in an empty list.
+func LegacyFiles(dir string, exclude ...string) ([]LegacyFile, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("read auth dir: %w", err)
+	}
+
+	files := []LegacyFile{}
+
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || slices.Contains(exclude, filepath.Join(dir, entry.Name())) {
+			continue
+		}
+
+		namespace, ok := strings.CutSuffix(entry.Name(), legacyExt)
+		if !ok || len(validation.IsDNS1123Label(namespace)) > 0 {
+			continue
+		}
+
+		files = append(files, LegacyFile{Path: filepath.Join(dir, entry.Name()), Namespace: namespace})
+	}
+
+	return files, nil
+}
+
+// Run converts the legacy files of the auth directory into the current
+// <namespace>-<sha256>.json layout and removes them afterwards. Auth files get
+// written for every image recorded in the state for the namespace as well as
+// the provided images, while already existing auth files are kept. Legacy files
+// whose contents are not parsable are kept to not remove foreign files. Nothing
+// gets changed if dryRun is true.
+func Run(cfg *config.Config, extraImages []string, dryRun bool) (*Result, error) {
+	// Other files may be located within the auth directory, too
+	files, err := LegacyFiles(cfg.AuthDir, cfg.StateFile, cfg.KubeletAuthFilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &Result{}
+	if len(files) == 0 {
+		return res, nil
+	}
+
+	s, err := state.Load(cfg.StateFile)
+	if err != nil {
+		return nil, fmt.Errorf("load state: %w", err)
+	}
+
+	integrityKey, err := auth.LoadOrCreateIntegrityKey(cfg.IntegrityKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get integrity key: %w", err)
+	}
+
+	stamp, err := app.NewStamp(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		errs       []error
+		images     = map[string]string{}
+		namespaces = map[string]string{}
+	)
+
+	for _, file := range files {
+		contents, err := readLegacyFile(file.Path)
+		if err != nil {
+			logger.Warnf("Keeping legacy file %s: %v", file.Path, err)
+			res.Skipped = append(res.Skipped, file.Path)
+
+			continue
+		}
+
+		converted, err := convert(cfg, file.Namespace, namespaceImages(s, file.Namespace, extraImages), contents, integrityKey, stamp, dryRun)
+		for path, image := range converted {
+			res.Converted = append(res.Converted, path)
+			images[path] = image
+			namespaces[path] = file.Namespace
+		}
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("convert legacy file %s: %w", file.Path, err))
+
+			continue
+		}
+
+		if !dryRun {
+			if err := os.Remove(file.Path); err != nil && !os.IsNotExist(err) {
+				errs = append(errs, fmt.Errorf("remove legacy file: %w", err))
+
+				continue
+			}
+
+			events.Emit(events.TypeDeleted, events.Data{Path: file.Path, Namespace: file.Namespace})
+		}
+
+		res.Removed = append(res.Removed, file.Path)
+	}
+
+	slices.Sort(res.Converted)
+
+	if len(res.Converted) > 0 && !dryRun {
+		if err := state.Update(cfg.StateFile, func(s *state.State) error {
+			for _, path := range res.Converted {
+				s.Files[path] = &state.File{
+					Namespace: namespaces[path],
+					Image:     images[path],
+					Updated:   time.Now(),
+					Owner:     stamp.Owner,
+					Fence:     stamp.Fence,
+				}
+			}
+
+			return nil
+		}); err != nil {
+			errs = append(errs, fmt.Errorf("update state: %w", err))
+		}
+	}
+
+	return res, errors.Join(errs...)
+}
+
+// convert writes the legacy contents as auth file for every image and returns
+// the images of the written files by their path.
+func convert(cfg *config.Config, namespace string, images []string, contents docker.ConfigJSON, integrityKey []byte, stamp auth.Stamp, dryRun bool) (map[string]string, error) {
+	fileNamespace := auth.FileNamespace(namespace, cfg.HashNamespaces, integrityKey)
+	converted := map[string]string{}
+
+	for _, image := range images {
+		path, err := cfg.Naming.FilePath(cfg.AuthDir, fileNamespace, image)
+		if err != nil {
+			return converted, err
+		}
+
+		if _, err := os.Stat(path); err == nil {
+			// The auth file got already written by the current version
+			continue
+		}
+
+		if dryRun {
+			converted[path] = image
+
+			continue
+		}
+
+		path, written, err := auth.WriteAuthFile(cfg.AuthDir, fileNamespace, image, contents, cfg.AuthFormat, integrityKey, stamp)
+		if err != nil {
+			return converted, fmt.Errorf("write auth file for image %q: %w", image, err)
+		}
+
+		if written {
+			converted[path] = image
+		}
+	}
+
+	return converted, nil
+}
+
+// namespaceImages returns the sorted unique images recorded in the state for
+// the namespace together with the provided images.
+func namespaceImages(s *state.State, namespace string, images []string) []string {
+	res := slices.Clone(images)
+
+	for _, file := range s.Files {
+		if file.Namespace == namespace && file.Image != "" {
+			res = append(res, file.Image)
+		}
+	}
+
+	slices.Sort(res)
+
+	return slices.Compact(res)
+}
+
+func readLegacyFile(path string) (docker.ConfigJSON, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return docker.ConfigJSON{}, fmt.Errorf("read legacy file: %w", err)
+	}
+
+	contents, _, err := docker.ParseConfigJSON(raw)
+	if err != nil {
+		return docker.ConfigJSON{}, fmt.Errorf("parse legacy file: %w", err)
+	}
+
+	if len(contents.Auths) == 0 {
+		return docker.ConfigJSON{}, errInvalidAuths
+	}
+
+	for _, entry := range contents.Auths {
+		if entry.Auth == "" && !entry.HasToken() {
+			return docker.ConfigJSON{}, errInvalidAuths
+		}
+	}
+
+	return contents, nil
+}
@@ -0,0 +1,110 @@
+package migrate
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/state"
+	"github.com/cri-o/crio-credential-provider/pkg/auth"
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+)
+
+const legacyContents = `{"auths":{"quay.io":{"auth":"dXNlcjpwYXNz"}}}`
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+
+	for name, tc := range map[string]struct {
+		dryRun bool
+	}{
+		"migration": {},
+		"dry run":   {dryRun: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+
+			cfg := config.Default()
+			cfg.AuthDir = dir
+			cfg.IntegrityKeyPath = filepath.Join(dir, "integrity.key")
+			cfg.StateFile = filepath.Join(dir, "state.json")
+			cfg.KubeletAuthFilePath = filepath.Join(dir, "kubelet.json")
+
+			legacy := filepath.Join(dir, "ns.json")
+			foreign := filepath.Join(dir, "other.json")
+
+			require.NoError(t, os.WriteFile(legacy, []byte(legacyContents), 0o600))
+			require.NoError(t, os.WriteFile(foreign, []byte(`{"key":"value"}`), 0o600))
+			require.NoError(t, os.WriteFile(cfg.KubeletAuthFilePath, []byte(legacyContents), 0o600))
+			require.NoError(t, state.Update(cfg.StateFile, func(s *state.State) error {
+				s.Files[filepath.Join(dir, "gone.json")] = &state.File{Namespace: "ns", Image: "quay.io/org/recorded"}
+
+				return nil
+			}))
+
+			res, err := Run(cfg, []string{"quay.io/org/provided"}, tc.dryRun)
+			require.NoError(t, err)
+
+			assert.Equal(t, []string{legacy}, res.Removed)
+			assert.Equal(t, []string{foreign}, res.Skipped)
+			require.Len(t, res.Converted, 2)
+			assert.FileExists(t, foreign)
+			assert.FileExists(t, cfg.KubeletAuthFilePath)
+
+			if tc.dryRun {
+				assert.FileExists(t, legacy)
+
+				for _, path := range res.Converted {
+					assert.NoFileExists(t, path)
+				}
+
+				return
+			}
+
+			assert.NoFileExists(t, legacy)
+
+			key, err := auth.ReadKey(cfg.IntegrityKeyPath)
+			require.NoError(t, err)
+
+			for _, image := range []string{"quay.io/org/provided", "quay.io/org/recorded"} {
+				contents, err := auth.Read(dir, "ns", image, cfg.AuthFormat, key)
+				require.NoError(t, err)
+				assert.Equal(t, "dXNlcjpwYXNz", contents.Auths["quay.io"].Auth)
+			}
+
+			s, err := state.Load(cfg.StateFile)
+			require.NoError(t, err)
+
+			for _, path := range res.Converted {
+				require.Contains(t, s.Files, path)
+				assert.Equal(t, "ns", s.Files[path].Namespace)
+			}
+		})
+	}
+}
+
+func TestLegacyFiles(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	current, err := auth.FilePath(dir, "ns", "quay.io/org/app")
+	require.NoError(t, err)
+
+	for _, name := range []string{"ns.json", "Invalid_NS.json", "ns.txt", filepath.Base(current)} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("{}"), 0o600))
+	}
+
+	files, err := LegacyFiles(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []LegacyFile{{Path: filepath.Join(dir, "ns.json"), Namespace: "ns"}}, files)
+
+	files, err = LegacyFiles(filepath.Join(dir, "missing"))
+	require.NoError(t, err)
+	assert.Empty(t, files)
+}
@@ -0,0 +1,240 @@
+// Package policy contains the application of the RegistryCredentialPolicy
+// resources, which move the credential distribution policy of a namespace
+// from the node configuration into the cluster.
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/claims"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/errcode"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/k8s"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/logger"
+	"github.com/cri-o/crio-credential-provider/pkg/apis/v1alpha1"
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+	"github.com/cri-o/crio-credential-provider/pkg/docker"
+	"github.com/cri-o/crio-credential-provider/pkg/mirrors"
+)
+
+var (
+	// ErrInvalidPolicy is returned if a RegistryCredentialPolicy cannot be
+	// applied.
+	ErrInvalidPolicy = errors.New("invalid registry credential policy")
+
+	// ErrNotAuthorized is returned if a RegistryCredentialPolicy does not
+	// permit the namespace to receive credentials for any mirror.
+	ErrNotAuthorized = errcode.New(errcode.NotAuthorized, "namespace is not authorized to receive mirror credentials")
+)
+
+// Policy is the RegistryCredentialPolicy applying to a namespace. All methods
+// of a nil Policy keep the node configuration.
+type Policy struct {
+	name string
+	spec v1alpha1.RegistryCredentialPolicySpec
+}
+
+// Load returns the policy applying to the namespace, or nil if there is none
+// or the policies are disabled. Errors have to fail the write, because
+// ignoring the policy could distribute credentials it does not permit.
+func Load(ctx context.Context, cfg *config.Config, client kubernetes.Interface, namespace string) (*Policy, error) {
+	if !cfg.RegistryCredentialPolicies {
+		return nil, nil //nolint:nilnil // no policy is not an error
+	}
+
+	resource, err := k8s.RetrieveRegistryCredentialPolicy(ctx, client, namespace)
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve registry credential policy: %w", err)
+	}
+
+	if resource == nil {
+		return nil, nil //nolint:nilnil // no policy is not an error
+	}
+
+	return New(resource)
+}
+
+// New returns the policy of the resource after validating it.
+func New(resource *v1alpha1.RegistryCredentialPolicy) (*Policy, error) {
+	switch resource.Spec.SecretMatching {
+	case "", config.SecretMatchingPrefix, config.SecretMatchingReference:
+	default:
+		return nil, fmt.Errorf("%w %s: %w: %q", ErrInvalidPolicy, resource.Name, config.ErrUnknownSecretMatching, resource.Spec.SecretMatching)
+	}
+
+	if resource.Spec.TTL != nil && resource.Spec.TTL.Duration < 0 {
+		return nil, fmt.Errorf("%w %s: ttl: %w: %s", ErrInvalidPolicy, resource.Name, config.ErrNegativeDuration, resource.Spec.TTL.Duration)
+	}
+
+	logger.Infof("Applying registry credential policy %s", resource.Name)
+
+	return &Policy{name: resource.Name, spec: resource.Spec}, nil
+}
+
+// Name returns the name of the policy resource, or an empty string if p is nil.
+func (p *Policy) Name() string {
+	if p == nil {
+		return ""
+	}
+
+	return p.name
+}
+
+// Config returns the configuration with the secret matching of the policy.
+func (p *Policy) Config(cfg *config.Config) *config.Config {
+	if p == nil || p.spec.SecretMatching == "" || p.spec.SecretMatching == cfg.SecretMatching {
+		return cfg
+	}
+
+	res := *cfg
+	res.SecretMatching = p.spec.SecretMatching
+
+	return &res
+}
+
+// Sources returns the pull sources with the ones not matching the allowed
+// registries of the policy being denied.
+func (p *Policy) Sources(sources []mirrors.Source) []mirrors.Source {
+	if p == nil || len(p.spec.AllowedRegistries) == 0 {
+		return sources
+	}
+
+	res := slices.Clone(sources)
+
+	for i := range res {
+		if res[i].Allowed && !claims.MatchAny(p.spec.AllowedRegistries, res[i].Location) {
+			res[i].Allowed = false
+			res[i].Reason = "not allowed by registry credential policy " + p.name
+		}
+	}
+
+	return res
+}
+
+// Denied returns ErrNotAuthorized together with the allowed registries of the
+// policy if it denies any mirror of the sources, or nil otherwise. It has to
+// be checked if no mirror is allowed, because the policy is the reason in
+// that case.
+func (p *Policy) Denied(sources []mirrors.Source) error {
+	if p == nil || len(p.spec.AllowedRegistries) == 0 {
+		return nil
+	}
+
+	denied := []string{}
+
+	for i := range sources {
+		if sources[i].Mirror && !claims.MatchAny(p.spec.AllowedRegistries, sources[i].Location) {
+			denied = append(denied, sources[i].Location)
+		}
+	}
+
+	if len(denied) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf(
+		"%w: registry credential policy %s only allows the registries %q, which do not match the mirrors %q",
+		ErrNotAuthorized, p.name, p.spec.AllowedRegistries, denied,
+	)
+}
+
+// Expires returns the time after which an auth file written now expires, or
+// the zero time if it does not expire.
+func (p *Policy) Expires(now time.Time) time.Time {
+	if p == nil || p.spec.TTL == nil || p.spec.TTL.Duration == 0 {
+		return time.Time{}
+	}
+
+	return now.Add(p.spec.TTL.Duration)
+}
+
+// Secrets returns the secrets restricted by the precedence of the policy. The
+// registry entries matching a precedence rule are only kept for the first
+// listed secret providing the same entry, while the ones of unlisted secrets
+// get removed. Only the first matching rule applies to an entry. Unparsable
+// secrets are kept unchanged to get reported as malformed.
+func (p *Policy) Secrets(secrets *corev1.SecretList) *corev1.SecretList {
+	if p == nil || len(p.spec.Precedence) == 0 {
+		return secrets
+	}
+
+	configs := map[string]docker.ConfigJSON{}
+
+	for i := range secrets.Items {
+		secret := &secrets.Items[i]
+
+		if config, _, err := docker.ParseConfigJSON(secret.Data[corev1.DockerConfigJsonKey]); err == nil {
+			configs[secret.Name] = config
+		}
+	}
+
+	res := &corev1.SecretList{Items: make([]corev1.Secret, 0, len(secrets.Items))}
+
+	for i := range secrets.Items {
+		secret := &secrets.Items[i]
+
+		config, ok := configs[secret.Name]
+		if !ok {
+			res.Items = append(res.Items, *secret)
+
+			continue
+		}
+
+		kept := maps.Clone(config.Auths)
+
+		maps.DeleteFunc(kept, func(registry string, _ docker.AuthConfig) bool {
+			owner, ok := p.owner(configs, registry)
+
+			return ok && owner != secret.Name
+		})
+
+		if len(kept) == len(config.Auths) {
+			res.Items = append(res.Items, *secret)
+
+			continue
+		}
+
+		logger.Infof("Registry credential policy %s removed %d registry entries of secret %s", p.name, len(config.Auths)-len(kept), secret.Name)
+
+		raw, err := json.Marshal(docker.ConfigJSON{Auths: kept})
+		if err != nil {
+			// Cannot happen for a map of strings, keep the secret out to be safe
+			continue
+		}
+
+		restricted := secret.DeepCopy()
+		restricted.Data[corev1.DockerConfigJsonKey] = raw
+		res.Items = append(res.Items, *restricted)
+	}
+
+	return res
+}
+
+// owner returns the name of the secret whose entry for the registry has to be
+// used, which is empty if no listed secret provides it. It returns false if
+// no precedence rule matches the registry.
+func (p *Policy) owner(configs map[string]docker.ConfigJSON, registry string) (string, bool) {
+	for _, rule := range p.spec.Precedence {
+		if !claims.MatchAny([]string{rule.Registry}, registry) {
+			continue
+		}
+
+		for _, name := range rule.Secrets {
+			if _, ok := configs[name].Auths[registry]; ok {
+				return name, true
+			}
+		}
+
+		return "", true
+	}
+
+	return "", false
+}
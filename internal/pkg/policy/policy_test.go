@@ -0,0 +1,180 @@
+package policy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/cri-o/crio-credential-provider/pkg/apis/v1alpha1"
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+	"github.com/cri-o/crio-credential-provider/pkg/docker"
+	"github.com/cri-o/crio-credential-provider/pkg/mirrors"
+)
+
+func newPolicy(t *testing.T, spec v1alpha1.RegistryCredentialPolicySpec) *Policy {
+	t.Helper()
+
+	p, err := New(&v1alpha1.RegistryCredentialPolicy{ObjectMeta: metav1.ObjectMeta{Name: "policy"}, Spec: spec})
+	require.NoError(t, err)
+
+	return p
+}
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	for name, tc := range map[string]struct {
+		spec v1alpha1.RegistryCredentialPolicySpec
+		err  error
+	}{
+		"success": {
+			spec: v1alpha1.RegistryCredentialPolicySpec{SecretMatching: config.SecretMatchingReference, TTL: &metav1.Duration{Duration: time.Hour}},
+		},
+		"failure on unknown secret matching": {
+			spec: v1alpha1.RegistryCredentialPolicySpec{SecretMatching: "wrong"},
+			err:  config.ErrUnknownSecretMatching,
+		},
+		"failure on negative ttl": {
+			spec: v1alpha1.RegistryCredentialPolicySpec{TTL: &metav1.Duration{Duration: -time.Hour}},
+			err:  config.ErrNegativeDuration,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := New(&v1alpha1.RegistryCredentialPolicy{Spec: tc.spec})
+			if tc.err != nil {
+				require.ErrorIs(t, err, ErrInvalidPolicy)
+				require.ErrorIs(t, err, tc.err)
+
+				return
+			}
+
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestNilPolicy(t *testing.T) {
+	t.Parallel()
+
+	var p *Policy
+
+	cfg := config.Default()
+	sources := []mirrors.Source{{Location: "quay.io", Allowed: true}}
+	secrets := &corev1.SecretList{}
+
+	assert.Empty(t, p.Name())
+	assert.Same(t, cfg, p.Config(cfg))
+	assert.Equal(t, sources, p.Sources(sources))
+	assert.Same(t, secrets, p.Secrets(secrets))
+	assert.True(t, p.Expires(time.Now()).IsZero())
+}
+
+func TestConfig(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.Default()
+	res := newPolicy(t, v1alpha1.RegistryCredentialPolicySpec{SecretMatching: config.SecretMatchingReference}).Config(cfg)
+
+	assert.Equal(t, config.SecretMatchingReference, res.SecretMatching)
+	assert.Equal(t, config.SecretMatchingPrefix, cfg.SecretMatching)
+}
+
+func TestSources(t *testing.T) {
+	t.Parallel()
+
+	sources := []mirrors.Source{
+		{Location: "mirror.example.com/org", Mirror: true, Allowed: true},
+		{Location: "quay.io/org", Allowed: true},
+		{Location: "denied.example.com", Reason: "rejected by policy"},
+	}
+
+	res := newPolicy(t, v1alpha1.RegistryCredentialPolicySpec{AllowedRegistries: []string{"*.example.com"}}).Sources(sources)
+
+	assert.True(t, res[0].Allowed)
+	assert.False(t, res[1].Allowed)
+	assert.Equal(t, "not allowed by registry credential policy policy", res[1].Reason)
+	assert.Equal(t, "rejected by policy", res[2].Reason)
+	assert.True(t, sources[1].Allowed, "must not modify the sources")
+}
+
+func TestDenied(t *testing.T) {
+	t.Parallel()
+
+	sources := []mirrors.Source{
+		{Location: "mirror.example.com/org", Mirror: true, Allowed: true},
+		{Location: "quay.io/org", Allowed: true},
+	}
+
+	var p *Policy
+	require.NoError(t, p.Denied(sources))
+	require.NoError(t, newPolicy(t, v1alpha1.RegistryCredentialPolicySpec{}).Denied(sources))
+	require.NoError(t, newPolicy(t, v1alpha1.RegistryCredentialPolicySpec{AllowedRegistries: []string{"*.example.com"}}).Denied(sources))
+
+	err := newPolicy(t, v1alpha1.RegistryCredentialPolicySpec{AllowedRegistries: []string{"quay.io"}}).Denied(sources)
+	require.ErrorIs(t, err, ErrNotAuthorized)
+	require.ErrorContains(t, err, `registry credential policy policy only allows the registries ["quay.io"], which do not match the mirrors ["mirror.example.com/org"]`)
+}
+
+func TestExpires(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+
+	assert.Equal(t, now.Add(time.Hour), newPolicy(t, v1alpha1.RegistryCredentialPolicySpec{TTL: &metav1.Duration{Duration: time.Hour}}).Expires(now))
+	assert.True(t, newPolicy(t, v1alpha1.RegistryCredentialPolicySpec{}).Expires(now).IsZero())
+}
+
+func TestSecrets(t *testing.T) {
+	t.Parallel()
+
+	secret := func(name, data string) corev1.Secret {
+		return corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Type:       corev1.SecretTypeDockerConfigJson,
+			Data:       map[string][]byte{corev1.DockerConfigJsonKey: []byte(data)},
+		}
+	}
+
+	secrets := &corev1.SecretList{Items: []corev1.Secret{
+		secret("fallback", `{"auths":{"mirror.example.com":{"auth":"ZmFsbGJhY2s="},"quay.io":{"auth":"cXVheQ=="}}}`),
+		secret("primary", `{"auths":{"https://mirror.example.com":{"auth":"cHJpbWFyeQ=="},"mirror.example.com":{"auth":"cHJpbWFyeQ=="}}}`),
+		secret("unlisted", `{"auths":{"mirror.example.com/org":{"auth":"dW5saXN0ZWQ="},"docker.io":{"auth":"ZG9ja2Vy"}}}`),
+		secret("malformed", `invalid`),
+	}}
+
+	res := newPolicy(t, v1alpha1.RegistryCredentialPolicySpec{Precedence: []v1alpha1.RegistryPrecedence{
+		{Registry: "*.example.com", Secrets: []string{"primary", "fallback"}},
+	}}).Secrets(secrets)
+
+	require.Len(t, res.Items, 4)
+
+	expected := map[string]map[string]docker.AuthConfig{
+		"fallback": {"quay.io": {Auth: "cXVheQ=="}},
+		"primary":  {"https://mirror.example.com": {Auth: "cHJpbWFyeQ=="}, "mirror.example.com": {Auth: "cHJpbWFyeQ=="}},
+		"unlisted": {"docker.io": {Auth: "ZG9ja2Vy"}},
+	}
+
+	for i := range res.Items {
+		item := &res.Items[i]
+
+		config, _, err := docker.ParseConfigJSON(item.Data[corev1.DockerConfigJsonKey])
+		if item.Name == "malformed" {
+			require.Error(t, err)
+
+			continue
+		}
+
+		require.NoError(t, err)
+		assert.Equal(t, expected[item.Name], config.Auths, item.Name)
+	}
+
+	original, _, err := docker.ParseConfigJSON(secrets.Items[0].Data[corev1.DockerConfigJsonKey])
+	require.NoError(t, err)
+	assert.Len(t, original.Auths, 2, "must not modify the secrets")
+}
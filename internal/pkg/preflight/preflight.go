@@ -0,0 +1,120 @@
+// Package preflight contains the startup checks for running the credential
+// provider as a non-root user.
+package preflight
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"syscall"
+
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+)
+
+// groupPerms are the permissions the auth group requires on the auth directory.
+const groupPerms = 0o070
+
+var (
+	errNotWritable = errors.New("directory is not writable")
+	errGroup       = errors.New("auth directory group ownership mismatch")
+)
+
+// Check verifies that the effective UID is able to complete all writes of a
+// credential provider run. If an auth group is configured, then the auth
+// directory has to be owned by that group with full group permissions.
+func Check(cfg *config.Config) error {
+	if cfg.AuthGroup != "" {
+		if err := checkGroup(cfg.AuthDir, cfg.AuthGroup); err != nil {
+			return err
+		}
+	}
+
+	candidates := []string{
+		cfg.AuthDir,
+		cfg.DiagnosticsDir,
+		filepath.Dir(cfg.IntegrityKeyPath),
+		filepath.Dir(cfg.StateFile),
+	}
+
+	if cfg.Audit.Enabled {
+		candidates = append(candidates, filepath.Dir(cfg.Audit.File))
+	}
+
+	if cfg.Admission.MaxInFlight > 0 {
+		candidates = append(candidates, cfg.Admission.Dir)
+	}
+
+	for i := range cfg.Outputs {
+		candidates = append(candidates, cfg.Outputs[i].Dir)
+	}
+
+	dirs := []string{}
+
+	for _, dir := range candidates {
+		if !slices.Contains(dirs, dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+
+	for _, dir := range dirs {
+		if err := checkWritable(dir); err != nil {
+			return fmt.Errorf(
+				"%w: %s is not writable for UID %d: %w. "+
+					"Create the directory with write permissions for the user or group of the provider, "+
+					"for example by using the shipped systemd-tmpfiles configuration",
+				errNotWritable, dir, os.Geteuid(), err,
+			)
+		}
+	}
+
+	return nil
+}
+
+func checkWritable(dir string) error {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("ensure directory: %w", err)
+	}
+
+	f, err := os.CreateTemp(dir, ".preflight-*.tmp")
+	if err != nil {
+		return fmt.Errorf("create file: %w", err)
+	}
+
+	_ = f.Close()
+
+	if err := os.Remove(f.Name()); err != nil {
+		return fmt.Errorf("remove file: %w", err)
+	}
+
+	return nil
+}
+
+func checkGroup(dir, group string) error {
+	g, err := user.LookupGroup(group)
+	if err != nil {
+		return fmt.Errorf("%w: unable to lookup group %q: %w", errGroup, group, err)
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("%w: unable to stat auth directory: %w", errGroup, err)
+	}
+
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fmt.Errorf("%w: unable to get owner of %s", errGroup, dir)
+	}
+
+	if strconv.FormatUint(uint64(stat.Gid), 10) != g.Gid || info.Mode().Perm()&groupPerms != groupPerms {
+		return fmt.Errorf(
+			"%w: %s has to be owned by group %q with read, write and execute permissions, fix it by running: chgrp %s %s && chmod g+rwx %s",
+			errGroup, dir, group, group, dir, dir,
+		)
+	}
+
+	return nil
+}
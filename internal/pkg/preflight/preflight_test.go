@@ -0,0 +1,79 @@
+package preflight
+
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+)
+
+func testConfig(t *testing.T) *config.Config {
+	t.Helper()
+
+	dir := t.TempDir()
+
+	cfg := config.Default()
+	cfg.AuthDir = filepath.Join(dir, "auth")
+	cfg.DiagnosticsDir = filepath.Join(dir, "lib", "diagnostics")
+	cfg.IntegrityKeyPath = filepath.Join(dir, "lib", "integrity.key")
+	cfg.StateFile = filepath.Join(dir, "lib", "state.json")
+
+	return cfg
+}
+
+func TestCheck(t *testing.T) {
+	t.Parallel()
+
+	cfg := testConfig(t)
+	require.NoError(t, Check(cfg))
+	require.DirExists(t, cfg.AuthDir)
+	require.DirExists(t, cfg.DiagnosticsDir)
+
+	entries, err := os.ReadDir(cfg.AuthDir)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
+func TestCheckNotWritable(t *testing.T) {
+	t.Parallel()
+
+	if os.Geteuid() == 0 {
+		t.Skip("root is able to write to any directory")
+	}
+
+	cfg := testConfig(t)
+	require.NoError(t, os.Mkdir(cfg.AuthDir, 0o500))
+
+	require.ErrorIs(t, Check(cfg), errNotWritable)
+}
+
+func TestCheckGroup(t *testing.T) {
+	t.Parallel()
+
+	cfg := testConfig(t)
+	require.NoError(t, os.Mkdir(cfg.AuthDir, 0o700))
+
+	info, err := os.Stat(cfg.AuthDir)
+	require.NoError(t, err)
+
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	require.True(t, ok)
+
+	group, err := user.LookupGroupId(strconv.FormatUint(uint64(stat.Gid), 10))
+	require.NoError(t, err)
+
+	cfg.AuthGroup = group.Name
+	require.ErrorIs(t, Check(cfg), errGroup)
+
+	require.NoError(t, os.Chmod(cfg.AuthDir, 0o770))
+	require.NoError(t, Check(cfg))
+
+	cfg.AuthGroup = "not-existing-group"
+	require.ErrorIs(t, Check(cfg), errGroup)
+}
@@ -0,0 +1,252 @@
+// Package prewarm provisions auth files ahead of the first image pull.
+package prewarm
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/app"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/auth"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/k8s"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/logger"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/policy"
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+	"github.com/cri-o/crio-credential-provider/pkg/mirrors"
+	"github.com/cri-o/crio-credential-provider/pkg/reference"
+)
+
+// Target is a combination of namespace and image to provision an auth file for.
+type Target struct {
+	// Namespace is the namespace of the auth file.
+	Namespace string
+
+	// Image is the normalized image name like passed by the kubelet.
+	Image string
+}
+
+// Result summarizes a prewarm run.
+type Result struct {
+	// Written are the paths of the written auth files.
+	Written []string
+
+	// Skipped is the number of targets without any allowed mirror or
+	// matching secret.
+	Skipped int
+}
+
+// Targets returns the targets for the provided images in every namespace as
+// well as the images of all pods scheduled to the node, if not empty. The
+// namespaces are all namespaces of the cluster if empty.
+func Targets(ctx context.Context, client kubernetes.Interface, namespaces, images []string, node string) ([]Target, error) {
+	if len(images) > 0 && len(namespaces) == 0 {
+		list, err := client.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("list namespaces: %w", err)
+		}
+
+		for i := range list.Items {
+			namespaces = append(namespaces, list.Items[i].Name)
+		}
+	}
+
+	targets := []Target{}
+
+	add := func(namespace, image string) error {
+		name, err := imageName(image)
+		if err != nil {
+			return err
+		}
+
+		targets = append(targets, Target{Namespace: namespace, Image: name})
+
+		return nil
+	}
+
+	for _, namespace := range namespaces {
+		for _, image := range images {
+			if err := add(namespace, image); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if node != "" {
+		podNamespaces := []string{metav1.NamespaceAll}
+		if len(namespaces) > 0 {
+			podNamespaces = namespaces
+		}
+
+		for _, namespace := range podNamespaces {
+			pods, err := client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+				FieldSelector: fields.OneTermEqualSelector("spec.nodeName", node).String(),
+			})
+			if err != nil {
+				return nil, fmt.Errorf("list pods of node %s: %w", node, err)
+			}
+
+			for i := range pods.Items {
+				for _, image := range podImages(&pods.Items[i]) {
+					if err := add(pods.Items[i].Namespace, image); err != nil {
+						logger.Warnf("Skipping image %q of pod %s/%s: %v", image, pods.Items[i].Namespace, pods.Items[i].Name, err)
+					}
+				}
+			}
+		}
+	}
+
+	slices.SortFunc(targets, func(a, b Target) int {
+		return cmp.Or(cmp.Compare(a.Namespace, b.Namespace), cmp.Compare(a.Image, b.Image))
+	})
+
+	return slices.Compact(targets), nil
+}
+
+// imageName returns the normalized image name without tag or digest, which
+// is the image the kubelet passes to the credential provider.
+func imageName(image string) (string, error) {
+	ref, err := reference.Parse(image)
+	if err != nil {
+		return "", fmt.Errorf("prewarm image: %w", err)
+	}
+
+	return ref.Name(), nil
+}
+
+func podImages(pod *corev1.Pod) []string {
+	images := []string{}
+
+	for _, containers := range [][]corev1.Container{pod.Spec.InitContainers, pod.Spec.Containers} {
+		for i := range containers {
+			images = append(images, containers[i].Image)
+		}
+	}
+
+	return images
+}
+
+// Run provisions the auth files of all targets by using the secrets of the
+// cluster. Targets of namespaces the credential provider is not enabled for,
+// without any allowed mirror or matching secret get skipped.
+func Run(ctx context.Context, cfg *config.Config, client kubernetes.Interface, targets []Target) (*Result, error) {
+	var (
+		res     = &Result{}
+		errs    []error
+		secrets = map[string]*corev1.SecretList{}
+	)
+
+	for _, target := range targets {
+		path, err := provision(ctx, cfg, client, secrets, target)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s/%s: %w", target.Namespace, target.Image, err))
+
+			continue
+		}
+
+		if path == "" {
+			res.Skipped++
+
+			continue
+		}
+
+		res.Written = append(res.Written, path)
+	}
+
+	return res, errors.Join(errs...)
+}
+
+// namespaceSecrets returns the secrets of the namespace, which get cached
+// across the targets of a run.
+func namespaceSecrets(ctx context.Context, cfg *config.Config, client kubernetes.Interface, cache map[string]*corev1.SecretList, namespace string) (*corev1.SecretList, error) {
+	if secrets, ok := cache[namespace]; ok {
+		return secrets, nil
+	}
+
+	secrets, err := client.CoreV1().Secrets(namespace).List(ctx, metav1.ListOptions{FieldSelector: k8s.FieldSelector(&cfg.Secrets)})
+	if err != nil {
+		return nil, fmt.Errorf("list secrets: %w", err)
+	}
+
+	secrets, _ = k8s.LimitSecrets(k8s.ConvertSecrets(secrets, &cfg.Secrets), cfg.Secrets.MaxSize)
+
+	cache[namespace] = secrets
+
+	return secrets, nil
+}
+
+func provision(ctx context.Context, cfg *config.Config, client kubernetes.Interface, cache map[string]*corev1.SecretList, target Target) (string, error) {
+	if !cfg.Namespaces.Allows(target.Namespace) {
+		return "", nil
+	}
+
+	pol, err := policy.Load(ctx, cfg, client, target.Namespace)
+	if err != nil {
+		return "", err
+	}
+
+	sources, err := mirrors.Resolve(target.Image, cfg)
+	if err != nil {
+		return "", fmt.Errorf("resolve pull sources: %w", err)
+	}
+
+	sources = pol.Sources(sources)
+
+	if len(mirrors.Mirrors(sources)) == 0 {
+		return "", nil
+	}
+
+	stamp, err := app.NewStamp(cfg)
+	if err != nil {
+		return "", err
+	}
+
+	secrets, err := namespaceSecrets(ctx, cfg, client, cache, target.Namespace)
+	if err != nil {
+		return "", err
+	}
+
+	if cfg.Secrets.Shared.Allows(target.Namespace) {
+		shared, err := namespaceSecrets(ctx, cfg, client, cache, cfg.Secrets.Shared.Namespace)
+		if err != nil {
+			return "", fmt.Errorf("shared secrets: %w", err)
+		}
+
+		secrets = k8s.MergeSharedSecrets(secrets, shared)
+	}
+
+	if cfg.Secrets.ClusterPullSecrets {
+		distributed, err := k8s.RetrieveClusterPullSecrets(ctx, client, target.Namespace)
+		if err != nil {
+			return "", err
+		}
+
+		secrets = k8s.MergeSharedSecrets(secrets, distributed)
+	}
+
+	if len(secrets.Items) == 0 {
+		return "", nil
+	}
+
+	stamp.Expires = pol.Expires(time.Now())
+
+	tlsSecrets := app.RetrieveTLSSecrets(ctx, cfg, client)
+
+	path, err := app.Provision(ctx, pol.Config(cfg), stamp, pol.Secrets(secrets), tlsSecrets, target.Namespace, target.Image, sources)
+	if err != nil {
+		if errors.Is(err, auth.ErrNoAuths) {
+			return "", nil
+		}
+
+		return "", fmt.Errorf("provision: %w", err)
+	}
+
+	return path, nil
+}
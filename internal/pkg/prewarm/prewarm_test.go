@@ -0,0 +1,96 @@
+package prewarm
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/cri-o/crio-credential-provider/pkg/auth"
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+)
+
+const mirror = "localhost:5000"
+
+func TestTargets(t *testing.T) {
+	t.Parallel()
+
+	client := fake.NewClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "a"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "b"}},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "b"},
+			Spec: corev1.PodSpec{
+				NodeName:       "node",
+				InitContainers: []corev1.Container{{Image: "quay.io/org/init:v1"}},
+				Containers:     []corev1.Container{{Image: "nginx"}, {Image: "Invalid:Image"}},
+			},
+		},
+	)
+
+	targets, err := Targets(t.Context(), client, nil, []string{"nginx:latest"}, "")
+	require.NoError(t, err)
+	assert.Equal(t, []Target{
+		{Namespace: "a", Image: "docker.io/library/nginx"},
+		{Namespace: "b", Image: "docker.io/library/nginx"},
+	}, targets)
+
+	targets, err = Targets(t.Context(), client, nil, nil, "node")
+	require.NoError(t, err)
+	assert.Equal(t, []Target{
+		{Namespace: "b", Image: "docker.io/library/nginx"},
+		{Namespace: "b", Image: "quay.io/org/init"},
+	}, targets)
+
+	_, err = Targets(t.Context(), client, []string{"a"}, []string{"Invalid:Image"}, "")
+	require.Error(t, err)
+}
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	key := []byte("key")
+
+	cfg := config.Default()
+	cfg.AuthDir = filepath.Join(dir, "auth")
+	cfg.RegistriesConfPath = filepath.Join(dir, "registries.conf")
+	cfg.KubeletAuthFilePath = filepath.Join(dir, "kubelet.json")
+	cfg.IntegrityKeyPath = filepath.Join(dir, "integrity.key")
+	cfg.StateFile = filepath.Join(dir, "state.json")
+	cfg.Sources.PolicyPath = filepath.Join(dir, "policy.json")
+
+	require.NoError(t, os.WriteFile(cfg.RegistriesConfPath, fmt.Appendf(nil,
+		"[[registry]]\nlocation = \"docker.io\"\n[[registry.mirror]]\nlocation = %q", mirror,
+	), 0o600))
+	require.NoError(t, os.WriteFile(cfg.IntegrityKeyPath, key, 0o600))
+
+	encoded := base64.StdEncoding.EncodeToString([]byte("user:pass"))
+	client := fake.NewClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "secret", Namespace: "a"},
+		Type:       corev1.SecretTypeDockerConfigJson,
+		Data: map[string][]byte{
+			corev1.DockerConfigJsonKey: fmt.Appendf(nil, `{"auths":{%q:{"auth":%q}}}`, mirror, encoded),
+		},
+	})
+
+	res, err := Run(t.Context(), cfg, client, []Target{
+		{Namespace: "a", Image: "docker.io/library/nginx"},
+		{Namespace: "b", Image: "docker.io/library/nginx"},
+		{Namespace: "a", Image: "quay.io/org/app"},
+	})
+	require.NoError(t, err)
+	require.Len(t, res.Written, 1)
+	assert.Equal(t, 2, res.Skipped)
+
+	authFile, err := auth.Read(cfg.AuthDir, "a", "docker.io/library/nginx", cfg.AuthFormat, key)
+	require.NoError(t, err)
+	assert.Equal(t, encoded, authFile.Auths[mirror].Auth)
+}
@@ -0,0 +1,109 @@
+// Package probe contains the reachability probe of the mirrors, which helps
+// diagnosing mirrors which are configured but down at credential time.
+package probe
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/cri-o/crio-credential-provider/pkg/mirrors"
+)
+
+// defaultPort is the port of mirror locations without an explicit one.
+const defaultPort = "443"
+
+// Unreachable probes the allowed mirrors of the sources concurrently and
+// returns the errors of the unreachable ones by their location. Mirrors not
+// reachable before ctx is done are unreachable. If useTLS is true, a TLS
+// handshake gets completed with all mirrors which are not insecure, which
+// presents the client certificates of the TLS configurations returned by
+// tlsConfig for mirrors requiring mutual TLS.
+func Unreachable(ctx context.Context, sources []mirrors.Source, useTLS bool, tlsConfig func(location string) *tls.Config) map[string]error {
+	var (
+		mu  sync.Mutex
+		wg  sync.WaitGroup
+		res = map[string]error{}
+	)
+
+	probed := map[string]bool{}
+
+	for i := range sources {
+		source := &sources[i]
+		if !source.Mirror || !source.Allowed || probed[source.Location] {
+			continue
+		}
+
+		probed[source.Location] = true
+
+		wg.Go(func() {
+			if err := probe(ctx, source.Location, useTLS && !source.Insecure, tlsConfig); err != nil {
+				mu.Lock()
+				res[source.Location] = err
+				mu.Unlock()
+			}
+		})
+	}
+
+	wg.Wait()
+
+	return res
+}
+
+// probe connects to the registry host of the location.
+func probe(ctx context.Context, location string, useTLS bool, tlsConfig func(location string) *tls.Config) error {
+	host, _, _ := strings.Cut(location, "/")
+
+	addr := host
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		addr = net.JoinHostPort(strings.Trim(host, "[]"), defaultPort)
+	}
+
+	var (
+		conn net.Conn
+		err  error
+	)
+
+	if useTLS {
+		config := &tls.Config{
+			ServerName: hostname(addr),
+			MinVersion: tls.VersionTLS12,
+			// Only the reachability is of interest, the runtime verifies the
+			// certificates by using the certs.d directories
+			InsecureSkipVerify: true, //nolint:gosec // not used for any data
+		}
+
+		if client := tlsConfig(location); client != nil {
+			config.Certificates = client.Certificates
+		}
+
+		dialer := &tls.Dialer{Config: config}
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	} else {
+		dialer := &net.Dialer{}
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+
+	if err != nil {
+		return fmt.Errorf("probe %s: %w", addr, err)
+	}
+
+	if err := conn.Close(); err != nil {
+		return fmt.Errorf("close probe connection: %w", err)
+	}
+
+	return nil
+}
+
+// hostname returns the host of the address without its port.
+func hostname(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+
+	return host
+}
@@ -0,0 +1,142 @@
+package probe
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cri-o/crio-credential-provider/pkg/mirrors"
+)
+
+// listen returns the address of a TCP listener closing all connections.
+func listen(t *testing.T) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			conn.Close()
+		}
+	}()
+
+	return l.Addr().String()
+}
+
+// closedAddr returns an address without a listener.
+func closedAddr(t *testing.T) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	addr := l.Addr().String()
+	require.NoError(t, l.Close())
+
+	return addr
+}
+
+// noTLSConfig returns no TLS configuration for all locations.
+func noTLSConfig(string) *tls.Config {
+	return nil
+}
+
+func TestUnreachable(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	t.Cleanup(server.Close)
+
+	tlsAddr := strings.TrimPrefix(server.URL, "https://")
+	tcpAddr := listen(t)
+	closed := closedAddr(t)
+
+	for name, tc := range map[string]struct {
+		sources           []mirrors.Source
+		useTLS            bool
+		expectUnreachable []string
+	}{
+		"reachable": {
+			sources: []mirrors.Source{
+				{Location: tcpAddr + "/org", Mirror: true, Allowed: true},
+				{Location: tlsAddr, Mirror: true, Allowed: true},
+			},
+		},
+		"closed port": {
+			sources: []mirrors.Source{
+				{Location: closed, Mirror: true, Allowed: true},
+				{Location: tcpAddr, Mirror: true, Allowed: true},
+			},
+			expectUnreachable: []string{closed},
+		},
+		"TLS handshake": {
+			sources: []mirrors.Source{
+				{Location: tlsAddr, Mirror: true, Allowed: true},
+				{Location: tcpAddr, Mirror: true, Allowed: true},
+			},
+			useTLS:            true,
+			expectUnreachable: []string{tcpAddr},
+		},
+		"TLS not used for insecure mirrors": {
+			sources: []mirrors.Source{
+				{Location: tcpAddr, Mirror: true, Allowed: true, Insecure: true},
+			},
+			useTLS: true,
+		},
+		"primary and not allowed sources are not probed": {
+			sources: []mirrors.Source{
+				{Location: closed, Mirror: true, Reason: "registry is blocked"},
+				{Location: closed},
+			},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			res := Unreachable(ctx, tc.sources, tc.useTLS, noTLSConfig)
+
+			unreachable := []string{}
+			for location, err := range res {
+				require.Error(t, err)
+
+				unreachable = append(unreachable, location)
+			}
+
+			if tc.expectUnreachable == nil {
+				tc.expectUnreachable = []string{}
+			}
+
+			assert.Equal(t, tc.expectUnreachable, unreachable)
+		})
+	}
+}
+
+func TestUnreachableBudget(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	addr := listen(t)
+	res := Unreachable(ctx, []mirrors.Source{{Location: addr, Mirror: true, Allowed: true}}, false, noTLSConfig)
+	require.Contains(t, res, addr)
+	assert.ErrorIs(t, res[addr], context.Canceled)
+}
@@ -0,0 +1,178 @@
+// Package registrytls contains the TLS clients of the registries and their
+// token services requiring mutual TLS.
+package registrytls
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/claims"
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+)
+
+// Clients are the TLS clients of the configured registries. A nil value has
+// no clients and uses the defaults for all registries.
+type Clients struct {
+	clients []client
+}
+
+type client struct {
+	registry   string
+	tlsConfig  *tls.Config
+	httpClient *http.Client
+}
+
+// SecretReferences returns the references of the kubernetes.io/tls secrets
+// of the configurations.
+func SecretReferences(cfgs []config.RegistryTLS) []config.SecretReference {
+	refs := []config.SecretReference{}
+
+	for i := range cfgs {
+		if cfgs[i].Secret != nil {
+			refs = append(refs, *cfgs[i].Secret)
+		}
+	}
+
+	return refs
+}
+
+// New loads the client certificates of the configurations from their files
+// on the node or from the kubernetes.io/tls secrets. Configurations
+// referencing secrets missing in secrets get skipped, which keeps the
+// defaults for their registries. Configurations which cannot be loaded get
+// skipped as well, their errors get returned together with the loaded
+// clients.
+func New(cfgs []config.RegistryTLS, secrets *corev1.SecretList) (*Clients, error) {
+	res := &Clients{}
+
+	var errs []error
+
+	for i := range cfgs {
+		cfg := &cfgs[i]
+
+		cert, ok, err := certificate(cfg, secrets)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("registry %s: %w", cfg.Registry, err))
+
+			continue
+		}
+
+		if !ok {
+			continue
+		}
+
+		tlsConfig, err := newTLSConfig(cfg.CAFile, cert)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("registry %s: %w", cfg.Registry, err))
+
+			continue
+		}
+
+		transport := http.DefaultTransport.(*http.Transport).Clone() //nolint:forcetypeassert // always a transport
+		transport.TLSClientConfig = tlsConfig
+
+		res.clients = append(res.clients, client{
+			registry:   cfg.Registry,
+			tlsConfig:  tlsConfig,
+			httpClient: &http.Client{Transport: transport},
+		})
+	}
+
+	return res, errors.Join(errs...)
+}
+
+// TLSConfig returns the TLS configuration of the first configuration
+// matching the registry location, or nil if none matches.
+func (c *Clients) TLSConfig(location string) *tls.Config {
+	if client := c.lookup(location); client != nil {
+		return client.tlsConfig
+	}
+
+	return nil
+}
+
+// HTTPClient returns the HTTP client of the first configuration matching the
+// registry location, or http.DefaultClient if none matches.
+func (c *Clients) HTTPClient(location string) *http.Client {
+	if client := c.lookup(location); client != nil {
+		return client.httpClient
+	}
+
+	return http.DefaultClient
+}
+
+func (c *Clients) lookup(location string) *client {
+	if c == nil {
+		return nil
+	}
+
+	for i := range c.clients {
+		if claims.Match(c.clients[i].registry, location) {
+			return &c.clients[i]
+		}
+	}
+
+	return nil
+}
+
+// certificate returns the client certificate of the configuration. It
+// returns false if the referenced secret is not part of secrets.
+func certificate(cfg *config.RegistryTLS, secrets *corev1.SecretList) (tls.Certificate, bool, error) {
+	if cfg.Secret == nil {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return tls.Certificate{}, false, fmt.Errorf("load client certificate: %w", err)
+		}
+
+		return cert, true, nil
+	}
+
+	if secrets == nil {
+		return tls.Certificate{}, false, nil
+	}
+
+	for i := range secrets.Items {
+		secret := &secrets.Items[i]
+		if secret.Namespace != cfg.Secret.Namespace || secret.Name != cfg.Secret.Name {
+			continue
+		}
+
+		cert, err := tls.X509KeyPair(secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey])
+		if err != nil {
+			return tls.Certificate{}, false, fmt.Errorf("load client certificate of secret %s/%s: %w", secret.Namespace, secret.Name, err)
+		}
+
+		return cert, true, nil
+	}
+
+	return tls.Certificate{}, false, nil
+}
+
+func newTLSConfig(caFile string, cert tls.Certificate) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}
+
+	if caFile != "" {
+		raw, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("read CA file: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(raw) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", caFile)
+		}
+
+		tlsConfig.RootCAs = pool
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,167 @@
+package registrytls
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+)
+
+// clientCert returns a self-signed client certificate and its private key as
+// PEM.
+func clientCert(t *testing.T) (certPEM, keyPEM []byte, cert *x509.Certificate) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "node-1"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	cert, err = x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	rawKey, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: rawKey}), cert
+}
+
+func TestClients(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	certPEM, keyPEM, cert := clientCert(t)
+
+	certFile := filepath.Join(dir, "client.crt")
+	keyFile := filepath.Join(dir, "client.key")
+	require.NoError(t, os.WriteFile(certFile, certPEM, 0o600))
+	require.NoError(t, os.WriteFile(keyFile, keyPEM, 0o600))
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: pool, MinVersion: tls.VersionTLS12}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	caFile := filepath.Join(dir, "ca.crt")
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0o600))
+
+	location := strings.TrimPrefix(server.URL, "https://")
+
+	secrets := &corev1.SecretList{Items: []corev1.Secret{{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "registry-tls"},
+		Type:       corev1.SecretTypeTLS,
+		Data:       map[string][]byte{corev1.TLSCertKey: certPEM, corev1.TLSPrivateKeyKey: keyPEM},
+	}}}
+
+	for name, tc := range map[string]struct {
+		cfg         config.RegistryTLS
+		secrets     *corev1.SecretList
+		expectedErr string
+		noClient    bool
+	}{
+		"node files": {
+			cfg: config.RegistryTLS{Registry: location, CAFile: caFile, CertFile: certFile, KeyFile: keyFile},
+		},
+		"secret": {
+			cfg:     config.RegistryTLS{Registry: location, CAFile: caFile, Secret: &config.SecretReference{Namespace: "kube-system", Name: "registry-tls"}},
+			secrets: secrets,
+		},
+		"missing secret": {
+			cfg:      config.RegistryTLS{Registry: location, CAFile: caFile, Secret: &config.SecretReference{Namespace: "kube-system", Name: "missing"}},
+			secrets:  secrets,
+			noClient: true,
+		},
+		"missing node files": {
+			cfg:         config.RegistryTLS{Registry: location, CertFile: filepath.Join(dir, "missing.crt"), KeyFile: keyFile},
+			expectedErr: "load client certificate",
+			noClient:    true,
+		},
+		"invalid CA file": {
+			cfg:         config.RegistryTLS{Registry: location, CAFile: keyFile, CertFile: certFile, KeyFile: keyFile},
+			expectedErr: "no certificates found in CA file",
+			noClient:    true,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			clients, err := New([]config.RegistryTLS{tc.cfg}, tc.secrets)
+			if tc.expectedErr != "" {
+				require.ErrorContains(t, err, tc.expectedErr)
+			} else {
+				require.NoError(t, err)
+			}
+
+			assert.Same(t, http.DefaultClient, clients.HTTPClient("quay.io"))
+			assert.Nil(t, clients.TLSConfig("quay.io"))
+
+			if tc.noClient {
+				assert.Same(t, http.DefaultClient, clients.HTTPClient(location))
+
+				return
+			}
+
+			require.NotNil(t, clients.TLSConfig(location))
+
+			req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, server.URL, http.NoBody)
+			require.NoError(t, err)
+
+			resp, err := clients.HTTPClient(location).Do(req)
+			require.NoError(t, err)
+			require.NoError(t, resp.Body.Close())
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+		})
+	}
+}
+
+func TestNilClients(t *testing.T) {
+	t.Parallel()
+
+	var clients *Clients
+
+	assert.Same(t, http.DefaultClient, clients.HTTPClient("quay.io"))
+	assert.Nil(t, clients.TLSConfig("quay.io"))
+}
+
+func TestSecretReferences(t *testing.T) {
+	t.Parallel()
+
+	refs := SecretReferences([]config.RegistryTLS{
+		{Registry: "quay.io", CertFile: "/etc/crio/tls.crt", KeyFile: "/etc/crio/tls.key"},
+		{Registry: "registry.example.com", Secret: &config.SecretReference{Namespace: "kube-system", Name: "registry-tls"}},
+	})
+
+	assert.Equal(t, []config.SecretReference{{Namespace: "kube-system", Name: "registry-tls"}}, refs)
+}
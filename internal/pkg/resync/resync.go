@@ -0,0 +1,266 @@
+// Package resync contains the reconstruction of the state from the auth
+// directory, which recovers nodes after losing their state file.
+package resync
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/auth"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/logger"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/retention"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/state"
+	cpAuth "github.com/cri-o/crio-credential-provider/pkg/auth"
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+	"github.com/cri-o/crio-credential-provider/pkg/reference"
+)
+
+// Result contains the outcome of a resync.
+type Result struct {
+	// Recorded are the paths of the auth files added to the state.
+	Recorded []string
+
+	// Unresolved are the paths of the recorded auth files whose namespace or
+	// image is unknown, which get evicted by the retention but not rotated.
+	Unresolved []string
+
+	// Completed are the paths of the auth files whose sidecar got completed
+	// with the content hash and write time.
+	Completed []string
+
+	// Unverifiable are the paths of the auth files without a sidecar matching
+	// their contents, which are kept but not recorded.
+	Unverifiable []string
+
+	// Orphaned are the paths of the removed sidecar files and state entries
+	// without an auth file.
+	Orphaned []string
+}
+
+// Run reconstructs the state entries of the auth files within the auth
+// directory, which are verified against their sidecars by using the integrity
+// key. The images and namespaces of the auth files get resolved from the
+// existing state entries together with the provided images and namespaces,
+// because the auth file names only contain their hashes. Auth files of other
+// owners within a shared auth directory are skipped. Nothing gets changed if
+// dryRun is true.
+func Run(cfg *config.Config, images, namespaces []string, dryRun bool) (*Result, error) {
+	integrityKey, err := cpAuth.ReadKey(cfg.IntegrityKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get integrity key: %w", err)
+	}
+
+	files, err := retention.List(cfg.AuthDir)
+	if err != nil {
+		return nil, fmt.Errorf("list auth files: %w", err)
+	}
+
+	lock := auth.Lock{}
+	if cfg.Coordination.Enabled() {
+		lock = auth.Lock{Mode: cfg.Coordination.Lock, LeaseTTL: cfg.Coordination.LeaseTTL.Duration}
+	}
+
+	res := &Result{}
+	existing := map[string]bool{}
+	verified := map[string]*cpAuth.Sidecar{}
+
+	// The auth directory lock must not be taken while holding the state lock
+	for _, file := range files {
+		existing[file.Path] = true
+
+		if cfg.Coordination.Enabled() && auth.ForeignOwner(file.Path, cfg.Coordination.Owner) {
+			continue
+		}
+
+		sidecar, incomplete, err := auth.VerifyFile(file.Path, integrityKey, lock, !dryRun)
+		if err != nil {
+			logger.Warnf("Unable to verify auth file %s: %v", file.Path, err)
+
+			res.Unverifiable = append(res.Unverifiable, file.Path)
+
+			continue
+		}
+
+		if incomplete {
+			res.Completed = append(res.Completed, file.Path)
+		}
+
+		if sidecar.Written.IsZero() {
+			sidecar.Written = file.ModTime.UTC()
+		}
+
+		verified[file.Path] = sidecar
+	}
+
+	orphaned, err := orphanedSidecars(cfg.AuthDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var errs []error
+
+	for _, path := range orphaned {
+		if !dryRun {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				errs = append(errs, fmt.Errorf("remove orphaned sidecar: %w", err))
+
+				continue
+			}
+		}
+
+		res.Orphaned = append(res.Orphaned, path)
+	}
+
+	update := func(s *state.State) error {
+		for _, path := range slices.Sorted(maps.Keys(s.Files)) {
+			if !existing[path] {
+				delete(s.Files, path)
+
+				res.Orphaned = append(res.Orphaned, path)
+			}
+		}
+
+		resolver := newResolver(cfg, integrityKey, s, images, namespaces)
+
+		for _, file := range files {
+			sidecar, ok := verified[file.Path]
+			if !ok || s.Files[file.Path] != nil {
+				continue
+			}
+
+			namespace, image := resolver.resolve(file.Path, file.Namespace)
+			if namespace == "" || image == "" {
+				res.Unresolved = append(res.Unresolved, file.Path)
+			}
+
+			s.Files[file.Path] = &state.File{
+				Namespace: namespace,
+				Image:     image,
+				Updated:   sidecar.Written,
+				Owner:     sidecar.Owner,
+				Fence:     sidecar.Fence,
+				Expires:   sidecar.Expires,
+			}
+
+			res.Recorded = append(res.Recorded, file.Path)
+		}
+
+		return nil
+	}
+
+	if dryRun {
+		s, err := state.Load(cfg.StateFile)
+		if err != nil {
+			return res, errors.Join(append(errs, fmt.Errorf("load state: %w", err))...)
+		}
+
+		_ = update(s)
+
+		return res, errors.Join(errs...)
+	}
+
+	if err := state.Update(cfg.StateFile, update); err != nil {
+		errs = append(errs, fmt.Errorf("update state: %w", err))
+	}
+
+	return res, errors.Join(errs...)
+}
+
+// orphanedSidecars returns the paths of all sidecar files within dir whose
+// auth file does not exist.
+func orphanedSidecars(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("read auth dir: %w", err)
+	}
+
+	res := []string{}
+
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))
+		if cpAuth.SidecarPath(name) != entry.Name() {
+			continue
+		}
+
+		if _, _, err := cpAuth.ParseFilePath(name); err != nil {
+			continue
+		}
+
+		if _, err := os.Lstat(filepath.Join(dir, name)); os.IsNotExist(err) {
+			res = append(res, filepath.Join(dir, entry.Name()))
+		}
+	}
+
+	return res, nil
+}
+
+// resolver resolves the namespaces and images of the auth file paths.
+type resolver struct {
+	cfg          *config.Config
+	integrityKey []byte
+	images       []string
+	namespaces   []string
+	namings      []cpAuth.Naming
+}
+
+func newResolver(cfg *config.Config, integrityKey []byte, s *state.State, images, namespaces []string) *resolver {
+	r := &resolver{
+		cfg:          cfg,
+		integrityKey: integrityKey,
+		namespaces:   slices.Clone(namespaces),
+		namings:      []cpAuth.Naming{cfg.Naming},
+	}
+
+	// Auth files written before switching the naming use the published one
+	if naming, err := cpAuth.ReadNaming(cfg.AuthDir); err == nil && *naming != cfg.Naming {
+		r.namings = append(r.namings, *naming)
+	}
+
+	for _, image := range images {
+		r.images = append(r.images, reference.Key(image))
+	}
+
+	for _, file := range s.Files {
+		r.images = append(r.images, file.Image)
+		r.namespaces = append(r.namespaces, file.Namespace)
+	}
+
+	slices.Sort(r.images)
+	slices.Sort(r.namespaces)
+	r.images = slices.Compact(r.images)
+	r.namespaces = slices.Compact(r.namespaces)
+
+	return r
+}
+
+// resolve returns the namespace and image of the auth file at path with the
+// namespace component, which are empty if unknown.
+func (r *resolver) resolve(path, component string) (string, string) {
+	namespace := component
+	if r.cfg.HashNamespaces {
+		namespace, _ = cpAuth.LookupNamespace(r.integrityKey, component, r.namespaces)
+	}
+
+	for _, image := range r.images {
+		if image == "" {
+			continue
+		}
+
+		for _, naming := range r.namings {
+			if candidate, err := naming.FilePath(r.cfg.AuthDir, component, image); err == nil && candidate == path {
+				return namespace, image
+			}
+		}
+	}
+
+	return namespace, ""
+}
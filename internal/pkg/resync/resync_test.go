@@ -0,0 +1,111 @@
+package resync
+
+import (
+	"encoding/json"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/auth"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/state"
+	cpAuth "github.com/cri-o/crio-credential-provider/pkg/auth"
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+	"github.com/cri-o/crio-credential-provider/pkg/docker"
+)
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+
+	for name, tc := range map[string]struct {
+		dryRun bool
+	}{
+		"resync":  {},
+		"dry run": {dryRun: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+
+			cfg := config.Default()
+			cfg.AuthDir = filepath.Join(dir, "auth")
+			cfg.IntegrityKeyPath = filepath.Join(dir, "integrity.key")
+			cfg.StateFile = filepath.Join(dir, "state.json")
+
+			key, err := auth.LoadOrCreateIntegrityKey(cfg.IntegrityKeyPath)
+			require.NoError(t, err)
+
+			contents := docker.ConfigJSON{Auths: map[string]docker.AuthConfig{"quay.io": {Auth: "dXNlcjpwYXNz"}}}
+			write := func(image string) string {
+				path, _, err := auth.WriteAuthFile(cfg.AuthDir, "ns", image, contents, "", key, auth.Stamp{})
+				require.NoError(t, err)
+
+				return path
+			}
+
+			known := write("quay.io/org/app")
+			unknown := write("quay.io/org/unknown")
+			tampered := write("quay.io/org/tampered")
+
+			// Sidecars of earlier versions only contain the HMAC
+			sidecar, err := cpAuth.ReadSidecar(unknown)
+			require.NoError(t, err)
+
+			legacy, err := json.Marshal(cpAuth.Sidecar{HMAC: sidecar.HMAC})
+			require.NoError(t, err)
+			require.NoError(t, os.WriteFile(cpAuth.SidecarPath(unknown), legacy, 0o600))
+
+			require.NoError(t, os.WriteFile(tampered, []byte(`{"auths":{}}`), 0o600))
+
+			orphan := cpAuth.SidecarPath(filepath.Join(cfg.AuthDir, "ns-"+strings.Repeat("a", 64)+".json"))
+			require.NoError(t, os.WriteFile(orphan, legacy, 0o600))
+
+			gone := filepath.Join(cfg.AuthDir, "ns-"+strings.Repeat("b", 64)+".json")
+			require.NoError(t, state.Update(cfg.StateFile, func(s *state.State) error {
+				s.Files[gone] = &state.File{Namespace: "ns", Image: "quay.io/org/gone"}
+
+				return nil
+			}))
+
+			res, err := Run(cfg, []string{"quay.io/org/app"}, nil, tc.dryRun)
+			require.NoError(t, err)
+
+			assert.ElementsMatch(t, []string{known, unknown}, res.Recorded)
+			assert.Equal(t, []string{unknown}, res.Unresolved)
+			assert.Equal(t, []string{unknown}, res.Completed)
+			assert.Equal(t, []string{tampered}, res.Unverifiable)
+			assert.Equal(t, []string{orphan, gone}, res.Orphaned)
+			assert.FileExists(t, tampered)
+
+			s, err := state.Load(cfg.StateFile)
+			require.NoError(t, err)
+
+			if tc.dryRun {
+				assert.FileExists(t, orphan)
+				assert.Equal(t, []string{gone}, slices.Collect(maps.Keys(s.Files)))
+
+				return
+			}
+
+			assert.NoFileExists(t, orphan)
+			assert.ElementsMatch(t, []string{known, unknown}, slices.Collect(maps.Keys(s.Files)))
+			assert.Equal(t, "quay.io/org/app", s.Files[known].Image)
+			assert.Equal(t, "ns", s.Files[known].Namespace)
+			assert.Empty(t, s.Files[unknown].Image)
+
+			sidecar, err = cpAuth.ReadSidecar(unknown)
+			require.NoError(t, err)
+			assert.NotEmpty(t, sidecar.SHA256)
+			assert.False(t, sidecar.Written.IsZero())
+
+			_, err = cpAuth.Read(cfg.AuthDir, "ns", "quay.io/org/unknown", cfg.AuthFormat, key)
+			require.NoError(t, err)
+		})
+	}
+}
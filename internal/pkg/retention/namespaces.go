@@ -0,0 +1,89 @@
+package retention
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/auth"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/logger"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/state"
+	cpAuth "github.com/cri-o/crio-credential-provider/pkg/auth"
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+)
+
+// RemoveDeletedNamespaces removes the auth files of all namespaces of the
+// auth directory which are not part of the existing namespaces, as well as
+// their state entries. The integrity key is only required for hashed
+// namespaces. It returns the paths of the removed files.
+func RemoveDeletedNamespaces(cfg *config.Config, integrityKey []byte, existing []string) ([]string, error) {
+	components, err := auth.Namespaces(cfg.AuthDir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list auth file namespaces: %w", err)
+	}
+
+	var (
+		removed []string
+		errs    []error
+	)
+
+	for _, component := range components {
+		namespace := component
+
+		if cfg.HashNamespaces {
+			var found bool
+			if namespace, found = cpAuth.LookupNamespace(integrityKey, component, existing); found {
+				continue
+			}
+		} else if slices.Contains(existing, namespace) {
+			continue
+		}
+
+		logger.Infof("Namespace %s does not exist, removing its auth files", component)
+
+		paths, err := RemoveNamespace(cfg, namespace, component)
+		removed = append(removed, paths...)
+
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return removed, errors.Join(errs...)
+}
+
+// RemoveNamespace removes all auth files of the namespace component as well
+// as their outputs and state entries. The namespace is empty if the
+// component is a hash of an unknown namespace. Auth files of other owners
+// within a shared auth directory are kept. It returns the paths of the
+// removed files.
+func RemoveNamespace(cfg *config.Config, namespace, component string) ([]string, error) {
+	removed, err := auth.RemoveNamespace(cfg.AuthDir, component, cfg.Coordination.Owner)
+	for _, path := range removed {
+		logger.Infof("Removed auth file %s", path)
+
+		if err := auth.RemoveOutputs(cfg, path); err != nil {
+			logger.Warnf("Unable to remove auth file outputs: %v", err)
+		}
+	}
+
+	if err != nil {
+		return removed, fmt.Errorf("remove auth files: %w", err)
+	}
+
+	if err := state.Update(cfg.StateFile, func(s *state.State) error {
+		for _, path := range removed {
+			delete(s.Files, path)
+		}
+
+		if namespace != "" {
+			s.RemoveNamespace(namespace)
+		}
+
+		return nil
+	}); err != nil {
+		return removed, fmt.Errorf("update state: %w", err)
+	}
+
+	return removed, nil
+}
@@ -0,0 +1,73 @@
+package retention
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/state"
+	"github.com/cri-o/crio-credential-provider/pkg/auth"
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+)
+
+func TestRemoveDeletedNamespaces(t *testing.T) {
+	t.Parallel()
+
+	key := []byte("0123456789abcdef0123456789abcdef")
+
+	for name, hashed := range map[string]bool{
+		"plain namespaces":  false,
+		"hashed namespaces": true,
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+
+			cfg := config.Default()
+			cfg.AuthDir = filepath.Join(dir, "auth")
+			cfg.StateFile = filepath.Join(dir, "state.json")
+			cfg.HashNamespaces = hashed
+
+			require.NoError(t, os.MkdirAll(cfg.AuthDir, 0o700))
+
+			paths := map[string]string{}
+
+			for _, namespace := range []string{"kept", "deleted"} {
+				component := namespace
+				if hashed {
+					component = auth.NamespaceHash(key, namespace)
+				}
+
+				path, err := auth.FilePath(cfg.AuthDir, component, "image")
+				require.NoError(t, err)
+				require.NoError(t, os.WriteFile(path, []byte("{}"), 0o600))
+
+				paths[namespace] = path
+			}
+
+			require.NoError(t, state.Update(cfg.StateFile, func(s *state.State) error {
+				for namespace, path := range paths {
+					s.Files[path] = &state.File{Namespace: namespace}
+				}
+
+				return nil
+			}))
+
+			removed, err := RemoveDeletedNamespaces(cfg, key, []string{"kept", "other"})
+			require.NoError(t, err)
+			assert.Equal(t, []string{paths["deleted"]}, removed)
+
+			assert.FileExists(t, paths["kept"])
+			assert.NoFileExists(t, paths["deleted"])
+
+			s, err := state.Load(cfg.StateFile)
+			require.NoError(t, err)
+			assert.Contains(t, s.Files, paths["kept"])
+			assert.NotContains(t, s.Files, paths["deleted"])
+		})
+	}
+}
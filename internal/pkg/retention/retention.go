@@ -0,0 +1,215 @@
+// Package retention contains the enforcement of the auth directory retention limits.
+package retention
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/auth"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/claims"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/logger"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/state"
+	cpAuth "github.com/cri-o/crio-credential-provider/pkg/auth"
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+)
+
+// File is an auth file considered by the retention.
+type File struct {
+	// Path is the path of the auth file.
+	Path string
+
+	// Namespace is the namespace the auth file belongs to.
+	Namespace string
+
+	// ModTime is the last time the auth file got written.
+	ModTime time.Time
+}
+
+// Sweep evicts all auth files exceeding the configured retention limits as
+// well as the expired ones and removes them from the state. It returns the
+// paths of the evicted files. Auth files of other owners within a shared auth
+// directory are neither evicted nor counted.
+func Sweep(cfg *config.Config, now time.Time) ([]string, error) {
+	selected, err := Expired(cfg.StateFile, now)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Retention.Enabled() {
+		files, err := List(cfg.AuthDir)
+		if err != nil {
+			return nil, err
+		}
+
+		if cfg.Coordination.Enabled() {
+			files = slices.DeleteFunc(files, func(file File) bool {
+				return auth.ForeignOwner(file.Path, cfg.Coordination.Owner)
+			})
+		}
+
+		for _, path := range Select(files, &cfg.Retention, now) {
+			if !slices.Contains(selected, path) {
+				selected = append(selected, path)
+			}
+		}
+	}
+
+	var (
+		evicted []string
+		errs    []error
+	)
+
+	for _, path := range selected {
+		if err := auth.RemoveFile(path); err != nil {
+			errs = append(errs, err)
+
+			continue
+		}
+
+		if err := auth.RemoveOutputs(cfg, path); err != nil {
+			errs = append(errs, err)
+		}
+
+		logger.Infof("Evicted auth file %s", path)
+
+		evicted = append(evicted, path)
+	}
+
+	if len(evicted) > 0 {
+		if err := state.Update(cfg.StateFile, func(s *state.State) error {
+			for _, path := range evicted {
+				delete(s.Files, path)
+			}
+
+			s.Evictions += uint64(len(evicted))
+
+			return nil
+		}); err != nil {
+			errs = append(errs, fmt.Errorf("update state: %w", err))
+		}
+	}
+
+	return evicted, errors.Join(errs...)
+}
+
+// Expired returns the paths of all auth files recorded in the state file
+// whose expiry, like the TTL of a registry credential policy, has passed.
+func Expired(stateFile string, now time.Time) ([]string, error) {
+	s, err := state.Load(stateFile)
+	if err != nil {
+		return nil, fmt.Errorf("load state: %w", err)
+	}
+
+	var expired []string
+
+	for path, file := range s.Files {
+		if !file.Expires.IsZero() && now.After(file.Expires) {
+			expired = append(expired, path)
+		}
+	}
+
+	slices.Sort(expired)
+
+	return expired, nil
+}
+
+// Expires returns the time after which an auth file written now for the image
+// references of its sources expires. It is the earliest of the provided
+// expiry, like the one of a registry credential policy, and the TTLs of all
+// registry patterns matching any of the references. The zero time never
+// expires.
+func Expires(ttls []config.RegistryTTL, references []string, expires, now time.Time) time.Time {
+	for _, ttl := range ttls {
+		if !slices.ContainsFunc(references, func(ref string) bool {
+			return claims.Match(ttl.Registry, ref)
+		}) {
+			continue
+		}
+
+		if candidate := now.Add(ttl.TTL.Duration); expires.IsZero() || candidate.Before(expires) {
+			expires = candidate
+		}
+	}
+
+	return expires
+}
+
+// List returns all auth files within dir. A non existing directory results in
+// an empty list.
+func List(dir string) ([]File, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("read auth dir: %w", err)
+	}
+
+	files := make([]File, 0, len(entries))
+
+	for _, entry := range entries {
+		// Versioned auth files are symlinks to their current version
+		if !entry.Type().IsRegular() && entry.Type()&fs.ModeSymlink == 0 {
+			continue
+		}
+
+		namespace, _, err := cpAuth.ParseFilePath(entry.Name())
+		if err != nil {
+			continue
+		}
+
+		info, err := os.Stat(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			if os.IsNotExist(err) {
+				// File got removed in the meantime
+				continue
+			}
+
+			return nil, fmt.Errorf("get file info: %w", err)
+		}
+
+		files = append(files, File{
+			Path:      filepath.Join(dir, entry.Name()),
+			Namespace: namespace,
+			ModTime:   info.ModTime(),
+		})
+	}
+
+	return files, nil
+}
+
+// Select returns the paths of all files exceeding the retention limits. The
+// most recently written files are kept.
+func Select(files []File, retention *config.Retention, now time.Time) []string {
+	sorted := slices.SortedFunc(slices.Values(files), func(a, b File) int {
+		return cmp.Or(b.ModTime.Compare(a.ModTime), cmp.Compare(a.Path, b.Path))
+	})
+
+	var (
+		evict      []string
+		kept       int
+		namespaces = map[string]int{}
+	)
+
+	for _, file := range sorted {
+		switch {
+		case retention.MaxAge.Duration > 0 && now.Sub(file.ModTime) > retention.MaxAge.Duration,
+			retention.MaxPerNamespace > 0 && namespaces[file.Namespace] >= retention.MaxPerNamespace,
+			retention.MaxTotalFiles > 0 && kept >= retention.MaxTotalFiles:
+			evict = append(evict, file.Path)
+
+		default:
+			kept++
+			namespaces[file.Namespace]++
+		}
+	}
+
+	return evict
+}
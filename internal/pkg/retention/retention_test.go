@@ -0,0 +1,202 @@
+package retention
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/state"
+	"github.com/cri-o/crio-credential-provider/pkg/auth"
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+)
+
+func TestSelect(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	files := []File{
+		{Path: "a1", Namespace: "a", ModTime: now.Add(-time.Minute)},
+		{Path: "a2", Namespace: "a", ModTime: now.Add(-2 * time.Minute)},
+		{Path: "a3", Namespace: "a", ModTime: now.Add(-3 * time.Hour)},
+		{Path: "b1", Namespace: "b", ModTime: now.Add(-90 * time.Second)},
+		{Path: "b2", Namespace: "b", ModTime: now.Add(-time.Hour)},
+	}
+
+	for name, tc := range map[string]struct {
+		retention config.Retention
+		expected  []string
+	}{
+		"no limits": {},
+		"max age": {
+			retention: config.Retention{MaxAge: metav1.Duration{Duration: 2 * time.Hour}},
+			expected:  []string{"a3"},
+		},
+		"max per namespace": {
+			retention: config.Retention{MaxPerNamespace: 1},
+			expected:  []string{"a2", "b2", "a3"},
+		},
+		"max total files": {
+			retention: config.Retention{MaxTotalFiles: 2},
+			expected:  []string{"a2", "b2", "a3"},
+		},
+		"all limits combined": {
+			retention: config.Retention{
+				MaxAge:          metav1.Duration{Duration: 2 * time.Hour},
+				MaxPerNamespace: 2,
+				MaxTotalFiles:   3,
+			},
+			expected: []string{"b2", "a3"},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tc.expected, Select(files, &tc.retention, now))
+		})
+	}
+}
+
+func TestSweep(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	cfg := config.Default()
+	cfg.AuthDir = filepath.Join(dir, "auth")
+	cfg.StateFile = filepath.Join(dir, "state.json")
+	cfg.Retention.MaxPerNamespace = 1
+
+	require.NoError(t, os.MkdirAll(cfg.AuthDir, 0o700))
+
+	now := time.Now()
+	paths := []string{}
+
+	for i, image := range []string{"new", "old"} {
+		path, err := auth.FilePath(cfg.AuthDir, "ns", image)
+		require.NoError(t, err)
+
+		require.NoError(t, os.WriteFile(path, []byte("{}"), 0o600))
+		require.NoError(t, os.WriteFile(auth.SidecarPath(path), []byte("{}"), 0o600))
+
+		modTime := now.Add(-time.Duration(i) * time.Hour)
+		require.NoError(t, os.Chtimes(path, modTime, modTime))
+
+		paths = append(paths, path)
+	}
+
+	require.NoError(t, state.Update(cfg.StateFile, func(s *state.State) error {
+		for _, path := range paths {
+			s.Files[path] = &state.File{Namespace: "ns"}
+		}
+
+		return nil
+	}))
+
+	evicted, err := Sweep(cfg, now)
+	require.NoError(t, err)
+	assert.Equal(t, []string{paths[1]}, evicted)
+
+	assert.FileExists(t, paths[0])
+	assert.NoFileExists(t, paths[1])
+	assert.NoFileExists(t, auth.SidecarPath(paths[1]))
+
+	s, err := state.Load(cfg.StateFile)
+	require.NoError(t, err)
+	assert.Contains(t, s.Files, paths[0])
+	assert.NotContains(t, s.Files, paths[1])
+	assert.Equal(t, uint64(1), s.Evictions)
+}
+
+func TestSweepExpired(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	cfg := config.Default()
+	cfg.AuthDir = filepath.Join(dir, "auth")
+	cfg.StateFile = filepath.Join(dir, "state.json")
+
+	require.NoError(t, os.MkdirAll(cfg.AuthDir, 0o700))
+
+	now := time.Now()
+	paths := []string{}
+
+	for _, image := range []string{"expired", "valid", "unlimited"} {
+		path, err := auth.FilePath(cfg.AuthDir, "ns", image)
+		require.NoError(t, err)
+
+		require.NoError(t, os.WriteFile(path, []byte("{}"), 0o600))
+
+		paths = append(paths, path)
+	}
+
+	require.NoError(t, state.Update(cfg.StateFile, func(s *state.State) error {
+		s.Files[paths[0]] = &state.File{Namespace: "ns", Expires: now.Add(-time.Minute)}
+		s.Files[paths[1]] = &state.File{Namespace: "ns", Expires: now.Add(time.Minute)}
+		s.Files[paths[2]] = &state.File{Namespace: "ns"}
+
+		return nil
+	}))
+
+	evicted, err := Sweep(cfg, now)
+	require.NoError(t, err)
+	assert.Equal(t, []string{paths[0]}, evicted)
+
+	assert.NoFileExists(t, paths[0])
+	assert.FileExists(t, paths[1])
+	assert.FileExists(t, paths[2])
+
+	s, err := state.Load(cfg.StateFile)
+	require.NoError(t, err)
+	assert.NotContains(t, s.Files, paths[0])
+	assert.Len(t, s.Files, 2)
+}
+
+func TestExpires(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	ttls := []config.RegistryTTL{
+		{Registry: "*.azurecr.io", TTL: metav1.Duration{Duration: time.Hour}},
+		{Registry: "mirror.example.com/org", TTL: metav1.Duration{Duration: 10 * time.Minute}},
+	}
+
+	for name, tc := range map[string]struct {
+		references []string
+		expires    time.Time
+		expected   time.Time
+	}{
+		"no matching registry": {
+			references: []string{"quay.io/org/app", "mirror.example.com/other/app"},
+		},
+		"matching registry": {
+			references: []string{"quay.io/org/app", "mirror.azurecr.io/org/app"},
+			expected:   now.Add(time.Hour),
+		},
+		"shortest TTL of all matching registries": {
+			references: []string{"mirror.example.com/org/app:latest", "mirror.azurecr.io/org/app"},
+			expected:   now.Add(10 * time.Minute),
+		},
+		"earlier expiry kept": {
+			references: []string{"mirror.azurecr.io/org/app"},
+			expires:    now.Add(time.Minute),
+			expected:   now.Add(time.Minute),
+		},
+		"later expiry shortened": {
+			references: []string{"mirror.azurecr.io/org/app"},
+			expires:    now.Add(2 * time.Hour),
+			expected:   now.Add(time.Hour),
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tc.expected, Expires(ttls, tc.references, tc.expires, now))
+		})
+	}
+}
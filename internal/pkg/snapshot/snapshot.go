@@ -0,0 +1,316 @@
+// Package snapshot contains the export and import of the resolved auth files
+// of a namespace as encrypted bundle, which allows pre-provisioning nodes
+// without access to the Kubernetes API, for example in air-gapped
+// environments.
+package snapshot
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/app"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/auth"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/logger"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/state"
+	cpAuth "github.com/cri-o/crio-credential-provider/pkg/auth"
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+)
+
+// bundleVersion is the version of the bundle format.
+const bundleVersion = 1
+
+var (
+	// ErrExpired is returned on import if the bundle is expired.
+	ErrExpired = errors.New("bundle is expired")
+
+	// ErrIntegrity is returned on import if the bundle cannot be decrypted
+	// or its contents do not match their checksums.
+	ErrIntegrity = errors.New("bundle integrity check failed")
+
+	errUnsupportedVersion = errors.New("unsupported bundle version")
+	errFormatMismatch     = errors.New("bundle auth format does not match the configured one")
+	errNoFiles            = errors.New("no auth files found for namespace")
+	errEmptyKey           = errors.New("bundle key is empty")
+)
+
+// bundle is the encrypted envelope written to disk.
+type bundle struct {
+	// Version is the version of the bundle format.
+	Version int `json:"version"`
+
+	// Nonce is the AES-GCM nonce used to encrypt the manifest.
+	Nonce []byte `json:"nonce"`
+
+	// Ciphertext is the encrypted manifest.
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// manifest is the plaintext content of a bundle.
+type manifest struct {
+	// Namespace is the namespace of the exported auth files.
+	Namespace string `json:"namespace"`
+
+	// Format is the auth file format of the exporting node.
+	Format string `json:"format"`
+
+	// Created is the time of the export.
+	Created time.Time `json:"created"`
+
+	// Expires is the time after which the bundle cannot be imported anymore.
+	Expires time.Time `json:"expires"`
+
+	// Files are the exported auth files.
+	Files []file `json:"files"`
+}
+
+// file is a single exported auth file.
+type file struct {
+	// Image is the image name the auth file has been written for.
+	Image string `json:"image"`
+
+	// Contents are the raw auth file contents.
+	Contents []byte `json:"contents"`
+
+	// SHA256 is the hex encoded checksum of the contents.
+	SHA256 string `json:"sha256"`
+}
+
+// Export returns the encrypted bundle containing all auth files of the
+// namespace recorded in the state. Every auth file gets verified against its
+// sidecar before being exported. The bundle can be imported until the ttl
+// exceeds.
+func Export(cfg *config.Config, namespace string, key []byte, ttl time.Duration, now time.Time) ([]byte, error) {
+	integrityKey, err := cpAuth.ReadKey(cfg.IntegrityKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get integrity key: %w", err)
+	}
+
+	s, err := state.Load(cfg.StateFile)
+	if err != nil {
+		return nil, fmt.Errorf("load state: %w", err)
+	}
+
+	m := &manifest{
+		Namespace: namespace,
+		Format:    cfg.AuthFormat,
+		Created:   now.UTC(),
+		Expires:   now.Add(ttl).UTC(),
+	}
+
+	for _, path := range slices.Sorted(maps.Keys(s.Files)) {
+		entry := s.Files[path]
+		if entry.Namespace != namespace {
+			continue
+		}
+
+		contents, err := readVerified(path, integrityKey)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				// File got removed without updating the state
+				continue
+			}
+
+			return nil, err
+		}
+
+		m.Files = append(m.Files, file{Image: entry.Image, Contents: contents, SHA256: checksum(contents)})
+	}
+
+	if len(m.Files) == 0 {
+		return nil, fmt.Errorf("%w %q", errNoFiles, namespace)
+	}
+
+	return seal(m, key)
+}
+
+// Import decrypts the bundle, validates its expiry and the checksums of all
+// contained auth files and writes them into the auth directory of this node.
+// The written files get signed with the integrity key of this node and
+// recorded in the state. It returns the paths of the written auth files.
+func Import(cfg *config.Config, data, key []byte, now time.Time) ([]string, error) {
+	m, err := open(data, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if now.After(m.Expires) {
+		return nil, fmt.Errorf("%w: expired at %s", ErrExpired, m.Expires.Format(time.RFC3339))
+	}
+
+	if m.Format != cfg.AuthFormat {
+		return nil, fmt.Errorf("%w: %q != %q", errFormatMismatch, m.Format, cfg.AuthFormat)
+	}
+
+	for _, f := range m.Files {
+		if !hmac.Equal([]byte(f.SHA256), []byte(checksum(f.Contents))) {
+			return nil, fmt.Errorf("%w: checksum mismatch for image %q", ErrIntegrity, f.Image)
+		}
+	}
+
+	integrityKey, err := auth.LoadOrCreateIntegrityKey(cfg.IntegrityKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get integrity key: %w", err)
+	}
+
+	stamp, err := app.NewStamp(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	fileNamespace := auth.FileNamespace(m.Namespace, cfg.HashNamespaces, integrityKey)
+	written := make([]string, 0, len(m.Files))
+	images := make(map[string]string, len(m.Files))
+
+	for _, f := range m.Files {
+		path, ok, err := auth.WriteRawAuthFile(cfg.AuthDir, fileNamespace, f.Image, f.Contents, integrityKey, stamp)
+		if err != nil {
+			return written, fmt.Errorf("write auth file for image %q: %w", f.Image, err)
+		}
+
+		if !ok {
+			logger.Infof("Skipped importing auth file %s, a more recent write already happened", path)
+
+			continue
+		}
+
+		written = append(written, path)
+		images[path] = f.Image
+	}
+
+	if err := state.Update(cfg.StateFile, func(s *state.State) error {
+		for _, path := range written {
+			s.Files[path] = &state.File{
+				Namespace: m.Namespace,
+				Image:     images[path],
+				Updated:   now,
+				Owner:     stamp.Owner,
+				Fence:     stamp.Fence,
+			}
+		}
+
+		return nil
+	}); err != nil {
+		logger.Warnf("Unable to record imported auth files in state: %v", err)
+	}
+
+	return written, nil
+}
+
+// readVerified reads the auth file at path and verifies it against the HMAC
+// of its sidecar.
+func readVerified(path string, integrityKey []byte) ([]byte, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read auth file: %w", err)
+	}
+
+	sidecar, err := cpAuth.ReadSidecar(path)
+	if err != nil {
+		return nil, fmt.Errorf("read sidecar: %w", err)
+	}
+
+	if !hmac.Equal([]byte(sidecar.HMAC), []byte(cpAuth.ComputeHMAC(integrityKey, contents))) {
+		return nil, fmt.Errorf("%w: %s", cpAuth.ErrIntegrity, path)
+	}
+
+	return contents, nil
+}
+
+func checksum(contents []byte) string {
+	sum := sha256.Sum256(contents)
+
+	return hex.EncodeToString(sum[:])
+}
+
+// newAEAD derives the AES-256-GCM cipher from the bundle key, which allows
+// using key files of any length.
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) == 0 {
+		return nil, errEmptyKey
+	}
+
+	derived := sha256.Sum256(key)
+
+	block, err := aes.NewCipher(derived[:])
+	if err != nil {
+		return nil, fmt.Errorf("create cipher: %w", err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("create GCM: %w", err)
+	}
+
+	return aead, nil
+}
+
+func seal(m *manifest, key []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := json.Marshal(m)
+	if err != nil {
+		return nil, fmt.Errorf("marshal manifest: %w", err)
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("generate nonce: %w", err)
+	}
+
+	raw, err := json.Marshal(bundle{
+		Version:    bundleVersion,
+		Nonce:      nonce,
+		Ciphertext: aead.Seal(nil, nonce, plaintext, nil),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("marshal bundle: %w", err)
+	}
+
+	return raw, nil
+}
+
+func open(data, key []byte) (*manifest, error) {
+	b := bundle{}
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, fmt.Errorf("unmarshal bundle: %w", err)
+	}
+
+	if b.Version != bundleVersion {
+		return nil, fmt.Errorf("%w: %d", errUnsupportedVersion, b.Version)
+	}
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(b.Nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("%w: invalid nonce size", ErrIntegrity)
+	}
+
+	plaintext, err := aead.Open(nil, b.Nonce, b.Ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrIntegrity, err)
+	}
+
+	m := &manifest{}
+	if err := json.Unmarshal(plaintext, m); err != nil {
+		return nil, fmt.Errorf("unmarshal manifest: %w", err)
+	}
+
+	return m, nil
+}
@@ -0,0 +1,163 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/auth"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/state"
+	cpAuth "github.com/cri-o/crio-credential-provider/pkg/auth"
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+)
+
+const (
+	namespace = "ns"
+	image     = "quay.io/org/app"
+	contents  = `{"auths":{"quay.io":{"auth":"dXNlcjpwYXNz"}}}`
+)
+
+func testConfig(t *testing.T) *config.Config {
+	t.Helper()
+
+	dir := t.TempDir()
+
+	cfg := config.Default()
+	cfg.AuthDir = filepath.Join(dir, "auth")
+	cfg.IntegrityKeyPath = filepath.Join(dir, "integrity.key")
+	cfg.StateFile = filepath.Join(dir, "state.json")
+
+	return cfg
+}
+
+func exportBundle(t *testing.T, key []byte, ttl time.Duration, now time.Time) []byte {
+	t.Helper()
+
+	cfg := testConfig(t)
+
+	integrityKey, err := auth.LoadOrCreateIntegrityKey(cfg.IntegrityKeyPath)
+	require.NoError(t, err)
+
+	path, _, err := auth.WriteRawAuthFile(cfg.AuthDir, namespace, image, []byte(contents), integrityKey, auth.Stamp{})
+	require.NoError(t, err)
+
+	require.NoError(t, state.Update(cfg.StateFile, func(s *state.State) error {
+		s.Files[path] = &state.File{Namespace: namespace, Image: image}
+
+		return nil
+	}))
+
+	data, err := Export(cfg, namespace, key, ttl, now)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "dXNlcjpwYXNz")
+
+	return data
+}
+
+func TestExportImport(t *testing.T) {
+	t.Parallel()
+
+	key := []byte("bundle-key")
+	now := time.Now()
+	data := exportBundle(t, key, time.Hour, now)
+
+	cfg := testConfig(t)
+	cfg.HashNamespaces = true
+
+	written, err := Import(cfg, data, key, now)
+	require.NoError(t, err)
+	require.Len(t, written, 1)
+
+	integrityKey, err := cpAuth.ReadKey(cfg.IntegrityKeyPath)
+	require.NoError(t, err)
+
+	authConfig, err := cpAuth.ReadHashed(cfg.AuthDir, namespace, image, cfg.AuthFormat, integrityKey)
+	require.NoError(t, err)
+	assert.Equal(t, "dXNlcjpwYXNz", authConfig.Auths["quay.io"].Auth)
+
+	s, err := state.Load(cfg.StateFile)
+	require.NoError(t, err)
+	require.Contains(t, s.Files, written[0])
+	assert.Equal(t, image, s.Files[written[0]].Image)
+}
+
+func TestImportFailure(t *testing.T) {
+	t.Parallel()
+
+	key := []byte("bundle-key")
+	now := time.Now()
+	data := exportBundle(t, key, time.Hour, now)
+
+	tampered := bundle{}
+	require.NoError(t, json.Unmarshal(data, &tampered))
+	tampered.Ciphertext[0] ^= 0xff
+	tamperedData, err := json.Marshal(tampered)
+	require.NoError(t, err)
+
+	for name, tc := range map[string]struct {
+		data     []byte
+		key      []byte
+		now      time.Time
+		format   string
+		expected error
+	}{
+		"expired": {
+			data:     data,
+			key:      key,
+			now:      now.Add(2 * time.Hour),
+			expected: ErrExpired,
+		},
+		"wrong key": {
+			data:     data,
+			key:      []byte("wrong"),
+			now:      now,
+			expected: ErrIntegrity,
+		},
+		"tampered": {
+			data:     tamperedData,
+			key:      key,
+			now:      now,
+			expected: ErrIntegrity,
+		},
+		"format mismatch": {
+			data:     data,
+			key:      key,
+			now:      now,
+			format:   config.AuthFormatDocker,
+			expected: errFormatMismatch,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := testConfig(t)
+			if tc.format != "" {
+				cfg.AuthFormat = tc.format
+			}
+
+			written, err := Import(cfg, tc.data, tc.key, tc.now)
+			require.ErrorIs(t, err, tc.expected)
+			assert.Empty(t, written)
+
+			_, err = os.Stat(cfg.AuthDir)
+			assert.True(t, os.IsNotExist(err))
+		})
+	}
+}
+
+func TestExportWithoutFiles(t *testing.T) {
+	t.Parallel()
+
+	cfg := testConfig(t)
+
+	_, err := auth.LoadOrCreateIntegrityKey(cfg.IntegrityKeyPath)
+	require.NoError(t, err)
+
+	_, err = Export(cfg, namespace, []byte("key"), time.Hour, time.Now())
+	require.ErrorIs(t, err, errNoFiles)
+}
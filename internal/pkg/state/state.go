@@ -0,0 +1,331 @@
+// Package state contains the persistent state of the credential provider.
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/k8s"
+	"github.com/cri-o/crio-credential-provider/pkg/mirrors"
+	"github.com/cri-o/crio-credential-provider/pkg/reference"
+)
+
+// Version is the schema version of the state file written by this version of
+// the credential provider. It has to be increased together with a migration
+// for every incompatible change of the format.
+const Version = 1
+
+// ErrUnsupportedVersion is returned if the state file got written by a newer
+// version of the credential provider, which happens after a downgrade.
+var ErrUnsupportedVersion = errors.New("unsupported state file version")
+
+// migrations migrate the raw state of the version of their index to the next
+// version. State files written before the introduction of the version have
+// version 0 and the same format as version 1.
+var migrations = []func(raw map[string]json.RawMessage) error{
+	0: func(map[string]json.RawMessage) error { return nil },
+}
+
+// State is the persistent state of the credential provider.
+type State struct {
+	// Version is the schema version of the state, see Version.
+	Version int `json:"version"`
+
+	// Files maps the path of each written auth file to its metadata.
+	Files map[string]*File `json:"files"`
+
+	// Evictions is the total number of auth files evicted by the retention.
+	Evictions uint64 `json:"evictions,omitempty"`
+
+	// NoCredentials maps the namespace and registry of requests which did
+	// not find any credentials to the expiry of that result.
+	NoCredentials map[string]time.Time `json:"noCredentials,omitempty"`
+}
+
+// File contains the metadata of a written auth file.
+type File struct {
+	// Namespace is the namespace the auth file belongs to.
+	Namespace string `json:"namespace"`
+
+	// Image is the image name from the credential provider request.
+	Image string `json:"image"`
+
+	// Secrets are the names of the secrets the auth file is derived from.
+	Secrets []string `json:"secrets,omitempty"`
+
+	// Sources are the resolved pull sources of the image together with the
+	// decision whether they received credentials.
+	Sources []mirrors.Source `json:"sources,omitempty"`
+
+	// Updated is the last time the auth file got written.
+	Updated time.Time `json:"updated"`
+
+	// Owner identifies the instance which wrote the auth file into a shared
+	// auth directory.
+	Owner string `json:"owner,omitempty"`
+
+	// Fence is the fencing token of the last write into a shared auth directory.
+	Fence uint64 `json:"fence,omitempty"`
+
+	// Workload is the workload the auth file got written for, if known.
+	Workload k8s.Workload `json:"workload,omitzero"`
+
+	// Expires is the time after which the auth file gets evicted by the
+	// retention, if set.
+	Expires time.Time `json:"expires,omitzero"`
+}
+
+// Load reads the state from path while holding a shared lock. A non existing
+// state file results in an empty state.
+func Load(path string) (*State, error) {
+	unlock, err := lock(path, syscall.LOCK_SH)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	return read(path)
+}
+
+// Update reads the state from path, applies fn and writes the result back
+// while holding an exclusive lock. The state does not get written if fn
+// returns an error.
+func Update(path string, fn func(*State) error) error {
+	unlock, err := lock(path, syscall.LOCK_EX)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	s, err := read(path)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(s); err != nil {
+		return err
+	}
+
+	return write(path, s)
+}
+
+// FilesFor returns all auth file paths of the namespace which are derived
+// from the provided secret name, including the auth files of other
+// namespaces referencing it as shared secret.
+func (s *State) FilesFor(namespace, secret string) []string {
+	res := []string{}
+	shared := k8s.SharedSecretName(namespace, secret)
+
+	for path, file := range s.Files {
+		if (file.Namespace == namespace && slices.Contains(file.Secrets, secret)) || slices.Contains(file.Secrets, shared) {
+			res = append(res, path)
+		}
+	}
+
+	return res
+}
+
+// FileOf returns the path and metadata of the auth file written for the
+// namespace and image, or false if there is none.
+func (s *State) FileOf(namespace, image string) (string, *File, bool) {
+	for path, file := range s.Files {
+		if file.Namespace == namespace && file.Image == image {
+			return path, file, true
+		}
+	}
+
+	return "", nil, false
+}
+
+// RemoveNamespace removes all auth file and negative cache entries of the
+// provided namespace.
+func (s *State) RemoveNamespace(namespace string) {
+	maps.DeleteFunc(s.Files, func(_ string, file *File) bool {
+		return file.Namespace == namespace
+	})
+
+	s.ForgetNamespaceNoCredentials(namespace)
+}
+
+// noCredentialsKey returns the key of the namespace and the registry of the
+// image within the negative cache. Unqualified images are keyed by the image
+// itself, because they resolve to multiple registries.
+func noCredentialsKey(namespace, image string) string {
+	if registry, ok := reference.Registry(image); ok {
+		return namespace + "/" + registry
+	}
+
+	return namespace + "/" + image
+}
+
+// HasNoCredentials returns true if a request of the namespace for the
+// registry of the image did not find any credentials and that result did not
+// expire yet.
+func (s *State) HasNoCredentials(namespace, image string, now time.Time) bool {
+	expires, ok := s.NoCredentials[noCredentialsKey(namespace, image)]
+
+	return ok && now.Before(expires)
+}
+
+// SetNoCredentials records that a request of the namespace for the registry
+// of the image did not find any credentials until expires, while dropping all
+// expired entries.
+func (s *State) SetNoCredentials(namespace, image string, now, expires time.Time) {
+	if s.NoCredentials == nil {
+		s.NoCredentials = map[string]time.Time{}
+	}
+
+	maps.DeleteFunc(s.NoCredentials, func(_ string, expires time.Time) bool {
+		return !now.Before(expires)
+	})
+
+	s.NoCredentials[noCredentialsKey(namespace, image)] = expires
+}
+
+// ForgetNamespaceNoCredentials removes all negative cache entries of the
+// namespace, or all entries if the namespace is empty.
+func (s *State) ForgetNamespaceNoCredentials(namespace string) {
+	maps.DeleteFunc(s.NoCredentials, func(key string, _ time.Time) bool {
+		return namespace == "" || strings.HasPrefix(key, namespace+"/")
+	})
+}
+
+func lock(path string, how int) (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("ensure state dir: %w", err)
+	}
+
+	lockFile, err := os.OpenFile(path+".lock", os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open state lock: %w", err)
+	}
+
+	if err := syscall.Flock(int(lockFile.Fd()), how); err != nil {
+		_ = lockFile.Close()
+
+		return nil, fmt.Errorf("lock state: %w", err)
+	}
+
+	return func() {
+		_ = syscall.Flock(int(lockFile.Fd()), syscall.LOCK_UN)
+		_ = lockFile.Close()
+	}, nil
+}
+
+func read(path string) (*State, error) {
+	s := &State{Version: Version, Files: map[string]*File{}}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+
+		return nil, fmt.Errorf("read state: %w", err)
+	}
+
+	if raw, err = migrate(path, raw); err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(raw, s); err != nil {
+		return nil, fmt.Errorf("unmarshal state: %w", err)
+	}
+
+	if s.Files == nil {
+		s.Files = map[string]*File{}
+	}
+
+	return s, nil
+}
+
+// migrate migrates the raw state to the current version. State files of newer
+// versions get refused, because their format is unknown and writing them
+// would lose their data.
+func migrate(path string, raw []byte) ([]byte, error) {
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, fmt.Errorf("unmarshal state: %w", err)
+	}
+
+	version := 0
+	if value, ok := fields["version"]; ok {
+		if err := json.Unmarshal(value, &version); err != nil {
+			return nil, fmt.Errorf("unmarshal state version: %w", err)
+		}
+	}
+
+	if version > Version {
+		return nil, fmt.Errorf(
+			"%w: %s has version %d, but only versions up to %d are supported. "+
+				"The state file got written by a newer version of the credential provider, "+
+				"upgrade it again or remove the state file to start over",
+			ErrUnsupportedVersion, path, version, Version,
+		)
+	}
+
+	if version == Version {
+		return raw, nil
+	}
+
+	for ; version < Version; version++ {
+		if err := migrations[version](fields); err != nil {
+			return nil, fmt.Errorf("migrate state from version %d: %w", version, err)
+		}
+	}
+
+	fields["version"] = json.RawMessage(strconv.Itoa(Version))
+
+	migrated, err := json.Marshal(fields)
+	if err != nil {
+		return nil, fmt.Errorf("marshal migrated state: %w", err)
+	}
+
+	return migrated, nil
+}
+
+func write(path string, s *State) error {
+	s.Version = Version
+
+	raw, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("marshal state: %w", err)
+	}
+
+	tmpFile, err := os.CreateTemp(filepath.Dir(path), ".state-*.tmp")
+	if err != nil {
+		return fmt.Errorf("create temp state: %w", err)
+	}
+
+	tmpPath := tmpFile.Name()
+
+	if _, err := tmpFile.Write(raw); err != nil {
+		_ = tmpFile.Close()
+		_ = os.Remove(tmpPath)
+
+		return fmt.Errorf("write temp state: %w", err)
+	}
+
+	if err := tmpFile.Close(); err != nil {
+		_ = os.Remove(tmpPath)
+
+		return fmt.Errorf("close temp state: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		_ = os.Remove(tmpPath)
+
+		return fmt.Errorf("rename temp state: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,182 @@
+package state
+
+import (
+	"errors"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdate(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "sub", "state.json")
+
+	s, err := Load(path)
+	require.NoError(t, err)
+	assert.Empty(t, s.Files)
+
+	require.NoError(t, Update(path, func(s *State) error {
+		s.Files["/auth/default-1.json"] = &File{Namespace: "default", Image: "quay.io/a", Secrets: []string{"a", "b"}}
+		s.Files["/auth/default-2.json"] = &File{Namespace: "default", Image: "quay.io/b", Secrets: []string{"b"}}
+		s.Files["/auth/other-1.json"] = &File{Namespace: "other", Image: "quay.io/a", Secrets: []string{"a"}}
+		s.Files["/auth/team-1.json"] = &File{Namespace: "team", Image: "quay.io/a", Secrets: []string{"shared/a"}}
+
+		return nil
+	}))
+
+	s, err = Load(path)
+	require.NoError(t, err)
+	assert.Len(t, s.Files, 4)
+	assert.Equal(t, []string{"/auth/team-1.json"}, s.FilesFor("shared", "a"))
+	assert.Equal(t, []string{"/auth/default-1.json"}, s.FilesFor("default", "a"))
+	assert.ElementsMatch(t, []string{"/auth/default-1.json", "/auth/default-2.json"}, s.FilesFor("default", "b"))
+	assert.Empty(t, s.FilesFor("default", "c"))
+
+	errTest := errors.New("test")
+	require.ErrorIs(t, Update(path, func(s *State) error {
+		clear(s.Files)
+
+		return errTest
+	}), errTest)
+
+	s, err = Load(path)
+	require.NoError(t, err)
+	assert.Len(t, s.Files, 4)
+}
+
+func TestUpdateConcurrent(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	const count = 20
+
+	wg := sync.WaitGroup{}
+	for i := range count {
+		wg.Go(func() {
+			assert.NoError(t, Update(path, func(s *State) error {
+				s.Files[filepath.Join("/auth", string(rune('a'+i)))] = &File{}
+
+				return nil
+			}))
+		})
+	}
+
+	wg.Wait()
+
+	s, err := Load(path)
+	require.NoError(t, err)
+	assert.Len(t, s.Files, count)
+}
+
+func TestLoadInvalid(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "state.json")
+	require.NoError(t, os.WriteFile(path, []byte("wrong"), 0o600))
+
+	_, err := Load(path)
+	require.Error(t, err)
+}
+
+func TestLoadVersion(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	// State files written before the introduction of the version
+	require.NoError(t, os.WriteFile(path, []byte(`{"files":{"/auth/default-1.json":{"namespace":"default","image":"quay.io/a"}}}`), 0o600))
+
+	s, err := Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, Version, s.Version)
+	assert.Equal(t, "quay.io/a", s.Files["/auth/default-1.json"].Image)
+
+	require.NoError(t, Update(path, func(*State) error { return nil }))
+
+	raw, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(raw), `"version":1`)
+
+	// State files written by a newer version after a downgrade
+	require.NoError(t, os.WriteFile(path, []byte(`{"version":2,"files":{}}`), 0o600))
+
+	_, err = Load(path)
+	require.ErrorIs(t, err, ErrUnsupportedVersion)
+
+	err = Update(path, func(*State) error { return nil })
+	require.ErrorIs(t, err, ErrUnsupportedVersion)
+
+	raw, err = os.ReadFile(path)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"version":2,"files":{}}`, string(raw), "the newer state stays untouched")
+}
+
+func TestRemoveNamespace(t *testing.T) {
+	t.Parallel()
+
+	s := &State{Files: map[string]*File{
+		"/auth/default-1.json": {Namespace: "default"},
+		"/auth/other-1.json":   {Namespace: "other"},
+	}}
+
+	s.RemoveNamespace("default")
+	assert.Equal(t, []string{"/auth/other-1.json"}, slices.Collect(maps.Keys(s.Files)))
+}
+
+func TestNoCredentials(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	s := &State{}
+
+	assert.False(t, s.HasNoCredentials("default", "quay.io/org/app", now))
+
+	s.SetNoCredentials("default", "quay.io/org/app", now, now.Add(time.Minute))
+	s.SetNoCredentials("default", "nginx", now, now.Add(time.Minute))
+	s.SetNoCredentials("other", "quay.io/org/app", now, now.Add(time.Minute))
+
+	assert.True(t, s.HasNoCredentials("default", "quay.io/other/app", now), "keyed by registry")
+	assert.False(t, s.HasNoCredentials("default", "docker.io/library/nginx", now))
+	assert.True(t, s.HasNoCredentials("default", "nginx", now), "unqualified images are keyed by image")
+	assert.False(t, s.HasNoCredentials("default", "quay.io/org/app", now.Add(time.Minute)), "expired")
+
+	// Expired entries get dropped
+	s.SetNoCredentials("new", "quay.io/org/app", now.Add(2*time.Minute), now.Add(3*time.Minute))
+	assert.Len(t, s.NoCredentials, 1)
+
+	s.SetNoCredentials("default", "quay.io/org/app", now, now.Add(time.Hour))
+	s.SetNoCredentials("other", "quay.io/org/app", now, now.Add(time.Hour))
+
+	s.ForgetNamespaceNoCredentials("default")
+	assert.False(t, s.HasNoCredentials("default", "quay.io/org/app", now))
+	assert.True(t, s.HasNoCredentials("other", "quay.io/org/app", now))
+
+	s.RemoveNamespace("other")
+	assert.Equal(t, []string{"new/quay.io"}, slices.Collect(maps.Keys(s.NoCredentials)))
+}
+
+func TestFileOf(t *testing.T) {
+	t.Parallel()
+
+	s := &State{Files: map[string]*File{
+		"/auth/default-a.json": {Namespace: "default", Image: "quay.io/org/app"},
+		"/auth/other-a.json":   {Namespace: "other", Image: "quay.io/org/app"},
+	}}
+
+	path, file, ok := s.FileOf("other", "quay.io/org/app")
+	require.True(t, ok)
+	assert.Equal(t, "/auth/other-a.json", path)
+	assert.Equal(t, "other", file.Namespace)
+
+	_, _, ok = s.FileOf("default", "quay.io/org/other")
+	assert.False(t, ok)
+}
@@ -0,0 +1,334 @@
+// Package stats contains the logic for summarizing the auth directory.
+package stats
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/state"
+	"github.com/cri-o/crio-credential-provider/pkg/auth"
+	"github.com/cri-o/crio-credential-provider/pkg/mirrors"
+)
+
+const metricPrefix = "crio_credential_provider_"
+
+// Stats is the summary of the auth directory.
+type Stats struct {
+	// Files is the number of auth files.
+	Files int `json:"files"`
+
+	// Bytes is the total size of all auth files.
+	Bytes int64 `json:"bytes"`
+
+	// Oldest is the modification time of the oldest auth file.
+	Oldest time.Time `json:"oldest,omitzero"`
+
+	// Namespaces maps each namespace to its number of auth files.
+	Namespaces map[string]int `json:"namespaces"`
+
+	// Freshness maps each namespace to the modification time of its most
+	// recently written auth file.
+	Freshness map[string]time.Time `json:"freshness"`
+
+	// Evictions is the total number of auth files evicted by the retention.
+	Evictions uint64 `json:"evictions"`
+
+	// State is the summary of the state database, if added.
+	State *StateSummary `json:"state,omitempty"`
+
+	// Resolutions are the most recent auth file resolutions recorded in the
+	// state database, starting with the latest one.
+	Resolutions []Resolution `json:"resolutions,omitempty"`
+
+	// paths are all collected auth file paths.
+	paths map[string]bool
+}
+
+// StateSummary is the summary of the state database.
+type StateSummary struct {
+	// Files is the number of tracked auth files.
+	Files int `json:"files"`
+
+	// Missing is the number of tracked auth files which do not exist.
+	Missing int `json:"missing"`
+
+	// Secrets is the number of distinct secrets the auth files are derived from.
+	Secrets int `json:"secrets"`
+
+	// LastUpdate is the latest time an auth file got written.
+	LastUpdate time.Time `json:"lastUpdate,omitzero"`
+}
+
+// Resolution is a single auth file resolution recorded in the state database.
+type Resolution struct {
+	// Updated is the time the auth file got written.
+	Updated time.Time `json:"updated"`
+
+	// Namespace is the namespace of the auth file.
+	Namespace string `json:"namespace"`
+
+	// Image is the image of the credential provider request.
+	Image string `json:"image"`
+
+	// Path is the path of the auth file.
+	Path string `json:"path"`
+
+	// Secrets are the secrets the auth file is derived from.
+	Secrets []string `json:"secrets"`
+
+	// Sources are the resolved pull sources of the image.
+	Sources []mirrors.Source `json:"sources"`
+}
+
+// Collect gathers the stats of all auth files within dir. A non existing
+// directory results in empty stats.
+func Collect(dir string) (*Stats, error) {
+	stats := &Stats{
+		Namespaces: map[string]int{},
+		Freshness:  map[string]time.Time{},
+		paths:      map[string]bool{},
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return stats, nil
+		}
+
+		return nil, fmt.Errorf("read auth dir: %w", err)
+	}
+
+	for _, entry := range entries {
+		// Versioned auth files are symlinks to their current version
+		if !entry.Type().IsRegular() && entry.Type()&fs.ModeSymlink == 0 {
+			continue
+		}
+
+		namespace, _, err := auth.ParseFilePath(entry.Name())
+		if err != nil {
+			continue
+		}
+
+		info, err := os.Stat(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			if os.IsNotExist(err) {
+				// File got removed in the meantime
+				continue
+			}
+
+			return nil, fmt.Errorf("get file info: %w", err)
+		}
+
+		stats.Files++
+		stats.Bytes += info.Size()
+		stats.Namespaces[namespace]++
+		stats.paths[filepath.Join(dir, entry.Name())] = true
+
+		if stats.Oldest.IsZero() || info.ModTime().Before(stats.Oldest) {
+			stats.Oldest = info.ModTime()
+		}
+
+		if info.ModTime().After(stats.Freshness[namespace]) {
+			stats.Freshness[namespace] = info.ModTime()
+		}
+	}
+
+	return stats, nil
+}
+
+// AddState adds the summary of the state database as well as its last
+// resolutions, limited to the provided number.
+func (s *Stats) AddState(st *state.State, last int) {
+	s.Evictions = st.Evictions
+	s.State = &StateSummary{Files: len(st.Files)}
+
+	secrets := map[string]bool{}
+	resolutions := make([]Resolution, 0, len(st.Files))
+
+	for path, file := range st.Files {
+		if !s.paths[path] {
+			s.State.Missing++
+		}
+
+		for _, secret := range file.Secrets {
+			secrets[file.Namespace+"/"+secret] = true
+		}
+
+		if file.Updated.After(s.State.LastUpdate) {
+			s.State.LastUpdate = file.Updated
+		}
+
+		resolutions = append(resolutions, Resolution{
+			Updated:   file.Updated,
+			Namespace: file.Namespace,
+			Image:     file.Image,
+			Path:      path,
+			Secrets:   file.Secrets,
+			Sources:   file.Sources,
+		})
+	}
+
+	s.State.Secrets = len(secrets)
+
+	slices.SortFunc(resolutions, func(a, b Resolution) int {
+		return cmp.Or(b.Updated.Compare(a.Updated), cmp.Compare(a.Path, b.Path))
+	})
+
+	s.Resolutions = resolutions[:min(max(last, 0), len(resolutions))]
+}
+
+// WriteMetrics writes the stats in the Prometheus text exposition format to w.
+func (s *Stats) WriteMetrics(w io.Writer, now time.Time) error {
+	b := &strings.Builder{}
+
+	writeGauge(b, "auth_files", "Number of auth files in the auth directory.")
+	fmt.Fprintf(b, "%sauth_files %d\n", metricPrefix, s.Files)
+
+	writeGauge(b, "auth_files_bytes", "Total size of all auth files in bytes.")
+	fmt.Fprintf(b, "%sauth_files_bytes %d\n", metricPrefix, s.Bytes)
+
+	oldestAge := 0.0
+	if !s.Oldest.IsZero() {
+		oldestAge = now.Sub(s.Oldest).Seconds()
+	}
+
+	writeGauge(b, "auth_file_oldest_age_seconds", "Age of the oldest auth file in seconds.")
+	fmt.Fprintf(b, "%sauth_file_oldest_age_seconds %g\n", metricPrefix, oldestAge)
+
+	writeMetadata(b, "auth_file_evictions_total", "counter", "Total number of auth files evicted by the retention.")
+	fmt.Fprintf(b, "%sauth_file_evictions_total %d\n", metricPrefix, s.Evictions)
+
+	writeGauge(b, "namespace_auth_files", "Number of auth files per namespace.")
+
+	for _, namespace := range slices.Sorted(maps.Keys(s.Namespaces)) {
+		fmt.Fprintf(b, "%snamespace_auth_files{namespace=%q} %d\n", metricPrefix, namespace, s.Namespaces[namespace])
+	}
+
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return fmt.Errorf("write metrics: %w", err)
+	}
+
+	return nil
+}
+
+// WriteSummary writes a human readable summary of the stats to w.
+func (s *Stats) WriteSummary(w io.Writer, now time.Time) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "Files:\t%d\n", s.Files)
+	fmt.Fprintf(tw, "Bytes:\t%d\n", s.Bytes)
+	fmt.Fprintf(tw, "Evictions:\t%d\n", s.Evictions)
+
+	if !s.Oldest.IsZero() {
+		fmt.Fprintf(tw, "Oldest:\t%s\n", since(s.Oldest, now))
+	}
+
+	if s.State != nil {
+		fmt.Fprintf(tw, "Tracked files:\t%d (%d missing)\n", s.State.Files, s.State.Missing)
+		fmt.Fprintf(tw, "Tracked secrets:\t%d\n", s.State.Secrets)
+
+		if !s.State.LastUpdate.IsZero() {
+			fmt.Fprintf(tw, "Last update:\t%s\n", since(s.State.LastUpdate, now))
+		}
+	}
+
+	if len(s.Namespaces) > 0 {
+		fmt.Fprintf(tw, "\nNAMESPACE\tFILES\tNEWEST\n")
+
+		for _, namespace := range slices.Sorted(maps.Keys(s.Namespaces)) {
+			fmt.Fprintf(tw, "%s\t%d\t%s\n", namespace, s.Namespaces[namespace], since(s.Freshness[namespace], now))
+		}
+	}
+
+	if len(s.Resolutions) > 0 {
+		fmt.Fprintf(tw, "\nUPDATED\tNAMESPACE\tIMAGE\tSECRETS\tSOURCES\n")
+
+		for i := range s.Resolutions {
+			r := &s.Resolutions[i]
+
+			allowed := 0
+
+			for j := range r.Sources {
+				if r.Sources[j].Allowed {
+					allowed++
+				}
+			}
+
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d/%d allowed\n",
+				r.Updated.Format(time.RFC3339), r.Namespace, r.Image, strings.Join(r.Secrets, ","), allowed, len(r.Sources),
+			)
+		}
+	}
+
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("write summary: %w", err)
+	}
+
+	return nil
+}
+
+// since formats the time together with the duration until now.
+func since(t, now time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+
+	return fmt.Sprintf("%s (%s ago)", t.Format(time.RFC3339), now.Sub(t).Round(time.Second))
+}
+
+// WriteTextfile atomically writes the stats as metrics to the provided
+// node-exporter textfile collector path.
+func (s *Stats) WriteTextfile(path string, now time.Time) error {
+	tmpFile, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("create temp textfile: %w", err)
+	}
+
+	tmpPath := tmpFile.Name()
+
+	if err := s.WriteMetrics(tmpFile, now); err != nil {
+		_ = tmpFile.Close()
+		_ = os.Remove(tmpPath)
+
+		return err
+	}
+
+	if err := tmpFile.Close(); err != nil {
+		_ = os.Remove(tmpPath)
+
+		return fmt.Errorf("close temp textfile: %w", err)
+	}
+
+	// The textfile collector requires world readable files
+	if err := os.Chmod(tmpPath, 0o644); err != nil {
+		_ = os.Remove(tmpPath)
+
+		return fmt.Errorf("chmod temp textfile: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		_ = os.Remove(tmpPath)
+
+		return fmt.Errorf("rename temp textfile: %w", err)
+	}
+
+	return nil
+}
+
+func writeGauge(b *strings.Builder, name, help string) {
+	writeMetadata(b, name, "gauge", help)
+}
+
+func writeMetadata(b *strings.Builder, name, metricType, help string) {
+	fmt.Fprintf(b, "# HELP %s%s %s\n", metricPrefix, name, help)
+	fmt.Fprintf(b, "# TYPE %s%s %s\n", metricPrefix, name, metricType)
+}
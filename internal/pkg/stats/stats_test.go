@@ -0,0 +1,161 @@
+package stats
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/state"
+	"github.com/cri-o/crio-credential-provider/pkg/auth"
+)
+
+func writeAuthFile(t *testing.T, dir, namespace, image string, modTime time.Time) {
+	t.Helper()
+
+	path, err := auth.FilePath(dir, namespace, image)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, []byte("{}"), 0o600))
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+}
+
+func TestCollect(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	oldest := now.Add(-time.Hour)
+	dir := t.TempDir()
+
+	writeAuthFile(t, dir, "default", "image-a", now)
+	writeAuthFile(t, dir, "default", "image-b", oldest)
+	writeAuthFile(t, dir, "kube-system", "image-a", now)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".auth-123.tmp"), []byte("{}"), 0o600))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "subdir"), 0o700))
+
+	stats, err := Collect(dir)
+	require.NoError(t, err)
+
+	assert.Equal(t, 3, stats.Files)
+	assert.EqualValues(t, 6, stats.Bytes)
+	assert.True(t, oldest.Equal(stats.Oldest))
+	assert.Equal(t, map[string]int{"default": 2, "kube-system": 1}, stats.Namespaces)
+	assert.True(t, now.Equal(stats.Freshness["default"]))
+}
+
+func TestAddState(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	dir := t.TempDir()
+
+	writeAuthFile(t, dir, "default", "image-a", now)
+
+	existing, err := auth.FilePath(dir, "default", "image-a")
+	require.NoError(t, err)
+
+	missing, err := auth.FilePath(dir, "default", "image-b")
+	require.NoError(t, err)
+
+	other, err := auth.FilePath(dir, "other", "image-a")
+	require.NoError(t, err)
+
+	stats, err := Collect(dir)
+	require.NoError(t, err)
+
+	stats.AddState(&state.State{
+		Evictions: 3,
+		Files: map[string]*state.File{
+			existing: {Namespace: "default", Image: "image-a", Secrets: []string{"a", "b"}, Updated: now},
+			missing:  {Namespace: "default", Image: "image-b", Secrets: []string{"a"}, Updated: now.Add(-time.Hour)},
+			other:    {Namespace: "other", Image: "image-a", Secrets: []string{"a"}, Updated: now.Add(-2 * time.Hour)},
+		},
+	}, 2)
+
+	assert.EqualValues(t, 3, stats.Evictions)
+	assert.Equal(t, 3, stats.State.Files)
+	assert.Equal(t, 2, stats.State.Missing)
+	assert.Equal(t, 3, stats.State.Secrets)
+	assert.True(t, now.Equal(stats.State.LastUpdate))
+
+	require.Len(t, stats.Resolutions, 2)
+	assert.Equal(t, existing, stats.Resolutions[0].Path)
+	assert.Equal(t, missing, stats.Resolutions[1].Path)
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, stats.WriteSummary(buf, now))
+	assert.Contains(t, buf.String(), "Tracked files:")
+	assert.Contains(t, buf.String(), "image-b")
+	assert.NotContains(t, buf.String(), "other")
+}
+
+func TestCollectNotExisting(t *testing.T) {
+	t.Parallel()
+
+	stats, err := Collect(filepath.Join(t.TempDir(), "not-existing"))
+	require.NoError(t, err)
+	assert.Zero(t, stats.Files)
+}
+
+func TestWriteMetrics(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	stats := &Stats{
+		Files:      3,
+		Bytes:      42,
+		Oldest:     now.Add(-time.Minute),
+		Namespaces: map[string]int{"default": 2, "kube-system": 1},
+		Evictions:  5,
+	}
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, stats.WriteMetrics(buf, now))
+
+	res := buf.String()
+	assert.Contains(t, res, "# TYPE crio_credential_provider_auth_files gauge\n")
+	assert.Contains(t, res, "crio_credential_provider_auth_files 3\n")
+	assert.Contains(t, res, "crio_credential_provider_auth_files_bytes 42\n")
+	assert.Contains(t, res, "# TYPE crio_credential_provider_auth_file_evictions_total counter\n")
+	assert.Contains(t, res, "crio_credential_provider_auth_file_evictions_total 5\n")
+	assert.Contains(t, res, "crio_credential_provider_auth_file_oldest_age_seconds 60\n")
+	assert.Contains(t, res, `crio_credential_provider_namespace_auth_files{namespace="default"} 2`)
+	assert.Contains(t, res, `crio_credential_provider_namespace_auth_files{namespace="kube-system"} 1`)
+}
+
+func TestWriteSummary(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	stats := &Stats{
+		Files:      1,
+		Bytes:      42,
+		Oldest:     now,
+		Namespaces: map[string]int{"default": 1},
+	}
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, stats.WriteSummary(buf, now))
+	assert.Contains(t, buf.String(), "Files:")
+	assert.Contains(t, buf.String(), "default")
+}
+
+func TestWriteTextfile(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "crio_credential_provider.prom")
+	stats := &Stats{Namespaces: map[string]int{}}
+
+	require.NoError(t, stats.WriteTextfile(path, time.Now()))
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o644), info.Mode().Perm())
+
+	matches, err := filepath.Glob(filepath.Join(filepath.Dir(path), ".*.tmp"))
+	require.NoError(t, err)
+	assert.Empty(t, matches)
+}
@@ -0,0 +1,231 @@
+// Package ui contains the read-only web interface for inspecting the auth
+// files of a node.
+package ui
+
+import (
+	"bufio"
+	"cmp"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/k8s"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/logger"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/state"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/stats"
+	"github.com/cri-o/crio-credential-provider/pkg/auth"
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+	"github.com/cri-o/crio-credential-provider/pkg/mirrors"
+)
+
+// auditLineMaxSize is the maximum size of a single audit record.
+const auditLineMaxSize = 1 << 20
+
+//go:embed index.html
+var files embed.FS
+
+var index = template.Must(template.New("index.html").Funcs(template.FuncMap{
+	"mirrors": mirrors.Mirrors,
+	"since": func(t, now time.Time) string {
+		if t.IsZero() {
+			return "-"
+		}
+
+		return now.Sub(t).Round(time.Second).String()
+	},
+	"until": func(t, now time.Time) string {
+		if t.IsZero() {
+			return "never"
+		}
+
+		if !t.After(now) {
+			return "expired"
+		}
+
+		return t.Sub(now).Round(time.Second).String()
+	},
+}).ParseFS(files, "index.html"))
+
+// View is the inspected state of the node.
+type View struct {
+	// Generated is the time the view got collected.
+	Generated time.Time `json:"generated"`
+
+	// Stats is the summary of the auth directory.
+	Stats *stats.Stats `json:"stats"`
+
+	// Files are the auth files tracked in the state database, starting with
+	// the most recently written one.
+	Files []File `json:"files"`
+
+	// Audited are the most recent resolutions of the audit log, starting
+	// with the latest one.
+	Audited []Audited `json:"audited"`
+}
+
+// File is an auth file tracked in the state database.
+type File struct {
+	// Path is the path of the auth file.
+	Path string `json:"path"`
+
+	// Exists is false if the auth file got removed without updating the
+	// state database.
+	Exists bool `json:"exists"`
+
+	// SHA256 is the content hash recorded in the sidecar, if readable.
+	SHA256 string `json:"sha256,omitempty"`
+
+	*state.File
+}
+
+// Audited is a resolution recorded in the audit log.
+type Audited struct {
+	// Time is the time of the request.
+	Time time.Time `json:"time"`
+
+	// Namespace is the namespace of the request.
+	Namespace string `json:"namespace"`
+
+	// Image is the requested image.
+	Image string `json:"image"`
+
+	// Workload is the workload of the request, if known.
+	Workload k8s.Workload `json:"workload,omitzero"`
+
+	// Sources are the resolved pull sources of the image.
+	Sources []mirrors.Source `json:"sources"`
+
+	// Secrets are the names of the secrets which would have contributed
+	// credentials.
+	Secrets []string `json:"secrets"`
+
+	// Registries are the auth file keys which would have received
+	// credentials.
+	Registries []string `json:"registries"`
+}
+
+// Collect gathers the view of the auth directory, the state database and the
+// last records of the audit log, limited to the provided number.
+func Collect(cfg *config.Config, last int) (*View, error) {
+	s, err := stats.Collect(cfg.AuthDir)
+	if err != nil {
+		return nil, fmt.Errorf("collect stats: %w", err)
+	}
+
+	st, err := state.Load(cfg.StateFile)
+	if err != nil {
+		return nil, fmt.Errorf("load state: %w", err)
+	}
+
+	s.AddState(st, 0)
+
+	view := &View{Generated: time.Now(), Stats: s, Files: make([]File, 0, len(st.Files)), Audited: []Audited{}}
+
+	for path, file := range st.Files {
+		f := File{Path: path, File: file}
+
+		if _, err := os.Stat(path); err == nil {
+			f.Exists = true
+		}
+
+		if sidecar, err := auth.ReadSidecar(path); err == nil {
+			f.SHA256 = sidecar.SHA256
+		}
+
+		view.Files = append(view.Files, f)
+	}
+
+	slices.SortFunc(view.Files, func(a, b File) int {
+		return cmp.Or(b.Updated.Compare(a.Updated), cmp.Compare(a.Path, b.Path))
+	})
+
+	if cfg.Audit.File != "" {
+		if view.Audited, err = readAudited(cfg.Audit.File, last); err != nil {
+			return nil, err
+		}
+	}
+
+	return view, nil
+}
+
+// readAudited returns the last records of the audit log, starting with the
+// latest one. A non existing audit log results in no records.
+func readAudited(path string, last int) ([]Audited, error) {
+	records := []Audited{}
+
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return records, nil
+		}
+
+		return nil, fmt.Errorf("open audit file: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, auditLineMaxSize)
+
+	for scanner.Scan() {
+		record := Audited{}
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			continue
+		}
+
+		records = append(records, record)
+		if len(records) > max(last, 0) {
+			records = records[1:]
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read audit file: %w", err)
+	}
+
+	slices.Reverse(records)
+
+	return records, nil
+}
+
+// Handler returns the read-only handler serving the view as HTML at "/" and
+// as JSON at "/api/view". The view gets collected for every request.
+func Handler(cfg *config.Config, last int) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, _ *http.Request) {
+		view, err := Collect(cfg, last)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+		if err := index.Execute(w, view); err != nil {
+			logger.Warnf("Unable to render view: %v", err)
+		}
+	})
+
+	mux.HandleFunc("GET /api/view", func(w http.ResponseWriter, _ *http.Request) {
+		view, err := Collect(cfg, last)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		if err := json.NewEncoder(w).Encode(view); err != nil {
+			logger.Warnf("Unable to encode view: %v", err)
+		}
+	})
+
+	return mux
+}
@@ -0,0 +1,152 @@
+package ui
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/k8s"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/state"
+	"github.com/cri-o/crio-credential-provider/pkg/auth"
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+	"github.com/cri-o/crio-credential-provider/pkg/mirrors"
+)
+
+func testConfig(t *testing.T) *config.Config {
+	t.Helper()
+
+	dir := t.TempDir()
+
+	cfg := config.Default()
+	cfg.AuthDir = filepath.Join(dir, "auth")
+	cfg.StateFile = filepath.Join(dir, "state.json")
+	cfg.Audit.File = filepath.Join(dir, "audit.jsonl")
+
+	require.NoError(t, os.Mkdir(cfg.AuthDir, 0o700))
+
+	now := time.Now()
+
+	written, err := auth.FilePath(cfg.AuthDir, "default", "quay.io/org/app")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(written, []byte("{}"), 0o600))
+
+	missing, err := auth.FilePath(cfg.AuthDir, "other", "quay.io/org/app")
+	require.NoError(t, err)
+
+	require.NoError(t, state.Update(cfg.StateFile, func(s *state.State) error {
+		s.Files[written] = &state.File{
+			Namespace: "default",
+			Image:     "quay.io/org/app",
+			Secrets:   []string{"pull-secret"},
+			Sources:   []mirrors.Source{{Location: "mirror.local/org", Mirror: true, Allowed: true}},
+			Updated:   now,
+			Workload:  k8s.Workload{ServiceAccount: "default", Pod: "app-0"},
+			Expires:   now.Add(time.Hour),
+		}
+		s.Files[missing] = &state.File{Namespace: "other", Image: "quay.io/org/app", Updated: now.Add(-time.Hour)}
+
+		return nil
+	}))
+
+	records := []string{}
+	for _, namespace := range []string{"first", "second", "third"} {
+		records = append(records, `{"version":1,"namespace":"`+namespace+`","image":"quay.io/org/app","secrets":["s"],"registries":["mirror.local/org"]}`)
+	}
+
+	require.NoError(t, os.WriteFile(cfg.Audit.File, []byte(strings.Join(records, "\n")+"\n"), 0o600))
+
+	return cfg
+}
+
+func TestCollect(t *testing.T) {
+	t.Parallel()
+
+	cfg := testConfig(t)
+
+	view, err := Collect(cfg, 2)
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, view.Stats.Files)
+	require.Len(t, view.Files, 2)
+	assert.Equal(t, "default", view.Files[0].Namespace)
+	assert.True(t, view.Files[0].Exists)
+	assert.Equal(t, "other", view.Files[1].Namespace)
+	assert.False(t, view.Files[1].Exists)
+
+	require.Len(t, view.Audited, 2)
+	assert.Equal(t, "third", view.Audited[0].Namespace)
+	assert.Equal(t, "second", view.Audited[1].Namespace)
+
+	// Missing state and audit log
+	cfg = config.Default()
+	cfg.AuthDir = filepath.Join(t.TempDir(), "auth")
+	cfg.StateFile = filepath.Join(t.TempDir(), "state.json")
+	cfg.Audit.File = filepath.Join(t.TempDir(), "audit.jsonl")
+
+	view, err = Collect(cfg, 2)
+	require.NoError(t, err)
+	assert.Empty(t, view.Files)
+	assert.Empty(t, view.Audited)
+}
+
+func TestHandler(t *testing.T) {
+	t.Parallel()
+
+	handler := Handler(testConfig(t), 10)
+
+	for name, tc := range map[string]struct {
+		method, path string
+		expectedCode int
+		expected     []string
+	}{
+		"html": {
+			method:       http.MethodGet,
+			path:         "/",
+			expectedCode: http.StatusOK,
+			expected:     []string{"pull-secret", "mirror.local/org", "pod app-0", "(missing)", "third"},
+		},
+		"json": {
+			method:       http.MethodGet,
+			path:         "/api/view",
+			expectedCode: http.StatusOK,
+			expected:     []string{`"secrets":["pull-secret"]`},
+		},
+		"read-only": {
+			method:       http.MethodPost,
+			path:         "/api/view",
+			expectedCode: http.StatusMethodNotAllowed,
+		},
+		"unknown path": {
+			method:       http.MethodGet,
+			path:         "/unknown",
+			expectedCode: http.StatusNotFound,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequestWithContext(t.Context(), tc.method, tc.path, http.NoBody))
+
+			assert.Equal(t, tc.expectedCode, rec.Code)
+
+			for _, expected := range tc.expected {
+				assert.Contains(t, rec.Body.String(), expected)
+			}
+
+			if tc.path == "/api/view" && tc.expectedCode == http.StatusOK {
+				view := View{}
+				require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &view))
+				assert.Len(t, view.Files, 2)
+			}
+		})
+	}
+}
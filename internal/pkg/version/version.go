@@ -12,6 +12,8 @@ import (
 	"text/tabwriter"
 
 	json "github.com/json-iterator/go"
+
+	"github.com/cri-o/crio-credential-provider/pkg/config"
 )
 
 // Version is the version of the build.
@@ -20,17 +22,32 @@ const Version = "0.1.2"
 // Variables injected during build-time.
 var buildDate string // build date in ISO8601 format, output of $(date -u +'%Y-%m-%dT%H:%M:%SZ')
 
-// Info contains all the version information.
+// Info contains all the version information. Features are the optional
+// features enabled by the configuration, which are only set if a
+// configuration got loaded.
 type Info struct {
-	Version       string   `json:"version,omitempty"`
-	GitCommit     string   `json:"gitCommit,omitempty"`
-	GitCommitDate string   `json:"gitCommitDate,omitempty"`
-	BuildDate     string   `json:"buildDate,omitempty"`
-	GoVersion     string   `json:"goVersion,omitempty"`
-	Compiler      string   `json:"compiler,omitempty"`
-	Platform      string   `json:"platform,omitempty"`
-	LDFlags       string   `json:"ldFlags,omitempty"`
-	Dependencies  []string `json:"dependencies,omitempty"`
+	Version           string   `json:"version,omitempty"`
+	GitCommit         string   `json:"gitCommit,omitempty"`
+	GitCommitDate     string   `json:"gitCommitDate,omitempty"`
+	BuildDate         string   `json:"buildDate,omitempty"`
+	GoVersion         string   `json:"goVersion,omitempty"`
+	Compiler          string   `json:"compiler,omitempty"`
+	Platform          string   `json:"platform,omitempty"`
+	LDFlags           string   `json:"ldFlags,omitempty"`
+	CredentialSources []string `json:"credentialSources,omitempty"`
+	TokenSources      []string `json:"tokenSources,omitempty"`
+	CredentialSinks   []string `json:"credentialSinks,omitempty"`
+	Features          []string `json:"features,omitempty"`
+	Dependencies      []string `json:"dependencies,omitempty"`
+}
+
+// CredentialSources are the compiled-in sources of registry credentials.
+var CredentialSources = []string{
+	"dockerconfigjson",
+	"opaque",
+	"static",
+	"shared",
+	"clusterPullSecrets",
 }
 
 // Get returns a new version info instance.
@@ -69,15 +86,18 @@ func Get() (*Info, error) {
 	}
 
 	return &Info{
-		Version:       Version,
-		GitCommit:     gitCommit,
-		GitCommitDate: gitCommitDate,
-		BuildDate:     buildDate,
-		GoVersion:     runtime.Version(),
-		Compiler:      runtime.Compiler,
-		Platform:      fmt.Sprintf("%s/%s", runtime.GOOS, runtime.GOARCH),
-		LDFlags:       ldFlags,
-		Dependencies:  dependencies,
+		Version:           Version,
+		GitCommit:         gitCommit,
+		GitCommitDate:     gitCommitDate,
+		BuildDate:         buildDate,
+		GoVersion:         runtime.Version(),
+		Compiler:          runtime.Compiler,
+		Platform:          fmt.Sprintf("%s/%s", runtime.GOOS, runtime.GOARCH),
+		LDFlags:           ldFlags,
+		CredentialSources: CredentialSources,
+		TokenSources:      config.TokenSourceTypes,
+		CredentialSinks:   config.AuthFormats,
+		Dependencies:      dependencies,
 	}, nil
 }
 
@@ -5,6 +5,8 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/cri-o/crio-credential-provider/pkg/config"
 )
 
 func TestGet(t *testing.T) {
@@ -18,6 +20,10 @@ func TestGet(t *testing.T) {
 	assert.NotEmpty(t, info.GoVersion)
 	assert.NotEmpty(t, info.Compiler)
 	assert.NotEmpty(t, info.Platform)
+	assert.Equal(t, CredentialSources, info.CredentialSources)
+	assert.Equal(t, config.TokenSourceTypes, info.TokenSources)
+	assert.Equal(t, config.AuthFormats, info.CredentialSinks)
+	assert.Empty(t, info.Features)
 }
 
 func TestString(t *testing.T) {
@@ -0,0 +1,88 @@
+// Package warnings contains the deprecation and obsolescence notices of the
+// credential provider. Every notice has a stable code which does not change
+// between releases, which allows tooling to match on them.
+package warnings
+
+import (
+	"fmt"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/logger"
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+)
+
+// Code is the stable machine-readable identifier of a warning.
+type Code string
+
+const (
+	// CodeInsecureAPIConnection is emitted if the TLS certificate of the
+	// Kubernetes API server does not get verified.
+	CodeInsecureAPIConnection Code = "CCP-W0001"
+
+	// CodePrefixSecretMatching is emitted if the registry entries of secrets
+	// get matched as plain string prefixes.
+	CodePrefixSecretMatching Code = "CCP-W0002"
+)
+
+// Kind classifies a warning.
+type Kind string
+
+const (
+	// KindDeprecation marks a behavior which is going to change or get removed.
+	KindDeprecation Kind = "deprecation"
+
+	// KindObsolescence marks a behavior which is still supported but superseded.
+	KindObsolescence Kind = "obsolescence"
+)
+
+// Warning is a single structured notice.
+type Warning struct {
+	// Code is the stable identifier of the warning.
+	Code Code `json:"code"`
+
+	// Kind classifies the warning.
+	Kind Kind `json:"kind"`
+
+	// Message describes the affected behavior.
+	Message string `json:"message"`
+
+	// Migration describes how to move away from the affected behavior.
+	Migration string `json:"migration"`
+}
+
+// String returns the human readable representation of the warning.
+func (w *Warning) String() string {
+	return fmt.Sprintf("[%s] %s: %s. %s", w.Code, w.Kind, w.Message, w.Migration)
+}
+
+// Check returns all warnings which apply to the provided configuration.
+func Check(cfg *config.Config) []Warning {
+	res := []Warning{}
+
+	// The API server does not get contacted in the standalone mode
+	if cfg.StaticSecretsDir == "" && cfg.APIServer.Insecure {
+		res = append(res, Warning{
+			Code:      CodeInsecureAPIConnection,
+			Kind:      KindDeprecation,
+			Message:   "The TLS certificate of the Kubernetes API server does not get verified",
+			Migration: "Unset apiServer.insecure and the --insecure-api-server flag, and configure apiServer.caFile or apiServer.kubeconfig to verify the certificate",
+		})
+	}
+
+	if cfg.SecretMatching == config.SecretMatchingPrefix {
+		res = append(res, Warning{
+			Code:      CodePrefixSecretMatching,
+			Kind:      KindObsolescence,
+			Message:   "Secret registry entries get matched as plain string prefixes without respecting path boundaries",
+			Migration: fmt.Sprintf("Set secretMatching to %q to match against the normalized image reference", config.SecretMatchingReference),
+		})
+	}
+
+	return res
+}
+
+// Log writes all provided warnings to the logger.
+func Log(warnings []Warning) {
+	for i := range warnings {
+		logger.Warnf("Warning %s", warnings[i].String())
+	}
+}
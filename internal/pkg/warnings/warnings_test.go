@@ -0,0 +1,75 @@
+package warnings
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+)
+
+func TestCheck(t *testing.T) {
+	t.Parallel()
+
+	for name, tc := range map[string]struct {
+		modify        func(*config.Config)
+		expectedCodes []Code
+	}{
+		"default config": {
+			modify:        func(*config.Config) {},
+			expectedCodes: []Code{CodePrefixSecretMatching},
+		},
+		"reference secret matching": {
+			modify: func(cfg *config.Config) {
+				cfg.SecretMatching = config.SecretMatchingReference
+			},
+			expectedCodes: []Code{},
+		},
+		"insecure API server": {
+			modify: func(cfg *config.Config) {
+				cfg.APIServer.Insecure = true
+			},
+			expectedCodes: []Code{CodeInsecureAPIConnection, CodePrefixSecretMatching},
+		},
+		"insecure API server with static secrets": {
+			modify: func(cfg *config.Config) {
+				cfg.StaticSecretsDir = "/etc/crio/secrets"
+				cfg.APIServer.Insecure = true
+			},
+			expectedCodes: []Code{CodePrefixSecretMatching},
+		},
+		"static secrets": {
+			modify: func(cfg *config.Config) {
+				cfg.StaticSecretsDir = "/etc/crio/secrets"
+				cfg.SecretMatching = config.SecretMatchingReference
+				cfg.APIServer.Insecure = true
+			},
+			expectedCodes: []Code{},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := config.Default()
+			tc.modify(cfg)
+
+			codes := []Code{}
+			for _, w := range Check(cfg) {
+				assert.NotEmpty(t, w.Kind)
+				assert.NotEmpty(t, w.Message)
+				assert.NotEmpty(t, w.Migration)
+
+				codes = append(codes, w.Code)
+			}
+
+			assert.Equal(t, tc.expectedCodes, codes)
+		})
+	}
+}
+
+func TestString(t *testing.T) {
+	t.Parallel()
+
+	w := &Warning{Code: "CCP-W9999", Kind: KindDeprecation, Message: "Something changes", Migration: "Do something else"}
+	assert.Equal(t, "[CCP-W9999] deprecation: Something changes. Do something else", w.String())
+}
@@ -0,0 +1,165 @@
+// Package webhook contains the HTTP webhooks called around the writes of the
+// auth files, which allow external approval and notification systems to gate
+// or record where registry credentials get materialized. The payloads never
+// contain credentials.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/k8s"
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+)
+
+const (
+	// PhasePreWrite is the phase of the webhook called before writing an
+	// auth file.
+	PhasePreWrite = "preWrite"
+
+	// PhasePostWrite is the phase of the webhook called after writing an
+	// auth file.
+	PhasePostWrite = "postWrite"
+
+	// payloadVersion is the schema version of the payloads, which has to be
+	// increased for every incompatible change of their format.
+	payloadVersion = 1
+
+	// maxReasonSize is the maximum number of bytes of a denial reason.
+	maxReasonSize = 256
+)
+
+var (
+	// ErrDenied is returned if the pre-write webhook denies the write.
+	ErrDenied = errors.New("denied by webhook")
+
+	errStatus = errors.New("unexpected HTTP response status")
+)
+
+// Payload is the JSON document posted to the webhooks.
+type Payload struct {
+	// Version is the schema version of the payload, see payloadVersion.
+	Version int `json:"version"`
+
+	// Phase is one of the Phase* values.
+	Phase string `json:"phase"`
+
+	// Time is the time of the call.
+	Time time.Time `json:"time"`
+
+	// Namespace is the namespace of the auth file.
+	Namespace string `json:"namespace"`
+
+	// Image is the image of the auth file.
+	Image string `json:"image"`
+
+	// Workload is the workload of the write, if known.
+	Workload k8s.Workload `json:"workload,omitzero"`
+
+	// Registries are the auth file keys receiving credentials.
+	Registries []string `json:"registries"`
+
+	// Secrets are the names of the secrets providing the credentials.
+	Secrets []string `json:"secrets"`
+
+	// AuthFile is the path of the written auth file, only set after the
+	// write.
+	AuthFile string `json:"authFile,omitempty"`
+}
+
+// Call posts the payload to the webhook. A 403 Forbidden response denies the
+// write with ErrDenied, containing the response body as reason. All other
+// non 2xx responses and connection failures are errors.
+func Call(ctx context.Context, hook *config.Webhook, payload *Payload) error {
+	payload.Version = payloadVersion
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("marshal payload: %w", err)
+	}
+
+	client, err := newClient(hook)
+	if err != nil {
+		return err
+	}
+
+	if hook.Timeout.Duration > 0 {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, hook.Timeout.Duration)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create webhook request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("send webhook request: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusForbidden:
+		reason, err := io.ReadAll(io.LimitReader(resp.Body, maxReasonSize))
+		if err != nil || len(bytes.TrimSpace(reason)) == 0 {
+			return ErrDenied
+		}
+
+		return fmt.Errorf("%w: %s", ErrDenied, strings.TrimSpace(string(reason)))
+
+	case resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices:
+		return fmt.Errorf("%w: %s", errStatus, resp.Status)
+	}
+
+	return nil
+}
+
+// newClient returns the HTTP client of the webhook, which trusts its CA
+// bundle and presents its client certificate.
+func newClient(hook *config.Webhook) (*http.Client, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if hook.CAFile != "" {
+		raw, err := os.ReadFile(hook.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read CA file: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(raw) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", hook.CAFile)
+		}
+
+		tlsConfig.RootCAs = pool
+	}
+
+	if hook.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(hook.CertFile, hook.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %w", err)
+		}
+
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone() //nolint:forcetypeassert // always a transport
+	transport.TLSClientConfig = tlsConfig
+
+	return &http.Client{Transport: transport}, nil
+}
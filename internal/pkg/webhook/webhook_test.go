@@ -0,0 +1,143 @@
+package webhook
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+)
+
+// writeClientCert writes a self-signed client certificate and its key into
+// dir and returns their paths together with the certificate.
+func writeClientCert(t *testing.T, dir string) (string, string, *x509.Certificate) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "node-1"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	rawKey, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile := filepath.Join(dir, "client.crt")
+	keyFile := filepath.Join(dir, "client.key")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: rawKey}), 0o600))
+
+	return certFile, keyFile, cert
+}
+
+func TestCall(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	certFile, keyFile, clientCert := writeClientCert(t, dir)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := Payload{}
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil || p.Version != payloadVersion || p.Phase != PhasePreWrite ||
+			!slices.Equal(p.Registries, []string{"mirror.local"}) || !slices.Equal(p.Secrets, []string{"pull-secret"}) {
+			w.WriteHeader(http.StatusBadRequest)
+
+			return
+		}
+
+		switch p.Image {
+		case "denied":
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte("registry not approved for node-1\n"))
+		case "failing":
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+
+	pool := x509.NewCertPool()
+	pool.AddCert(clientCert)
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: pool, MinVersion: tls.VersionTLS12}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	caFile := filepath.Join(dir, "ca.crt")
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0o600))
+
+	for name, tc := range map[string]struct {
+		image       string
+		noCert      bool
+		expectedErr string
+		denied      bool
+	}{
+		"allowed": {
+			image: "quay.io/org/app",
+		},
+		"denied": {
+			image:       "denied",
+			expectedErr: "denied by webhook: registry not approved for node-1",
+			denied:      true,
+		},
+		"failing": {
+			image:       "failing",
+			expectedErr: "500 Internal Server Error",
+		},
+		"missing client certificate": {
+			image:       "quay.io/org/app",
+			noCert:      true,
+			expectedErr: "send webhook request",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			hook := &config.Webhook{URL: server.URL, CAFile: caFile, CertFile: certFile, KeyFile: keyFile}
+			if tc.noCert {
+				hook.CertFile, hook.KeyFile = "", ""
+			}
+
+			err := Call(t.Context(), hook, &Payload{
+				Phase:      PhasePreWrite,
+				Namespace:  "default",
+				Image:      tc.image,
+				Registries: []string{"mirror.local"},
+				Secrets:    []string{"pull-secret"},
+			})
+
+			if tc.expectedErr == "" {
+				require.NoError(t, err)
+			} else {
+				require.ErrorContains(t, err, tc.expectedErr)
+			}
+
+			assert.Equal(t, tc.denied, errors.Is(err, ErrDenied))
+		})
+	}
+}
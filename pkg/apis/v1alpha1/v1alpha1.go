@@ -0,0 +1,120 @@
+// Package v1alpha1 contains the custom resources consumed by the credential
+// provider, which allow managing the credential distribution within the
+// cluster instead of the node configuration.
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// Group is the API group of the custom resources.
+	Group = "crio-credential-provider.cri-o.io"
+
+	// Version is the API version of the custom resources.
+	Version = "v1alpha1"
+
+	// ClusterPullSecretResource is the plural resource name of ClusterPullSecret.
+	ClusterPullSecretResource = "clusterpullsecrets"
+
+	// RegistryCredentialPolicyResource is the plural resource name of
+	// RegistryCredentialPolicy.
+	RegistryCredentialPolicyResource = "registrycredentialpolicies"
+)
+
+// ClusterPullSecret is a cluster scoped resource distributing the credentials
+// of a pull secret to the namespaces selected by the platform administrators.
+type ClusterPullSecret struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// Spec is the desired distribution of the pull secret.
+	Spec ClusterPullSecretSpec `json:"spec"`
+}
+
+// ClusterPullSecretSpec is the specification of a ClusterPullSecret.
+type ClusterPullSecretSpec struct {
+	// Registries are the registry patterns in the matchImages syntax, like
+	// "*.example.com" or "mirror.example.com:5000/org". Only the registry
+	// entries of the pull secret matching any of them get distributed.
+	Registries []string `json:"registries"`
+
+	// SecretRef references the distributed pull secret.
+	SecretRef SecretReference `json:"secretRef"`
+
+	// NamespaceSelector selects the namespaces receiving the credentials. An
+	// empty selector selects all namespaces, while a missing one selects none.
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+}
+
+// SecretReference references a secret in any namespace.
+type SecretReference struct {
+	// Namespace is the namespace of the secret.
+	Namespace string `json:"namespace"`
+
+	// Name is the name of the secret.
+	Name string `json:"name"`
+}
+
+// ClusterPullSecretList is a list of ClusterPullSecret resources.
+type ClusterPullSecretList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	// Items are the listed resources.
+	Items []ClusterPullSecret `json:"items"`
+}
+
+// RegistryCredentialPolicy is a cluster scoped resource configuring how the
+// credentials of the selected namespaces get matched and distributed, which
+// takes precedence over the node configuration.
+type RegistryCredentialPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// Spec is the policy.
+	Spec RegistryCredentialPolicySpec `json:"spec"`
+}
+
+// RegistryCredentialPolicySpec is the specification of a
+// RegistryCredentialPolicy. Empty fields keep the node configuration.
+type RegistryCredentialPolicySpec struct {
+	// NamespaceSelector selects the namespaces the policy applies to. An
+	// empty selector selects all namespaces, while a missing one selects none.
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+
+	// SecretMatching is the mode of matching the registry entries of the
+	// secrets, either "prefix" or "reference".
+	SecretMatching string `json:"secretMatching,omitempty"`
+
+	// AllowedRegistries are registry patterns in the matchImages syntax. Only
+	// the pull sources matching any of them receive credentials, if set.
+	AllowedRegistries []string `json:"allowedRegistries,omitempty"`
+
+	// Precedence defines which secrets provide the credentials of registries.
+	Precedence []RegistryPrecedence `json:"precedence,omitempty"`
+
+	// TTL is the duration after which the written auth files get evicted.
+	TTL *metav1.Duration `json:"ttl,omitempty"`
+}
+
+// RegistryPrecedence defines which secrets provide the credentials of the
+// registry entries matching a pattern.
+type RegistryPrecedence struct {
+	// Registry is the registry pattern in the matchImages syntax.
+	Registry string `json:"registry"`
+
+	// Secrets are the names of the secrets providing the credentials of
+	// matching registry entries, where earlier secrets take precedence for
+	// the same entry. The entries of other secrets get ignored.
+	Secrets []string `json:"secrets"`
+}
+
+// RegistryCredentialPolicyList is a list of RegistryCredentialPolicy resources.
+type RegistryCredentialPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	// Items are the listed resources.
+	Items []RegistryCredentialPolicy `json:"items"`
+}
@@ -2,17 +2,34 @@
 package auth
 
 import (
+	"crypto/hmac"
 	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"path"
 	"path/filepath"
+	"strings"
 )
 
+const (
+	fileExt = ".json"
+
+	// namespaceHashContext separates the namespace hashes from the auth file
+	// HMACs computed with the same key.
+	namespaceHashContext = "namespace:"
+)
+
+var errInvalidFileName = errors.New("file name does not match <namespace>-<sha256>.json")
+
 // FilePath returns a path to the auth file for the provided auth directory
 // (dir), namespace and imageRef. The resulting path has the following format:
 // <dir>/<namespace>-<imageRef as SHA256>.json
 //
+// The imageRef has to be the result of reference.Key to match the path of the
+// auth file written by the credential provider.
+//
 // The function errors if:
 // - dir is not an absolute path or not provided.
 // - namespace is not provided.
@@ -32,5 +49,66 @@ func FilePath(dir, namespace, imageRef string) (string, error) {
 
 	hash := sha256.Sum256([]byte(imageRef))
 
-	return filepath.Join(dir, fmt.Sprintf("%s-%x.json", namespace, hash)), nil
+	return filepath.Join(dir, fmt.Sprintf("%s-%x%s", namespace, hash, fileExt)), nil
+}
+
+// HashedFilePath works like FilePath, but uses the namespace hash of
+// NamespaceHash as namespace component. This avoids exposing the namespace
+// names within the auth directory.
+func HashedFilePath(dir, namespace, imageRef string, key []byte) (string, error) {
+	if namespace == "" {
+		return "", errors.New("no namespace provided")
+	}
+
+	return FilePath(dir, NamespaceHash(key, namespace), imageRef)
+}
+
+// NamespaceHash returns the hex encoded HMAC-SHA256 of the namespace using
+// the integrity key.
+func NamespaceHash(key []byte, namespace string) string {
+	return ComputeHMAC(key, []byte(namespaceHashContext+namespace))
+}
+
+// LookupNamespace returns the namespace out of the candidates whose hash
+// matches the namespace component returned by ParseFilePath.
+func LookupNamespace(key []byte, component string, candidates []string) (string, bool) {
+	for _, candidate := range candidates {
+		if hmac.Equal([]byte(NamespaceHash(key, candidate)), []byte(component)) {
+			return candidate, true
+		}
+	}
+
+	return "", false
+}
+
+// ParseFilePath is the inverse of FilePath and returns the namespace as well
+// as the hex encoded image ref hash from the provided auth file path. It
+// supports all naming versions, see Naming.
+func ParseFilePath(filePath string) (string, string, error) {
+	name, ok := strings.CutSuffix(filepath.Base(filePath), fileExt)
+	if !ok {
+		return "", "", errInvalidFileName
+	}
+
+	// The registry component is not part of the result
+	name, _, _ = strings.Cut(name, registrySeparator)
+
+	namespace, imageRefHash, ok := cutLast(name, "-")
+	if !ok || namespace == "" {
+		return "", "", errInvalidFileName
+	}
+
+	if decoded, err := hex.DecodeString(imageRefHash); err != nil || len(imageRefHash) < MinHashLength || len(decoded) > sha512.Size {
+		return "", "", errInvalidFileName
+	}
+
+	return namespace, imageRefHash, nil
+}
+
+func cutLast(s, sep string) (string, string, bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+
+	return s, "", false
 }
@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestFilePath(t *testing.T) {
@@ -56,3 +57,90 @@ func TestFilePath(t *testing.T) {
 		})
 	}
 }
+
+func TestParseFilePath(t *testing.T) {
+	t.Parallel()
+
+	const hash = "baee713fe56d0f5189067a1126374bc39cd8bbca1cd980322f0c8596cd400826"
+
+	for name, tc := range map[string]struct {
+		path, expectedNamespace, expectedHash string
+		shouldErr                             bool
+	}{
+		"success": {
+			path:              "/some/dir/namespace-" + hash + ".json",
+			expectedNamespace: "namespace",
+			expectedHash:      hash,
+		},
+		"success namespace with dashes": {
+			path:              "/some/dir/my-name-space-" + hash + ".json",
+			expectedNamespace: "my-name-space",
+			expectedHash:      hash,
+		},
+		"failure wrong extension": {
+			path:      "/some/dir/namespace-" + hash + ".tmp",
+			shouldErr: true,
+		},
+		"failure no namespace": {
+			path:      "/some/dir/-" + hash + ".json",
+			shouldErr: true,
+		},
+		"failure no hash": {
+			path:      "/some/dir/namespace.json",
+			shouldErr: true,
+		},
+		"failure invalid hash": {
+			path:      "/some/dir/namespace-abc.json",
+			shouldErr: true,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			namespace, hash, err := ParseFilePath(tc.path)
+
+			if tc.shouldErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tc.expectedNamespace, namespace)
+				assert.Equal(t, tc.expectedHash, hash)
+			}
+		})
+	}
+}
+
+func TestFilePathRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	path, err := FilePath("/some/dir", "my-namespace", "image:latest")
+	require.NoError(t, err)
+
+	namespace, _, err := ParseFilePath(path)
+	require.NoError(t, err)
+	assert.Equal(t, "my-namespace", namespace)
+}
+
+func TestHashedFilePath(t *testing.T) {
+	t.Parallel()
+
+	key := []byte("key")
+
+	path, err := HashedFilePath("/some/dir", "my-namespace", "image:latest", key)
+	require.NoError(t, err)
+	assert.NotContains(t, path, "my-namespace")
+
+	component, _, err := ParseFilePath(path)
+	require.NoError(t, err)
+	assert.Equal(t, NamespaceHash(key, "my-namespace"), component)
+
+	namespace, ok := LookupNamespace(key, component, []string{"other", "my-namespace"})
+	assert.True(t, ok)
+	assert.Equal(t, "my-namespace", namespace)
+
+	_, ok = LookupNamespace([]byte("other key"), component, []string{"my-namespace"})
+	assert.False(t, ok)
+
+	_, err = HashedFilePath("/some/dir", "", "image:latest", key)
+	require.Error(t, err)
+}
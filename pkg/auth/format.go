@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/cri-o/crio-credential-provider/pkg/docker"
+)
+
+const (
+	// FormatAuthJSON is the containers-auth.json(5) format consumed by CRI-O
+	// and Podman.
+	FormatAuthJSON = "auth.json"
+
+	// FormatDocker is the Docker config.json layout, which only supports
+	// registry host keys.
+	FormatDocker = "docker"
+
+	// FormatContainerd is the containerd CRI registry configuration in TOML.
+	FormatContainerd = "containerd"
+)
+
+// ErrUnknownFormat is returned if the auth file format is not supported.
+var ErrUnknownFormat = errors.New("unknown auth format")
+
+const (
+	dockerHubKey           = "https://index.docker.io/v1/"
+	containerdDockerHubKey = "registry-1.docker.io"
+)
+
+// Decode decodes auth file contents of the provided format, one of the
+// Format* values, where an empty format is FormatAuthJSON. The format
+// specific Docker Hub keys get normalized to "docker.io".
+func Decode(format string, raw []byte) (docker.ConfigJSON, error) {
+	contents := docker.ConfigJSON{Auths: map[string]docker.AuthConfig{}}
+
+	switch format {
+	case "", FormatAuthJSON, FormatDocker:
+		if err := json.Unmarshal(raw, &contents); err != nil {
+			return contents, fmt.Errorf("decode JSON: %w", err)
+		}
+
+	case FormatContainerd:
+		var tree struct {
+			Plugins map[string]struct {
+				Registry struct {
+					Configs map[string]struct {
+						Auth struct {
+							Auth          string `toml:"auth"`
+							IdentityToken string `toml:"identitytoken"`
+						} `toml:"auth"`
+					} `toml:"configs"`
+				} `toml:"registry"`
+			} `toml:"plugins"`
+		}
+
+		if _, err := toml.Decode(string(raw), &tree); err != nil {
+			return contents, fmt.Errorf("decode TOML: %w", err)
+		}
+
+		for host, cfg := range tree.Plugins["io.containerd.grpc.v1.cri"].Registry.Configs {
+			contents.Auths[host] = docker.AuthConfig{Auth: cfg.Auth.Auth, IdentityToken: cfg.Auth.IdentityToken}
+		}
+
+	default:
+		return contents, fmt.Errorf("%w: %q", ErrUnknownFormat, format)
+	}
+
+	for _, key := range []string{dockerHubKey, containerdDockerHubKey} {
+		if auth, ok := contents.Auths[key]; ok {
+			delete(contents.Auths, key)
+			contents.Auths["docker.io"] = auth
+		}
+	}
+
+	return contents, nil
+}
@@ -0,0 +1,219 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// NamingVersion1 names the auth files <namespace>-<sha256>.json, see
+	// FilePath.
+	NamingVersion1 = 1
+
+	// NamingVersion2 names the auth files <namespace>-<hash>.json or
+	// <namespace>-<hash>_<registry>.json, where the hash uses the algorithm
+	// and length of the naming.
+	NamingVersion2 = 2
+
+	// NamingFile is the file within the auth directory describing the naming
+	// of its auth files, which consumers have to use to locate them.
+	NamingFile = ".naming.json"
+
+	// HashSHA256 is the SHA-256 naming algorithm.
+	HashSHA256 = "sha256"
+
+	// HashSHA512 is the SHA-512 naming algorithm.
+	HashSHA512 = "sha512"
+
+	// MinHashLength is the minimum length of a truncated hex encoded hash,
+	// which keeps collisions between the images of a namespace unlikely.
+	MinHashLength = 16
+
+	// registrySeparator separates the registry from the hash. It is neither
+	// part of namespaces nor registry hosts.
+	registrySeparator = "_"
+)
+
+var (
+	// ErrUnsupportedNaming is returned if the naming of an auth directory is
+	// not supported.
+	ErrUnsupportedNaming = errors.New("unsupported naming")
+
+	errNoRegistry = errors.New("image ref has no registry")
+)
+
+// Naming is the versioned scheme of the auth file names. The zero value is
+// NamingVersion1.
+type Naming struct {
+	// Version is the naming version, one of the NamingVersion* values.
+	Version int `json:"version"`
+
+	// Algorithm is the hash algorithm of the image ref, one of the Hash*
+	// values. Defaults to HashSHA256 if empty.
+	Algorithm string `json:"algorithm,omitempty"`
+
+	// Length is the number of hex characters the hash gets truncated to,
+	// which accommodates file systems with path length limits. The full hash
+	// gets used if zero.
+	Length int `json:"length,omitempty"`
+
+	// Registry adds the registry of the image ref to the file name.
+	Registry bool `json:"registry,omitempty"`
+}
+
+// Validate returns an error if the naming is not supported.
+func (n *Naming) Validate() error {
+	switch n.Version {
+	case 0, NamingVersion1:
+		if (n.Algorithm != "" && n.Algorithm != HashSHA256) || n.Length != 0 || n.Registry {
+			return fmt.Errorf("%w: version %d only supports the full %s hash", ErrUnsupportedNaming, NamingVersion1, HashSHA256)
+		}
+
+	case NamingVersion2:
+		sum, err := n.sum(nil)
+		if err != nil {
+			return err
+		}
+
+		if size := hex.EncodedLen(len(sum)); n.Length != 0 && (n.Length < MinHashLength || n.Length > size) {
+			return fmt.Errorf("%w: length %d has to be between %d and %d", ErrUnsupportedNaming, n.Length, MinHashLength, size)
+		}
+
+	default:
+		return fmt.Errorf("%w: version %d", ErrUnsupportedNaming, n.Version)
+	}
+
+	return nil
+}
+
+// FilePath returns the path to the auth file for the provided auth directory
+// (dir), namespace and imageRef like FilePath, but uses the naming.
+func (n *Naming) FilePath(dir, namespace, imageRef string) (string, error) {
+	if err := n.Validate(); err != nil {
+		return "", err
+	}
+
+	path, err := FilePath(dir, namespace, imageRef)
+	if err != nil || n.Version != NamingVersion2 {
+		return path, err
+	}
+
+	// The algorithm is valid
+	sum, _ := n.sum([]byte(imageRef))
+
+	name := hex.EncodeToString(sum)
+	if n.Length != 0 {
+		name = name[:n.Length]
+	}
+
+	if n.Registry {
+		registry, _, ok := strings.Cut(imageRef, "/")
+		if !ok || registry == "" {
+			return "", fmt.Errorf("%w: %q", errNoRegistry, imageRef)
+		}
+
+		name += registrySeparator + registry
+	}
+
+	return filepath.Join(filepath.Dir(path), fmt.Sprintf("%s-%s%s", namespace, name, fileExt)), nil
+}
+
+// Matches returns true if the auth file at path is named by the naming, which
+// is not the case for auth files written before switching the naming.
+func (n *Naming) Matches(path string) bool {
+	_, imageRefHash, err := ParseFilePath(path)
+	if err != nil || n.Validate() != nil {
+		return false
+	}
+
+	length := n.Length
+	if length == 0 {
+		sum, _ := n.sum(nil)
+		length = hex.EncodedLen(len(sum))
+	}
+
+	registry := strings.Contains(filepath.Base(path), registrySeparator)
+
+	return len(imageRefHash) == length && registry == (n.Version == NamingVersion2 && n.Registry)
+}
+
+// sum returns the hash of data by using the algorithm of the naming.
+func (n *Naming) sum(data []byte) ([]byte, error) {
+	switch n.Algorithm {
+	case "", HashSHA256:
+		sum := sha256.Sum256(data)
+
+		return sum[:], nil
+	case HashSHA512:
+		sum := sha512.Sum512(data)
+
+		return sum[:], nil
+	default:
+		return nil, fmt.Errorf("%w: algorithm %q", ErrUnsupportedNaming, n.Algorithm)
+	}
+}
+
+// ReadNaming returns the naming of the auth files within the auth directory
+// dir. Auth directories without a naming file use NamingVersion1.
+func ReadNaming(dir string) (*Naming, error) {
+	raw, err := os.ReadFile(filepath.Join(dir, NamingFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &Naming{Version: NamingVersion1}, nil
+		}
+
+		return nil, fmt.Errorf("read naming file: %w", err)
+	}
+
+	naming := &Naming{}
+	if err := json.Unmarshal(raw, naming); err != nil {
+		return nil, fmt.Errorf("unmarshal naming file: %w", err)
+	}
+
+	if err := naming.Validate(); err != nil {
+		return nil, err
+	}
+
+	return naming, nil
+}
+
+// WriteNaming atomically writes the naming into the auth directory dir,
+// unless it already describes the naming.
+func WriteNaming(dir string, naming *Naming) error {
+	if err := naming.Validate(); err != nil {
+		return err
+	}
+
+	if existing, err := ReadNaming(dir); err == nil && *existing == naming.normalized() {
+		return nil
+	}
+
+	raw, err := json.Marshal(naming.normalized())
+	if err != nil {
+		return fmt.Errorf("marshal naming file: %w", err)
+	}
+
+	return WriteFileAtomic(filepath.Join(dir, NamingFile), raw, 0o644, -1)
+}
+
+// normalized returns the naming with its defaults applied.
+func (n *Naming) normalized() Naming {
+	res := *n
+
+	if res.Version == 0 {
+		res.Version = NamingVersion1
+	}
+
+	if res.Version == NamingVersion2 && res.Algorithm == "" {
+		res.Algorithm = HashSHA256
+	}
+
+	return res
+}
@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNamingFilePath(t *testing.T) {
+	t.Parallel()
+
+	const imageRef = "quay.io/org/image"
+
+	for name, tc := range map[string]struct {
+		naming    Naming
+		shouldErr bool
+	}{
+		"success with zero value": {},
+		"success with truncated hash": {
+			naming: Naming{Version: NamingVersion2, Length: 16},
+		},
+		"success with sha512 and registry": {
+			naming: Naming{Version: NamingVersion2, Algorithm: HashSHA512, Registry: true},
+		},
+		"failure on version 1 with length": {
+			naming:    Naming{Version: NamingVersion1, Length: 16},
+			shouldErr: true,
+		},
+		"failure on too short length": {
+			naming:    Naming{Version: NamingVersion2, Length: 8},
+			shouldErr: true,
+		},
+		"failure on unknown algorithm": {
+			naming:    Naming{Version: NamingVersion2, Algorithm: "md5"},
+			shouldErr: true,
+		},
+		"failure on unknown version": {
+			naming:    Naming{Version: 3},
+			shouldErr: true,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			path, err := tc.naming.FilePath("/auth", "my-ns", imageRef)
+			if tc.shouldErr {
+				require.ErrorIs(t, err, ErrUnsupportedNaming)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, "/auth", filepath.Dir(path))
+			assert.True(t, tc.naming.Matches(path))
+
+			namespace, _, err := ParseFilePath(path)
+			require.NoError(t, err)
+			assert.Equal(t, "my-ns", namespace)
+
+			if tc.naming.Version == 0 {
+				expected, err := FilePath("/auth", "my-ns", imageRef)
+				require.NoError(t, err)
+				assert.Equal(t, expected, path)
+			}
+
+			if tc.naming.Registry {
+				assert.Contains(t, filepath.Base(path), "_quay.io.json")
+			}
+
+			// Switching the naming renames the auth files
+			assert.Equal(t, tc.naming.Version == 0, (&Naming{}).Matches(path))
+		})
+	}
+}
+
+func TestNamingReadWrite(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	naming, err := ReadNaming(dir)
+	require.NoError(t, err)
+	assert.Equal(t, &Naming{Version: NamingVersion1}, naming)
+
+	// The default naming does not require a naming file
+	require.NoError(t, WriteNaming(dir, &Naming{}))
+	assert.NoFileExists(t, filepath.Join(dir, NamingFile))
+
+	require.NoError(t, WriteNaming(dir, &Naming{Version: NamingVersion2, Length: 32}))
+
+	naming, err = ReadNaming(dir)
+	require.NoError(t, err)
+	assert.Equal(t, &Naming{Version: NamingVersion2, Algorithm: HashSHA256, Length: 32}, naming)
+
+	require.ErrorIs(t, WriteNaming(dir, &Naming{Version: 3}), ErrUnsupportedNaming)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, NamingFile), []byte(`{"version":3}`), 0o600))
+
+	_, err = ReadNaming(dir)
+	require.ErrorIs(t, err, ErrUnsupportedNaming)
+}
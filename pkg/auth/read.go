@@ -0,0 +1,207 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/cri-o/crio-credential-provider/pkg/docker"
+)
+
+const sidecarExt = ".meta"
+
+// SidecarVersion is the schema version of the sidecar files written by this
+// version of the credential provider. Sidecar files written before the
+// introduction of the version have version 0 and the same format as version 1.
+const SidecarVersion = 1
+
+var (
+	// ErrIntegrity is returned if the auth file does not match its sidecar
+	// HMAC.
+	ErrIntegrity = errors.New("auth file integrity check failed")
+
+	// ErrUnsupportedSidecarVersion is returned if the sidecar file got
+	// written by a newer version of the credential provider.
+	ErrUnsupportedSidecarVersion = errors.New("unsupported sidecar file version")
+)
+
+// Sidecar contains the metadata stored next to each auth file.
+type Sidecar struct {
+	// Version is the schema version of the sidecar, see SidecarVersion.
+	Version int `json:"version"`
+
+	// HMAC is the hex encoded HMAC-SHA256 of the auth file contents.
+	HMAC string `json:"hmac"`
+
+	// Owner identifies the instance which wrote the auth file into an auth
+	// directory shared by multiple instances. Empty if not shared.
+	Owner string `json:"owner,omitempty"`
+
+	// Fence is the fencing token of the write within a shared auth directory.
+	// Writes with a lower token than the existing file get rejected.
+	Fence uint64 `json:"fence,omitempty"`
+
+	// SHA256 is the hex encoded SHA-256 of the auth file contents, which
+	// allows consumers without access to the integrity key to verify that
+	// they read the latest write.
+	SHA256 string `json:"sha256,omitempty"`
+
+	// Written is the time the auth file got written.
+	Written time.Time `json:"written,omitzero"`
+
+	// Expires is the time after which the auth file gets evicted, if set.
+	Expires time.Time `json:"expires,omitzero"`
+}
+
+// ComputeSHA256 returns the hex encoded SHA-256 of content.
+func ComputeSHA256(content []byte) string {
+	sum := sha256.Sum256(content)
+
+	return hex.EncodeToString(sum[:])
+}
+
+// Matches returns true if content is the auth file content the sidecar got
+// written for. Sidecars written without a content hash never match.
+func (s *Sidecar) Matches(content []byte) bool {
+	return s.SHA256 != "" && s.SHA256 == ComputeSHA256(content)
+}
+
+// SidecarPath returns the path to the sidecar metadata file of the provided
+// auth file path.
+func SidecarPath(filePath string) string {
+	return filePath + sidecarExt
+}
+
+// ComputeHMAC returns the hex encoded HMAC-SHA256 of content using key.
+func ComputeHMAC(key, content []byte) string {
+	return hex.EncodeToString(computeHMAC(key, content))
+}
+
+func computeHMAC(key, content []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(content)
+
+	return mac.Sum(nil)
+}
+
+// ReadKey reads the integrity key from the provided path.
+func ReadKey(path string) ([]byte, error) {
+	key, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read integrity key: %w", err)
+	}
+
+	if len(key) == 0 {
+		return nil, fmt.Errorf("integrity key %q is empty", path)
+	}
+
+	return key, nil
+}
+
+// ReadSidecar reads the sidecar metadata for the provided auth file path.
+// Sidecars of older versions get migrated, while sidecars of newer versions
+// result in ErrUnsupportedSidecarVersion.
+func ReadSidecar(filePath string) (*Sidecar, error) {
+	raw, err := os.ReadFile(SidecarPath(filePath))
+	if err != nil {
+		return nil, fmt.Errorf("read sidecar: %w", err)
+	}
+
+	sidecar := &Sidecar{}
+	if err := json.Unmarshal(raw, sidecar); err != nil {
+		return nil, fmt.Errorf("unmarshal sidecar: %w", err)
+	}
+
+	if sidecar.Version > SidecarVersion {
+		return nil, fmt.Errorf(
+			"%w: %s has version %d, but only versions up to %d are supported, "+
+				"upgrade to the version of the credential provider which wrote it",
+			ErrUnsupportedSidecarVersion, SidecarPath(filePath), sidecar.Version, SidecarVersion,
+		)
+	}
+
+	// Version 0 only lacks the version field
+	sidecar.Version = SidecarVersion
+
+	return sidecar, nil
+}
+
+// Read locates the auth file for the provided auth directory (dir),
+// namespace and imageRef by using the naming of the auth directory, verifies
+// its contents against the HMAC stored in the sidecar file by using key and
+// returns the auth file parsed in the configured format, see Decode.
+//
+// The function errors with ErrIntegrity if the verification fails.
+func Read(dir, namespace, imageRef, format string, key []byte) (*docker.ConfigJSON, error) {
+	naming, err := ReadNaming(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	path, err := naming.FilePath(dir, namespace, imageRef)
+	if err != nil {
+		return nil, err
+	}
+
+	return readFile(path, format, key)
+}
+
+// ReadHashed works like Read for auth files written with hashed namespaces,
+// see HashedFilePath.
+func ReadHashed(dir, namespace, imageRef, format string, key []byte) (*docker.ConfigJSON, error) {
+	if namespace == "" {
+		return nil, errors.New("no namespace provided")
+	}
+
+	return Read(dir, NamespaceHash(key, namespace), imageRef, format, key)
+}
+
+func readFile(path, format string, key []byte) (*docker.ConfigJSON, error) {
+	raw, err := readVerified(path, key)
+	if errors.Is(err, ErrIntegrity) {
+		// Writers replace the sidecar before the auth file, which means that
+		// a read in between sees the new sidecar next to the old auth file
+		raw, err = readVerified(path, key)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := Decode(format, raw)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal auth file: %w", err)
+	}
+
+	return &config, nil
+}
+
+// readVerified reads the auth file at path and verifies it against the HMAC
+// of its sidecar file by using key.
+func readVerified(path string, key []byte) ([]byte, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read auth file: %w", err)
+	}
+
+	sidecar, err := ReadSidecar(path)
+	if err != nil {
+		return nil, err
+	}
+
+	expected, err := hex.DecodeString(sidecar.HMAC)
+	if err != nil {
+		return nil, fmt.Errorf("%w: decode sidecar HMAC: %w", ErrIntegrity, err)
+	}
+
+	if !hmac.Equal(expected, computeHMAC(key, raw)) {
+		return nil, fmt.Errorf("%w: %s", ErrIntegrity, path)
+	}
+
+	return raw, nil
+}
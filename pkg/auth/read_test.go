@@ -0,0 +1,196 @@
+package auth
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cri-o/crio-credential-provider/pkg/docker"
+)
+
+func TestRead(t *testing.T) {
+	t.Parallel()
+
+	const (
+		namespace = "default"
+		imageRef  = "quay.io/image"
+	)
+
+	key := []byte("key")
+	content := []byte(`{"auths":{"quay.io":{"auth":"dXNlcjpwYXNz"}}}`)
+
+	prepare := func(t *testing.T, content []byte, hmac string) string {
+		t.Helper()
+
+		dir := t.TempDir()
+
+		path, err := FilePath(dir, namespace, imageRef)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(path, content, 0o600))
+
+		sidecar, err := json.Marshal(Sidecar{HMAC: hmac})
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(SidecarPath(path), sidecar, 0o600))
+
+		return dir
+	}
+
+	containerd := []byte(`[plugins."io.containerd.grpc.v1.cri".registry.configs."registry-1.docker.io".auth]
+auth = "dXNlcjpwYXNz"
+`)
+
+	for name, tc := range map[string]struct {
+		prepare func(*testing.T) string
+		format  string
+		assert  func(*docker.ConfigJSON, error)
+	}{
+		"success": {
+			prepare: func(t *testing.T) string {
+				t.Helper()
+
+				return prepare(t, content, ComputeHMAC(key, content))
+			},
+			assert: func(res *docker.ConfigJSON, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, "dXNlcjpwYXNz", res.Auths["quay.io"].Auth)
+			},
+		},
+		"success with containerd format": {
+			prepare: func(t *testing.T) string {
+				t.Helper()
+
+				return prepare(t, containerd, ComputeHMAC(key, containerd))
+			},
+			format: FormatContainerd,
+			assert: func(res *docker.ConfigJSON, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, map[string]docker.AuthConfig{"docker.io": {Auth: "dXNlcjpwYXNz"}}, res.Auths)
+			},
+		},
+		"failure on unknown format": {
+			prepare: func(t *testing.T) string {
+				t.Helper()
+
+				return prepare(t, content, ComputeHMAC(key, content))
+			},
+			format: "yaml",
+			assert: func(_ *docker.ConfigJSON, err error) {
+				require.ErrorIs(t, err, ErrUnknownFormat)
+			},
+		},
+		"failure on tampered content": {
+			prepare: func(t *testing.T) string {
+				t.Helper()
+
+				return prepare(t, []byte(`{"auths":{}}`), ComputeHMAC(key, content))
+			},
+			assert: func(_ *docker.ConfigJSON, err error) {
+				require.ErrorIs(t, err, ErrIntegrity)
+			},
+		},
+		"failure on wrong key": {
+			prepare: func(t *testing.T) string {
+				t.Helper()
+
+				return prepare(t, content, ComputeHMAC([]byte("other"), content))
+			},
+			assert: func(_ *docker.ConfigJSON, err error) {
+				require.ErrorIs(t, err, ErrIntegrity)
+			},
+		},
+		"failure on invalid sidecar HMAC": {
+			prepare: func(t *testing.T) string {
+				t.Helper()
+
+				return prepare(t, content, "not-hex")
+			},
+			assert: func(_ *docker.ConfigJSON, err error) {
+				require.ErrorIs(t, err, ErrIntegrity)
+			},
+		},
+		"failure on missing sidecar": {
+			prepare: func(t *testing.T) string {
+				t.Helper()
+
+				dir := prepare(t, content, ComputeHMAC(key, content))
+
+				path, err := FilePath(dir, namespace, imageRef)
+				require.NoError(t, err)
+				require.NoError(t, os.Remove(SidecarPath(path)))
+
+				return dir
+			},
+			assert: func(_ *docker.ConfigJSON, err error) {
+				require.ErrorIs(t, err, os.ErrNotExist)
+			},
+		},
+		"failure on missing auth file": {
+			prepare: func(t *testing.T) string {
+				t.Helper()
+
+				return t.TempDir()
+			},
+			assert: func(_ *docker.ConfigJSON, err error) {
+				require.ErrorIs(t, err, os.ErrNotExist)
+			},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			res, err := Read(tc.prepare(t), namespace, imageRef, tc.format, key)
+			tc.assert(res, err)
+		})
+	}
+}
+
+func TestReadKey(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "key")
+	require.NoError(t, os.WriteFile(path, []byte("key"), 0o600))
+
+	key, err := ReadKey(path)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("key"), key)
+
+	empty := filepath.Join(dir, "empty")
+	require.NoError(t, os.WriteFile(empty, nil, 0o600))
+
+	_, err = ReadKey(empty)
+	require.Error(t, err)
+}
+
+func TestReadSidecarVersion(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "default-1.json")
+
+	// Sidecars written before the introduction of the version
+	require.NoError(t, os.WriteFile(SidecarPath(path), []byte(`{"hmac":"abc"}`), 0o600))
+
+	sidecar, err := ReadSidecar(path)
+	require.NoError(t, err)
+	assert.Equal(t, &Sidecar{Version: SidecarVersion, HMAC: "abc"}, sidecar)
+
+	require.NoError(t, os.WriteFile(SidecarPath(path), []byte(`{"version":2,"hmac":"abc"}`), 0o600))
+
+	_, err = ReadSidecar(path)
+	require.ErrorIs(t, err, ErrUnsupportedSidecarVersion)
+}
+
+func TestSidecarMatches(t *testing.T) {
+	t.Parallel()
+
+	content := []byte(`{"auths":{}}`)
+
+	assert.True(t, (&Sidecar{SHA256: ComputeSHA256(content)}).Matches(content))
+	assert.False(t, (&Sidecar{SHA256: ComputeSHA256(content)}).Matches([]byte(`{}`)))
+	assert.False(t, (&Sidecar{}).Matches(content))
+}
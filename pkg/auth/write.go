@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// WriteFileAtomic writes data to path without ever exposing a partially
+// written file to concurrent readers like CRI-O. The data gets written to a
+// temp file in the directory of path first, which gets synced and renamed to
+// path afterwards. The file gets the permissions perm and the group gid
+// before the rename, while a gid of -1 keeps the group of the process.
+func WriteFileAtomic(path string, data []byte, perm os.FileMode, gid int) error {
+	dir := filepath.Dir(path)
+
+	tmpFile, err := os.CreateTemp(dir, ".auth-*.tmp")
+	if err != nil {
+		return fmt.Errorf("create temp file: %w", err)
+	}
+
+	tmpPath := tmpFile.Name()
+
+	success := false
+
+	defer func() {
+		if !success {
+			_ = os.Remove(tmpPath)
+		}
+	}()
+
+	if _, err := tmpFile.Write(data); err != nil {
+		_ = tmpFile.Close()
+
+		return fmt.Errorf("write temp file: %w", err)
+	}
+
+	if err := tmpFile.Sync(); err != nil {
+		_ = tmpFile.Close()
+
+		return fmt.Errorf("sync temp file: %w", err)
+	}
+
+	if err := tmpFile.Chmod(perm); err != nil {
+		_ = tmpFile.Close()
+
+		return fmt.Errorf("chmod temp file: %w", err)
+	}
+
+	if gid != -1 {
+		if err := tmpFile.Chown(-1, gid); err != nil {
+			_ = tmpFile.Close()
+
+			return fmt.Errorf("chown temp file: %w", err)
+		}
+	}
+
+	if err := tmpFile.Close(); err != nil {
+		return fmt.Errorf("close temp file: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("rename temp file: %w", err)
+	}
+
+	success = true
+
+	return syncDir(dir)
+}
+
+// syncDir syncs the directory to persist a rename within it.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("open directory: %w", err)
+	}
+	defer d.Close()
+
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("sync directory: %w", err)
+	}
+
+	return nil
+}
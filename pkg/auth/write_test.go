@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	t.Parallel()
+
+	for name, tc := range map[string]struct {
+		existing  bool
+		perm      os.FileMode
+		shouldErr bool
+	}{
+		"success creating the file": {
+			perm: 0o600,
+		},
+		"success replacing the file": {
+			existing: true,
+			perm:     0o640,
+		},
+		"failure on missing directory": {
+			perm:      0o600,
+			shouldErr: true,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			path := filepath.Join(dir, "auth.json")
+
+			if tc.shouldErr {
+				path = filepath.Join(dir, "missing", "auth.json")
+			}
+
+			if tc.existing {
+				require.NoError(t, os.WriteFile(path, []byte("old contents"), 0o600))
+			}
+
+			err := WriteFileAtomic(path, []byte("new"), tc.perm, -1)
+			if tc.shouldErr {
+				require.Error(t, err)
+
+				return
+			}
+
+			require.NoError(t, err)
+
+			data, err := os.ReadFile(path)
+			require.NoError(t, err)
+			assert.Equal(t, []byte("new"), data)
+
+			info, err := os.Stat(path)
+			require.NoError(t, err)
+			assert.Equal(t, tc.perm, info.Mode().Perm())
+
+			// No temp files are left behind
+			entries, err := os.ReadDir(dir)
+			require.NoError(t, err)
+			assert.Len(t, entries, 1)
+		})
+	}
+}
@@ -1,7 +1,240 @@
-// Package config contains variables which can be adjusted at build time.
+// Package config contains the provider configuration as well as variables
+// which can be adjusted at build time.
 package config
 
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+
+	"github.com/cri-o/crio-credential-provider/pkg/auth"
+)
+
+const (
+	// SecretMatchingPrefix matches the registry entries of secrets as plain
+	// string prefixes of the image and mirrors.
+	SecretMatchingPrefix = "prefix"
+
+	// SecretMatchingReference matches the registry entries of secrets against
+	// the normalized image reference, which allows scoping credentials to
+	// repositories as well as tags and digests, like "quay.io/org/app:release-*".
+	SecretMatchingReference = "reference"
+
+	// AuthFormatAuthJSON writes the auth files in the containers-auth.json(5)
+	// format consumed by CRI-O and Podman.
+	AuthFormatAuthJSON = auth.FormatAuthJSON
+
+	// AuthFormatDocker writes the auth files in the Docker config.json layout,
+	// which only supports registry host keys.
+	AuthFormatDocker = auth.FormatDocker
+
+	// AuthFormatContainerd writes the auth files as containerd CRI registry
+	// configuration in TOML.
+	AuthFormatContainerd = auth.FormatContainerd
+
+	// ResponseModeEmpty writes the auth files and responds to the kubelet
+	// without credentials, which leaves the mirror credentials to CRI-O.
+	ResponseModeEmpty = "empty"
+
+	// ResponseModeCredentials responds to the kubelet with the matched
+	// credentials instead of writing the auth files, which allows using the
+	// provider with container runtimes not consuming the auth files.
+	ResponseModeCredentials = "credentials"
+
+	// TokenSourceRequest uses the service account token forwarded by the
+	// kubelet within the credential provider request.
+	TokenSourceRequest = "request"
+
+	// TokenSourceFile reads the service account token from a file, like a
+	// projected service account token.
+	TokenSourceFile = "file"
+
+	// TokenSourceTokenRequest requests a service account token from the API
+	// server by using the node identity.
+	TokenSourceTokenRequest = "tokenRequest"
+
+	// LockFlock locks a shared auth directory by using flock(2), which is
+	// sufficient for local filesystems.
+	LockFlock = "flock"
+
+	// LockFcntl locks a shared auth directory by using POSIX record locks via
+	// fcntl(2), which get forwarded to the server by NFS.
+	LockFcntl = "fcntl"
+
+	// LockLease locks a shared auth directory by exclusively creating a lease
+	// file with an expiry, which works on filesystems without lock support
+	// like virtiofs. Leases of crashed holders get recovered after expiry.
+	LockLease = "lease"
+
+	// WebhookFailurePolicyFail denies the write of an auth file if the
+	// pre-write webhook cannot be called or responds with an error.
+	WebhookFailurePolicyFail = "fail"
+
+	// WebhookFailurePolicyIgnore writes the auth file if the pre-write
+	// webhook cannot be called or responds with an error.
+	WebhookFailurePolicyIgnore = "ignore"
+
+	// MergeConflictNewest replaces the existing auth entries of an auth file
+	// by the ones of the current run.
+	MergeConflictNewest = "newest"
+
+	// MergeConflictExisting keeps the existing auth entries of an auth file
+	// and only adds the new ones of the current run.
+	MergeConflictExisting = "existing"
+
+	// LogLevelDebug logs all records, including the matching details.
+	LogLevelDebug = "debug"
+
+	// LogLevelInfo logs the informational records and above.
+	LogLevelInfo = "info"
+
+	// LogLevelWarn only logs warnings and errors.
+	LogLevelWarn = "warn"
+
+	// LogLevelError only logs errors.
+	LogLevelError = "error"
+
+	// LogFormatText logs text lines to stderr.
+	LogFormatText = "text"
+
+	// LogFormatJSON logs JSON documents to stderr.
+	LogFormatJSON = "json"
+
+	// DefaultSecretMaxSize is the default maximum size of a secret in bytes,
+	// which matches the limit of the Kubernetes API.
+	DefaultSecretMaxSize = 1 << 20
+)
+
+var (
+	// ErrUnknownSecretMatching is returned if the secret matching mode is not supported.
+	ErrUnknownSecretMatching = errors.New("unknown secret matching mode")
+
+	// ErrUnknownAuthFormat is returned if the auth file format is not supported.
+	ErrUnknownAuthFormat = auth.ErrUnknownFormat
+
+	// ErrUnknownResponseMode is returned if the response mode is not supported.
+	ErrUnknownResponseMode = errors.New("unknown response mode")
+
+	// ErrInvalidRetention is returned if a retention limit is negative.
+	ErrInvalidRetention = errors.New("retention limits must not be negative")
+
+	// ErrInvalidMaxInFlight is returned if the admission limit is negative.
+	ErrInvalidMaxInFlight = errors.New("max in-flight must not be negative")
+
+	// ErrInvalidWriteConcurrency is returned if the daemon write concurrency is not positive.
+	ErrInvalidWriteConcurrency = errors.New("write concurrency has to be positive")
+
+	// ErrRelativePath is returned if a configured path is not absolute.
+	ErrRelativePath = errors.New("path has to be absolute")
+
+	// ErrNegativeDuration is returned if a configured duration is negative.
+	ErrNegativeDuration = errors.New("duration must not be negative")
+
+	// ErrInvalidEndpoint is returned if a configured endpoint is not a HTTP(S) URL.
+	ErrInvalidEndpoint = errors.New("endpoint has to be a HTTP or HTTPS URL")
+
+	// ErrAmbiguousClientCertificate is returned if a registry TLS
+	// configuration sources its client certificate from files and a secret.
+	ErrAmbiguousClientCertificate = errors.New("client certificate has to be sourced from either files or a secret")
+
+	// ErrInsecurePermissions is returned if a configured file or directory is
+	// accessible by too many users.
+	ErrInsecurePermissions = errors.New("insecure permissions")
+
+	// ErrNotDirectory is returned if a configured directory is not a directory.
+	ErrNotDirectory = errors.New("not a directory")
+
+	// ErrUnknownTokenSource is returned if the token source type is not supported.
+	ErrUnknownTokenSource = errors.New("unknown token source")
+
+	// ErrMissingValue is returned if a required configuration value is empty.
+	ErrMissingValue = errors.New("value is required")
+
+	// ErrUnknownLock is returned if the coordination lock is not supported.
+	ErrUnknownLock = errors.New("unknown lock")
+
+	// ErrInvalidSecretSize is returned if the maximum secret size is negative.
+	ErrInvalidSecretSize = errors.New("maximum secret size must not be negative")
+
+	// ErrInvalidPattern is returned if a configured pattern is malformed.
+	ErrInvalidPattern = errors.New("invalid pattern")
+
+	// ErrUnknownProfile is returned if the selected profile is not configured.
+	ErrUnknownProfile = errors.New("unknown profile")
+
+	// ErrInvalidOverride is returned if a configuration override is malformed.
+	ErrInvalidOverride = errors.New("invalid override")
+
+	// ErrDuplicateIssuer is returned if a trusted token issuer is configured
+	// multiple times.
+	ErrDuplicateIssuer = errors.New("duplicate issuer")
+
+	// ErrDuplicateOutput is returned if an auth directory is configured
+	// multiple times.
+	ErrDuplicateOutput = errors.New("duplicate auth directory")
+
+	// ErrInvalidMode is returned if a file mode is not an octal permission.
+	ErrInvalidMode = errors.New("file mode has to be an octal permission like 0640")
+
+	// ErrUnknownFailurePolicy is returned if the webhook failure policy is not supported.
+	ErrUnknownFailurePolicy = errors.New("unknown failure policy")
+
+	// ErrUnknownMergeConflict is returned if the merge conflict policy is not supported.
+	ErrUnknownMergeConflict = errors.New("unknown merge conflict policy")
+
+	// ErrUnknownLogLevel is returned if the log level is not supported.
+	ErrUnknownLogLevel = errors.New("unknown log level")
+
+	// ErrUnknownLogFormat is returned if the log format is not supported.
+	ErrUnknownLogFormat = errors.New("unknown log format")
+
+	// ErrTokenExchangeFormat is returned if the token exchange is enabled
+	// for an auth format without support for registry tokens.
+	ErrTokenExchangeFormat = errors.New("token exchange requires the docker auth format")
+)
+
+var (
+	// SecretMatchingModes are the supported secret matching modes.
+	SecretMatchingModes = []string{SecretMatchingPrefix, SecretMatchingReference}
+
+	// AuthFormats are the supported auth file formats.
+	AuthFormats = []string{AuthFormatAuthJSON, AuthFormatDocker, AuthFormatContainerd}
+
+	// ResponseModes are the supported response modes.
+	ResponseModes = []string{ResponseModeEmpty, ResponseModeCredentials}
+
+	// TokenSourceTypes are the supported service account token sources.
+	TokenSourceTypes = []string{TokenSourceRequest, TokenSourceFile, TokenSourceTokenRequest}
+
+	// Locks are the supported coordination locks.
+	Locks = []string{LockFlock, LockFcntl, LockLease}
+
+	// WebhookFailurePolicies are the supported webhook failure policies.
+	WebhookFailurePolicies = []string{WebhookFailurePolicyFail, WebhookFailurePolicyIgnore}
+
+	// MergeConflicts are the supported merge conflict policies.
+	MergeConflicts = []string{MergeConflictNewest, MergeConflictExisting}
+
+	// LogLevels are the supported log levels.
+	LogLevels = []string{LogLevelDebug, LogLevelInfo, LogLevelWarn, LogLevelError}
+
+	// LogFormats are the supported log formats.
+	LogFormats = []string{LogFormatText, LogFormatJSON}
+)
+
 var (
+	// ConfigPath is the default path for the credential provider configuration file.
+	ConfigPath = "/etc/crio/crio-credential-provider.yaml"
+
 	// RegistriesConfPath is the default path for registries.conf.
 	RegistriesConfPath = "/etc/containers/registries.conf"
 
@@ -13,4 +246,1061 @@ var (
 
 	// KubernetesConfigDir is the configuration directory for Kubernetes.
 	KubernetesConfigDir = "/etc/kubernetes"
+
+	// DiagnosticsDir is the default directory for crash reports.
+	DiagnosticsDir = "/var/lib/crio-credential-provider/diagnostics"
+
+	// IntegrityKeyPath is the default path of the key used to sign the auth files.
+	IntegrityKeyPath = "/var/lib/crio-credential-provider/integrity.key"
+
+	// StateFile is the default path of the state database.
+	StateFile = "/var/lib/crio-credential-provider/state.json"
+
+	// AuditFile is the default path of the audit records of the audit mode.
+	AuditFile = "/var/lib/crio-credential-provider/audit.jsonl"
+
+	// AdmissionDir is the default directory of the in-flight slots of the
+	// admission gate.
+	AdmissionDir = "/var/lib/crio-credential-provider/admission"
+
+	// DaemonLeaseFile is the default path of the lease file of the daemon.
+	DaemonLeaseFile = "/var/lib/crio-credential-provider/daemon.lease"
+
+	// KubeletKubeconfigPath is the default path of the kubeconfig containing
+	// the node identity on kubeadm nodes.
+	KubeletKubeconfigPath = "/etc/kubernetes/kubelet.conf"
+
+	// KubeletKubeconfigFallbackPath is the path of the kubeconfig containing
+	// the node identity used if KubeletKubeconfigPath does not exist.
+	KubeletKubeconfigFallbackPath = "/var/lib/kubelet/kubeconfig"
+
+	// KubeletCAFile is the default path of the CA bundle used to verify the
+	// certificate of the API server.
+	KubeletCAFile = "/etc/kubernetes/kubelet-ca.crt"
+
+	// ClaimsProvider is the default provider name within the claims directory.
+	ClaimsProvider = "crio-credential-provider"
+
+	// PolicyPath is the default path for the containers-policy.json(5).
+	PolicyPath = "/etc/containers/policy.json"
 )
+
+// Config is the runtime configuration of the credential provider.
+type Config struct {
+	// RegistriesConfPath is the path to the registries.conf used for mirror matching.
+	RegistriesConfPath string `json:"registriesConfPath,omitempty"`
+
+	// RegistriesConfDirPath is the drop-in directory of the registries.conf,
+	// like /etc/containers/registries.conf.d. The default drop-in directories
+	// get used if empty.
+	RegistriesConfDirPath string `json:"registriesConfDirPath,omitempty"`
+
+	// AuthDir is the directory where the namespaced auth files get written to.
+	AuthDir string `json:"authDir,omitempty"`
+
+	// KubeletAuthFilePath is the path to the kubelet global auth file.
+	KubeletAuthFilePath string `json:"kubeletAuthFilePath,omitempty"`
+
+	// KubernetesConfigDir is the configuration directory for Kubernetes.
+	KubernetesConfigDir string `json:"kubernetesConfigDir,omitempty"`
+
+	// APIServer configures the connection to the Kubernetes API server.
+	APIServer APIServer `json:"apiServer"`
+
+	// StaticSecretsDir enables the standalone mode if not empty, which reads
+	// the secrets from <dir>/<namespace>/<name>.json dockerconfigjson
+	// documents instead of the Kubernetes API.
+	StaticSecretsDir string `json:"staticSecretsDir,omitempty"`
+
+	// AuthGroup is the group which has to own the auth directory with full
+	// group permissions. Required when running the provider as non-root user
+	// which is member of that group. The ownership is not checked if empty.
+	AuthGroup string `json:"authGroup,omitempty"`
+
+	// DiagnosticsDir is the directory where crash reports get written to.
+	DiagnosticsDir string `json:"diagnosticsDir,omitempty"`
+
+	// IntegrityKeyPath is the path of the key used to sign the auth files.
+	// The key gets created if it does not exist.
+	IntegrityKeyPath string `json:"integrityKeyPath,omitempty"`
+
+	// StateFile is the path of the state database tracking the written auth files.
+	StateFile string `json:"stateFile,omitempty"`
+
+	// SecretMatching selects how the registry entries of the secrets get
+	// matched against the image, see the SecretMatching* constants.
+	SecretMatching string `json:"secretMatching,omitempty"`
+
+	// AuthFormat is the format of the written auth files, see the AuthFormat*
+	// constants.
+	AuthFormat string `json:"authFormat,omitempty"`
+
+	// Namespaces restricts the credential provider to a set of namespaces.
+	Namespaces Namespaces `json:"namespaces"`
+
+	// Outputs are additional auth directories for other consumers of the
+	// credentials, like a node local build daemon, which receive the same
+	// auth files in their own format.
+	Outputs []Output `json:"outputs,omitempty"`
+
+	// ResponseMode selects whether the credentials get written to the auth
+	// files or returned to the kubelet, see the ResponseMode* constants.
+	ResponseMode string `json:"responseMode,omitempty"`
+
+	// TokenExchange configures the pre-exchange of the static credentials
+	// for short-lived registry tokens.
+	TokenExchange TokenExchange `json:"tokenExchange"`
+
+	// HashNamespaces replaces the namespace component of the auth file names
+	// with a keyed hash of the namespace, which avoids exposing the namespace
+	// names in the auth directory. The consumer of the auth files requires
+	// access to the integrity key to compute the file names.
+	HashNamespaces bool `json:"hashNamespaces,omitempty"`
+
+	// Naming is the versioned naming scheme of the auth files, which gets
+	// published within the auth directory for the consumers, see
+	// auth.ReadNaming. Defaults to auth.NamingVersion1.
+	Naming auth.Naming `json:"naming"`
+
+	// RegistryCredentialPolicies applies the RegistryCredentialPolicy
+	// resources selecting the namespace, which take precedence over the
+	// secret matching of the node configuration. Not supported in the
+	// standalone mode.
+	RegistryCredentialPolicies bool `json:"registryCredentialPolicies,omitempty"`
+
+	// EmitMetrics writes a JSON metrics object of every credential provider
+	// run to the file descriptor 3 if it is open.
+	EmitMetrics bool `json:"emitMetrics,omitempty"`
+
+	// Logging configures additional log outputs.
+	Logging Logging `json:"logging"`
+
+	// Sources configures which pull sources of an image receive credentials.
+	Sources Sources `json:"sources"`
+
+	// Secrets configures which secrets get considered besides the ones of
+	// type kubernetes.io/dockerconfigjson.
+	Secrets Secrets `json:"secrets"`
+
+	// Retention limits the number and age of the auth files.
+	Retention Retention `json:"retention"`
+
+	// Reuse configures the reuse of previously written auth files.
+	Reuse Reuse `json:"reuse"`
+
+	// Publication configures how the auth files get published to CRI-O.
+	Publication Publication `json:"publication"`
+
+	// Merge configures merging the credentials into the existing auth files.
+	Merge Merge `json:"merge"`
+
+	// Audit configures the read-only audit mode.
+	Audit Audit `json:"audit"`
+
+	// Shadow configures the comparison against the kubelet secrets flow.
+	Shadow Shadow `json:"shadow"`
+
+	// Admission limits the concurrent runs of the node.
+	Admission Admission `json:"admission"`
+
+	// Events configures the CloudEvents emitted on the lifecycle of the auth
+	// files.
+	Events Events `json:"events"`
+
+	// Webhooks configures the HTTP webhooks called around the writes of the
+	// auth files.
+	Webhooks Webhooks `json:"webhooks"`
+
+	// Coordination configures the sharing of the auth directory with other
+	// instances of the credential provider.
+	Coordination Coordination `json:"coordination"`
+
+	// Claims configures the coexistence with other kubelet credential
+	// providers of the node.
+	Claims Claims `json:"claims"`
+
+	// Daemon configures the long running mode.
+	Daemon Daemon `json:"daemon"`
+
+	// Token configures the validation of the service account token.
+	Token Token `json:"token"`
+
+	// RegistryTLS are the client certificates of the registries and their
+	// token services requiring mutual TLS, which get presented by the
+	// credential sources contacting them.
+	RegistryTLS []RegistryTLS `json:"registryTLS,omitempty"`
+
+	// Timeouts are the per-phase timeouts of a single credential provider run.
+	Timeouts Timeouts `json:"timeouts"`
+
+	// Profiles are named partial configurations, which get merged over the
+	// configuration if selected by the --profile argument. This allows
+	// differentiating the behavior per node pool by the args of the kubelet
+	// credential provider configuration.
+	Profiles map[string]json.RawMessage `json:"profiles,omitempty"`
+}
+
+// Logging contains the additional log outputs besides stderr and journald.
+type Logging struct {
+	// Level is the minimum level of the logged records, one of the LogLevel*
+	// values. Defaults to info if empty.
+	Level string `json:"level,omitempty"`
+
+	// Format is the format of the records logged to stderr, one of the
+	// LogFormat* values. The journal and the exports are not affected.
+	// Defaults to text if empty.
+	Format string `json:"format,omitempty"`
+
+	// JSONLFile is the path of a file every log record gets appended to as
+	// JSON line. Disabled if empty.
+	JSONLFile string `json:"jsonlFile,omitempty"`
+
+	// OTLPEndpoint is the OTLP/HTTP collector endpoint the log records get
+	// exported to, for example "http://localhost:4318". Disabled if empty.
+	OTLPEndpoint string `json:"otlpEndpoint,omitempty"`
+}
+
+// Sources contains the options deciding which of the resolved pull sources
+// of an image are permitted to receive credentials.
+type Sources struct {
+	// PolicyPath is the path to the containers-policy.json(5). Sources
+	// rejected by the policy do not receive credentials. The policy is not
+	// evaluated if empty or if the file does not exist.
+	PolicyPath string `json:"policyPath,omitempty"`
+
+	// AllowInsecure permits sources of registries marked as insecure in
+	// registries.conf to receive credentials.
+	AllowInsecure bool `json:"allowInsecure"`
+
+	// ScopeMirrorAuths writes the auth entries of mirrors declared with a
+	// path, like "mirror.example.com/org", scoped to that path instead of
+	// the less specific registry entry of the secret. This avoids sending
+	// path scoped mirror tokens to unrelated repositories of the same host.
+	// Only the auth.json format supports path scoped entries.
+	ScopeMirrorAuths bool `json:"scopeMirrorAuths"`
+
+	// RuntimeSocket is the path of the CRI-O socket. If set, the insecure
+	// registries and the signature policy CRI-O runs with get read from the
+	// /config endpoint of the socket, which makes the sources match the ones
+	// of the runtime. The registries configuration and policyPath remain the
+	// fallback if CRI-O cannot be reached.
+	RuntimeSocket string `json:"runtimeSocket,omitempty"`
+
+	// Pinning honors the pull mirror annotation of the service account, which
+	// restricts the credentials of its workloads to a single mirror. The
+	// kubelet only forwards the annotations listed in the tokenAttributes of
+	// the provider.
+	Pinning bool `json:"pinning,omitempty"`
+
+	// Probe configures the reachability probe of the mirrors.
+	Probe Probe `json:"probe"`
+}
+
+// Probe contains the options of the reachability probe of the mirrors, which
+// helps diagnosing mirrors which are configured but down.
+type Probe struct {
+	// Enabled probes the TCP reachability of the allowed mirrors of every run
+	// and reports the unreachable ones in the logs and the run summary.
+	Enabled bool `json:"enabled,omitempty"`
+
+	// Timeout is the budget for probing all mirrors of a run. Mirrors not
+	// reachable within the budget are considered unreachable.
+	Timeout metav1.Duration `json:"timeout"`
+
+	// TLS completes a TLS handshake with the mirrors, which detects mirrors
+	// accepting connections without serving the registry. Not used for
+	// insecure mirrors.
+	TLS bool `json:"tls,omitempty"`
+
+	// SkipUnreachable does not write credentials for unreachable mirrors,
+	// unless all mirrors are unreachable, which leaves the fallback to the
+	// runtime.
+	SkipUnreachable bool `json:"skipUnreachable,omitempty"`
+}
+
+// Retention contains the limits for the auth directory. Auth files exceeding
+// them get evicted, starting with the least recently written ones. A zero
+// value disables the corresponding limit.
+type Retention struct {
+	// MaxAge is the maximum time since an auth file got written.
+	MaxAge metav1.Duration `json:"maxAge"`
+
+	// MaxPerNamespace is the maximum number of auth files per namespace.
+	MaxPerNamespace int `json:"maxPerNamespace"`
+
+	// MaxTotalFiles is the maximum number of auth files in the auth directory.
+	MaxTotalFiles int `json:"maxTotalFiles"`
+
+	// RegistryTTLs limit the lifetime of the auth files containing
+	// credentials for matching registries, like token based mirrors whose
+	// credentials expire hourly.
+	RegistryTTLs []RegistryTTL `json:"registryTTLs,omitempty"`
+}
+
+// RegistryTTL is the lifetime of the auth files providing credentials to the
+// matching registries.
+type RegistryTTL struct {
+	// Registry is the registry pattern in the kubelet matchImages syntax,
+	// like "*.azurecr.io" or "mirror.example.com/org".
+	Registry string `json:"registry"`
+
+	// TTL is the time after which the auth file expires.
+	TTL metav1.Duration `json:"ttl"`
+}
+
+// Enabled returns true if any retention limit is set.
+func (r *Retention) Enabled() bool {
+	return r.MaxAge.Duration > 0 || r.MaxPerNamespace > 0 || r.MaxTotalFiles > 0 || len(r.RegistryTTLs) > 0
+}
+
+// Reuse contains the durations for which a previously written auth file of
+// the same namespace and image gets reused without retrieving the secrets
+// again. A zero value disables the reuse for the corresponding references.
+type Reuse struct {
+	// Digest is the reuse duration for references by digest, whose content
+	// cannot change.
+	Digest metav1.Duration `json:"digest"`
+
+	// Tag is the reuse duration for references by tag, including the
+	// implicit latest tag.
+	Tag metav1.Duration `json:"tag"`
+}
+
+// Enabled returns true if any reuse duration is set.
+func (r *Reuse) Enabled() bool {
+	return r.Digest.Duration > 0 || r.Tag.Duration > 0
+}
+
+// Audit contains the options of the read-only audit mode, which performs the
+// full resolution of every request but only records which credentials would
+// have been provided instead of writing the auth files.
+type Audit struct {
+	// Enabled switches to the audit mode. No auth files, state or claims get
+	// written, while the responses stay empty as usual.
+	Enabled bool `json:"enabled"`
+
+	// File is the path of the file every audit record gets appended to as
+	// JSON line.
+	File string `json:"file"`
+}
+
+// Shadow contains the options of the shadow mode, which compares the
+// credentials of every request against the ones the kubelet would have used
+// from the imagePullSecrets of the pod.
+type Shadow struct {
+	// Enabled logs the divergences from the kubelet secrets flow. It
+	// requires the pod name within the service account token and permissions
+	// to get the pod.
+	Enabled bool `json:"enabled"`
+}
+
+// TokenExchange contains the options of the registry token pre-exchange. The
+// credentials of matching registries supporting the token authentication get
+// exchanged for a bearer token scoped to the pulled repositories, which gets
+// written as registrytoken instead of the static credentials. Only the docker
+// auth format supports registry tokens.
+type TokenExchange struct {
+	// Registries are the patterns of the registries to exchange the
+	// credentials for, using the matchImages semantics of the kubelet.
+	Registries []string `json:"registries,omitempty"`
+
+	// Audiences are the registries federating the service account identity,
+	// which receive a registry token in exchange for a service account token
+	// of their audience instead of the credentials of the secrets.
+	Audiences []TokenAudience `json:"audiences,omitempty"`
+
+	// Kubeconfig is the path of the kubeconfig containing the node identity,
+	// which mints the service account tokens if the token of the request
+	// lacks the audience and reads the secrets of the registryTLS. Defaults
+	// to the kubelet kubeconfig.
+	Kubeconfig string `json:"kubeconfig,omitempty"`
+}
+
+// Enabled returns true if the credentials of any registry get exchanged.
+func (t *TokenExchange) Enabled() bool {
+	return len(t.Registries) > 0 || len(t.Audiences) > 0
+}
+
+// TokenAudience is a registry federating the service account identity.
+type TokenAudience struct {
+	// Registry is the pattern of the registry locations, using the
+	// matchImages semantics of the kubelet.
+	Registry string `json:"registry"`
+
+	// Audience is the audience the registry requires within the service
+	// account token.
+	Audience string `json:"audience"`
+
+	// Username is sent together with the service account token as password
+	// to the token endpoint of the registry, like the name of the robot
+	// account trusting the identity.
+	Username string `json:"username,omitempty"`
+}
+
+// Output is an additional auth directory. The auth files get written with
+// the same names as within the authDir and get removed together with them.
+type Output struct {
+	// Dir is the directory the auth files get written to.
+	Dir string `json:"dir"`
+
+	// Format is the format of the auth files expected by the consumer, see
+	// the AuthFormat* constants. Defaults to the authFormat if empty.
+	Format string `json:"format,omitempty"`
+
+	// Group is the group owning the auth files, which allows consumers
+	// running as another user to read them. Kept if empty.
+	Group string `json:"group,omitempty"`
+
+	// Mode is the octal file mode of the auth files, like "0640". Defaults
+	// to "0600" if empty.
+	Mode string `json:"mode,omitempty"`
+}
+
+// FileMode returns the parsed file mode of the output.
+func (o *Output) FileMode() (os.FileMode, error) {
+	if o.Mode == "" {
+		return 0o600, nil
+	}
+
+	mode, err := strconv.ParseUint(o.Mode, 8, 32)
+	if err != nil || mode > 0o777 {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidMode, o.Mode)
+	}
+
+	return os.FileMode(mode), nil
+}
+
+// Admission contains the limit of the runs resolving credentials
+// concurrently on the node, which protects the node and the API server from
+// pull storms like after a node reboot. Runs beyond the limit get shed: They
+// respond with a previously written auth file if still valid, or without
+// credentials otherwise.
+type Admission struct {
+	// MaxInFlight is the maximum number of concurrent runs retrieving
+	// secrets. Zero disables the limit.
+	MaxInFlight int `json:"maxInFlight"`
+
+	// Dir is the directory of the in-flight slot files, which get locked by
+	// the admitted runs.
+	Dir string `json:"dir"`
+}
+
+// Events contains the sinks of the CloudEvents emitted whenever an auth file
+// gets created, updated or deleted.
+type Events struct {
+	// Endpoint is the HTTP(S) URL every event gets posted to in the
+	// structured content mode. Disabled if empty.
+	Endpoint string `json:"endpoint,omitempty"`
+
+	// Journal writes every event as structured journald record, or as JSON
+	// line to stderr if journald is not available.
+	Journal bool `json:"journal,omitempty"`
+
+	// Kubernetes creates a warning event in the namespace of the workload
+	// if a registry credential policy denies all mirrors. The service
+	// account token of the request has to permit creating events.
+	Kubernetes bool `json:"kubernetes,omitempty"`
+}
+
+// Webhooks contains the HTTP webhooks called around the writes of the auth
+// files, which allows external systems to approve or record where registry
+// credentials get materialized. The payloads never contain credentials.
+type Webhooks struct {
+	// PreWrite is called before writing an auth file and can deny the write.
+	PreWrite Webhook `json:"preWrite"`
+
+	// PostWrite is called after writing an auth file. Its failures only get
+	// logged.
+	PostWrite Webhook `json:"postWrite"`
+}
+
+// Webhook is a single HTTP webhook.
+type Webhook struct {
+	// URL is the HTTP(S) URL the payload gets posted to. Disabled if empty.
+	URL string `json:"url,omitempty"`
+
+	// CAFile is the CA bundle used to verify the certificate of the webhook.
+	// The system roots get used if empty.
+	CAFile string `json:"caFile,omitempty"`
+
+	// CertFile is the client certificate for mutual TLS, which requires the
+	// KeyFile as well.
+	CertFile string `json:"certFile,omitempty"`
+
+	// KeyFile is the private key of the client certificate.
+	KeyFile string `json:"keyFile,omitempty"`
+
+	// Timeout is the timeout of a single call.
+	Timeout metav1.Duration `json:"timeout"`
+
+	// FailurePolicy decides whether the auth file gets written if the
+	// pre-write webhook cannot be called, see the WebhookFailurePolicy*
+	// constants. Defaults to WebhookFailurePolicyFail if empty.
+	FailurePolicy string `json:"failurePolicy,omitempty"`
+}
+
+// Enabled returns true if the webhook has an URL.
+func (w *Webhook) Enabled() bool {
+	return w.URL != ""
+}
+
+// Namespaces selects the namespaces the credential provider is enabled for,
+// which allows piloting it with a few tenants before enabling it for the whole
+// fleet. Both lists support path.Match patterns like "team-*".
+type Namespaces struct {
+	// Include are the namespaces the credential provider is enabled for. All
+	// namespaces are included if empty.
+	Include []string `json:"include,omitempty"`
+
+	// Exclude are the namespaces the credential provider is disabled for,
+	// like "kube-*", which take precedence over the included ones.
+	Exclude []string `json:"exclude,omitempty"`
+}
+
+// Enabled returns true if the credential provider is restricted to a subset
+// of the namespaces.
+func (n *Namespaces) Enabled() bool {
+	return len(n.Include) > 0 || len(n.Exclude) > 0
+}
+
+// Allows returns true if the credential provider is enabled for the
+// namespace.
+func (n *Namespaces) Allows(namespace string) bool {
+	matches := func(patterns []string) bool {
+		return slices.ContainsFunc(patterns, func(pattern string) bool {
+			matched, err := path.Match(pattern, namespace)
+
+			return err == nil && matched
+		})
+	}
+
+	return (len(n.Include) == 0 || matches(n.Include)) && !matches(n.Exclude)
+}
+
+// APIServer contains the options for connecting to the Kubernetes API server
+// with the service account token of the request.
+type APIServer struct {
+	// Host is the endpoint of the API server, like
+	// "https://api.example.com:6443", which takes precedence over the
+	// kubeconfig and the kubernetesConfigDir if set.
+	Host string `json:"host,omitempty"`
+
+	// CAFile is the path of the PEM encoded CA bundle used to verify the
+	// certificate of the API server. The certificate authority of the
+	// kubeconfig gets used if the file does not exist.
+	CAFile string `json:"caFile,omitempty"`
+
+	// Kubeconfig is the path of the kubelet kubeconfig, like
+	// "/etc/kubernetes/kubelet.conf" on kubeadm nodes. The server of its
+	// current cluster is used as API server endpoint, while its certificate
+	// authority gets used if the CA file does not exist. The endpoint of the
+	// kubernetesConfigDir gets used if the kubeconfig does not exist.
+	Kubeconfig string `json:"kubeconfig,omitempty"`
+
+	// Insecure skips verifying the certificate of the API server, which
+	// allows a man-in-the-middle to capture the service account tokens. Only
+	// intended for development clusters.
+	Insecure bool `json:"insecure,omitempty"`
+}
+
+// Publication contains the options for publishing the auth files.
+type Publication struct {
+	// Versioned writes every auth file content into a new version within
+	// the .versions directory of the auth directory and atomically flips the
+	// auth file, which becomes a symlink to the current version. This allows
+	// rolling back a bad credential rollout on the node by using the rollback
+	// subcommand without resolving the credentials again.
+	Versioned bool `json:"versioned,omitempty"`
+
+	// RetainPrevious is the duration the previous version of an auth file is
+	// kept after getting replaced. It gets removed by the next write of the
+	// auth file afterwards.
+	RetainPrevious metav1.Duration `json:"retainPrevious"`
+}
+
+// Merge contains the options for merging the credentials of a run into the
+// existing auth file of the namespace and image instead of replacing it.
+type Merge struct {
+	// Enabled keeps the auth entries written by earlier runs, like the ones
+	// of mirrors which are not part of the current pull sources any more.
+	Enabled bool `json:"enabled,omitempty"`
+
+	// Conflict decides which auth entry wins if the existing auth file and
+	// the current run contain the same registry key, see the MergeConflict*
+	// constants. Defaults to MergeConflictNewest if empty.
+	Conflict string `json:"conflict,omitempty"`
+}
+
+// Policy returns the effective merge conflict policy, which is empty if
+// merging is disabled.
+func (m *Merge) Policy() string {
+	if !m.Enabled {
+		return ""
+	}
+
+	if m.Conflict == "" {
+		return MergeConflictNewest
+	}
+
+	return m.Conflict
+}
+
+// Coordination contains the options for auth directories shared by multiple
+// kubelets or runtimes on the same host, for example in nested topologies.
+type Coordination struct {
+	// Owner identifies this instance within the shared auth directory. If
+	// set, writes get serialized and fenced, while auth files owned by other
+	// instances are never removed or rewritten. Disabled if empty.
+	Owner string `json:"owner,omitempty"`
+
+	// Lock is the locking mechanism used to serialize the writes, which has
+	// to be the same for all instances sharing the auth directory. Use
+	// "fcntl" for NFS and "lease" for virtiofs shared by multiple nodes.
+	Lock string `json:"lock"`
+
+	// LeaseTTL is the duration after which a lease of the "lease" lock gets
+	// considered stale and recovered, for example if its holder crashed.
+	LeaseTTL metav1.Duration `json:"leaseTTL"`
+}
+
+// Enabled returns true if the auth directory is shared.
+func (c *Coordination) Enabled() bool {
+	return c.Owner != ""
+}
+
+// Secrets contains the options for the considered secrets.
+type Secrets struct {
+	// Opaque additionally considers Opaque secrets annotated with
+	// crio-credential-provider.cri-o.io/registry-credentials: "true", which
+	// contain the username, password and registry keys. This pattern is
+	// commonly produced by external secret operators.
+	Opaque bool `json:"opaque,omitempty"`
+
+	// Dockercfg additionally considers legacy kubernetes.io/dockercfg
+	// secrets, whose .dockercfg key contains the registries without the
+	// auths object.
+	Dockercfg bool `json:"dockercfg,omitempty"`
+
+	// MaxSize is the maximum size of the data of a single secret in bytes.
+	// Larger secrets get skipped to bound the parsing time and memory usage
+	// of a run. Disabled if zero.
+	MaxSize int `json:"maxSize"`
+
+	// Strict fails the request if any secret is malformed instead of skipping
+	// it, which avoids silently proceeding with partial credentials.
+	Strict bool `json:"strict,omitempty"`
+
+	// Shared allows namespaces to reference the pull secrets of a designated
+	// shared namespace.
+	Shared SharedSecrets `json:"shared"`
+
+	// ClusterPullSecrets additionally uses the pull secrets distributed to
+	// the namespace by ClusterPullSecret custom resources. Not supported in
+	// the standalone mode.
+	ClusterPullSecrets bool `json:"clusterPullSecrets,omitempty"`
+
+	// PodPullSecrets only retrieves the imagePullSecrets of the pod and its
+	// service account instead of listing all secrets of the namespace, which
+	// avoids handing out unrelated credentials and only requires the service
+	// accounts to get pods, service accounts and secrets. Requires tokens
+	// bound to a pod or service account. Not supported in the standalone
+	// mode.
+	PodPullSecrets bool `json:"podPullSecrets,omitempty"`
+
+	// NegativeCacheTTL is the duration for which requests of a namespace for
+	// a registry skip retrieving the secrets after no credentials got found,
+	// which avoids hammering the API server with the pulls of crash looping
+	// pods. Disabled if zero.
+	NegativeCacheTTL metav1.Duration `json:"negativeCacheTTL"`
+}
+
+// SharedSecrets is the policy for referencing the pull secrets of a shared
+// namespace from other namespaces. The secrets of the requesting namespace
+// take precedence over the shared ones for equally specific registry entries. The service accounts of the consumer
+// namespaces have to be permitted to list the secrets of the shared
+// namespace, unless the standalone mode is used.
+type SharedSecrets struct {
+	// Namespace is the namespace containing the shared pull secrets.
+	// Disabled if empty.
+	Namespace string `json:"namespace,omitempty"`
+
+	// Consumers are the namespaces permitted to reference the shared pull
+	// secrets, which support path.Match patterns like "team-*".
+	Consumers []string `json:"consumers,omitempty"`
+}
+
+// Allows returns true if the namespace is permitted to reference the shared
+// pull secrets.
+func (s *SharedSecrets) Allows(namespace string) bool {
+	if s.Namespace == "" || namespace == s.Namespace {
+		return false
+	}
+
+	for _, consumer := range s.Consumers {
+		if matched, err := path.Match(consumer, namespace); err == nil && matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Claims contains the options for coexisting with other kubelet credential
+// providers. Every provider writes a claims file per handled registry pattern
+// into a shared directory, while registries claimed by a provider with a
+// higher priority do not receive credentials.
+type Claims struct {
+	// Dir is the directory containing the claims files of all providers of
+	// the node. Disabled if empty.
+	Dir string `json:"dir,omitempty"`
+
+	// Provider is the name of this provider within the claims directory.
+	Provider string `json:"provider,omitempty"`
+
+	// Priority is the priority of this provider, where a higher value wins.
+	Priority int `json:"priority"`
+
+	// Patterns are the registry patterns handled by this provider, using the
+	// matchImages syntax of the kubelet credential provider configuration,
+	// like "*.quay.io" or "registry.example.com:5000/org".
+	Patterns []string `json:"patterns,omitempty"`
+}
+
+// Enabled returns true if the claims are used.
+func (c *Claims) Enabled() bool {
+	return c.Dir != ""
+}
+
+// Daemon contains the options of the long running mode.
+type Daemon struct {
+	// NamespaceWriteConcurrency is the maximum number of auth files of the
+	// same namespace which get written concurrently.
+	NamespaceWriteConcurrency int `json:"namespaceWriteConcurrency"`
+
+	// LeaseFile is the file locked by the active daemon of the node. Other
+	// daemons, like the new one during an upgrade, wait as hot standby with
+	// synced caches until the active daemon stopped.
+	LeaseFile string `json:"leaseFile"`
+}
+
+// Token contains the service account token validation options.
+type Token struct {
+	// Leeway is the tolerated clock skew when validating the time based
+	// claims (exp, nbf, iat) of the token.
+	Leeway metav1.Duration `json:"leeway"`
+
+	// Sources are the ordered sources to obtain the token from. The first
+	// source providing a token wins, which allows falling back to other
+	// sources for kubelets not forwarding the token of the pod.
+	Sources []TokenSource `json:"sources"`
+
+	// Issuers are the trusted issuers of the service account token. Tokens
+	// with any other iss claim get rejected if set, which matters on nodes
+	// serving clusters behind different API aggregators.
+	Issuers []TokenIssuer `json:"issuers,omitempty"`
+
+	// ClaimMapping locates the identity within tokens of a non-standard
+	// layout. The kubernetes.io claim of the service account tokens gets
+	// used if empty.
+	ClaimMapping ClaimMapping `json:"claimMapping"`
+}
+
+// ClaimMapping contains the paths of the identity claims within the token,
+// like ["ext", "kubernetes", "namespace"] for a namespace nested within the
+// claims of an external OIDC issuer. Every path element is the key of a
+// nested object, which supports keys containing dots or slashes.
+type ClaimMapping struct {
+	// Namespace is the path of the namespace, which is required.
+	Namespace []string `json:"namespace,omitempty"`
+
+	// ServiceAccount is the optional path of the service account name.
+	ServiceAccount []string `json:"serviceAccount,omitempty"`
+
+	// ServiceAccountUID is the optional path of the service account UID.
+	ServiceAccountUID []string `json:"serviceAccountUID,omitempty"`
+
+	// Pod is the optional path of the pod name.
+	Pod []string `json:"pod,omitempty"`
+
+	// PodUID is the optional path of the pod UID.
+	PodUID []string `json:"podUID,omitempty"`
+}
+
+// Enabled returns true if any claim path is set.
+func (m *ClaimMapping) Enabled() bool {
+	return len(m.Namespace) > 0 || len(m.ServiceAccount) > 0 || len(m.ServiceAccountUID) > 0 || len(m.Pod) > 0 || len(m.PodUID) > 0
+}
+
+// TokenIssuer is a trusted issuer of the service account token.
+type TokenIssuer struct {
+	// Issuer is the accepted value of the iss claim.
+	Issuer string `json:"issuer"`
+
+	// JWKSURI is the HTTPS URL of the JSON Web Key Set the signatures of
+	// the tokens of the issuer get verified with, like
+	// "https://api.example.com:6443/openid/v1/jwks". The signature does not
+	// get verified if empty.
+	JWKSURI string `json:"jwksURI,omitempty"`
+
+	// CAFile is the path of the PEM encoded CA bundle used to verify the
+	// certificate of the JWKS endpoint. Uses the system roots if empty.
+	CAFile string `json:"caFile,omitempty"`
+}
+
+// TokenSource is a single source of the service account token.
+type TokenSource struct {
+	// Type is the kind of the source, either "request", "file" or "tokenRequest".
+	Type string `json:"type"`
+
+	// Path is the token file path of the "file" source.
+	Path string `json:"path,omitempty"`
+
+	// Kubeconfig is the path of the kubeconfig containing the node identity
+	// of the "tokenRequest" source. Defaults to the kubelet kubeconfig.
+	Kubeconfig string `json:"kubeconfig,omitempty"`
+
+	// Namespace is the namespace of the service account of the "tokenRequest" source.
+	Namespace string `json:"namespace,omitempty"`
+
+	// ServiceAccount is the name of the service account of the "tokenRequest" source.
+	ServiceAccount string `json:"serviceAccount,omitempty"`
+
+	// Audiences are the intended audiences of the requested token. Uses the
+	// API server audiences if empty.
+	Audiences []string `json:"audiences,omitempty"`
+}
+
+// RegistryTLS is the TLS client configuration of the registry locations
+// matching the pattern. The first matching configuration applies.
+type RegistryTLS struct {
+	// Registry is the pattern of the registry locations, using the
+	// matchImages semantics of the kubelet.
+	Registry string `json:"registry"`
+
+	// CAFile is the CA bundle used to verify the certificate of the
+	// registry. The system roots get used if empty.
+	CAFile string `json:"caFile,omitempty"`
+
+	// CertFile is the client certificate on the node, which requires the
+	// KeyFile as well.
+	CertFile string `json:"certFile,omitempty"`
+
+	// KeyFile is the private key of the client certificate on the node.
+	KeyFile string `json:"keyFile,omitempty"`
+
+	// Secret references a kubernetes.io/tls secret containing the client
+	// certificate instead of the files on the node.
+	Secret *SecretReference `json:"secret,omitempty"`
+}
+
+// SecretReference references a secret of a namespace.
+type SecretReference struct {
+	// Namespace is the namespace of the secret.
+	Namespace string `json:"namespace"`
+
+	// Name is the name of the secret.
+	Name string `json:"name"`
+}
+
+// Timeouts contains the deadlines for each phase of a credential provider
+// run. Splitting them up ensures that a single hanging phase cannot consume
+// the whole kubelet plugin deadline. A zero value disables the timeout.
+type Timeouts struct {
+	// Token is the timeout for parsing the service account token.
+	Token metav1.Duration `json:"token"`
+
+	// Secrets is the timeout for retrieving the secrets from the Kubernetes API.
+	Secrets metav1.Duration `json:"secrets"`
+
+	// CredentialSources is the timeout of a single credential source, like a
+	// docker credential helper or a registry token exchange.
+	CredentialSources metav1.Duration `json:"credentialSources"`
+
+	// Write is the timeout for writing the auth file to disk.
+	Write metav1.Duration `json:"write"`
+
+	// Run is the timeout of the whole run, which bounds all phases together.
+	// Disabled by default, since the kubelet enforces its own deadline.
+	Run metav1.Duration `json:"run"`
+}
+
+// KubeletKubeconfig returns the first existing of KubeletKubeconfigPath and
+// KubeletKubeconfigFallbackPath, or KubeletKubeconfigPath if none exists.
+func KubeletKubeconfig() string {
+	for _, path := range []string{KubeletKubeconfigPath, KubeletKubeconfigFallbackPath} {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+
+	return KubeletKubeconfigPath
+}
+
+// Default returns the default configuration based on the build time variables.
+func Default() *Config {
+	return &Config{
+		RegistriesConfPath:  RegistriesConfPath,
+		AuthDir:             AuthDir,
+		KubeletAuthFilePath: KubeletAuthFilePath,
+		KubernetesConfigDir: KubernetesConfigDir,
+		DiagnosticsDir:      DiagnosticsDir,
+		IntegrityKeyPath:    IntegrityKeyPath,
+		StateFile:           StateFile,
+		SecretMatching:      SecretMatchingPrefix,
+		AuthFormat:          AuthFormatAuthJSON,
+		ResponseMode:        ResponseModeEmpty,
+		APIServer: APIServer{
+			CAFile:     KubeletCAFile,
+			Kubeconfig: KubeletKubeconfig(),
+		},
+		Sources: Sources{
+			PolicyPath:    PolicyPath,
+			AllowInsecure: true,
+			Probe: Probe{
+				Timeout: metav1.Duration{Duration: 500 * time.Millisecond},
+			},
+		},
+		Secrets: Secrets{
+			MaxSize: DefaultSecretMaxSize,
+		},
+		Audit: Audit{
+			File: AuditFile,
+		},
+		Admission: Admission{
+			Dir: AdmissionDir,
+		},
+		Publication: Publication{
+			RetainPrevious: metav1.Duration{Duration: time.Hour},
+		},
+		Webhooks: Webhooks{
+			PreWrite:  Webhook{Timeout: metav1.Duration{Duration: 5 * time.Second}},
+			PostWrite: Webhook{Timeout: metav1.Duration{Duration: 5 * time.Second}},
+		},
+		Coordination: Coordination{
+			Lock:     LockFlock,
+			LeaseTTL: metav1.Duration{Duration: 30 * time.Second},
+		},
+		Claims: Claims{
+			Provider: ClaimsProvider,
+		},
+		Daemon: Daemon{
+			NamespaceWriteConcurrency: 4,
+			LeaseFile:                 DaemonLeaseFile,
+		},
+		Token: Token{
+			Leeway:  metav1.Duration{Duration: time.Minute},
+			Sources: []TokenSource{{Type: TokenSourceRequest}},
+		},
+		Timeouts: Timeouts{
+			Token:   metav1.Duration{Duration: 10 * time.Second},
+			Secrets: metav1.Duration{Duration: time.Minute},
+			Write:   metav1.Duration{Duration: 10 * time.Second},
+
+			CredentialSources: metav1.Duration{Duration: 10 * time.Second},
+		},
+	}
+}
+
+// Features returns the configuration paths of the enabled optional features,
+// which helps to see what a given configuration actually does.
+func (c *Config) Features() []string {
+	features := []string{}
+
+	for path, enabled := range map[string]bool{
+		"staticSecretsDir":           c.StaticSecretsDir != "",
+		"hashNamespaces":             c.HashNamespaces,
+		"naming":                     c.Naming.Version > auth.NamingVersion1,
+		"registryCredentialPolicies": c.RegistryCredentialPolicies,
+		"emitMetrics":                c.EmitMetrics,
+		"logging.jsonlFile":          c.Logging.JSONLFile != "",
+		"logging.otlpEndpoint":       c.Logging.OTLPEndpoint != "",
+		"sources.scopeMirrorAuths":   c.Sources.ScopeMirrorAuths,
+		"sources.pinning":            c.Sources.Pinning,
+		"sources.probe":              c.Sources.Probe.Enabled,
+		"secrets.opaque":             c.Secrets.Opaque,
+		"secrets.dockercfg":          c.Secrets.Dockercfg,
+		"secrets.strict":             c.Secrets.Strict,
+		"secrets.shared":             c.Secrets.Shared.Namespace != "",
+		"secrets.clusterPullSecrets": c.Secrets.ClusterPullSecrets,
+		"secrets.podPullSecrets":     c.Secrets.PodPullSecrets,
+		"secrets.negativeCacheTTL":   c.Secrets.NegativeCacheTTL.Duration > 0,
+		"retention":                  c.Retention.Enabled(),
+		"reuse":                      c.Reuse.Enabled(),
+		"audit":                      c.Audit.Enabled,
+		"shadow":                     c.Shadow.Enabled,
+		"admission":                  c.Admission.MaxInFlight > 0,
+		"namespaces":                 c.Namespaces.Enabled(),
+		"outputs":                    len(c.Outputs) > 0,
+		"responseMode":               c.ResponseMode == ResponseModeCredentials,
+		"tokenExchange":              c.TokenExchange.Enabled(),
+		"registryTLS":                len(c.RegistryTLS) > 0,
+		"sources.runtimeSocket":      c.Sources.RuntimeSocket != "",
+		"publication.versioned":      c.Publication.Versioned,
+		"merge":                      c.Merge.Enabled,
+		"events.endpoint":            c.Events.Endpoint != "",
+		"events.journal":             c.Events.Journal,
+		"events.kubernetes":          c.Events.Kubernetes,
+		"webhooks.preWrite":          c.Webhooks.PreWrite.Enabled(),
+		"webhooks.postWrite":         c.Webhooks.PostWrite.Enabled(),
+		"coordination":               c.Coordination.Enabled(),
+		"claims":                     c.Claims.Enabled(),
+		"token.issuers":              len(c.Token.Issuers) > 0,
+		"token.claimMapping":         c.Token.ClaimMapping.Enabled(),
+	} {
+		if enabled {
+			features = append(features, path)
+		}
+	}
+
+	slices.Sort(features)
+
+	return features
+}
+
+// Load reads the configuration file from path and applies it on top of the
+// defaults, followed by the environment variables of EnvOverrides. A non
+// existing file results in the default configuration.
+func Load(path string) (*Config, error) {
+	cfg, err := Read(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config file %q: %w", path, err)
+	}
+
+	return cfg, nil
+}
+
+// Read works like Load but does not validate the configuration values.
+func Read(path string) (*Config, error) {
+	cfg := Default()
+
+	raw, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("unable to read config file: %w", err)
+	}
+
+	if err == nil {
+		if err := yaml.UnmarshalStrict(raw, cfg); err != nil {
+			return nil, fmt.Errorf("unable to parse config file %q: %w", path, err)
+		}
+	}
+
+	if err := cfg.ApplyEnv(os.LookupEnv); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// Hash returns the SHA256 hash of the JSON representation of the configuration.
+func (c *Config) Hash() (string, error) {
+	raw, err := json.Marshal(c)
+	if err != nil {
+		return "", fmt.Errorf("marshal config: %w", err)
+	}
+
+	return fmt.Sprintf("%x", sha256.Sum256(raw)), nil
+}
@@ -0,0 +1,542 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cri-o/crio-credential-provider/pkg/auth"
+)
+
+func TestLoad(t *testing.T) {
+	t.Parallel()
+
+	for name, tc := range map[string]struct {
+		content string
+		missing bool
+		assert  func(*Config, error)
+	}{
+		"success missing file": {
+			missing: true,
+			assert: func(cfg *Config, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, Default(), cfg)
+			},
+		},
+		"success with timeouts": {
+			content: "authDir: /some/dir\ntimeouts:\n  secrets: 5s\n",
+			assert: func(cfg *Config, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, "/some/dir", cfg.AuthDir)
+				assert.Equal(t, RegistriesConfPath, cfg.RegistriesConfPath)
+				assert.Equal(t, 5*time.Second, cfg.Timeouts.Secrets.Duration)
+				assert.Equal(t, Default().Timeouts.Token, cfg.Timeouts.Token)
+			},
+		},
+		"success with registries conf dir": {
+			content: "registriesConfDirPath: /etc/containers/registries.conf.d\n",
+			assert: func(cfg *Config, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, "/etc/containers/registries.conf.d", cfg.RegistriesConfDirPath)
+			},
+		},
+		"failure on relative registries conf dir": {
+			content: "registriesConfDirPath: registries.conf.d\n",
+			assert: func(_ *Config, err error) {
+				require.ErrorIs(t, err, ErrRelativePath)
+				assert.ErrorContains(t, err, "registriesConfDirPath: ")
+			},
+		},
+		"failure on unknown field": {
+			content: "unknown: true\n",
+			assert: func(_ *Config, err error) {
+				require.Error(t, err)
+			},
+		},
+		"success with reference secret matching": {
+			content: "secretMatching: reference\n",
+			assert: func(cfg *Config, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, SecretMatchingReference, cfg.SecretMatching)
+			},
+		},
+		"failure on unknown secret matching": {
+			content: "secretMatching: wrong\n",
+			assert: func(_ *Config, err error) {
+				require.ErrorIs(t, err, ErrUnknownSecretMatching)
+			},
+		},
+		"failure on unknown auth format": {
+			content: "authFormat: wrong\n",
+			assert: func(_ *Config, err error) {
+				require.ErrorIs(t, err, ErrUnknownAuthFormat)
+			},
+		},
+		"success with credentials response mode": {
+			content: "responseMode: credentials\n",
+			assert: func(cfg *Config, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, ResponseModeCredentials, cfg.ResponseMode)
+				assert.Contains(t, cfg.Features(), "responseMode")
+			},
+		},
+		"failure on unknown response mode": {
+			content: "responseMode: wrong\n",
+			assert: func(_ *Config, err error) {
+				require.ErrorIs(t, err, ErrUnknownResponseMode)
+			},
+		},
+		"success with retention": {
+			content: "retention:\n  maxAge: 24h\n  maxPerNamespace: 10\n",
+			assert: func(cfg *Config, err error) {
+				require.NoError(t, err)
+				assert.True(t, cfg.Retention.Enabled())
+				assert.Equal(t, 24*time.Hour, cfg.Retention.MaxAge.Duration)
+				assert.Equal(t, 10, cfg.Retention.MaxPerNamespace)
+				assert.Zero(t, cfg.Retention.MaxTotalFiles)
+			},
+		},
+		"failure on negative retention": {
+			content: "retention:\n  maxTotalFiles: -1\n",
+			assert: func(_ *Config, err error) {
+				require.ErrorIs(t, err, ErrInvalidRetention)
+			},
+		},
+		"failure on negative secret size": {
+			content: "secrets:\n  maxSize: -1\n",
+			assert: func(_ *Config, err error) {
+				require.ErrorIs(t, err, ErrInvalidSecretSize)
+			},
+		},
+		"success with namespaces": {
+			content: "namespaces:\n  include: [team-*]\n  exclude: [team-legacy]\n",
+			assert: func(cfg *Config, err error) {
+				require.NoError(t, err)
+				assert.True(t, cfg.Namespaces.Allows("team-a"))
+				assert.False(t, cfg.Namespaces.Allows("team-legacy"))
+				assert.False(t, cfg.Namespaces.Allows("default"))
+				assert.Contains(t, cfg.Features(), "namespaces")
+			},
+		},
+		"success with excluded namespaces only": {
+			content: "namespaces:\n  exclude: [kube-*, openshift-*]\n",
+			assert: func(cfg *Config, err error) {
+				require.NoError(t, err)
+				assert.True(t, cfg.Namespaces.Allows("default"))
+				assert.False(t, cfg.Namespaces.Allows("kube-system"))
+			},
+		},
+		"failure on invalid namespace pattern": {
+			content: "namespaces:\n  exclude: [\"kube-[\"]\n",
+			assert: func(_ *Config, err error) {
+				require.ErrorIs(t, err, ErrInvalidPattern)
+				require.ErrorContains(t, err, "namespaces.exclude[0]")
+			},
+		},
+		"success with naming": {
+			content: "naming:\n  version: 2\n  algorithm: sha512\n  length: 32\n  registry: true\n",
+			assert: func(cfg *Config, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, auth.Naming{Version: auth.NamingVersion2, Algorithm: auth.HashSHA512, Length: 32, Registry: true}, cfg.Naming)
+				assert.Contains(t, cfg.Features(), "naming")
+			},
+		},
+		"failure on unsupported naming": {
+			content: "naming:\n  version: 1\n  length: 16\n",
+			assert: func(_ *Config, err error) {
+				require.ErrorIs(t, err, auth.ErrUnsupportedNaming)
+				require.ErrorContains(t, err, "naming")
+			},
+		},
+		"success with pod pull secrets": {
+			content: "secrets:\n  podPullSecrets: true\n",
+			assert: func(cfg *Config, err error) {
+				require.NoError(t, err)
+				assert.True(t, cfg.Secrets.PodPullSecrets)
+				assert.Contains(t, cfg.Features(), "secrets.podPullSecrets")
+			},
+		},
+		"success with versioned publication": {
+			content: "publication:\n  versioned: true\n  retainPrevious: 10m\n",
+			assert: func(cfg *Config, err error) {
+				require.NoError(t, err)
+				assert.True(t, cfg.Publication.Versioned)
+				assert.Equal(t, 10*time.Minute, cfg.Publication.RetainPrevious.Duration)
+				assert.Contains(t, cfg.Features(), "publication.versioned")
+			},
+		},
+		"failure on negative previous version retention": {
+			content: "publication:\n  retainPrevious: -1m\n",
+			assert: func(_ *Config, err error) {
+				require.ErrorIs(t, err, ErrNegativeDuration)
+				require.ErrorContains(t, err, "publication.retainPrevious")
+			},
+		},
+		"success with lease lock": {
+			content: "coordination:\n  owner: node-a\n  lock: lease\n  leaseTTL: 1m\n",
+			assert: func(cfg *Config, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, LockLease, cfg.Coordination.Lock)
+				assert.Equal(t, time.Minute, cfg.Coordination.LeaseTTL.Duration)
+			},
+		},
+		"success with mirror probe": {
+			content: "sources:\n  probe:\n    enabled: true\n    skipUnreachable: true\n",
+			assert: func(cfg *Config, err error) {
+				require.NoError(t, err)
+				assert.True(t, cfg.Sources.Probe.SkipUnreachable)
+				assert.Equal(t, 500*time.Millisecond, cfg.Sources.Probe.Timeout.Duration)
+				assert.Contains(t, cfg.Features(), "sources.probe")
+			},
+		},
+		"success with runtime socket": {
+			content: "sources:\n  runtimeSocket: /var/run/crio/crio.sock\n",
+			assert: func(cfg *Config, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, "/var/run/crio/crio.sock", cfg.Sources.RuntimeSocket)
+				assert.Contains(t, cfg.Features(), "sources.runtimeSocket")
+			},
+		},
+		"failure on relative runtime socket": {
+			content: "sources:\n  runtimeSocket: crio.sock\n",
+			assert: func(_ *Config, err error) {
+				require.ErrorIs(t, err, ErrRelativePath)
+			},
+		},
+		"success with webhooks": {
+			content: "webhooks:\n  preWrite:\n    url: https://approval.example.com\n    certFile: /etc/crio/webhook.crt\n    keyFile: /etc/crio/webhook.key\n",
+			assert: func(cfg *Config, err error) {
+				require.NoError(t, err)
+				assert.True(t, cfg.Webhooks.PreWrite.Enabled())
+				assert.Equal(t, 5*time.Second, cfg.Webhooks.PreWrite.Timeout.Duration)
+				assert.Contains(t, cfg.Features(), "webhooks.preWrite")
+				assert.NotContains(t, cfg.Features(), "webhooks.postWrite")
+			},
+		},
+		"failure on invalid webhook": {
+			content: "webhooks:\n  postWrite:\n    url: approval.example.com\n    certFile: /etc/crio/webhook.crt\n    failurePolicy: wrong\n",
+			assert: func(_ *Config, err error) {
+				require.ErrorIs(t, err, ErrInvalidEndpoint)
+				require.ErrorIs(t, err, ErrMissingValue)
+				require.ErrorIs(t, err, ErrUnknownFailurePolicy)
+				require.ErrorContains(t, err, "webhooks.postWrite.keyFile")
+			},
+		},
+		"success with merge": {
+			content: "merge:\n  enabled: true\n",
+			assert: func(cfg *Config, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, MergeConflictNewest, cfg.Merge.Policy())
+				assert.Contains(t, cfg.Features(), "merge")
+			},
+		},
+		"failure on unknown merge conflict policy": {
+			content: "merge:\n  enabled: true\n  conflict: wrong\n",
+			assert: func(_ *Config, err error) {
+				require.ErrorIs(t, err, ErrUnknownMergeConflict)
+			},
+		},
+		"failure on unknown lock": {
+			content: "coordination:\n  lock: wrong\n",
+			assert: func(_ *Config, err error) {
+				require.ErrorIs(t, err, ErrUnknownLock)
+			},
+		},
+		"success with log level and format": {
+			content: "logging:\n  level: debug\n  format: json\n",
+			assert: func(cfg *Config, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, LogLevelDebug, cfg.Logging.Level)
+				assert.Equal(t, LogFormatJSON, cfg.Logging.Format)
+			},
+		},
+		"failure on unknown log level": {
+			content: "logging:\n  level: verbose\n",
+			assert: func(_ *Config, err error) {
+				require.ErrorIs(t, err, ErrUnknownLogLevel)
+			},
+		},
+		"failure on unknown log format": {
+			content: "logging:\n  format: xml\n",
+			assert: func(_ *Config, err error) {
+				require.ErrorIs(t, err, ErrUnknownLogFormat)
+			},
+		},
+		"success with shared secrets": {
+			content: "secrets:\n  shared:\n    namespace: pull-secrets\n    consumers: [team-*, ci]\n",
+			assert: func(cfg *Config, err error) {
+				require.NoError(t, err)
+				assert.True(t, cfg.Secrets.Shared.Allows("team-a"))
+				assert.True(t, cfg.Secrets.Shared.Allows("ci"))
+				assert.False(t, cfg.Secrets.Shared.Allows("other"))
+				assert.False(t, cfg.Secrets.Shared.Allows("pull-secrets"))
+			},
+		},
+		"failure on shared secrets without consumers": {
+			content: "secrets:\n  shared:\n    namespace: pull-secrets\n",
+			assert: func(_ *Config, err error) {
+				require.ErrorIs(t, err, ErrMissingValue)
+				require.ErrorContains(t, err, "secrets.shared.consumers")
+			},
+		},
+		"failure on invalid shared secrets consumer": {
+			content: "secrets:\n  shared:\n    namespace: pull-secrets\n    consumers: [\"team-[\"]\n",
+			assert: func(_ *Config, err error) {
+				require.ErrorIs(t, err, ErrInvalidPattern)
+			},
+		},
+		"failure on invalid write concurrency": {
+			content: "daemon:\n  namespaceWriteConcurrency: 0\n",
+			assert: func(_ *Config, err error) {
+				require.ErrorIs(t, err, ErrInvalidWriteConcurrency)
+			},
+		},
+		"failure on invalid admission": {
+			content: "admission:\n  maxInFlight: -1\n  dir: relative\n",
+			assert: func(_ *Config, err error) {
+				require.ErrorIs(t, err, ErrInvalidMaxInFlight)
+				require.ErrorIs(t, err, ErrRelativePath)
+			},
+		},
+		"failure on multiple problems": {
+			content: "authDir: relative\nauthFormat: wrong\ntimeouts:\n  token: -1s\nlogging:\n  otlpEndpoint: localhost:4318\n",
+			assert: func(_ *Config, err error) {
+				require.ErrorIs(t, err, ErrRelativePath)
+				require.ErrorIs(t, err, ErrUnknownAuthFormat)
+				require.ErrorIs(t, err, ErrNegativeDuration)
+				require.ErrorIs(t, err, ErrInvalidEndpoint)
+				assert.Len(t, Problems(err), 4)
+				assert.ErrorContains(t, err, "authDir: ")
+				assert.ErrorContains(t, err, "timeouts.token: ")
+			},
+		},
+		"failure on negative run timeout": {
+			content: "timeouts:\n  run: -1s\n",
+			assert: func(_ *Config, err error) {
+				require.ErrorIs(t, err, ErrNegativeDuration)
+				assert.ErrorContains(t, err, "timeouts.run: ")
+			},
+		},
+		"success with token sources": {
+			content: "token:\n  sources:\n  - type: file\n    path: /token\n  - type: tokenRequest\n    namespace: ns\n    serviceAccount: sa\n",
+			assert: func(cfg *Config, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, []TokenSource{
+					{Type: TokenSourceFile, Path: "/token"},
+					{Type: TokenSourceTokenRequest, Namespace: "ns", ServiceAccount: "sa"},
+				}, cfg.Token.Sources)
+			},
+		},
+		"failure on invalid token sources": {
+			content: "token:\n  sources:\n  - type: wrong\n  - type: tokenRequest\n",
+			assert: func(_ *Config, err error) {
+				require.ErrorIs(t, err, ErrUnknownTokenSource)
+				require.ErrorIs(t, err, ErrMissingValue)
+				assert.ErrorContains(t, err, "token.sources[1].serviceAccount: ")
+			},
+		},
+		"failure on invalid token issuers": {
+			content: "token:\n  issuers:\n  - issuer: https://a\n    jwksURI: http://a/jwks\n  - issuer: https://a\n    caFile: ca.pem\n  - jwksURI: https://b/jwks\n",
+			assert: func(_ *Config, err error) {
+				require.ErrorIs(t, err, ErrInvalidEndpoint)
+				require.ErrorIs(t, err, ErrDuplicateIssuer)
+				require.ErrorIs(t, err, ErrRelativePath)
+				require.ErrorIs(t, err, ErrMissingValue)
+				assert.Len(t, Problems(err), 4)
+				assert.ErrorContains(t, err, "token.issuers[2].issuer: ")
+			},
+		},
+		"failure on invalid registry TTLs": {
+			content: "retention:\n  registryTTLs:\n  - registry: mirror.example.com\n    ttl: -1h\n  - ttl: 1h\n  - registry: '*.azurecr.io'\n",
+			assert: func(_ *Config, err error) {
+				require.ErrorIs(t, err, ErrNegativeDuration)
+				require.ErrorIs(t, err, ErrMissingValue)
+				assert.Len(t, Problems(err), 3)
+				assert.ErrorContains(t, err, "retention.registryTTLs[1].registry: ")
+				assert.ErrorContains(t, err, "retention.registryTTLs[2].ttl: ")
+			},
+		},
+		"failure on invalid claim mapping": {
+			content: "token:\n  claimMapping:\n    pod: [ext, '']\n",
+			assert: func(_ *Config, err error) {
+				require.ErrorIs(t, err, ErrMissingValue)
+				assert.Len(t, Problems(err), 2)
+				assert.ErrorContains(t, err, "token.claimMapping.namespace: ")
+				assert.ErrorContains(t, err, "token.claimMapping.pod: ")
+			},
+		},
+		"failure on invalid outputs": {
+			content: "outputs:\n- dir: /etc/crio/auth/\n- dir: /var/lib/buildkit/auth\n  format: wrong\n  mode: '0999'\n- dir: relative\n",
+			assert: func(_ *Config, err error) {
+				require.ErrorIs(t, err, ErrDuplicateOutput)
+				require.ErrorIs(t, err, ErrUnknownAuthFormat)
+				require.ErrorIs(t, err, ErrInvalidMode)
+				require.ErrorIs(t, err, ErrRelativePath)
+				assert.Len(t, Problems(err), 4)
+			},
+		},
+		"failure on token exchange without docker format": {
+			content: "tokenExchange:\n  registries: [quay.io, '']\noutputs:\n- dir: /var/lib/buildkit/auth\n  format: docker\n- dir: /var/lib/other/auth\n  format: auth.json\n",
+			assert: func(_ *Config, err error) {
+				require.ErrorIs(t, err, ErrTokenExchangeFormat)
+				require.ErrorIs(t, err, ErrMissingValue)
+				assert.Len(t, Problems(err), 3)
+			},
+		},
+		"failure on invalid token audiences": {
+			content: "authFormat: docker\ntokenExchange:\n  audiences:\n  - registry: quay.io\n  - audience: registry\n  kubeconfig: relative\n",
+			assert: func(_ *Config, err error) {
+				require.ErrorIs(t, err, ErrMissingValue)
+				require.ErrorIs(t, err, ErrRelativePath)
+				assert.ErrorContains(t, err, "tokenExchange.audiences[0].audience: ")
+				assert.ErrorContains(t, err, "tokenExchange.audiences[1].registry: ")
+				assert.Len(t, Problems(err), 3)
+			},
+		},
+		"failure on invalid registry TLS": {
+			content: "registryTLS:\n- registry: quay.io\n  certFile: relative\n- registry: registry.example.com\n  certFile: /etc/crio/tls.crt\n  keyFile: /etc/crio/tls.key\n  secret:\n    namespace: kube-system\n- secret:\n    name: registry-tls\n",
+			assert: func(_ *Config, err error) {
+				require.ErrorIs(t, err, ErrMissingValue)
+				require.ErrorIs(t, err, ErrRelativePath)
+				require.ErrorIs(t, err, ErrAmbiguousClientCertificate)
+				assert.ErrorContains(t, err, "registryTLS[0].keyFile: ")
+				assert.ErrorContains(t, err, "registryTLS[1].secret.name: ")
+				assert.ErrorContains(t, err, "registryTLS[2].registry: ")
+				assert.ErrorContains(t, err, "registryTLS[2].secret.namespace: ")
+				assert.Len(t, Problems(err), 6)
+			},
+		},
+		"failure on invalid duration": {
+			content: "timeouts:\n  write: wrong\n",
+			assert: func(_ *Config, err error) {
+				require.Error(t, err)
+			},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			if !tc.missing {
+				require.NoError(t, os.WriteFile(path, []byte(tc.content), 0o600))
+			}
+
+			cfg, err := Load(path)
+			tc.assert(cfg, err)
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	for name, tc := range map[string]struct {
+		prepare func(*Config)
+		assert  func(error)
+	}{
+		"success with non existing paths": {
+			prepare: func(*Config) {},
+			assert: func(err error) {
+				require.NoError(t, err)
+			},
+		},
+		"failure on insecure integrity key": {
+			prepare: func(cfg *Config) {
+				require.NoError(t, os.WriteFile(cfg.IntegrityKeyPath, []byte("key"), 0o600))
+				require.NoError(t, os.Chmod(cfg.IntegrityKeyPath, 0o644))
+			},
+			assert: func(err error) {
+				require.ErrorIs(t, err, ErrInsecurePermissions)
+				assert.ErrorContains(t, err, "integrityKeyPath: ")
+			},
+		},
+		"failure on auth dir not being a directory": {
+			prepare: func(cfg *Config) {
+				require.NoError(t, os.WriteFile(cfg.AuthDir, nil, 0o600))
+			},
+			assert: func(err error) {
+				require.ErrorIs(t, err, ErrNotDirectory)
+			},
+		},
+		"failure on insecure registries conf dir": {
+			prepare: func(cfg *Config) {
+				cfg.RegistriesConfDirPath = filepath.Join(filepath.Dir(cfg.AuthDir), "registries.conf.d")
+				require.NoError(t, os.MkdirAll(cfg.RegistriesConfDirPath, 0o700))
+				require.NoError(t, os.Chmod(cfg.RegistriesConfDirPath, 0o777))
+			},
+			assert: func(err error) {
+				require.ErrorIs(t, err, ErrInsecurePermissions)
+				assert.ErrorContains(t, err, "registriesConfDirPath: ")
+			},
+		},
+		"failure on missing static secrets dir": {
+			prepare: func(cfg *Config) {
+				cfg.StaticSecretsDir = filepath.Join(filepath.Dir(cfg.AuthDir), "secrets")
+			},
+			assert: func(err error) {
+				require.ErrorIs(t, err, os.ErrNotExist)
+			},
+		},
+		"failure on values and permissions": {
+			prepare: func(cfg *Config) {
+				cfg.AuthFormat = "wrong"
+				require.NoError(t, os.MkdirAll(cfg.AuthDir, 0o700))
+				require.NoError(t, os.Chmod(cfg.AuthDir, 0o777))
+			},
+			assert: func(err error) {
+				require.ErrorIs(t, err, ErrUnknownAuthFormat)
+				require.ErrorIs(t, err, ErrInsecurePermissions)
+				assert.Len(t, Problems(err), 2)
+			},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			cfg := Default()
+			cfg.RegistriesConfPath = filepath.Join(dir, "registries.conf")
+			cfg.AuthDir = filepath.Join(dir, "auth")
+			cfg.IntegrityKeyPath = filepath.Join(dir, "integrity.key")
+			cfg.StateFile = filepath.Join(dir, "state.json")
+
+			tc.prepare(cfg)
+			tc.assert(cfg.Validate())
+		})
+	}
+}
+
+func TestHash(t *testing.T) {
+	t.Parallel()
+
+	first, err := Default().Hash()
+	require.NoError(t, err)
+
+	second, err := Default().Hash()
+	require.NoError(t, err)
+	assert.Equal(t, first, second)
+
+	cfg := Default()
+	cfg.AuthDir = "/other"
+
+	third, err := cfg.Hash()
+	require.NoError(t, err)
+	assert.NotEqual(t, first, third)
+}
+
+func TestFeatures(t *testing.T) {
+	t.Parallel()
+
+	assert.Empty(t, Default().Features())
+
+	cfg := Default()
+	cfg.Secrets.Opaque = true
+	cfg.Retention.MaxTotalFiles = 10
+	cfg.HashNamespaces = true
+
+	assert.Equal(t, []string{"hashNamespaces", "retention", "secrets.opaque"}, cfg.Features())
+}
@@ -0,0 +1,154 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+// EnvPrefix is the prefix of the environment variables overriding the
+// configuration.
+const EnvPrefix = "CRIO_CREDENTIAL_PROVIDER_"
+
+// EnvOverrides are the configuration paths which can be overridden by the
+// environment variables, keyed by the variable name without EnvPrefix. The
+// names match the ones of the dedicated override flags, which allows passing
+// them by the env of the kubelet credential provider configuration instead.
+var EnvOverrides = map[string]string{
+	"APISERVER":           "apiServer.host",
+	"AUTH_DIR":            "authDir",
+	"REGISTRIES_CONF":     "registriesConfPath",
+	"REGISTRIES_CONF_DIR": "registriesConfDirPath",
+	"KUBELET_AUTH_FILE":   "kubeletAuthFilePath",
+	"APISERVER_ENV_DIR":   "kubernetesConfigDir",
+	"INSECURE_API_SERVER": "apiServer.insecure",
+	"LOG_LEVEL":           "logging.level",
+	"LOG_FORMAT":          "logging.format",
+	"TIMEOUT":             "timeouts.run",
+}
+
+// envParsers parse the values of the EnvOverrides which are not strings, while
+// the values of all others are assigned literally.
+var envParsers = map[string]func(string) (any, error){
+	"INSECURE_API_SERVER": parseYAML,
+	"TIMEOUT":             parseDuration,
+}
+
+// parseYAML parses the value as YAML.
+func parseYAML(rawValue string) (any, error) {
+	var value any
+	if err := yaml.Unmarshal([]byte(rawValue), &value); err != nil {
+		return nil, fmt.Errorf("parse value: %w", err)
+	}
+
+	return value, nil
+}
+
+// parseDuration parses the value like the --timeout flag, which accepts a
+// bare "0" as well.
+func parseDuration(rawValue string) (any, error) {
+	d, err := time.ParseDuration(rawValue)
+	if err != nil {
+		return nil, fmt.Errorf("parse duration: %w", err)
+	}
+
+	return d.String(), nil
+}
+
+// ApplyEnv overrides the values of the configuration by the set environment
+// variables of EnvOverrides, which get looked up by using lookupEnv. Empty
+// variables are ignored.
+func (c *Config) ApplyEnv(lookupEnv func(string) (string, bool)) error {
+	for _, name := range slices.Sorted(maps.Keys(EnvOverrides)) {
+		rawValue, ok := lookupEnv(EnvPrefix + name)
+		if !ok || rawValue == "" {
+			continue
+		}
+
+		var value any = rawValue
+		if parse, ok := envParsers[name]; ok {
+			parsed, err := parse(rawValue)
+			if err != nil {
+				return fmt.Errorf("environment variable %s%s: %w: %w", EnvPrefix, name, ErrInvalidOverride, err)
+			}
+
+			value = parsed
+		}
+
+		if err := c.set(EnvOverrides[name], value); err != nil {
+			return fmt.Errorf("environment variable %s%s: %w", EnvPrefix, name, err)
+		}
+	}
+
+	return nil
+}
+
+// ApplyProfile merges the named profile of the configuration over it.
+func (c *Config) ApplyProfile(name string) error {
+	profile, ok := c.Profiles[name]
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownProfile, name)
+	}
+
+	if err := decodeStrict(profile, c); err != nil {
+		return fmt.Errorf("apply profile %q: %w", name, err)
+	}
+
+	return nil
+}
+
+// Set overrides a single value of the configuration by an assignment of the
+// form "path=value", where the path uses the field names of the configuration
+// file separated by dots, like "secrets.opaque=true". The value gets parsed as
+// YAML, which allows setting lists like "claims.patterns=[quay.io]".
+func (c *Config) Set(assignment string) error {
+	path, rawValue, ok := strings.Cut(assignment, "=")
+	if !ok || path == "" {
+		return fmt.Errorf("%w: %q is not of the form path=value", ErrInvalidOverride, assignment)
+	}
+
+	var value any
+	if err := yaml.Unmarshal([]byte(rawValue), &value); err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrInvalidOverride, path, err)
+	}
+
+	return c.set(path, value)
+}
+
+// set overrides the value at the dot separated path of the configuration.
+func (c *Config) set(path string, value any) error {
+	keys := strings.Split(path, ".")
+	for i := len(keys) - 1; i >= 0; i-- {
+		value = map[string]any{keys[i]: value}
+	}
+
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrInvalidOverride, path, err)
+	}
+
+	if err := decodeStrict(raw, c); err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrInvalidOverride, path, err)
+	}
+
+	return nil
+}
+
+// decodeStrict merges the JSON document over the configuration while
+// rejecting unknown fields.
+func decodeStrict(raw []byte, c *Config) error {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(c); err != nil {
+		return fmt.Errorf("decode: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,210 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyProfile(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+secrets:
+  maxSize: 10
+profiles:
+  restricted:
+    secretMatching: reference
+    secrets:
+      strict: true
+`), 0o600))
+
+	cfg, err := Load(path)
+	require.NoError(t, err)
+
+	require.NoError(t, cfg.ApplyProfile("restricted"))
+	assert.Equal(t, SecretMatchingReference, cfg.SecretMatching)
+	assert.True(t, cfg.Secrets.Strict)
+	assert.Equal(t, 10, cfg.Secrets.MaxSize, "unset values are kept")
+
+	require.ErrorIs(t, cfg.ApplyProfile("unknown"), ErrUnknownProfile)
+}
+
+func TestSet(t *testing.T) {
+	t.Parallel()
+
+	for name, tc := range map[string]struct {
+		assignment string
+		assert     func(*Config)
+		err        error
+	}{
+		"success string": {
+			assignment: "authDir=/var/run/auth",
+			assert: func(cfg *Config) {
+				assert.Equal(t, "/var/run/auth", cfg.AuthDir)
+			},
+		},
+		"success nested bool": {
+			assignment: "secrets.opaque=true",
+			assert: func(cfg *Config) {
+				assert.True(t, cfg.Secrets.Opaque)
+				assert.Equal(t, DefaultSecretMaxSize, cfg.Secrets.MaxSize)
+			},
+		},
+		"success duration": {
+			assignment: "token.leeway=30s",
+			assert: func(cfg *Config) {
+				assert.Equal(t, 30*time.Second, cfg.Token.Leeway.Duration)
+			},
+		},
+		"success list": {
+			assignment: "claims.patterns=[quay.io, '*.example.com']",
+			assert: func(cfg *Config) {
+				assert.Equal(t, []string{"quay.io", "*.example.com"}, cfg.Claims.Patterns)
+			},
+		},
+		"failure on missing value": {
+			assignment: "secrets.opaque",
+			err:        ErrInvalidOverride,
+		},
+		"failure on unknown field": {
+			assignment: "secrets.unknown=true",
+			err:        ErrInvalidOverride,
+		},
+		"failure on wrong type": {
+			assignment: "secrets.maxSize=large",
+			err:        ErrInvalidOverride,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := Default()
+
+			err := cfg.Set(tc.assignment)
+			if tc.err != nil {
+				require.ErrorIs(t, err, tc.err)
+
+				return
+			}
+
+			require.NoError(t, err)
+			tc.assert(cfg)
+		})
+	}
+}
+
+func TestValidateProfiles(t *testing.T) {
+	t.Parallel()
+
+	cfg := Default()
+	cfg.Profiles = map[string]json.RawMessage{
+		"valid":   json.RawMessage(`{"secrets":{"strict":true}}`),
+		"invalid": json.RawMessage(`{"secrets":{"unknown":true}}`),
+	}
+
+	problems := Problems(cfg.validate())
+	require.Len(t, problems, 1)
+	assert.ErrorContains(t, problems[0], "profiles.invalid: ")
+}
+
+func TestApplyEnv(t *testing.T) {
+	t.Parallel()
+
+	for name, tc := range map[string]struct {
+		env    map[string]string
+		assert func(*Config)
+		err    error
+	}{
+		"success": {
+			env: map[string]string{
+				EnvPrefix + "AUTH_DIR":            "/var/run/auth",
+				EnvPrefix + "INSECURE_API_SERVER": "true",
+				EnvPrefix + "TIMEOUT":             "30s",
+				EnvPrefix + "LOG_LEVEL":           "",
+				"AUTH_DIR":                        "/ignored",
+			},
+			assert: func(cfg *Config) {
+				assert.Equal(t, "/var/run/auth", cfg.AuthDir)
+				assert.True(t, cfg.APIServer.Insecure)
+				assert.Equal(t, 30*time.Second, cfg.Timeouts.Run.Duration)
+				assert.Empty(t, cfg.Logging.Level)
+			},
+		},
+		"success with special characters": {
+			env: map[string]string{
+				EnvPrefix + "AUTH_DIR":          "/var/run/a: b #c/{d}/[e]",
+				EnvPrefix + "KUBELET_AUTH_FILE": "yes",
+				EnvPrefix + "APISERVER":         "https://api.example.com:6443",
+			},
+			assert: func(cfg *Config) {
+				assert.Equal(t, "/var/run/a: b #c/{d}/[e]", cfg.AuthDir)
+				assert.Equal(t, "yes", cfg.KubeletAuthFilePath)
+				assert.Equal(t, "https://api.example.com:6443", cfg.APIServer.Host)
+			},
+		},
+		"success with zero timeout": {
+			env: map[string]string{EnvPrefix + "TIMEOUT": "0"},
+			assert: func(cfg *Config) {
+				assert.Equal(t, time.Duration(0), cfg.Timeouts.Run.Duration)
+			},
+		},
+		"success with timeout": {
+			env: map[string]string{EnvPrefix + "TIMEOUT": "1m30s"},
+			assert: func(cfg *Config) {
+				assert.Equal(t, 90*time.Second, cfg.Timeouts.Run.Duration)
+			},
+		},
+		"failure on invalid timeout": {
+			env: map[string]string{EnvPrefix + "TIMEOUT": "long"},
+			err: ErrInvalidOverride,
+		},
+		"failure on timeout without unit": {
+			env: map[string]string{EnvPrefix + "TIMEOUT": "30"},
+			err: ErrInvalidOverride,
+		},
+		"failure on invalid bool": {
+			env: map[string]string{EnvPrefix + "INSECURE_API_SERVER": "[true"},
+			err: ErrInvalidOverride,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := Default()
+
+			err := cfg.ApplyEnv(func(key string) (string, bool) {
+				value, ok := tc.env[key]
+
+				return value, ok
+			})
+			if tc.err != nil {
+				require.ErrorIs(t, err, tc.err)
+
+				return
+			}
+
+			require.NoError(t, err)
+			tc.assert(cfg)
+		})
+	}
+}
+
+//nolint:paralleltest // modifies the environment
+func TestLoadWithEnv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("authDir: /from/file\nkubeletAuthFilePath: /from/file.json\n"), 0o600))
+
+	t.Setenv(EnvPrefix+"AUTH_DIR", "/from/env")
+
+	cfg, err := Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, "/from/env", cfg.AuthDir, "the environment overrides the file")
+	assert.Equal(t, "/from/file.json", cfg.KubeletAuthFilePath)
+}
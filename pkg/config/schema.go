@@ -0,0 +1,112 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// schemaEnums are the supported values of the enumerated configuration
+// values by their path.
+var schemaEnums = map[string][]string{
+	"secretMatching":     SecretMatchingModes,
+	"authFormat":         AuthFormats,
+	"responseMode":       ResponseModes,
+	"coordination.lock":  Locks,
+	"token.sources.type": TokenSourceTypes,
+	"logging.level":      LogLevels,
+	"logging.format":     LogFormats,
+}
+
+// Schema returns the JSON schema of the configuration file, including the
+// default values and the supported values of enumerations.
+func Schema() ([]byte, error) {
+	schema := schemaOf(reflect.TypeFor[Config](), reflect.ValueOf(*Default()), "")
+	schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	schema["title"] = "CRI-O credential provider configuration"
+
+	raw, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("marshal schema: %w", err)
+	}
+
+	return raw, nil
+}
+
+// schemaOf returns the schema of the type t with the default value def, where
+// path is the configuration path used to look up enumerations.
+func schemaOf(t reflect.Type, def reflect.Value, path string) map[string]any {
+	schema := map[string]any{}
+
+	if t == reflect.TypeFor[metav1.Duration]() {
+		schema["type"] = "string"
+		schema["description"] = "Duration like \"1m30s\"."
+
+		if !def.IsZero() {
+			schema["default"] = def.Interface().(metav1.Duration).Duration.String() //nolint:forcetypeassert // checked by the type
+		}
+
+		return schema
+	}
+
+	if t == reflect.TypeFor[map[string]json.RawMessage]() {
+		// Profiles are partial configurations
+		schema["type"] = "object"
+		schema["additionalProperties"] = map[string]any{"$ref": "#"}
+
+		return schema
+	}
+
+	switch t.Kind() { //nolint:exhaustive // other kinds are not used by the configuration
+	case reflect.Struct:
+		properties := map[string]any{}
+
+		for i := range t.NumField() {
+			field := t.Field(i)
+
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if !field.IsExported() || name == "" || name == "-" {
+				continue
+			}
+
+			fieldPath := name
+			if path != "" {
+				fieldPath = path + "." + name
+			}
+
+			properties[name] = schemaOf(field.Type, def.Field(i), fieldPath)
+		}
+
+		schema["type"] = "object"
+		schema["properties"] = properties
+		schema["additionalProperties"] = false
+
+		return schema
+
+	case reflect.Slice:
+		schema["type"] = "array"
+		schema["items"] = schemaOf(t.Elem(), reflect.Zero(t.Elem()), path)
+
+	case reflect.String:
+		schema["type"] = "string"
+
+		if enum, ok := schemaEnums[path]; ok {
+			schema["enum"] = enum
+		}
+
+	case reflect.Bool:
+		schema["type"] = "boolean"
+
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64:
+		schema["type"] = "integer"
+	}
+
+	if !def.IsZero() {
+		schema["default"] = def.Interface()
+	}
+
+	return schema
+}
@@ -0,0 +1,58 @@
+package config
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchema(t *testing.T) {
+	t.Parallel()
+
+	raw, err := Schema()
+	require.NoError(t, err)
+
+	type schema struct {
+		Type                 string             `json:"type"`
+		Properties           map[string]*schema `json:"properties"`
+		Items                *schema            `json:"items"`
+		Enum                 []string           `json:"enum"`
+		Default              any                `json:"default"`
+		AdditionalProperties any                `json:"additionalProperties"`
+	}
+
+	res := &schema{}
+	require.NoError(t, json.Unmarshal(raw, res))
+
+	assert.Equal(t, "object", res.Type)
+	assert.Equal(t, false, res.AdditionalProperties)
+
+	authFormat := res.Properties["authFormat"]
+	require.NotNil(t, authFormat)
+	assert.Equal(t, "string", authFormat.Type)
+	assert.Equal(t, AuthFormats, authFormat.Enum)
+	assert.Equal(t, AuthFormatAuthJSON, authFormat.Default)
+
+	assert.Equal(t, "boolean", res.Properties["hashNamespaces"].Type)
+	assert.Nil(t, res.Properties["hashNamespaces"].Default)
+
+	maxSize := res.Properties["secrets"].Properties["maxSize"]
+	assert.Equal(t, "integer", maxSize.Type)
+	assert.InDelta(t, DefaultSecretMaxSize, maxSize.Default, 0)
+
+	leeway := res.Properties["token"].Properties["leeway"]
+	assert.Equal(t, "string", leeway.Type)
+	assert.Equal(t, "1m0s", leeway.Default)
+
+	sources := res.Properties["token"].Properties["sources"]
+	assert.Equal(t, "array", sources.Type)
+	require.NotNil(t, sources.Items)
+	assert.Equal(t, TokenSourceTypes, sources.Items.Properties["type"].Enum)
+	assert.Equal(t, []any{map[string]any{"type": TokenSourceRequest}}, sources.Default)
+
+	profiles := res.Properties["profiles"]
+	assert.Equal(t, "object", profiles.Type)
+	assert.Equal(t, map[string]any{"$ref": "#"}, profiles.AdditionalProperties)
+}
@@ -0,0 +1,517 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// validate checks the values of the configuration and returns all problems
+// at once, prefixed with their field path.
+func (c *Config) validate() error {
+	return errors.Join(c.valueProblems()...)
+}
+
+// Validate checks the values of the configuration as well as the permissions
+// of the already existing configured files and directories. All problems get
+// returned at once, prefixed with their field path.
+func (c *Config) Validate() error {
+	return errors.Join(append(c.valueProblems(), c.permissionProblems()...)...)
+}
+
+// Problems returns the single problems of an error returned by Load or Validate.
+func Problems(err error) []error {
+	var joined interface{ Unwrap() []error }
+	if errors.As(err, &joined) {
+		return joined.Unwrap()
+	}
+
+	if err != nil {
+		return []error{err}
+	}
+
+	return nil
+}
+
+func (c *Config) valueProblems() []error {
+	var errs []error
+
+	addErr := func(path string, err error) {
+		errs = append(errs, fmt.Errorf("%s: %w", path, err))
+	}
+
+	switch c.SecretMatching {
+	case SecretMatchingPrefix, SecretMatchingReference:
+	default:
+		addErr("secretMatching", fmt.Errorf("%w: %q", ErrUnknownSecretMatching, c.SecretMatching))
+	}
+
+	switch c.AuthFormat {
+	case AuthFormatAuthJSON, AuthFormatDocker, AuthFormatContainerd:
+	default:
+		addErr("authFormat", fmt.Errorf("%w: %q", ErrUnknownAuthFormat, c.AuthFormat))
+	}
+
+	if c.Logging.Level != "" && !slices.Contains(LogLevels, c.Logging.Level) {
+		addErr("logging.level", fmt.Errorf("%w: %q", ErrUnknownLogLevel, c.Logging.Level))
+	}
+
+	if c.Logging.Format != "" && !slices.Contains(LogFormats, c.Logging.Format) {
+		addErr("logging.format", fmt.Errorf("%w: %q", ErrUnknownLogFormat, c.Logging.Format))
+	}
+
+	switch c.Merge.Conflict {
+	case "", MergeConflictNewest, MergeConflictExisting:
+	default:
+		addErr("merge.conflict", fmt.Errorf("%w: %q", ErrUnknownMergeConflict, c.Merge.Conflict))
+	}
+
+	if err := c.Naming.Validate(); err != nil {
+		addErr("naming", err)
+	}
+
+	switch c.ResponseMode {
+	case ResponseModeEmpty, ResponseModeCredentials:
+	default:
+		addErr("responseMode", fmt.Errorf("%w: %q", ErrUnknownResponseMode, c.ResponseMode))
+	}
+
+	dirs := []string{filepath.Clean(c.AuthDir)}
+
+	for i := range c.Outputs {
+		output := &c.Outputs[i]
+		path := fmt.Sprintf("outputs[%d]", i)
+
+		switch {
+		case !filepath.IsAbs(output.Dir):
+			addErr(path+".dir", fmt.Errorf("%w: %q", ErrRelativePath, output.Dir))
+		case slices.Contains(dirs, filepath.Clean(output.Dir)):
+			addErr(path+".dir", fmt.Errorf("%w: %q", ErrDuplicateOutput, output.Dir))
+		}
+
+		dirs = append(dirs, filepath.Clean(output.Dir))
+
+		switch output.Format {
+		case "", AuthFormatAuthJSON, AuthFormatDocker, AuthFormatContainerd:
+		default:
+			addErr(path+".format", fmt.Errorf("%w: %q", ErrUnknownAuthFormat, output.Format))
+		}
+
+		if _, err := output.FileMode(); err != nil {
+			addErr(path+".mode", err)
+		}
+	}
+
+	if c.TokenExchange.Enabled() {
+		if c.AuthFormat != AuthFormatDocker {
+			addErr("authFormat", fmt.Errorf("%w: %q", ErrTokenExchangeFormat, c.AuthFormat))
+		}
+
+		for i := range c.Outputs {
+			if format := c.Outputs[i].Format; format != "" && format != AuthFormatDocker {
+				addErr(fmt.Sprintf("outputs[%d].format", i), fmt.Errorf("%w: %q", ErrTokenExchangeFormat, format))
+			}
+		}
+
+		for i, registry := range c.TokenExchange.Registries {
+			if registry == "" {
+				addErr(fmt.Sprintf("tokenExchange.registries[%d]", i), ErrMissingValue)
+			}
+		}
+
+		for i := range c.TokenExchange.Audiences {
+			audience := &c.TokenExchange.Audiences[i]
+			path := fmt.Sprintf("tokenExchange.audiences[%d]", i)
+
+			if audience.Registry == "" {
+				addErr(path+".registry", ErrMissingValue)
+			}
+
+			if audience.Audience == "" {
+				addErr(path+".audience", ErrMissingValue)
+			}
+		}
+	}
+
+	for _, p := range []struct {
+		path     string
+		value    string
+		optional bool
+	}{
+		{path: "registriesConfPath", value: c.RegistriesConfPath},
+		{path: "registriesConfDirPath", value: c.RegistriesConfDirPath, optional: true},
+		{path: "authDir", value: c.AuthDir},
+		{path: "kubeletAuthFilePath", value: c.KubeletAuthFilePath},
+		{path: "kubernetesConfigDir", value: c.KubernetesConfigDir},
+		{path: "staticSecretsDir", value: c.StaticSecretsDir, optional: true},
+		{path: "diagnosticsDir", value: c.DiagnosticsDir},
+		{path: "integrityKeyPath", value: c.IntegrityKeyPath},
+		{path: "stateFile", value: c.StateFile},
+		{path: "logging.jsonlFile", value: c.Logging.JSONLFile, optional: true},
+		{path: "sources.policyPath", value: c.Sources.PolicyPath, optional: true},
+		{path: "sources.runtimeSocket", value: c.Sources.RuntimeSocket, optional: true},
+		{path: "apiServer.caFile", value: c.APIServer.CAFile, optional: true},
+		{path: "apiServer.kubeconfig", value: c.APIServer.Kubeconfig, optional: true},
+		{path: "claims.dir", value: c.Claims.Dir, optional: true},
+		{path: "tokenExchange.kubeconfig", value: c.TokenExchange.Kubeconfig, optional: true},
+		{path: "audit.file", value: c.Audit.File, optional: !c.Audit.Enabled},
+		{path: "admission.dir", value: c.Admission.Dir, optional: c.Admission.MaxInFlight == 0},
+		{path: "daemon.leaseFile", value: c.Daemon.LeaseFile, optional: true},
+	} {
+		if (p.value != "" || !p.optional) && !filepath.IsAbs(p.value) {
+			addErr(p.path, fmt.Errorf("%w: %q", ErrRelativePath, p.value))
+		}
+	}
+
+	if len(c.Token.Sources) == 0 {
+		addErr("token.sources", ErrMissingValue)
+	}
+
+	for i, source := range c.Token.Sources {
+		path := fmt.Sprintf("token.sources[%d]", i)
+
+		switch source.Type {
+		case TokenSourceRequest:
+		case TokenSourceFile:
+			if !filepath.IsAbs(source.Path) {
+				addErr(path+".path", fmt.Errorf("%w: %q", ErrRelativePath, source.Path))
+			}
+		case TokenSourceTokenRequest:
+			if source.Kubeconfig != "" && !filepath.IsAbs(source.Kubeconfig) {
+				addErr(path+".kubeconfig", fmt.Errorf("%w: %q", ErrRelativePath, source.Kubeconfig))
+			}
+
+			if source.Namespace == "" {
+				addErr(path+".namespace", ErrMissingValue)
+			}
+
+			if source.ServiceAccount == "" {
+				addErr(path+".serviceAccount", ErrMissingValue)
+			}
+		default:
+			addErr(path+".type", fmt.Errorf("%w: %q", ErrUnknownTokenSource, source.Type))
+		}
+	}
+
+	issuers := map[string]bool{}
+
+	for i, issuer := range c.Token.Issuers {
+		path := fmt.Sprintf("token.issuers[%d]", i)
+
+		switch {
+		case issuer.Issuer == "":
+			addErr(path+".issuer", ErrMissingValue)
+		case issuers[issuer.Issuer]:
+			addErr(path+".issuer", fmt.Errorf("%w: %q", ErrDuplicateIssuer, issuer.Issuer))
+		}
+
+		issuers[issuer.Issuer] = true
+
+		if issuer.JWKSURI != "" {
+			if u, err := url.Parse(issuer.JWKSURI); err != nil || u.Scheme != "https" || u.Host == "" {
+				addErr(path+".jwksURI", fmt.Errorf("%w: %q", ErrInvalidEndpoint, issuer.JWKSURI))
+			}
+		}
+
+		if issuer.CAFile != "" && !filepath.IsAbs(issuer.CAFile) {
+			addErr(path+".caFile", fmt.Errorf("%w: %q", ErrRelativePath, issuer.CAFile))
+		}
+	}
+
+	if c.Token.ClaimMapping.Enabled() {
+		mapping := &c.Token.ClaimMapping
+
+		for _, p := range []struct {
+			path     string
+			value    []string
+			optional bool
+		}{
+			{path: "token.claimMapping.namespace", value: mapping.Namespace},
+			{path: "token.claimMapping.serviceAccount", value: mapping.ServiceAccount, optional: true},
+			{path: "token.claimMapping.serviceAccountUID", value: mapping.ServiceAccountUID, optional: true},
+			{path: "token.claimMapping.pod", value: mapping.Pod, optional: true},
+			{path: "token.claimMapping.podUID", value: mapping.PodUID, optional: true},
+		} {
+			switch {
+			case len(p.value) == 0 && !p.optional:
+				addErr(p.path, ErrMissingValue)
+			case slices.Contains(p.value, ""):
+				addErr(p.path, fmt.Errorf("%w: empty path element", ErrMissingValue))
+			}
+		}
+	}
+
+	for i := range c.RegistryTLS {
+		errs = append(errs, c.RegistryTLS[i].problems(fmt.Sprintf("registryTLS[%d]", i))...)
+	}
+
+	switch c.Coordination.Lock {
+	case LockFlock, LockFcntl:
+	case LockLease:
+		if c.Coordination.LeaseTTL.Duration == 0 {
+			addErr("coordination.leaseTTL", ErrMissingValue)
+		}
+	default:
+		addErr("coordination.lock", fmt.Errorf("%w: %q", ErrUnknownLock, c.Coordination.Lock))
+	}
+
+	if c.Secrets.Shared.Namespace != "" && len(c.Secrets.Shared.Consumers) == 0 {
+		addErr("secrets.shared.consumers", ErrMissingValue)
+	}
+
+	for _, list := range []struct {
+		path     string
+		patterns []string
+	}{
+		{path: "namespaces.include", patterns: c.Namespaces.Include},
+		{path: "namespaces.exclude", patterns: c.Namespaces.Exclude},
+	} {
+		for i, pattern := range list.patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				addErr(fmt.Sprintf("%s[%d]", list.path, i), fmt.Errorf("%w: %q", ErrInvalidPattern, pattern))
+			}
+		}
+	}
+
+	for i, consumer := range c.Secrets.Shared.Consumers {
+		if _, err := path.Match(consumer, ""); err != nil {
+			addErr(fmt.Sprintf("secrets.shared.consumers[%d]", i), fmt.Errorf("%w: %q", ErrInvalidPattern, consumer))
+		}
+	}
+
+	if c.Claims.Enabled() && c.Claims.Provider == "" {
+		addErr("claims.provider", ErrMissingValue)
+	}
+
+	if c.Logging.OTLPEndpoint != "" {
+		if u, err := url.Parse(c.Logging.OTLPEndpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			addErr("logging.otlpEndpoint", fmt.Errorf("%w: %q", ErrInvalidEndpoint, c.Logging.OTLPEndpoint))
+		}
+	}
+
+	if c.Events.Endpoint != "" {
+		if u, err := url.Parse(c.Events.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			addErr("events.endpoint", fmt.Errorf("%w: %q", ErrInvalidEndpoint, c.Events.Endpoint))
+		}
+	}
+
+	errs = append(errs, c.Webhooks.PreWrite.problems("webhooks.preWrite")...)
+	errs = append(errs, c.Webhooks.PostWrite.problems("webhooks.postWrite")...)
+
+	for _, d := range []struct {
+		path  string
+		value time.Duration
+	}{
+		{path: "retention.maxAge", value: c.Retention.MaxAge.Duration},
+		{path: "sources.probe.timeout", value: c.Sources.Probe.Timeout.Duration},
+		{path: "webhooks.preWrite.timeout", value: c.Webhooks.PreWrite.Timeout.Duration},
+		{path: "webhooks.postWrite.timeout", value: c.Webhooks.PostWrite.Timeout.Duration},
+		{path: "reuse.digest", value: c.Reuse.Digest.Duration},
+		{path: "reuse.tag", value: c.Reuse.Tag.Duration},
+		{path: "secrets.negativeCacheTTL", value: c.Secrets.NegativeCacheTTL.Duration},
+		{path: "publication.retainPrevious", value: c.Publication.RetainPrevious.Duration},
+		{path: "coordination.leaseTTL", value: c.Coordination.LeaseTTL.Duration},
+		{path: "token.leeway", value: c.Token.Leeway.Duration},
+		{path: "timeouts.token", value: c.Timeouts.Token.Duration},
+		{path: "timeouts.secrets", value: c.Timeouts.Secrets.Duration},
+		{path: "timeouts.credentialSources", value: c.Timeouts.CredentialSources.Duration},
+		{path: "timeouts.write", value: c.Timeouts.Write.Duration},
+		{path: "timeouts.run", value: c.Timeouts.Run.Duration},
+	} {
+		if d.value < 0 {
+			addErr(d.path, fmt.Errorf("%w: %s", ErrNegativeDuration, d.value))
+		}
+	}
+
+	for i, ttl := range c.Retention.RegistryTTLs {
+		path := fmt.Sprintf("retention.registryTTLs[%d]", i)
+
+		if ttl.Registry == "" {
+			addErr(path+".registry", ErrMissingValue)
+		}
+
+		switch {
+		case ttl.TTL.Duration < 0:
+			addErr(path+".ttl", fmt.Errorf("%w: %s", ErrNegativeDuration, ttl.TTL.Duration))
+		case ttl.TTL.Duration == 0:
+			addErr(path+".ttl", ErrMissingValue)
+		}
+	}
+
+	if c.Admission.MaxInFlight < 0 {
+		addErr("admission.maxInFlight", fmt.Errorf("%w: %d", ErrInvalidMaxInFlight, c.Admission.MaxInFlight))
+	}
+
+	if c.Retention.MaxPerNamespace < 0 {
+		addErr("retention.maxPerNamespace", fmt.Errorf("%w: %d", ErrInvalidRetention, c.Retention.MaxPerNamespace))
+	}
+
+	if c.Retention.MaxTotalFiles < 0 {
+		addErr("retention.maxTotalFiles", fmt.Errorf("%w: %d", ErrInvalidRetention, c.Retention.MaxTotalFiles))
+	}
+
+	if c.Secrets.MaxSize < 0 {
+		addErr("secrets.maxSize", fmt.Errorf("%w: %d", ErrInvalidSecretSize, c.Secrets.MaxSize))
+	}
+
+	if c.Daemon.NamespaceWriteConcurrency < 1 {
+		addErr("daemon.namespaceWriteConcurrency", fmt.Errorf("%w: %d", ErrInvalidWriteConcurrency, c.Daemon.NamespaceWriteConcurrency))
+	}
+
+	for name, profile := range c.Profiles {
+		if err := decodeStrict(profile, &Config{}); err != nil {
+			addErr("profiles."+name, err)
+		}
+	}
+
+	return errs
+}
+
+// problems returns the problems of the webhook prefixed with path.
+func (w *Webhook) problems(path string) []error {
+	var errs []error
+
+	addErr := func(field string, err error) {
+		errs = append(errs, fmt.Errorf("%s.%s: %w", path, field, err))
+	}
+
+	if w.URL != "" {
+		if u, err := url.Parse(w.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			addErr("url", fmt.Errorf("%w: %q", ErrInvalidEndpoint, w.URL))
+		}
+	}
+
+	for _, f := range []struct {
+		field, value string
+	}{
+		{field: "caFile", value: w.CAFile},
+		{field: "certFile", value: w.CertFile},
+		{field: "keyFile", value: w.KeyFile},
+	} {
+		if f.value != "" && !filepath.IsAbs(f.value) {
+			addErr(f.field, fmt.Errorf("%w: %q", ErrRelativePath, f.value))
+		}
+	}
+
+	if w.CertFile != "" && w.KeyFile == "" {
+		addErr("keyFile", ErrMissingValue)
+	}
+
+	if w.KeyFile != "" && w.CertFile == "" {
+		addErr("certFile", ErrMissingValue)
+	}
+
+	switch w.FailurePolicy {
+	case "", WebhookFailurePolicyFail, WebhookFailurePolicyIgnore:
+	default:
+		addErr("failurePolicy", fmt.Errorf("%w: %q", ErrUnknownFailurePolicy, w.FailurePolicy))
+	}
+
+	return errs
+}
+
+func (c *Config) permissionProblems() []error {
+	var errs []error
+
+	for _, p := range []struct {
+		path  string
+		value string
+		dir   bool
+		mask  fs.FileMode
+	}{
+		// Other users must not be able to inject mirrors or credentials
+		{path: "registriesConfPath", value: c.RegistriesConfPath, mask: 0o022},
+		{path: "registriesConfDirPath", value: c.RegistriesConfDirPath, dir: true, mask: 0o022},
+		{path: "authDir", value: c.AuthDir, dir: true, mask: 0o002},
+		{path: "staticSecretsDir", value: c.StaticSecretsDir, dir: true, mask: 0o022},
+		{path: "stateFile", value: c.StateFile, mask: 0o022},
+		// The key allows forging the integrity of the auth files
+		{path: "integrityKeyPath", value: c.IntegrityKeyPath, mask: 0o077},
+	} {
+		if p.value == "" || !filepath.IsAbs(p.value) {
+			continue
+		}
+
+		info, err := os.Stat(p.value)
+		if err != nil {
+			if os.IsNotExist(err) && p.path != "staticSecretsDir" {
+				// Gets created when required
+				continue
+			}
+
+			errs = append(errs, fmt.Errorf("%s: %w", p.path, err))
+
+			continue
+		}
+
+		if p.dir && !info.IsDir() {
+			errs = append(errs, fmt.Errorf("%s: %w: %q", p.path, ErrNotDirectory, p.value))
+
+			continue
+		}
+
+		if perm := info.Mode().Perm(); perm&p.mask != 0 {
+			errs = append(errs, fmt.Errorf("%s: %w: %q has mode %#o, remove %#o", p.path, ErrInsecurePermissions, p.value, perm, perm&p.mask))
+		}
+	}
+
+	return errs
+}
+
+// problems returns the problems of the registry TLS configuration prefixed
+// with path.
+func (r *RegistryTLS) problems(path string) []error {
+	var errs []error
+
+	addErr := func(field string, err error) {
+		errs = append(errs, fmt.Errorf("%s.%s: %w", path, field, err))
+	}
+
+	if r.Registry == "" {
+		addErr("registry", ErrMissingValue)
+	}
+
+	for _, f := range []struct {
+		field, value string
+	}{
+		{field: "caFile", value: r.CAFile},
+		{field: "certFile", value: r.CertFile},
+		{field: "keyFile", value: r.KeyFile},
+	} {
+		if f.value != "" && !filepath.IsAbs(f.value) {
+			addErr(f.field, fmt.Errorf("%w: %q", ErrRelativePath, f.value))
+		}
+	}
+
+	if r.Secret != nil {
+		if r.CertFile != "" || r.KeyFile != "" {
+			addErr("secret", ErrAmbiguousClientCertificate)
+		}
+
+		if r.Secret.Namespace == "" {
+			addErr("secret.namespace", ErrMissingValue)
+		}
+
+		if r.Secret.Name == "" {
+			addErr("secret.name", ErrMissingValue)
+		}
+
+		return errs
+	}
+
+	if r.CertFile == "" {
+		addErr("certFile", ErrMissingValue)
+	}
+
+	if r.KeyFile == "" {
+		addErr("keyFile", ErrMissingValue)
+	}
+
+	return errs
+}
@@ -0,0 +1,74 @@
+// Package docker contains types specific to authenticate against container registries.
+package docker
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ConfigJSON represents ~/.docker/config.json file info.
+type ConfigJSON struct {
+	// Auths maps a registry prefix to an AuthConfig instance.
+	Auths map[string]AuthConfig `json:"auths,omitempty"`
+
+	// CredHelpers maps a registry host to the suffix of the docker credential
+	// helper binary, like "ecr-login" for docker-credential-ecr-login,
+	// providing its credentials.
+	CredHelpers map[string]string `json:"credHelpers,omitempty"`
+}
+
+// AuthConfig is a single registry's auth configuration.
+type AuthConfig struct {
+	// Auth is the base64 encoded credential in the format user:password.
+	Auth string `json:"auth,omitempty"`
+
+	// IdentityToken is a refresh token exchanged for registry tokens by the
+	// client, like the ones of Azure Container Registry. The username within
+	// Auth identifies the token.
+	IdentityToken string `json:"identitytoken,omitempty"`
+
+	// RegistryToken is a bearer token sent to the registry instead of the
+	// credential, which is supported by the Docker config.json layout only.
+	RegistryToken string `json:"registrytoken,omitempty"`
+}
+
+// HasToken returns true if the entry contains an identity or registry token.
+func (a AuthConfig) HasToken() bool {
+	return a.IdentityToken != "" || a.RegistryToken != ""
+}
+
+// ConfigEntry wraps a docker config as a entry.
+type ConfigEntry struct {
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+// authsKey is the top level key of the docker config JSON format.
+const authsKey = "auths"
+
+// ParseConfigJSON parses the docker config JSON data. Data in the legacy
+// .dockercfg format, which is a flat map of registries without the top level
+// "auths" key, gets converted. The returned bool is true if the data uses the
+// legacy format.
+func ParseConfigJSON(data []byte) (ConfigJSON, bool, error) {
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return ConfigJSON{}, false, fmt.Errorf("unmarshal docker config: %w", err)
+	}
+
+	if _, ok := fields[authsKey]; ok || len(fields) == 0 {
+		config := ConfigJSON{}
+		if err := json.Unmarshal(data, &config); err != nil {
+			return ConfigJSON{}, false, fmt.Errorf("unmarshal docker config JSON: %w", err)
+		}
+
+		return config, false, nil
+	}
+
+	auths := map[string]AuthConfig{}
+	if err := json.Unmarshal(data, &auths); err != nil {
+		return ConfigJSON{}, false, fmt.Errorf("unmarshal legacy docker config: %w", err)
+	}
+
+	return ConfigJSON{Auths: auths}, true, nil
+}
@@ -78,18 +78,23 @@ func TestAuthConfig(t *testing.T) {
 	t.Parallel()
 
 	auth := AuthConfig{
-		Auth: "dXNlcjpwYXNz",
+		Auth:          "dXNlcjpwYXNz",
+		IdentityToken: "refresh",
+		RegistryToken: "bearer",
 	}
 
 	data, err := json.Marshal(auth)
 	require.NoError(t, err)
+	assert.JSONEq(t, `{"auth":"dXNlcjpwYXNz","identitytoken":"refresh","registrytoken":"bearer"}`, string(data))
 
 	var decoded AuthConfig
 
 	err = json.Unmarshal(data, &decoded)
 	require.NoError(t, err)
 
-	assert.Equal(t, auth.Auth, decoded.Auth)
+	assert.Equal(t, auth, decoded)
+	assert.True(t, decoded.HasToken())
+	assert.False(t, AuthConfig{Auth: "dXNlcjpwYXNz"}.HasToken())
 }
 
 func TestConfigEntry(t *testing.T) {
@@ -138,3 +143,50 @@ func TestConfigJSONMarshaling(t *testing.T) {
 	assert.Equal(t, cfg.Auths["quay.io"].Auth, decoded.Auths["quay.io"].Auth)
 	assert.Equal(t, cfg.Auths["docker.io"].Auth, decoded.Auths["docker.io"].Auth)
 }
+
+func TestParseConfigJSON(t *testing.T) {
+	t.Parallel()
+
+	for name, tc := range map[string]struct {
+		data         string
+		expectAuths  map[string]AuthConfig
+		expectLegacy bool
+		shouldErr    bool
+	}{
+		"docker config JSON": {
+			data:        `{"auths":{"quay.io":{"auth":"dXNlcjpwYXNz"}}}`,
+			expectAuths: map[string]AuthConfig{"quay.io": {Auth: "dXNlcjpwYXNz"}},
+		},
+		"legacy dockercfg": {
+			data:         `{"quay.io":{"auth":"dXNlcjpwYXNz","email":"user@example.com"}}`,
+			expectAuths:  map[string]AuthConfig{"quay.io": {Auth: "dXNlcjpwYXNz"}},
+			expectLegacy: true,
+		},
+		"empty object": {
+			data: `{}`,
+		},
+		"invalid JSON": {
+			data:      `invalid`,
+			shouldErr: true,
+		},
+		"invalid legacy entry": {
+			data:      `{"quay.io":"dXNlcjpwYXNz"}`,
+			shouldErr: true,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg, legacy, err := ParseConfigJSON([]byte(tc.data))
+			if tc.shouldErr {
+				require.Error(t, err)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectLegacy, legacy)
+			assert.Equal(t, tc.expectAuths, cfg.Auths)
+		})
+	}
+}
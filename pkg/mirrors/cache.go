@@ -0,0 +1,209 @@
+package mirrors
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"go.podman.io/image/v5/pkg/sysregistriesv2"
+	"go.podman.io/image/v5/types"
+	"go.podman.io/storage/pkg/configfile"
+	"go.podman.io/storage/pkg/unshare"
+)
+
+// CacheKey identifies a matched registry.
+type CacheKey struct {
+	// RegistriesConfPath is the path to the registries.conf.
+	RegistriesConfPath string
+
+	// RegistriesConfDirPath is the drop-in directory of the registries.conf.
+	RegistriesConfDirPath string
+
+	// Fingerprint identifies the state of all registries configuration files,
+	// which changes whenever any of them gets modified.
+	Fingerprint string
+
+	// Host is the registry host of the image.
+	Host string
+}
+
+// Cache caches the registry matching an image host. A nil registry means that
+// no registry matches the host. Implementations have to be safe for
+// concurrent use and must not return registries of a different fingerprint.
+type Cache interface {
+	// Get returns the cached registry of the key.
+	Get(key CacheKey) (*sysregistriesv2.Registry, bool)
+
+	// Set caches the registry of the key.
+	Set(key CacheKey, registry *sysregistriesv2.Registry)
+}
+
+// NewCache returns an in-memory cache, which only keeps the registries of the
+// latest fingerprint per registries configuration.
+func NewCache() Cache {
+	return &hostCache{configs: map[configPaths]*configCache{}}
+}
+
+// hostCache caches the matched registry per registries configuration and
+// registry host. Many images share the same host, which turns mirror matching
+// into a map lookup for long running processes.
+type hostCache struct {
+	mu      sync.Mutex
+	configs map[configPaths]*configCache
+}
+
+type configPaths struct {
+	path, dir string
+}
+
+type configCache struct {
+	// fingerprint identifies the state of all registries configuration files.
+	fingerprint string
+
+	// hosts maps a registry host to its matching registry, which is nil if no
+	// registry matches.
+	hosts map[string]*sysregistriesv2.Registry
+}
+
+var (
+	cache = NewCache()
+
+	hits, misses atomic.Uint64
+
+	// fingerprints are the latest fingerprints per registries configuration,
+	// which are used to invalidate the cache of sysregistriesv2.
+	fingerprints = struct {
+		sync.Mutex
+		m map[configPaths]string
+	}{m: map[configPaths]string{}}
+)
+
+// CacheStats returns the number of registry lookups which got served from the
+// cache as well as the number of lookups which required parsing the registries
+// configuration.
+func CacheStats() (uint64, uint64) {
+	return hits.Load(), misses.Load()
+}
+
+// Get returns the cached registry of the key. The whole cache of the
+// configuration gets dropped if any registries configuration file changed.
+func (c *hostCache) Get(key CacheKey) (*sysregistriesv2.Registry, bool) {
+	paths := configPaths{key.RegistriesConfPath, key.RegistriesConfDirPath}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	config, ok := c.configs[paths]
+	if !ok || config.fingerprint != key.Fingerprint {
+		c.configs[paths] = &configCache{
+			fingerprint: key.Fingerprint,
+			hosts:       map[string]*sysregistriesv2.Registry{},
+		}
+
+		return nil, false
+	}
+
+	registry, ok := config.hosts[key.Host]
+
+	return registry, ok
+}
+
+// Set caches the registry of the key if the configuration did not change in
+// the meantime.
+func (c *hostCache) Set(key CacheKey, registry *sysregistriesv2.Registry) {
+	paths := configPaths{key.RegistriesConfPath, key.RegistriesConfDirPath}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	config, ok := c.configs[paths]
+	if !ok || config.fingerprint != key.Fingerprint {
+		return
+	}
+
+	config.hosts[key.Host] = registry
+}
+
+// invalidate drops the cache of sysregistriesv2 if the fingerprint of the
+// registries configuration changed since the last lookup.
+func invalidate(ctx *types.SystemContext, fingerprint string) {
+	paths := configPaths{ctx.SystemRegistriesConfPath, ctx.SystemRegistriesConfDirPath}
+
+	fingerprints.Lock()
+	defer fingerprints.Unlock()
+
+	if previous, ok := fingerprints.m[paths]; ok && previous != fingerprint {
+		sysregistriesv2.InvalidateCache()
+	}
+
+	fingerprints.m[paths] = fingerprint
+}
+
+// cacheable returns true if the match result for an image only depends on
+// its host, which is not the case if any registry prefix contains a path
+// below the host, like "quay.io/org".
+func cacheable(ctx *types.SystemContext, host string) bool {
+	registries, err := sysregistriesv2.GetRegistries(ctx)
+	if err != nil {
+		return false
+	}
+
+	for i := range registries {
+		if strings.HasPrefix(registries[i].Prefix, host+"/") {
+			return false
+		}
+	}
+
+	return true
+}
+
+// configFingerprint returns a string identifying the state of all main and
+// drop-in registries configuration files used by ctx.
+func configFingerprint(ctx *types.SystemContext) (string, error) {
+	paths, err := configfile.GetSearchPaths(&configfile.File{
+		Name:                            "registries",
+		Extension:                       "conf",
+		EnvironmentName:                 "CONTAINERS_REGISTRIES_CONF",
+		CustomConfigFilePath:            ctx.SystemRegistriesConfPath,
+		CustomConfigFileDropInDirectory: ctx.SystemRegistriesConfDirPath,
+		UserId:                          unshare.GetRootlessUID(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("get registries configuration search paths: %w", err)
+	}
+
+	b := &strings.Builder{}
+
+	for _, path := range paths.MainFiles {
+		writeFileFingerprint(b, path)
+	}
+
+	for _, dir := range paths.DropInDirectories {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			fmt.Fprintf(b, "%s:-\n", dir)
+
+			continue
+		}
+
+		for _, entry := range entries {
+			writeFileFingerprint(b, filepath.Join(dir, entry.Name()))
+		}
+	}
+
+	return b.String(), nil
+}
+
+func writeFileFingerprint(b *strings.Builder, path string) {
+	info, err := os.Stat(path)
+	if err != nil {
+		fmt.Fprintf(b, "%s:-\n", path)
+
+		return
+	}
+
+	fmt.Fprintf(b, "%s:%d:%d\n", path, info.ModTime().UnixNano(), info.Size())
+}
@@ -0,0 +1,456 @@
+// Package mirrors contains the pull source resolution and mirror matching
+// logic of the credential provider. It can be used by other node agents to
+// resolve the pull sources of an image the same way the provider does.
+package mirrors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+
+	"go.podman.io/image/v5/docker/reference"
+	"go.podman.io/image/v5/pkg/sysregistriesv2"
+	"go.podman.io/image/v5/types"
+
+	"github.com/cri-o/crio-credential-provider/internal/pkg/claims"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/crio"
+	"github.com/cri-o/crio-credential-provider/internal/pkg/logger"
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+	cpReference "github.com/cri-o/crio-credential-provider/pkg/reference"
+)
+
+var errImageEmpty = errors.New("image is empty")
+
+// Source is a resolved pull source of an image.
+type Source struct {
+	// Reference is the image reference after remapping it to the source.
+	Reference string `json:"reference"`
+
+	// Location is the registry location of the source.
+	Location string `json:"location"`
+
+	// Mirror is true if the source is a mirror and not the primary registry.
+	Mirror bool `json:"mirror"`
+
+	// Allowed is true if the runtime is permitted to use the source, which
+	// means that it is allowed to receive credentials.
+	Allowed bool `json:"allowed"`
+
+	// Reason explains why the source is not allowed.
+	Reason string `json:"reason,omitempty"`
+
+	// Candidate is the qualified image the source got resolved from, if the
+	// image got qualified by using the unqualified-search-registries.
+	Candidate string `json:"candidate,omitempty"`
+
+	// Prefix is the prefix of the matching registries configuration entry,
+	// which is empty if no entry matches the image.
+	Prefix string `json:"prefix,omitempty"`
+
+	// Insecure is true if the source skips the TLS verification.
+	Insecure bool `json:"insecure,omitempty"`
+
+	// PullFromMirror restricts the pulls using the mirror to "digest-only" or
+	// "tag-only" pulls, and is empty for unrestricted mirrors.
+	PullFromMirror string `json:"pullFromMirror,omitempty"`
+}
+
+// Options are the options to resolve the pull sources of an image.
+type Options struct {
+	// RegistriesConfPath is the path to the registries.conf, which uses the
+	// system default if empty.
+	RegistriesConfPath string
+
+	// RegistriesConfDirPath is the drop-in directory of the registries.conf,
+	// which uses the system defaults if empty.
+	RegistriesConfDirPath string
+
+	// PolicyPath is the path to the containers-policy.json(5). No source gets
+	// rejected by a policy if empty.
+	PolicyPath string
+
+	// AllowInsecure allows sources with insecure = true.
+	AllowInsecure bool
+
+	// InsecureRegistries are additional registries whose sources are
+	// insecure, either as host or as CIDR, like the insecure_registries of
+	// CRI-O.
+	InsecureRegistries []string
+
+	// Claimed returns the owner if the image name got claimed by another
+	// party, which rejects the source. Optional.
+	Claimed func(name string) (owner string, claimed bool)
+
+	// Cache caches the matched registries. The package wide cache reported by
+	// CacheStats gets used if nil.
+	Cache Cache
+}
+
+// ConfigOptions returns the options used by the credential provider for the
+// configuration.
+func ConfigOptions(cfg *config.Config) (*Options, error) {
+	opts := &Options{
+		RegistriesConfPath:    cfg.RegistriesConfPath,
+		RegistriesConfDirPath: cfg.RegistriesConfDirPath,
+		PolicyPath:            cfg.Sources.PolicyPath,
+		AllowInsecure:         cfg.Sources.AllowInsecure,
+	}
+
+	// The runtime does not expose the paths of the registries configuration,
+	// which remains the source of the mirrors.
+	if cfg.Sources.RuntimeSocket != "" {
+		runtime, err := crio.ReadConfig(context.Background(), cfg.Sources.RuntimeSocket)
+		if err != nil {
+			logger.Warnf("Unable to read the CRI-O configuration, falling back to the node configuration: %v", err)
+		} else {
+			opts.InsecureRegistries = runtime.InsecureRegistries
+
+			if runtime.SignaturePolicy != "" {
+				opts.PolicyPath = runtime.SignaturePolicy
+			}
+		}
+	}
+
+	if !cfg.Claims.Enabled() {
+		return opts, nil
+	}
+
+	loaded, err := claims.Load(cfg.Claims.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("load claims: %w", err)
+	}
+
+	opts.Claimed = func(name string) (string, bool) {
+		return claims.Owner(cfg, loaded, name)
+	}
+
+	return opts, nil
+}
+
+// Resolve parses the image into its pull sources by using the options of the
+// configuration, see ResolveOptions.
+func Resolve(image string, cfg *config.Config) ([]Source, error) {
+	opts, err := ConfigOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return ResolveOptions(image, opts)
+}
+
+// ResolveOptions parses the image into its pull sources, which are the
+// mirrors after remapping followed by the primary registry. Every source gets
+// checked against the blocked and insecure registries configuration as well
+// as the containers-policy.json(5). The results get cached per registry host
+// until the registries configuration changes. Images without a registry host
+// get qualified with every unqualified-search-registries entry, which results
+// in the sources of all candidates in the search order.
+func ResolveOptions(image string, opts *Options) ([]Source, error) {
+	if image == "" {
+		return nil, errImageEmpty
+	}
+
+	if host, _, ok := strings.Cut(image, "/"); ok && strings.HasPrefix(host, "[") {
+		return resolveIPv6(image, host, opts), nil
+	}
+
+	ctx := &types.SystemContext{
+		SystemRegistriesConfPath:    opts.RegistriesConfPath,
+		SystemRegistriesConfDirPath: opts.RegistriesConfDirPath,
+	}
+
+	search, err := searchRegistries(ctx, image)
+	if err != nil {
+		return nil, err
+	}
+
+	pol, err := loadPolicy(opts.PolicyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(search) == 0 {
+		ref, err := cpReference.Parse(image)
+		if err != nil {
+			return nil, fmt.Errorf("resolve image: %w", err)
+		}
+
+		return resolveNamed(ctx, opts, ref.Named(), pol)
+	}
+
+	sources := []Source{}
+
+	for _, registry := range search {
+		ref, err := cpReference.Parse(registry + "/" + image)
+		if err != nil {
+			return nil, fmt.Errorf("resolve image qualified with %q: %w", registry, err)
+		}
+
+		named := ref.Named()
+
+		candidateSources, err := resolveNamed(ctx, opts, named, pol)
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range candidateSources {
+			candidateSources[i].Candidate = named.String()
+		}
+
+		sources = append(sources, candidateSources...)
+	}
+
+	return sources, nil
+}
+
+// searchRegistries returns the unqualified-search-registries if the image
+// does not contain a registry host, like "nginx" or "org/app".
+func searchRegistries(ctx *types.SystemContext, image string) ([]string, error) {
+	if _, ok := cpReference.Registry(image); ok {
+		return nil, nil
+	}
+
+	search, err := sysregistriesv2.UnqualifiedSearchRegistries(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("loading unqualified search registries: %w", err)
+	}
+
+	return search, nil
+}
+
+// resolveNamed resolves the pull sources of the fully qualified image.
+func resolveNamed(ctx *types.SystemContext, opts *Options, named reference.Named, pol *policy) ([]Source, error) {
+	registry, err := findRegistry(ctx, opts.Cache, named)
+	if err != nil {
+		return nil, err
+	}
+
+	if registry == nil {
+		source := &Source{
+			Reference: named.String(),
+			Location:  reference.Domain(named),
+			Allowed:   true,
+			Insecure:  insecureRegistry(opts, reference.Domain(named)),
+		}
+
+		if source.Insecure && !opts.AllowInsecure {
+			source.Allowed = false
+			source.Reason = "insecure sources are not allowed"
+		} else {
+			check(source, named, pol)
+			checkClaimed(source, named.Name(), opts)
+		}
+
+		return []Source{*source}, nil
+	}
+
+	pullSources, err := registry.PullSourcesFromReference(named)
+	if err != nil {
+		return nil, fmt.Errorf("get pull sources: %w", err)
+	}
+
+	sources := make([]Source, 0, len(pullSources))
+
+	for i, pullSource := range pullSources {
+		source := &Source{
+			Reference: pullSource.Reference.String(),
+			Location:  pullSource.Endpoint.Location,
+			Mirror:    i < len(pullSources)-1,
+			Allowed:   true,
+			Prefix:    registry.Prefix,
+			Insecure:  pullSource.Endpoint.Insecure || insecureRegistry(opts, reference.Domain(pullSource.Reference)),
+		}
+
+		if source.Mirror {
+			source.PullFromMirror = pullFromMirror(registry, &pullSource.Endpoint)
+		}
+
+		if source.Location == "" {
+			// Wildcard prefixes do not have a location
+			source.Location = reference.Domain(pullSource.Reference)
+		}
+
+		switch {
+		case registry.Blocked:
+			source.Allowed = false
+			source.Reason = "registry is blocked"
+
+		case source.Insecure && !opts.AllowInsecure:
+			source.Allowed = false
+			source.Reason = "insecure sources are not allowed"
+
+		default:
+			check(source, pullSource.Reference, pol)
+			checkClaimed(source, pullSource.Reference.Name(), opts)
+		}
+
+		sources = append(sources, *source)
+	}
+
+	return sources, nil
+}
+
+// resolveIPv6 resolves an image located at an IPv6 literal host, like
+// "[fd00::1]:5000/org/app". Neither the image reference grammar nor the
+// registries configuration and policy support such hosts, which means that
+// the image itself is the only pull source.
+func resolveIPv6(image, host string, opts *Options) []Source {
+	source := &Source{Reference: image, Location: host, Allowed: true}
+	checkClaimed(source, image, opts)
+
+	return []Source{*source}
+}
+
+// insecureRegistry returns true if the registry host matches an entry of the
+// InsecureRegistries, either by its name or by an IP within a CIDR.
+func insecureRegistry(opts *Options, host string) bool {
+	name := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		name = h
+	}
+
+	ip := net.ParseIP(name)
+
+	for _, entry := range opts.InsecureRegistries {
+		if entry == host || entry == name {
+			return true
+		}
+
+		if _, cidr, err := net.ParseCIDR(entry); err == nil && ip != nil && cidr.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// pullFromMirror returns the effective pull restriction of the mirror.
+func pullFromMirror(registry *sysregistriesv2.Registry, mirror *sysregistriesv2.Endpoint) string {
+	if registry.MirrorByDigestOnly {
+		return sysregistriesv2.MirrorByDigestOnly
+	}
+
+	if mirror.PullFromMirror == sysregistriesv2.MirrorAll {
+		return ""
+	}
+
+	return mirror.PullFromMirror
+}
+
+// check verifies the source against the policy.
+func check(source *Source, ref reference.Named, pol *policy) {
+	if scope, rejected := pol.rejects(ref); rejected {
+		source.Allowed = false
+		source.Reason = fmt.Sprintf("rejected by policy scope %q", scope)
+	}
+}
+
+// checkClaimed verifies that the source is not claimed by another party.
+func checkClaimed(source *Source, name string, opts *Options) {
+	if !source.Allowed || opts.Claimed == nil {
+		return
+	}
+
+	if owner, claimed := opts.Claimed(name); claimed {
+		source.Allowed = false
+		source.Reason = fmt.Sprintf("claimed by provider %q with a higher priority", owner)
+	}
+}
+
+// Mirrors returns the locations of all allowed mirror sources.
+func Mirrors(sources []Source) []string {
+	res := []string{}
+
+	for i := range sources {
+		if sources[i].Mirror && sources[i].Allowed {
+			res = append(res, sources[i].Location)
+		}
+	}
+
+	return res
+}
+
+// Candidates returns the distinct qualified images the sources got resolved
+// from in the search order, or the image itself if it did not get qualified.
+func Candidates(sources []Source, image string) []string {
+	res := []string{}
+
+	for i := range sources {
+		if candidate := sources[i].Candidate; candidate != "" && !slices.Contains(res, candidate) {
+			res = append(res, candidate)
+		}
+	}
+
+	if len(res) == 0 {
+		return []string{image}
+	}
+
+	return res
+}
+
+// CandidateSources returns the sources resolved from the candidate, which are
+// all sources if the image did not get qualified.
+func CandidateSources(sources []Source, candidate string) []Source {
+	res := []Source{}
+
+	for i := range sources {
+		if sources[i].Candidate == "" || sources[i].Candidate == candidate {
+			res = append(res, sources[i])
+		}
+	}
+
+	return res
+}
+
+// PrimaryAllowed returns true if the primary source is allowed.
+func PrimaryAllowed(sources []Source) bool {
+	for i := range sources {
+		if !sources[i].Mirror {
+			return sources[i].Allowed
+		}
+	}
+
+	return false
+}
+
+// findRegistry returns the matching registry, which is nil if none matches.
+func findRegistry(ctx *types.SystemContext, c Cache, named reference.Named) (*sysregistriesv2.Registry, error) {
+	if c == nil {
+		c = cache
+	}
+
+	key := CacheKey{
+		RegistriesConfPath:    ctx.SystemRegistriesConfPath,
+		RegistriesConfDirPath: ctx.SystemRegistriesConfDirPath,
+		Host:                  reference.Domain(named),
+	}
+
+	fingerprint, err := configFingerprint(ctx)
+	if err == nil {
+		key.Fingerprint = fingerprint
+		invalidate(ctx, fingerprint)
+
+		if cached, ok := c.Get(key); ok {
+			hits.Add(1)
+
+			return cached, nil
+		}
+	}
+
+	// Let the registries configuration parsing report the fingerprint error
+	misses.Add(1)
+
+	registry, err := sysregistriesv2.FindRegistry(ctx, named.String())
+	if err != nil {
+		return nil, fmt.Errorf("loading registries configuration: %w", err)
+	}
+
+	if key.Fingerprint != "" && cacheable(ctx, key.Host) {
+		c.Set(key, registry)
+	}
+
+	return registry, nil
+}
@@ -0,0 +1,574 @@
+package mirrors
+
+import (
+	"fmt"
+	"maps"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.podman.io/image/v5/pkg/sysregistriesv2"
+
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+)
+
+func testConfig(t *testing.T, conf, policy string) *config.Config {
+	t.Helper()
+
+	dir := t.TempDir()
+
+	cfg := config.Default()
+	cfg.RegistriesConfPath = filepath.Join(dir, "registries.conf")
+	cfg.Sources.PolicyPath = filepath.Join(dir, "policy.json")
+
+	require.NoError(t, os.WriteFile(cfg.RegistriesConfPath, []byte(conf), 0o600))
+
+	if policy != "" {
+		require.NoError(t, os.WriteFile(cfg.Sources.PolicyPath, []byte(policy), 0o600))
+	}
+
+	return cfg
+}
+
+func TestResolve(t *testing.T) {
+	t.Parallel()
+
+	cfg := testConfig(t, `unqualified-search-registries = ["quay.io"]
+
+[[registry]]
+location = "quay.io"
+
+  [[registry.mirror]]
+  location = "mirror.quay.io"
+
+  [[registry.mirror]]
+  location = "cache.local:5000"
+`, "")
+
+	sources, err := Resolve("quay.io/library/nginx", cfg)
+	require.NoError(t, err)
+
+	assert.Equal(t, []Source{
+		{Reference: "mirror.quay.io/library/nginx", Location: "mirror.quay.io", Mirror: true, Allowed: true, Prefix: "quay.io"},
+		{Reference: "cache.local:5000/library/nginx", Location: "cache.local:5000", Mirror: true, Allowed: true, Prefix: "quay.io"},
+		{Reference: "quay.io/library/nginx", Location: "quay.io", Allowed: true, Prefix: "quay.io"},
+	}, sources)
+	assert.Equal(t, []string{"mirror.quay.io", "cache.local:5000"}, Mirrors(sources))
+	assert.True(t, PrimaryAllowed(sources))
+
+	sources, err = Resolve("[fd00::1]:5000/org/app", cfg)
+	require.NoError(t, err)
+	assert.Equal(t, []Source{{Reference: "[fd00::1]:5000/org/app", Location: "[fd00::1]:5000", Allowed: true}}, sources)
+}
+
+func TestResolveUnqualified(t *testing.T) {
+	t.Parallel()
+
+	cfg := testConfig(t, `unqualified-search-registries = ["quay.io", "registry.local"]
+
+[[registry]]
+location = "quay.io"
+
+  [[registry.mirror]]
+  location = "mirror.quay.io"
+`, "")
+
+	sources, err := Resolve("org/app:v1", cfg)
+	require.NoError(t, err)
+
+	assert.Equal(t, []Source{
+		{Reference: "mirror.quay.io/org/app:v1", Location: "mirror.quay.io", Mirror: true, Allowed: true, Candidate: "quay.io/org/app:v1", Prefix: "quay.io"},
+		{Reference: "quay.io/org/app:v1", Location: "quay.io", Allowed: true, Candidate: "quay.io/org/app:v1", Prefix: "quay.io"},
+		{Reference: "registry.local/org/app:v1", Location: "registry.local", Allowed: true, Candidate: "registry.local/org/app:v1"},
+	}, sources)
+
+	candidates := Candidates(sources, "org/app:v1")
+	assert.Equal(t, []string{"quay.io/org/app:v1", "registry.local/org/app:v1"}, candidates)
+	assert.Equal(t, sources[:2], CandidateSources(sources, candidates[0]))
+	assert.Equal(t, sources[2:], CandidateSources(sources, candidates[1]))
+
+	// Qualified images do not have any candidates
+	sources, err = Resolve("quay.io/org/app", cfg)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"quay.io/org/app"}, Candidates(sources, "quay.io/org/app"))
+	assert.Equal(t, sources, CandidateSources(sources, "quay.io/org/app"))
+}
+
+func TestResolveDecisions(t *testing.T) {
+	t.Parallel()
+
+	const conf = `[[registry]]
+location = "quay.io"
+
+  [[registry.mirror]]
+  location = "mirror.quay.io"
+
+  [[registry.mirror]]
+  location = "insecure.local:5000"
+  insecure = true
+
+[[registry]]
+location = "blocked.io"
+blocked = true
+
+  [[registry.mirror]]
+  location = "mirror.blocked.io"
+`
+
+	for name, tc := range map[string]struct {
+		image          string
+		allowInsecure  bool
+		policy         string
+		claims         []string
+		expectMirrors  []string
+		expectPrimary  bool
+		expectRejected map[string]string
+	}{
+		"all allowed": {
+			image:         "quay.io/org/app",
+			allowInsecure: true,
+			expectMirrors: []string{"mirror.quay.io", "insecure.local:5000"},
+			expectPrimary: true,
+		},
+		"insecure not allowed": {
+			image:         "quay.io/org/app",
+			expectMirrors: []string{"mirror.quay.io"},
+			expectPrimary: true,
+			expectRejected: map[string]string{
+				"insecure.local:5000/org/app": "insecure sources are not allowed",
+			},
+		},
+		"blocked registry": {
+			image:         "blocked.io/org/app",
+			allowInsecure: true,
+			expectMirrors: []string{},
+			expectRejected: map[string]string{
+				"mirror.blocked.io/org/app": "registry is blocked",
+				"blocked.io/org/app":        "registry is blocked",
+			},
+		},
+		"policy rejects mirror host": {
+			image:         "quay.io/org/app",
+			allowInsecure: true,
+			policy:        `{"default":[{"type":"insecureAcceptAnything"}],"transports":{"docker":{"mirror.quay.io":[{"type":"reject"}]}}}`,
+			expectMirrors: []string{"insecure.local:5000"},
+			expectPrimary: true,
+			expectRejected: map[string]string{
+				"mirror.quay.io/org/app": `rejected by policy scope "mirror.quay.io"`,
+			},
+		},
+		"policy rejects by default": {
+			image:         "quay.io/org/app",
+			allowInsecure: true,
+			policy:        `{"default":[{"type":"reject"}],"transports":{"docker":{"quay.io/org":[{"type":"insecureAcceptAnything"}]}}}`,
+			expectMirrors: []string{},
+			expectPrimary: true,
+			expectRejected: map[string]string{
+				"mirror.quay.io/org/app":      `rejected by policy scope "default"`,
+				"insecure.local:5000/org/app": `rejected by policy scope "default"`,
+			},
+		},
+		"policy rejects wildcard domain": {
+			image:         "quay.io/org/app",
+			allowInsecure: true,
+			policy:        `{"default":[{"type":"insecureAcceptAnything"}],"transports":{"docker":{"*.quay.io":[{"type":"reject"}]}}}`,
+			expectMirrors: []string{"insecure.local:5000"},
+			expectPrimary: true,
+			expectRejected: map[string]string{
+				"mirror.quay.io/org/app": `rejected by policy scope "*.quay.io"`,
+			},
+		},
+		"mirror claimed by other provider": {
+			image:         "quay.io/org/app",
+			allowInsecure: true,
+			claims:        []string{`{"provider":"other","priority":10,"pattern":"*.quay.io/org"}`},
+			expectMirrors: []string{"insecure.local:5000"},
+			expectPrimary: true,
+			expectRejected: map[string]string{
+				"mirror.quay.io/org/app": `claimed by provider "other" with a higher priority`,
+			},
+		},
+		"claims with lower priority": {
+			image:         "quay.io/org/app",
+			allowInsecure: true,
+			claims:        []string{`{"provider":"other","priority":-1,"pattern":"quay.io"}`},
+			expectMirrors: []string{"mirror.quay.io", "insecure.local:5000"},
+			expectPrimary: true,
+		},
+		"unrelated registry": {
+			image:         "gcr.io/org/app",
+			expectMirrors: []string{},
+			expectPrimary: true,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := testConfig(t, conf, tc.policy)
+			cfg.Sources.AllowInsecure = tc.allowInsecure
+			cfg.Claims.Dir = t.TempDir()
+
+			for i, claim := range tc.claims {
+				require.NoError(t, os.WriteFile(filepath.Join(cfg.Claims.Dir, fmt.Sprintf("%d.claim.json", i)), []byte(claim), 0o600))
+			}
+
+			sources, err := Resolve(tc.image, cfg)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.expectMirrors, Mirrors(sources))
+			assert.Equal(t, tc.expectPrimary, PrimaryAllowed(sources))
+
+			rejected := map[string]string{}
+
+			for _, source := range sources {
+				if !source.Allowed {
+					rejected[source.Reference] = source.Reason
+				}
+			}
+
+			if tc.expectRejected == nil {
+				tc.expectRejected = map[string]string{}
+			}
+
+			assert.Equal(t, tc.expectRejected, rejected)
+		})
+	}
+}
+
+func TestResolveEdgeCases(t *testing.T) {
+	t.Parallel()
+
+	for name, tc := range map[string]struct {
+		image     string
+		conf      string
+		policy    string
+		confPath  string
+		shouldErr bool
+		expectLen int
+	}{
+		"empty image": {
+			image:     "",
+			shouldErr: true,
+		},
+		"invalid image": {
+			image:     "Invalid//Image",
+			shouldErr: true,
+		},
+		"no registry found": {
+			image:     "docker.io/library/nginx",
+			conf:      `unqualified-search-registries = ["docker.io"]`,
+			expectLen: 1,
+		},
+		"registry with no mirrors": {
+			image: "gcr.io/library/nginx",
+			conf: `[[registry]]
+location = "gcr.io"`,
+			expectLen: 1,
+		},
+		"digest reference": {
+			image: "quay.io/org/app@sha256:" + fmt.Sprintf("%064d", 0),
+			conf: `[[registry]]
+location = "quay.io"
+
+  [[registry.mirror]]
+  location = "mirror.quay.io"`,
+			expectLen: 2,
+		},
+		"invalid policy": {
+			image:     "quay.io/org/app",
+			policy:    "{",
+			shouldErr: true,
+		},
+		"invalid registries conf path": {
+			image:     "quay.io/test/image",
+			confPath:  "/nonexistent/path/registries.conf",
+			shouldErr: true,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := testConfig(t, tc.conf, tc.policy)
+			if tc.confPath != "" {
+				cfg.RegistriesConfPath = tc.confPath
+			}
+
+			sources, err := Resolve(tc.image, cfg)
+			if tc.shouldErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				assert.Len(t, sources, tc.expectLen)
+			}
+		})
+	}
+}
+
+func TestResolveCache(t *testing.T) {
+	t.Parallel()
+
+	cfg := testConfig(t, "", "")
+	writeConf := func(mirror string, modTime time.Time) {
+		t.Helper()
+
+		conf := fmt.Sprintf(`[[registry]]
+location = "quay.io"
+
+  [[registry.mirror]]
+  location = %q
+
+[[registry]]
+location = "docker.io/org"
+
+  [[registry.mirror]]
+  location = "org.mirror.local"
+`, mirror)
+		require.NoError(t, os.WriteFile(cfg.RegistriesConfPath, []byte(conf), 0o600))
+		require.NoError(t, os.Chtimes(cfg.RegistriesConfPath, modTime, modTime))
+	}
+
+	match := func(image string) []string {
+		t.Helper()
+
+		sources, err := Resolve(image, cfg)
+		require.NoError(t, err)
+
+		return Mirrors(sources)
+	}
+
+	cachedHosts := func() []string {
+		c, ok := cache.(*hostCache)
+		require.True(t, ok)
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		return slices.Sorted(maps.Keys(c.configs[configPaths{path: cfg.RegistriesConfPath}].hosts))
+	}
+
+	now := time.Now()
+	writeConf("first.mirror.local", now)
+
+	assert.Equal(t, []string{"first.mirror.local"}, match("quay.io/library/nginx"))
+	assert.Equal(t, []string{"first.mirror.local"}, match("quay.io/other/image"))
+	assert.Equal(t, []string{"org.mirror.local"}, match("docker.io/org/image"))
+	assert.Empty(t, match("docker.io/library/nginx"))
+
+	// docker.io contains a registry with a namespaced prefix
+	assert.Equal(t, []string{"quay.io"}, cachedHosts())
+
+	writeConf("second.mirror.local", now.Add(time.Second))
+
+	assert.Equal(t, []string{"second.mirror.local"}, match("quay.io/library/nginx"))
+}
+
+func TestResolveConfDir(t *testing.T) {
+	t.Parallel()
+
+	cfg := testConfig(t, "", "")
+	cfg.RegistriesConfDirPath = filepath.Join(filepath.Dir(cfg.RegistriesConfPath), "registries.conf.d")
+
+	require.NoError(t, os.Mkdir(cfg.RegistriesConfDirPath, 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(cfg.RegistriesConfDirPath, "50-mirror.conf"), []byte(`[[registry]]
+location = "quay.io"
+
+  [[registry.mirror]]
+  location = "dropin.mirror.local"
+`), 0o600))
+
+	sources, err := Resolve("quay.io/library/nginx", cfg)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"dropin.mirror.local"}, Mirrors(sources))
+}
+
+func TestResolveOptions(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	confDir := filepath.Join(dir, "registries.conf.d")
+	opts := &Options{
+		RegistriesConfPath:    filepath.Join(dir, "registries.conf"),
+		RegistriesConfDirPath: confDir,
+		Claimed: func(name string) (string, bool) {
+			return "other", strings.HasPrefix(name, "tags.local/")
+		},
+	}
+
+	require.NoError(t, os.WriteFile(opts.RegistriesConfPath, []byte(`[[registry]]
+location = "quay.io"
+
+  [[registry.mirror]]
+  location = "digests.local"
+  pull-from-mirror = "digest-only"
+`), 0o600))
+	require.NoError(t, os.Mkdir(confDir, 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(confDir, "10-tags.conf"), []byte(`[[registry]]
+prefix = "quay.io/org"
+location = "quay.io/org"
+
+  [[registry.mirror]]
+  location = "tags.local/org"
+  pull-from-mirror = "tag-only"
+  insecure = true
+`), 0o600))
+
+	sources, err := ResolveOptions("quay.io/org/app:v1", opts)
+	require.NoError(t, err)
+
+	assert.Equal(t, []Source{
+		{
+			Reference: "tags.local/org/app:v1", Location: "tags.local/org", Mirror: true, Reason: "insecure sources are not allowed",
+			Prefix: "quay.io/org", Insecure: true, PullFromMirror: "tag-only",
+		},
+		{Reference: "quay.io/org/app:v1", Location: "quay.io/org", Allowed: true, Prefix: "quay.io/org"},
+	}, sources)
+
+	opts.AllowInsecure = true
+
+	sources, err = ResolveOptions("quay.io/org/app:v1", opts)
+	require.NoError(t, err)
+	assert.False(t, sources[0].Allowed)
+	assert.Equal(t, `claimed by provider "other" with a higher priority`, sources[0].Reason)
+
+	sources, err = ResolveOptions("quay.io/library/nginx@sha256:"+strings.Repeat("a", 64), opts)
+	require.NoError(t, err)
+	require.Len(t, sources, 2)
+	assert.Equal(t, "digest-only", sources[0].PullFromMirror)
+}
+
+func TestResolveInsecureRegistries(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	opts := &Options{
+		RegistriesConfPath: filepath.Join(dir, "registries.conf"),
+		InsecureRegistries: []string{"mirror.local:5000", "10.0.0.0/8"},
+	}
+
+	require.NoError(t, os.WriteFile(opts.RegistriesConfPath, []byte(`[[registry]]
+location = "quay.io"
+
+  [[registry.mirror]]
+  location = "mirror.local:5000"
+
+  [[registry.mirror]]
+  location = "other.local"
+`), 0o600))
+
+	sources, err := ResolveOptions("quay.io/org/app:v1", opts)
+	require.NoError(t, err)
+	require.Len(t, sources, 3)
+	assert.True(t, sources[0].Insecure)
+	assert.Equal(t, "insecure sources are not allowed", sources[0].Reason)
+	assert.False(t, sources[1].Insecure)
+	assert.True(t, sources[1].Allowed)
+
+	sources, err = ResolveOptions("10.1.2.3:5000/org/app:v1", opts)
+	require.NoError(t, err)
+	require.Len(t, sources, 1)
+	assert.True(t, sources[0].Insecure)
+	assert.False(t, sources[0].Allowed)
+
+	opts.AllowInsecure = true
+
+	sources, err = ResolveOptions("10.1.2.3:5000/org/app:v1", opts)
+	require.NoError(t, err)
+	assert.True(t, sources[0].Allowed)
+}
+
+func TestConfigOptionsRuntimeSocket(t *testing.T) {
+	t.Parallel()
+
+	dir, err := os.MkdirTemp("", "crio")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	listener, err := net.Listen("unix", filepath.Join(dir, "crio.sock"))
+	require.NoError(t, err)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, err := w.Write([]byte("[crio.image]\ninsecure_registries = [\"mirror.local\"]\nsignature_policy = \"/etc/crio/policy.json\"\n"))
+		assert.NoError(t, err)
+	}))
+	server.Listener = listener
+	server.Start()
+	t.Cleanup(server.Close)
+
+	cfg := config.Default()
+	cfg.Sources.RuntimeSocket = listener.Addr().String()
+
+	opts, err := ConfigOptions(cfg)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"mirror.local"}, opts.InsecureRegistries)
+	assert.Equal(t, "/etc/crio/policy.json", opts.PolicyPath)
+
+	// The node configuration remains if CRI-O cannot be reached
+	cfg.Sources.RuntimeSocket = filepath.Join(dir, "missing.sock")
+
+	opts, err = ConfigOptions(cfg)
+	require.NoError(t, err)
+	assert.Empty(t, opts.InsecureRegistries)
+	assert.Equal(t, config.PolicyPath, opts.PolicyPath)
+}
+
+// testCache records the lookups of the registries.
+type testCache struct {
+	mu      sync.Mutex
+	entries map[CacheKey]*sysregistriesv2.Registry
+	gets    int
+}
+
+func (c *testCache) Get(key CacheKey) (*sysregistriesv2.Registry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gets++
+	registry, ok := c.entries[key]
+
+	return registry, ok
+}
+
+func (c *testCache) Set(key CacheKey, registry *sysregistriesv2.Registry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[key] = registry
+}
+
+func TestResolveCacheHook(t *testing.T) {
+	t.Parallel()
+
+	cfg := testConfig(t, `[[registry]]
+location = "quay.io"
+
+  [[registry.mirror]]
+  location = "mirror.quay.io"
+`, "")
+	c := &testCache{entries: map[CacheKey]*sysregistriesv2.Registry{}}
+	opts := &Options{RegistriesConfPath: cfg.RegistriesConfPath, Cache: c}
+
+	for range 2 {
+		sources, err := ResolveOptions("quay.io/org/app", opts)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"mirror.quay.io"}, Mirrors(sources))
+	}
+
+	assert.Equal(t, 2, c.gets)
+	require.Len(t, c.entries, 1)
+
+	for key, registry := range c.entries {
+		assert.Equal(t, cfg.RegistriesConfPath, key.RegistriesConfPath)
+		assert.Equal(t, "quay.io", key.Host)
+		assert.NotEmpty(t, key.Fingerprint)
+		assert.Equal(t, "quay.io", registry.Prefix)
+	}
+}
@@ -0,0 +1,123 @@
+package mirrors
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"go.podman.io/image/v5/docker/reference"
+)
+
+const (
+	policyTransportDocker = "docker"
+	policyTypeReject      = "reject"
+)
+
+// policy is the subset of containers-policy.json(5) required to decide
+// whether the runtime rejects images from a source.
+type policy struct {
+	Default    []policyRequirement                       `json:"default"`
+	Transports map[string]map[string][]policyRequirement `json:"transports"`
+}
+
+type policyRequirement struct {
+	Type string `json:"type"`
+}
+
+// loadPolicy reads the policy from path. A non existing file or an empty path
+// result in a nil policy, which does not reject anything.
+func loadPolicy(path string) (*policy, error) {
+	if path == "" {
+		return nil, nil //nolint:nilnil // no policy configured
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil //nolint:nilnil // no policy available
+		}
+
+		return nil, fmt.Errorf("read policy: %w", err)
+	}
+
+	pol := &policy{}
+	if err := json.Unmarshal(raw, pol); err != nil {
+		return nil, fmt.Errorf("parse policy %q: %w", path, err)
+	}
+
+	return pol, nil
+}
+
+// rejects returns true and the matching scope if the most specific docker
+// transport scope of the reference rejects it.
+func (p *policy) rejects(ref reference.Named) (string, bool) {
+	if p == nil {
+		return "", false
+	}
+
+	scope, requirements := p.requirements(ref)
+	for _, r := range requirements {
+		if r.Type == policyTypeReject {
+			return scope, true
+		}
+	}
+
+	return "", false
+}
+
+// requirements returns the most specific scope and requirements for the
+// reference, see the docker transport section of containers-policy.json(5).
+func (p *policy) requirements(ref reference.Named) (string, []policyRequirement) {
+	scopes := p.Transports[policyTransportDocker]
+
+	for _, scope := range policyScopes(ref) {
+		if requirements, ok := scopes[scope]; ok {
+			return scope, requirements
+		}
+	}
+
+	if requirements, ok := scopes[""]; ok {
+		return policyTransportDocker, requirements
+	}
+
+	return "default", p.Default
+}
+
+// policyScopes returns all candidate scopes of the reference from the most
+// to the least specific one.
+func policyScopes(ref reference.Named) []string {
+	scopes := []string{}
+
+	if _, ok := ref.(reference.Tagged); ok {
+		scopes = append(scopes, ref.String())
+	} else if _, ok := ref.(reference.Digested); ok {
+		scopes = append(scopes, ref.String())
+	}
+
+	name := ref.Name()
+	for {
+		scopes = append(scopes, name)
+
+		i := strings.LastIndex(name, "/")
+		if i == -1 {
+			break
+		}
+
+		name = name[:i]
+	}
+
+	// Wildcard scopes for all parent domains of the host
+	host := reference.Domain(ref)
+	for {
+		_, parent, ok := strings.Cut(host, ".")
+		if !ok || !strings.Contains(parent, ".") {
+			break
+		}
+
+		scopes = append(scopes, "*."+parent)
+		host = parent
+	}
+
+	return scopes
+}
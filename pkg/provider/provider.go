@@ -0,0 +1,117 @@
+// Package provider allows consumers like CRI-O tests, admission webhooks and
+// fleet tooling to reason about the output of the credential provider without
+// running it.
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/cri-o/crio-credential-provider/pkg/auth"
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+	"github.com/cri-o/crio-credential-provider/pkg/mirrors"
+	"github.com/cri-o/crio-credential-provider/pkg/reference"
+)
+
+// File is an auth file the credential provider writes for an image.
+type File struct {
+	// Image is the image key the auth file is written for, see
+	// reference.Key.
+	Image string `json:"image"`
+
+	// Path is the path of the auth file within the auth directory.
+	Path string `json:"path"`
+
+	// Outputs are the paths of the auth file within the additional auth
+	// directories.
+	Outputs []string `json:"outputs,omitempty"`
+
+	// Mirrors are the locations of the mirrors receiving the credentials,
+	// which are the candidate keys of the auth file. Only the ones matched
+	// by any pull secret of the namespace end up in the auth file.
+	Mirrors []string `json:"mirrors"`
+}
+
+// Plan returns the auth files the credential provider writes for the images
+// pulled within the namespace, in the order of the images. Images without
+// allowed mirrors result in no auth file, like images pulled multiple times
+// result in a single one. Namespaces the provider is not enabled for result
+// in no auth files at all. Nothing gets written, but the integrity key has to
+// exist if the namespaces are hashed.
+//
+// The plan is based on the node configuration only: registry credential
+// policies of the cluster and the pull secrets are not considered, which
+// means that the auth file may be denied or not written at all because no
+// secret matches.
+func Plan(namespace string, images []string, cfg *config.Config) ([]File, error) {
+	if namespace == "" {
+		return nil, errors.New("no namespace provided")
+	}
+
+	files := []File{}
+
+	// The provider stops without registries configuration, while the audit
+	// mode and namespaces which are not enabled do not write into the auth
+	// directories
+	if cfg.Audit.Enabled || !cfg.Namespaces.Allows(namespace) {
+		return files, nil
+	}
+
+	if _, err := os.Stat(cfg.RegistriesConfPath); err != nil {
+		if os.IsNotExist(err) {
+			return files, nil
+		}
+
+		return nil, fmt.Errorf("unable to access registries conf path %q: %w", cfg.RegistriesConfPath, err)
+	}
+
+	fileNamespace := namespace
+
+	if cfg.HashNamespaces {
+		key, err := auth.ReadKey(cfg.IntegrityKeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("unable to hash namespace: %w", err)
+		}
+
+		fileNamespace = auth.NamespaceHash(key, namespace)
+	}
+
+	planned := map[string]bool{}
+
+	for _, image := range images {
+		image = reference.Key(image)
+
+		sources, err := mirrors.Resolve(image, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("unable to resolve pull sources of %q: %w", image, err)
+		}
+
+		allowedMirrors := mirrors.Mirrors(sources)
+		if len(allowedMirrors) == 0 {
+			continue
+		}
+
+		path, err := cfg.Naming.FilePath(cfg.AuthDir, fileNamespace, image)
+		if err != nil {
+			return nil, fmt.Errorf("unable to get auth file path of %q: %w", image, err)
+		}
+
+		if planned[path] {
+			continue
+		}
+
+		planned[path] = true
+
+		file := File{Image: image, Path: path, Mirrors: allowedMirrors}
+
+		for i := range cfg.Outputs {
+			file.Outputs = append(file.Outputs, filepath.Join(cfg.Outputs[i].Dir, filepath.Base(path)))
+		}
+
+		files = append(files, file)
+	}
+
+	return files, nil
+}
@@ -0,0 +1,126 @@
+package provider
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cri-o/crio-credential-provider/pkg/auth"
+	"github.com/cri-o/crio-credential-provider/pkg/config"
+)
+
+const registriesConf = `[[registry]]
+location = "docker.io"
+
+  [[registry.mirror]]
+  location = "mirror.local"
+
+[[registry]]
+location = "quay.io/org"
+
+  [[registry.mirror]]
+  location = "mirror.local/org"
+
+  [[registry.mirror]]
+  location = "backup.local/org"
+`
+
+func testConfig(t *testing.T) *config.Config {
+	t.Helper()
+
+	dir := t.TempDir()
+
+	cfg := config.Default()
+	cfg.RegistriesConfPath = filepath.Join(dir, "registries.conf")
+	cfg.AuthDir = filepath.Join(dir, "auth")
+	cfg.IntegrityKeyPath = filepath.Join(dir, "integrity.key")
+
+	require.NoError(t, os.WriteFile(cfg.RegistriesConfPath, []byte(registriesConf), 0o600))
+
+	return cfg
+}
+
+func TestPlan(t *testing.T) {
+	t.Parallel()
+
+	cfg := testConfig(t)
+	cfg.Outputs = []config.Output{{Dir: "/run/containerd/auth"}}
+
+	files, err := Plan("default", []string{"docker.io/nginx", "docker.io/library/nginx", "quay.io/org/app", "ghcr.io/org/app"}, cfg)
+	require.NoError(t, err)
+
+	nginxPath, err := auth.FilePath(cfg.AuthDir, "default", "docker.io/library/nginx")
+	require.NoError(t, err)
+
+	appPath, err := auth.FilePath(cfg.AuthDir, "default", "quay.io/org/app")
+	require.NoError(t, err)
+
+	assert.Equal(t, []File{
+		{
+			Image:   "docker.io/library/nginx",
+			Path:    nginxPath,
+			Outputs: []string{filepath.Join("/run/containerd/auth", filepath.Base(nginxPath))},
+			Mirrors: []string{"mirror.local"},
+		},
+		{
+			Image:   "quay.io/org/app",
+			Path:    appPath,
+			Outputs: []string{filepath.Join("/run/containerd/auth", filepath.Base(appPath))},
+			Mirrors: []string{"mirror.local/org", "backup.local/org"},
+		},
+	}, files)
+
+	_, err = os.Stat(cfg.AuthDir)
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	_, err = Plan("", []string{"quay.io/org/app"}, cfg)
+	require.Error(t, err)
+}
+
+func TestPlanHashedNamespaces(t *testing.T) {
+	t.Parallel()
+
+	cfg := testConfig(t)
+	cfg.HashNamespaces = true
+
+	_, err := Plan("default", []string{"quay.io/org/app"}, cfg)
+	require.Error(t, err)
+
+	require.NoError(t, os.WriteFile(cfg.IntegrityKeyPath, []byte("key"), 0o600))
+
+	files, err := Plan("default", []string{"quay.io/org/app"}, cfg)
+	require.NoError(t, err)
+
+	path, err := auth.HashedFilePath(cfg.AuthDir, "default", "quay.io/org/app", []byte("key"))
+	require.NoError(t, err)
+
+	require.Len(t, files, 1)
+	assert.Equal(t, path, files[0].Path)
+}
+
+func TestPlanWithoutRegistriesConf(t *testing.T) {
+	t.Parallel()
+
+	cfg := testConfig(t)
+	cfg.RegistriesConfPath = filepath.Join(t.TempDir(), "missing.conf")
+
+	files, err := Plan("default", []string{"quay.io/org/app"}, cfg)
+	require.NoError(t, err)
+	assert.Empty(t, files)
+}
+
+func TestPlanNamespaces(t *testing.T) {
+	t.Parallel()
+
+	cfg := testConfig(t)
+	cfg.Namespaces = config.Namespaces{Include: []string{"team-*"}, Exclude: []string{"team-legacy"}}
+
+	for namespace, expected := range map[string]int{"team-a": 1, "team-legacy": 0, "default": 0} {
+		files, err := Plan(namespace, []string{"quay.io/org/app"}, cfg)
+		require.NoError(t, err)
+		assert.Len(t, files, expected, namespace)
+	}
+}
@@ -0,0 +1,104 @@
+// Package reference contains the normalization of image references shared
+// by the credential provider and its consumers, like CRI-O computing the auth
+// file path. All of them have to agree on the key of an image, otherwise the
+// auth file written for it would never be found.
+package reference
+
+import (
+	"fmt"
+	"strings"
+
+	"go.podman.io/image/v5/docker/reference"
+)
+
+// defaultTag is the tag the kubelet and CRI-O pull images without tag and
+// digest by.
+const defaultTag = "latest"
+
+// Reference is a normalized image reference.
+type Reference struct {
+	named reference.Named
+}
+
+// Parse normalizes the image the same way as the kubelet, which qualifies
+// Docker Hub images like "nginx" as "docker.io/library/nginx".
+func Parse(image string) (*Reference, error) {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return nil, fmt.Errorf("parse image reference %q: %w", image, err)
+	}
+
+	return &Reference{named: named}, nil
+}
+
+// Named returns the normalized reference without defaulting the tag.
+func (r *Reference) Named() reference.Named {
+	return r.named
+}
+
+// Domain returns the registry host of the reference, like "docker.io".
+func (r *Reference) Domain() string {
+	return reference.Domain(r.named)
+}
+
+// Name returns the image name without tag and digest, which is the image the
+// kubelet passes to the credential providers.
+func (r *Reference) Name() string {
+	return r.named.Name()
+}
+
+// Tag returns the tag of the reference, which defaults to "latest" if it has
+// neither a tag nor a digest. It is empty for references by digest only.
+func (r *Reference) Tag() string {
+	if tagged, ok := reference.TagNameOnly(r.named).(reference.Tagged); ok {
+		return tagged.Tag()
+	}
+
+	return ""
+}
+
+// Digest returns the digest of the reference, or an empty string if it has
+// none.
+func (r *Reference) Digest() string {
+	if digested, ok := r.named.(reference.Digested); ok {
+		return digested.Digest().String()
+	}
+
+	return ""
+}
+
+// String returns the fully qualified reference with the defaulted tag, which
+// is the image CRI-O pulls.
+func (r *Reference) String() string {
+	return reference.TagNameOnly(r.named).String()
+}
+
+// Registry returns the registry host of the image and true if the image
+// contains one. Images without registry host, like "nginx" or "org/app", get
+// resolved by CRI-O using the unqualified-search-registries.
+func Registry(image string) (string, bool) {
+	host, _, ok := strings.Cut(image, "/")
+	if ok && (strings.ContainsAny(host, ".:[") || host == "localhost") {
+		return host, true
+	}
+
+	return "", false
+}
+
+// Key returns the key identifying the image across all components. Images
+// with registry host get normalized without defaulting the tag, which keeps
+// the image names passed by the kubelet unchanged while mapping references
+// like "docker.io/nginx" to the same key. Unqualified images resolve to
+// multiple registries and are kept like unparsable ones unchanged.
+func Key(image string) string {
+	if _, ok := Registry(image); !ok {
+		return image
+	}
+
+	ref, err := Parse(image)
+	if err != nil {
+		return image
+	}
+
+	return ref.named.String()
+}
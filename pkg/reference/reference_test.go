@@ -0,0 +1,104 @@
+package reference
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	const digest = "sha256:2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+
+	for name, tc := range map[string]struct {
+		image, domain, name, tag, digest, expected string
+	}{
+		"unqualified Docker Hub image": {
+			image:    "nginx",
+			domain:   "docker.io",
+			name:     "docker.io/library/nginx",
+			tag:      "latest",
+			expected: "docker.io/library/nginx:latest",
+		},
+		"legacy Docker Hub domain": {
+			image:    "index.docker.io/org/app:v1",
+			domain:   "docker.io",
+			name:     "docker.io/org/app",
+			tag:      "v1",
+			expected: "docker.io/org/app:v1",
+		},
+		"registry with port": {
+			image:    "localhost:5000/app",
+			domain:   "localhost:5000",
+			name:     "localhost:5000/app",
+			tag:      "latest",
+			expected: "localhost:5000/app:latest",
+		},
+		"digest": {
+			image:    "quay.io/org/app@" + digest,
+			domain:   "quay.io",
+			name:     "quay.io/org/app",
+			digest:   digest,
+			expected: "quay.io/org/app@" + digest,
+		},
+		"tag and digest": {
+			image:    "quay.io/org/app:v1@" + digest,
+			domain:   "quay.io",
+			name:     "quay.io/org/app",
+			tag:      "v1",
+			digest:   digest,
+			expected: "quay.io/org/app:v1@" + digest,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ref, err := Parse(tc.image)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.domain, ref.Domain())
+			assert.Equal(t, tc.name, ref.Name())
+			assert.Equal(t, tc.tag, ref.Tag())
+			assert.Equal(t, tc.digest, ref.Digest())
+			assert.Equal(t, tc.expected, ref.String())
+		})
+	}
+
+	_, err := Parse("Invalid:Image")
+	require.Error(t, err)
+}
+
+func TestRegistry(t *testing.T) {
+	t.Parallel()
+
+	for image, expected := range map[string]string{
+		"nginx":                  "",
+		"org/app":                "",
+		"quay.io/org/app":        "quay.io",
+		"localhost/app":          "localhost",
+		"registry:5000/app":      "registry:5000",
+		"[2001:db8::1]:5000/app": "[2001:db8::1]:5000",
+	} {
+		registry, ok := Registry(image)
+		assert.Equal(t, expected, registry, image)
+		assert.Equal(t, expected != "", ok, image)
+	}
+}
+
+func TestKey(t *testing.T) {
+	t.Parallel()
+
+	for image, expected := range map[string]string{
+		"docker.io/library/nginx":       "docker.io/library/nginx",
+		"docker.io/nginx":               "docker.io/library/nginx",
+		"index.docker.io/library/nginx": "docker.io/library/nginx",
+		"quay.io/org/app:v1":            "quay.io/org/app:v1",
+		"nginx":                         "nginx",
+		"org/app":                       "org/app",
+		"quay.io/Invalid":               "quay.io/Invalid",
+	} {
+		assert.Equal(t, expected, Key(image), image)
+	}
+}